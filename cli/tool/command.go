@@ -0,0 +1,232 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/krotik/ecal/config"
+)
+
+/*
+DefaultCommand is the command which is run if no command is given.
+*/
+const DefaultCommand = "console"
+
+/*
+Command is a subcommand of the ecal tool.
+*/
+type Command struct {
+	Name    string                    // Name of the command
+	Aliases []string                  // Alternative names of the command
+	Desc    string                    // Short description which is shown in the usage message
+	Run     func(args []string) error // Function which runs the command with its arguments
+}
+
+/*
+commands are all registered commands (name or alias -> command)
+*/
+var commands = make(map[string]*Command)
+
+/*
+commandsLock is the lock for registered commands
+*/
+var commandsLock = &sync.RWMutex{}
+
+/*
+Register the built-in commands
+*/
+func init() {
+	for _, c := range []*Command{
+		{"console", nil, "Interactive console (default)", func(args []string) error {
+			return NewCLIInterpreter().Interpret(true)
+		}},
+		{"run", nil, "Execute ECAL code", func(args []string) error {
+			return NewCLIInterpreter().Interpret(false)
+		}},
+		{"debug", nil, "Run in debug mode", func(args []string) error {
+			return NewCLIDebugInterpreter(NewCLIInterpreter()).Interpret()
+		}},
+		{"doc", nil, "Generate documentation for ECAL code", func(args []string) error {
+			return Doc()
+		}},
+		{"format", []string{"fmt"}, "Format all ECAL files in a directory structure", func(args []string) error {
+			return Format()
+		}},
+		{"graph", nil, "Export the dependency graph of all sinks in ECAL code", func(args []string) error {
+			return Graph()
+		}},
+		{"lint", nil, "Check all ECAL files in a directory structure for problems", func(args []string) error {
+			return Lint()
+		}},
+		{"pack", nil, "Create a single executable from ECAL code", func(args []string) error {
+			return NewCLIPacker().Pack()
+		}},
+		{"test", nil, "Run the tests in all ECAL test files in a directory structure", func(args []string) error {
+			return Test()
+		}},
+	} {
+		RegisterCommand(c)
+	}
+}
+
+/*
+RegisterCommand registers a command of the ecal tool. Embedding applications
+can add their own commands or replace built-in commands. A command which is
+registered under an existing name or alias replaces the existing command.
+*/
+func RegisterCommand(cmd *Command) error {
+
+	if cmd.Name == "" || cmd.Run == nil {
+		return fmt.Errorf("Command needs a name and a run function")
+	}
+
+	commandsLock.Lock()
+	defer commandsLock.Unlock()
+
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		if old, ok := commands[name]; ok {
+
+			// Remove all names of the replaced command
+
+			for n, c := range commands {
+				if c == old {
+					delete(commands, n)
+				}
+			}
+		}
+	}
+
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		commands[name] = cmd
+	}
+
+	return nil
+}
+
+/*
+Commands returns all registered commands sorted by name.
+*/
+func Commands() []*Command {
+	var res []*Command
+
+	commandsLock.RLock()
+	defer commandsLock.RUnlock()
+
+	for name, c := range commands {
+		if name == c.Name {
+			res = append(res, c)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res
+}
+
+/*
+Main runs the ecal tool with the given command line arguments. The first
+argument is the name of the binary and the second the name of the command.
+Each command gets a new command line flag set so it can define its own flags.
+*/
+func Main(args []string) error {
+	var err error
+	var name string
+
+	osArgs = args
+	out := flag.CommandLine.Output()
+
+	// Parse the command bit
+
+	flag.CommandLine = flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flag.CommandLine.SetOutput(out)
+	flag.CommandLine.Usage = func() {
+		usage(args[0])
+	}
+
+	if err = flag.CommandLine.Parse(args[1:]); err == nil {
+
+		if name = DefaultCommand; len(flag.Args()) > 0 {
+			name = flag.Args()[0]
+		}
+
+		commandsLock.RLock()
+		cmd, ok := commands[name]
+		commandsLock.RUnlock()
+
+		if !ok {
+			usage(args[0])
+			return nil
+		}
+
+		// Command arguments always start at the third position (also for
+		// the default command)
+
+		if len(flag.Args()) > 0 {
+			osArgs = append([]string{args[0], name}, flag.Args()[1:]...)
+		} else {
+			osArgs = []string{args[0], name}
+		}
+
+		flag.CommandLine = flag.NewFlagSet(fmt.Sprintf("%s %s", args[0], name), flag.ContinueOnError)
+		flag.CommandLine.SetOutput(out)
+
+		err = cmd.Run(osArgs[2:])
+
+	} else if err == flag.ErrHelp {
+		err = nil
+	}
+
+	return err
+}
+
+/*
+usage prints the usage message of the ecal tool.
+*/
+func usage(binary string) {
+	out := flag.CommandLine.Output()
+
+	fmt.Fprintln(out, fmt.Sprintf("Usage of %s <tool>", binary))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, fmt.Sprintf("ECAL %v - Event Condition Action Language", config.ProductVersion))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Available commands:")
+	fmt.Fprintln(out)
+
+	var names []string
+
+	width := 0
+	cmds := Commands()
+
+	for _, c := range cmds {
+		name := strings.Join(append([]string{c.Name}, c.Aliases...), ", ")
+
+		if len(name) > width {
+			width = len(name)
+		}
+
+		names = append(names, name)
+	}
+
+	for i, c := range cmds {
+		fmt.Fprintln(out, fmt.Sprintf("    %-*v   %v", width, names[i], c.Desc))
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, fmt.Sprintf("Use %s <command> -help for more information about a given command.", binary))
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,118 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	out := bytes.Buffer{}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	format := commands["format"]
+
+	defer func() {
+		RegisterCommand(format)
+		delete(commands, "hello")
+		delete(commands, "hi")
+		delete(commands, "greet")
+	}()
+
+	var names []string
+	for _, c := range Commands() {
+		names = append(names, c.Name)
+	}
+
+	if res := fmt.Sprint(names); res != "[console debug doc format graph lint pack run test]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := Main([]string{"foo", "bar"}); err != nil || !strings.Contains(out.String(), "    format, fmt   Format all ECAL files") {
+		t.Error("Unexpected result:", err, out.String())
+		return
+	}
+
+	if err := RegisterCommand(&Command{Name: "hello"}); err == nil || err.Error() != "Command needs a name and a run function" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Register a command with its own flags
+
+	var res string
+
+	hello := &Command{"hello", []string{"hi"}, "Say hello", func(args []string) error {
+		name := flag.String("name", "world", "Name to greet")
+
+		if err := flag.CommandLine.Parse(args); err != nil {
+			return err
+		}
+
+		res = fmt.Sprintf("hello %v %v", *name, flag.Args())
+
+		if *name == "error" {
+			return fmt.Errorf("Greeting failed")
+		}
+
+		return nil
+	}}
+
+	if err := RegisterCommand(hello); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := Main([]string{"foo", "hi", "-name", "ecal", "x"}); err != nil || res != "hello ecal [x]" {
+		t.Error("Unexpected result:", err, res)
+		return
+	}
+
+	// Flags of one command run are not visible to the next
+
+	if err := Main([]string{"foo", "hello"}); err != nil || res != "hello world []" {
+		t.Error("Unexpected result:", err, res)
+		return
+	}
+
+	if err := Main([]string{"foo", "hello", "-name", "error"}); err == nil || err.Error() != "Greeting failed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Commands can be replaced
+
+	if err := RegisterCommand(&Command{"greet", []string{"fmt"}, "Greet", func(args []string) error {
+		res = "greet"
+		return nil
+	}}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := Main([]string{"foo", "fmt"}); err != nil || res != "greet" {
+		t.Error("Unexpected result:", err, res)
+		return
+	}
+
+	if _, ok := commands["format"]; ok {
+		t.Error("Replaced command should be removed")
+		return
+	}
+}
@@ -13,11 +13,13 @@ package tool
 import (
 	"bufio"
 	"bytes"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"strings"
@@ -38,23 +40,31 @@ type CLIDebugInterpreter struct {
 
 	// Parameter these can either be set programmatically or via CLI args
 
-	DebugServerAddr *string // Debug server address
-	RunDebugServer  *bool   // Run a debug server
-	EchoDebugServer *bool   // Echo all input and output of the debug server
-	Interactive     *bool   // Flag if the interpreter should open a console in the current tty.
-	BreakOnStart    *bool   // Flag if the debugger should stop the execution on start
-	BreakOnError    *bool   // Flag if the debugger should stop when encountering an error
+	DebugServerAddr  *string // Debug server address
+	DebugServerToken *string // Token which clients of the debug server must send to authenticate (blank for no authentication)
+	RunDebugServer   *bool   // Run a debug server
+	EchoDebugServer  *bool   // Echo all input and output of the debug server
+	Interactive      *bool   // Flag if the interpreter should open a console in the current tty.
+	BreakOnStart     *bool   // Flag if the debugger should stop the execution on start
+	BreakOnError     *bool   // Flag if the debugger should stop when encountering an error
+	HistorySize      *int    // Number of states which are recorded for each thread
+	TUI              *bool   // Flag if the debugger user interface should be shown in the console
+	Session          *string // File which stores break points and settings between debugging sessions
+	Script           *string // File with debug commands which are run on start
 
 	LogOut io.Writer // Log output
 
 	debugServer *debugTelnetServer // Debug server if started
+	tui         *debugTUI          // Debugger user interface if shown
+	tuiStop     chan struct{}      // Channel which is closed to stop redrawing the user interface
 }
 
 /*
 NewCLIDebugInterpreter wraps an existing CLIInterpreter object and adds capabilities.
 */
 func NewCLIDebugInterpreter(i *CLIInterpreter) *CLIDebugInterpreter {
-	return &CLIDebugInterpreter{i, nil, nil, nil, nil, nil, nil, os.Stdout, nil}
+	return &CLIDebugInterpreter{i, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil,
+		os.Stdout, nil, nil, nil}
 }
 
 /*
@@ -67,11 +77,17 @@ func (i *CLIDebugInterpreter) ParseArgs() bool {
 	}
 
 	i.DebugServerAddr = flag.String("serveraddr", "localhost:33274", "Debug server address") // Think BERTA
+	i.DebugServerToken = flag.String("servertoken", os.Getenv("ECAL_DEBUG_TOKEN"),
+		"Token which clients of the debug server must send to authenticate (default: value of ECAL_DEBUG_TOKEN)")
 	i.RunDebugServer = flag.Bool("server", false, "Run a debug server")
 	i.EchoDebugServer = flag.Bool("echo", false, "Echo all i/o of the debug server")
 	i.Interactive = flag.Bool("interactive", true, "Run interactive console")
 	i.BreakOnStart = flag.Bool("breakonstart", false, "Stop the execution on start")
 	i.BreakOnError = flag.Bool("breakonerror", false, "Stop the execution when encountering an error")
+	i.HistorySize = flag.Int("historysize", 10, "Number of states which are recorded for each thread (0 to disable)")
+	i.TUI = flag.Bool("tui", false, "Show source, threads and variables side by side in the interactive console")
+	i.Session = flag.String("session", "", "File which stores breakpoints and settings between debugging sessions")
+	i.Script = flag.String("script", "", "File with debug commands which are run on start")
 
 	return i.CLIInterpreter.ParseArgs()
 }
@@ -85,6 +101,8 @@ func (i *CLIDebugInterpreter) Interpret() error {
 		return nil
 	}
 
+	var serverDone chan bool
+
 	err := i.CreateRuntimeProvider("debug console")
 
 	if err == nil {
@@ -96,13 +114,33 @@ func (i *CLIDebugInterpreter) Interpret() error {
 			i.CLIInterpreter.CustomWelcomeMessage += fmt.Sprintf("with debug server on %v - ", *i.DebugServerAddr)
 		}
 		i.CLIInterpreter.CustomWelcomeMessage += "prefix debug commands with ##"
-		i.CustomHelpString = "    @dbg [glob] - List all available debug commands.\n"
+		i.CustomHelpString = "    @dbg [glob] - List all available debug commands.\n" +
+			"    @tui [on|off] - Show source, threads and variables side by side (debug commands are prefixed with #).\n"
 
 		// Set debug object on the runtime provider
 
 		i.RuntimeProvider.Debugger = interpreter.NewECALDebugger(i.GlobalVS)
 		i.RuntimeProvider.Debugger.BreakOnStart(*i.BreakOnStart)
 		i.RuntimeProvider.Debugger.BreakOnError(*i.BreakOnError)
+		i.RuntimeProvider.Debugger.SetHistorySize(*i.HistorySize)
+
+		// Restore the previous debugging session and run the startup script
+
+		if err = i.LoadDebugSession(); err != nil {
+			return err
+		}
+
+		if i.Session != nil && *i.Session != "" {
+			defer func() {
+				if serr := i.SaveDebugSession(); serr != nil {
+					fmt.Fprintln(i.LogOut, fmt.Sprint("Could not save debug session: ", serr))
+				}
+			}()
+		}
+
+		if err = i.RunDebugScript(); err != nil {
+			return err
+		}
 
 		// Set this object as a custom handler to deal with input.
 
@@ -113,11 +151,19 @@ func (i *CLIDebugInterpreter) Interpret() error {
 			// Start the debug server
 
 			i.debugServer = &debugTelnetServer{*i.DebugServerAddr, "ECALDebugServer: ",
-				nil, true, *i.EchoDebugServer, i, i.RuntimeProvider.Logger}
+				nil, true, *i.EchoDebugServer, i, i.RuntimeProvider.Logger, ""}
+
+			if i.DebugServerToken != nil {
+				i.debugServer.token = *i.DebugServerToken
+			}
 
 			wg := &sync.WaitGroup{}
 			wg.Add(1)
-			go i.debugServer.Run(wg)
+			serverDone = make(chan bool)
+			go func() {
+				i.debugServer.Run(wg)
+				close(serverDone)
+			}()
 			wg.Wait()
 
 			if *i.Interactive {
@@ -125,7 +171,20 @@ func (i *CLIDebugInterpreter) Interpret() error {
 			}
 		}
 
+		if i.TUI != nil && *i.TUI && *i.Interactive {
+			i.startTUI()
+			defer i.stopTUI()
+		}
+
 		err = i.CLIInterpreter.Interpret(*i.Interactive)
+
+		if err == nil && serverDone != nil && !*i.Interactive {
+
+			// Keep serving debug clients (e.g. of a long running service)
+			// until the debug server is stopped
+
+			<-serverDone
+		}
 	}
 
 	return err
@@ -151,11 +210,110 @@ func (i *CLIDebugInterpreter) LoadInitialFile(tid uint64) error {
 	return nil
 }
 
+/*
+LoadDebugSession restores the break points and settings of the debugger from
+the session file. Nothing is restored if the session file does not exist yet.
+Relative paths are relative to the root directory of the interpreter.
+*/
+func (i *CLIDebugInterpreter) LoadDebugSession() error {
+	var err error
+
+	if i.Session != nil && *i.Session != "" {
+		file := i.snapshotPath(*i.Session)
+
+		if _, serr := os.Stat(file); serr == nil {
+			err = interpreter.LoadDebugSession(i.RuntimeProvider.Debugger, file)
+		}
+	}
+
+	return err
+}
+
+/*
+SaveDebugSession writes the break points and settings of the debugger to the
+session file.
+*/
+func (i *CLIDebugInterpreter) SaveDebugSession() error {
+	var err error
+
+	if i.Session != nil && *i.Session != "" {
+		err = interpreter.SaveDebugSession(i.RuntimeProvider.Debugger, i.snapshotPath(*i.Session))
+	}
+
+	return err
+}
+
+/*
+RunDebugScript runs all debug commands of the startup script. Each line of the
+script contains a debug command (the ## prefix is optional). Empty lines and
+lines starting with a single # are ignored. Relative paths are relative to the
+root directory of the interpreter.
+*/
+func (i *CLIDebugInterpreter) RunDebugScript() error {
+	var data []byte
+	var err error
+
+	if i.Script == nil || *i.Script == "" {
+		return nil
+	}
+
+	file := i.snapshotPath(*i.Script)
+
+	if data, err = ioutil.ReadFile(file); err == nil {
+		for n, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+
+			if strings.HasPrefix(line, "##") {
+				line = strings.TrimSpace(line[2:])
+			} else if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			if _, err = i.RuntimeProvider.Debugger.HandleInput(line); err != nil {
+				return fmt.Errorf("Error in debug script %v line %v: %v", file, n+1, err)
+			}
+		}
+	}
+
+	return err
+}
+
+/*
+startTUI shows the debugger user interface. The screen is redrawn when the
+state of the debugger changes.
+*/
+func (i *CLIDebugInterpreter) startTUI() {
+	if i.tui != nil {
+		return
+	}
+
+	i.tui = newDebugTUI(i)
+	i.tuiStop = make(chan struct{})
+
+	go i.tui.Watch(func() OutputTerminal {
+		if i.Term == nil {
+			return nil
+		}
+		return i.Term
+	}, i.tuiStop)
+}
+
+/*
+stopTUI hides the debugger user interface.
+*/
+func (i *CLIDebugInterpreter) stopTUI() {
+	if i.tui != nil {
+		close(i.tuiStop)
+		i.tui = nil
+	}
+}
+
 /*
 CanHandle checks if a given string can be handled by this handler.
 */
 func (i *CLIDebugInterpreter) CanHandle(s string) bool {
-	return strings.HasPrefix(s, "##") || strings.HasPrefix(s, "@dbg")
+	return strings.HasPrefix(s, "##") || strings.HasPrefix(s, "@dbg") || strings.HasPrefix(s, "@tui") ||
+		(i.tui != nil && strings.HasPrefix(s, "#"))
 }
 
 /*
@@ -185,6 +343,20 @@ func (i *CLIDebugInterpreter) Handle(ot OutputTerminal, line string) {
 		}
 		ot.WriteString(fmt.Sprintln(fmt.Sprintln()))
 
+	} else if strings.HasPrefix(line, "@tui") {
+		args := strings.Fields(line)[1:]
+
+		if (len(args) == 0 && i.tui == nil) || (len(args) > 0 && args[0] == "on") {
+			i.startTUI()
+			i.tui.Draw(ot)
+		} else {
+			i.stopTUI()
+			ot.WriteString(fmt.Sprintln("Debugger user interface is hidden"))
+		}
+
+	} else if i.tui != nil {
+		i.handleTUIInput(ot, line)
+
 	} else {
 		res, err := i.RuntimeProvider.Debugger.HandleInput(strings.TrimSpace(line[2:]))
 
@@ -207,6 +379,34 @@ func (i *CLIDebugInterpreter) Handle(ot OutputTerminal, line string) {
 	}
 }
 
+/*
+handleTUIInput handles input while the debugger user interface is shown. The
+result of debug commands is shown below the panels and the screen is redrawn.
+*/
+func (i *CLIDebugInterpreter) handleTUIInput(ot OutputTerminal, line string) {
+
+	if strings.HasPrefix(line, "##") {
+		res, err := i.RuntimeProvider.Debugger.HandleInput(strings.TrimSpace(line[2:]))
+
+		if err == nil {
+			var outBytes []byte
+
+			if outBytes, err = json.Marshal(res); err == nil {
+				i.tui.SetMessage(string(outBytes))
+			}
+		}
+
+		if err != nil {
+			i.tui.SetMessage(fmt.Sprintf("DebuggerError: %v", err))
+		}
+
+	} else if !i.tui.Handle(line) {
+		i.tui.SetMessage(fmt.Sprintf("Unknown command: %v", line))
+	}
+
+	i.tui.Draw(ot)
+}
+
 /*
 debugTelnetServer is a simple telnet server to send and receive debug data.
 */
@@ -218,8 +418,14 @@ type debugTelnetServer struct {
 	echo        bool
 	interpreter *CLIDebugInterpreter
 	logger      util.Logger
+	token       string // Token which clients must send to authenticate (blank for no authentication)
 }
 
+/*
+debugAuthTimeout is the time a client has to authenticate after connecting.
+*/
+var debugAuthTimeout = 10 * time.Second
+
 /*
 Run runs the debug server.
 */
@@ -273,6 +479,12 @@ func (s *debugTelnetServer) HandleConnection(conn net.Conn) {
 		fmt.Fprintln(s.interpreter.LogOut, fmt.Sprintf("%v : Connected", conn.RemoteAddr()))
 	}
 
+	if s.token != "" && !s.authenticate(conn, inputReader, outputTerminal) {
+		s.logger.LogInfo(s.logPrefix, "Authentication failed for ", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
 	for {
 		var outBytes []byte
 		var err error
@@ -334,6 +546,39 @@ func (s *debugTelnetServer) HandleConnection(conn net.Conn) {
 	conn.Close()
 }
 
+/*
+authenticate reads the first line of a connection and checks if it contains
+the expected token in the form: auth <token>
+*/
+func (s *debugTelnetServer) authenticate(conn net.Conn, inputReader *bufio.Reader, ot OutputTerminal) bool {
+	var res interface{}
+
+	conn.SetReadDeadline(time.Now().Add(debugAuthTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	line, err := inputReader.ReadString('\n')
+	line = strings.TrimSpace(line)
+
+	ok := err == nil && strings.HasPrefix(line, "auth ") &&
+		subtle.ConstantTimeCompare([]byte(strings.TrimSpace(line[5:])), []byte(s.token)) == 1
+
+	if ok {
+		res = map[string]interface{}{
+			"Authenticated": true,
+		}
+	} else {
+		res = map[string]interface{}{
+			"DebuggerError": "Authentication failed",
+		}
+	}
+
+	outBytes, err := json.MarshalIndent(res, "", "  ")
+	errorutil.AssertOk(err)
+	ot.WriteString(fmt.Sprintln(fmt.Sprintln(string(outBytes))))
+
+	return ok
+}
+
 /*
 bufioWriterShim is a shim to allow a bufio.Writer to be used as an OutputTerminal.
 */
@@ -15,8 +15,10 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -133,6 +135,166 @@ func TestDebugInterpret(t *testing.T) {
 	}
 }
 
+func TestDebugSessionAndScript(t *testing.T) {
+	tdin := newTestDebugWithConfig()
+	defer tearDown()
+
+	if stop := tdin.ParseArgs(); stop {
+		t.Error("Setting default args should be fine")
+		return
+	}
+
+	if err := tdin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	tdin.RuntimeProvider.Logger = util.NewMemoryLogger(10)
+	tdin.RuntimeProvider.ImportLocator = &util.MemoryImportLocator{}
+
+	ioutil.WriteFile(filepath.Join(testDir, "script.txt"), []byte(`
+# Startup script
+break foo:1
+## break foo:2 if a > 1
+`), 0644)
+
+	l1 := ""
+	tdin.LogFile = &l1
+	tdin.LogLevel = &l1
+	l2 := true
+	tdin.Interactive = &l2
+	l3 := false
+	tdin.RunDebugServer = &l3
+	l4 := "session.json"
+	tdin.Session = &l4
+	l5 := "script.txt"
+	tdin.Script = &l5
+	l6 := testDir
+	tdin.Dir = &l6
+
+	testTerm.in = []string{"##break foo:3", "##disablebreak foo:1", "q"}
+
+	if err := tdin.Interpret(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(testDir, "session.json"))
+
+	if res := string(data); res != `{
+  "breakpoints": [
+    {
+      "source": "foo",
+      "line": 1,
+      "disabled": true
+    },
+    {
+      "source": "foo",
+      "line": 2,
+      "condition": "a \u003e 1"
+    },
+    {
+      "source": "foo",
+      "line": 3
+    }
+  ],
+  "breakonstart": false,
+  "breakonerror": false
+}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Restore the session in a new debugger without running the script
+
+	l5 = ""
+
+	testTerm.in = []string{"##rmbreak foo:2", "q"}
+
+	if err := tdin.Interpret(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if status := fmt.Sprint(tdin.RuntimeProvider.Debugger.Status().(map[string]interface{})["breakpoints"]); status !=
+		"map[foo:1:false foo:3:true]" {
+		t.Error("Unexpected result:", status)
+		return
+	}
+
+	// Test error handling
+
+	ioutil.WriteFile(filepath.Join(testDir, "script.txt"), []byte("\nbreak foo\n"), 0644)
+	l5 = "script.txt"
+
+	if err := tdin.Interpret(); err == nil || err.Error() != fmt.Sprintf(
+		"Error in debug script %v line 2: Invalid break target - should be <source>:<line>",
+		filepath.Join(testDir, "script.txt")) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	ioutil.WriteFile(filepath.Join(testDir, "session.json"), []byte("{"), 0644)
+
+	if err := tdin.Interpret(); err == nil || err.Error() != fmt.Sprintf(
+		"Could not parse debug session file %v: unexpected end of JSON input",
+		filepath.Join(testDir, "session.json")) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestDebugInterpretNonInteractive(t *testing.T) {
+	tdin := newTestDebugWithConfig()
+	defer tearDown()
+
+	if stop := tdin.ParseArgs(); stop {
+		t.Error("Setting default args should be fine")
+		return
+	}
+
+	if err := tdin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	tdin.RuntimeProvider.Logger, _ = util.NewLogLevelLogger(util.NewMemoryLogger(10), "info")
+	tdin.RuntimeProvider.ImportLocator = &util.MemoryImportLocator{}
+
+	l1 := ""
+	tdin.LogFile = &l1
+	l2 := ""
+	tdin.LogLevel = &l2
+	l3 := false
+	tdin.Interactive = &l3
+	l4 := true
+	tdin.RunDebugServer = &l4
+	l5 := "localhost:0"
+	tdin.DebugServerAddr = &l5
+
+	done := make(chan error)
+
+	go func() {
+		done <- tdin.Interpret()
+	}()
+
+	// The interpreter should keep running until the debug server is stopped
+
+	select {
+	case err := <-done:
+		t.Error("Interpreter returned early:", err)
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	tdin.StopDebugServer()
+
+	if err := <-done; err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
 func TestDebugHandleInput(t *testing.T) {
 	tdin := newTestDebugWithConfig()
 	defer tearDown()
@@ -219,6 +381,8 @@ func TestDebugHandleInput(t *testing.T) {
 
 	if testTerm.out.String() != `1
 ECAL error in foo (console input): 123 () (Line:1 Pos:1)
+   1 | raise(123)
+     | ^
 ` {
 		t.Error("Unexpected result:", testTerm.out.String())
 		return
@@ -326,7 +490,7 @@ func TestDebugTelnetServer(t *testing.T) {
 	line = strings.TrimSpace(line)
 
 	if line != `{
-  "EncodedOutput": "RUNBTCBlcnJvciBpbiBmb28gKGNvbnNvbGUgaW5wdXQpOiAxMjMgKCkgKExpbmU6MSBQb3M6MSkK"
+  "EncodedOutput": "RUNBTCBlcnJvciBpbiBmb28gKGNvbnNvbGUgaW5wdXQpOiAxMjMgKCkgKExpbmU6MSBQb3M6MSkKICAgMSB8IHJhaXNlKDEyMyk7MQogICAgIHwgXgo="
 }` {
 		t.Error("Unexpected output:", line)
 		return
@@ -394,3 +558,151 @@ func TestDebugTelnetServer(t *testing.T) {
 		return
 	}
 }
+
+func TestDebugTelnetServerAuthentication(t *testing.T) {
+	tdin := newTestDebugWithConfig()
+	defer tearDown()
+
+	if err := tdin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	tdin.RuntimeProvider.Logger = util.NewMemoryLogger(10)
+	tdin.RuntimeProvider.ImportLocator = &util.MemoryImportLocator{}
+	tdin.RuntimeProvider.Debugger = interpreter.NewECALDebugger(tdin.GlobalVS)
+	tdin.CustomHandler = tdin
+
+	mlog := util.NewMemoryLogger(10)
+
+	srv := &debugTelnetServer{
+		address:     "localhost:0",
+		logPrefix:   "testdebugserver",
+		listener:    nil,
+		listen:      true,
+		echo:        false,
+		interpreter: tdin,
+		logger:      mlog,
+		token:       "secret",
+	}
+	defer func() {
+		srv.listen = false
+		srv.listener.Close() // Attempt to cleanup
+	}()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go srv.Run(wg)
+	wg.Wait()
+
+	addr := srv.listener.Addr().String()
+
+	// Wrong token
+
+	conn, err := net.Dial("tcp", addr)
+	errorutil.AssertOk(err)
+	reader := bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "auth foo\n")
+
+	line, err := reader.ReadString('}')
+	errorutil.AssertOk(err)
+
+	if line != `{
+  "DebuggerError": "Authentication failed"
+}` {
+		t.Error("Unexpected output:", line)
+		return
+	}
+
+	// The connection should have been closed
+
+	if rest, err := ioutil.ReadAll(reader); string(rest) != "\n\n" || err != nil {
+		t.Error("Unexpected result:", rest, err)
+		return
+	}
+
+	// Command without authentication
+
+	conn, err = net.Dial("tcp", addr)
+	errorutil.AssertOk(err)
+	reader = bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "a:= 1; a\n")
+
+	line, err = reader.ReadString('}')
+	errorutil.AssertOk(err)
+
+	if line != `{
+  "DebuggerError": "Authentication failed"
+}` {
+		t.Error("Unexpected output:", line)
+		return
+	}
+
+	if tdin.GlobalVS.String() != `GlobalScope {
+}` {
+		t.Error("Unexpected result:", tdin.GlobalVS)
+		return
+	}
+
+	// No authentication within the timeout
+
+	debugAuthTimeout = 10 * time.Millisecond
+	defer func() {
+		debugAuthTimeout = 10 * time.Second
+	}()
+
+	conn, err = net.Dial("tcp", addr)
+	errorutil.AssertOk(err)
+	reader = bufio.NewReader(conn)
+
+	line, err = reader.ReadString('}')
+	errorutil.AssertOk(err)
+
+	if line != `{
+  "DebuggerError": "Authentication failed"
+}` {
+		t.Error("Unexpected output:", line)
+		return
+	}
+
+	debugAuthTimeout = 10 * time.Second
+
+	// Correct token
+
+	conn, err = net.Dial("tcp", addr)
+	errorutil.AssertOk(err)
+	reader = bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "auth secret\n")
+
+	line, err = reader.ReadString('}')
+	errorutil.AssertOk(err)
+
+	if line != `{
+  "Authenticated": true
+}` {
+		t.Error("Unexpected output:", line)
+		return
+	}
+
+	fmt.Fprintf(conn, "a:= 1; a\n")
+
+	line, err = reader.ReadString('}')
+	errorutil.AssertOk(err)
+
+	if strings.TrimSpace(line) != `{
+  "EncodedOutput": "MQo="
+}` {
+		t.Error("Unexpected output:", line)
+		return
+	}
+
+	conn.Close()
+
+	if !strings.Contains(mlog.String(), "Authentication failed for 127.0.0.1:") {
+		t.Error("Unexpected output:", mlog.String())
+		return
+	}
+}
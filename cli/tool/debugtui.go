@@ -0,0 +1,600 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krotik/ecal/util"
+)
+
+/*
+tuiRefreshInterval is the interval in which the debugger state is checked for
+changes which should be shown.
+*/
+var tuiRefreshInterval = 250 * time.Millisecond
+
+/*
+tuiClearScreen is the ANSI sequence which clears the terminal before the
+screen is drawn.
+*/
+const tuiClearScreen = "\x1b[H\x1b[2J"
+
+/*
+tuiHelp is the help line which is shown at the bottom of the screen.
+*/
+const tuiHelp = "#c cont  #s step in  #n step over  #o step out  #k kill  #t <tid> thread  " +
+	"#b <line> breakpoint  #f <source> [line] show source  @tui off"
+
+/*
+debugTUI is a text based user interface for the debugger. It shows the source
+code with breakpoints and the current line next to the threads, the call stack
+and the variables of a selected thread.
+*/
+type debugTUI struct {
+	interpreter *CLIDebugInterpreter // Debug interpreter which is shown
+	width       int                  // Width of the screen
+	height      int                  // Height of the screen
+	thread      uint64               // Selected thread (0 selects a suspended thread)
+	source      string               // Displayed source (blank shows the source of the selected thread)
+	line        int                  // Line which should be shown if the source has no current line
+	message     string               // Result of the last command
+	lastScreen  string               // Last drawn screen
+	lock        *sync.Mutex          // Lock for the user interface state
+}
+
+/*
+newDebugTUI creates a new text based user interface for a given debug
+interpreter. The screen size is taken from the environment variables COLUMNS
+and LINES.
+*/
+func newDebugTUI(i *CLIDebugInterpreter) *debugTUI {
+	width, height := 120, 32
+
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 40 {
+		width = w
+	}
+
+	if h, err := strconv.Atoi(os.Getenv("LINES")); err == nil && h > 10 {
+		height = h
+	}
+
+	return &debugTUI{i, width, height, 0, "", 1, "", "", &sync.Mutex{}}
+}
+
+/*
+Draw draws the screen on a given output terminal.
+*/
+func (t *debugTUI) Draw(ot OutputTerminal) {
+	screen := t.Render()
+
+	t.lock.Lock()
+	t.lastScreen = screen
+	t.lock.Unlock()
+
+	ot.WriteString(tuiClearScreen + screen)
+}
+
+/*
+Watch redraws the screen on a given output terminal when the state of the
+debugger changes (e.g. a thread was suspended). Blocks until the given stop
+channel is closed.
+*/
+func (t *debugTUI) Watch(ot func() OutputTerminal, stop <-chan struct{}) {
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if out := ot(); out != nil {
+			screen := t.Render()
+
+			t.lock.Lock()
+			changed := screen != t.lastScreen
+			t.lock.Unlock()
+
+			if changed {
+				t.Draw(out)
+			}
+		}
+	}
+}
+
+/*
+Handle handles a command of the user interface. Returns false if the given
+input is not a command of the user interface.
+*/
+func (t *debugTUI) Handle(line string) bool {
+	var msg string
+
+	debugger := t.interpreter.RuntimeProvider.Debugger
+
+	fields := strings.Fields(strings.TrimPrefix(line, "#"))
+
+	if len(fields) == 0 {
+		return false
+	}
+
+	tid := t.selectedThread(t.threads(debugger.Status()))
+
+	switch fields[0] {
+
+	case "c", "s", "n", "o", "k":
+		if tid == 0 {
+			msg = "No thread selected"
+		} else if fields[0] == "k" {
+			debugger.KillThread(tid)
+			msg = fmt.Sprintf("Killed thread %v", tid)
+		} else {
+			contType := map[string]util.ContType{
+				"c": util.Resume,
+				"s": util.StepIn,
+				"n": util.StepOver,
+				"o": util.StepOut,
+			}[fields[0]]
+
+			debugger.Continue(tid, contType)
+			msg = fmt.Sprintf("Continued thread %v", tid)
+
+			// Give the thread a chance to reach its next state before the
+			// screen is drawn
+
+			time.Sleep(50 * time.Millisecond)
+		}
+
+	case "t":
+		if len(fields) < 2 {
+			msg = "Need a thread ID"
+		} else if id, err := strconv.ParseUint(fields[1], 10, 64); err != nil {
+			msg = fmt.Sprintf("Invalid thread ID: %v", fields[1])
+		} else {
+			t.lock.Lock()
+			t.thread = id
+			t.source = ""
+			t.lock.Unlock()
+			msg = fmt.Sprintf("Selected thread %v", id)
+		}
+
+	case "b":
+		source, _ := t.displayedSource(debugger.Describe(tid))
+
+		if len(fields) < 2 {
+			msg = "Need a line number"
+		} else if l, err := strconv.Atoi(fields[1]); err != nil {
+			msg = fmt.Sprintf("Invalid line number: %v", fields[1])
+		} else if source == "" {
+			msg = "No source is shown"
+		} else if _, ok := t.breakpoints(debugger.Status(), source)[l]; ok {
+			debugger.RemoveBreakPoint(source, l)
+			msg = fmt.Sprintf("Removed breakpoint %v:%v", source, l)
+		} else {
+			debugger.SetBreakPoint(source, l, "", 0)
+			msg = fmt.Sprintf("Set breakpoint %v:%v", source, l)
+		}
+
+	case "f":
+		if len(fields) < 2 {
+			t.lock.Lock()
+			t.source = ""
+			t.lock.Unlock()
+			msg = "Showing the source of the selected thread"
+		} else {
+			l := 1
+
+			if len(fields) > 2 {
+				l, _ = strconv.Atoi(fields[2])
+			}
+
+			t.lock.Lock()
+			t.source = fields[1]
+			t.line = l
+			t.lock.Unlock()
+			msg = fmt.Sprintf("Showing %v", fields[1])
+		}
+
+	default:
+		return false
+	}
+
+	t.SetMessage(msg)
+
+	return true
+}
+
+/*
+SetMessage sets the message which is shown below the panels.
+*/
+func (t *debugTUI) SetMessage(msg string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.message = msg
+}
+
+/*
+Render renders the current state of the debugger as a screen.
+*/
+func (t *debugTUI) Render() string {
+	var buf strings.Builder
+
+	debugger := t.interpreter.RuntimeProvider.Debugger
+
+	status := debugger.Status()
+	threads := t.threads(status)
+	tid := t.selectedThread(threads)
+	describe := debugger.Describe(tid)
+
+	source, current := t.displayedSource(describe)
+	breakpoints := t.breakpoints(status, source)
+
+	t.lock.Lock()
+	message := t.message
+	line := t.line
+	t.lock.Unlock()
+
+	// Calculate the layout - the source panel takes 60% of the width
+
+	rows := t.height - 4
+	leftWidth := (t.width - 3) * 3 / 5
+	rightWidth := t.width - 3 - leftWidth
+
+	left := t.renderSource(source, current, line, breakpoints, leftWidth, rows)
+	right := t.renderThread(threads, tid, describe, rightWidth, rows)
+
+	leftTitle := "Source"
+	if source != "" {
+		leftTitle = fmt.Sprintf("Source: %v", source)
+	}
+
+	rightTitle := "Threads"
+	if tid != 0 {
+		rightTitle = fmt.Sprintf("Thread %v", tid)
+	}
+
+	buf.WriteString(fmt.Sprintf("┌%v┬%v┐\n", tuiTitle(leftTitle, leftWidth), tuiTitle(rightTitle, rightWidth)))
+
+	for r := 0; r < rows; r++ {
+		buf.WriteString(fmt.Sprintf("│%v│%v│\n", tuiCell(left[r], leftWidth), tuiCell(right[r], rightWidth)))
+	}
+
+	buf.WriteString(fmt.Sprintf("└%v┴%v┘\n", strings.Repeat("─", leftWidth), strings.Repeat("─", rightWidth)))
+	buf.WriteString(fmt.Sprintln(tuiCell(message, t.width)))
+	buf.WriteString(fmt.Sprintln(tuiCell(tuiHelp, t.width)))
+
+	return buf.String()
+}
+
+/*
+renderSource renders the lines of the source panel. The current line is marked
+with > and breakpoints with * (disabled breakpoints with o).
+*/
+func (t *debugTUI) renderSource(source string, current int, line int, breakpoints map[int]bool,
+	width int, rows int) []string {
+
+	res := make([]string, rows)
+
+	if source == "" {
+		res[0] = " No source to show"
+		return res
+	}
+
+	lines, err := t.sourceLines(source)
+
+	if err != nil {
+		res[0] = fmt.Sprintf(" Source is not available: %v", err)
+		return res
+	}
+
+	// Show the current line (or the requested line) in the middle of the panel
+
+	focus := line
+	if current > 0 {
+		focus = current
+	}
+
+	top := focus - rows/2
+	if top+rows-1 > len(lines) {
+		top = len(lines) - rows + 1
+	}
+	if top < 1 {
+		top = 1
+	}
+
+	for r := 0; r < rows && top+r <= len(lines); r++ {
+		n := top + r
+		marker := []rune("  ")
+
+		if active, ok := breakpoints[n]; ok {
+			marker[0] = 'o'
+			if active {
+				marker[0] = '*'
+			}
+		}
+
+		if n == current {
+			marker[1] = '>'
+		}
+
+		res[r] = fmt.Sprintf("%v%4d  %v", string(marker), n, strings.Replace(lines[n-1], "\t", "    ", -1))
+	}
+
+	return res
+}
+
+/*
+renderThread renders the lines of the thread panel which shows all threads
+and the call stack and variables of the selected thread.
+*/
+func (t *debugTUI) renderThread(threads map[uint64]map[string]interface{}, tid uint64,
+	describe interface{}, width int, rows int) []string {
+
+	var res []string
+	var ids []uint64
+
+	for id := range threads {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	res = append(res, " Threads")
+
+	if len(ids) == 0 {
+		res = append(res, "   No threads")
+	}
+
+	for _, id := range ids {
+		state := "running"
+		if tuiSuspended(threads[id]) {
+			state = "suspended"
+		}
+
+		marker := " "
+		if id == tid {
+			marker = ">"
+		}
+
+		res = append(res, fmt.Sprintf(" %v %v %v", marker, id, state))
+	}
+
+	if d, ok := describe.(map[string]interface{}); ok && d != nil {
+
+		if err, ok := d["error"]; ok && err != nil {
+			res = append(res, "", fmt.Sprintf(" Error: %v", err))
+		}
+
+		if cs, ok := d["callStack"].([]string); ok && len(cs) > 0 {
+			res = append(res, "", " Call stack")
+
+			for i := len(cs) - 1; i >= 0; i-- {
+				res = append(res, fmt.Sprint("   ", cs[i]))
+			}
+		}
+
+		if vs, ok := d["vs"].(map[string]interface{}); ok {
+			res = append(res, "", " Variables")
+			res = append(res, tuiVariables(vs)...)
+		}
+
+		if vs, ok := d["vsGlobal"].(map[string]interface{}); ok && len(vs) > 0 {
+			res = append(res, "", " Globals")
+			res = append(res, tuiVariables(vs)...)
+		}
+	}
+
+	if len(res) > rows {
+		res = res[:rows]
+	}
+
+	for len(res) < rows {
+		res = append(res, "")
+	}
+
+	return res
+}
+
+/*
+threads returns the states of all threads from a given debugger status.
+*/
+func (t *debugTUI) threads(status interface{}) map[uint64]map[string]interface{} {
+	res := make(map[uint64]map[string]interface{})
+
+	if s, ok := status.(map[string]interface{}); ok {
+		if threads, ok := s["threads"].(map[string]map[string]interface{}); ok {
+			for k, v := range threads {
+				if id, err := strconv.ParseUint(k, 10, 64); err == nil {
+					res[id] = v
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+/*
+breakpoints returns all breakpoints of a given source from a given debugger
+status (line -> active).
+*/
+func (t *debugTUI) breakpoints(status interface{}, source string) map[int]bool {
+	res := make(map[int]bool)
+
+	if s, ok := status.(map[string]interface{}); ok && source != "" {
+		if bps, ok := s["breakpoints"].(map[string]bool); ok {
+			for k, active := range bps {
+				if i := strings.LastIndex(k, ":"); i > 0 && k[:i] == source {
+					if l, err := strconv.Atoi(k[i+1:]); err == nil {
+						res[l] = active
+					}
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+/*
+selectedThread returns the selected thread. If no thread was selected (or the
+selected thread has finished) then the first suspended thread is selected.
+*/
+func (t *debugTUI) selectedThread(threads map[uint64]map[string]interface{}) uint64 {
+	var res uint64
+
+	t.lock.Lock()
+	selected := t.thread
+	t.lock.Unlock()
+
+	if _, ok := threads[selected]; ok {
+		return selected
+	}
+
+	for id, s := range threads {
+		if tuiSuspended(s) && (res == 0 || id < res) {
+			res = id
+		}
+	}
+
+	return res
+}
+
+/*
+displayedSource returns the displayed source and the current line of the
+selected thread in it (0 if the thread is not suspended in the source).
+*/
+func (t *debugTUI) displayedSource(describe interface{}) (string, int) {
+	var threadSource string
+	var threadLine int
+
+	if d, ok := describe.(map[string]interface{}); ok && d != nil {
+		if node, ok := d["node"].(map[string]interface{}); ok {
+			threadSource = fmt.Sprint(node["source"])
+			threadLine, _ = strconv.Atoi(fmt.Sprint(node["line"]))
+		}
+	}
+
+	t.lock.Lock()
+	source := t.source
+	t.lock.Unlock()
+
+	if source == "" {
+		source = threadSource
+	}
+
+	if source == "" {
+		source = t.interpreter.EntryFile
+	}
+
+	if source != threadSource {
+		threadLine = 0
+	}
+
+	return source, threadLine
+}
+
+/*
+sourceLines returns the lines of a given source. The source is either the
+entry file or a file which can be imported.
+*/
+func (t *debugTUI) sourceLines(source string) ([]string, error) {
+	var code string
+	var err error
+
+	if source == t.interpreter.EntryFile {
+		var data []byte
+
+		data, err = ioutil.ReadFile(source)
+		code = string(data)
+
+	} else {
+
+		code, err = t.interpreter.RuntimeProvider.ImportLocator.Resolve(source)
+	}
+
+	return strings.Split(strings.TrimRight(code, "\n"), "\n"), err
+}
+
+/*
+tuiSuspended checks if a given thread state belongs to a suspended thread.
+*/
+func tuiSuspended(state map[string]interface{}) bool {
+	running, ok := state["threadRunning"]
+	return ok && running == false
+}
+
+/*
+tuiVariables renders the variables of a given scope snapshot (sorted by name).
+*/
+func tuiVariables(vs map[string]interface{}) []string {
+	var res, names []string
+
+	for k := range vs {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	for _, n := range names {
+		val := fmt.Sprint(vs[n])
+
+		if data, err := json.Marshal(vs[n]); err == nil {
+			val = string(data)
+		}
+
+		res = append(res, fmt.Sprintf("   %v = %v", n, val))
+	}
+
+	return res
+}
+
+/*
+tuiTitle renders the top border of a panel with a given title.
+*/
+func tuiTitle(title string, width int) string {
+	return tuiCell(fmt.Sprintf("─ %v ", title), width, '─')
+}
+
+/*
+tuiCell cuts or pads a given text to a given width. The text is padded with
+spaces unless a different padding character is given.
+*/
+func tuiCell(text string, width int, padding ...rune) string {
+	pad := ' '
+	if len(padding) > 0 {
+		pad = padding[0]
+	}
+
+	r := []rune(text)
+
+	if len(r) > width {
+		if width > 0 {
+			return string(r[:width-1]) + "…"
+		}
+		return ""
+	}
+
+	return text + strings.Repeat(string(pad), width-len(r))
+}
@@ -0,0 +1,266 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krotik/ecal/interpreter"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+func TestDebugTUI(t *testing.T) {
+	tdin := newTestDebugWithConfig()
+	defer tearDown()
+
+	if stop := tdin.ParseArgs(); stop {
+		t.Error("Setting default args should be fine")
+		return
+	}
+
+	if err := tdin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	erp := tdin.RuntimeProvider
+
+	erp.Logger = util.NewMemoryLogger(10)
+	erp.ImportLocator = &util.MemoryImportLocator{
+		Files: map[string]string{
+			"mysrc": `a := 1
+b := 2
+c := {"x" : a}
+d := b
+`,
+		},
+	}
+	erp.Debugger = interpreter.NewECALDebugger(tdin.GlobalVS)
+	erp.Debugger.BreakOnError(false)
+
+	tui := newDebugTUI(tdin)
+	tui.width = 80
+	tui.height = 12
+
+	if res := tui.Render(); res != `┌─ Source ─────────────────────────────────────┬─ Threads ─────────────────────┐
+│ No source to show                            │ Threads                       │
+│                                              │   No threads                  │
+│                                              │                               │
+│                                              │                               │
+│                                              │                               │
+│                                              │                               │
+│                                              │                               │
+│                                              │                               │
+└──────────────────────────────────────────────┴───────────────────────────────┘
+                                                                                
+#c cont  #s step in  #n step over  #o step out  #k kill  #t <tid> thread  #b <l…
+` {
+		t.Error("Unexpected result:\n" + res)
+		return
+	}
+
+	// Suspend a thread on a breakpoint
+
+	erp.Debugger.SetBreakPoint("mysrc", 3, "", 0)
+	erp.Debugger.SetBreakPoint("mysrc", 4, "", 0)
+	erp.Debugger.DisableBreakPoint("mysrc", 4)
+
+	code, _ := erp.ImportLocator.Resolve("mysrc")
+	ast, err := parser.ParseWithRuntime("mysrc", code, erp)
+
+	if err == nil {
+		err = ast.Runtime.Validate()
+	}
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	done := make(chan error)
+	tid := erp.NewThreadID()
+
+	go func() {
+		_, err := ast.Runtime.Eval(tdin.GlobalVS, make(map[string]interface{}), tid)
+		done <- err
+	}()
+
+	waitForSuspendedThread(tui)
+
+	if res := tui.Render(); res != `┌─ Source: mysrc ──────────────────────────────┬─ Thread 1 ────────────────────┐
+│     1  a := 1                                │ Threads                       │
+│     2  b := 2                                │ > 1 suspended                 │
+│*>   3  c := {"x" : a}                        │                               │
+│o    4  d := b                                │ Variables                     │
+│                                              │   a = 1                       │
+│                                              │   b = 2                       │
+│                                              │                               │
+│                                              │ Globals                       │
+└──────────────────────────────────────────────┴───────────────────────────────┘
+                                                                                
+#c cont  #s step in  #n step over  #o step out  #k kill  #t <tid> thread  #b <l…
+` {
+		t.Error("Unexpected result:\n" + res)
+		return
+	}
+
+	// Step to the next line
+
+	if !tui.Handle("#n") {
+		t.Error("Command should have been handled")
+		return
+	}
+
+	waitForSuspendedThread(tui)
+
+	if res := tui.Render(); !strings.Contains(res, "│o>   4  d := b") ||
+		!strings.Contains(res, `c = {"x":1}`) || !strings.Contains(res, "Continued thread 1") {
+		t.Error("Unexpected result:\n" + res)
+		return
+	}
+
+	// Toggle breakpoints in the displayed source
+
+	tui.Handle("#b 4")
+	tui.Handle("#b 1")
+
+	if res := tui.Render(); !strings.Contains(res, "│*    1  a := 1") ||
+		!strings.Contains(res, "│ >   4  d := b") || !strings.Contains(res, "Set breakpoint mysrc:1") {
+		t.Error("Unexpected result:\n" + res)
+		return
+	}
+
+	tui.Handle("#c")
+
+	if err := <-done; err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Show a source without a suspended thread
+
+	tui.Handle("#f mysrc 2")
+
+	if res := tui.Render(); !strings.Contains(res, "─ Source: mysrc ─") ||
+		!strings.Contains(res, "│*    1  a := 1") || !strings.Contains(res, "   1 running") {
+		t.Error("Unexpected result:\n" + res)
+		return
+	}
+
+	tui.Handle("#f unknown")
+
+	if res := tui.Render(); !strings.Contains(res, "│ Source is not available: Could not find impo…│") {
+		t.Error("Unexpected result:\n" + res)
+		return
+	}
+
+	// Test error handling of commands
+
+	for cmd, msg := range map[string]string{
+		"#c":     "No thread selected",
+		"#t":     "Need a thread ID",
+		"#t x":   "Invalid thread ID: x",
+		"#t 5":   "Selected thread 5",
+		"#b":     "Need a line number",
+		"#b x":   "Invalid line number: x",
+		"#f":     "Showing the source of the selected thread",
+		"#f foo": "Showing foo",
+	} {
+		if !tui.Handle(cmd) {
+			t.Error("Command should have been handled:", cmd)
+			return
+		}
+
+		if res := tui.Render(); !strings.Contains(res, msg) {
+			t.Error("Unexpected result for", cmd, ":\n"+res)
+			return
+		}
+	}
+
+	if tui.Handle("#") || tui.Handle("#x") {
+		t.Error("Unknown commands should not be handled")
+		return
+	}
+
+	// Test the user interface in the interactive console (the screen should
+	// only be drawn after input)
+
+	oldRefreshInterval := tuiRefreshInterval
+	tuiRefreshInterval = time.Hour
+	defer func() { tuiRefreshInterval = oldRefreshInterval }()
+
+	testTerm.out.Reset()
+
+	for _, line := range []string{"@tui", "#t 1", "##status", "#x", "@tui off"} {
+		if !tdin.CanHandle(line) {
+			t.Error("Line should be handled:", line)
+			return
+		}
+
+		tdin.Handle(testTerm, line)
+	}
+
+	if tdin.CanHandle("#x") {
+		t.Error("Shortcuts should only be handled while the user interface is shown")
+		return
+	}
+
+	out := testTerm.out.String()
+
+	if strings.Count(out, tuiClearScreen) != 4 || !strings.Contains(out, "Selected thread 1") ||
+		!strings.Contains(out, `"breakpoints":{"mysrc:1":true,"mysrc:3":true}`) ||
+		!strings.Contains(out, "Unknown command: #x") ||
+		!strings.HasSuffix(out, "Debugger user interface is hidden\n") {
+		t.Error("Unexpected result:", out)
+		return
+	}
+
+	// Test that the user interface is shown while the console is running
+
+	l1 := ""
+	tdin.LogFile = &l1
+	tdin.LogLevel = &l1
+	l2 := true
+	tdin.Interactive = &l2
+	tdin.TUI = &l2
+	l3 := false
+	tdin.RunDebugServer = &l3
+
+	testTerm.in = []string{"#t 1", "q"}
+	testTerm.out.Reset()
+
+	if err := tdin.Interpret(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if out := testTerm.out.String(); !strings.Contains(out, "Selected thread 1") || tdin.tui != nil {
+		t.Error("Unexpected result:", out, tdin.tui)
+		return
+	}
+}
+
+func waitForSuspendedThread(tui *debugTUI) {
+	for i := 0; i < 100; i++ {
+		status := tui.interpreter.RuntimeProvider.Debugger.Status()
+
+		for _, s := range tui.threads(status) {
+			if tuiSuspended(s) {
+				return
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
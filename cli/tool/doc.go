@@ -0,0 +1,270 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/krotik/ecal/parser"
+)
+
+/*
+Known output formats of the documentation generator
+*/
+const (
+	DocFormatMarkdown = "markdown"
+	DocFormatHTML     = "html"
+)
+
+/*
+Doc generates documentation for all functions and sinks in a given set of ECAL files.
+*/
+func Doc() error {
+	wd, _ := os.Getwd()
+
+	dir := flag.String("dir", wd, "Root directory for ECAL files")
+	ext := flag.String("ext", ".ecal", "Extension for ECAL files")
+	format := flag.String("format", DocFormatMarkdown, "Output format (markdown or html)")
+	out := flag.String("out", "", "Output file (default is stdout)")
+	showHelp := flag.Bool("help", false, "Show this help message")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), fmt.Sprintf("Usage of %s doc [options]", os.Args[0]))
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "This tool will generate documentation for all functions and sinks")
+		fmt.Fprintln(flag.CommandLine.Output(), "in a directory structure of ECAL files. Doc comments are taken from")
+		fmt.Fprintln(flag.CommandLine.Output(), "the block comments (/* ... */) directly in front of a declaration.")
+		fmt.Fprintln(flag.CommandLine.Output())
+	}
+
+	if len(os.Args) >= 2 {
+		flag.CommandLine.Parse(osArgs[2:])
+
+		if *showHelp {
+			flag.Usage()
+			return nil
+		}
+	}
+
+	res, err := GenerateDoc(*dir, *ext, *format)
+
+	if err == nil {
+		if *out != "" {
+			err = ioutil.WriteFile(*out, []byte(res), 0660)
+		} else {
+			fmt.Fprint(flag.CommandLine.Output(), res)
+		}
+	}
+
+	return err
+}
+
+/*
+docEntry is a documented declaration in an ECAL file.
+*/
+type docEntry struct {
+	kind      string // Kind of declaration (function or sink)
+	name      string // Name of the declaration
+	signature string // Signature of the declaration
+	doc       string // Doc comment of the declaration
+	line      int    // Line of the declaration
+}
+
+/*
+docFile contains all documented declarations of an ECAL file.
+*/
+type docFile struct {
+	path    string      // Path of the file relative to the root directory
+	entries []*docEntry // Declarations of the file
+}
+
+/*
+GenerateDoc generates documentation for all top-level functions and sinks
+in all ECAL files in a given directory with a given ending. Files which
+cannot be parsed are skipped.
+*/
+func GenerateDoc(dir string, ext string, format string) (string, error) {
+	var files []*docFile
+
+	if format != DocFormatMarkdown && format != DocFormatHTML {
+		return "", fmt.Errorf("Unknown output format: %v", format)
+	}
+
+	// Try to resolve symbolic links
+
+	scanDir, lerr := os.Readlink(dir)
+	if lerr != nil {
+		scanDir = dir
+	}
+
+	err := filepath.Walk(scanDir,
+		func(path string, i os.FileInfo, err error) error {
+			if err == nil && !i.IsDir() && strings.HasSuffix(path, ext) {
+				var data []byte
+				var ast *parser.ASTNode
+
+				if data, err = ioutil.ReadFile(path); err == nil {
+					relPath, _ := filepath.Rel(scanDir, path)
+
+					res := parser.ParseAll(relPath, string(data))
+
+					for _, perr := range res.Errors {
+						fmt.Fprintln(flag.CommandLine.Output(), fmt.Sprintf("Could not parse %v: %v", path, perr))
+					}
+
+					if ast = res.AST; len(res.Errors) == 0 {
+						if entries := extractDocEntries(ast); len(entries) > 0 {
+							files = append(files, &docFile{filepath.ToSlash(relPath), entries})
+						}
+					}
+				}
+			}
+			return err
+		})
+
+	if err != nil {
+		return "", err
+	}
+
+	if format == DocFormatHTML {
+		return renderDocHTML(files), nil
+	}
+
+	return renderDocMarkdown(files), nil
+}
+
+/*
+extractDocEntries extracts all top-level function and sink declarations from
+a given AST.
+*/
+func extractDocEntries(ast *parser.ASTNode) []*docEntry {
+	var res []*docEntry
+
+	statements := ast.Children
+
+	if ast.Name != parser.NodeSTATEMENTS {
+
+		// Code with a single statement has no statements node
+
+		statements = []*parser.ASTNode{ast}
+	}
+
+	for _, c := range statements {
+		var entry *docEntry
+
+		if c.Name == parser.NodeFUNC && len(c.Children) > 1 && c.Children[0].Name == parser.NodeIDENTIFIER {
+			name := c.Children[0].Token.Val
+			params, _ := parser.PrettyPrint(c.Children[1])
+
+			entry = &docEntry{"function", name, fmt.Sprintf("%v%v", name, params), "", c.Token.Lline}
+
+		} else if c.Name == parser.NodeSINK && len(c.Children) > 0 {
+			var clauses []string
+
+			name := c.Children[0].Token.Val
+
+			for _, cc := range c.Children[1:] {
+				if cc.Name != parser.NodeSTATEMENTS {
+					clause, _ := parser.PrettyPrint(cc)
+					clauses = append(clauses, clause)
+				}
+			}
+
+			signature := fmt.Sprintf("sink %v", name)
+			if len(clauses) > 0 {
+				signature = fmt.Sprintf("%v\n    %v", signature, strings.Join(clauses, ",\n    "))
+			}
+
+			entry = &docEntry{"sink", name, signature, "", c.Token.Lline}
+		}
+
+		if entry != nil {
+			for _, m := range c.Meta {
+				if m.Type() == parser.MetaDataPreComment {
+					entry.doc = strings.TrimSpace(m.Value())
+				}
+			}
+
+			res = append(res, entry)
+		}
+	}
+
+	return res
+}
+
+/*
+renderDocMarkdown renders documentation as Markdown.
+*/
+func renderDocMarkdown(files []*docFile) string {
+	var buf bytes.Buffer
+
+	buf.WriteString("# ECAL Documentation\n")
+
+	for _, f := range files {
+		buf.WriteString(fmt.Sprintf("\n## %v\n", f.path))
+
+		for _, e := range f.entries {
+			buf.WriteString(fmt.Sprintf("\n### %v `%v`\n", e.kind, e.name))
+			buf.WriteString(fmt.Sprintf("```\n%v\n```\n", e.signature))
+
+			if e.doc != "" {
+				buf.WriteString(fmt.Sprintf("%v\n", e.doc))
+			}
+
+			buf.WriteString(fmt.Sprintf("\nDefined in %v line %v\n", f.path, e.line))
+		}
+	}
+
+	return buf.String()
+}
+
+/*
+renderDocHTML renders documentation as a HTML page.
+*/
+func renderDocHTML(files []*docFile) string {
+	var buf bytes.Buffer
+
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	buf.WriteString("<title>ECAL Documentation</title>\n</head>\n<body>\n")
+	buf.WriteString("<h1>ECAL Documentation</h1>\n")
+
+	for _, f := range files {
+		buf.WriteString(fmt.Sprintf("<h2>%v</h2>\n", html.EscapeString(f.path)))
+
+		for _, e := range f.entries {
+			buf.WriteString(fmt.Sprintf("<h3>%v <code>%v</code></h3>\n", e.kind, html.EscapeString(e.name)))
+			buf.WriteString(fmt.Sprintf("<pre>%v</pre>\n", html.EscapeString(e.signature)))
+
+			for _, p := range strings.Split(e.doc, "\n\n") {
+				if p = strings.TrimSpace(p); p != "" {
+					buf.WriteString(fmt.Sprintf("<p>%v</p>\n", html.EscapeString(p)))
+				}
+			}
+
+			buf.WriteString(fmt.Sprintf("<p><small>Defined in %v line %v</small></p>\n",
+				html.EscapeString(f.path), e.line))
+		}
+	}
+
+	buf.WriteString("</body>\n</html>\n")
+
+	return buf.String()
+}
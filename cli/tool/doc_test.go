@@ -0,0 +1,196 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/krotik/common/errorutil"
+)
+
+func TestDoc(t *testing.T) {
+	setupFormatTestDir()
+	defer tearDownFormatTestDir()
+
+	out := bytes.Buffer{}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	osArgs = []string{"foo", "bar", "-help"}
+
+	if err := Doc(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if !strings.Contains(out.String(), "Output format (markdown or html)") {
+		t.Error("Unexpected output:", out.String())
+		return
+	}
+
+	err := os.Mkdir(filepath.Join(formatTestDir, "lib"), 0770)
+	errorutil.AssertOk(err)
+
+	err = ioutil.WriteFile(filepath.Join(formatTestDir, "main.ecal"), []byte(`
+/*
+Adds two numbers.
+
+The second number is optional.
+*/
+func add(a, b=1) {
+  return a + b
+}
+
+func noDoc() {
+}
+
+x := 1
+
+/* Handles <high> temperatures */
+sink hightemp
+  kindmatch ["sensor.temp"],
+  statematch {"temp" : {">" : 30}},
+  priority 2,
+  {
+  }
+`), 0777)
+	errorutil.AssertOk(err)
+
+	err = ioutil.WriteFile(filepath.Join(formatTestDir, "lib", "util.ecal"), []byte(`
+/* Returns the answer. */
+func answer() {
+  return 42
+}
+`), 0777)
+	errorutil.AssertOk(err)
+
+	err = ioutil.WriteFile(filepath.Join(formatTestDir, "invalid.ecal"), []byte("func ("), 0777)
+	errorutil.AssertOk(err)
+
+	err = ioutil.WriteFile(filepath.Join(formatTestDir, "other.txt"), []byte("func other() {}"), 0777)
+	errorutil.AssertOk(err)
+
+	out = bytes.Buffer{}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	osArgs = []string{"foo", "bar", "-dir", formatTestDir}
+
+	if err := Doc(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if out.String() != `Could not parse formattest/invalid.ecal: Parse error in invalid.ecal: Unexpected end (Line:1 Pos:6)
+# ECAL Documentation
+
+## lib/util.ecal
+
+### function `+"`answer`"+`
+`+"```"+`
+answer()
+`+"```"+`
+Returns the answer.
+
+Defined in lib/util.ecal line 3
+
+## main.ecal
+
+### function `+"`add`"+`
+`+"```"+`
+add(a, b=1)
+`+"```"+`
+Adds two numbers.
+
+The second number is optional.
+
+Defined in main.ecal line 7
+
+### function `+"`noDoc`"+`
+`+"```"+`
+noDoc()
+`+"```"+`
+
+Defined in main.ecal line 11
+
+### sink `+"`hightemp`"+`
+`+"```"+`
+sink hightemp
+    kindmatch ["sensor.temp"],
+    statematch {"temp" : {">" : 30}},
+    priority 2
+`+"```"+`
+Handles <high> temperatures
+
+Defined in main.ecal line 17
+` {
+		t.Error("Unexpected output:", out.String())
+		return
+	}
+
+	// Write HTML into a file
+
+	docFile := filepath.Join(formatTestDir, "doc.html")
+
+	out = bytes.Buffer{}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	osArgs = []string{"foo", "bar", "-dir", filepath.Join(formatTestDir, "lib"), "-format", "html", "-out", docFile}
+
+	if err := Doc(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	docContent, err := ioutil.ReadFile(docFile)
+	errorutil.AssertOk(err)
+
+	if string(docContent) != `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ECAL Documentation</title>
+</head>
+<body>
+<h1>ECAL Documentation</h1>
+<h2>util.ecal</h2>
+<h3>function <code>answer</code></h3>
+<pre>answer()</pre>
+<p>Returns the answer.</p>
+<p><small>Defined in util.ecal line 3</small></p>
+</body>
+</html>
+` {
+		t.Error("Unexpected result:", string(docContent))
+		return
+	}
+
+	if res, err := GenerateDoc(formatTestDir, ".ecal", "html"); err != nil ||
+		!strings.Contains(res, "<p>Handles &lt;high&gt; temperatures</p>") {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := GenerateDoc(formatTestDir, ".ecal", "pdf"); err == nil || err.Error() != "Unknown output format: pdf" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
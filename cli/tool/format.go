@@ -11,6 +11,7 @@
 package tool
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -29,6 +30,7 @@ func Format() error {
 
 	dir := flag.String("dir", wd, "Root directory for ECAL files")
 	ext := flag.String("ext", ".ecal", "Extension for ECAL files")
+	sourceMaps := flag.Bool("sourcemap", false, "Write a source map (<file>.map) for every formatted file")
 	showHelp := flag.Bool("help", false, "Show this help message")
 
 	flag.Usage = func() {
@@ -52,6 +54,10 @@ func Format() error {
 
 	fmt.Fprintln(flag.CommandLine.Output(), fmt.Sprintf("Formatting all %v files in %v", *ext, *dir))
 
+	if *sourceMaps {
+		return FormatFilesWithSourceMaps(*dir, *ext)
+	}
+
 	return FormatFiles(*dir, *ext)
 }
 
@@ -59,6 +65,22 @@ func Format() error {
 FormatFiles formats all ECAL files in a given directory with a given ending.
 */
 func FormatFiles(dir string, ext string) error {
+	return formatFiles(dir, ext, false)
+}
+
+/*
+FormatFilesWithSourceMaps formats all ECAL files in a given directory with a
+given ending. A source map which links the formatted code to the original
+code is written for every formatted file (<file>.map).
+*/
+func FormatFilesWithSourceMaps(dir string, ext string) error {
+	return formatFiles(dir, ext, true)
+}
+
+/*
+formatFiles formats all ECAL files in a given directory with a given ending.
+*/
+func formatFiles(dir string, ext string, writeSourceMaps bool) error {
 	var err error
 
 	// Try to resolve symbolic links
@@ -80,9 +102,25 @@ func FormatFiles(dir string, ext string) error {
 						if data, err = ioutil.ReadFile(path); err == nil {
 							var ferr error
 
-							if ast, ferr = parser.Parse(path, string(data)); ferr == nil {
-								if srcFormatted, ferr = parser.PrettyPrint(ast); ferr == nil {
+							res := parser.ParseAll(path, string(data))
+
+							for _, perr := range res.Errors {
+								fmt.Fprintln(flag.CommandLine.Output(), fmt.Sprintf("Could not format %v: %v", path, perr))
+							}
+
+							if ast = res.AST; len(res.Errors) == 0 {
+								var sm *parser.SourceMap
+
+								if srcFormatted, sm, ferr = parser.PrettyPrintWithSourceMap(ast); ferr == nil {
 									ioutil.WriteFile(path, []byte(fmt.Sprintln(srcFormatted)), i.Mode())
+
+									if writeSourceMaps {
+										var smData []byte
+
+										if smData, ferr = json.MarshalIndent(sm, "", "  "); ferr == nil {
+											ferr = ioutil.WriteFile(path+".map", smData, i.Mode())
+										}
+									}
 								}
 							}
 
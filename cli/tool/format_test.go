@@ -12,6 +12,7 @@ package tool
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -22,6 +23,7 @@ import (
 
 	"github.com/krotik/common/errorutil"
 	"github.com/krotik/common/fileutil"
+	"github.com/krotik/ecal/parser"
 )
 
 const formatTestDir = "formattest"
@@ -120,3 +122,54 @@ Could not format formattest/myinvalidfile.ecal: Parse error in formattest/myinva
 		return
 	}
 }
+
+func TestFormatSourceMap(t *testing.T) {
+	setupFormatTestDir()
+	defer tearDownFormatTestDir()
+
+	myfile := filepath.Join(formatTestDir, "myfile.ecal")
+
+	err := ioutil.WriteFile(myfile, []byte("a := 1\n\n\nif a == 1 { b := 1 }"), 0777)
+	errorutil.AssertOk(err)
+
+	out := bytes.Buffer{}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	osArgs = []string{"foo", "bar", "-dir", formatTestDir, "-sourcemap"}
+
+	if err := Format(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	myfileContent, err := ioutil.ReadFile(myfile)
+	errorutil.AssertOk(err)
+
+	if string(myfileContent) != `a := 1
+
+if a == 1 {
+    b := 1
+}
+` {
+		t.Error("Unexpected result:", string(myfileContent))
+		return
+	}
+
+	smData, err := ioutil.ReadFile(myfile + ".map")
+	errorutil.AssertOk(err)
+
+	sm := &parser.SourceMap{}
+	errorutil.AssertOk(json.Unmarshal(smData, sm))
+
+	if sm.Source != myfile {
+		t.Error("Unexpected result:", sm.Source)
+		return
+	}
+
+	if l, ok := sm.OriginalLine(3); !ok || l != 4 {
+		t.Error("Unexpected result:", l, ok)
+		return
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/krotik/ecal/interpreter"
+	"github.com/krotik/ecal/parser"
+)
+
+/*
+Known output formats of the rule graph generator
+*/
+const (
+	GraphFormatDOT  = "dot"
+	GraphFormatJSON = "json"
+)
+
+/*
+Graph exports the dependency graph of all sinks in a given set of ECAL files.
+*/
+func Graph() error {
+	wd, _ := os.Getwd()
+
+	dir := flag.String("dir", wd, "Root directory for ECAL files")
+	ext := flag.String("ext", ".ecal", "Extension for ECAL files")
+	format := flag.String("format", GraphFormatDOT, "Output format (dot or json)")
+	out := flag.String("out", "", "Output file (default is stdout)")
+	showHelp := flag.Bool("help", false, "Show this help message")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), fmt.Sprintf("Usage of %s graph [options]", os.Args[0]))
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "This tool will export the dependency graph of all sinks in a directory")
+		fmt.Fprintln(flag.CommandLine.Output(), "structure of ECAL files. Sinks are connected if a sink adds events which")
+		fmt.Fprintln(flag.CommandLine.Output(), "trigger another sink or if a sink suppresses another sink.")
+		fmt.Fprintln(flag.CommandLine.Output())
+	}
+
+	if len(os.Args) >= 2 {
+		flag.CommandLine.Parse(osArgs[2:])
+
+		if *showHelp {
+			flag.Usage()
+			return nil
+		}
+	}
+
+	res, err := GenerateGraph(*dir, *ext, *format)
+
+	if err == nil {
+		if *out != "" {
+			err = ioutil.WriteFile(*out, []byte(res), 0660)
+		} else {
+			fmt.Fprint(flag.CommandLine.Output(), res)
+		}
+	}
+
+	return err
+}
+
+/*
+GenerateGraph exports the dependency graph of all sinks in all ECAL files in
+a given directory with a given ending. Files which cannot be parsed are skipped.
+*/
+func GenerateGraph(dir string, ext string, format string) (string, error) {
+	var res string
+
+	asts := make(map[string]*parser.ASTNode)
+
+	if format != GraphFormatDOT && format != GraphFormatJSON {
+		return "", fmt.Errorf("Unknown output format: %v", format)
+	}
+
+	// Try to resolve symbolic links
+
+	scanDir, lerr := os.Readlink(dir)
+	if lerr != nil {
+		scanDir = dir
+	}
+
+	err := filepath.Walk(scanDir,
+		func(path string, i os.FileInfo, err error) error {
+			if err == nil && !i.IsDir() && strings.HasSuffix(path, ext) {
+				var data []byte
+
+				if data, err = ioutil.ReadFile(path); err == nil {
+					relPath, _ := filepath.Rel(scanDir, path)
+
+					res := parser.ParseAll(relPath, string(data))
+
+					for _, perr := range res.Errors {
+						fmt.Fprintln(flag.CommandLine.Output(), fmt.Sprintf("Could not parse %v: %v", path, perr))
+					}
+
+					if len(res.Errors) == 0 {
+						asts[filepath.ToSlash(relPath)] = res.AST
+					}
+				}
+			}
+			return err
+		})
+
+	if err == nil {
+		graph := interpreter.NewRuleGraph(asts)
+
+		if format == GraphFormatJSON {
+			var data []byte
+
+			if data, err = json.MarshalIndent(graph, "", "  "); err == nil {
+				res = fmt.Sprintln(string(data))
+			}
+
+		} else {
+
+			res = graph.DOT()
+		}
+	}
+
+	return res, err
+}
@@ -0,0 +1,119 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/krotik/common/errorutil"
+)
+
+func TestGraph(t *testing.T) {
+	setupFormatTestDir()
+	defer tearDownFormatTestDir()
+
+	out := bytes.Buffer{}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	osArgs = []string{"foo", "bar", "-help"}
+
+	if err := Graph(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if !strings.Contains(out.String(), "Output format (dot or json)") {
+		t.Error("Unexpected output:", out.String())
+		return
+	}
+
+	err := ioutil.WriteFile(filepath.Join(formatTestDir, "main.ecal"), []byte(`
+sink order
+  kindmatch ["order.created"],
+  {
+    addEvent("mail", "mail.send", {})
+  }
+
+sink mail
+  kindmatch ["mail.*"],
+  {
+  }
+`), 0777)
+	errorutil.AssertOk(err)
+
+	err = ioutil.WriteFile(filepath.Join(formatTestDir, "invalid.ecal"), []byte("func ("), 0777)
+	errorutil.AssertOk(err)
+
+	out = bytes.Buffer{}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	osArgs = []string{"foo", "bar", "-dir", formatTestDir}
+
+	if err := Graph(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if out.String() != `Could not parse formattest/invalid.ecal: Parse error in invalid.ecal: Unexpected end (Line:1 Pos:6)
+digraph rules {
+  "mail" [label="mail\nmail.*"];
+  "order" [label="order\norder.created"];
+  "order" -> "mail" [label="mail.send"];
+}
+` {
+		t.Error("Unexpected output:", out.String())
+		return
+	}
+
+	// Write JSON into a file
+
+	graphFile := filepath.Join(formatTestDir, "graph.json")
+
+	osArgs = []string{"foo", "bar", "-dir", formatTestDir, "-format", "json", "-out", graphFile}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	if err := Graph(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	graphContent, err := ioutil.ReadFile(graphFile)
+	errorutil.AssertOk(err)
+
+	if !strings.Contains(string(graphContent), `"edges": [
+    {
+      "from": "order",
+      "to": "mail",
+      "type": "event",
+      "label": "mail.send"
+    }
+  ]`) {
+		t.Error("Unexpected result:", string(graphContent))
+		return
+	}
+
+	if _, err := GenerateGraph(formatTestDir, ".ecal", "svg"); err == nil || err.Error() != "Unknown output format: svg" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -12,15 +12,19 @@ package tool
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime/pprof"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/krotik/common/errorutil"
 	"github.com/krotik/common/fileutil"
@@ -31,6 +35,7 @@ import (
 	"github.com/krotik/ecal/interpreter"
 	"github.com/krotik/ecal/parser"
 	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/server"
 	"github.com/krotik/ecal/stdlib"
 	"github.com/krotik/ecal/util"
 )
@@ -61,14 +66,22 @@ type CLIInterpreter struct {
 	CustomHelpString     string
 	CustomRules          []*engine.Rule
 
-	EntryFile   string // Entry file for the program
-	LoadPlugins bool   // Flag if stdlib plugins should be loaded
+	EntryFile   string   // Entry file for the program
+	Args        []string // Program arguments (entry file followed by remaining command line arguments)
+	LoadPlugins bool     // Flag if stdlib plugins should be loaded
 
 	// Parameter these can either be set programmatically or via CLI args
 
 	Dir      *string // Root dir for interpreter
 	LogFile  *string // Logfile (blank for stdout)
 	LogLevel *string // Log level string (Debug, Info, Error)
+	Exec     *string // Comma separated list of commands which can be executed (* allows all)
+	Net      *string // Comma separated list of network addresses which can be accessed (* allows all)
+	APIAddr  *string // Address of the API server (blank for no server)
+	APIToken *string // Token which clients of the API server must send to authenticate (blank for no authentication)
+	Color    *bool   // Flag if error messages should contain ANSI colors
+	Watch    *bool   // Flag if the program should be reloaded when its files change
+	Config   *string // Config file (JSON) which is reloaded when it changes (blank for no file)
 
 	// User terminal
 
@@ -84,7 +97,7 @@ NewCLIInterpreter creates a new commandline interpreter for ECAL.
 */
 func NewCLIInterpreter() *CLIInterpreter {
 	return &CLIInterpreter{scope.NewScope(scope.GlobalScope), nil, nil, "", "",
-		[]*engine.Rule{}, "", true, nil, nil, nil, nil, os.Stdout}
+		[]*engine.Rule{}, "", nil, true, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, os.Stdout}
 }
 
 /*
@@ -101,12 +114,20 @@ func (i *CLIInterpreter) ParseArgs() bool {
 
 	i.Dir = flag.String("dir", wd, "Root directory for ECAL interpreter")
 	i.LogFile = flag.String("logfile", "", "Log to a file")
-	i.LogLevel = flag.String("loglevel", "Info", "Logging level (Debug, Info, Error)")
+	i.LogLevel = flag.String("loglevel", "", "Logging level (Debug, Info, Error - default is the LogLevel config option)")
+	i.Exec = flag.String("exec", "", "Commands which can be executed by ECAL code (comma separated list, * allows all)")
+	i.Net = flag.String("net", "", "Network addresses which can be accessed by ECAL code (comma separated list of host:port or host:*, * allows all)")
+	i.APIAddr = flag.String("api", "", "Run a JSON-RPC API server on the given address (e.g. localhost:33275)")
+	i.APIToken = flag.String("apitoken", os.Getenv("ECAL_API_TOKEN"),
+		"Token which clients of the API server must send to authenticate (default: value of ECAL_API_TOKEN)")
+	i.Color = flag.Bool("color", false, "Use ANSI colors in error messages")
+	i.Watch = flag.Bool("watch", false, "Reload the program when the entry file or one of its imports changes")
+	i.Config = flag.String("config", "", "Read config options from a JSON file (the file is reloaded when it changes)")
 	showHelp := flag.Bool("help", false, "Show this help message")
 
 	flag.Usage = func() {
 		fmt.Fprintln(flag.CommandLine.Output())
-		fmt.Fprintln(flag.CommandLine.Output(), fmt.Sprintf("Usage of %s run [options] [file]", osArgs[0]))
+		fmt.Fprintln(flag.CommandLine.Output(), fmt.Sprintf("Usage of %s run [options] [file] [args]", osArgs[0]))
 		fmt.Fprintln(flag.CommandLine.Output())
 		flag.PrintDefaults()
 		fmt.Fprintln(flag.CommandLine.Output())
@@ -117,6 +138,7 @@ func (i *CLIInterpreter) ParseArgs() bool {
 
 		if cargs := flag.Args(); len(cargs) > 0 {
 			i.EntryFile = flag.Arg(0)
+			i.Args = cargs
 		}
 
 		if *showHelp {
@@ -127,9 +149,29 @@ func (i *CLIInterpreter) ParseArgs() bool {
 	return *showHelp
 }
 
+/*
+LoadConfig reads config options from the config file (if given) and from
+environment variables. Environment variables take precedence over the config
+file.
+*/
+func (i *CLIInterpreter) LoadConfig() error {
+	var err error
+
+	if i.Config != nil && *i.Config != "" {
+		err = config.LoadFile(*i.Config)
+	}
+
+	if err == nil {
+		err = config.LoadEnv()
+	}
+
+	return err
+}
+
 /*
 CreateRuntimeProvider creates the runtime provider of this interpreter. This function expects Dir,
-LogFile and LogLevel to be set.
+LogFile and LogLevel to be set. Options which are not given on the command line
+are read from the config.
 */
 func (i *CLIInterpreter) CreateRuntimeProvider(name string) error {
 	var logger util.Logger
@@ -139,6 +181,12 @@ func (i *CLIInterpreter) CreateRuntimeProvider(name string) error {
 		return nil
 	}
 
+	// Read config options before any component is created
+
+	if err = i.LoadConfig(); err != nil {
+		return err
+	}
+
 	// Check if we should log to a file
 
 	if i.LogFile != nil && *i.LogFile != "" {
@@ -158,18 +206,61 @@ func (i *CLIInterpreter) CreateRuntimeProvider(name string) error {
 	// Set the log level
 
 	if err == nil {
+		level := config.Str(config.LogLevel)
+
 		if i.LogLevel != nil && *i.LogLevel != "" {
-			logger, err = util.NewLogLevelLogger(logger, *i.LogLevel)
+			level = *i.LogLevel
 		}
 
+		logger, err = util.NewLogLevelLogger(logger, level)
+
 		if err == nil {
 			// Get the import locator
 
-			importLocator := &util.FileImportLocator{Root: *i.Dir}
+			var importLocator util.ECALImportLocator = &util.FileImportLocator{Root: *i.Dir}
+
+			if i.isWatching() {
+
+				// Record imports so they can be watched for changes
+
+				importLocator = newImportRecorder(importLocator)
+			}
 
 			// Create interpreter
 
 			i.RuntimeProvider = interpreter.NewECALRuntimeProvider(name, importLocator, logger)
+
+			// File operations of stdlib functions are confined to the root directory
+
+			i.RuntimeProvider.FileRoot = *i.Dir
+
+			i.RuntimeProvider.Args = i.Args
+
+			// Code is checked for undefined variables before it is executed
+
+			i.RuntimeProvider.VarCheckScope = i.GlobalVS
+
+			// The security policy is only read on startup
+
+			execAllowList := config.Str(config.ExecAllowList)
+
+			if i.Exec != nil && *i.Exec != "" {
+				execAllowList = *i.Exec
+			}
+
+			if execAllowList != "" {
+				i.RuntimeProvider.ExecAllowList = strings.Split(execAllowList, ",")
+			}
+
+			netAllowList := config.Str(config.NetAllowList)
+
+			if i.Net != nil && *i.Net != "" {
+				netAllowList = *i.Net
+			}
+
+			if netAllowList != "" {
+				i.RuntimeProvider.NetAllowList = strings.Split(netAllowList, ",")
+			}
 		}
 	}
 
@@ -197,14 +288,37 @@ func (i *CLIInterpreter) LoadInitialFile(tid uint64) error {
 
 	i.GlobalVS.Clear()
 
+	if len(i.Args) > 0 {
+		var osArgs []interface{}
+
+		for _, arg := range i.Args {
+			osArgs = append(osArgs, arg)
+		}
+		i.GlobalVS.SetValue("osArgs", osArgs)
+	}
+
 	if i.EntryFile != "" {
 		var ast *parser.ASTNode
 		var initFile []byte
 
 		initFile, err = ioutil.ReadFile(i.EntryFile)
 
+		name, code := i.EntryFile, string(initFile)
+
+		if err == nil && util.IsBundle(code) {
+			var il *util.MemoryImportLocator
+
+			// Imports of bundled code are resolved from the bundle - the entry
+			// code is named after its import path in the bundle
+
+			if name, il, err = util.ParseBundle(code); err == nil {
+				code = il.Files[name]
+				i.RuntimeProvider.ImportLocator = il
+			}
+		}
+
 		if err == nil {
-			if ast, err = parser.ParseWithRuntime(i.EntryFile, string(initFile), i.RuntimeProvider); err == nil {
+			if ast, err = parser.ParseWithRuntime(name, code, i.RuntimeProvider); err == nil {
 				if err = ast.Runtime.Validate(); err == nil {
 					_, err = ast.Runtime.Eval(i.GlobalVS, make(map[string]interface{}), tid)
 				}
@@ -278,9 +392,68 @@ func (i *CLIInterpreter) Interpret(interactive bool) error {
 
 				if err = i.LoadInitialFile(tid); err == nil {
 
+					// Shut down gracefully on SIGINT or SIGTERM
+
+					i.handleShutdownSignals(interactive)
+
+					apiRequested := i.APIAddr != nil && *i.APIAddr != ""
+
+					// Apply config changes to the running program and reload
+					// the config file when it changes
+
+					defer config.AddChangeListener(i.RuntimeProvider.ApplyConfigChange)()
+
+					if i.Config != nil && *i.Config != "" {
+						stopConfigWatch := make(chan struct{})
+						defer close(stopConfigWatch)
+
+						go config.WatchFile(*i.Config, watchInterval, stopConfigWatch, func(err error) {
+							fmt.Fprintln(i.LogOut, fmt.Sprintf("Could not reload config: %v", err))
+						})
+					}
+
+					// Reload the program on file changes in the background if requested
+
+					if i.isWatching() && (interactive || apiRequested) {
+						stopWatch := make(chan struct{})
+						defer close(stopWatch)
+
+						go i.WatchFiles(stopWatch)
+					}
+
+					// Start the API server if requested
+
+					if apiRequested {
+						apiServer := server.NewAPIServer(i.RuntimeProvider, *i.APIAddr)
+
+						if i.APIToken != nil {
+							apiServer.Token = *i.APIToken
+						}
+
+						if err = apiServer.Start(); err == nil {
+							if apiServer.IsExposed() {
+								fmt.Fprintln(i.LogOut, fmt.Sprintf("Warning: API server on %v is reachable "+
+									"from other hosts and does not require a token (use -apitoken)", apiServer.ListenAddress()))
+							}
+
+							if interactive {
+								fmt.Fprintln(i.LogOut, fmt.Sprintf("API server on: %v", apiServer.ListenAddress()))
+								defer apiServer.Stop()
+							} else {
+								apiServer.Wait()
+							}
+						}
+					}
+
+					// Keep watching files if there is nothing else to do
+
+					if err == nil && !interactive && !apiRequested && i.isWatching() {
+						i.WatchFiles(nil)
+					}
+
 					// Drop into interactive shell
 
-					if interactive {
+					if err == nil && interactive {
 
 						// Add history functionality without file persistence
 
@@ -314,9 +487,130 @@ func (i *CLIInterpreter) Interpret(interactive bool) error {
 		}
 	}
 
+	if err != nil {
+
+		// Show errors in ECAL code with an excerpt of the code
+
+		if msg := i.FormatError(err, ""); msg != err.Error() {
+			err = &sourceError{err, msg}
+		}
+	}
+
 	return err
 }
 
+/*
+sourceError is an error which is shown with an excerpt of the source code where
+it occurred.
+*/
+type sourceError struct {
+	error
+	msg string // Error message with source excerpt
+}
+
+/*
+Error returns the error message with the source excerpt.
+*/
+func (e *sourceError) Error() string {
+	return e.msg
+}
+
+/*
+FormatError returns a human-readable string representation of an error. Parser
+and runtime errors show the line of the code where they occurred with a caret
+under the offending token. The code of console input is given as a parameter,
+the code of files is read from the entry file or via the import locator.
+*/
+func (i *CLIInterpreter) FormatError(err error, input string) string {
+	var source string
+	var format func(code string, color bool) string
+
+	switch e := err.(type) {
+	case *parser.Error:
+		source, format = e.Source, e.ErrorWithSource
+	case *util.RuntimeErrorWithDetail:
+		err = e.RuntimeError
+	}
+
+	if e, ok := err.(*util.RuntimeError); ok {
+		if source, format = e.Source, e.ErrorWithSource; e.Node != nil && e.Node.Token != nil {
+			source = e.Node.Token.Lsource
+		}
+	}
+
+	if format != nil {
+		var rerr error
+
+		code, ok := input, source == "console input"
+
+		if !ok && source == i.EntryFile {
+			var data []byte
+
+			if data, rerr = ioutil.ReadFile(i.EntryFile); rerr == nil {
+				code, ok = string(data), true
+			}
+
+		} else if !ok && i.RuntimeProvider != nil && i.RuntimeProvider.ImportLocator != nil {
+			code, rerr = i.RuntimeProvider.ImportLocator.Resolve(source)
+			ok = rerr == nil
+		}
+
+		if ok {
+			return format(code, i.Color != nil && *i.Color)
+		}
+	}
+
+	return err.Error()
+}
+
+/*
+Shutdown stops accepting new root events and waits for running event cascades
+and triggers to finish. Waiting is bounded by the configured shutdown timeout.
+*/
+func (i *CLIInterpreter) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(config.Int(config.ShutdownTimeout))*time.Second)
+	defer cancel()
+
+	return i.RuntimeProvider.Processor.Shutdown(ctx)
+}
+
+/*
+handleShutdownSignals shuts down the interpreter and exits the program once
+SIGINT or SIGTERM is received.
+*/
+func (i *CLIInterpreter) handleShutdownSignals(interactive bool) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigs
+		signal.Stop(sigs)
+
+		i.shutdownOnSignal(sig, interactive)
+	}()
+}
+
+/*
+shutdownOnSignal shuts down the interpreter after a signal was received and
+exits the program. Leftover work is reported to the log output.
+*/
+func (i *CLIInterpreter) shutdownOnSignal(sig os.Signal, interactive bool) {
+	if interactive {
+		i.Term.StopTerm()
+	}
+
+	fmt.Fprintln(i.LogOut, fmt.Sprintf("Received %v - shutting down", sig))
+
+	if err := i.Shutdown(); err != nil {
+		fmt.Fprintln(i.LogOut, err.Error())
+		osExit(1)
+		return
+	}
+
+	osExit(0)
+}
+
 /*
 LoadStdlibPlugins load plugins from .ecal.json.
 */
@@ -380,10 +674,14 @@ func (i *CLIInterpreter) HandleInput(ot OutputTerminal, line string, tid uint64)
 		ot.WriteString(fmt.Sprint("Console supports all normal ECAL statements and the following special commands:\n"))
 		ot.WriteString(fmt.Sprint("\n"))
 		ot.WriteString(fmt.Sprint("    @format - Format all .ecal files in the current root directory.\n"))
+		ot.WriteString(fmt.Sprint("    @plugin [load|reload|unload] - List, load, reload or unload stdlib plugin functions.\n"))
 		ot.WriteString(fmt.Sprint("    @prof [profile] - Output profiling information (supports any of Go's pprof profiles).\n"))
+		ot.WriteString(fmt.Sprint("    @profile [start|stop|reset|folded] - Profile ECAL code and show execution times per function and line.\n"))
 		ot.WriteString(fmt.Sprint("    @reload - Clear the interpreter and reload the initial file if it was given.\n"))
+		ot.WriteString(fmt.Sprint("    @restore <file> - Restore the global variable scope from a snapshot file.\n"))
+		ot.WriteString(fmt.Sprint("    @save <file> - Save a snapshot of the global variable scope to a file.\n"))
 		ot.WriteString(fmt.Sprint("    @std <package> [glob] - List all available constants and functions of a stdlib package.\n"))
-		ot.WriteString(fmt.Sprint("    @sym [glob] - List all available inbuild functions and available stdlib packages of ECAL.\n"))
+		ot.WriteString(fmt.Sprint("    @sym [glob] - List all available inbuild functions, available stdlib packages and loaded plugin functions of ECAL.\n"))
 		if i.CustomHelpString != "" {
 			ot.WriteString(i.CustomHelpString)
 		}
@@ -423,7 +721,7 @@ func (i *CLIInterpreter) HandleInput(ot OutputTerminal, line string, tid uint64)
 			}
 
 			if ierr != nil {
-				ot.WriteString(fmt.Sprintln(ierr.Error()))
+				ot.WriteString(fmt.Sprintln(i.FormatError(ierr, line)))
 			}
 		}
 	}
@@ -434,7 +732,17 @@ handleSpecialStatements handles inbuild special statements.
 */
 func (i *CLIInterpreter) handleSpecialStatements(ot OutputTerminal, line string) bool {
 
-	if strings.HasPrefix(line, "@prof") {
+	if strings.HasPrefix(line, "@plugin") {
+		i.handlePlugin(ot, strings.Fields(line)[1:])
+
+		return true
+
+	} else if strings.HasPrefix(line, "@profile") {
+		i.handleProfile(ot, strings.Split(line, " ")[1:])
+
+		return true
+
+	} else if strings.HasPrefix(line, "@prof") {
 		args := strings.Split(line, " ")[1:]
 
 		profile := "goroutine"
@@ -465,12 +773,218 @@ func (i *CLIInterpreter) handleSpecialStatements(ot OutputTerminal, line string)
 		}()
 		ot.WriteString(fmt.Sprintln(fmt.Sprintln("Reloading interpreter state")))
 
+		return true
+
+	} else if strings.HasPrefix(line, "@save") || strings.HasPrefix(line, "@restore") {
+		args := strings.Split(line, " ")[1:]
+
+		if len(args) == 0 {
+			ot.WriteString(fmt.Sprintln("Need a snapshot file name"))
+			return true
+		}
+
+		var err error
+		var msg string
+
+		if strings.HasPrefix(line, "@save") {
+			err = i.SaveSnapshot(args[0])
+			msg = "Snapshot saved"
+		} else {
+			err = i.RestoreSnapshot(args[0])
+			msg = "Snapshot restored"
+		}
+
+		if err != nil {
+			ot.WriteString(fmt.Sprintln("Error:", err))
+		} else {
+			ot.WriteString(fmt.Sprintln(msg))
+		}
+
 		return true
 	}
 
 	return false
 }
 
+/*
+snapshotPath returns the path of a snapshot file. Relative paths are relative
+to the root directory of the interpreter.
+*/
+func (i *CLIInterpreter) snapshotPath(file string) string {
+	if !filepath.IsAbs(file) && i.Dir != nil {
+		file = filepath.Join(*i.Dir, file)
+	}
+	return file
+}
+
+/*
+SaveSnapshot saves the variables of the global scope to a file. Functions are
+stored by reference and are bound again when the snapshot is restored.
+*/
+func (i *CLIInterpreter) SaveSnapshot(file string) error {
+	data, err := scope.Serialize(i.GlobalVS)
+
+	if err == nil {
+		err = ioutil.WriteFile(i.snapshotPath(file), data, 0644)
+	}
+
+	return err
+}
+
+/*
+RestoreSnapshot restores the variables of the global scope from a file which
+was written by SaveSnapshot.
+*/
+func (i *CLIInterpreter) RestoreSnapshot(file string) error {
+	data, err := ioutil.ReadFile(i.snapshotPath(file))
+
+	if err == nil {
+		err = scope.Deserialize(i.GlobalVS, data)
+	}
+
+	return err
+}
+
+/*
+handlePlugin lists, loads, reloads and unloads stdlib plugin functions.
+Without further arguments the load command loads all plugins which are
+defined in .ecal.json.
+*/
+func (i *CLIInterpreter) handlePlugin(ot OutputTerminal, args []string) {
+	var err error
+
+	cmd := ""
+
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	switch {
+	case cmd == "load" && len(args) == 1:
+		err = i.LoadStdlibPlugins(false)
+
+	case cmd == "load" && len(args) == 4:
+		if pkg, name := splitPluginFuncName(args[1]); name != "" {
+			err = stdlib.AddStdlibPluginFunc(pkg, name, args[2], args[3])
+		} else {
+			err = fmt.Errorf("Function name must be of the form <package>.<name>")
+		}
+
+	case cmd == "reload" && len(args) == 2:
+		err = stdlib.ReloadStdlibPluginFunc(args[1])
+
+	case cmd == "unload" && len(args) == 2:
+		err = stdlib.UnloadStdlibPluginFunc(args[1])
+
+	case cmd == "":
+		tabData := []string{"Function", "Path", "Symbol", "Running calls"}
+
+		for _, p := range stdlib.GetStdlibPlugins() {
+			tabData = append(tabData, p.FullName(), p.Path, p.Symbol, fmt.Sprint(p.Calls()))
+		}
+
+		if len(tabData) > 4 {
+			ot.WriteString(stringutil.PrintGraphicStringTable(tabData, 4, 1,
+				stringutil.SingleDoubleLineTable))
+		} else {
+			ot.WriteString(fmt.Sprintln("No plugin functions loaded"))
+		}
+		return
+
+	default:
+		ot.WriteString(fmt.Sprintln("Usage: @plugin [load [<package>.<name> <path> <symbol>]|reload <package>.<name>|unload <package>.<name>]"))
+		return
+	}
+
+	if err != nil {
+		ot.WriteString(fmt.Sprintln("Error:", err))
+	} else {
+		ot.WriteString(fmt.Sprintln("Plugin", cmd, "done"))
+	}
+}
+
+/*
+splitPluginFuncName splits a full function name into package and name.
+*/
+func splitPluginFuncName(fullName string) (string, string) {
+	if idx := strings.Index(fullName, "."); idx > 0 {
+		return fullName[:idx], fullName[idx+1:]
+	}
+	return fullName, ""
+}
+
+/*
+profileDisplayRows is the maximum number of rows which are shown in profile tables.
+*/
+const profileDisplayRows = 20
+
+/*
+handleProfile controls the ECAL profiler and displays its results.
+*/
+func (i *CLIInterpreter) handleProfile(ot OutputTerminal, args []string) {
+	cmd := ""
+
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	if cmd == "start" {
+		i.RuntimeProvider.Profiler = interpreter.NewProfiler()
+		ot.WriteString(fmt.Sprintln("Profiling started"))
+		return
+	}
+
+	profiler := i.RuntimeProvider.Profiler
+
+	if profiler == nil {
+		ot.WriteString(fmt.Sprintln("Profiling is not active - use @profile start"))
+		return
+	}
+
+	switch cmd {
+	case "stop":
+		i.RuntimeProvider.Profiler = nil
+		ot.WriteString(fmt.Sprintln("Profiling stopped"))
+
+	case "reset":
+		profiler.Reset()
+		ot.WriteString(fmt.Sprintln("Profiling data reset"))
+
+	case "folded":
+		ot.WriteString(profiler.Folded())
+
+	default:
+		formatDuration := func(d time.Duration) string {
+			return d.Round(time.Microsecond).String()
+		}
+
+		tabData := []string{"Function", "Calls", "Inclusive", "Exclusive"}
+
+		for j, e := range profiler.Functions() {
+			if j == profileDisplayRows {
+				break
+			}
+			tabData = append(tabData, e.Name, fmt.Sprint(e.Count),
+				formatDuration(e.Inclusive), formatDuration(e.Exclusive))
+		}
+
+		ot.WriteString(stringutil.PrintGraphicStringTable(tabData, 4, 1,
+			stringutil.SingleDoubleLineTable))
+
+		tabData = []string{"Line", "Visits", "Time"}
+
+		for j, e := range profiler.Lines() {
+			if j == profileDisplayRows {
+				break
+			}
+			tabData = append(tabData, e.Name, fmt.Sprint(e.Count), formatDuration(e.Exclusive))
+		}
+
+		ot.WriteString(stringutil.PrintGraphicStringTable(tabData, 3, 1,
+			stringutil.SingleDoubleLineTable))
+	}
+}
+
 /*
 displaySymbols lists all available inbuild functions and available stdlib packages of ECAL.
 */
@@ -511,6 +1025,28 @@ func (i *CLIInterpreter) displaySymbols(ot OutputTerminal, args []string) {
 		ot.WriteString(stringutil.PrintGraphicStringTable(tabData, 2, 1,
 			stringutil.SingleDoubleLineTable))
 	}
+
+	tabData = []string{"Plugin function", "Plugin", "Version", "Path"}
+
+	for _, p := range stdlib.GetStdlibPlugins() {
+		name, version := p.PluginName, p.PluginVersion
+
+		if name == "" {
+			name, version = "unknown", "unknown"
+		}
+
+		if len(args) > 0 && !matchesFulltextSearch(ot,
+			fmt.Sprintf("%v %v %v %v", p.FullName(), name, version, p.Path), args[0]) {
+			continue
+		}
+
+		tabData = append(tabData, p.FullName(), name, version, p.Path)
+	}
+
+	if len(tabData) > 4 {
+		ot.WriteString(stringutil.PrintGraphicStringTable(tabData, 4, 1,
+			stringutil.SingleDoubleLineTable))
+	}
 }
 
 /*
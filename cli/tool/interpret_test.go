@@ -21,6 +21,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/krotik/common/errorutil"
 	"github.com/krotik/common/fileutil"
@@ -133,7 +134,7 @@ func TestInterpretBasicFunctions(t *testing.T) {
 
 	tin = NewCLIInterpreter()
 
-	osArgs = []string{"foo", "bar", "myfile"}
+	osArgs = []string{"foo", "bar", "myfile", "-x", "y"}
 
 	if stop := tin.ParseArgs(); stop {
 		t.Error("Giving an entry file should not stop the program")
@@ -145,8 +146,8 @@ func TestInterpretBasicFunctions(t *testing.T) {
 		return
 	}
 
-	if tin.EntryFile != "myfile" {
-		t.Error("Unexpected entryfile:", tin.EntryFile)
+	if tin.EntryFile != "myfile" || fmt.Sprint(tin.Args) != "[myfile -x y]" {
+		t.Error("Unexpected entryfile or args:", tin.EntryFile, tin.Args)
 		return
 	}
 
@@ -198,11 +199,94 @@ func TestCreateRuntimeProvider(t *testing.T) {
 		return
 	}
 
-	if _, ok := tin.RuntimeProvider.Logger.(*util.BufferLogger); !ok {
+	// The log level is taken from the config if it was not given
+
+	if lll, ok := tin.RuntimeProvider.Logger.(*util.LogLevelLogger); !ok || lll.Level() != util.Info {
 		t.Errorf("Unexpected logger: %#v", tin.RuntimeProvider.Logger)
 		return
 	}
 
+	if tin.RuntimeProvider.FileRoot != *tin.Dir || tin.RuntimeProvider.IsExecAllowed("ls") {
+		t.Error("Unexpected file root or exec policy:", tin.RuntimeProvider.FileRoot)
+		return
+	}
+
+	tin = newTestInterpreterWithConfig()
+	defer tearDown()
+
+	e := "ls,cat"
+	tin.Exec = &e
+
+	if err := tin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if !tin.RuntimeProvider.IsExecAllowed("cat") || tin.RuntimeProvider.IsExecAllowed("rm") {
+		t.Error("Unexpected exec policy:", tin.RuntimeProvider.ExecAllowList)
+		return
+	}
+
+	tin = newTestInterpreterWithConfig()
+	defer tearDown()
+
+	n := "localhost:*,127.0.0.1:8080"
+	tin.Net = &n
+
+	if err := tin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if !tin.RuntimeProvider.IsNetworkAllowed("localhost:1234") || !tin.RuntimeProvider.IsNetworkAllowed("127.0.0.1:8080") ||
+		tin.RuntimeProvider.IsNetworkAllowed("127.0.0.1:8081") || tin.RuntimeProvider.IsNetworkAllowed("localhost") {
+		t.Error("Unexpected network policy:", tin.RuntimeProvider.NetAllowList)
+		return
+	}
+
+	// Options which are not given on the command line are read from the config
+
+	defer func() {
+		for k, v := range config.DefaultConfig {
+			config.Config[k] = v
+		}
+	}()
+
+	tin = newTestInterpreterWithConfig()
+	defer tearDown()
+
+	c := filepath.Join(testDir, "config.json")
+	tin.Config = &c
+	tin.Net = &n
+
+	ioutil.WriteFile(c, []byte(`{"LogLevel": "error", "ExecAllowList": "ls", "NetAllowList": ["*"]}`), 0660)
+
+	if err := tin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if lll, ok := tin.RuntimeProvider.Logger.(*util.LogLevelLogger); !ok || lll.Level() != util.Error ||
+		!tin.RuntimeProvider.IsExecAllowed("ls") || tin.RuntimeProvider.IsNetworkAllowed("127.0.0.1:8081") {
+		t.Errorf("Unexpected result: %#v %v %v", tin.RuntimeProvider.Logger,
+			tin.RuntimeProvider.ExecAllowList, tin.RuntimeProvider.NetAllowList)
+		return
+	}
+
+	tin = newTestInterpreterWithConfig()
+	defer tearDown()
+
+	c = filepath.Join(testDir, "config.json")
+	tin.Config = &c
+
+	ioutil.WriteFile(c, []byte(`{"LogLevel": "foo"}`), 0660)
+
+	if err := tin.CreateRuntimeProvider("foo"); err == nil ||
+		err.Error() != "Config option LogLevel needs a log level (debug, info or error): foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
 	tin = newTestInterpreterWithConfig()
 	defer tearDown()
 
@@ -254,6 +338,24 @@ func TestLoadInitialFile(t *testing.T) {
 
 	if tin.GlobalVS.String() != `GlobalScope {
     a (float64) : 1
+}` {
+		t.Error("Unexpected scope:", tin.GlobalVS)
+		return
+	}
+
+	tin.Args = []string{tin.EntryFile, "foo"}
+	tin.RuntimeProvider.Args = tin.Args
+
+	ioutil.WriteFile(tin.EntryFile, []byte("a := os.args()[1]"), 0777)
+
+	if err := tin.CLIInterpreter.LoadInitialFile(1); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if tin.GlobalVS.String() != `GlobalScope {
+    a (string) : foo
+    osArgs ([]interface {}) : ["`+tin.EntryFile+`","foo"]
 }` {
 		t.Error("Unexpected scope:", tin.GlobalVS)
 		return
@@ -305,6 +407,364 @@ Type 'q' or 'quit' to exit the shell and '?' to get help
 	}
 }
 
+func TestFormatError(t *testing.T) {
+	tin := newTestInterpreterWithConfig()
+	defer tearDown()
+
+	if err := tin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	tin.RuntimeProvider.Logger = util.NewMemoryLogger(10)
+	tin.RuntimeProvider.ImportLocator = &util.MemoryImportLocator{
+		Files: map[string]string{
+			"lib": "func fail() {\n\tx := 1 + \"a\"\n}",
+		},
+	}
+
+	l1 := ""
+	tin.LogFile = &l1
+	l2 := ""
+	tin.LogLevel = &l2
+
+	tin.EntryFile = filepath.Join(testDir, "foo.ecal")
+
+	// Parse errors in the entry file
+
+	ioutil.WriteFile(tin.EntryFile, []byte("a := 1\nb := (1 + )"), 0777)
+
+	if err := tin.Interpret(false); err == nil || err.Error() != `Parse error in tooltest/foo.ecal: Term cannot start an expression ()) (Line:2 Pos:11)
+   2 | b := (1 + )
+     |           ^` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Runtime errors in imported code
+
+	ioutil.WriteFile(tin.EntryFile, []byte("import \"lib\" as lib\nlib.fail()"), 0777)
+
+	if err := tin.Interpret(false); err == nil || err.Error() != `ECAL error in foo (lib): Operand is not a number (a) (Line:2 Pos:11)
+   2 | 	x := 1 + "a"
+     | 	         ^` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Colored output
+
+	color := true
+	tin.Color = &color
+
+	if res := tin.FormatError(&util.RuntimeError{Source: "console input", Type: util.ErrRuntimeError,
+		Detail: "foo", Line: 1, Pos: 3}, "a b"); res != "\x1b[1;31mECAL error in console input: Runtime error (foo) (Line:1 Pos:3)\x1b[0m\n"+
+		"\x1b[2m   1 | \x1b[0ma b\n\x1b[2m     | \x1b[0m  \x1b[1;31m^\x1b[0m" {
+		t.Errorf("Unexpected result: %q", res)
+		return
+	}
+
+	// Other errors and errors without source are not changed
+
+	if res := tin.FormatError(fmt.Errorf("foo"), ""); res != "foo" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := tin.FormatError(&util.RuntimeError{Source: "bar", Type: util.ErrRuntimeError, Detail: "foo", Line: 1, Pos: 3}, ""); res != "ECAL error in bar: Runtime error (foo) (Line:1 Pos:3)" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	tin := newTestInterpreterWithConfig()
+	defer tearDown()
+
+	if err := tin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	tin.RuntimeProvider.Logger = util.NewMemoryLogger(10)
+	tin.EntryFile = filepath.Join(testDir, "foo.ecal")
+
+	ioutil.WriteFile(tin.EntryFile, []byte(`
+sink test
+  kindmatch [ "foo.*" ],
+{
+	log("pulse")
+}
+setPulseTrigger(100, "pulseevent", "foo.bar")
+`), 0777)
+
+	if err := tin.LoadInitialFile(1); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	lastReturnCode = -1
+	osExit = func(code int) {
+		lastReturnCode = code
+	}
+
+	tin.shutdownOnSignal(os.Interrupt, false)
+
+	if lastReturnCode != 0 || testLogOut.String() != "Received interrupt - shutting down\n" {
+		t.Error("Unexpected result:", lastReturnCode, testLogOut.String())
+		return
+	}
+
+	if !tin.RuntimeProvider.Processor.Stopped() {
+		t.Error("Processor should be stopped")
+		return
+	}
+
+	// Leftover work is reported
+
+	ioutil.WriteFile(tin.EntryFile, []byte(`
+sink test
+  kindmatch [ "foo.*" ],
+{
+	log("delayed")
+}
+addEventAfter(10, "delayed", "foo.bar", {})
+`), 0777)
+
+	if err := tin.LoadInitialFile(1); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	testLogOut.Reset()
+
+	tin.shutdownOnSignal(os.Interrupt, false)
+
+	if lastReturnCode != 1 || testLogOut.String() != `Received interrupt - shutting down
+Shutdown left work behind: 0 queued tasks, 0 running triggers, 1 dropped delayed event
+` {
+		t.Error("Unexpected result:", lastReturnCode, testLogOut.String())
+		return
+	}
+}
+
+func TestInterpretAPIServer(t *testing.T) {
+	tin := newTestInterpreterWithConfig()
+	defer tearDown()
+
+	if err := tin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	l1 := ""
+	tin.LogFile = &l1
+	l2 := ""
+	tin.LogLevel = &l2
+	a := "localhost:0"
+	tin.APIAddr = &a
+
+	testTerm.in = []string{"q"}
+
+	if err := tin.Interpret(true); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if !strings.Contains(testLogOut.String(), "API server on: 127.0.0.1:") ||
+		strings.Contains(testLogOut.String(), "Warning") {
+		t.Error("Unexpected result:", testLogOut.String())
+		return
+	}
+
+	a = ":0"
+	testLogOut.Reset()
+	testTerm.in = []string{"q"}
+
+	if err := tin.Interpret(true); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if !strings.Contains(testLogOut.String(), "Warning: API server on ") ||
+		!strings.Contains(testLogOut.String(), "does not require a token (use -apitoken)") {
+		t.Error("Unexpected result:", testLogOut.String())
+		return
+	}
+
+	token := "secret"
+	tin.APIToken = &token
+	testLogOut.Reset()
+	testTerm.in = []string{"q"}
+
+	if err := tin.Interpret(true); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if strings.Contains(testLogOut.String(), "Warning") {
+		t.Error("Unexpected result:", testLogOut.String())
+		return
+	}
+
+	a = "localhost:-1"
+	testTerm.in = []string{"q"}
+
+	if err := tin.Interpret(true); err == nil || !strings.Contains(err.Error(), "invalid port") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestHandleProfile(t *testing.T) {
+	tin := newTestInterpreterWithConfig()
+	defer tearDown()
+
+	if err := tin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	handle := func(line string) string {
+		testTerm.out.Reset()
+		tin.HandleInput(testTerm, line, tin.RuntimeProvider.NewThreadID())
+		return testTerm.out.String()
+	}
+
+	if res := handle("@profile"); res != "Profiling is not active - use @profile start\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@profile start"); res != "Profiling started\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	handle("func myfunc() {\n  sleep(1ms)\n}")
+	handle("myfunc()")
+
+	if res := handle("@profile"); !strings.Contains(res, "│myfunc ") ||
+		!strings.Contains(res, "│sleep ") || !strings.Contains(res, "│console input:2 ") {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@profile folded"); !strings.HasPrefix(res, "myfunc ") ||
+		!strings.Contains(res, "\nmyfunc;sleep ") {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@profile reset") + handle("@profile folded"); res != "Profiling data reset\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@profile stop"); res != "Profiling stopped\n" || tin.RuntimeProvider.Profiler != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestHandlePlugin(t *testing.T) {
+	tin := newTestInterpreterWithConfig()
+	defer tearDown()
+
+	if err := tin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	handle := func(line string) string {
+		testTerm.out.Reset()
+		tin.HandleInput(testTerm, line, tin.RuntimeProvider.NewThreadID())
+		return testTerm.out.String()
+	}
+
+	if res := handle("@plugin"); res != "No plugin functions loaded\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@plugin load"); res != "Plugin load done\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@plugin load foo ./myfunc.so ECALmyfunc"); res !=
+		"Error: Function name must be of the form <package>.<name>\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@plugin load foo.bar ./myfunc.so ECALmyfunc"); !strings.HasPrefix(res, "Error: plugin.Open") {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@plugin reload foo.bar"); res != "Error: Function foo.bar was not loaded from a plugin\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@plugin unload foo.bar"); res != "Error: Function foo.bar was not loaded from a plugin\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@plugin foo"); !strings.HasPrefix(res, "Usage: @plugin") {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestHandleSnapshot(t *testing.T) {
+	tin := newTestInterpreterWithConfig()
+	defer tearDown()
+
+	if err := tin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	handle := func(line string) string {
+		testTerm.out.Reset()
+		tin.HandleInput(testTerm, line, tin.RuntimeProvider.NewThreadID())
+		return testTerm.out.String()
+	}
+
+	handle("func myfunc() {\n  return 42\n}")
+	handle(`a := {"b" : [1, 2], 3 : "c", "f" : myfunc}`)
+
+	if res := handle("@save"); res != "Need a snapshot file name\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@save snapshot.json"); res != "Snapshot saved\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	handle(`a.b := null`)
+
+	if res := handle("@restore snapshot.json"); res != "Snapshot restored\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle(`[a.b[1], a[3], a.f()]`); res != "[2,\"c\",42]\n" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := handle("@restore foo.json"); !strings.HasPrefix(res, "Error: open ") {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
 func TestHandleInput(t *testing.T) {
 	tin := newTestInterpreterWithConfig()
 	defer tearDown()
@@ -338,6 +798,12 @@ func TestHandleInput(t *testing.T) {
 		return
 	}
 
+	// Wait for the reload which happens in the background
+
+	for j := 0; j < 200 && !strings.Contains(testTerm.out.String(), "Interpreter reloaded"); j++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
 	// Just check for a simple string no need for the whole thing
 
 	if !strings.Contains(testTerm.out.String(), "Creates a new object instance.") {
@@ -389,6 +855,8 @@ func TestHandleInput(t *testing.T) {
 
 	if testTerm.out.String() != `1
 ECAL error in foo (console input): 123 () (Line:1 Pos:1)
+   1 | raise(123)
+     | ^
 ` {
 		t.Error("Unexpected result:", testTerm.out.String())
 		return
@@ -0,0 +1,123 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/krotik/ecal/interpreter"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+Lint checks a given set of ECAL files for problems.
+*/
+func Lint() error {
+	wd, _ := os.Getwd()
+
+	dir := flag.String("dir", wd, "Root directory for ECAL files")
+	ext := flag.String("ext", ".ecal", "Extension for ECAL files")
+	showHelp := flag.Bool("help", false, "Show this help message")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), fmt.Sprintf("Usage of %s lint [options]", os.Args[0]))
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "This tool will check all ECAL files in a directory structure for syntax")
+		fmt.Fprintln(flag.CommandLine.Output(), "errors, invalid constructs and reads of variables which are never assigned.")
+		fmt.Fprintln(flag.CommandLine.Output())
+	}
+
+	if len(os.Args) >= 2 {
+		flag.CommandLine.Parse(osArgs[2:])
+
+		if *showHelp {
+			flag.Usage()
+			return nil
+		}
+	}
+
+	problems, err := LintFiles(*dir, *ext)
+
+	if err == nil {
+		for _, p := range problems {
+			fmt.Fprintln(flag.CommandLine.Output(), p)
+		}
+
+		if len(problems) > 0 {
+			err = fmt.Errorf("Found %v problems", len(problems))
+		}
+	}
+
+	return err
+}
+
+/*
+LintFiles checks all ECAL files in a given directory with a given ending for
+syntax errors, invalid constructs and reads of variables which are never
+assigned. Returns a list of all problems which were found.
+*/
+func LintFiles(dir string, ext string) ([]string, error) {
+	var problems []string
+
+	// Try to resolve symbolic links
+
+	scanDir, lerr := os.Readlink(dir)
+	if lerr != nil {
+		scanDir = dir
+	}
+
+	erp := interpreter.NewECALRuntimeProvider("lint", &util.FileImportLocator{Root: scanDir}, nil)
+	defer erp.Cron.Stop()
+
+	err := filepath.Walk(scanDir,
+		func(path string, i os.FileInfo, err error) error {
+			if err == nil && !i.IsDir() && strings.HasSuffix(path, ext) {
+				var data []byte
+
+				if data, err = ioutil.ReadFile(path); err == nil {
+					relPath, _ := filepath.Rel(scanDir, path)
+
+					// Parse the whole file to find all syntax errors
+
+					res := parser.ParseAllWithRuntime(relPath, string(data), erp)
+
+					for _, perr := range res.Errors {
+						problems = append(problems, perr.Error())
+					}
+
+					if len(res.Errors) == 0 && res.AST != nil {
+						var verr error
+
+						if verr = res.AST.Runtime.Validate(); verr == nil {
+							verr = erp.ValidateVariables(res.AST, scope.NewScope(scope.GlobalScope))
+						}
+
+						if verr != nil {
+							problems = append(problems, verr.Error())
+						}
+					}
+				}
+			}
+			return err
+		})
+
+	return problems, err
+}
@@ -0,0 +1,83 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	setupFormatTestDir()
+	defer tearDownFormatTestDir()
+
+	out := bytes.Buffer{}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	osArgs = []string{"foo", "bar", "-help"}
+
+	if err := Lint(); err != nil || !strings.Contains(out.String(), "Root directory for ECAL files") {
+		t.Error("Unexpected result:", err, out.String())
+		return
+	}
+
+	os.Mkdir(filepath.Join(formatTestDir, "lib"), 0770)
+
+	ioutil.WriteFile(filepath.Join(formatTestDir, "lib", "util.ecal"), []byte(`
+func add(a, b) {
+    return a + b
+}
+`), 0660)
+
+	ioutil.WriteFile(filepath.Join(formatTestDir, "main.ecal"), []byte(`
+import "lib/util.ecal" as util
+a := util.add(1, 2)
+`), 0660)
+
+	if res, err := LintFiles(formatTestDir, ".ecal"); err != nil || len(res) != 0 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	ioutil.WriteFile(filepath.Join(formatTestDir, "main.ecal"), []byte(`
+b := (1 + )
+`), 0660)
+
+	ioutil.WriteFile(filepath.Join(formatTestDir, "other.ecal"), []byte(`
+a := c + 1
+`), 0660)
+
+	if res, err := LintFiles(formatTestDir, ".ecal"); err != nil || strings.Join(res, "\n") !=
+		`Parse error in main.ecal: Term cannot start an expression ()) (Line:2 Pos:11)
+ECAL error in lint (other.ecal): Cannot access variable (Variable c is not assigned in any enclosing scope) (Line:2 Pos:6)` {
+		t.Error("Unexpected result:", strings.Join(res, "\n"), err)
+		return
+	}
+
+	out.Reset()
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	osArgs = []string{"foo", "bar", "-dir", formatTestDir}
+
+	if err := Lint(); err == nil || err.Error() != "Found 2 problems" || !strings.Contains(out.String(), "other.ecal") {
+		t.Error("Unexpected result:", err, out.String())
+		return
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"unicode"
 
@@ -26,13 +27,15 @@ import (
 	"github.com/krotik/common/fileutil"
 	"github.com/krotik/ecal/interpreter"
 	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/parser/astutil"
 	"github.com/krotik/ecal/scope"
 	"github.com/krotik/ecal/util"
 )
 
 /*
 CLIPacker is a commandline packing tool for ECAL. This tool can build a self
-contained executable.
+contained executable, a single bundle file or a Go source file which embeds
+the code.
 */
 type CLIPacker struct {
 	EntryFile string // Entry file for the program
@@ -42,6 +45,8 @@ type CLIPacker struct {
 	Dir          *string // Root dir for interpreter (all files will be collected)
 	SourceBinary *string // Binary which is used by the packer
 	TargetBinary *string // Binary which will be build by the packer
+	Format       *string // Output format (binary, bundle or go)
+	Package      *string // Package name of generated Go source files
 
 	// Log output
 
@@ -55,7 +60,7 @@ var packmarker = fmt.Sprintf("\n%v%v%v\n", packmarkerend, "ECALSRC", packmarkere
 NewCLIPacker creates a new commandline packer.
 */
 func NewCLIPacker() *CLIPacker {
-	return &CLIPacker{"", nil, nil, nil, os.Stdout}
+	return &CLIPacker{"", nil, nil, nil, nil, nil, os.Stdout}
 }
 
 /*
@@ -74,7 +79,9 @@ func (p *CLIPacker) ParseArgs() bool {
 
 	p.Dir = flag.String("dir", wd, "Root directory for ECAL interpreter")
 	p.SourceBinary = flag.String("source", binname, "Filename for source binary")
-	p.TargetBinary = flag.String("target", "out.bin", "Filename for target binary")
+	p.TargetBinary = flag.String("target", "out.bin", "Filename for target binary (or target file for bundle and go formats)")
+	p.Format = flag.String("format", "binary", "Output format (binary, bundle or go)")
+	p.Package = flag.String("package", "main", "Package name of generated Go source file")
 	showHelp := flag.Bool("help", false, "Show this help message")
 
 	flag.Usage = func() {
@@ -85,6 +92,8 @@ func (p *CLIPacker) ParseArgs() bool {
 		fmt.Fprintln(flag.CommandLine.Output())
 		fmt.Fprintln(flag.CommandLine.Output(), "This tool will collect all files in the root directory and "+
 			"build a standalone executable from the given source binary and the collected files.")
+		fmt.Fprintln(flag.CommandLine.Output(), "The bundle and go formats only collect the entry file and "+
+			"its imports and write them into a single bundle file or a Go source file.")
 		fmt.Fprintln(flag.CommandLine.Output())
 	}
 
@@ -113,6 +122,10 @@ func (p *CLIPacker) Pack() error {
 		return nil
 	}
 
+	if p.Format != nil && *p.Format != "binary" {
+		return p.packSources()
+	}
+
 	fmt.Fprintln(p.LogOut, fmt.Sprintf("Packing %v -> %v from %v with entry: %v", *p.Dir,
 		*p.TargetBinary, *p.SourceBinary, p.EntryFile))
 
@@ -197,6 +210,123 @@ func (p *CLIPacker) packFiles(w *zip.Writer, filePath string, zipPath string) er
 	return err
 }
 
+/*
+packSources writes the entry file and all its imports either into a single
+bundle file or into a Go source file.
+*/
+func (p *CLIPacker) packSources() error {
+	var out string
+
+	format := *p.Format
+
+	if format != "bundle" && format != "go" {
+		return fmt.Errorf("Unknown output format: %v", format)
+	}
+
+	fmt.Fprintln(p.LogOut, fmt.Sprintf("Packing %v -> %v (%v) with entry: %v", *p.Dir,
+		*p.TargetBinary, format, p.EntryFile))
+
+	entry, files, err := p.collectSources()
+
+	if err == nil {
+		if format == "bundle" {
+			out = util.CreateBundle(entry, files)
+		} else {
+			out = p.goSource(entry, files)
+		}
+
+		if err = ioutil.WriteFile(*p.TargetBinary, []byte(out), 0644); err == nil {
+			fmt.Fprintln(p.LogOut, fmt.Sprintf("Wrote %v files (%v bytes)", len(files), len(out)))
+		}
+	}
+
+	return err
+}
+
+/*
+collectSources reads the entry file and resolves all its imports (and their
+imports) via the import locator of the root directory. Returns the import path
+of the entry file and a map of import paths to code.
+*/
+func (p *CLIPacker) collectSources() (string, map[string]string, error) {
+	var data []byte
+
+	files := make(map[string]string)
+	il := &util.FileImportLocator{Root: *p.Dir}
+
+	entry, err := filepath.Rel(*p.Dir, p.EntryFile)
+
+	if err == nil {
+		entry = filepath.ToSlash(entry)
+
+		if data, err = ioutil.ReadFile(p.EntryFile); err == nil {
+			toCollect := []string{entry}
+			files[entry] = string(data)
+
+			for len(toCollect) > 0 && err == nil {
+				var ast *parser.ASTNode
+
+				path := toCollect[0]
+				toCollect = toCollect[1:]
+
+				if ast, err = parser.Parse(path, files[path]); err == nil {
+
+					for _, node := range astutil.FindByName(ast, parser.NodeIMPORT) {
+						var importPath, code string
+
+						if importPath, err = util.ResolveImportPath(path, node.Children[0].Token.Val); err != nil {
+							break
+						}
+
+						if _, ok := files[importPath]; !ok {
+							if code, err = il.Resolve(importPath); err != nil {
+								break
+							}
+
+							files[importPath] = code
+							toCollect = append(toCollect, importPath)
+
+							fmt.Fprintln(p.LogOut, fmt.Sprintf("Collected %v bytes for %v", len(code), importPath))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return entry, files, err
+}
+
+/*
+goSource generates Go source code which embeds the given files in a
+MemoryImportLocator.
+*/
+func (p *CLIPacker) goSource(entry string, files map[string]string) string {
+	var buf strings.Builder
+	var paths []string
+
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	buf.WriteString("// Code generated by ecal pack. DO NOT EDIT.\n\n")
+	buf.WriteString(fmt.Sprintf("package %v\n\n", *p.Package))
+	buf.WriteString("import \"github.com/krotik/ecal/util\"\n\n")
+	buf.WriteString("// ECALEntryFile is the import path of the entry file of the packed ECAL code.\n")
+	buf.WriteString(fmt.Sprintf("const ECALEntryFile = %q\n\n", entry))
+	buf.WriteString("// ECALImportLocator provides all packed ECAL code.\n")
+	buf.WriteString("var ECALImportLocator = &util.MemoryImportLocator{Files: map[string]string{\n")
+
+	for _, path := range paths {
+		buf.WriteString(fmt.Sprintf("\t%q: %q,\n", path, files[path]))
+	}
+
+	buf.WriteString("}}\n")
+
+	return buf.String()
+}
+
 var ( // Internal reading buffers
 	b1 = 4096
 	b2 = len(packmarker) + 11
@@ -327,6 +457,7 @@ func runInterpreter(reader io.ReaderAt, size int64) (interface{}, error) {
 		var ast *parser.ASTNode
 
 		erp := interpreter.NewECALRuntimeProvider(osArgs[0], il, util.NewStdOutLogger())
+		erp.Args = os.Args
 
 		if ast, err = parser.ParseWithRuntime(os.Args[0], il.Files[".ecalsrc-entry"], erp); err == nil {
 			if err = ast.Runtime.Validate(); err == nil {
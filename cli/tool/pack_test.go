@@ -276,3 +276,124 @@ func testRunningPackedBinary(t *testing.T) {
 		return
 	}
 }
+
+func TestPackSources(t *testing.T) {
+	setupPackTestDir()
+	defer tearDownPackTestDir()
+
+	packTestEntry := filepath.Join(packTestDir, "myentry.ecal")
+	packTestBundle := filepath.Join(packTestDir, "out.ecal")
+	packTestGo := filepath.Join(packTestDir, "out.go")
+
+	errorutil.AssertOk(ioutil.WriteFile(packTestEntry, []byte(`import "sub/lib.ecal" as lib
+a := lib.b`), 0777))
+	errorutil.AssertOk(ioutil.WriteFile(filepath.Join(packTestDir, "sub", "lib.ecal"), []byte(`import "./lib2.ecal" as lib2
+import "sub/lib2.ecal" as lib3
+b := lib2.c + 1`), 0777))
+	errorutil.AssertOk(ioutil.WriteFile(filepath.Join(packTestDir, "sub", "lib2.ecal"), []byte("c := 41"), 0777))
+	errorutil.AssertOk(ioutil.WriteFile(filepath.Join(packTestDir, "sub", "unused.ecal"), []byte("d := 1"), 0777))
+
+	pack := func(args ...string) error {
+		clip := newTestCLIPacker()
+
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+		flag.CommandLine.SetOutput(&bytes.Buffer{})
+
+		osArgs = append([]string{"ecal", "pack", "-dir", packTestDir}, args...)
+
+		return clip.Pack()
+	}
+
+	if err := pack("-format", "bundle", "-target", packTestBundle, packTestEntry); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	data, err := ioutil.ReadFile(packTestBundle)
+	errorutil.AssertOk(err)
+
+	if string(data) != `####ECALBUNDLE####
+####ECALFILE#### myentry.ecal
+import "sub/lib.ecal" as lib
+a := lib.b
+####ECALFILE#### sub/lib.ecal
+import "./lib2.ecal" as lib2
+import "sub/lib2.ecal" as lib3
+b := lib2.c + 1
+####ECALFILE#### sub/lib2.ecal
+c := 41
+` {
+		t.Error("Unexpected result:", string(data))
+		return
+	}
+
+	// Run the bundle
+
+	tin := newTestInterpreter()
+	l := packTestDir
+	tin.Dir = &l
+	l1 := ""
+	tin.LogFile = &l1
+	l2 := ""
+	tin.LogLevel = &l2
+
+	errorutil.AssertOk(tin.CreateRuntimeProvider("foo"))
+
+	tin.EntryFile = packTestBundle
+
+	os.Remove(filepath.Join(packTestDir, "sub", "lib.ecal")) // Imports must come from the bundle
+
+	if err := tin.LoadInitialFile(tin.RuntimeProvider.NewThreadID()); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, _, _ := tin.GlobalVS.GetValue("a"); fmt.Sprint(res) != "42" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	errorutil.AssertOk(ioutil.WriteFile(filepath.Join(packTestDir, "sub", "lib.ecal"), []byte("b := 1"), 0777))
+
+	if err := pack("-format", "go", "-package", "myapp", "-target", packTestGo, packTestEntry); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	data, err = ioutil.ReadFile(packTestGo)
+	errorutil.AssertOk(err)
+
+	if string(data) != `// Code generated by ecal pack. DO NOT EDIT.
+
+package myapp
+
+import "github.com/krotik/ecal/util"
+
+// ECALEntryFile is the import path of the entry file of the packed ECAL code.
+const ECALEntryFile = "myentry.ecal"
+
+// ECALImportLocator provides all packed ECAL code.
+var ECALImportLocator = &util.MemoryImportLocator{Files: map[string]string{
+	"myentry.ecal": "import \"sub/lib.ecal\" as lib\na := lib.b",
+	"sub/lib.ecal": "b := 1",
+}}
+` {
+		t.Error("Unexpected result:", string(data))
+		return
+	}
+
+	// Test error cases
+
+	if err := pack("-format", "foo", packTestEntry); err == nil || err.Error() != "Unknown output format: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	errorutil.AssertOk(ioutil.WriteFile(packTestEntry, []byte(`import "sub/foo.ecal" as lib`), 0777))
+
+	if err := pack("-format", "bundle", "-target", packTestBundle, packTestEntry); err == nil ||
+		!strings.HasPrefix(err.Error(), "Could not import path sub/foo.ecal") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
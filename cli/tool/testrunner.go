@@ -0,0 +1,213 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/krotik/ecal/interpreter"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+TestResult is the result of a single test function in an ECAL test file.
+*/
+type TestResult struct {
+	File     string        // Path of the test file relative to the root directory
+	Name     string        // Name of the test function (blank if the file could not be loaded)
+	Err      error         // Error of the test (nil if the test passed)
+	Duration time.Duration // Run time of the test
+	Log      []string      // Log messages of the test file
+}
+
+/*
+Test runs the tests in a given set of ECAL test files.
+*/
+func Test() error {
+	wd, _ := os.Getwd()
+
+	dir := flag.String("dir", wd, "Root directory for ECAL files")
+	ext := flag.String("ext", "_test.ecal", "Extension for ECAL test files")
+	run := flag.String("run", "", "Run only tests whose name matches the given regular expression")
+	showHelp := flag.Bool("help", false, "Show this help message")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), fmt.Sprintf("Usage of %s test [options]", os.Args[0]))
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "This tool will run all top-level functions whose name starts with")
+		fmt.Fprintln(flag.CommandLine.Output(), "'test' in all ECAL test files in a directory structure. Each file runs")
+		fmt.Fprintln(flag.CommandLine.Output(), "in its own interpreter. A test fails if it raises an error (e.g. by a")
+		fmt.Fprintln(flag.CommandLine.Output(), "failing assert statement).")
+		fmt.Fprintln(flag.CommandLine.Output())
+	}
+
+	if len(os.Args) >= 2 {
+		flag.CommandLine.Parse(osArgs[2:])
+
+		if *showHelp {
+			flag.Usage()
+			return nil
+		}
+	}
+
+	results, err := RunTests(*dir, *ext, *run)
+
+	if err == nil {
+		var failed int
+
+		out := flag.CommandLine.Output()
+
+		for _, r := range results {
+			if r.Err == nil {
+				fmt.Fprintln(out, fmt.Sprintf("ok   %v %v (%v)", r.File, r.Name, r.Duration))
+				continue
+			}
+
+			failed++
+
+			fmt.Fprintln(out, fmt.Sprintf("FAIL %v %v (%v)", r.File, r.Name, r.Duration))
+			fmt.Fprintln(out, fmt.Sprint("    ", strings.Replace(r.Err.Error(), "\n", "\n    ", -1)))
+
+			for _, l := range r.Log {
+				fmt.Fprintln(out, fmt.Sprint("    ", l))
+			}
+		}
+
+		fmt.Fprintln(out, fmt.Sprintf("%v tests, %v failed", len(results), failed))
+
+		if failed > 0 {
+			err = fmt.Errorf("%v of %v tests failed", failed, len(results))
+		}
+	}
+
+	return err
+}
+
+/*
+RunTests runs all top-level functions whose name starts with "test" in all
+ECAL files in a given directory with a given ending. Only tests whose name
+matches a given regular expression are run (a blank expression matches all
+tests). Each file runs in its own interpreter.
+*/
+func RunTests(dir string, ext string, run string) ([]*TestResult, error) {
+	var results []*TestResult
+
+	re, err := regexp.Compile(run)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid test name expression: %v", err)
+	}
+
+	// Try to resolve symbolic links
+
+	scanDir, lerr := os.Readlink(dir)
+	if lerr != nil {
+		scanDir = dir
+	}
+
+	err = filepath.Walk(scanDir,
+		func(path string, i os.FileInfo, err error) error {
+			if err == nil && !i.IsDir() && strings.HasSuffix(path, ext) {
+				var data []byte
+
+				if data, err = ioutil.ReadFile(path); err == nil {
+					relPath, _ := filepath.Rel(scanDir, path)
+
+					results = append(results, runTestFile(scanDir, filepath.ToSlash(relPath), string(data), re)...)
+				}
+			}
+			return err
+		})
+
+	return results, err
+}
+
+/*
+runTestFile runs all tests of a given ECAL test file in a new interpreter.
+*/
+func runTestFile(dir string, name string, code string, re *regexp.Regexp) []*TestResult {
+	var results []*TestResult
+	var ast *parser.ASTNode
+
+	logger := util.NewMemoryLogger(100)
+	erp := interpreter.NewECALRuntimeProvider(name, &util.FileImportLocator{Root: dir}, logger)
+	erp.FileRoot = dir
+
+	defer func() {
+		erp.Cron.Stop()
+		erp.Processor.Finish()
+	}()
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	// Load the test file
+
+	start := time.Now()
+
+	ast, err := parser.ParseWithRuntime(name, code, erp)
+
+	if err == nil {
+		if err = ast.Runtime.Validate(); err == nil {
+			_, err = ast.Runtime.Eval(vs, make(map[string]interface{}), erp.NewThreadID())
+		}
+	}
+
+	if err != nil {
+		return []*TestResult{{name, "", err, time.Since(start), logger.Slice()}}
+	}
+
+	// Run all test functions in the order of their declaration
+
+	statements := ast.Children
+
+	if ast.Name != parser.NodeSTATEMENTS {
+		statements = []*parser.ASTNode{ast}
+	}
+
+	for _, c := range statements {
+		var call *parser.ASTNode
+
+		if c.Name != parser.NodeFUNC || len(c.Children) == 0 || c.Children[0].Name != parser.NodeIDENTIFIER {
+			continue
+		}
+
+		testName := c.Children[0].Token.Val
+
+		if !strings.HasPrefix(testName, "test") || !re.MatchString(testName) {
+			continue
+		}
+
+		logger.Reset()
+		start = time.Now()
+
+		if call, err = parser.ParseWithRuntime(name, fmt.Sprintf("%v()", testName), erp); err == nil {
+			if err = call.Runtime.Validate(); err == nil {
+				_, err = call.Runtime.Eval(vs, make(map[string]interface{}), erp.NewThreadID())
+			}
+		}
+
+		results = append(results, &TestResult{name, testName, err, time.Since(start), logger.Slice()})
+	}
+
+	return results
+}
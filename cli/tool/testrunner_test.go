@@ -0,0 +1,126 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTestRunner(t *testing.T) {
+	setupFormatTestDir()
+	defer tearDownFormatTestDir()
+
+	out := bytes.Buffer{}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	osArgs = []string{"foo", "bar", "-help"}
+
+	if err := Test(); err != nil || !strings.Contains(out.String(), "Extension for ECAL test files") {
+		t.Error("Unexpected result:", err, out.String())
+		return
+	}
+
+	ioutil.WriteFile(filepath.Join(formatTestDir, "util.ecal"), []byte(`
+func add(a, b) {
+    return a + b
+}
+`), 0660)
+
+	ioutil.WriteFile(filepath.Join(formatTestDir, "util_test.ecal"), []byte(`
+import "util.ecal" as util
+
+sink double
+    kindmatch [ "double" ],
+	{
+        return event.state.val * 2
+	}
+
+func testAdd() {
+    assert util.add(1, 2) == 3
+}
+
+func helper() {
+    raise("helper should not run")
+}
+
+func testFail() {
+    log("about to fail")
+    assert util.add(1, 2) == 4
+}
+
+func testSink() {
+    res := addEventAndWait("double", "double", { "val" : 21 })
+    assert res[0].results.double == 42
+}
+`), 0660)
+
+	ioutil.WriteFile(filepath.Join(formatTestDir, "broken_test.ecal"), []byte(`
+a := 1 +
+`), 0660)
+
+	if _, err := RunTests(formatTestDir, "_test.ecal", "("); err == nil ||
+		!strings.HasPrefix(err.Error(), "Invalid test name expression") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	results, err := RunTests(formatTestDir, "_test.ecal", "")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var res []string
+	for _, r := range results {
+		res = append(res, fmt.Sprint(r.File, " ", r.Name, " ", r.Err, " ", r.Log))
+	}
+
+	if res := strings.Join(res, "\n"); res != `broken_test.ecal  Parse error in broken_test.ecal: Unexpected end []
+util_test.ecal testAdd <nil> []
+util_test.ecal testFail ECAL error in util_test.ecal (util_test.ecal): Assertion failed (util.add(1, 2) == 4) (Line:20 Pos:5) [about to fail]
+util_test.ecal testSink <nil> []` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	out.Reset()
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // Reset CLI parsing
+	flag.CommandLine.SetOutput(&out)
+
+	osArgs = []string{"foo", "bar", "-dir", formatTestDir, "-run", "Add|Sink"}
+
+	if err := Test(); err == nil || err.Error() != "1 of 3 tests failed" {
+		t.Error("Unexpected result:", err, out.String())
+		return
+	}
+
+	if res := regexp.MustCompile(`\(.*?\)`).ReplaceAllString(out.String(), "(x)"); res != `FAIL broken_test.ecal  (x)
+    Parse error in broken_test.ecal: Unexpected end
+ok   util_test.ecal testAdd (x)
+ok   util_test.ecal testSink (x)
+3 tests, 1 failed
+` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -0,0 +1,226 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+watchInterval is the interval in which watched files are checked for changes.
+*/
+var watchInterval = time.Second
+
+/*
+importRecorder is an import locator which records all import paths which
+were resolved.
+*/
+type importRecorder struct {
+	util.ECALImportLocator
+	paths     map[string]bool // Import paths which were resolved
+	pathsLock *sync.Mutex     // Lock for resolved import paths
+}
+
+/*
+newImportRecorder wraps a given import locator into an import recorder.
+*/
+func newImportRecorder(locator util.ECALImportLocator) *importRecorder {
+	return &importRecorder{locator, make(map[string]bool), &sync.Mutex{}}
+}
+
+/*
+Resolve a given import path and record it.
+*/
+func (ir *importRecorder) Resolve(path string) (string, error) {
+	ir.pathsLock.Lock()
+	ir.paths[path] = true
+	ir.pathsLock.Unlock()
+
+	return ir.ECALImportLocator.Resolve(path)
+}
+
+/*
+ResolveImportPath resolves a given import path with the wrapped import locator.
+*/
+func (ir *importRecorder) ResolveImportPath(source string, path string) (string, error) {
+	if resolver, ok := ir.ECALImportLocator.(util.ECALImportPathResolver); ok {
+		return resolver.ResolveImportPath(source, path)
+	}
+
+	return util.ResolveImportPath(source, path)
+}
+
+/*
+Paths returns all recorded import paths.
+*/
+func (ir *importRecorder) Paths() []string {
+	ir.pathsLock.Lock()
+	defer ir.pathsLock.Unlock()
+
+	var res []string
+
+	for p := range ir.paths {
+		res = append(res, p)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+/*
+isWatching returns if the program should be reloaded when its files change.
+*/
+func (i *CLIInterpreter) isWatching() bool {
+	return i.Watch != nil && *i.Watch
+}
+
+/*
+watchedFiles returns the entry file and all files which were imported by the
+program (only files which are located by a file import locator).
+*/
+func (i *CLIInterpreter) watchedFiles() []string {
+	res := []string{i.EntryFile}
+
+	if ir, ok := i.RuntimeProvider.ImportLocator.(*importRecorder); ok {
+		if fl, ok := ir.ECALImportLocator.(*util.FileImportLocator); ok {
+			for _, p := range ir.Paths() {
+				res = append(res, filepath.Clean(filepath.Join(fl.Root, p)))
+			}
+		}
+	}
+
+	return res
+}
+
+/*
+fileState returns the modification time and size of all given files. Missing
+files have no state.
+*/
+func fileState(files []string) map[string]string {
+	res := make(map[string]string)
+
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			res[f] = fmt.Sprintf("%v %v", fi.ModTime().UnixNano(), fi.Size())
+		}
+	}
+
+	return res
+}
+
+/*
+WatchFiles monitors the entry file and all its imports and reloads the program
+when one of the files changes. Errors are printed to the log output and the
+program keeps running. Blocks until the given stop channel is closed (a nil
+channel blocks forever).
+*/
+func (i *CLIInterpreter) WatchFiles(stop <-chan struct{}) {
+	files := i.watchedFiles()
+	state := fileState(files)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		var changed []string
+
+		newState := fileState(files)
+
+		for _, f := range files {
+			if newState[f] != state[f] {
+				changed = append(changed, f)
+			}
+		}
+
+		if len(changed) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(i.LogOut, fmt.Sprintf("Reloading program (changed: %v)", changed))
+
+		// Keep the state which was seen before the reload - files which change
+		// during the reload cause another reload
+
+		state = newState
+
+		if err := i.reloadProgram(); err != nil {
+			fmt.Fprintln(i.LogOut, i.FormatError(err, ""))
+		} else {
+			fmt.Fprintln(i.LogOut, "Program reloaded")
+		}
+
+		// Imports might have changed
+
+		files = i.watchedFiles()
+
+		for f, s := range fileState(files) {
+			if _, ok := state[f]; !ok {
+				state[f] = s
+			}
+		}
+	}
+}
+
+/*
+reloadProgram checks the syntax of the entry file and all its imports and
+reloads the program. The running program is not changed if the check fails.
+*/
+func (i *CLIInterpreter) reloadProgram() error {
+	var err error
+
+	for n, f := range i.watchedFiles() {
+		var data []byte
+		var ast *parser.ASTNode
+
+		name := f
+
+		if ir, ok := i.RuntimeProvider.ImportLocator.(*importRecorder); ok && n > 0 {
+			name = ir.Paths()[n-1] // Imported code is parsed with the import path as name
+		}
+
+		if data, err = ioutil.ReadFile(f); err == nil {
+			if ast, err = parser.ParseWithRuntime(name, string(data), i.RuntimeProvider); err == nil {
+				err = ast.Runtime.Validate()
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if ir, ok := i.RuntimeProvider.ImportLocator.(*importRecorder); ok {
+
+		// Record the imports of the new program
+
+		ir.pathsLock.Lock()
+		ir.paths = make(map[string]bool)
+		ir.pathsLock.Unlock()
+	}
+
+	return i.LoadInitialFile(i.RuntimeProvider.NewThreadID())
+}
@@ -0,0 +1,124 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package tool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchFiles(t *testing.T) {
+	tin := newTestInterpreterWithConfig()
+	defer tearDown()
+
+	watch := true
+	tin.Watch = &watch
+
+	l1 := ""
+	tin.LogFile = &l1
+	l2 := ""
+	tin.LogLevel = &l2
+
+	if err := tin.CreateRuntimeProvider("foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	tin.EntryFile = filepath.Join(testDir, "main.ecal")
+	libFile := filepath.Join(testDir, "lib.ecal")
+
+	ioutil.WriteFile(libFile, []byte("b := 1"), 0777)
+	ioutil.WriteFile(tin.EntryFile, []byte(`import "lib.ecal" as lib
+a := lib.b`), 0777)
+
+	if err := tin.LoadInitialFile(tin.RuntimeProvider.NewThreadID()); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := fmt.Sprint(tin.watchedFiles()); res != fmt.Sprint([]string{tin.EntryFile, libFile}) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	oldInterval := watchInterval
+	watchInterval = 10 * time.Millisecond
+	defer func() {
+		watchInterval = oldInterval
+	}()
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		tin.WatchFiles(stop)
+		close(stopped)
+	}()
+
+	waitForValue := func(expected string) bool {
+		for j := 0; j < 200; j++ {
+			if res, _, _ := tin.GlobalVS.GetValue("a"); fmt.Sprint(res) == expected {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	// Give the watcher time to record the initial state of all files
+
+	time.Sleep(5 * watchInterval)
+
+	// Change an imported file
+
+	ioutil.WriteFile(libFile, []byte("b := 22"), 0777)
+
+	if !waitForValue("22") {
+		t.Error("Program was not reloaded:", testLogOut.String())
+		return
+	}
+
+	// Errors are reported and the running program is kept
+
+	ioutil.WriteFile(libFile, []byte("b := "), 0777)
+
+	for j := 0; j < 200 && !strings.Contains(testLogOut.String(), "Parse error"); j++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !strings.Contains(testLogOut.String(), "Parse error") {
+		t.Error("Unexpected result:", testLogOut.String())
+		return
+	}
+
+	if res, _, _ := tin.GlobalVS.GetValue("a"); fmt.Sprint(res) != "22" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Changing the entry file reloads the program
+
+	ioutil.WriteFile(libFile, []byte("b := 1"), 0777)
+	ioutil.WriteFile(tin.EntryFile, []byte(`import "lib.ecal" as lib
+a := lib.b + 332`), 0777)
+
+	if !waitForValue("333") {
+		t.Error("Program was not reloaded:", testLogOut.String())
+		return
+	}
+
+	close(stop)
+	<-stopped
+}
@@ -11,8 +11,16 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/krotik/common/errorutil"
 )
@@ -29,9 +37,27 @@ const ProductVersion = "1.6.1"
 Known configuration options for ECAL
 */
 const (
-	WorkerCount = "WorkerCount"
+	WorkerCount       = "WorkerCount"
+	ShutdownTimeout   = "ShutdownTimeout"
+	TypeCheckWarnOnly = "TypeCheckWarnOnly"
+	Optimize          = "Optimize"
+	MaxCallDepth      = "MaxCallDepth"
+	TraceDepth        = "TraceDepth"
+	MaxCascadeDepth   = "MaxCascadeDepth"
+	MaxKindRepeat     = "MaxKindRepeat"
+	SinkTimeout       = "SinkTimeout"
+	QueueWarnSize     = "QueueWarnSize"
+	LogLevel          = "LogLevel"
+	ExecAllowList     = "ExecAllowList"
+	NetAllowList      = "NetAllowList"
 )
 
+/*
+EnvPrefix is the prefix of environment variables which contain configuration
+options (e.g. ECAL_WORKER_COUNT for WorkerCount).
+*/
+const EnvPrefix = "ECAL_"
+
 /*
 DefaultConfig is the defaut configuration
 */
@@ -43,6 +69,84 @@ var DefaultConfig = map[string]interface{}{
 		in a single event chain.
 	*/
 	WorkerCount: 4,
+
+	/*
+		Number of seconds which running event cascades and triggers get to finish
+		when the interpreter is shut down via SIGINT or SIGTERM.
+	*/
+	ShutdownTimeout: 10,
+
+	/*
+		Flag if violations of type annotations should only be logged as errors
+		instead of stopping the execution with a runtime error.
+	*/
+	TypeCheckWarnOnly: false,
+
+	/*
+		Flag if code should be optimized when it is validated (e.g. constant
+		expressions are evaluated only once). The optimizer is not used if a
+		debugger or profiler is attached.
+	*/
+	Optimize: true,
+
+	/*
+		Maximum number of nested function calls in a thread. Deeper calls (e.g.
+		by runaway recursion) fail with a runtime error. A value of 0 disables
+		the limit.
+	*/
+	MaxCallDepth: 10000,
+
+	/*
+		Maximum number of frames which are shown in the stack trace of an error.
+		The frames in the middle of longer stack traces are omitted. A value of
+		0 shows all frames.
+	*/
+	TraceDepth: 100,
+
+	/*
+		Maximum depth of event cascades. An event cascade which would grow
+		deeper (e.g. by runaway recursive events) is aborted. A value of 0
+		disables the limit (default).
+	*/
+	MaxCascadeDepth: 0,
+
+	/*
+		Maximum number of times an event kind can re-trigger itself in a row
+		within an event cascade before the cascade is aborted. A value of 0
+		disables the loop detection (default).
+	*/
+	MaxKindRepeat: 0,
+
+	/*
+		Number of seconds a sink may run before it is aborted with a timeout
+		error. Sinks can define their own timeout. A value of 0 disables the
+		timeout.
+	*/
+	SinkTimeout: 0,
+
+	/*
+		Number of queued tasks in ECAL's ECA engine after which a warning is
+		printed that the task queue is filling up.
+	*/
+	QueueWarnSize: 10,
+
+	/*
+		Logging level of the interpreter (debug, info or error).
+	*/
+	LogLevel: "info",
+
+	/*
+		Commands which can be executed by ECAL code (comma separated list,
+		* allows all). This option is only read when the interpreter starts.
+	*/
+	ExecAllowList: "",
+
+	/*
+		Network addresses which can be accessed by ECAL code (comma separated
+		list of host:port or host:*, * allows all). This option is only read
+		when the interpreter starts.
+	*/
+	NetAllowList: "",
 }
 
 /*
@@ -50,6 +154,26 @@ Config is the actual config which is used
 */
 var Config map[string]interface{}
 
+/*
+configLock is the lock for the actual config and its listeners
+*/
+var configLock = &sync.RWMutex{}
+
+/*
+ChangeListener is called when the value of a config option has changed.
+*/
+type ChangeListener func(key string, oldValue interface{}, newValue interface{})
+
+/*
+listeners are all registered change listeners
+*/
+var listeners = make(map[int]ChangeListener)
+
+/*
+listenerIDCount is the ID counter for change listeners
+*/
+var listenerIDCount = 0
+
 /*
 Initialise the config
 */
@@ -65,18 +189,28 @@ func init() {
 // Helper functions
 // ================
 
+/*
+Get reads a config value.
+*/
+func Get(key string) interface{} {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	return Config[key]
+}
+
 /*
 Str reads a config value as a string value.
 */
 func Str(key string) string {
-	return fmt.Sprint(Config[key])
+	return fmt.Sprint(Get(key))
 }
 
 /*
 Int reads a config value as an int value.
 */
 func Int(key string) int {
-	ret, err := strconv.ParseInt(fmt.Sprint(Config[key]), 10, 64)
+	ret, err := strconv.ParseInt(fmt.Sprint(Get(key)), 10, 64)
 
 	errorutil.AssertTrue(err == nil,
 		fmt.Sprintf("Could not parse config key %v: %v", key, err))
@@ -88,10 +222,276 @@ func Int(key string) int {
 Bool reads a config value as a boolean value.
 */
 func Bool(key string) bool {
-	ret, err := strconv.ParseBool(fmt.Sprint(Config[key]))
+	ret, err := strconv.ParseBool(fmt.Sprint(Get(key)))
 
 	errorutil.AssertTrue(err == nil,
 		fmt.Sprintf("Could not parse config key %v: %v", key, err))
 
 	return ret
 }
+
+/*
+List returns a copy of the actual config.
+*/
+func List() map[string]interface{} {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	ret := make(map[string]interface{})
+	for k, v := range Config {
+		ret[k] = v
+	}
+
+	return ret
+}
+
+// Changing the configuration
+// ==========================
+
+/*
+AddChangeListener registers a listener which is called after a config value
+was changed. Returns a function which removes the listener again.
+*/
+func AddChangeListener(listener ChangeListener) func() {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	listenerIDCount++
+	id := listenerIDCount
+
+	listeners[id] = listener
+
+	return func() {
+		configLock.Lock()
+		defer configLock.Unlock()
+
+		delete(listeners, id)
+	}
+}
+
+/*
+Set changes a config value. The value is converted to the type of the
+default value of the option. Registered change listeners are notified if
+the value has changed.
+*/
+func Set(key string, value interface{}) error {
+	return Load(map[string]interface{}{key: value})
+}
+
+/*
+Load changes several config values. All values are checked before any value
+is changed. Registered change listeners are notified about every value which
+has changed (in alphabetical order of the keys).
+*/
+func Load(data map[string]interface{}) error {
+	var keys []string
+
+	values := make(map[string]interface{})
+
+	for k, v := range data {
+		cv, err := convertValue(k, v)
+		if err != nil {
+			return err
+		}
+
+		keys = append(keys, k)
+		values[k] = cv
+	}
+
+	sort.Strings(keys)
+
+	type change struct {
+		key      string
+		oldValue interface{}
+		newValue interface{}
+	}
+
+	var changes []change
+	var notify []ChangeListener
+
+	configLock.Lock()
+
+	for _, k := range keys {
+		if old := Config[k]; old != values[k] {
+			Config[k] = values[k]
+			changes = append(changes, change{k, old, values[k]})
+		}
+	}
+
+	var ids []int
+	for id := range listeners {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		notify = append(notify, listeners[id])
+	}
+
+	configLock.Unlock()
+
+	// Listeners are called outside of the lock so they can read the config
+
+	for _, c := range changes {
+		for _, l := range notify {
+			l(c.key, c.oldValue, c.newValue)
+		}
+	}
+
+	return nil
+}
+
+/*
+LoadFile changes config values according to a given JSON file. The file
+should contain a single JSON object which maps config options to values.
+*/
+func LoadFile(path string) error {
+	var data map[string]interface{}
+
+	content, err := ioutil.ReadFile(path)
+
+	if err == nil {
+		if err = json.Unmarshal(content, &data); err != nil {
+			err = fmt.Errorf("Could not parse config file %v: %v", path, err)
+		}
+	}
+
+	if err == nil {
+		err = Load(data)
+	}
+
+	return err
+}
+
+/*
+LoadEnv changes config values according to environment variables. The name
+of the environment variable for a config option is the option name in upper
+snake case with the EnvPrefix (e.g. ECAL_WORKER_COUNT for WorkerCount).
+*/
+func LoadEnv() error {
+	data := make(map[string]interface{})
+
+	for k := range DefaultConfig {
+		if v, ok := os.LookupEnv(EnvName(k)); ok {
+			data[k] = v
+		}
+	}
+
+	return Load(data)
+}
+
+/*
+EnvName returns the name of the environment variable for a given config option.
+*/
+func EnvName(key string) string {
+	var buf strings.Builder
+
+	runes := []rune(key)
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			buf.WriteRune('_')
+		}
+		buf.WriteRune(unicode.ToUpper(r))
+	}
+
+	return EnvPrefix + buf.String()
+}
+
+/*
+WatchFile reloads a given JSON config file when it changes. The file is
+checked in the given interval. Errors are passed to the given error handler
+and the previous config is kept. Blocks until the given stop channel is
+closed (a nil channel blocks forever).
+*/
+func WatchFile(path string, interval time.Duration, stop <-chan struct{}, errorHandler func(error)) {
+	fileState := func() string {
+		if fi, err := os.Stat(path); err == nil {
+			return fmt.Sprintf("%v %v", fi.ModTime().UnixNano(), fi.Size())
+		}
+		return ""
+	}
+
+	state := fileState()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if newState := fileState(); newState != state {
+			state = newState
+
+			if err := LoadFile(path); err != nil && errorHandler != nil {
+				errorHandler(err)
+			}
+		}
+	}
+}
+
+/*
+convertValue converts a given value to the type of the default value of
+a config option.
+*/
+func convertValue(key string, value interface{}) (interface{}, error) {
+	var err error
+
+	def, ok := DefaultConfig[key]
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown config option: %v", key)
+	}
+
+	switch def.(type) {
+	case int:
+		var f float64
+
+		if f, err = strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(value)), 64); err == nil && f == float64(int(f)) {
+			return int(f), nil
+		}
+
+		err = fmt.Errorf("Config option %v needs a whole number: %v", key, value)
+
+	case bool:
+		var b bool
+
+		if b, err = strconv.ParseBool(strings.TrimSpace(fmt.Sprint(value))); err == nil {
+			return b, nil
+		}
+
+		err = fmt.Errorf("Config option %v needs a boolean: %v", key, value)
+
+	default:
+		if key == LogLevel {
+			level := strings.ToLower(strings.TrimSpace(fmt.Sprint(value)))
+
+			if level == "debug" || level == "info" || level == "error" {
+				return level, nil
+			}
+
+			return nil, fmt.Errorf("Config option %v needs a log level (debug, info or error): %v", key, value)
+		}
+
+		if l, ok := value.([]interface{}); ok {
+
+			// Lists are stored as comma separated strings
+
+			var items []string
+			for _, i := range l {
+				items = append(items, fmt.Sprint(i))
+			}
+
+			return strings.Join(items, ","), nil
+		}
+
+		return fmt.Sprint(value), nil
+	}
+
+	return nil, err
+}
@@ -11,12 +11,21 @@
 package config
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestConfig(t *testing.T) {
 
 	Config[WorkerCount] = 1
+	defer func() {
+		Config[WorkerCount] = DefaultConfig[WorkerCount]
+	}()
 
 	if res := Str(WorkerCount); res != "1" {
 		t.Error("Unexpected result:", res)
@@ -33,3 +42,194 @@ func TestConfig(t *testing.T) {
 		return
 	}
 }
+
+func TestConfigChanges(t *testing.T) {
+	defer func() {
+		for k, v := range DefaultConfig {
+			Config[k] = v
+		}
+	}()
+
+	var changes []string
+
+	removeListener := AddChangeListener(func(key string, oldValue interface{}, newValue interface{}) {
+		changes = append(changes, fmt.Sprintf("%v: %v -> %v", key, oldValue, newValue))
+	})
+
+	if err := Set("foo", 1); err == nil || err.Error() != "Unknown config option: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := Set(WorkerCount, "1.5"); err == nil || err.Error() != "Config option WorkerCount needs a whole number: 1.5" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := Set(Optimize, "x"); err == nil || err.Error() != "Config option Optimize needs a boolean: x" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := Set(LogLevel, "trace"); err == nil ||
+		err.Error() != "Config option LogLevel needs a log level (debug, info or error): trace" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Invalid values do not change any option
+
+	if err := Load(map[string]interface{}{
+		MaxCallDepth: 5,
+		Optimize:     "x",
+	}); err == nil || Int(MaxCallDepth) != 10000 || len(changes) != 0 {
+		t.Error("Unexpected result:", err, Int(MaxCallDepth), changes)
+		return
+	}
+
+	if err := Load(map[string]interface{}{
+		WorkerCount:   float64(8),
+		Optimize:      "false",
+		LogLevel:      "Debug",
+		ExecAllowList: []interface{}{"ls", "cat"},
+		TraceDepth:    100,
+	}); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := fmt.Sprint(changes); res != "[ExecAllowList:  -> ls,cat LogLevel: info -> debug "+
+		"Optimize: true -> false WorkerCount: 4 -> 8]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := List(); res[WorkerCount] != 8 || res[Optimize] != false || Str(ExecAllowList) != "ls,cat" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	removeListener()
+
+	Set(WorkerCount, 2)
+
+	if len(changes) != 4 || Int(WorkerCount) != 2 {
+		t.Error("Unexpected result:", changes)
+		return
+	}
+}
+
+func TestConfigSources(t *testing.T) {
+	defer func() {
+		for k, v := range DefaultConfig {
+			Config[k] = v
+		}
+	}()
+
+	if res := EnvName(WorkerCount); res != "ECAL_WORKER_COUNT" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := EnvName(TypeCheckWarnOnly); res != "ECAL_TYPE_CHECK_WARN_ONLY" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	os.Setenv("ECAL_MAX_CALL_DEPTH", "50")
+	defer os.Unsetenv("ECAL_MAX_CALL_DEPTH")
+
+	if err := LoadEnv(); err != nil || Int(MaxCallDepth) != 50 {
+		t.Error("Unexpected result:", err, Int(MaxCallDepth))
+		return
+	}
+
+	os.Setenv("ECAL_MAX_CALL_DEPTH", "many")
+
+	if err := LoadEnv(); err == nil || err.Error() != "Config option MaxCallDepth needs a whole number: many" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "configtest")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "ecal.json")
+
+	if err := LoadFile(configFile); err == nil {
+		t.Error("Loading a missing file should fail")
+		return
+	}
+
+	ioutil.WriteFile(configFile, []byte(`{"WorkerCount": 2`), 0660)
+
+	if err := LoadFile(configFile); err == nil || !strings.HasPrefix(err.Error(), "Could not parse config file") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	ioutil.WriteFile(configFile, []byte(`{"WorkerCount": 2, "NetAllowList": ["localhost:*"]}`), 0660)
+
+	if err := LoadFile(configFile); err != nil || Int(WorkerCount) != 2 || Str(NetAllowList) != "localhost:*" {
+		t.Error("Unexpected result:", err, Int(WorkerCount), Str(NetAllowList))
+		return
+	}
+
+	// Watch the file for changes
+
+	changed := make(chan string, 10)
+	errors := make(chan error, 10)
+
+	defer AddChangeListener(func(key string, oldValue interface{}, newValue interface{}) {
+		changed <- fmt.Sprintf("%v: %v -> %v", key, oldValue, newValue)
+	})()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go WatchFile(configFile, time.Millisecond, stop, func(err error) {
+		errors <- err
+	})
+
+	time.Sleep(10 * time.Millisecond)
+
+	writeFileAtomic(configFile, []byte(`{"WorkerCount": 3, "NetAllowList": ["localhost:*"]}`))
+
+	select {
+	case res := <-changed:
+		if res != "WorkerCount: 2 -> 3" {
+			t.Error("Unexpected result:", res)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Config file was not reloaded")
+		return
+	}
+
+	writeFileAtomic(configFile, []byte(`{"WorkerCount": "x"}`))
+
+	select {
+	case err := <-errors:
+		if err.Error() != "Config option WorkerCount needs a whole number: x" || Int(WorkerCount) != 3 {
+			t.Error("Unexpected result:", err, Int(WorkerCount))
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Config file was not reloaded")
+		return
+	}
+}
+
+/*
+writeFileAtomic replaces a file in one step so a watcher never sees it half
+written.
+*/
+func writeFileAtomic(path string, data []byte) {
+	tmpFile := path + ".tmp"
+	ioutil.WriteFile(tmpFile, data, 0660)
+	os.Rename(tmpFile, path)
+}
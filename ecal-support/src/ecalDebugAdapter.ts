@@ -34,6 +34,7 @@ import * as path from "path";
 interface ECALDebugArguments extends DebugProtocol.LaunchRequestArguments {
   host: string; // Host of the ECAL debug server
   port: number; // Port of the ECAL debug server
+  token?: string; // Token to authenticate with the ECAL debug server
   dir: string; // Root directory for ECAL interpreter
   executeOnEntry?: boolean; // Flag if the debugged script should be executed when the debug session is started
   trace?: boolean; // Flag to enable verbose logging of the adapter protocol
@@ -183,7 +184,7 @@ export class ECALDebugSession extends LoggingDebugSession {
 
     this.extout.appendLine(`Configuration loaded: ${JSON.stringify(args)}`);
 
-    await this.client.connect(args.host, args.port);
+    await this.client.connect(args.host, args.port, args.token);
 
     if (args.executeOnEntry) {
       this.client.reload();
@@ -39,10 +39,13 @@ export class ECALDebugClient extends EventEmitter {
     this.socketLock = new AsyncLock();
   }
 
-  public async connect(host: string, port: number) {
+  public async connect(host: string, port: number, token?: string) {
     try {
       this.out.log(`Connecting to: ${host}:${port}`);
       await this.socket.connect({ port, host });
+      if (token) {
+        await this.sendCommandString(`auth ${token}\r\n`);
+      }
       this.connected = true;
       this.pollEvents(); // Start emitting events
     } catch (e) {
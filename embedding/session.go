@@ -0,0 +1,172 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+/*
+Package embedding contains a high-level API to embed ECAL into Go applications.
+*/
+package embedding
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/krotik/ecal/interpreter"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+Session is an interpreter session with a persistent global variable scope.
+Code which is evaluated in a session can access all variables and functions
+which were declared by previously evaluated code.
+*/
+type Session struct {
+	RuntimeProvider *interpreter.ECALRuntimeProvider // Runtime provider of the session
+	GlobalVS        parser.Scope                     // Global variable scope of the session
+
+	evalCount int         // Counter for evaluated code snippets
+	lock      *sync.Mutex // Lock for the eval counter
+}
+
+/*
+NewSession creates a new interpreter session. The event processor of the
+session is started so sinks react to events straight away (the processor is
+briefly stopped while code which declares sinks is evaluated). If no import
+locator is given then imports are resolved from memory. If no logger is given
+then log messages are kept in a memory logger.
+*/
+func NewSession(name string, importLocator util.ECALImportLocator, logger util.Logger) *Session {
+
+	if importLocator == nil {
+		importLocator = &util.MemoryImportLocator{Files: make(map[string]string)}
+	}
+
+	rtp := interpreter.NewECALRuntimeProvider(name, importLocator, logger)
+	rtp.Processor.Start()
+
+	return &Session{rtp, scope.NewScope(scope.GlobalScope), 0, &sync.Mutex{}}
+}
+
+/*
+Eval parses, validates and evaluates a piece of ECAL code in the global scope
+of this session. Returns the value of the last statement.
+*/
+func (s *Session) Eval(code string) (interface{}, error) {
+	s.lock.Lock()
+	s.evalCount++
+	source := fmt.Sprintf("eval %v", s.evalCount)
+	s.lock.Unlock()
+
+	return s.EvalSource(source, code)
+}
+
+/*
+EvalSource parses, validates and evaluates a piece of ECAL code with a given
+source name (e.g. a file name) in the global scope of this session.
+*/
+func (s *Session) EvalSource(source string, code string) (interface{}, error) {
+	var res interface{}
+
+	ast, err := parser.ParseWithRuntime(source, code, s.RuntimeProvider)
+
+	if err == nil {
+		if err = ast.Runtime.Validate(); err == nil {
+			tid := s.RuntimeProvider.NewThreadID()
+
+			// Sinks can only be added while the processor is stopped
+
+			if proc := s.RuntimeProvider.Processor; containsSink(ast) && !proc.Stopped() {
+				proc.Finish()
+				defer proc.Start()
+			}
+
+			res, err = ast.Runtime.Eval(s.GlobalVS, make(map[string]interface{}), tid)
+
+			if s.RuntimeProvider.Debugger != nil {
+				s.RuntimeProvider.Debugger.RecordThreadFinished(tid)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+containsSink checks if a given AST contains a sink declaration.
+*/
+func containsSink(node *parser.ASTNode) bool {
+	if node.Name == parser.NodeSINK {
+		return true
+	}
+
+	for _, c := range node.Children {
+		if containsSink(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Call calls a function which is stored in the global scope of this session.
+The function name may be a dotted path into a map (e.g. an object method).
+Go arguments are converted into ECAL values.
+*/
+func (s *Session) Call(funcName string, args ...interface{}) (interface{}, error) {
+	return s.RuntimeProvider.CallFunction(s.GlobalVS, funcName, args...)
+}
+
+/*
+CallInto calls a function like Call and converts the result into a given Go
+value. The target must be a pointer.
+*/
+func (s *Session) CallInto(target interface{}, funcName string, args ...interface{}) error {
+	res, err := s.Call(funcName, args...)
+
+	if err == nil {
+		err = scope.ConvertECALToGoObject(res, target)
+	}
+
+	return err
+}
+
+/*
+SetVar sets a variable in the global scope of this session. Go values are
+converted into ECAL values.
+*/
+func (s *Session) SetVar(name string, value interface{}) error {
+	return s.GlobalVS.SetValue(name, scope.ConvertGoToECALObject(value))
+}
+
+/*
+GetVar returns the value of a variable in the global scope of this session.
+The name may be a dotted path into a map.
+*/
+func (s *Session) GetVar(name string) (interface{}, bool) {
+	val, ok, err := s.GlobalVS.GetValue(name)
+	return val, ok && err == nil
+}
+
+/*
+Sinks returns information about all sinks which are registered in this session.
+*/
+func (s *Session) Sinks() []*interpreter.SinkInfo {
+	return s.RuntimeProvider.Sinks()
+}
+
+/*
+Close stops the event processing of this session.
+*/
+func (s *Session) Close() {
+	s.RuntimeProvider.Processor.Finish()
+	s.RuntimeProvider.Cron.Stop()
+}
@@ -0,0 +1,169 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package embedding
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/krotik/ecal/engine"
+	"github.com/krotik/ecal/util"
+)
+
+func TestSession(t *testing.T) {
+	logger := util.NewMemoryLogger(10)
+
+	s := NewSession("test", nil, logger)
+	defer s.Close()
+
+	if err := s.SetVar("offset", 10.); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	res, err := s.Eval(`
+func add(a, b) {
+  return a + b + offset
+}
+result := add(1, 2)
+`)
+
+	if err != nil || res != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, ok := s.GetVar("result"); !ok || res != 13. {
+		t.Error("Unexpected result:", res, ok)
+		return
+	}
+
+	// Later code can use previous declarations
+
+	if res, err := s.Eval(`add(result, 1)`); err != nil || res != 24. {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := s.Call("add", 5., 6.); err != nil || res != 21. {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Go values are converted
+
+	type point struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+
+	if err := s.SetVar("origin", point{1, 2}); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := s.Eval(`func move(p, d) { return {"x" : p.x + d + origin.x, "y" : p.y + d + origin.y} }`); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	var moved point
+
+	if err := s.CallInto(&moved, "move", &point{3, 4}, 1); err != nil || moved.X != 5 || moved.Y != 7 {
+		t.Error("Unexpected result:", moved, err)
+		return
+	}
+
+	if err := s.CallInto(&moved, "foo"); err == nil || err.Error() != "Unknown function: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Call object methods
+
+	if _, err := s.Eval(`obj := new({ "name" : "foo", "greet" : func(g) { return "{{g}} {{this.name}}" } })`); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := s.Call("obj.greet", "hello"); err != nil || res != "hello foo" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, ok := s.GetVar("obj.name"); !ok || res != "foo" {
+		t.Error("Unexpected result:", res, ok)
+		return
+	}
+
+	if res, ok := s.GetVar("foo"); ok || res != nil {
+		t.Error("Unexpected result:", res, ok)
+		return
+	}
+
+	// Sinks react to events
+
+	if _, err := s.Eval(`
+sink mysink
+    kindmatch [ "foo" ],
+    {
+        log("Handling: ", event.name)
+    }
+`); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := s.RuntimeProvider.Processor.AddEventAndWait(
+		engine.NewEvent("myevent", []string{"foo"}, nil), nil); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if logger.String() != "Handling: myevent" {
+		t.Error("Unexpected result:", logger.String())
+		return
+	}
+
+	if sinks := s.Sinks(); len(sinks) != 1 || sinks[0].Name != "mysink" ||
+		fmt.Sprint(sinks[0].KindMatch) != "[foo]" || !sinks[0].Enabled {
+		t.Error("Unexpected result:", sinks)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := s.Eval(`a := `); err == nil || err.Error() != "Parse error in eval 6: Unexpected end" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := s.EvalSource("mysource", `raise("MyError")`); err == nil ||
+		err.Error() != "ECAL error in test (mysource): MyError () (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := s.Call("foo"); err == nil || err.Error() != "Unknown function: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := s.Call("result"); err == nil || err.Error() != "Variable result is not a function" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := s.Call("add", "a"); err == nil || err.Error() != "ECAL error in test (eval 1): Operand is not a number (a=a) (Line:3 Pos:10)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
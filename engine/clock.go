@@ -0,0 +1,177 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+Clock provides the current time and timers to components which fire events
+over time (e.g. pulse triggers). A virtual clock can be used to run these
+components deterministically.
+*/
+type Clock interface {
+
+	/*
+		Now returns the current time.
+	*/
+	Now() time.Time
+
+	/*
+		After returns a channel which receives the current time once a given
+		duration has passed.
+	*/
+	After(d time.Duration) <-chan time.Time
+}
+
+// System clock
+// ============
+
+/*
+SystemClock is a clock which uses the system time.
+*/
+type SystemClock struct {
+}
+
+/*
+Now returns the current time.
+*/
+func (sc *SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+/*
+After returns a channel which receives the current time once a given
+duration has passed.
+*/
+func (sc *SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Virtual clock
+// =============
+
+/*
+VirtualClock is a clock which only moves if it is advanced. Timers of the
+clock fire once the clock has been advanced past their deadline. This allows
+tests to fast-forward time and to fire triggers on demand.
+*/
+type VirtualClock struct {
+	now    time.Time     // Current time of the clock
+	timers []*clockTimer // Pending timers
+	lock   *sync.Mutex   // Lock for time and timers
+	waiter *sync.Cond    // Condition which is signalled when a timer is added
+}
+
+/*
+clockTimer is a pending timer of a virtual clock.
+*/
+type clockTimer struct {
+	deadline time.Time      // Time when the timer fires
+	c        chan time.Time // Channel which receives the time when the timer fires
+}
+
+/*
+NewVirtualClock creates a new virtual clock which starts at a given time.
+*/
+func NewVirtualClock(start time.Time) *VirtualClock {
+	lock := &sync.Mutex{}
+	return &VirtualClock{start, nil, lock, sync.NewCond(lock)}
+}
+
+/*
+Now returns the current time.
+*/
+func (vc *VirtualClock) Now() time.Time {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	return vc.now
+}
+
+/*
+After returns a channel which receives the current time once the clock
+has been advanced by a given duration.
+*/
+func (vc *VirtualClock) After(d time.Duration) <-chan time.Time {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	c := make(chan time.Time, 1)
+
+	if d <= 0 {
+		c <- vc.now
+		return c
+	}
+
+	vc.timers = append(vc.timers, &clockTimer{vc.now.Add(d), c})
+	vc.waiter.Broadcast()
+
+	return c
+}
+
+/*
+Advance moves the clock forward by a given duration. All pending timers which
+are due fire in the order of their deadlines. Timers which are created while
+the clock is advanced are relative to the new time of the clock.
+*/
+func (vc *VirtualClock) Advance(d time.Duration) {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	target := vc.now.Add(d)
+
+	sort.SliceStable(vc.timers, func(i, j int) bool {
+		return vc.timers[i].deadline.Before(vc.timers[j].deadline)
+	})
+
+	var pending []*clockTimer
+
+	for _, t := range vc.timers {
+		if t.deadline.After(target) {
+			pending = append(pending, t)
+			continue
+		}
+
+		vc.now = t.deadline
+		t.c <- t.deadline
+	}
+
+	vc.now = target
+	vc.timers = pending
+}
+
+/*
+Timers returns the number of pending timers.
+*/
+func (vc *VirtualClock) Timers() int {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	return len(vc.timers)
+}
+
+/*
+WaitTimers waits until the clock has at least a given number of pending timers.
+This can be used to wait for components to start waiting on the clock before
+advancing it.
+*/
+func (vc *VirtualClock) WaitTimers(n int) {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	for len(vc.timers) < n {
+		vc.waiter.Wait()
+	}
+}
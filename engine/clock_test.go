@@ -0,0 +1,93 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSystemClock(t *testing.T) {
+	clock := &SystemClock{}
+
+	start := clock.Now()
+
+	if res := <-clock.After(10 * time.Millisecond); res.Sub(start) < 10*time.Millisecond {
+		t.Error("Unexpected result:", res, start)
+		return
+	}
+}
+
+func TestVirtualClock(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+
+	if res := clock.Now(); !res.Equal(start) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	c1 := clock.After(2 * time.Second)
+	c2 := clock.After(time.Second)
+	c3 := clock.After(time.Minute)
+
+	if res := <-clock.After(0); !res.Equal(start) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	clock.WaitTimers(3)
+
+	if res := clock.Timers(); res != 3 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Nothing fires before the clock is advanced
+
+	select {
+	case res := <-c2:
+		t.Error("Unexpected result:", res)
+		return
+	default:
+	}
+
+	clock.Advance(5 * time.Second)
+
+	if res := fmt.Sprint((<-c1).Sub(start), " ", (<-c2).Sub(start), " ", clock.Now().Sub(start)); res != "2s 1s 5s" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := clock.Timers(); res != 1 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Timers which are created after advancing are relative to the new time
+
+	c4 := clock.After(time.Second)
+
+	clock.Advance(time.Second)
+
+	if res := (<-c4).Sub(start); res != 6*time.Second {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	clock.Advance(time.Hour)
+
+	if res := (<-c3).Sub(start); res != time.Minute || clock.Timers() != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
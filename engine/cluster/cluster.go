@@ -0,0 +1,315 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+/*
+Package cluster distributes root events across the processors of several nodes.
+
+Every node of a cluster runs its own processor with the same rule definitions
+(e.g. by loading the same ECAL code). Root events which are added to the cluster
+are handed to the nodes in turn. The receiving node processes the whole event
+cascade and sends the errors of the cascade back to the node which added the
+event. Nodes communicate through a pluggable transport.
+*/
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/krotik/ecal/engine"
+	"github.com/krotik/ecal/scope"
+)
+
+/*
+Message types
+*/
+const (
+	MessageEvent = "event" // Request to process an event cascade
+	MessageRules = "rules" // Request for the names of all loaded rules
+)
+
+/*
+Message is a message which is exchanged between cluster nodes.
+*/
+type Message struct {
+	Type   string          `json:"type"`             // Message type
+	Event  *EventData      `json:"event,omitempty"`  // Event of an event request
+	Scope  map[string]bool `json:"scope,omitempty"`  // Scope of an event request
+	Errors []*EventError   `json:"errors,omitempty"` // Errors of a processed event cascade
+	Rules  []string        `json:"rules,omitempty"`  // Names of loaded rules
+	Error  string          `json:"error,omitempty"`  // Error which prevented the processing of a request
+}
+
+/*
+EventData is the transferable form of an event.
+*/
+type EventData struct {
+	Name  string                 `json:"name"`  // Name of the event
+	Kind  []string               `json:"kind"`  // Kind of the event
+	State map[string]interface{} `json:"state"` // State of the event
+}
+
+/*
+NewEventData creates the transferable form of an event.
+*/
+func NewEventData(event *engine.Event) *EventData {
+	state, _ := scope.ConvertECALToJSONObject(event.State()).(map[string]interface{})
+	return &EventData{event.Name(), event.Kind(), state}
+}
+
+/*
+Event creates an event from this event data.
+*/
+func (ed *EventData) Event() *engine.Event {
+	state, _ := scope.ConvertJSONToECALObject(ed.State).(map[interface{}]interface{})
+
+	if state == nil {
+		state = map[interface{}]interface{}{}
+	}
+
+	return engine.NewEvent(ed.Name, ed.Kind, state)
+}
+
+/*
+EventError contains the rule errors of an event in a processed event cascade.
+*/
+type EventError struct {
+	Event  *EventData        `json:"event"`  // Event which caused the errors
+	Path   string            `json:"path"`   // Path of the event in the event cascade
+	Errors map[string]string `json:"errors"` // Rule errors (rule name -> error)
+}
+
+/*
+Error returns a string representation of this error.
+*/
+func (ee *EventError) Error() string {
+	var names []string
+	for name := range ee.Errors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%v -> %v : %v", ee.Path, name, ee.Errors[name]))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+/*
+Transport is a communication channel between cluster nodes.
+*/
+type Transport interface {
+
+	/*
+		Nodes returns the names of all other nodes which can be reached.
+	*/
+	Nodes() []string
+
+	/*
+		Send sends a message to a node and returns the response.
+	*/
+	Send(node string, msg *Message) (*Message, error)
+
+	/*
+		Listen starts receiving messages from other nodes. Every received
+		message is passed to the given handler which returns the response.
+	*/
+	Listen(handler func(msg *Message) *Message) error
+
+	/*
+		Close stops receiving messages.
+	*/
+	Close() error
+}
+
+/*
+Cluster distributes root events across the nodes of a cluster.
+*/
+type Cluster struct {
+	Name      string           // Name of the local node
+	Processor engine.Processor // Processor of the local node
+	Transport Transport        // Transport to other nodes
+
+	next int         // Position of the next node which receives an event
+	lock *sync.Mutex // Lock for node selection
+}
+
+/*
+NewCluster creates a new cluster node.
+*/
+func NewCluster(name string, proc engine.Processor, transport Transport) *Cluster {
+	return &Cluster{name, proc, transport, 0, &sync.Mutex{}}
+}
+
+/*
+Start starts receiving requests from other nodes.
+*/
+func (c *Cluster) Start() error {
+	return c.Transport.Listen(c.handleMessage)
+}
+
+/*
+Stop stops receiving requests from other nodes.
+*/
+func (c *Cluster) Stop() error {
+	return c.Transport.Close()
+}
+
+/*
+Nodes returns the names of all nodes of the cluster (including the local node).
+*/
+func (c *Cluster) Nodes() []string {
+	nodes := append([]string{c.Name}, c.Transport.Nodes()...)
+	sort.Strings(nodes)
+	return nodes
+}
+
+/*
+AddEventAndWait adds a root event to the cluster and waits for the resulting
+event cascade to finish. The event cascade runs with a given scope (nil for
+the default scope) on the next node in turn. If a node cannot be reached the
+event is handed to the following node. Returns the node which processed the
+event and the errors of the event cascade.
+*/
+func (c *Cluster) AddEventAndWait(event *engine.Event, scope map[string]bool) (string, []*EventError, error) {
+	nodes := c.Nodes()
+
+	c.lock.Lock()
+	start := c.next % len(nodes)
+	c.next = start + 1
+	c.lock.Unlock()
+
+	var lastErr error
+
+	for i := range nodes {
+		node := nodes[(start+i)%len(nodes)]
+
+		if node == c.Name {
+			errs, err := c.processEvent(event, scope)
+			return node, errs, err
+		}
+
+		res, err := c.Transport.Send(node, &Message{Type: MessageEvent, Event: NewEventData(event), Scope: scope})
+
+		if err == nil {
+			if res.Error != "" {
+				return node, nil, fmt.Errorf("Node %v could not process event: %v", node, res.Error)
+			}
+
+			return node, res.Errors, nil
+		}
+
+		lastErr = err
+	}
+
+	return "", nil, lastErr
+}
+
+/*
+CheckRules checks that all nodes of the cluster have loaded the same rules.
+*/
+func (c *Cluster) CheckRules() error {
+	local := c.ruleNames()
+
+	for _, node := range c.Transport.Nodes() {
+		res, err := c.Transport.Send(node, &Message{Type: MessageRules})
+
+		if err != nil {
+			return fmt.Errorf("Could not get rules of node %v: %v", node, err)
+		}
+
+		if remote := strings.Join(res.Rules, ", "); remote != strings.Join(local, ", ") {
+			return fmt.Errorf("Node %v has different rules: [%v] (local node %v has [%v])",
+				node, remote, c.Name, strings.Join(local, ", "))
+		}
+	}
+
+	return nil
+}
+
+/*
+handleMessage handles a request from another node.
+*/
+func (c *Cluster) handleMessage(msg *Message) *Message {
+	res := &Message{Type: msg.Type}
+
+	switch msg.Type {
+
+	case MessageEvent:
+		if msg.Event == nil {
+			res.Error = "No event given"
+		} else if errs, err := c.processEvent(msg.Event.Event(), msg.Scope); err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Errors = errs
+		}
+
+	case MessageRules:
+		res.Rules = c.ruleNames()
+
+	default:
+		res.Error = fmt.Sprintf("Unknown message type: %v", msg.Type)
+	}
+
+	return res
+}
+
+/*
+processEvent processes an event cascade on the local processor.
+*/
+func (c *Cluster) processEvent(event *engine.Event, scope map[string]bool) ([]*EventError, error) {
+	var ruleScope *engine.RuleScope
+
+	if scope != nil {
+		ruleScope = engine.NewRuleScope(scope)
+	}
+
+	rm := c.Processor.NewRootMonitor(nil, ruleScope)
+
+	m, err := c.Processor.AddEventAndWait(event, rm)
+
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	var errs []*EventError
+
+	for _, te := range m.(*engine.RootMonitor).AllErrors() {
+		ee := &EventError{NewEventData(te.Event), te.Monitor.EventPathString(), make(map[string]string)}
+
+		for name, err := range te.ErrorMap {
+			ee.Errors[name] = err.Error()
+		}
+
+		errs = append(errs, ee)
+	}
+
+	return errs, nil
+}
+
+/*
+ruleNames returns the sorted names of all rules of the local processor.
+*/
+func (c *Cluster) ruleNames() []string {
+	var names []string
+
+	for name := range c.Processor.Rules() {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,209 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/krotik/ecal/engine"
+)
+
+/*
+testNode creates a processor with test rules which records all handled events.
+*/
+func testNode(name string, handled map[string]string, lock *sync.Mutex, extraRule bool) engine.Processor {
+	proc := engine.NewProcessor(1)
+
+	proc.AddRule(&engine.Rule{
+		Name:       "handler",
+		KindMatch:  []string{"job.*"},
+		ScopeMatch: []string{},
+		Action: func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error {
+			lock.Lock()
+			handled[e.Name()] = fmt.Sprint(name, " ", e.State())
+			lock.Unlock()
+
+			if e.Name() == "fail" {
+				return fmt.Errorf("Job failed")
+			}
+
+			return nil
+		},
+	})
+
+	proc.AddRule(&engine.Rule{
+		Name:       "restricted",
+		KindMatch:  []string{"job.restricted"},
+		ScopeMatch: []string{"admin"},
+		Action: func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error {
+			return fmt.Errorf("Restricted job")
+		},
+	})
+
+	if extraRule {
+		proc.AddRule(&engine.Rule{
+			Name:       "extra",
+			KindMatch:  []string{"other"},
+			ScopeMatch: []string{},
+			Action: func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error {
+				return nil
+			},
+		})
+	}
+
+	proc.Start()
+
+	return proc
+}
+
+func TestCluster(t *testing.T) {
+	handled := make(map[string]string)
+	lock := &sync.Mutex{}
+	network := NewMemoryNetwork()
+
+	var clusters []*Cluster
+
+	for _, name := range []string{"node1", "node2", "node3"} {
+		c := NewCluster(name, testNode(name, handled, lock, false), NewMemoryTransport(network, name))
+
+		if err := c.Start(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		defer c.Processor.Finish()
+
+		clusters = append(clusters, c)
+	}
+
+	c := clusters[0]
+
+	if res := fmt.Sprint(c.Nodes()); res != "[node1 node2 node3]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := c.CheckRules(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Events are distributed across all nodes
+
+	var nodes []string
+
+	for i := 0; i < 3; i++ {
+		node, errs, err := c.AddEventAndWait(engine.NewEvent(fmt.Sprint("job", i), []string{"job", "run"},
+			map[interface{}]interface{}{"id": float64(i), "data": map[interface{}]interface{}{"a": "b"}}), nil)
+
+		if err != nil || len(errs) != 0 {
+			t.Error("Unexpected result:", errs, err)
+			return
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	sort.Strings(nodes)
+
+	if res := fmt.Sprint(nodes); res != "[node1 node2 node3]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	lock.Lock()
+	for i := 0; i < 3; i++ {
+		if res := handled[fmt.Sprint("job", i)]; res == "" || res[6:] != fmt.Sprintf("map[data:map[a:b] id:%v]", i) {
+			t.Error("Unexpected result:", res)
+			lock.Unlock()
+			return
+		}
+	}
+	lock.Unlock()
+
+	// Errors are forwarded back
+
+	node, errs, err := c.AddEventAndWait(engine.NewEvent("fail", []string{"job", "run"}, nil), nil)
+
+	if err != nil || len(errs) != 1 || errs[0].Error() != "fail -> handler : Job failed" || node != "node1" {
+		t.Error("Unexpected result:", node, errs, err)
+		return
+	}
+
+	// Scopes are forwarded
+
+	node, errs, err = c.AddEventAndWait(engine.NewEvent("restricted", []string{"job", "restricted"}, nil),
+		map[string]bool{"admin": true})
+
+	if err != nil || len(errs) != 1 || errs[0].Error() != "restricted -> restricted : Restricted job" || node != "node2" {
+		t.Error("Unexpected result:", node, errs, err)
+		return
+	}
+
+	// Events are not handed to nodes which have stopped
+
+	clusters[2].Stop()
+
+	if res := fmt.Sprint(c.Nodes()); res != "[node1 node2]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if node, _, err = c.AddEventAndWait(engine.NewEvent("job", []string{"job", "run"}, nil), nil); err != nil || node == "node3" {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	// Check that rule differences are detected
+
+	other := NewCluster("node4", testNode("node4", handled, lock, true), NewMemoryTransport(network, "node4"))
+	other.Start()
+	defer other.Processor.Finish()
+
+	if err := c.CheckRules(); err == nil ||
+		err.Error() != "Node node4 has different rules: [extra, handler, restricted] (local node node1 has [handler, restricted])" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := other.Start(); err == nil || err.Error() != "Node node4 is already listening" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := c.handleMessage(&Message{Type: "foo"}); res.Error != "Unknown message type: foo" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := c.handleMessage(&Message{Type: MessageEvent}); res.Error != "No event given" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Check processing errors
+
+	clusters[1].Processor.Finish()
+
+	if _, _, err = c.AddEventAndWait(engine.NewEvent("job", []string{"job", "run"}, nil), nil); err == nil ||
+		err.Error() != "Node node2 could not process event: Cannot add event if the processor is stopping or not running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = c.Transport.Send("node5", &Message{Type: MessageRules}); err == nil || err.Error() != "Unknown node: node5" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,271 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package cluster
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory transport
+// ================
+
+/*
+MemoryNetwork connects memory transports within the same process.
+*/
+type MemoryNetwork struct {
+	handlers map[string]func(msg *Message) *Message // Message handlers of listening nodes
+	lock     *sync.RWMutex                          // Lock for handlers
+}
+
+/*
+NewMemoryNetwork creates a new network for memory transports.
+*/
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{make(map[string]func(msg *Message) *Message), &sync.RWMutex{}}
+}
+
+/*
+MemoryTransport is a transport between nodes within the same process.
+*/
+type MemoryTransport struct {
+	name    string         // Name of the node
+	network *MemoryNetwork // Network of the transport
+}
+
+/*
+NewMemoryTransport creates a new memory transport for a node.
+*/
+func NewMemoryTransport(network *MemoryNetwork, name string) *MemoryTransport {
+	return &MemoryTransport{name, network}
+}
+
+/*
+Nodes returns the names of all other nodes which can be reached.
+*/
+func (mt *MemoryTransport) Nodes() []string {
+	mt.network.lock.RLock()
+	defer mt.network.lock.RUnlock()
+
+	var nodes []string
+
+	for name := range mt.network.handlers {
+		if name != mt.name {
+			nodes = append(nodes, name)
+		}
+	}
+
+	sort.Strings(nodes)
+
+	return nodes
+}
+
+/*
+Send sends a message to a node and returns the response.
+*/
+func (mt *MemoryTransport) Send(node string, msg *Message) (*Message, error) {
+	mt.network.lock.RLock()
+	handler, ok := mt.network.handlers[node]
+	mt.network.lock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown node: %v", node)
+	}
+
+	return handler(msg), nil
+}
+
+/*
+Listen starts receiving messages from other nodes.
+*/
+func (mt *MemoryTransport) Listen(handler func(msg *Message) *Message) error {
+	mt.network.lock.Lock()
+	defer mt.network.lock.Unlock()
+
+	if _, ok := mt.network.handlers[mt.name]; ok {
+		return fmt.Errorf("Node %v is already listening", mt.name)
+	}
+
+	mt.network.handlers[mt.name] = handler
+
+	return nil
+}
+
+/*
+Close stops receiving messages.
+*/
+func (mt *MemoryTransport) Close() error {
+	mt.network.lock.Lock()
+	defer mt.network.lock.Unlock()
+
+	delete(mt.network.handlers, mt.name)
+
+	return nil
+}
+
+// TCP transport
+// =============
+
+/*
+TCPTransport is a transport between nodes over TCP. Messages are exchanged
+as JSON objects (one object per line). Event states are converted to JSON
+which means that all numbers arrive as floating point numbers.
+*/
+type TCPTransport struct {
+	Address string            // Address to listen on (e.g. localhost:9020)
+	Peers   map[string]string // Addresses of other nodes (node name -> address)
+	Timeout time.Duration     // Timeout for connecting to other nodes
+
+	listener net.Listener // Listener for incoming connections
+	lock     *sync.Mutex  // Lock for the listener
+}
+
+/*
+NewTCPTransport creates a new TCP transport.
+*/
+func NewTCPTransport(address string, peers map[string]string) *TCPTransport {
+	return &TCPTransport{address, peers, 5 * time.Second, nil, &sync.Mutex{}}
+}
+
+/*
+Nodes returns the names of all other nodes which can be reached.
+*/
+func (tt *TCPTransport) Nodes() []string {
+	var nodes []string
+
+	for name := range tt.Peers {
+		nodes = append(nodes, name)
+	}
+
+	sort.Strings(nodes)
+
+	return nodes
+}
+
+/*
+Send sends a message to a node and returns the response.
+*/
+func (tt *TCPTransport) Send(node string, msg *Message) (*Message, error) {
+	var res *Message
+
+	address, ok := tt.Peers[node]
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown node: %v", node)
+	}
+
+	conn, err := net.DialTimeout("tcp", address, tt.Timeout)
+
+	if err == nil {
+		defer conn.Close()
+
+		if err = json.NewEncoder(conn).Encode(msg); err == nil {
+			res = &Message{}
+			err = json.NewDecoder(bufio.NewReader(conn)).Decode(res)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not send message to node %v: %v", node, err)
+	}
+
+	return res, nil
+}
+
+/*
+Listen starts receiving messages from other nodes.
+*/
+func (tt *TCPTransport) Listen(handler func(msg *Message) *Message) error {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+
+	if tt.listener != nil {
+		return fmt.Errorf("TCP transport is already listening")
+	}
+
+	listener, err := net.Listen("tcp", tt.Address)
+
+	if err == nil {
+		tt.listener = listener
+
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				go tt.handleConnection(conn, handler)
+			}
+		}()
+	}
+
+	return err
+}
+
+/*
+ListenAddress returns the address which the transport is listening on or an
+empty string if it is not listening.
+*/
+func (tt *TCPTransport) ListenAddress() string {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+
+	if tt.listener == nil {
+		return ""
+	}
+
+	return tt.listener.Addr().String()
+}
+
+/*
+Close stops receiving messages.
+*/
+func (tt *TCPTransport) Close() error {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+
+	if tt.listener == nil {
+		return fmt.Errorf("TCP transport is not listening")
+	}
+
+	err := tt.listener.Close()
+	tt.listener = nil
+
+	return err
+}
+
+/*
+handleConnection handles all requests of a single connection.
+*/
+func (tt *TCPTransport) handleConnection(conn net.Conn, handler func(msg *Message) *Message) {
+	defer conn.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+
+	for {
+		msg := &Message{}
+
+		if err := dec.Decode(msg); err != nil {
+			return
+		}
+
+		if err := enc.Encode(handler(msg)); err != nil {
+			return
+		}
+	}
+}
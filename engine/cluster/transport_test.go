@@ -0,0 +1,141 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/krotik/ecal/engine"
+)
+
+func TestTCPTransport(t *testing.T) {
+	handled := make(map[string]string)
+	lock := &sync.Mutex{}
+
+	t1 := NewTCPTransport("localhost:0", map[string]string{})
+	t2 := NewTCPTransport("localhost:0", map[string]string{})
+
+	if res := t1.ListenAddress(); res != "" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	c1 := NewCluster("node1", testNode("node1", handled, lock, false), t1)
+	c2 := NewCluster("node2", testNode("node2", handled, lock, false), t2)
+
+	defer c1.Processor.Finish()
+	defer c2.Processor.Finish()
+
+	if err := c1.Start(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := c2.Start(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := c2.Start(); err == nil || err.Error() != "TCP transport is already listening" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	t1.Peers["node2"] = t2.ListenAddress()
+	t2.Peers["node1"] = t1.ListenAddress()
+
+	if res := fmt.Sprint(c1.Nodes()); res != "[node1 node2]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := c1.CheckRules(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// First event is processed locally
+
+	node, errs, err := c1.AddEventAndWait(engine.NewEvent("job1", []string{"job", "run"},
+		map[interface{}]interface{}{"id": 1}), nil)
+
+	if err != nil || len(errs) != 0 || node != "node1" {
+		t.Error("Unexpected result:", node, errs, err)
+		return
+	}
+
+	// Second event is sent to the other node - numbers arrive as floats
+
+	node, errs, err = c1.AddEventAndWait(engine.NewEvent("fail", []string{"job", "run"},
+		map[interface{}]interface{}{"id": 2, "list": []interface{}{"a", true}}), nil)
+
+	if err != nil || len(errs) != 1 || node != "node2" {
+		t.Error("Unexpected result:", node, errs, err)
+		return
+	}
+
+	if res := errs[0].Error(); res != "fail -> handler : Job failed" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprintf("%v %v %v", errs[0].Event.Name, errs[0].Event.Kind, errs[0].Event.State); res != "fail [job run] map[id:2 list:[a true]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	lock.Lock()
+	res := fmt.Sprint(handled["job1"], " - ", handled["fail"])
+	lock.Unlock()
+
+	if res != "node1 map[id:1] - node2 map[id:2 list:[a true]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Unreachable nodes are skipped
+
+	if err := c2.Stop(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := c2.Stop(); err == nil || err.Error() != "TCP transport is not listening" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if node, _, err = c1.AddEventAndWait(engine.NewEvent("job2", []string{"job", "run"}, nil), nil); err != nil || node != "node1" {
+		t.Error("Unexpected result:", node, err)
+		return
+	}
+
+	if _, err = t1.Send("node2", &Message{Type: MessageRules}); err == nil ||
+		!strings.HasPrefix(err.Error(), "Could not send message to node node2:") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := c1.CheckRules(); err == nil || !strings.HasPrefix(err.Error(), "Could not get rules of node node2:") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = t1.Send("node3", &Message{Type: MessageRules}); err == nil || err.Error() != "Unknown node: node3" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	c1.Stop()
+}
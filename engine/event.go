@@ -54,6 +54,85 @@ func (e *Event) State() map[interface{}]interface{} {
 	return e.state
 }
 
+/*
+NewCollectedEvent returns a new event which contains a list of collected events.
+The new event has the name and kind of the first collected event. Its state
+contains the list of collected events (each with name, kind and state) under
+the key "events".
+*/
+func NewCollectedEvent(events []*Event) *Event {
+	list := make([]interface{}, len(events))
+
+	for i, e := range events {
+		list[i] = map[interface{}]interface{}{
+			"name":  e.Name(),
+			"kind":  strings.Join(e.Kind(), "."),
+			"state": e.State(),
+		}
+	}
+
+	return NewEvent(events[0].Name(), events[0].Kind(), map[interface{}]interface{}{
+		"events": list,
+	})
+}
+
+/*
+RetryExhaustedKind is the kind of events which report that a rule failed to
+handle an event after all retries.
+*/
+var RetryExhaustedKind = []string{"retry", "exhausted"}
+
+/*
+NewRetryExhaustedEvent returns a new event which reports that a rule failed to
+handle an event after all retries. The new event has the name of the rule and
+the kind retry.exhausted. Its state contains the name of the rule under "rule",
+the failed event (with name, kind and state) under "event", the last error
+under "error" and the given number of times the action was run under
+"attempts".
+*/
+func NewRetryExhaustedEvent(rule *Rule, event *Event, err error, attempts int) *Event {
+	return NewEvent(rule.Name, RetryExhaustedKind, map[interface{}]interface{}{
+		"rule": rule.Name,
+		"event": map[interface{}]interface{}{
+			"name":  event.Name(),
+			"kind":  strings.Join(event.Kind(), "."),
+			"state": event.State(),
+		},
+		"error":    err.Error(),
+		"attempts": attempts,
+	})
+}
+
+/*
+NewBreakerEvent returns a new event which reports that a circuit breaker was
+opened or closed by the result of a rule. The new event has the name of the
+breaker and the kind circuit.open or circuit.close. Its state contains the
+name of the breaker under "breaker", the name of the rule under "rule", the
+number of consecutive failures under "failures" and the error which opened
+the breaker under "error".
+*/
+func NewBreakerEvent(breaker *RuleBreaker, rule *Rule, err error) *Event {
+	kind := []string{"circuit", "close"}
+	state, failures := breaker.State()
+
+	var errMsg interface{}
+
+	if state == BreakerOpen {
+		kind = []string{"circuit", "open"}
+
+		if err != nil {
+			errMsg = err.Error()
+		}
+	}
+
+	return NewEvent(breaker.Name, kind, map[interface{}]interface{}{
+		"breaker":  breaker.Name,
+		"rule":     rule.Name,
+		"failures": failures,
+		"error":    errMsg,
+	})
+}
+
 func (e *Event) String() string {
 	return fmt.Sprintf("Event: %v %v %v", e.name, strings.Join(e.kind, "."),
 		stringutil.ConvertToString(e.state))
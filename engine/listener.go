@@ -0,0 +1,83 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package engine
+
+/*
+ProcessorListener is notified about lifecycle events of a processor. It can
+be used to collect metrics, trace event cascades or for custom logging.
+Listener methods are called synchronously by the threads of the processor
+and should return quickly.
+*/
+type ProcessorListener interface {
+
+	/*
+		OnEventQueued is called when an event was queued for processing.
+	*/
+	OnEventQueued(event *Event, monitor Monitor)
+
+	/*
+		OnRuleStart is called before a rule handles an event.
+	*/
+	OnRuleStart(rule *Rule, event *Event, monitor Monitor)
+
+	/*
+		OnRuleEnd is called after a rule has handled an event. The error is
+		the error which was returned by the rule (nil on success).
+	*/
+	OnRuleEnd(rule *Rule, event *Event, monitor Monitor, err error)
+
+	/*
+		OnCascadeFinished is called when an event cascade has finished.
+	*/
+	OnCascadeFinished(monitor *RootMonitor)
+
+	/*
+		OnError is called when rules returned errors while handling an event.
+	*/
+	OnError(err *TaskError)
+}
+
+/*
+BaseProcessorListener is a processor listener which ignores all events. It
+can be embedded by listeners which only need some of the listener methods.
+*/
+type BaseProcessorListener struct {
+}
+
+/*
+OnEventQueued is called when an event was queued for processing.
+*/
+func (bl *BaseProcessorListener) OnEventQueued(event *Event, monitor Monitor) {
+}
+
+/*
+OnRuleStart is called before a rule handles an event.
+*/
+func (bl *BaseProcessorListener) OnRuleStart(rule *Rule, event *Event, monitor Monitor) {
+}
+
+/*
+OnRuleEnd is called after a rule has handled an event.
+*/
+func (bl *BaseProcessorListener) OnRuleEnd(rule *Rule, event *Event, monitor Monitor, err error) {
+}
+
+/*
+OnCascadeFinished is called when an event cascade has finished.
+*/
+func (bl *BaseProcessorListener) OnCascadeFinished(monitor *RootMonitor) {
+}
+
+/*
+OnError is called when rules returned errors while handling an event.
+*/
+func (bl *BaseProcessorListener) OnError(err *TaskError) {
+}
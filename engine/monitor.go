@@ -14,7 +14,10 @@ import (
 	"bytes"
 	"container/heap"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/krotik/common/errorutil"
 	"github.com/krotik/common/sortutil"
@@ -82,6 +85,16 @@ type Monitor interface {
 	*/
 	SetErrors(e *TaskError)
 
+	/*
+		Results returns the results of the rules which handled the event of this monitor.
+	*/
+	Results() map[string]interface{}
+
+	/*
+		SetResult records the result of a rule which handled the event of this monitor.
+	*/
+	SetResult(rule string, result interface{})
+
 	/*
 		EventPath returns the chain of events which created this monitor.
 	*/
@@ -92,6 +105,11 @@ type Monitor interface {
 	*/
 	EventPathString() string
 
+	/*
+		CascadeTree returns the event cascade which started with this monitor.
+	*/
+	CascadeTree() *CascadeNode
+
 	/*
 		String returns a string representation of this monitor.
 	*/
@@ -108,10 +126,17 @@ type monitorBase struct {
 	Err     *TaskError             // Errors which occurred during event processing
 
 	priority    int          // Priority of the monitor
+	depth       int          // Depth of the monitor in the event cascade (root monitor is 0)
 	rootMonitor *RootMonitor // Root monitor
 	event       *Event       // Event which activated this monitor
 	activated   bool         // Flag indicating if the monitor was activated
 	finished    bool         // Flag indicating if the monitor has finished
+
+	children      []*monitorBase         // Child monitors (protected by the root monitor lock)
+	rules         []string               // Rules which handled the event (protected by the root monitor lock)
+	results       map[string]interface{} // Rule results (protected by the root monitor lock)
+	activatedTime time.Time              // Time when the monitor was activated
+	finishedTime  time.Time              // Time when the monitor has finished
 }
 
 /*
@@ -122,9 +147,11 @@ func newMonitorBase(priority int, parent *monitorBase, context map[string]interf
 	var ret *monitorBase
 
 	if parent != nil {
-		ret = &monitorBase{newMonID(), parent, context, nil, priority, parent.rootMonitor, nil, false, false}
+		ret = &monitorBase{newMonID(), parent, context, nil, priority, parent.depth + 1, parent.rootMonitor, nil, false, false,
+			nil, nil, nil, time.Time{}, time.Time{}}
 	} else {
-		ret = &monitorBase{newMonID(), nil, context, nil, priority, nil, nil, false, false}
+		ret = &monitorBase{newMonID(), nil, context, nil, priority, 0, nil, nil, false, false,
+			nil, nil, nil, time.Time{}, time.Time{}}
 	}
 
 	return ret
@@ -136,7 +163,7 @@ NewChildMonitor creates a new child monitor of this monitor.
 func (mb *monitorBase) NewChildMonitor(priority int) Monitor {
 	child := &ChildMonitor{newMonitorBase(priority, mb, mb.Context)}
 
-	mb.rootMonitor.descendantCreated(child)
+	mb.rootMonitor.descendantCreated(mb, child.monitorBase)
 
 	return child
 }
@@ -192,7 +219,7 @@ func (mb *monitorBase) Activate(e *Event) {
 	errorutil.AssertTrue(e != nil, "Monitor can only be activated with an event")
 
 	mb.event = e
-	mb.rootMonitor.descendantActivated(mb.priority)
+	mb.rootMonitor.descendantActivated(mb)
 	mb.activated = true
 }
 
@@ -219,6 +246,61 @@ func (mb *monitorBase) Finish() {
 	mb.rootMonitor.descendantFinished(mb)
 }
 
+/*
+rulesTriggered records the names of rules which handle the event of this monitor.
+*/
+func (mb *monitorBase) rulesTriggered(rules []*Rule) {
+	mb.rootMonitor.lock.Lock()
+	defer mb.rootMonitor.lock.Unlock()
+
+	for _, r := range rules {
+		mb.rules = append(mb.rules, r.Name)
+	}
+}
+
+/*
+CascadeTree returns the event cascade which started with this monitor.
+*/
+func (mb *monitorBase) CascadeTree() *CascadeNode {
+	mb.rootMonitor.lock.Lock()
+	defer mb.rootMonitor.lock.Unlock()
+
+	return mb.cascadeNode()
+}
+
+/*
+cascadeNode creates a cascade node for this monitor and all its descendants.
+The root monitor lock must be held when calling this function.
+*/
+func (mb *monitorBase) cascadeNode() *CascadeNode {
+	node := &CascadeNode{
+		MonitorID: mb.id,
+		Event:     mb.event,
+		Rules:     append([]string{}, mb.rules...),
+		Errors:    make(map[string]error),
+		Results:   make(map[string]interface{}),
+		Activated: mb.activatedTime,
+		Finished:  mb.finishedTime,
+		Children:  make([]*CascadeNode, 0, len(mb.children)),
+	}
+
+	if mb.Err != nil {
+		for k, v := range mb.Err.ErrorMap {
+			node.Errors[k] = v
+		}
+	}
+
+	for k, v := range mb.results {
+		node.Results[k] = v
+	}
+
+	for _, c := range mb.children {
+		node.Children = append(node.Children, c.cascadeNode())
+	}
+
+	return node
+}
+
 /*
 Errors returns the error object of this monitor.
 */
@@ -235,6 +317,29 @@ func (mb *monitorBase) SetErrors(e *TaskError) {
 	mb.rootMonitor.descendantFailed(mb)
 }
 
+/*
+Results returns the results of the rules which handled the event of this monitor.
+*/
+func (mb *monitorBase) Results() map[string]interface{} {
+	mb.rootMonitor.lock.Lock()
+	defer mb.rootMonitor.lock.Unlock()
+
+	ret := make(map[string]interface{}, len(mb.results))
+
+	for k, v := range mb.results {
+		ret[k] = v
+	}
+
+	return ret
+}
+
+/*
+SetResult records the result of a rule which handled the event of this monitor.
+*/
+func (mb *monitorBase) SetResult(rule string, result interface{}) {
+	mb.rootMonitor.descendantResult(mb, rule, result)
+}
+
 /*
 EventPath returns the chain of events which created this monitor.
 */
@@ -300,7 +405,9 @@ type RootMonitor struct {
 	unfinished   int                     // Counter of all unfinished trackers
 	messageQueue *pubsub.EventPump       // Message passing queue of the processor
 	errors       map[uint64]*monitorBase // Monitors which got errors
+	results      map[uint64]*monitorBase // Monitors which got results
 	finished     func(Processor)         // Finish handler (can be used externally)
+	aborted      error                   // Reason why the event cascade was aborted
 }
 
 /*
@@ -311,7 +418,7 @@ func newRootMonitor(context map[string]interface{}, scope *RuleScope,
 
 	ret := &RootMonitor{newMonitorBase(0, nil, context), &sync.Mutex{},
 		make(map[int]int), &sortutil.IntHeap{}, scope, 1, messageQueue,
-		make(map[uint64]*monitorBase), nil}
+		make(map[uint64]*monitorBase), make(map[uint64]*monitorBase), nil, nil}
 
 	// A root monitor is its own parent
 
@@ -330,6 +437,54 @@ func (rm *RootMonitor) SetFinishHandler(fh func(Processor)) {
 	rm.finished = fh
 }
 
+/*
+ContextValue returns a value of the context object of this root monitor. The
+value is created with a given function if it does not exist yet. Values of the
+context object should only be accessed through this function once the event
+cascade has started.
+*/
+func (rm *RootMonitor) ContextValue(key string, create func() interface{}) interface{} {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+
+	if rm.Context == nil {
+		rm.Context = make(map[string]interface{})
+	}
+
+	val, ok := rm.Context[key]
+
+	if !ok {
+		val = create()
+		rm.Context[key] = val
+	}
+
+	return val
+}
+
+/*
+Aborted returns the reason why the event cascade of this root monitor was
+aborted or nil if it was not aborted.
+*/
+func (rm *RootMonitor) Aborted() error {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+
+	return rm.aborted
+}
+
+/*
+abort aborts the event cascade of this root monitor - no further events are
+accepted. Only the first reason is kept.
+*/
+func (rm *RootMonitor) abort(reason error) {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+
+	if rm.aborted == nil {
+		rm.aborted = reason
+	}
+}
+
 /*
 HighestPriority returns the highest priority which is handled by this monitor.
 */
@@ -370,23 +525,64 @@ func (rm *RootMonitor) AllErrors() []*TaskError {
 	return ret
 }
 
+/*
+AllResults returns all rule results which have been collected in this root monitor.
+*/
+func (rm *RootMonitor) AllResults() []*TaskResult {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+
+	ret := make([]*TaskResult, 0, len(rm.results))
+
+	// Sort by monitor id - this should give the corrent order timewise
+
+	var ids []uint64
+	for id := range rm.results {
+		ids = append(ids, id)
+	}
+
+	sortutil.UInt64s(ids)
+
+	for _, id := range ids {
+		m := rm.results[id]
+
+		resultMap := make(map[string]interface{}, len(m.results))
+		for k, v := range m.results {
+			resultMap[k] = v
+		}
+
+		var mon Monitor = &ChildMonitor{m}
+		if m == rm.monitorBase {
+			mon = rm
+		}
+
+		ret = append(ret, &TaskResult{resultMap, m.event, mon})
+	}
+
+	return ret
+}
+
 /*
 descendantCreated notifies this root monitor that a descendant has been created.
 */
-func (rm *RootMonitor) descendantCreated(monitor Monitor) {
+func (rm *RootMonitor) descendantCreated(parent *monitorBase, monitor *monitorBase) {
 	rm.lock.Lock()
 	defer rm.lock.Unlock()
 
+	parent.children = append(parent.children, monitor)
 	rm.unfinished++
 }
 
 /*
 descendantActivated notifies this root monitor that a descendant has been activated.
 */
-func (rm *RootMonitor) descendantActivated(priority int) {
+func (rm *RootMonitor) descendantActivated(monitor *monitorBase) {
 	rm.lock.Lock()
 	defer rm.lock.Unlock()
 
+	priority := monitor.priority
+	monitor.activatedTime = time.Now()
+
 	val, ok := rm.incomplete[priority]
 	if !ok {
 		val = 0
@@ -396,6 +592,62 @@ func (rm *RootMonitor) descendantActivated(priority int) {
 	rm.incomplete[priority] = val + 1
 }
 
+/*
+newActiveChildMonitors creates a new child monitor of a given parent monitor
+for each given event and activates it with the event. The lock of this root
+monitor is only acquired once.
+*/
+func (rm *RootMonitor) newActiveChildMonitors(parent *monitorBase, priority int, events []*Event) []Monitor {
+	res := make([]Monitor, len(events))
+
+	if len(events) == 0 {
+		return res
+	}
+
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+
+	if _, ok := rm.incomplete[priority]; !ok {
+		heap.Push(rm.priorities, priority)
+	}
+
+	now := time.Now()
+
+	for i, e := range events {
+		errorutil.AssertTrue(e != nil, "Monitor can only be activated with an event")
+
+		child := newMonitorBase(priority, parent, parent.Context)
+
+		child.event = e
+		child.activated = true
+		child.activatedTime = now
+
+		parent.children = append(parent.children, child)
+
+		res[i] = &ChildMonitor{child}
+	}
+
+	rm.unfinished += len(events)
+	rm.incomplete[priority] += len(events)
+
+	return res
+}
+
+/*
+descendantResult records the result of a rule in a descendant.
+*/
+func (rm *RootMonitor) descendantResult(monitor *monitorBase, rule string, result interface{}) {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+
+	if monitor.results == nil {
+		monitor.results = make(map[string]interface{})
+	}
+
+	monitor.results[rule] = result
+	rm.results[monitor.ID()] = monitor
+}
+
 /*
 descendantFailed notifies this root monitor that a descendant has failed.
 */
@@ -410,12 +662,14 @@ func (rm *RootMonitor) descendantFailed(monitor *monitorBase) {
 descendantFinished records that this monitor has finished. If it is the last
 active monitor in the event tree then send a notification.
 */
-func (rm *RootMonitor) descendantFinished(m Monitor) {
+func (rm *RootMonitor) descendantFinished(m *monitorBase) {
 
 	rm.lock.Lock()
 
 	rm.unfinished--
 
+	m.finishedTime = time.Now()
+
 	finished := rm.unfinished == 0
 
 	if m.IsActivated() {
@@ -438,6 +692,84 @@ func (rm *RootMonitor) descendantFinished(m Monitor) {
 	}
 }
 
+// Cascade tree
+// ============
+
+/*
+CascadeNode is a node in the tree of an event cascade. Each node represents
+a monitor and the event which activated it.
+*/
+type CascadeNode struct {
+	MonitorID uint64                 // ID of the monitor
+	Event     *Event                 // Event which activated the monitor (nil if the monitor was not activated)
+	Rules     []string               // Rules which handled the event
+	Errors    map[string]error       // Rule errors (rule name -> error)
+	Results   map[string]interface{} // Rule results (rule name -> result)
+	Activated time.Time              // Time when the monitor was activated
+	Finished  time.Time              // Time when the monitor has finished (zero if it is still running)
+	Children  []*CascadeNode         // Cascade nodes of events which were added while handling the event
+}
+
+/*
+Duration returns the time it took to handle the event of this node (zero if
+the event is still being handled).
+*/
+func (cn *CascadeNode) Duration() time.Duration {
+	if cn.Activated.IsZero() || cn.Finished.IsZero() {
+		return 0
+	}
+	return cn.Finished.Sub(cn.Activated)
+}
+
+/*
+String returns a string representation of this cascade node and all its
+descendants.
+*/
+func (cn *CascadeNode) String() string {
+	var buf bytes.Buffer
+	cn.stringIndent(&buf, 0)
+	return strings.TrimSpace(buf.String())
+}
+
+/*
+stringIndent writes an indented string representation of this cascade node.
+*/
+func (cn *CascadeNode) stringIndent(buf *bytes.Buffer, indent int) {
+	buf.WriteString(strings.Repeat("  ", indent))
+
+	if cn.Event != nil {
+		buf.WriteString(fmt.Sprintf("%v (%v)", cn.Event.Name(), strings.Join(cn.Event.Kind(), ".")))
+	} else {
+		buf.WriteString("<no event>")
+	}
+
+	if len(cn.Rules) > 0 {
+		buf.WriteString(fmt.Sprintf(" rules: %v", strings.Join(cn.Rules, ", ")))
+	}
+
+	if len(cn.Errors) > 0 {
+		var names []string
+
+		for name := range cn.Errors {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for i, name := range names {
+			names[i] = fmt.Sprintf("%v: %v", name, cn.Errors[name])
+		}
+
+		buf.WriteString(fmt.Sprintf(" errors: %v", strings.Join(names, ", ")))
+	}
+
+	buf.WriteString("\n")
+
+	for _, c := range cn.Children {
+		c.stringIndent(buf, indent+1)
+	}
+}
+
 // Child Monitor
 // =============
 
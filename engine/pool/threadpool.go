@@ -14,6 +14,7 @@ package pool
 
 import (
 	"math"
+	"runtime"
 	"sync"
 	"time"
 )
@@ -219,6 +220,43 @@ func (tp *ThreadPool) AddTask(t Task) {
 	tp.newTaskCond.Signal()
 }
 
+/*
+AddTasks adds several tasks to the thread pool. The queue is only locked once.
+*/
+func (tp *ThreadPool) AddTasks(tasks []Task) {
+	if len(tasks) == 0 {
+		return
+	}
+
+	tp.queueLock.Lock()
+	defer tp.queueLock.Unlock()
+
+	for _, t := range tasks {
+		tp.queue.Push(t)
+	}
+
+	// Reset too few flag
+
+	tp.RegulationLock.Lock()
+
+	if tp.tooFewTriggered && tp.TooFewThreshold < tp.queue.Size() {
+		tp.tooFewTriggered = false
+	}
+
+	// Check too many
+
+	if !tp.tooManyTriggered && tp.TooManyThreshold <= tp.queue.Size() {
+		tp.tooManyTriggered = true
+		tp.TooManyCallback()
+	}
+
+	tp.RegulationLock.Unlock()
+
+	// Wake up all waiting workers
+
+	tp.newTaskCond.Broadcast()
+}
+
 /*
 getTask is called by a worker to request a new task. The worker is expected to finish
 if this function returns nil.
@@ -360,7 +398,15 @@ func (tp *ThreadPool) SetWorkerCount(count int, wait bool) {
 
 	// If a count was set wait until at least one worker is idle
 
-	for count > 0 && len(tp.workerIdleMap) == 0 {
+	for count > 0 {
+		tp.workerMapLock.Lock()
+		idleCount := len(tp.workerIdleMap)
+		tp.workerMapLock.Unlock()
+
+		if idleCount > 0 {
+			break
+		}
+
 		time.Sleep(5 * time.Nanosecond)
 	}
 }
@@ -433,7 +479,7 @@ func (tp *ThreadPool) WaitAll() {
 			break
 		}
 
-		time.Sleep(5 * time.Nanosecond)
+		runtime.Gosched()
 
 		// Broadcast again and again until all workers are idle
 
@@ -476,7 +522,7 @@ func (tp *ThreadPool) JoinAll() {
 			break
 		}
 
-		time.Sleep(5 * time.Nanosecond)
+		runtime.Gosched()
 
 		// Broadcast again and again until all workers are dead
 
@@ -11,10 +11,17 @@
 package engine
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/krotik/common/stringutil"
 	"github.com/krotik/ecal/engine/pool"
 	"github.com/krotik/ecal/engine/pubsub"
 )
@@ -41,6 +48,30 @@ type Processor interface {
 	*/
 	Workers() int
 
+	/*
+	   SetWorkers changes the number of threads of this processor. The number
+	   can be changed while the processor is running. Deterministic processors
+	   always have a single thread.
+	*/
+	SetWorkers(count int)
+
+	/*
+	   Deterministic returns if this processor runs event cascades deterministically.
+	*/
+	Deterministic() bool
+
+	/*
+	   Clock returns the clock which is used by components which fire events
+	   over time (e.g. pulse triggers).
+	*/
+	Clock() Clock
+
+	/*
+	   SetClock sets the clock which is used by components which fire events
+	   over time. The clock should be set before the processor is started.
+	*/
+	SetClock(clock Clock)
+
 	/*
 	   Reset removes all stored rules from this processor.
 	*/
@@ -51,11 +82,86 @@ type Processor interface {
 	*/
 	AddRule(rule *Rule) error
 
+	/*
+	   InsertRule adds a new rule to the processor. Unlike AddRule the processor
+	   does not need to be stopped.
+	*/
+	InsertRule(rule *Rule) error
+
+	/*
+	   RemoveRule removes a loaded rule from the processor. The processor does
+	   not need to be stopped.
+	*/
+	RemoveRule(name string) error
+
 	/*
 	   Rules returns all loaded rules.
 	*/
 	Rules() map[string]*Rule
 
+	/*
+	   SetRuleEnabled enables or disables a loaded rule. Disabled rules do not
+	   trigger and do not suppress other rules. Rules can be enabled or disabled
+	   while the processor is running.
+	*/
+	SetRuleEnabled(name string, enabled bool) error
+
+	/*
+	   SetRulePriority changes the priority of a loaded rule. The priority can be
+	   changed while the processor is running.
+	*/
+	SetRulePriority(name string, priority int) error
+
+	/*
+	   RuleSettings returns if a loaded rule is enabled and its current priority
+	   (including changes which were made at runtime).
+	*/
+	RuleSettings(name string) (bool, int, error)
+
+	/*
+	   SetRuleBreaker sets the circuit breaker of a loaded rule. The same
+	   breaker can be set for several rules. A nil value removes the breaker
+	   of the rule. Breakers can be set while the processor is running.
+	*/
+	SetRuleBreaker(name string, breaker *RuleBreaker) error
+
+	/*
+	   SetRuleDedup sets the deduplication of a loaded rule. The rule ignores
+	   events which are duplicates of an event it has seen within the time
+	   window of the deduplication. A nil value removes the deduplication of
+	   the rule.
+	*/
+	SetRuleDedup(name string, dedup *RuleDedup) error
+
+	/*
+	   SetRuleCollect sets the aggregation of events of a loaded rule. The
+	   rule collects all matching events of a time window and handles them at
+	   once. A nil value removes the aggregation of the rule. Events which
+	   have already been collected are discarded.
+	*/
+	SetRuleCollect(name string, collect *RuleCollect) error
+
+	/*
+	   SetRuleRetry sets the retry policy of a loaded rule. The action of the
+	   rule is run again if it returns an error. A nil value removes the retry
+	   policy of the rule.
+	*/
+	SetRuleRetry(name string, retry *RuleRetry) error
+
+	/*
+	   SaveState writes a snapshot of the processor state to a given writer. The
+	   snapshot contains the runtime settings of all loaded rules and all queued
+	   tasks which have not been processed yet.
+	*/
+	SaveState(w io.Writer) error
+
+	/*
+	   LoadState restores a snapshot which was written with SaveState. The rules
+	   of the snapshot must have been loaded and the processor must be stopped.
+	   Restored tasks are processed once the processor is started.
+	*/
+	LoadState(r io.Reader) error
+
 	/*
 	   Start starts this processor.
 	*/
@@ -66,6 +172,21 @@ type Processor interface {
 	*/
 	Finish()
 
+	/*
+	   Shutdown stops accepting new root events and waits for all running event
+	   cascades and registered triggers to finish before stopping the processor.
+	   Waiting is bounded by the given context. Returns a ShutdownError if work
+	   was left over.
+	*/
+	Shutdown(ctx context.Context) error
+
+	/*
+	   RegisterTrigger registers a goroutine which adds root events to the processor
+	   (e.g. a pulse trigger). The returned channel is closed once the processor
+	   shuts down. The returned function must be called once the goroutine has stopped.
+	*/
+	RegisterTrigger() (<-chan struct{}, func())
+
 	/*
 	   Stopped returns if the processor is stopped.
 	*/
@@ -97,6 +218,37 @@ type Processor interface {
 	*/
 	SetFailOnFirstErrorInTriggerSequence(bool)
 
+	/*
+		SetQueueClasses sets classes of event kinds which are processed from
+		their own queues. Each class is a list of kind matches (e.g. alert.*).
+		Tasks of a class are processed before tasks of all following classes
+		independent of the priorities of their monitors. Events which do not
+		match any class have the lowest priority. A class with pending tasks is
+		picked at the latest after it was skipped starvationLimit times in a
+		row (0 means no starvation protection).
+	*/
+	SetQueueClasses(classes [][]string, starvationLimit int)
+
+	/*
+		SetCascadeLimits sets the limits of event cascades. An event cascade is
+		aborted if an event would exceed the maximum depth of the cascade or if
+		an event kind re-triggers itself more than maxKindRepeat times in a row.
+		A limit of 0 disables the check (default).
+	*/
+	SetCascadeLimits(maxDepth int, maxKindRepeat int)
+
+	/*
+		AddListener adds a listener which is notified about lifecycle events
+		of this processor (e.g. queued events, rule executions, finished event
+		cascades and errors).
+	*/
+	AddListener(listener ProcessorListener)
+
+	/*
+		RemoveListener removes a previously added listener.
+	*/
+	RemoveListener(listener ProcessorListener)
+
 	/*
 	   AddEventAndWait adds a new event to the processor and waits for the resulting event cascade
 	   to finish. If a monitor is passed then it must be a RootMonitor.
@@ -109,6 +261,28 @@ type Processor interface {
 	*/
 	AddEvent(event *Event, parentMonitor Monitor) (Monitor, error)
 
+	/*
+	   AddEvents adds several events to the processor. Each event is handled with a
+	   new child monitor of the given parent monitor which must be active (e.g. the
+	   monitor of a rule which fans out events). If no parent monitor is given then
+	   each event gets a new root monitor. Returns the monitors of the events - the
+	   monitor of an event which was skipped is nil.
+	*/
+	AddEvents(events []*Event, parentMonitor Monitor) ([]Monitor, error)
+
+	/*
+	   AddEventAfter adds a new event to the processor once a given delay has passed.
+	   The event is added with a new root monitor using the given scope. Returns an
+	   id which can be used to cancel the event.
+	*/
+	AddEventAfter(delay time.Duration, event *Event, scope *RuleScope) uint64
+
+	/*
+	   CancelEvent cancels an event which was added with AddEventAfter. Returns
+	   false if the event was not pending anymore.
+	*/
+	CancelEvent(id uint64) bool
+
 	/*
 	   IsTriggering checks if a given event triggers a loaded rule. This does not the
 	   actual state matching for speed.
@@ -122,12 +296,65 @@ type Processor interface {
 	*/
 	ProcessEvent(tid uint64, event *Event, parent Monitor) map[string]error
 
+	/*
+		DryRun returns the rules which would run for a given event in the order
+		of their execution without running them. Scope matches are checked against
+		a given scope (nil is the global scope). Rules which collect events are
+		included.
+	*/
+	DryRun(event *Event, scope *RuleScope) []*Rule
+
 	/*
 	   String returns a string representation the processor.
 	*/
 	String() string
 }
 
+/*
+ShutdownError is returned if a shutdown left work behind.
+*/
+type ShutdownError struct {
+	QueuedTasks     int   // Number of tasks which were still queued
+	RunningTriggers int   // Number of registered triggers which were still running
+	DroppedEvents   int   // Number of dropped delayed events and collect windows
+	Err             error // Error of the context which ended the shutdown (nil if all tasks finished)
+}
+
+/*
+Error returns a string representation of this error.
+*/
+func (se *ShutdownError) Error() string {
+	ret := fmt.Sprintf("Shutdown left work behind: %v queued task%v, %v running trigger%v, %v dropped delayed event%v",
+		se.QueuedTasks, stringutil.Plural(se.QueuedTasks), se.RunningTriggers, stringutil.Plural(se.RunningTriggers),
+		se.DroppedEvents, stringutil.Plural(se.DroppedEvents))
+
+	if se.Err != nil {
+		ret = fmt.Sprintf("%v (%v)", ret, se.Err)
+	}
+
+	return ret
+}
+
+/*
+Errors of aborted event cascades
+*/
+var (
+	ErrCascadeDepth = errors.New("Maximum event cascade depth exceeded")
+	ErrCascadeLoop  = errors.New("Event kind re-triggers itself in a loop")
+)
+
+/*
+ErrorKeyCascadeAborted is the key of the error in the error map of an event
+which was rejected because its event cascade was aborted.
+*/
+const ErrorKeyCascadeAborted = "CascadeAborted"
+
+/*
+ErrCircuitOpen is the error of rules which were not run because their circuit
+breaker is open.
+*/
+var ErrCircuitOpen = errors.New("Circuit breaker is open")
+
 /*
 eventProcessor main implementation of the Processor interface.
 
@@ -137,32 +364,92 @@ Process -> Triggering -> Matching -> Fire Rule
 
 */
 type eventProcessor struct {
-	id                  uint64                // Processor ID
-	pool                *pool.ThreadPool      // Thread pool of this processor
-	workerCount         int                   // Number of threads for this processor
-	failOnFirstError    bool                  // Stop rule execution on first error in an event trigger sequence
-	ruleIndex           RuleIndex             // Container for loaded rules
-	triggeringCache     map[string]bool       // Cache which remembers which events are triggering
-	triggeringCacheLock sync.Mutex            // Lock for triggeringg cache
-	messageQueue        *pubsub.EventPump     // Queue for message passing between components
-	rmErrorObserver     func(rm *RootMonitor) // Error observer for root monitors
+	id                  uint64                  // Processor ID
+	pool                *pool.ThreadPool        // Thread pool of this processor
+	workerCount         int                     // Number of threads for this processor
+	workerCountLock     sync.Mutex              // Lock for the number of threads
+	failOnFirstError    bool                    // Stop rule execution on first error in an event trigger sequence
+	ruleIndex           RuleIndex               // Container for loaded rules
+	ruleIndexLock       sync.RWMutex            // Lock for the rule index (rules can be changed while running)
+	triggeringCache     map[string]bool         // Cache which remembers which events are triggering
+	triggeringCacheLock sync.Mutex              // Lock for triggeringg cache
+	messageQueue        *pubsub.EventPump       // Queue for message passing between components
+	rmErrorObserver     func(rm *RootMonitor)   // Error observer for root monitors
+	timers              *TimerWheel             // Timer wheel for delayed events
+	disabledRules       map[string]bool         // Rules which have been disabled at runtime
+	rulePriorities      map[string]int          // Rule priorities which have been changed at runtime
+	ruleBreakers        map[string]*RuleBreaker // Circuit breakers of rules
+	ruleDedups          map[string]*RuleDedup   // Deduplication of events by rules
+	ruleCollects        map[string]*RuleCollect // Aggregation of events by rules
+	ruleRetries         map[string]*RuleRetry   // Retry policies of rules
+	ruleSettingsLock    sync.RWMutex            // Lock for runtime rule settings
+	shuttingDown        bool                    // Flag if the processor is shutting down
+	triggerStop         chan struct{}           // Channel which is closed to stop registered triggers
+	triggerCount        int                     // Number of running registered triggers
+	triggers            sync.WaitGroup          // Wait group for registered triggers
+	shutdownDone        chan struct{}           // Channel which is closed once a shutdown has finished
+	shutdownLock        sync.Mutex              // Lock for shutdown state
+	deterministic       bool                    // Flag if event cascades are run deterministically
+	clock               Clock                   // Clock for components which fire events over time
+	queue               *TaskQueue              // Task queue of the thread pool
+	listeners           []ProcessorListener     // Listeners for lifecycle events (copy on write)
+	listenersLock       sync.RWMutex            // Lock for listeners
+	maxCascadeDepth     int                     // Maximum depth of event cascades (0 means no limit)
+	maxKindRepeat       int                     // Maximum number of times an event kind can re-trigger itself (0 means no limit)
 }
 
 /*
 NewProcessor creates a new event processor with a given number of workers.
 */
 func NewProcessor(workerCount int) Processor {
+	return newEventProcessor(workerCount, false)
+}
+
+/*
+NewDeterministicProcessor creates a new event processor which runs event
+cascades deterministically. The processor has a single worker and always
+processes the tasks of the oldest event cascade first. Together with a virtual
+clock this allows tests to assert the exact order of rule executions.
+*/
+func NewDeterministicProcessor() Processor {
+	return newEventProcessor(1, true)
+}
+
+/*
+newEventProcessor creates a new event processor.
+*/
+func newEventProcessor(workerCount int, deterministic bool) *eventProcessor {
 	ep := pubsub.NewEventPump()
 
-	pool := pool.NewThreadPoolWithQueue(NewTaskQueue(ep))
+	queue := NewTaskQueue(ep)
+	queue.deterministic = deterministic
+
+	pool := pool.NewThreadPoolWithQueue(queue)
 
 	pool.TooManyThreshold = 10
 	pool.TooManyCallback = func() {
 		fmt.Fprintf(os.Stderr, "Warning: The thread pool queue is filling up ...")
 	}
 
-	return &eventProcessor{newProcID(), pool,
-		workerCount, false, NewRuleIndex(), nil, sync.Mutex{}, ep, nil}
+	p := &eventProcessor{newProcID(), pool,
+		workerCount, sync.Mutex{}, false, NewRuleIndex(), sync.RWMutex{}, nil, sync.Mutex{}, ep, nil,
+		NewTimerWheel(10*time.Millisecond, 512), make(map[string]bool),
+		make(map[string]int), make(map[string]*RuleBreaker),
+		make(map[string]*RuleDedup), make(map[string]*RuleCollect), make(map[string]*RuleRetry),
+		sync.RWMutex{}, false, make(chan struct{}), 0,
+		sync.WaitGroup{}, nil, sync.Mutex{}, deterministic, &SystemClock{}, queue,
+		nil, sync.RWMutex{}, 0, 0}
+
+	// Notify listeners about all finished event cascades
+
+	ep.AddObserver(MessageRootMonitorFinished, nil,
+		func(event string, eventSource interface{}) {
+			for _, l := range p.getListeners() {
+				l.OnCascadeFinished(eventSource.(*RootMonitor))
+			}
+		})
+
+	return p
 }
 
 /*
@@ -183,9 +470,55 @@ func (p *eventProcessor) ThreadPool() *pool.ThreadPool {
 Workers returns the number of threads of this processor.
 */
 func (p *eventProcessor) Workers() int {
+	p.workerCountLock.Lock()
+	defer p.workerCountLock.Unlock()
+
 	return p.workerCount
 }
 
+/*
+SetWorkers changes the number of threads of this processor. The number
+can be changed while the processor is running. Deterministic processors
+always have a single thread.
+*/
+func (p *eventProcessor) SetWorkers(count int) {
+	if p.deterministic || count < 1 {
+		return
+	}
+
+	p.workerCountLock.Lock()
+	defer p.workerCountLock.Unlock()
+
+	p.workerCount = count
+
+	if p.pool.Status() == pool.StatusRunning {
+		p.pool.SetWorkerCount(count, false)
+	}
+}
+
+/*
+Deterministic returns if this processor runs event cascades deterministically.
+*/
+func (p *eventProcessor) Deterministic() bool {
+	return p.deterministic
+}
+
+/*
+Clock returns the clock which is used by components which fire events
+over time (e.g. pulse triggers).
+*/
+func (p *eventProcessor) Clock() Clock {
+	return p.clock
+}
+
+/*
+SetClock sets the clock which is used by components which fire events
+over time. The clock should be set before the processor is started.
+*/
+func (p *eventProcessor) SetClock(clock Clock) {
+	p.clock = clock
+}
+
 /*
 Reset removes all stored rules from this processor.
 */
@@ -205,7 +538,28 @@ func (p *eventProcessor) Reset() error {
 
 	// Create a new rule index
 
+	p.ruleIndexLock.Lock()
 	p.ruleIndex = NewRuleIndex()
+	p.ruleIndexLock.Unlock()
+
+	// Remove runtime rule settings and discard events which have been
+	// collected by the old rules
+
+	p.ruleSettingsLock.Lock()
+	for _, collect := range p.ruleCollects {
+		collect.Flush()
+	}
+	p.disabledRules = make(map[string]bool)
+	p.rulePriorities = make(map[string]int)
+	p.ruleBreakers = make(map[string]*RuleBreaker)
+	p.ruleDedups = make(map[string]*RuleDedup)
+	p.ruleCollects = make(map[string]*RuleCollect)
+	p.ruleRetries = make(map[string]*RuleRetry)
+	p.ruleSettingsLock.Unlock()
+
+	// Cancel all pending delayed events
+
+	p.timers.Clear()
 
 	return nil
 }
@@ -227,141 +581,662 @@ func (p *eventProcessor) AddRule(rule *Rule) error {
 	p.triggeringCache = nil
 	p.triggeringCacheLock.Unlock()
 
+	p.ruleIndexLock.Lock()
+	defer p.ruleIndexLock.Unlock()
+
 	return p.ruleIndex.AddRule(rule)
 }
 
 /*
-Rules returns all loaded rules.
+InsertRule adds a new rule to the processor. Unlike AddRule the processor
+does not need to be stopped.
 */
-func (p *eventProcessor) Rules() map[string]*Rule {
-	return p.ruleIndex.Rules()
+func (p *eventProcessor) InsertRule(rule *Rule) error {
+	return p.rebuildIndex(rule, "")
 }
 
 /*
-Start starts this processor.
+RemoveRule removes a loaded rule from the processor. The processor does not
+need to be stopped. Events which have been collected by the rule are discarded.
 */
-func (p *eventProcessor) Start() {
-	p.pool.SetWorkerCount(p.workerCount, false)
-}
+func (p *eventProcessor) RemoveRule(name string) error {
+	if _, ok := p.index().Rules()[name]; !ok {
+		return fmt.Errorf("Unknown rule: %v", name)
+	}
 
-/*
-Finish will finish all remaining tasks and then stop the processor.
-*/
-func (p *eventProcessor) Finish() {
-	p.pool.JoinAll()
-}
+	if err := p.rebuildIndex(nil, name); err != nil {
+		return err
+	}
 
-/*
-Stopped returns if the processor is stopped.
-*/
-func (p *eventProcessor) Stopped() bool {
-	return p.pool.Status() == pool.StatusStopped
-}
+	// Remove runtime rule settings
 
-/*
-Status returns the status of the processor (Running / Stopping / Stopped).
-*/
-func (p *eventProcessor) Status() string {
-	return p.pool.Status()
+	p.ruleSettingsLock.Lock()
+	if collect, ok := p.ruleCollects[name]; ok {
+		collect.Flush()
+	}
+	delete(p.disabledRules, name)
+	delete(p.rulePriorities, name)
+	delete(p.ruleBreakers, name)
+	delete(p.ruleDedups, name)
+	delete(p.ruleCollects, name)
+	delete(p.ruleRetries, name)
+	p.ruleSettingsLock.Unlock()
+
+	return nil
 }
 
 /*
-NewRootMonitor creates a new root monitor for this processor. This monitor is used to add initial
-root events.
+rebuildIndex replaces the rule index with a new index which contains all
+current rules except a removed rule plus an optional new rule. The current
+index is not modified so events which are currently processed can still use it.
 */
-func (p *eventProcessor) NewRootMonitor(context map[string]interface{}, scope *RuleScope) *RootMonitor {
+func (p *eventProcessor) rebuildIndex(add *Rule, remove string) error {
+	p.ruleIndexLock.Lock()
+	defer p.ruleIndexLock.Unlock()
 
-	if scope == nil {
-		scope = NewRuleScope(map[string]bool{
-			"": true, // Default root monitor has global scope
-		})
+	rules := p.ruleIndex.Rules()
+	names := make([]string, 0, len(rules))
+
+	for name := range rules {
+		if name != remove {
+			names = append(names, name)
+		}
 	}
 
-	return newRootMonitor(context, scope, p.messageQueue)
+	sort.Strings(names)
+
+	index := NewRuleIndex()
+
+	for _, name := range names {
+		if err := index.AddRule(rules[name]); err != nil {
+			return err
+		}
+	}
+
+	if add != nil {
+		if err := index.AddRule(add); err != nil {
+			return err
+		}
+	}
+
+	p.ruleIndex = index
+
+	// Invalidate triggering cache
+
+	p.triggeringCacheLock.Lock()
+	p.triggeringCache = nil
+	p.triggeringCacheLock.Unlock()
+
+	return nil
 }
 
 /*
-SetRootMonitorErrorObserver specifies an observer which is triggered
-when a root monitor of this processor has finished and returns errors.
-By default this is set to nil (no observer).
+index returns the current rule index.
 */
-func (p *eventProcessor) SetRootMonitorErrorObserver(rmErrorObserver func(rm *RootMonitor)) {
-	p.rmErrorObserver = rmErrorObserver
+func (p *eventProcessor) index() RuleIndex {
+	p.ruleIndexLock.RLock()
+	defer p.ruleIndexLock.RUnlock()
+
+	return p.ruleIndex
 }
 
 /*
-SetFailOnFirstErrorInTriggerSequence sets the behavior when rules return errors.
-If set to false (default) then all rules in a trigger sequence for a specific event
-are executed. If set to true then the first rule which returns an error will stop
-the trigger sequence. Events which have been added by the failing rule are still processed.
+Rules returns all loaded rules.
 */
-func (p *eventProcessor) SetFailOnFirstErrorInTriggerSequence(v bool) {
-	p.failOnFirstError = v
+func (p *eventProcessor) Rules() map[string]*Rule {
+	return p.index().Rules()
 }
 
 /*
-Notify the root monitor error observer that an error occurred.
+SetRuleEnabled enables or disables a loaded rule. Disabled rules do not
+trigger and do not suppress other rules. Rules can be enabled or disabled
+while the processor is running.
 */
-func (p *eventProcessor) notifyRootMonitorErrors(rm *RootMonitor) {
-	if p.rmErrorObserver != nil {
-		p.rmErrorObserver(rm)
+func (p *eventProcessor) SetRuleEnabled(name string, enabled bool) error {
+	if _, ok := p.index().Rules()[name]; !ok {
+		return fmt.Errorf("Unknown rule: %v", name)
+	}
+
+	p.ruleSettingsLock.Lock()
+	defer p.ruleSettingsLock.Unlock()
+
+	if enabled {
+		delete(p.disabledRules, name)
+	} else {
+		p.disabledRules[name] = true
 	}
+
+	return nil
 }
 
 /*
-AddEventAndWait adds a new event to the processor and waits for the resulting event cascade
-to finish. If a monitor is passed then it must be a RootMonitor.
+SetRulePriority changes the priority of a loaded rule. The priority can be
+changed while the processor is running.
 */
-func (p *eventProcessor) AddEventAndWait(event *Event, monitor *RootMonitor) (Monitor, error) {
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	if monitor == nil {
-		monitor = p.NewRootMonitor(nil, nil)
+func (p *eventProcessor) SetRulePriority(name string, priority int) error {
+	if _, ok := p.index().Rules()[name]; !ok {
+		return fmt.Errorf("Unknown rule: %v", name)
 	}
 
-	p.messageQueue.AddObserver(MessageRootMonitorFinished, monitor,
-		func(event string, eventSource interface{}) {
+	p.ruleSettingsLock.Lock()
+	defer p.ruleSettingsLock.Unlock()
 
-			// Everything has finished
+	p.rulePriorities[name] = priority
 
-			wg.Done()
+	return nil
+}
 
-			p.messageQueue.RemoveObservers(event, eventSource)
-		})
+/*
+RuleSettings returns if a loaded rule is enabled and its current priority
+(including changes which were made at runtime).
+*/
+func (p *eventProcessor) RuleSettings(name string) (bool, int, error) {
+	rule, ok := p.index().Rules()[name]
 
-	resMonitor, err := p.AddEvent(event, monitor)
+	if !ok {
+		return false, 0, fmt.Errorf("Unknown rule: %v", name)
+	}
 
-	if resMonitor == nil {
+	p.ruleSettingsLock.RLock()
+	defer p.ruleSettingsLock.RUnlock()
 
-		// Event was not added
+	priority, ok := p.rulePriorities[name]
+	if !ok {
+		priority = rule.Priority
+	}
 
-		p.messageQueue.RemoveObservers(MessageRootMonitorFinished, monitor)
+	return !p.disabledRules[name], priority, nil
+}
 
-	} else {
+/*
+SetRuleBreaker sets the circuit breaker of a loaded rule. The same breaker can
+be set for several rules. A nil value removes the breaker of the rule. Breakers
+can be set while the processor is running.
+*/
+func (p *eventProcessor) SetRuleBreaker(name string, breaker *RuleBreaker) error {
+	if _, ok := p.index().Rules()[name]; !ok {
+		return fmt.Errorf("Unknown rule: %v", name)
+	}
 
-		// Event was added now wait for it to finish
+	p.ruleSettingsLock.Lock()
+	defer p.ruleSettingsLock.Unlock()
 
-		wg.Wait()
+	if breaker == nil {
+		delete(p.ruleBreakers, name)
+	} else {
+		p.ruleBreakers[name] = breaker
 	}
 
-	return resMonitor, err
+	return nil
 }
 
 /*
-AddEvent adds a new event to the processor. Returns the monitor if the event
-triggered a rule and nil if the event was skipped.
+SetRuleDedup sets the deduplication of a loaded rule. The rule ignores events
+which are duplicates of an event it has seen within the time window of the
+deduplication. A nil value removes the deduplication of the rule.
 */
-func (p *eventProcessor) AddEvent(event *Event, eventMonitor Monitor) (Monitor, error) {
+func (p *eventProcessor) SetRuleDedup(name string, dedup *RuleDedup) error {
+	if _, ok := p.index().Rules()[name]; !ok {
+		return fmt.Errorf("Unknown rule: %v", name)
+	}
 
-	// Check that the thread pool is running
+	p.ruleSettingsLock.Lock()
+	defer p.ruleSettingsLock.Unlock()
 
-	if s := p.pool.Status(); s == pool.StatusStopped || s == pool.StatusStopping {
+	if dedup == nil {
+		delete(p.ruleDedups, name)
+	} else {
+		p.ruleDedups[name] = dedup
+	}
+
+	return nil
+}
+
+/*
+SetRuleCollect sets the aggregation of events of a loaded rule. The rule
+collects all matching events of a time window and handles them at once. A nil
+value removes the aggregation of the rule. Events which have already been
+collected are discarded.
+*/
+func (p *eventProcessor) SetRuleCollect(name string, collect *RuleCollect) error {
+	if _, ok := p.index().Rules()[name]; !ok {
+		return fmt.Errorf("Unknown rule: %v", name)
+	}
+
+	p.ruleSettingsLock.Lock()
+	defer p.ruleSettingsLock.Unlock()
+
+	if old, ok := p.ruleCollects[name]; ok && old != collect {
+		old.Flush()
+	}
+
+	if collect == nil {
+		delete(p.ruleCollects, name)
+	} else {
+		p.ruleCollects[name] = collect
+	}
+
+	return nil
+}
+
+/*
+SetRuleRetry sets the retry policy of a loaded rule. The action of the rule is
+run again if it returns an error. A nil value removes the retry policy of the
+rule.
+*/
+func (p *eventProcessor) SetRuleRetry(name string, retry *RuleRetry) error {
+	if _, ok := p.index().Rules()[name]; !ok {
+		return fmt.Errorf("Unknown rule: %v", name)
+	}
+
+	p.ruleSettingsLock.Lock()
+	defer p.ruleSettingsLock.Unlock()
+
+	if retry == nil {
+		delete(p.ruleRetries, name)
+	} else {
+		p.ruleRetries[name] = retry
+	}
+
+	return nil
+}
+
+/*
+Start starts this processor.
+*/
+func (p *eventProcessor) Start() {
+	p.shutdownLock.Lock()
+	if p.shuttingDown {
+		p.shuttingDown = false
+		p.triggerStop = make(chan struct{})
+	}
+	p.shutdownLock.Unlock()
+
+	p.workerCountLock.Lock()
+	defer p.workerCountLock.Unlock()
+
+	p.pool.SetWorkerCount(p.workerCount, false)
+}
+
+/*
+Finish will finish all remaining tasks and then stop the processor.
+*/
+func (p *eventProcessor) Finish() {
+	p.pool.JoinAll()
+}
+
+/*
+Shutdown stops accepting new root events and waits for all running event
+cascades and registered triggers to finish before stopping the processor.
+Waiting is bounded by the given context. Pending delayed events and open
+collect windows are dropped. Returns a ShutdownError if work was left over.
+*/
+func (p *eventProcessor) Shutdown(ctx context.Context) error {
+	var dropped int
+
+	p.shutdownLock.Lock()
+
+	if !p.shuttingDown {
+
+		if p.pool.Status() == pool.StatusStopped {
+			p.shutdownLock.Unlock()
+			return nil
+		}
+
+		p.shuttingDown = true
+		close(p.triggerStop)
+
+		// Drop all pending delayed events
+
+		dropped = p.timers.Pending()
+		p.timers.Clear()
+
+		// Wait for triggers to stop and then for all running cascades to finish
+
+		done := make(chan struct{})
+		p.shutdownDone = done
+
+		go func() {
+			p.triggers.Wait()
+			p.pool.JoinAll()
+			close(done)
+		}()
+	}
+
+	done := p.shutdownDone
+
+	p.shutdownLock.Unlock()
+
+	select {
+	case <-done:
+		if dropped > 0 {
+			return &ShutdownError{0, 0, dropped, nil}
+		}
+		return nil
+
+	case <-ctx.Done():
+	}
+
+	p.shutdownLock.Lock()
+	triggers := p.triggerCount
+	p.shutdownLock.Unlock()
+
+	return &ShutdownError{p.pool.State()["TaskQueueSize"].(int), triggers, dropped, ctx.Err()}
+}
+
+/*
+RegisterTrigger registers a goroutine which adds root events to the processor
+(e.g. a pulse trigger). The returned channel is closed once the processor
+shuts down. The returned function must be called once the goroutine has stopped.
+*/
+func (p *eventProcessor) RegisterTrigger() (<-chan struct{}, func()) {
+	var once sync.Once
+
+	p.shutdownLock.Lock()
+	defer p.shutdownLock.Unlock()
+
+	stop := p.triggerStop
+
+	if p.shuttingDown {
+		return stop, func() {}
+	}
+
+	p.triggerCount++
+	p.triggers.Add(1)
+
+	return stop, func() {
+		once.Do(func() {
+			p.shutdownLock.Lock()
+			p.triggerCount--
+			p.shutdownLock.Unlock()
+
+			p.triggers.Done()
+		})
+	}
+}
+
+/*
+isShuttingDown returns if the processor is shutting down.
+*/
+func (p *eventProcessor) isShuttingDown() bool {
+	p.shutdownLock.Lock()
+	defer p.shutdownLock.Unlock()
+	return p.shuttingDown
+}
+
+/*
+Stopped returns if the processor is stopped.
+*/
+func (p *eventProcessor) Stopped() bool {
+	return p.pool.Status() == pool.StatusStopped
+}
+
+/*
+Status returns the status of the processor (Running / Stopping / Stopped).
+A processor which is shutting down is reported as stopping.
+*/
+func (p *eventProcessor) Status() string {
+	status := p.pool.Status()
+
+	if status == pool.StatusRunning && p.isShuttingDown() {
+		status = pool.StatusStopping
+	}
+
+	return status
+}
+
+/*
+NewRootMonitor creates a new root monitor for this processor. This monitor is used to add initial
+root events.
+*/
+func (p *eventProcessor) NewRootMonitor(context map[string]interface{}, scope *RuleScope) *RootMonitor {
+
+	if scope == nil {
+		scope = NewRuleScope(map[string]bool{
+			"": true, // Default root monitor has global scope
+		})
+	}
+
+	return newRootMonitor(context, scope, p.messageQueue)
+}
+
+/*
+SetRootMonitorErrorObserver specifies an observer which is triggered
+when a root monitor of this processor has finished and returns errors.
+By default this is set to nil (no observer).
+*/
+func (p *eventProcessor) SetRootMonitorErrorObserver(rmErrorObserver func(rm *RootMonitor)) {
+	p.rmErrorObserver = rmErrorObserver
+}
+
+/*
+SetFailOnFirstErrorInTriggerSequence sets the behavior when rules return errors.
+If set to false (default) then all rules in a trigger sequence for a specific event
+are executed. If set to true then the first rule which returns an error will stop
+the trigger sequence. Events which have been added by the failing rule are still processed.
+*/
+func (p *eventProcessor) SetFailOnFirstErrorInTriggerSequence(v bool) {
+	p.failOnFirstError = v
+}
+
+/*
+SetQueueClasses sets classes of event kinds which are processed from
+their own queues. Each class is a list of kind matches (e.g. alert.*).
+Tasks of a class are processed before tasks of all following classes
+independent of the priorities of their monitors. Events which do not
+match any class have the lowest priority. A class with pending tasks is
+picked at the latest after it was skipped starvationLimit times in a
+row (0 means no starvation protection).
+*/
+func (p *eventProcessor) SetQueueClasses(classes [][]string, starvationLimit int) {
+	p.queue.SetClasses(classes, starvationLimit)
+}
+
+/*
+SetCascadeLimits sets the limits of event cascades. An event cascade is
+aborted if an event would exceed the maximum depth of the cascade or if
+an event kind re-triggers itself more than maxKindRepeat times in a row.
+A limit of 0 disables the check (default).
+*/
+func (p *eventProcessor) SetCascadeLimits(maxDepth int, maxKindRepeat int) {
+	p.maxCascadeDepth = maxDepth
+	p.maxKindRepeat = maxKindRepeat
+}
+
+/*
+checkCascadeLimits checks if an event which is added as a child of a given
+parent monitor exceeds the limits of its event cascade. The event cascade is
+aborted once a limit has been exceeded.
+*/
+func (p *eventProcessor) checkCascadeLimits(event *Event, parent *monitorBase) error {
+	rm := parent.rootMonitor
+
+	err := rm.Aborted()
+
+	if err == nil && p.maxCascadeDepth > 0 && parent.depth+1 > p.maxCascadeDepth {
+		err = fmt.Errorf("%w: Event %v has depth %v (limit is %v)",
+			ErrCascadeDepth, event.Name(), parent.depth+1, p.maxCascadeDepth)
+	}
+
+	if err == nil && p.maxKindRepeat > 0 {
+		kind := strings.Join(event.Kind(), RuleKindSeparator)
+		count := 1
+
+		// Count the direct ancestors which have the same event kind
+
+		for m := parent; m != nil && m.event != nil &&
+			strings.Join(m.event.Kind(), RuleKindSeparator) == kind; m = m.Parent {
+			count++
+		}
+
+		if count > p.maxKindRepeat {
+			err = fmt.Errorf("%w: Event kind %v was added %v times in a row (limit is %v)",
+				ErrCascadeLoop, kind, count, p.maxKindRepeat)
+		}
+	}
+
+	if err != nil {
+		rm.abort(err)
+	}
+
+	return err
+}
+
+/*
+rejectEvent finishes the monitor of an event which was rejected because its
+event cascade was aborted. The reason is recorded as error of the event.
+*/
+func (p *eventProcessor) rejectEvent(event *Event, eventMonitor Monitor, reason error) {
+	EventTracer.record(event, "eventProcessor.rejectEvent", "Event cascade was aborted: ", reason)
+
+	eventMonitor.SetErrors(&TaskError{map[string]error{ErrorKeyCascadeAborted: reason}, event, eventMonitor})
+	eventMonitor.Skip(event)
+}
+
+/*
+Notify the root monitor error observer that an error occurred.
+*/
+func (p *eventProcessor) notifyRootMonitorErrors(rm *RootMonitor) {
+	if p.rmErrorObserver != nil {
+		p.rmErrorObserver(rm)
+	}
+}
+
+/*
+AddListener adds a listener which is notified about lifecycle events
+of this processor (e.g. queued events, rule executions, finished event
+cascades and errors).
+*/
+func (p *eventProcessor) AddListener(listener ProcessorListener) {
+	p.listenersLock.Lock()
+	defer p.listenersLock.Unlock()
+
+	listeners := make([]ProcessorListener, 0, len(p.listeners)+1)
+	p.listeners = append(append(listeners, p.listeners...), listener)
+}
+
+/*
+RemoveListener removes a previously added listener.
+*/
+func (p *eventProcessor) RemoveListener(listener ProcessorListener) {
+	p.listenersLock.Lock()
+	defer p.listenersLock.Unlock()
+
+	listeners := make([]ProcessorListener, 0, len(p.listeners))
+
+	for _, l := range p.listeners {
+		if l != listener {
+			listeners = append(listeners, l)
+		}
+	}
+
+	p.listeners = listeners
+}
+
+/*
+getListeners returns the current listeners. The returned slice must not be
+modified.
+*/
+func (p *eventProcessor) getListeners() []ProcessorListener {
+	p.listenersLock.RLock()
+	defer p.listenersLock.RUnlock()
+
+	return p.listeners
+}
+
+/*
+notifyEventQueued notifies all listeners that an event was queued.
+*/
+func (p *eventProcessor) notifyEventQueued(event *Event, monitor Monitor) {
+	for _, l := range p.getListeners() {
+		l.OnEventQueued(event, monitor)
+	}
+}
+
+/*
+notifyTaskError notifies all listeners about errors of a task.
+*/
+func (p *eventProcessor) notifyTaskError(err *TaskError) {
+	for _, l := range p.getListeners() {
+		l.OnError(err)
+	}
+}
+
+/*
+AddEventAndWait adds a new event to the processor and waits for the resulting event cascade
+to finish. If a monitor is passed then it must be a RootMonitor.
+*/
+func (p *eventProcessor) AddEventAndWait(event *Event, monitor *RootMonitor) (Monitor, error) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	if monitor == nil {
+		monitor = p.NewRootMonitor(nil, nil)
+	}
+
+	p.messageQueue.AddObserver(MessageRootMonitorFinished, monitor,
+		func(event string, eventSource interface{}) {
+
+			// Everything has finished
+
+			wg.Done()
+
+			p.messageQueue.RemoveObservers(event, eventSource)
+		})
+
+	resMonitor, err := p.AddEvent(event, monitor)
+
+	if resMonitor == nil {
+
+		// Event was not added
+
+		p.messageQueue.RemoveObservers(MessageRootMonitorFinished, monitor)
+
+	} else {
+
+		// Event was added now wait for it to finish
+
+		wg.Wait()
+	}
+
+	return resMonitor, err
+}
+
+/*
+AddEvent adds a new event to the processor. Returns the monitor if the event
+triggered a rule and nil if the event was skipped.
+*/
+func (p *eventProcessor) AddEvent(event *Event, eventMonitor Monitor) (Monitor, error) {
+
+	_, isRoot := eventMonitor.(*RootMonitor)
+	isRoot = isRoot || eventMonitor == nil
+
+	// Root events are not accepted while the processor is shutting down - running
+	// cascades can still add events while the thread pool is stopping
+
+	shuttingDown := p.isShuttingDown()
+
+	if isRoot && shuttingDown {
+		return nil, fmt.Errorf("Cannot add root event if the processor is shutting down")
+	}
+
+	// Check that the thread pool is running
+
+	if s := p.pool.Status(); s == pool.StatusStopped || (s == pool.StatusStopping && !shuttingDown) {
 		return nil, fmt.Errorf("Cannot add event if the processor is stopping or not running")
 	}
 
 	EventTracer.record(event, "eventProcessor.AddEvent", "Event added to the processor")
 
+	// Check that the event does not exceed the limits of its event cascade
+
+	if child, ok := eventMonitor.(*ChildMonitor); ok {
+		if err := p.checkCascadeLimits(event, child.Parent); err != nil {
+			p.rejectEvent(event, eventMonitor, err)
+			return nil, err
+		}
+	}
+
 	// First check if the event is triggering any rules at all
 
 	if !p.IsTriggering(event) {
@@ -382,30 +1257,173 @@ func (p *eventProcessor) AddEvent(event *Event, eventMonitor Monitor) (Monitor,
 	}
 
 	if rootMonitor, ok := eventMonitor.(*RootMonitor); ok {
-		p.messageQueue.AddObserver(MessageRootMonitorFinished, rootMonitor,
-			func(event string, eventSource interface{}) {
-
-				// Call finish handler if there is one
-
-				if rm := eventSource.(*RootMonitor); rm.finished != nil {
-					rm.finished(p)
-				}
-
-				p.messageQueue.RemoveObservers(event, eventSource)
-			})
+		p.observeRootMonitor(rootMonitor)
 	}
 
 	eventMonitor.Activate(event)
 
 	EventTracer.record(event, "eventProcessor.AddEvent", "Adding task to thread pool")
 
+	p.notifyEventQueued(event, eventMonitor)
+
 	// Kick off event processing (see Processor.ProcessEvent)
 
-	p.pool.AddTask(&Task{p, eventMonitor, event})
+	p.pool.AddTask(newTask(p, eventMonitor, event, nil))
 
 	return eventMonitor, nil
 }
 
+/*
+observeRootMonitor calls the finish handler of a given root monitor once its
+event cascade has finished.
+*/
+func (p *eventProcessor) observeRootMonitor(rootMonitor *RootMonitor) {
+	p.messageQueue.AddObserver(MessageRootMonitorFinished, rootMonitor,
+		func(event string, eventSource interface{}) {
+
+			// Call finish handler if there is one
+
+			if rm := eventSource.(*RootMonitor); rm.finished != nil {
+				rm.finished(p)
+			}
+
+			p.messageQueue.RemoveObservers(event, eventSource)
+		})
+}
+
+/*
+AddEvents adds several events to the processor. Each event is handled with a
+new child monitor of the given parent monitor which must be active (e.g. the
+monitor of a rule which fans out events). If no parent monitor is given then
+each event gets a new root monitor. Returns the monitors of the events - the
+monitor of an event which was skipped is nil.
+*/
+func (p *eventProcessor) AddEvents(events []*Event, parentMonitor Monitor) ([]Monitor, error) {
+	var triggering []*Event
+	var monitors []Monitor
+
+	shuttingDown := p.isShuttingDown()
+
+	if parentMonitor == nil && shuttingDown {
+		return nil, fmt.Errorf("Cannot add root event if the processor is shutting down")
+	}
+
+	// Check that the thread pool is running
+
+	if s := p.pool.Status(); s == pool.StatusStopped || (s == pool.StatusStopping && !shuttingDown) {
+		return nil, fmt.Errorf("Cannot add event if the processor is stopping or not running")
+	}
+
+	if parentMonitor != nil && !parentMonitor.IsActivated() {
+		return nil, fmt.Errorf("Parent monitor must be active")
+	}
+
+	res := make([]Monitor, len(events))
+	pos := make([]int, 0, len(events))
+
+	// Only events which trigger rules are added
+
+	for i, event := range events {
+		EventTracer.record(event, "eventProcessor.AddEvents", "Event added to the processor")
+
+		if !p.IsTriggering(event) {
+			EventTracer.record(event, "eventProcessor.AddEvents", "Event was skipped")
+			continue
+		}
+
+		triggering = append(triggering, event)
+		pos = append(pos, i)
+	}
+
+	// Create and activate the monitors of all events
+
+	if parentMonitor == nil {
+		for _, event := range triggering {
+			rootMonitor := p.NewRootMonitor(nil, nil)
+			p.observeRootMonitor(rootMonitor)
+			rootMonitor.Activate(event)
+			monitors = append(monitors, rootMonitor)
+		}
+
+	} else {
+		var parent *monitorBase
+
+		switch m := parentMonitor.(type) {
+		case *RootMonitor:
+			parent = m.monitorBase
+		case *ChildMonitor:
+			parent = m.monitorBase
+		}
+
+		if parent != nil {
+
+			// Check that no event exceeds the limits of the event cascade
+
+			for _, event := range triggering {
+				if err := p.checkCascadeLimits(event, parent); err != nil {
+					p.rejectEvent(event, parentMonitor.NewChildMonitor(0), err)
+					return nil, err
+				}
+			}
+
+			monitors = parent.rootMonitor.newActiveChildMonitors(parent, 0, triggering)
+
+		} else {
+			for _, event := range triggering {
+				m := parentMonitor.NewChildMonitor(0)
+				m.Activate(event)
+				monitors = append(monitors, m)
+			}
+		}
+	}
+
+	// Kick off event processing (see Processor.ProcessEvent)
+
+	tasks := make([]pool.Task, len(triggering))
+
+	for i, event := range triggering {
+		EventTracer.record(event, "eventProcessor.AddEvents", "Adding task to thread pool")
+
+		p.notifyEventQueued(event, monitors[i])
+
+		tasks[i] = newTask(p, monitors[i], event, nil)
+		res[pos[i]] = monitors[i]
+	}
+
+	p.pool.AddTasks(tasks)
+
+	return res, nil
+}
+
+/*
+AddEventAfter adds a new event to the processor once a given delay has passed.
+The event is added with a new root monitor using the given scope. Returns an
+id which can be used to cancel the event.
+*/
+func (p *eventProcessor) AddEventAfter(delay time.Duration, event *Event, scope *RuleScope) uint64 {
+
+	EventTracer.record(event, "eventProcessor.AddEventAfter", "Event scheduled")
+
+	return p.timers.Schedule(delay, func() {
+
+		// Events which become due while the processor is stopping or stopped are dropped
+
+		if s := p.pool.Status(); s != pool.StatusStopped && s != pool.StatusStopping {
+			if _, err := p.AddEvent(event, p.NewRootMonitor(nil, scope)); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Could not add delayed event %v: %v\n", event.Name(), err)
+			}
+		}
+	})
+}
+
+/*
+CancelEvent cancels an event which was added with AddEventAfter. Returns
+false if the event was not pending anymore.
+*/
+func (p *eventProcessor) CancelEvent(id uint64) bool {
+	return p.timers.Cancel(id)
+}
+
 /*
 IsTriggering checks if a given event triggers a loaded rule. This does not the
 actual state matching for speed.
@@ -425,7 +1443,7 @@ func (p *eventProcessor) IsTriggering(event *Event) bool {
 	name := event.Name()
 
 	if res, ok = p.triggeringCache[name]; !ok {
-		res = p.ruleIndex.IsTriggering(event)
+		res = p.index().IsTriggering(event)
 		p.triggeringCache[name] = res
 	}
 
@@ -437,20 +1455,75 @@ ProcessEvent processes an event by determining which rules trigger and match
 the given event.
 */
 func (p *eventProcessor) ProcessEvent(tid uint64, event *Event, parent Monitor) map[string]error {
+
+	EventTracer.record(event, "eventProcessor.ProcessEvent", "Processing event")
+
+	rulesExecuting := p.selectRules(event, parent.Scope(), false)
+
+	// Run rules which are not suppressed
+
+	errors := make(map[string]error)
+
+	EventTracer.record(event, "eventProcessor.ProcessEvent", "Running rules: ", rulesExecuting)
+
+	recordRulesTriggered(parent, rulesExecuting)
+
+	for _, rule := range rulesExecuting {
+		if err := p.runRule(tid, rule, event, parent); err != nil {
+			errors[rule.Name] = err
+		}
+		if p.failOnFirstError && len(errors) > 0 {
+			break
+		}
+	}
+
+	return errors
+}
+
+/*
+DryRun returns the rules which would run for a given event in the order
+of their execution without running them. Scope matches are checked against
+a given scope (nil is the global scope). Rules which collect events are
+included. Deduplication is checked without recording the event.
+*/
+func (p *eventProcessor) DryRun(event *Event, scope *RuleScope) []*Rule {
+
+	if scope == nil {
+		scope = NewRuleScope(map[string]bool{
+			"": true,
+		})
+	}
+
+	return p.selectRules(event, scope, true)
+}
+
+/*
+selectRules determines the rules which run for a given event in a given scope
+ordered by their priority. A dry run does not change the state of rules which
+deduplicate or collect events.
+*/
+func (p *eventProcessor) selectRules(event *Event, scope *RuleScope, dryRun bool) []*Rule {
 	var rulesTriggering []*Rule
 	var rulesExecuting []*Rule
 
-	scope := parent.Scope()
-	ruleCandidates := p.ruleIndex.Match(event)
+	ruleCandidates := p.index().Match(event)
 	suppressedRules := make(map[string]bool)
 
-	EventTracer.record(event, "eventProcessor.ProcessEvent", "Processing event")
+	// Remove candidates which are out of scope or have been disabled
 
-	// Remove candidates which are out of scope
+	p.ruleSettingsLock.RLock()
 
 	for _, ruleCandidate := range ruleCandidates {
 
-		if scope.IsAllowedAll(ruleCandidate.ScopeMatch) {
+		if scope.IsAllowedAll(ruleCandidate.ScopeMatch) && !p.disabledRules[ruleCandidate.Name] {
+
+			// Apply priorities which have been changed at runtime
+
+			if priority, ok := p.rulePriorities[ruleCandidate.Name]; ok && priority != ruleCandidate.Priority {
+				ruleCandidate = ruleCandidate.CopyAs(ruleCandidate.Name)
+				ruleCandidate.Priority = priority
+			}
+
 			rulesTriggering = append(rulesTriggering, ruleCandidate)
 
 			// Build up a suppression list
@@ -467,36 +1540,205 @@ func (p *eventProcessor) ProcessEvent(tid uint64, event *Event, parent Monitor)
 		if _, ok := suppressedRules[ruleTriggers.Name]; ok {
 			continue
 		}
+
+		// Remove rules for which the event is a duplicate
+
+		if dedup := p.ruleDedups[ruleTriggers.Name]; dedup != nil && dedup.checkDuplicate(event, !dryRun) {
+			if !dryRun {
+				EventTracer.record(event, "eventProcessor.ProcessEvent", "Duplicate event for rule: ", ruleTriggers.Name)
+			}
+			continue
+		}
+
+		// Collect events for rules which aggregate events over a time window
+
+		if collect := p.ruleCollects[ruleTriggers.Name]; collect != nil && !dryRun {
+			EventTracer.record(event, "eventProcessor.ProcessEvent", "Event collected for rule: ", ruleTriggers.Name)
+
+			if collect.Add(event) {
+				p.scheduleCollected(ruleTriggers, collect, scope)
+			}
+			continue
+		}
+
 		rulesExecuting = append(rulesExecuting, ruleTriggers)
 	}
 
+	p.ruleSettingsLock.RUnlock()
+
 	// Sort rules according to their priority (0 is the highest)
 
 	SortRuleSlice(rulesExecuting)
 
-	// Run rules which are not suppressed
+	return rulesExecuting
+}
+
+/*
+scheduleCollected schedules the processing of all events which a rule collects
+within its time window.
+*/
+func (p *eventProcessor) scheduleCollected(rule *Rule, collect *RuleCollect, scope *RuleScope) {
+	p.timers.Schedule(collect.Window, func() {
+		events := collect.Flush()
+
+		// Collected events are dropped if the processor is stopping or stopped
+		// or if the rule has been disabled
+
+		if s := p.pool.Status(); len(events) == 0 || s == pool.StatusStopped || s == pool.StatusStopping {
+			return
+		}
+
+		p.ruleSettingsLock.RLock()
+		disabled := p.disabledRules[rule.Name]
+		p.ruleSettingsLock.RUnlock()
+
+		if disabled {
+			return
+		}
+
+		event := NewCollectedEvent(events)
+		monitor := p.NewRootMonitor(nil, scope)
+
+		EventTracer.record(event, "eventProcessor.scheduleCollected", "Adding collected events for rule: ", rule.Name)
+
+		monitor.Activate(event)
+
+		p.notifyEventQueued(event, monitor)
+
+		p.pool.AddTask(newTask(p, monitor, event, rule))
+	})
+}
 
+/*
+processRule processes an event by running only a given rule. This function
+must receive a unique thread ID from the executing thread.
+*/
+func (p *eventProcessor) processRule(tid uint64, rule *Rule, event *Event, parent Monitor) map[string]error {
 	errors := make(map[string]error)
 
-	EventTracer.record(event, "eventProcessor.ProcessEvent", "Running rules: ", rulesExecuting)
+	EventTracer.record(event, "eventProcessor.processRule", "Running rule: ", rule.Name)
 
-	for _, rule := range rulesExecuting {
-		if err := rule.Action(p, parent, event, tid); err != nil {
-			errors[rule.Name] = err
+	recordRulesTriggered(parent, []*Rule{rule})
+
+	if err := p.runRule(tid, rule, event, parent); err != nil {
+		errors[rule.Name] = err
+	}
+
+	return errors
+}
+
+/*
+runRule runs the action of a given rule and notifies all listeners.
+*/
+func (p *eventProcessor) runRule(tid uint64, rule *Rule, event *Event, parent Monitor) error {
+	listeners := p.getListeners()
+
+	for _, l := range listeners {
+		l.OnRuleStart(rule, event, parent)
+	}
+
+	err := p.runAction(tid, rule, event, parent)
+
+	if err != nil {
+		p.ruleSettingsLock.RLock()
+		retry := p.ruleRetries[rule.Name]
+		p.ruleSettingsLock.RUnlock()
+
+		if retry != nil && retry.Retries > 0 {
+			err = p.retryRule(tid, rule, retry, event, parent, err)
 		}
-		if p.failOnFirstError && len(errors) > 0 {
+	}
+
+	for _, l := range listeners {
+		l.OnRuleEnd(rule, event, parent, err)
+	}
+
+	return err
+}
+
+/*
+runAction runs the action of a rule. If the rule has a circuit breaker then the
+action is only run if the breaker allows it. An event is added to the event
+cascade if the result of the action opens or closes the breaker.
+*/
+func (p *eventProcessor) runAction(tid uint64, rule *Rule, event *Event, parent Monitor) error {
+	p.ruleSettingsLock.RLock()
+	breaker := p.ruleBreakers[rule.Name]
+	p.ruleSettingsLock.RUnlock()
+
+	if breaker == nil {
+		return rule.Action(p, parent, event, tid)
+	}
+
+	if !breaker.allow(p.clock.Now()) {
+		EventTracer.record(event, "eventProcessor.runAction", "Circuit breaker is open for rule: ", rule.Name)
+		return fmt.Errorf("%w: %v", ErrCircuitOpen, breaker.Name)
+	}
+
+	err := rule.Action(p, parent, event, tid)
+
+	if state := breaker.record(err, p.clock.Now()); state != "" {
+		EventTracer.record(event, "eventProcessor.runAction", "Circuit breaker changed state to ", state)
+
+		p.AddEvent(NewBreakerEvent(breaker, rule, err), parent.NewChildMonitor(0))
+	}
+
+	return err
+}
+
+/*
+retryRule runs the action of a rule again after it returned an error. The
+action is retried according to a given retry policy until it succeeds. If the
+action still fails after all retries then an event which reports the failure is
+added to the event cascade. Returns the error of the last run.
+*/
+func (p *eventProcessor) retryRule(tid uint64, rule *Rule, policy *RuleRetry,
+	event *Event, parent Monitor, err error) error {
+
+	for retry := 1; err != nil && retry <= policy.Retries; retry++ {
+
+		// Actions are not retried once the processor is stopping
+
+		if s := p.pool.Status(); s == pool.StatusStopping || s == pool.StatusStopped {
+			return err
+		}
+
+		EventTracer.record(event, "eventProcessor.retryRule", "Retrying rule: ", rule.Name)
+
+		<-p.clock.After(policy.Delay(retry))
+
+		// Retries stop once the circuit breaker of the rule is open
+
+		if err = p.runAction(tid, rule, event, parent); errors.Is(err, ErrCircuitOpen) {
 			break
 		}
 	}
 
-	return errors
+	if err != nil {
+		exhausted := NewRetryExhaustedEvent(rule, event, err, policy.Retries+1)
+
+		EventTracer.record(event, "eventProcessor.retryRule", "Retries exhausted for rule: ", rule.Name)
+
+		p.AddEvent(exhausted, parent.NewChildMonitor(0))
+	}
+
+	return err
+}
+
+/*
+recordRulesTriggered records in a monitor which rules handle its event.
+*/
+func recordRulesTriggered(m Monitor, rules []*Rule) {
+	if rr, ok := m.(interface{ rulesTriggered([]*Rule) }); ok {
+		rr.rulesTriggered(rules)
+	}
 }
 
 /*
 String returns a string representation the processor.
 */
 func (p *eventProcessor) String() string {
-	return fmt.Sprintf("EventProcessor %v (workers:%v)", p.ID(), p.workerCount)
+	return fmt.Sprintf("EventProcessor %v (workers:%v)", p.ID(), p.Workers())
 }
 
 // Unique id creation
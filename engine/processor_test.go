@@ -12,9 +12,12 @@ package engine
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -621,6 +624,52 @@ TestRule1
 		t.Error("Unexpected result:", log.String())
 		return
 	}
+
+	// The number of workers can be changed while the processor is running
+
+	proc.Start()
+	proc.SetWorkers(12)
+
+	if res := len(proc.ThreadPool().State()["TotalWorkerThreads"].([]uint64)); res != 12 || proc.Workers() != 12 {
+		t.Error("Unexpected number of workers:", res, proc.Workers())
+		return
+	}
+
+	proc.SetWorkers(0)
+	proc.Finish()
+
+	if res := proc.Workers(); res != 12 {
+		t.Error("Unexpected number of workers:", res)
+		return
+	}
+
+	// The number of workers can be changed concurrently
+
+	proc.Start()
+
+	var wg sync.WaitGroup
+
+	for i := 1; i <= 4; i++ {
+		wg.Add(1)
+
+		go func(count int) {
+			defer wg.Done()
+
+			proc.SetWorkers(count)
+			proc.Workers()
+			_ = proc.String()
+		}(i)
+	}
+
+	wg.Wait()
+
+	proc.SetWorkers(3)
+	proc.Finish()
+
+	if res := proc.Workers(); res != 3 {
+		t.Error("Unexpected number of workers:", res)
+		return
+	}
 }
 
 func TestProcessorSimpleErrorHandling(t *testing.T) {
@@ -860,3 +909,1252 @@ InitialEvent -> event2 -> event3 -> TestRule3 : testerror2]` {
 
 	proc.Finish()
 }
+
+func TestProcessorCollect(t *testing.T) {
+	var res []string
+	var lock sync.Mutex
+
+	proc := NewProcessor(1)
+
+	action := func(p Processor, m Monitor, e *Event, tid uint64) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if events, ok := e.State()["events"].([]interface{}); ok {
+			var names []string
+
+			for _, ce := range events {
+				names = append(names, fmt.Sprint(ce.(map[interface{}]interface{})["name"]))
+			}
+
+			res = append(res, fmt.Sprintf("collected %v %v", e.Name(), names))
+		} else {
+			res = append(res, e.Name())
+		}
+
+		if e.Name() == "event3" {
+			return fmt.Errorf("testerror")
+		}
+
+		return nil
+	}
+
+	proc.AddRule(&Rule{
+		Name:       "CollectRule",
+		KindMatch:  []string{"core.*"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action:     action,
+	})
+	proc.AddRule(&Rule{
+		Name:       "Rule",
+		KindMatch:  []string{"core.main"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action:     action,
+	})
+
+	if err := proc.SetRuleCollect("foo", nil); err == nil || err.Error() != "Unknown rule: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	errorutil.AssertOk(proc.SetRuleCollect("CollectRule", NewRuleCollect(50*time.Millisecond)))
+
+	var rmErrors []string
+
+	proc.SetRootMonitorErrorObserver(func(rm *RootMonitor) {
+		lock.Lock()
+		defer lock.Unlock()
+		rmErrors = append(rmErrors, fmt.Sprint(rm.AllErrors()))
+	})
+
+	proc.Start()
+
+	for _, name := range []string{"event1", "event2", "event3"} {
+		if _, err := proc.AddEventAndWait(NewEvent(name, []string{"core", "main"}, nil), nil); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	lock.Lock()
+	if fmt.Sprint(res) != "[event1 event2 event3]" {
+		t.Error("Unexpected result:", res)
+		lock.Unlock()
+		return
+	}
+	res = nil
+	lock.Unlock()
+
+	time.Sleep(150 * time.Millisecond)
+
+	// A new window is started by the next event
+
+	proc.AddEvent(NewEvent("event4", []string{"core", "other"}, nil), nil)
+
+	time.Sleep(150 * time.Millisecond)
+
+	proc.Finish()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if fmt.Sprint(res) != "[collected event1 [event1 event2 event3] collected event4 [event4]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if fmt.Sprint(rmErrors) != `[[Taskerror:
+event3 -> Rule : testerror]]` {
+		t.Error("Unexpected result:", rmErrors)
+		return
+	}
+
+	if s := proc.(*eventProcessor).ruleCollects["CollectRule"].String(); s != "Collect:50ms" {
+		t.Error("Unexpected result:", s)
+		return
+	}
+}
+
+func TestProcessorRuleSettings(t *testing.T) {
+	var res []string
+	var lock sync.Mutex
+
+	proc := NewProcessor(1)
+
+	for i, name := range []string{"Rule1", "Rule2", "Rule3"} {
+		var suppression []string
+
+		ruleName := name
+
+		if name == "Rule1" {
+			suppression = []string{"Rule3"}
+		}
+
+		proc.AddRule(&Rule{
+			Name:            name,
+			KindMatch:       []string{"core.*"},
+			ScopeMatch:      []string{},
+			StateMatch:      map[string]interface{}{},
+			Priority:        i,
+			SuppressionList: suppression,
+			Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+				lock.Lock()
+				defer lock.Unlock()
+				res = append(res, ruleName)
+				return nil
+			},
+		})
+	}
+
+	if err := proc.SetRuleEnabled("Rule4", false); err == nil || err.Error() != "Unknown rule: Rule4" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := proc.SetRulePriority("Rule4", 1); err == nil || err.Error() != "Unknown rule: Rule4" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	proc.Start()
+
+	run := func() string {
+		lock.Lock()
+		res = nil
+		lock.Unlock()
+
+		proc.AddEventAndWait(NewEvent("event", []string{"core", "main"}, nil), nil)
+
+		lock.Lock()
+		defer lock.Unlock()
+		return fmt.Sprint(res)
+	}
+
+	if r := run(); r != "[Rule1 Rule2]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	// A disabled rule does not trigger and does not suppress other rules
+
+	proc.SetRuleEnabled("Rule1", false)
+
+	if r := run(); r != "[Rule2 Rule3]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	proc.SetRulePriority("Rule3", -1)
+
+	if r := run(); r != "[Rule3 Rule2]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	proc.SetRuleEnabled("Rule1", true)
+
+	if r := run(); r != "[Rule1 Rule2]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	enabled, priority, err := proc.RuleSettings("Rule3")
+	if !enabled || priority != -1 || err != nil {
+		t.Error("Unexpected result:", enabled, priority, err)
+		return
+	}
+
+	if _, _, err := proc.RuleSettings("Rule4"); err == nil || err.Error() != "Unknown rule: Rule4" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Loaded rules are not changed
+
+	if p := proc.Rules()["Rule3"].Priority; p != 2 {
+		t.Error("Unexpected result:", p)
+		return
+	}
+
+	// Runtime settings are removed on reset
+
+	proc.Finish()
+	proc.Reset()
+
+	if err := proc.SetRuleEnabled("Rule1", false); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestProcessorDryRun(t *testing.T) {
+	var res []string
+	var lock sync.Mutex
+
+	proc := NewProcessor(1)
+
+	addRule := func(rule *Rule) {
+		ruleName := rule.Name
+
+		rule.KindMatch = []string{"core.*"}
+		rule.StateMatch = map[string]interface{}{}
+		if rule.ScopeMatch == nil {
+			rule.ScopeMatch = []string{}
+		}
+		rule.Action = func(p Processor, m Monitor, e *Event, tid uint64) error {
+			lock.Lock()
+			defer lock.Unlock()
+			res = append(res, ruleName)
+			return nil
+		}
+
+		proc.AddRule(rule)
+	}
+
+	addRule(&Rule{Name: "Rule1", Priority: 2, SuppressionList: []string{"Rule2"}})
+	addRule(&Rule{Name: "Rule2", Priority: 3})
+	addRule(&Rule{Name: "Rule3", Priority: 1, ScopeMatch: []string{"data.read"}})
+	addRule(&Rule{Name: "Rule4", Priority: 4})
+	addRule(&Rule{Name: "Rule5", Priority: 0})
+
+	proc.SetRuleDedup("Rule4", NewRuleDedup(time.Hour, nil))
+	proc.SetRuleCollect("Rule5", NewRuleCollect(time.Hour))
+
+	proc.Start()
+	defer proc.Finish()
+
+	names := func(rules []*Rule) string {
+		var ret []string
+		for _, r := range rules {
+			ret = append(ret, r.Name)
+		}
+		return fmt.Sprint(ret)
+	}
+
+	event := NewEvent("event", []string{"core", "main"}, nil)
+
+	if r := names(proc.DryRun(event, nil)); r != "[Rule5 Rule3 Rule1 Rule4]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	// Dry runs do not record events for deduplication
+
+	if r := names(proc.DryRun(event, NewRuleScope(map[string]bool{"data": false}))); r != "[Rule5 Rule1 Rule4]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	proc.SetRuleEnabled("Rule1", false)
+
+	if r := names(proc.DryRun(event, nil)); r != "[Rule5 Rule3 Rule2 Rule4]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	if err := proc.SetRuleDedup("foo", nil); err == nil || err.Error() != "Unknown rule: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	errorutil.AssertOk(proc.SetRuleDedup("Rule4", nil))
+
+	if res := len(proc.(*eventProcessor).ruleDedups); res != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+type testProcessorListener struct {
+	*BaseProcessorListener
+	res      []string
+	lock     sync.Mutex
+	finished chan bool
+}
+
+func (tl *testProcessorListener) record(s ...interface{}) {
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+	tl.res = append(tl.res, fmt.Sprint(s...))
+}
+
+func (tl *testProcessorListener) OnEventQueued(event *Event, monitor Monitor) {
+	tl.record("queued ", event.Name())
+}
+
+func (tl *testProcessorListener) OnRuleStart(rule *Rule, event *Event, monitor Monitor) {
+	tl.record("start ", rule.Name, " ", event.Name())
+}
+
+func (tl *testProcessorListener) OnRuleEnd(rule *Rule, event *Event, monitor Monitor, err error) {
+	tl.record("end ", rule.Name, " ", event.Name(), " ", err)
+}
+
+func (tl *testProcessorListener) OnCascadeFinished(monitor *RootMonitor) {
+	tl.record("finished ", len(monitor.AllErrors()))
+	tl.finished <- true
+}
+
+func (tl *testProcessorListener) OnError(err *TaskError) {
+	tl.record("error ", err.Event.Name(), " ", err.ErrorMap)
+}
+
+func TestProcessorListener(t *testing.T) {
+	proc := NewDeterministicProcessor()
+
+	proc.AddRule(&Rule{
+		Name:       "Rule1",
+		KindMatch:  []string{"core.main"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			p.AddEvent(NewEvent("child", []string{"core", "child"}, nil), m.NewChildMonitor(1))
+			return nil
+		},
+	})
+
+	proc.AddRule(&Rule{
+		Name:       "Rule2",
+		KindMatch:  []string{"core.child"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			return fmt.Errorf("testerror")
+		},
+	})
+
+	tl := &testProcessorListener{&BaseProcessorListener{}, nil, sync.Mutex{}, make(chan bool, 1)}
+	other := &BaseProcessorListener{}
+
+	proc.AddListener(other)
+	proc.AddListener(tl)
+	proc.RemoveListener(other)
+
+	proc.Start()
+	defer proc.Finish()
+
+	proc.AddEventAndWait(NewEvent("main", []string{"core", "main"}, nil), nil)
+
+	<-tl.finished
+
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+
+	if res := strings.Join(tl.res, "\n"); res != `
+queued main
+start Rule1 main
+queued child
+end Rule1 main <nil>
+start Rule2 child
+end Rule2 child testerror
+error child map[Rule2:testerror]
+finished 1`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestProcessorRuntimeRules(t *testing.T) {
+	var res []string
+	var lock sync.Mutex
+
+	proc := NewProcessor(1)
+
+	newRule := func(name string, priority int) *Rule {
+		return &Rule{
+			Name:       name,
+			KindMatch:  []string{"core.*"},
+			ScopeMatch: []string{},
+			StateMatch: map[string]interface{}{},
+			Priority:   priority,
+			Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+				lock.Lock()
+				defer lock.Unlock()
+				res = append(res, name)
+				return nil
+			},
+		}
+	}
+
+	proc.AddRule(newRule("Rule1", 0))
+
+	proc.Start()
+	defer proc.Finish()
+
+	run := func() string {
+		lock.Lock()
+		res = nil
+		lock.Unlock()
+
+		proc.AddEventAndWait(NewEvent("event", []string{"core", "main"}, nil), nil)
+
+		lock.Lock()
+		defer lock.Unlock()
+		return fmt.Sprint(res)
+	}
+
+	if r := run(); r != "[Rule1]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	// Rules can be inserted and removed while the processor is running
+
+	if err := proc.InsertRule(newRule("Rule2", 1)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := proc.InsertRule(newRule("Rule2", 1)); err == nil || err.Error() != "Cannot add rule Rule2 twice" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if r := run(); r != "[Rule1 Rule2]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	proc.SetRuleEnabled("Rule1", false)
+
+	if err := proc.RemoveRule("Rule1"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := proc.RemoveRule("Rule1"); err == nil || err.Error() != "Unknown rule: Rule1" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if r := run(); r != "[Rule2]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	// Runtime settings of removed rules are discarded
+
+	proc.InsertRule(newRule("Rule1", 0))
+
+	if r := run(); r != "[Rule1 Rule2]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	if err := proc.InsertRule(&Rule{Name: "Rule3", ScopeMatch: []string{}}); err == nil ||
+		err.Error() != "Cannot add rule without a kind match: Rule3" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if r := fmt.Sprint(len(proc.Rules())); r != "2" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+}
+
+func TestProcessorShutdown(t *testing.T) {
+	var res []string
+	var lock sync.Mutex
+
+	proc := NewProcessor(2)
+
+	proc.AddRule(&Rule{
+		Name:       "Rule1",
+		KindMatch:  []string{"core.main"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			time.Sleep(20 * time.Millisecond)
+
+			// Root events are rejected but the cascade can continue
+
+			_, err := p.AddEvent(NewEvent("root", []string{"core", "child"}, nil), nil)
+
+			lock.Lock()
+			res = append(res, fmt.Sprint(e.Name(), ": ", err))
+			lock.Unlock()
+
+			p.AddEvent(NewEvent("child", []string{"core", "child"}, nil), m.NewChildMonitor(1))
+
+			return nil
+		},
+	})
+
+	block := make(chan struct{})
+
+	proc.AddRule(&Rule{
+		Name:       "Rule2",
+		KindMatch:  []string{"core.child"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			if e.Name() == "block" {
+				<-block
+			}
+
+			lock.Lock()
+			res = append(res, e.Name())
+			lock.Unlock()
+
+			return nil
+		},
+	})
+
+	proc.Start()
+
+	// Register a trigger which keeps adding root events until the processor shuts down
+
+	stop, done := proc.RegisterTrigger()
+
+	go func() {
+		defer done()
+
+		<-stop
+
+		_, err := proc.AddEvent(NewEvent("trigger", []string{"core", "main"}, nil), nil)
+
+		lock.Lock()
+		res = append(res, fmt.Sprint("trigger: ", err))
+		lock.Unlock()
+	}()
+
+	proc.AddEventAfter(time.Second, NewEvent("delayed", []string{"core", "main"}, nil), nil)
+	proc.AddEvent(NewEvent("event", []string{"core", "main"}, nil), nil)
+
+	time.Sleep(5 * time.Millisecond)
+
+	err := proc.Shutdown(context.Background())
+
+	if err == nil || err.Error() != "Shutdown left work behind: 0 queued tasks, 0 running triggers, 1 dropped delayed event" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	lock.Lock()
+	r := fmt.Sprint(res)
+	lock.Unlock()
+
+	if r != "[trigger: Cannot add root event if the processor is shutting down "+
+		"event: Cannot add root event if the processor is shutting down child]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	if !proc.Stopped() {
+		t.Error("Processor should be stopped")
+		return
+	}
+
+	// Shutting down a stopped processor does nothing
+
+	if err := proc.Shutdown(context.Background()); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Check shutdown timeout
+
+	proc.Start()
+
+	if s := proc.Status(); s != "Running" {
+		t.Error("Unexpected result:", s)
+		return
+	}
+
+	stop, done = proc.RegisterTrigger()
+
+	proc.AddEvent(NewEvent("block", []string{"core", "child"}, nil), nil)
+	proc.AddEvent(NewEvent("queued", []string{"core", "child"}, nil), nil)
+	proc.AddEvent(NewEvent("queued", []string{"core", "child"}, nil), nil)
+
+	time.Sleep(5 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err = proc.Shutdown(ctx)
+
+	if err == nil || err.Error() != "Shutdown left work behind: 0 queued tasks, 1 running trigger, "+
+		"0 dropped delayed events (context deadline exceeded)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if s := proc.Status(); s != "Stopping" {
+		t.Error("Unexpected result:", s)
+		return
+	}
+
+	// Triggers which register during a shutdown are stopped straight away
+
+	stop2, done2 := proc.RegisterTrigger()
+	done2()
+
+	select {
+	case <-stop2:
+	default:
+		t.Error("Trigger should be stopped")
+		return
+	}
+
+	// Calling shutdown again waits for the running shutdown
+
+	<-stop
+	done()
+	done()
+	close(block)
+
+	if err = proc.Shutdown(context.Background()); err != nil || !proc.Stopped() {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	lock.Lock()
+	r = fmt.Sprint(res[3:])
+	lock.Unlock()
+
+	if r != "[queued queued block]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+}
+
+func TestProcessorDeterministic(t *testing.T) {
+
+	run := func() string {
+		var res []string
+		var lock sync.Mutex
+
+		record := func(s string) {
+			lock.Lock()
+			res = append(res, s)
+			lock.Unlock()
+		}
+
+		proc := NewDeterministicProcessor()
+
+		for _, name := range []string{"RuleB", "RuleA"} {
+			ruleName := name
+
+			proc.AddRule(&Rule{
+				Name:       ruleName,
+				KindMatch:  []string{"core.main"},
+				ScopeMatch: []string{},
+				StateMatch: map[string]interface{}{},
+				Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+					record(fmt.Sprint(ruleName, ":", e.Name()))
+
+					if ruleName == "RuleA" {
+						for i := 0; i < 2; i++ {
+							p.AddEvent(NewEvent(fmt.Sprint(e.Name(), ".child", i), []string{"core", "child"}, nil),
+								m.NewChildMonitor(2-i))
+						}
+					}
+
+					return nil
+				},
+			})
+		}
+
+		proc.AddRule(&Rule{
+			Name:       "RuleC",
+			KindMatch:  []string{"core.child"},
+			ScopeMatch: []string{},
+			StateMatch: map[string]interface{}{},
+			Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+				record(fmt.Sprint("RuleC:", e.Name()))
+				return nil
+			},
+		})
+
+		proc.Start()
+
+		for i := 0; i < 3; i++ {
+			proc.AddEvent(NewEvent(fmt.Sprint("event", i), []string{"core", "main"}, nil), nil)
+		}
+
+		proc.Shutdown(context.Background())
+
+		return fmt.Sprint(res)
+	}
+
+	expected := "[RuleA:event0 RuleB:event0 RuleC:event0.child1 RuleC:event0.child0 " +
+		"RuleA:event1 RuleB:event1 RuleC:event1.child1 RuleC:event1.child0 " +
+		"RuleA:event2 RuleB:event2 RuleC:event2.child1 RuleC:event2.child0]"
+
+	for i := 0; i < 5; i++ {
+		if res := run(); res != expected {
+			t.Error("Unexpected result:", res)
+			return
+		}
+	}
+
+	proc := NewDeterministicProcessor()
+
+	if !proc.Deterministic() || proc.Workers() != 1 || NewProcessor(1).Deterministic() {
+		t.Error("Unexpected result:", proc.Deterministic(), proc.Workers())
+		return
+	}
+
+	proc.SetWorkers(4)
+
+	if proc.Workers() != 1 {
+		t.Error("Unexpected result:", proc.Workers())
+		return
+	}
+
+	if _, ok := proc.Clock().(*SystemClock); !ok {
+		t.Error("Unexpected result:", proc.Clock())
+		return
+	}
+
+	clock := &testClock{time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+	proc.SetClock(clock)
+
+	if res := proc.Clock().Now().String(); res != "2000-01-01 00:00:00 +0000 UTC" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+/*
+testClock is a clock with a fixed time.
+*/
+type testClock struct {
+	now time.Time
+}
+
+func (tc *testClock) Now() time.Time {
+	return tc.now
+}
+
+func (tc *testClock) After(d time.Duration) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	c <- tc.now.Add(d)
+	return c
+}
+
+func TestProcessorCascadeTree(t *testing.T) {
+	proc := NewProcessor(1)
+
+	proc.AddRule(&Rule{
+		Name:       "RuleA",
+		KindMatch:  []string{"core.main"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			for i := 0; i < 2; i++ {
+				p.AddEvent(NewEvent(fmt.Sprint("child", i), []string{"core", "child"}, nil),
+					m.NewChildMonitor(1))
+			}
+			return nil
+		},
+	})
+
+	proc.AddRule(&Rule{
+		Name:       "RuleB",
+		KindMatch:  []string{"core.child"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			if e.Name() == "child1" {
+				return errors.New("testerror")
+			}
+			m.SetResult("RuleB", e.Name())
+			return nil
+		},
+	})
+
+	proc.Start()
+
+	mon, err := proc.AddEventAndWait(NewEvent("root", []string{"core", "main"}, nil), nil)
+	errorutil.AssertOk(err)
+
+	proc.Finish()
+
+	tree := mon.CascadeTree()
+
+	if res := tree.String(); res != `
+root (core.main) rules: RuleA
+  child0 (core.child) rules: RuleB
+  child1 (core.child) rules: RuleB errors: RuleB: testerror`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if tree.MonitorID != mon.ID() || len(tree.Children) != 2 ||
+		tree.Children[1].Errors["RuleB"].Error() != "testerror" {
+		t.Error("Unexpected result:", tree)
+		return
+	}
+
+	if res := fmt.Sprint(tree.Results, tree.Children[0].Results, tree.Children[1].Results); res != "map[] map[RuleB:child0] map[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	rm := mon.(*RootMonitor)
+	create := func() interface{} { return len(rm.Context) + 1 }
+
+	if v1, v2 := rm.ContextValue("foo", create), rm.ContextValue("foo", create); v1 != 1 || v2 != 1 || rm.Context["foo"] != 1 {
+		t.Error("Unexpected result:", v1, v2, rm.Context)
+		return
+	}
+
+	results := mon.(*RootMonitor).AllResults()
+
+	if len(results) != 1 || results[0].Event.Name() != "child0" || results[0].Monitor.ID() != tree.Children[0].MonitorID ||
+		fmt.Sprint(results[0].ResultMap, results[0].Monitor.Results()) != "map[RuleB:child0] map[RuleB:child0]" {
+		t.Error("Unexpected result:", results)
+		return
+	}
+
+	if tree.Activated.IsZero() || tree.Finished.Before(tree.Activated) || tree.Duration() < 0 {
+		t.Error("Unexpected timings:", tree.Activated, tree.Finished)
+		return
+	}
+
+	if (&CascadeNode{}).Duration() != 0 || (&CascadeNode{}).String() != "<no event>" {
+		t.Error("Unexpected result")
+		return
+	}
+}
+
+func TestProcessorAddEvents(t *testing.T) {
+	var log []string
+	logLock := &sync.Mutex{}
+
+	proc := NewProcessor(1)
+
+	proc.AddRule(&Rule{
+		Name:       "RuleA",
+		KindMatch:  []string{"core.main"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			var events []*Event
+
+			for i := 0; i < 3; i++ {
+				events = append(events, NewEvent(fmt.Sprint("child", i), []string{"core", "child"}, nil))
+			}
+
+			events = append(events, NewEvent("ignored", []string{"core", "foo"}, nil))
+
+			monitors, err := p.AddEvents(events, m)
+
+			if err == nil && (len(monitors) != 4 || monitors[3] != nil) {
+				err = fmt.Errorf("Unexpected monitors: %v", monitors)
+			}
+
+			return err
+		},
+	})
+
+	proc.AddRule(&Rule{
+		Name:       "RuleB",
+		KindMatch:  []string{"core.child"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			logLock.Lock()
+			log = append(log, e.Name())
+			logLock.Unlock()
+			return nil
+		},
+	})
+
+	// Processor must be running
+
+	if _, err := proc.AddEvents([]*Event{NewEvent("root", []string{"core", "child"}, nil)}, nil); err == nil ||
+		err.Error() != "Cannot add event if the processor is stopping or not running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	proc.Start()
+
+	mon, err := proc.AddEventAndWait(NewEvent("root", []string{"core", "main"}, nil), nil)
+	errorutil.AssertOk(err)
+
+	if res := mon.CascadeTree().String(); res != `
+root (core.main) rules: RuleA
+  child0 (core.child) rules: RuleB
+  child1 (core.child) rules: RuleB
+  child2 (core.child) rules: RuleB`[1:] || len(log) != 3 {
+		t.Error("Unexpected result:", res, log)
+		return
+	}
+
+	// Without a parent monitor each event starts its own cascade
+
+	monitors, err := proc.AddEvents([]*Event{
+		NewEvent("root1", []string{"core", "child"}, nil),
+		NewEvent("root2", []string{"core", "child"}, nil),
+	}, nil)
+	errorutil.AssertOk(err)
+
+	if _, ok := monitors[0].(*RootMonitor); !ok || monitors[0] == monitors[1] {
+		t.Error("Unexpected result:", monitors)
+		return
+	}
+
+	// The parent monitor must be active
+
+	if _, err := proc.AddEvents(nil, proc.NewRootMonitor(nil, nil)); err == nil ||
+		err.Error() != "Parent monitor must be active" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	proc.Finish()
+
+	sort.Strings(log)
+
+	if res := fmt.Sprint(log); res != "[child0 child1 child2 root1 root2]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestProcessorCascadeLimits(t *testing.T) {
+	proc := NewProcessor(1)
+
+	proc.AddRule(&Rule{
+		Name:       "RuleLoop",
+		KindMatch:  []string{"core.*"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			kind := e.Kind()
+
+			// Events of kind core.switch alternate between two kinds
+
+			if kind[1] != "loop" {
+				if kind[1] == "ping" {
+					kind = []string{"core", "pong"}
+				} else {
+					kind = []string{"core", "ping"}
+				}
+			}
+
+			if e.Name() == "batch" {
+				_, err := p.AddEvents([]*Event{NewEvent("batch", kind, nil)}, m)
+				return err
+			}
+
+			_, err := p.AddEvent(NewEvent(e.Name(), kind, nil), m.NewChildMonitor(0))
+			return err
+		},
+	})
+
+	proc.SetCascadeLimits(10, 3)
+	proc.Start()
+
+	// An event kind which re-triggers itself is detected
+
+	mon, err := proc.AddEventAndWait(NewEvent("loop", []string{"core", "loop"}, nil), nil)
+	errorutil.AssertOk(err)
+
+	rm := mon.(*RootMonitor)
+	errs := rm.AllErrors()
+
+	if !errors.Is(rm.Aborted(), ErrCascadeLoop) || len(errs) != 2 || rm.CascadeTree().Children[0].Children[0].Children[0].Event == nil ||
+		errs[0].ErrorMap["RuleLoop"].Error() != "Event kind re-triggers itself in a loop: Event kind core.loop was added 4 times in a row (limit is 3)" ||
+		errs[1].ErrorMap[ErrorKeyCascadeAborted] != errs[0].ErrorMap["RuleLoop"] || errs[1].Event.Name() != "loop" {
+		t.Error("Unexpected result:", rm.Aborted(), errs)
+		return
+	}
+
+	// Cascades which alternate between event kinds are limited by their depth
+
+	for _, name := range []string{"switch", "batch"} {
+		mon, err = proc.AddEventAndWait(NewEvent(name, []string{"core", "ping"}, nil), nil)
+		errorutil.AssertOk(err)
+
+		rm = mon.(*RootMonitor)
+		errs = rm.AllErrors()
+
+		if !errors.Is(rm.Aborted(), ErrCascadeDepth) || len(errs) != 2 ||
+			errs[0].ErrorMap["RuleLoop"].Error() != fmt.Sprintf("Maximum event cascade depth exceeded: Event %v has depth 11 (limit is 10)", name) {
+			t.Error("Unexpected result:", rm.Aborted(), errs)
+			return
+		}
+	}
+
+	// An aborted cascade does not accept any further events
+
+	if _, err = proc.AddEvent(NewEvent("late", []string{"core", "ping"}, nil), rm.NewChildMonitor(0)); err != rm.Aborted() {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	proc.Finish()
+}
+
+func TestProcessorRetry(t *testing.T) {
+	var attempts, exhausted []string
+	var lock sync.Mutex
+
+	proc := NewProcessor(1)
+
+	proc.AddRule(&Rule{
+		Name:       "Flaky",
+		KindMatch:  []string{"job.*"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			attempts = append(attempts, e.Name())
+
+			if n := e.State()["fails"].(int); len(attempts) <= n {
+				return fmt.Errorf("Attempt %v failed", len(attempts))
+			}
+
+			return nil
+		},
+	})
+
+	proc.AddRule(&Rule{
+		Name:       "Exhausted",
+		KindMatch:  []string{"retry.exhausted"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			exhausted = append(exhausted, fmt.Sprint(e.Name(), " ", e.State()["error"], " ",
+				e.State()["attempts"], " ", e.State()["event"].(map[interface{}]interface{})["kind"]))
+
+			return nil
+		},
+	})
+
+	if err := proc.SetRuleRetry("foo", nil); err == nil || err.Error() != "Unknown rule: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	errorutil.AssertOk(proc.SetRuleRetry("Flaky", NewRuleRetry(3, time.Millisecond)))
+
+	proc.Start()
+
+	// The action succeeds on the third attempt
+
+	m, err := proc.AddEventAndWait(NewEvent("a", []string{"job", "run"},
+		map[interface{}]interface{}{"fails": 2}), nil)
+
+	if errs := m.(*RootMonitor).AllErrors(); err != nil || len(errs) != 0 ||
+		fmt.Sprint(attempts) != "[a a a]" || len(exhausted) != 0 {
+		t.Error("Unexpected result:", err, errs, attempts, exhausted)
+		return
+	}
+
+	// The action fails after all retries
+
+	attempts = nil
+
+	m, err = proc.AddEventAndWait(NewEvent("b", []string{"job", "run"},
+		map[interface{}]interface{}{"fails": 10}), nil)
+
+	if errs := m.(*RootMonitor).AllErrors(); err != nil || len(errs) != 1 ||
+		errs[0].ErrorMap["Flaky"].Error() != "Attempt 4 failed" || fmt.Sprint(attempts) != "[b b b b]" ||
+		fmt.Sprint(exhausted) != "[Flaky Attempt 4 failed 4 job.run]" {
+		t.Error("Unexpected result:", err, errs, attempts, exhausted)
+		return
+	}
+
+	proc.Finish()
+
+	// Delays double with every retry and have a jitter of up to 25%
+
+	rr := NewRuleRetry(5, 100*time.Millisecond)
+
+	for i, min := range []time.Duration{100, 200, 400, 800} {
+		if d := rr.Delay(i + 1); d < min*time.Millisecond || d > min*time.Millisecond*5/4 {
+			t.Error("Unexpected delay:", i+1, d)
+			return
+		}
+	}
+
+	if res := fmt.Sprint(rr, " ", NewRuleRetry(1, time.Hour).Delay(100)); res != "Retry:5 Backoff:100ms 2562047h47m16.854775807s" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestProcessorBreaker(t *testing.T) {
+	var runs int
+	var events []string
+	var lock sync.Mutex
+
+	fail := true
+	clock := NewVirtualClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	proc := NewProcessor(1)
+	proc.SetClock(clock)
+
+	proc.AddRule(&Rule{
+		Name:       "Downstream",
+		KindMatch:  []string{"call"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			runs++
+
+			if fail {
+				return fmt.Errorf("Service unavailable")
+			}
+
+			return nil
+		},
+	})
+
+	proc.AddRule(&Rule{
+		Name:       "Breaker",
+		KindMatch:  []string{"circuit.*"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			events = append(events, fmt.Sprint(strings.Join(e.Kind(), "."), " ", e.Name(), " ",
+				e.State()["rule"], " ", e.State()["failures"], " ", e.State()["error"]))
+
+			return nil
+		},
+	})
+
+	if err := proc.SetRuleBreaker("foo", nil); err == nil || err.Error() != "Unknown rule: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	breaker := NewRuleBreaker("service", 2, time.Minute)
+	errorutil.AssertOk(proc.SetRuleBreaker("Downstream", breaker))
+
+	proc.Start()
+
+	call := func() error {
+		m, err := proc.AddEventAndWait(NewEvent("call", []string{"call"}, nil), nil)
+		errorutil.AssertOk(err)
+
+		if errs := m.(*RootMonitor).AllErrors(); len(errs) > 0 {
+			return errs[0].ErrorMap["Downstream"]
+		}
+
+		return nil
+	}
+
+	// Two failures open the breaker - further calls fail straight away
+
+	call()
+	call()
+	err := call()
+
+	if !errors.Is(err, ErrCircuitOpen) || err.Error() != "Circuit breaker is open: service" || runs != 2 ||
+		fmt.Sprint(events) != "[circuit.open service Downstream 2 Service unavailable]" ||
+		breaker.String() != "Breaker:service open (failures:2 threshold:2 cooldown:1m0s)" {
+		t.Error("Unexpected result:", err, runs, events, breaker)
+		return
+	}
+
+	// A failed trial after the cooldown opens the breaker again
+
+	clock.Advance(time.Minute)
+
+	if err = call(); err == nil || err.Error() != "Service unavailable" || runs != 3 || len(events) != 2 {
+		t.Error("Unexpected result:", err, runs, events)
+		return
+	}
+
+	if err = call(); !errors.Is(err, ErrCircuitOpen) || runs != 3 {
+		t.Error("Unexpected result:", err, runs)
+		return
+	}
+
+	// A successful trial closes the breaker
+
+	fail = false
+	clock.Advance(time.Minute)
+
+	if err = call(); err != nil || runs != 4 ||
+		events[2] != "circuit.close service Downstream 0 <nil>" || breaker.String() != "Breaker:service closed (failures:0 threshold:2 cooldown:1m0s)" {
+		t.Error("Unexpected result:", err, runs, events, breaker)
+		return
+	}
+
+	// Removing the breaker runs the rule unprotected
+
+	errorutil.AssertOk(proc.SetRuleBreaker("Downstream", nil))
+
+	fail = true
+
+	for i := 0; i < 3; i++ {
+		call()
+	}
+
+	if runs != 7 || len(events) != 3 {
+		t.Error("Unexpected result:", runs, events)
+		return
+	}
+
+	proc.Finish()
+}
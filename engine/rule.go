@@ -14,10 +14,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"reflect"
 	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/krotik/common/errorutil"
 	"github.com/krotik/common/sortutil"
@@ -28,13 +33,14 @@ Rule models a matching rule for event receivers (actions). A rule has 3 possible
 matching criteria:
 
 - Match on event kinds: A list of strings in dot notation which describes event kinds. May
-contain '*' characters as wildcards (e.g. core.tests.*).
+contain '*' characters or named wildcards as segments (e.g. core.tests.* or device.{id}.temp).
 
 - Match on event cascade scope: A list of strings in dot notation which describe the
 required scopes of an event cascade.
 
 - Match on event state: A simple list of required key / value states in the event
-state. Nil values can be used as wildcards (i.e. match is only on key).
+state. Nil values can be used as wildcards (i.e. match is only on key). Values can
+also be regular expressions or conditions (see RuleStateCondition).
 
 Rules have priorities (0 being the highest) and may suppress each other.
 */
@@ -65,10 +71,55 @@ func (r *Rule) CopyAs(newName string) *Rule {
 	}
 }
 
+/*
+KindParams returns the event kind segments which are matched by wildcards in
+the first kind match of this rule which matches a given event. Named wildcards
+(e.g. {id}) are stored under their name. All other wildcards are stored under
+the position of the segment in the event kind.
+*/
+func (r *Rule) KindParams(event *Event) map[string]string {
+	kind := event.Kind()
+
+	for _, kindMatch := range r.KindMatch {
+		segments := strings.Split(kindMatch, RuleKindSeparator)
+
+		if len(segments) != len(kind) {
+			continue
+		}
+
+		params := make(map[string]string)
+
+		for i, segment := range segments {
+			if segment == RuleKindWildcard {
+				params[fmt.Sprint(i)] = kind[i]
+			} else if IsRuleKindWildcard(segment) {
+				params[segment[1:len(segment)-1]] = kind[i]
+			} else if segment != kind[i] {
+				params = nil
+				break
+			}
+		}
+
+		if params != nil {
+			return params
+		}
+	}
+
+	return map[string]string{}
+}
+
 func (r *Rule) String() string {
-	sm, _ := json.Marshal(r.StateMatch)
+	var sm bytes.Buffer
+
+	// Do not escape operators of state conditions
+
+	enc := json.NewEncoder(&sm)
+	enc.SetEscapeHTML(false)
+	enc.Encode(r.StateMatch)
+
 	return fmt.Sprintf("Rule:%s [%s] (Priority:%v Kind:%v Scope:%v StateMatch:%s Suppress:%v)",
-		r.Name, strings.TrimSpace(r.Desc), r.Priority, r.KindMatch, r.ScopeMatch, sm, r.SuppressionList)
+		r.Name, strings.TrimSpace(r.Desc), r.Priority, r.KindMatch, r.ScopeMatch,
+		strings.TrimSpace(sm.String()), r.SuppressionList)
 }
 
 /*
@@ -77,6 +128,521 @@ a unique thread ID from the executing thread.
 */
 type RuleAction func(p Processor, m Monitor, e *Event, tid uint64) error
 
+/*
+RuleDedup prevents a rule from triggering on duplicate events (see
+Processor.SetRuleDedup). Two events are duplicates if they have the same
+deduplication key and the second event arrives within the time window which was
+started by the first event. The deduplication key is made of the values of the
+given state keys (dot notation can be used to address nested values). The whole
+event state is used if no keys are given.
+*/
+type RuleDedup struct {
+	Window    time.Duration        // Time window in which events are considered duplicates
+	Keys      []string             // State keys which make up the deduplication key
+	seen      map[string]time.Time // Deduplication keys of seen events and their time
+	lastPrune time.Time            // Time when expired keys were last removed
+	lock      *sync.Mutex          // Lock for seen events
+}
+
+/*
+NewRuleDedup returns a new deduplication object for rules.
+*/
+func NewRuleDedup(window time.Duration, keys []string) *RuleDedup {
+	return &RuleDedup{window, keys, make(map[string]time.Time), time.Now(), &sync.Mutex{}}
+}
+
+/*
+IsDuplicate checks if a given event is a duplicate of a previously seen event.
+Events which are not duplicates are recorded.
+*/
+func (rd *RuleDedup) IsDuplicate(event *Event) bool {
+	return rd.checkDuplicate(event, true)
+}
+
+/*
+checkDuplicate checks if a given event is a duplicate of a previously seen
+event. Events which are not duplicates are only recorded if record is set.
+*/
+func (rd *RuleDedup) checkDuplicate(event *Event, record bool) bool {
+	key := rd.key(event)
+	now := time.Now()
+
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+
+	// Remove expired keys once per window
+
+	if now.Sub(rd.lastPrune) > rd.Window {
+		for k, t := range rd.seen {
+			if now.Sub(t) > rd.Window {
+				delete(rd.seen, k)
+			}
+		}
+		rd.lastPrune = now
+	}
+
+	if t, ok := rd.seen[key]; ok && now.Sub(t) <= rd.Window {
+		return true
+	}
+
+	if record {
+		rd.seen[key] = now
+	}
+
+	return false
+}
+
+/*
+key returns the deduplication key of an event.
+*/
+func (rd *RuleDedup) key(event *Event) string {
+	if len(rd.Keys) == 0 {
+		return fmt.Sprint(event.State())
+	}
+
+	var buf bytes.Buffer
+
+	for _, k := range rd.Keys {
+		var val interface{} = event.State()
+
+		for _, field := range strings.Split(k, ".") {
+			if m, ok := val.(map[interface{}]interface{}); ok {
+				val = m[field]
+			} else {
+				val = nil
+			}
+		}
+
+		buf.WriteString(fmt.Sprintf("%q=%v\x00", k, val))
+	}
+
+	return buf.String()
+}
+
+/*
+String returns a string representation of this deduplication object.
+*/
+func (rd *RuleDedup) String() string {
+	return fmt.Sprintf("Dedup:%v %v", rd.Window, rd.Keys)
+}
+
+/*
+RuleCollect lets a rule aggregate events (see Processor.SetRuleCollect). The
+first matching event starts a time window. All matching events which arrive
+within the window are collected and the rule is triggered once with a single
+event which contains all collected events (see NewCollectedEvent).
+*/
+type RuleCollect struct {
+	Window time.Duration // Time window in which events are collected
+	events []*Event      // Collected events of the current window
+	lock   *sync.Mutex   // Lock for collected events
+}
+
+/*
+NewRuleCollect returns a new aggregation object for rules.
+*/
+func NewRuleCollect(window time.Duration) *RuleCollect {
+	return &RuleCollect{window, nil, &sync.Mutex{}}
+}
+
+/*
+Add adds an event to the current window. Returns true if the event started a
+new window.
+*/
+func (rc *RuleCollect) Add(event *Event) bool {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	rc.events = append(rc.events, event)
+
+	return len(rc.events) == 1
+}
+
+/*
+Flush returns all collected events and ends the current window.
+*/
+func (rc *RuleCollect) Flush() []*Event {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	events := rc.events
+	rc.events = nil
+
+	return events
+}
+
+/*
+String returns a string representation of this aggregation object.
+*/
+func (rc *RuleCollect) String() string {
+	return fmt.Sprintf("Collect:%v", rc.Window)
+}
+
+/*
+RuleRetry lets a rule re-run its action if the action returns an error (see
+Processor.SetRuleRetry). The delay before a retry starts with the backoff and
+doubles with every retry. A random jitter of up to 25% is added to each delay.
+If the action still fails after all retries then the error is recorded and an
+event is added which reports the failure (see NewRetryExhaustedEvent).
+*/
+type RuleRetry struct {
+	Retries int           // Number of retries
+	Backoff time.Duration // Delay before the first retry
+}
+
+/*
+NewRuleRetry returns a new retry policy for rules.
+*/
+func NewRuleRetry(retries int, backoff time.Duration) *RuleRetry {
+	return &RuleRetry{retries, backoff}
+}
+
+/*
+Delay returns the delay before a given retry (the first retry is 1).
+*/
+func (rr *RuleRetry) Delay(retry int) time.Duration {
+	d := float64(rr.Backoff) * math.Pow(2, float64(retry-1))
+	d += d * 0.25 * rand.Float64()
+
+	if d > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(d)
+}
+
+/*
+String returns a string representation of this retry policy.
+*/
+func (rr *RuleRetry) String() string {
+	return fmt.Sprintf("Retry:%v Backoff:%v", rr.Retries, rr.Backoff)
+}
+
+/*
+Circuit breaker states
+*/
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "halfopen"
+)
+
+/*
+RuleBreaker is a circuit breaker which protects downstream systems from rules
+which keep failing. A breaker can be shared by several rules (see
+SetRuleBreaker of the processor). The breaker opens after a number of
+consecutive failures of its rules. While the breaker is open actions are not
+run and fail straight away. Once the cooldown has passed the breaker is half
+open and lets a single trial run through. A successful trial closes the
+breaker - a failed trial opens it again.
+*/
+type RuleBreaker struct {
+	Name      string        // Name of the breaker
+	Threshold int           // Number of consecutive failures which open the breaker
+	Cooldown  time.Duration // Time the breaker stays open before a trial run
+	state     string        // Current state of the breaker
+	failures  int           // Number of consecutive failures
+	openUntil time.Time     // Time when the cooldown of an open breaker ends
+	trial     bool          // Flag if a trial run is in progress
+	lock      *sync.Mutex   // Lock for the breaker state
+}
+
+/*
+NewRuleBreaker returns a new circuit breaker for rules.
+*/
+func NewRuleBreaker(name string, threshold int, cooldown time.Duration) *RuleBreaker {
+	return &RuleBreaker{name, threshold, cooldown, BreakerClosed, 0, time.Time{}, false, &sync.Mutex{}}
+}
+
+/*
+State returns the current state of the breaker and the number of consecutive
+failures.
+*/
+func (rb *RuleBreaker) State() (string, int) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	return rb.state, rb.failures
+}
+
+/*
+allow checks if an action can run at a given time. An open breaker becomes
+half open once its cooldown has passed.
+*/
+func (rb *RuleBreaker) allow(now time.Time) bool {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	if rb.state == BreakerOpen && !now.Before(rb.openUntil) {
+		rb.state = BreakerHalfOpen
+		rb.trial = false
+	}
+
+	if rb.state == BreakerHalfOpen {
+
+		// Only a single trial run is allowed
+
+		if rb.trial {
+			return false
+		}
+
+		rb.trial = true
+	}
+
+	return rb.state != BreakerOpen
+}
+
+/*
+record records the result of an action which was run at a given time. Returns
+the new state of the breaker if the state was changed to open or closed.
+*/
+func (rb *RuleBreaker) record(err error, now time.Time) string {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	if err == nil {
+		rb.failures = 0
+
+		if rb.state != BreakerClosed {
+			rb.state = BreakerClosed
+			return rb.state
+		}
+
+		return ""
+	}
+
+	rb.failures++
+
+	if rb.state == BreakerHalfOpen || (rb.state == BreakerClosed && rb.failures >= rb.Threshold) {
+		rb.state = BreakerOpen
+		rb.openUntil = now.Add(rb.Cooldown)
+		return rb.state
+	}
+
+	return ""
+}
+
+/*
+String returns a string representation of this circuit breaker.
+*/
+func (rb *RuleBreaker) String() string {
+	state, failures := rb.State()
+	return fmt.Sprintf("Breaker:%v %v (failures:%v threshold:%v cooldown:%v)",
+		rb.Name, state, failures, rb.Threshold, rb.Cooldown)
+}
+
+/*
+RuleStateCondition is a condition for a value in the state match of a rule. A
+condition consists of one or more operators which must all be true for a state
+value. A state value must be present for a condition to match. Supported
+operators are:
+
+	>, >=, <, <=  Numbers and strings are compared
+	==, not       Value is equal / not equal
+	in, notin     Value is / is not in a list of values
+	like          Value matches a regular expression
+*/
+type RuleStateCondition struct {
+	ops     []string                  // Operators of this condition (sorted)
+	spec    map[string]interface{}    // Operators and their values
+	regexes map[string]*regexp.Regexp // Compiled regular expressions
+}
+
+/*
+NewRuleStateCondition returns a new state condition from a map of operators
+to values.
+*/
+func NewRuleStateCondition(spec map[string]interface{}) (*RuleStateCondition, error) {
+	var ops []string
+
+	regexes := make(map[string]*regexp.Regexp)
+
+	if len(spec) == 0 {
+		return nil, fmt.Errorf("State condition needs at least one operator")
+	}
+
+	for op, val := range spec {
+		switch op {
+		case ">", ">=", "<", "<=", "==", "not":
+		case "in", "notin":
+			if _, ok := val.([]interface{}); !ok {
+				return nil, fmt.Errorf("State condition operator %v needs a list", op)
+			}
+		case "like":
+			re, err := regexp.Compile(fmt.Sprint(val))
+			if err != nil {
+				return nil, fmt.Errorf("State condition operator like needs a regular expression: %v", err)
+			}
+			regexes[op] = re
+		default:
+			return nil, fmt.Errorf("Unknown state condition operator: %v", op)
+		}
+
+		ops = append(ops, op)
+	}
+
+	sort.Strings(ops)
+
+	return &RuleStateCondition{ops, spec, regexes}, nil
+}
+
+/*
+Match checks if a given state value fulfills this condition.
+*/
+func (rc *RuleStateCondition) Match(val interface{}) bool {
+	for _, op := range rc.ops {
+		if !rc.matchOp(op, rc.spec[op], val) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+matchOp checks a single operator of this condition.
+*/
+func (rc *RuleStateCondition) matchOp(op string, opVal interface{}, val interface{}) bool {
+	switch op {
+	case "==":
+		return stateValueEqual(val, opVal)
+
+	case "not":
+		return !stateValueEqual(val, opVal)
+
+	case "in", "notin":
+		found := false
+
+		for _, item := range opVal.([]interface{}) {
+			if stateValueEqual(val, item) {
+				found = true
+				break
+			}
+		}
+
+		return found == (op == "in")
+
+	case "like":
+		return rc.regexes[op].MatchString(fmt.Sprint(val))
+	}
+
+	res, ok := stateValueCompare(val, opVal)
+
+	if !ok {
+
+		// Values which cannot be compared never match
+
+		return false
+	}
+
+	switch op {
+	case ">":
+		return res > 0
+	case ">=":
+		return res >= 0
+	case "<":
+		return res < 0
+	}
+
+	return res <= 0
+}
+
+/*
+Spec returns the operators of this condition and their values.
+*/
+func (rc *RuleStateCondition) Spec() map[string]interface{} {
+	return rc.spec
+}
+
+/*
+MarshalJSON returns a JSON representation of this condition.
+*/
+func (rc *RuleStateCondition) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(rc.spec)
+
+	return bytes.TrimSpace(buf.Bytes()), err
+}
+
+/*
+String returns a string representation of this condition.
+*/
+func (rc *RuleStateCondition) String() string {
+	var parts []string
+
+	for _, op := range rc.ops {
+		parts = append(parts, fmt.Sprintf("%v %v", op, rc.spec[op]))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+/*
+stateValueEqual checks if two state values are equal. Numbers of different
+types are equal if they have the same value.
+*/
+func stateValueEqual(val1 interface{}, val2 interface{}) bool {
+	if res, ok := stateValueCompare(val1, val2); ok {
+		return res == 0
+	}
+
+	return reflect.DeepEqual(val1, val2)
+}
+
+/*
+stateValueCompare compares two state values. Returns -1, 0 or 1 and true if
+the values could be compared.
+*/
+func stateValueCompare(val1 interface{}, val2 interface{}) (int, bool) {
+	if n1, ok := stateValueNumber(val1); ok {
+		if n2, ok := stateValueNumber(val2); ok {
+			if n1 < n2 {
+				return -1, true
+			} else if n1 > n2 {
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	if s1, ok := val1.(string); ok {
+		if s2, ok := val2.(string); ok {
+			return strings.Compare(s1, s2), true
+		}
+	}
+
+	return 0, false
+}
+
+/*
+stateValueNumber converts a numeric state value into a float64.
+*/
+func stateValueNumber(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+
+	return 0, false
+}
+
 /*
 RuleIndex is an index for rules. It takes the form of a tree structure in which
 incoming events are matched level by level (e.g. event of kind core.task1.step1
@@ -98,7 +664,8 @@ type RuleIndex interface {
 
 	/*
 		Match returns all rules in this index which match a given event. This
-		method does a full matching check including state matching.
+		method does a full matching check including state matching. The
+		returned slice may be shared with the index and must not be modified.
 	*/
 	Match(event *Event) []*Rule
 
@@ -137,11 +704,13 @@ type ruleSubIndex interface {
 	isTriggeringAtLevel(event *Event, level int) bool
 
 	/*
-		matchAtLevel returns all rules in this index which match a given event
-		at the given level. This method does a full matching check including
-		state matching.
+		matchAtLevel appends all rules in this index which match a given event
+		at the given level to a given slice. This method does a full matching
+		check including state matching. If the given slice is empty then the
+		returned slice may be shared with the index (its capacity is limited
+		so appending to it creates a copy).
 	*/
-	matchAtLevel(event *Event, level int) []*Rule
+	matchAtLevel(event *Event, level int, ret []*Rule) []*Rule
 
 	/*
 		stringIndent returns a string representation with a given indentation of this
@@ -280,7 +849,7 @@ func (ri *RuleIndexKind) addRuleAtLevel(rule *Rule, kindMatchLevel []string) {
 
 	// Select the correct ruleSubIndexList
 
-	if matchItem == RuleKindWildcard {
+	if IsRuleKindWildcard(matchItem) {
 		ruleSubIndexList = ri.kindAllMatch
 	} else {
 		if ruleSubIndexList, ok = ri.kindSingleMatch[matchItem]; !ok {
@@ -312,7 +881,7 @@ func (ri *RuleIndexKind) addRuleAtLevel(rule *Rule, kindMatchLevel []string) {
 
 		// Add the new index to the correct list
 
-		if matchItem == RuleKindWildcard {
+		if IsRuleKindWildcard(matchItem) {
 			ri.kindAllMatch = append(ruleSubIndexList, index)
 		} else {
 			ri.kindSingleMatch[matchItem] = append(ruleSubIndexList, index)
@@ -370,42 +939,44 @@ func (ri *RuleIndexKind) isTriggeringAtLevel(event *Event, level int) bool {
 
 /*
 Match returns all rules in this index which match a given event. This method
-does a full matching check including state matching.
+does a full matching check including state matching. The returned slice may
+be shared with the index and must not be modified.
+
+Matching does not allocate memory if all matching rules are stored in the same
+leaf of the index (e.g. an event which is only matched by a single rule).
 */
 func (ri *RuleIndexKind) Match(event *Event) []*Rule {
-	return ri.matchAtLevel(event, 0)
+	return ri.matchAtLevel(event, 0, nil)
 }
 
 /*
-matchAtLevel returns all rules in this index which match a given event
-at the given level. This method does a full matching check including
-state matching.
+matchAtLevel appends all rules in this index which match a given event
+at the given level to a given slice. This method does a full matching
+check including state matching.
 */
-func (ri *RuleIndexKind) matchAtLevel(event *Event, level int) []*Rule {
+func (ri *RuleIndexKind) matchAtLevel(event *Event, level int, ret []*Rule) []*Rule {
 
 	// Check if the event kind is too general (e.g. rule is defined as a.b.c
 	// and the event kind is a.b)
 
 	if len(event.kind) <= level {
-		return nil
+		return ret
 	}
 
-	var ret []*Rule
-
 	levelKind := event.kind[level]
 	nextLevel := level + 1
 
 	// Check rules targeting all events
 
 	for _, index := range ri.kindAllMatch {
-		ret = append(ret, index.matchAtLevel(event, nextLevel)...)
+		ret = index.matchAtLevel(event, nextLevel, ret)
 	}
 
 	// Check rules targeting specific events
 
 	if ruleSubIndexList, ok := ri.kindSingleMatch[levelKind]; ok {
 		for _, index := range ruleSubIndexList {
-			ret = append(ret, index.matchAtLevel(event, nextLevel)...)
+			ret = index.matchAtLevel(event, nextLevel, ret)
 		}
 	}
 
@@ -464,10 +1035,11 @@ func (ri *RuleIndexKind) stringIndent(indent string) string {
 RuleMatcherKey is used for pure key - value state matches.
 */
 type RuleMatcherKey struct {
-	bits        uint64
-	bitsAny     uint64
-	bitsValue   map[interface{}]uint64
-	bitsRegexes map[uint64]*regexp.Regexp
+	bits           uint64
+	bitsAny        uint64
+	bitsValue      map[interface{}]uint64
+	bitsRegexes    map[uint64]*regexp.Regexp
+	bitsConditions map[uint64]*RuleStateCondition
 }
 
 /*
@@ -490,6 +1062,14 @@ func (rm *RuleMatcherKey) addRule(num uint, bit uint64, key string, value interf
 		rm.bitsAny |= bit
 		rm.bitsRegexes[bit] = regex
 
+	} else if cond, ok := value.(*RuleStateCondition); ok {
+
+		// Conditions are checked like regexes once the presence of the key
+		// has been established
+
+		rm.bitsAny |= bit
+		rm.bitsConditions[bit] = cond
+
 	} else {
 		rm.bitsValue[value] |= bit
 	}
@@ -519,6 +1099,16 @@ func (rm *RuleMatcherKey) match(bits uint64, value interface{}) uint64 {
 		}
 	}
 
+	for bm, c := range rm.bitsConditions {
+
+		if keyMatchedBits&bm > 0 && !c.Match(value) {
+
+			// Condition does not match remove the bit
+
+			keyMatchedBits ^= keyMatchedBits & bm
+		}
+	}
+
 	return keyMatchedBits
 }
 
@@ -567,6 +1157,23 @@ func (rm *RuleMatcherKey) String() string {
 
 	buf.WriteString("]")
 
+	if len(rm.bitsConditions) > 0 {
+		var ckeys []uint64
+		for k := range rm.bitsConditions {
+			ckeys = append(ckeys, k)
+		}
+
+		sortutil.UInt64s(ckeys)
+
+		buf.WriteString(" [")
+
+		for _, k := range ckeys {
+			buf.WriteString(fmt.Sprintf("%08X:%v ", k, rm.bitsConditions[k]))
+		}
+
+		buf.WriteString("]")
+	}
+
 	return buf.String()
 }
 
@@ -612,7 +1219,8 @@ func (ri *RuleIndexState) addRuleAtLevel(rule *Rule, kindMatchLevel []string) {
 		var keyMatcher *RuleMatcherKey
 
 		if keyMatcher, ok = ri.keyMap[k]; !ok {
-			keyMatcher = &RuleMatcherKey{0, 0, make(map[interface{}]uint64), make(map[uint64]*regexp.Regexp)}
+			keyMatcher = &RuleMatcherKey{0, 0, make(map[interface{}]uint64), make(map[uint64]*regexp.Regexp),
+				make(map[uint64]*RuleStateCondition)}
 			ri.keyMap[k] = keyMatcher
 		}
 
@@ -629,13 +1237,13 @@ func (ri *RuleIndexState) isTriggeringAtLevel(event *Event, level int) bool {
 }
 
 /*
-matchAtLevel returns all rules in this index which match a given event
-at the given level. This method does a full matching check including
-state matching.
+matchAtLevel appends all rules in this index which match a given event
+at the given level to a given slice. This method does a full matching
+check including state matching.
 */
-func (ri *RuleIndexState) matchAtLevel(event *Event, level int) []*Rule {
+func (ri *RuleIndexState) matchAtLevel(event *Event, level int, ret []*Rule) []*Rule {
 	if len(event.kind) != level {
-		return nil
+		return ret
 	}
 
 	// Assume all rules match and remove the ones with don't
@@ -662,13 +1270,19 @@ func (ri *RuleIndexState) matchAtLevel(event *Event, level int) []*Rule {
 
 			// All rules have been excluded
 
-			return nil
+			return ret
 		}
 	}
 
-	var ret []*Rule
 	var collectionBits uint64 = 1
 
+	// Return a single matched rule without allocating a new slice
+
+	if len(ret) == 0 && matchBits&(matchBits-1) == 0 {
+		i := bits.TrailingZeros64(matchBits)
+		return ri.rules[i : i+1 : i+1]
+	}
+
 	// Collect matched rules
 
 	for i := 0; collectionBits <= matchBits; i++ {
@@ -755,16 +1369,20 @@ func (ri *RuleIndexAll) isTriggeringAtLevel(event *Event, level int) bool {
 }
 
 /*
-matchAtLevel returns all rules in this index which match a given event
-at the given level. This method does a full matching check including
-state matching.
+matchAtLevel appends all rules in this index which match a given event
+at the given level to a given slice. This method does a full matching
+check including state matching.
 */
-func (ri *RuleIndexAll) matchAtLevel(event *Event, level int) []*Rule {
+func (ri *RuleIndexAll) matchAtLevel(event *Event, level int, ret []*Rule) []*Rule {
 	if len(event.kind) != level {
-		return nil
+		return ret
+	}
+
+	if len(ret) == 0 {
+		return ri.rules[:len(ri.rules):len(ri.rules)]
 	}
 
-	return ri.rules
+	return append(ret, ri.rules...)
 }
 
 /*
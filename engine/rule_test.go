@@ -14,7 +14,9 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRuleIndexSimple(t *testing.T) {
@@ -507,3 +509,276 @@ func printRules(rules []*Rule) string {
 
 	return fmt.Sprint(ret)
 }
+
+func TestRuleDedup(t *testing.T) {
+	dedup := NewRuleDedup(50*time.Millisecond, []string{"id", "data.val"})
+
+	newEvent := func(state map[interface{}]interface{}) *Event {
+		return NewEvent("test", []string{"foo"}, state)
+	}
+
+	e1 := newEvent(map[interface{}]interface{}{"id": 1, "data": map[interface{}]interface{}{"val": 1, "ts": 1}})
+	e2 := newEvent(map[interface{}]interface{}{"id": 1, "data": map[interface{}]interface{}{"val": 1, "ts": 2}})
+	e3 := newEvent(map[interface{}]interface{}{"id": 1, "data": map[interface{}]interface{}{"val": 2, "ts": 3}})
+	e4 := newEvent(map[interface{}]interface{}{"id": 1, "data": 5})
+
+	if res := fmt.Sprint(dedup.IsDuplicate(e1), dedup.IsDuplicate(e2), dedup.IsDuplicate(e3),
+		dedup.IsDuplicate(e4), dedup.IsDuplicate(e4)); res != "false true false false true" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if res := fmt.Sprint(dedup.IsDuplicate(e2), dedup.IsDuplicate(e1), len(dedup.seen)); res != "false true 1" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Without keys the whole state is compared
+
+	dedup = NewRuleDedup(time.Minute, nil)
+
+	if res := fmt.Sprint(dedup.IsDuplicate(e1), dedup.IsDuplicate(e2), dedup.IsDuplicate(e1)); res != "false false true" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := dedup.String(); res != "Dedup:1m0s []" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestRuleKindParams(t *testing.T) {
+
+	rule := &Rule{
+		Name:       "TestRule",
+		KindMatch:  []string{"order.*.created", "device.{id}.{sensor}", "core.main"},
+		ScopeMatch: []string{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			return nil
+		},
+	}
+
+	index := NewRuleIndex()
+
+	if err := index.AddRule(rule); err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, kind := range []string{"order.123.created", "device.d1.temp", "core.main"} {
+		if res := index.Match(NewEvent("test", strings.Split(kind, "."), nil)); len(res) != 1 {
+			t.Error("Unexpected result:", kind, res)
+			return
+		}
+	}
+
+	for _, kind := range []string{"order.123.deleted", "device.d1", "core.main.foo"} {
+		if res := index.Match(NewEvent("test", strings.Split(kind, "."), nil)); len(res) != 0 {
+			t.Error("Unexpected result:", kind, res)
+			return
+		}
+	}
+
+	for kind, expected := range map[string]string{
+		"order.123.created": "map[1:123]",
+		"device.d1.temp":    "map[id:d1 sensor:temp]",
+		"core.main":         "map[]",
+		"foo.bar":           "map[]",
+	} {
+		if res := fmt.Sprint(rule.KindParams(NewEvent("test", strings.Split(kind, "."), nil))); res != expected {
+			t.Error("Unexpected result:", kind, res)
+			return
+		}
+	}
+
+	if !IsRuleKindWildcard("*") || !IsRuleKindWildcard("{id}") || IsRuleKindWildcard("{}") || IsRuleKindWildcard("id") {
+		t.Error("Unexpected wildcard detection")
+		return
+	}
+}
+
+func TestRuleIndexStateConditionMatch(t *testing.T) {
+
+	newCond := func(spec map[string]interface{}) *RuleStateCondition {
+		cond, err := NewRuleStateCondition(spec)
+		if err != nil {
+			panic(err)
+		}
+		return cond
+	}
+
+	index := NewRuleIndex()
+
+	for name, stateMatch := range map[string]map[string]interface{}{
+		"hot":     {"temp": newCond(map[string]interface{}{">": 30})},
+		"normal":  {"temp": newCond(map[string]interface{}{">=": 10, "<=": 30})},
+		"notok":   {"status": newCond(map[string]interface{}{"not": "ok"})},
+		"known":   {"status": newCond(map[string]interface{}{"in": []interface{}{"ok", "warn"}})},
+		"unknown": {"status": newCond(map[string]interface{}{"notin": []interface{}{"ok", "warn"}})},
+		"sensor":  {"id": newCond(map[string]interface{}{"like": "^s[0-9]+$", "==": "s1"})},
+		"strings": {"status": newCond(map[string]interface{}{"<": "p"})},
+		"plain":   {"status": "ok", "temp": newCond(map[string]interface{}{"<": 0})},
+	} {
+		index.AddRule(&Rule{
+			Name:       name,
+			KindMatch:  []string{"sensor"},
+			ScopeMatch: []string{},
+			StateMatch: stateMatch,
+			Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+				return nil
+			},
+		})
+	}
+
+	match := func(state map[interface{}]interface{}) string {
+		var names []string
+
+		for _, r := range index.Match(NewEvent("test", []string{"sensor"}, state)) {
+			names = append(names, r.Name)
+		}
+
+		sort.Strings(names)
+
+		return fmt.Sprint(names)
+	}
+
+	for expected, state := range map[string]map[interface{}]interface{}{
+		"[hot]":                   {"temp": 31.5},
+		"[normal]":                {"temp": 30},
+		"[]":                      {"temp": "foo"},
+		"[known strings]":         {"status": "ok"},
+		"[known notok]":           {"status": "warn"},
+		"[notok unknown]":         {"status": "unknown"},
+		"[notok strings unknown]": {"status": "fail"},
+		"[sensor]":                {"id": "s1"},
+		"[known plain strings]":   {"status": "ok", "temp": int64(-5)},
+	} {
+		if res := match(state); res != expected {
+			t.Error("Unexpected result:", state, res, "expected:", expected)
+			return
+		}
+	}
+
+	if res := fmt.Sprint(index.Rules()["normal"]); res != `Rule:normal [] (Priority:0 Kind:[sensor] Scope:[] StateMatch:{"temp":{"<=":30,">=":10}} Suppress:[])` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(index.Rules()["normal"].StateMatch["temp"]); res != "<= 30 >= 10" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	for _, spec := range []map[string]interface{}{
+		{},
+		{"foo": 1},
+		{"in": "foo"},
+		{"like": "("},
+	} {
+		if _, err := NewRuleStateCondition(spec); err == nil {
+			t.Error("Error expected for:", spec)
+			return
+		}
+	}
+}
+
+func newMatchTestIndex() RuleIndex {
+	index := NewRuleIndex()
+
+	action := func(p Processor, m Monitor, e *Event, tid uint64) error { return nil }
+
+	index.AddRule(&Rule{Name: "All", KindMatch: []string{"core.*"}, ScopeMatch: []string{}, Action: action})
+	index.AddRule(&Rule{Name: "Main", KindMatch: []string{"core.main"}, ScopeMatch: []string{}, Action: action})
+	index.AddRule(&Rule{Name: "State1", KindMatch: []string{"core.state"}, ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{"name": "foo"}, Action: action})
+	index.AddRule(&Rule{Name: "State2", KindMatch: []string{"core.state"}, ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{"name": "bar"}, Action: action})
+	index.AddRule(&Rule{Name: "State3", KindMatch: []string{"core.state"}, ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{"test": nil}, Action: action})
+
+	return index
+}
+
+func TestRuleIndexMatchAllocations(t *testing.T) {
+	index := newMatchTestIndex()
+
+	ruleNames := func(rules []*Rule) string {
+		var names []string
+		for _, r := range rules {
+			names = append(names, r.Name)
+		}
+		return fmt.Sprint(names)
+	}
+
+	for _, test := range []struct {
+		event  *Event
+		res    string
+		allocs float64
+	}{
+		{NewEvent("e1", []string{"core", "other"}, nil), "[All]", 0},
+		{NewEvent("e2", []string{"core", "state"}, map[interface{}]interface{}{"name": "foo"}), "[All State1]", 1},
+		{NewEvent("e3", []string{"core", "state"}, map[interface{}]interface{}{"name": "bar"}), "[All State2]", 1},
+		{NewEvent("e4", []string{"core", "state", "x"}, nil), "[]", 0},
+		{NewEvent("e5", []string{"core"}, nil), "[]", 0},
+		{NewEvent("e6", []string{"foo", "state"}, nil), "[]", 0},
+	} {
+		if res := ruleNames(index.Match(test.event)); res != test.res {
+			t.Error("Unexpected result:", test.event, res)
+			return
+		}
+
+		if allocs := testing.AllocsPerRun(100, func() { index.Match(test.event) }); allocs != test.allocs {
+			t.Error("Unexpected allocations:", test.event, allocs)
+			return
+		}
+	}
+
+	// A single matching state rule is returned without an allocation
+
+	index = NewRuleIndex()
+	index.AddRule(&Rule{Name: "State1", KindMatch: []string{"core.state"}, ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{"name": "foo"}})
+	index.AddRule(&Rule{Name: "State2", KindMatch: []string{"core.state"}, ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{"name": "bar"}})
+
+	event := NewEvent("e1", []string{"core", "state"}, map[interface{}]interface{}{"name": "bar"})
+
+	res := index.Match(event)
+
+	if ruleNames(res) != "[State2]" {
+		t.Error("Unexpected result:", ruleNames(res))
+		return
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { index.Match(event) }); allocs != 0 {
+		t.Error("Unexpected allocations:", allocs)
+		return
+	}
+
+	// Appending to a returned slice does not modify the index
+
+	_ = append(res, &Rule{Name: "Foo"})
+
+	if res := ruleNames(index.Match(NewEvent("e2", []string{"core", "state"}, map[interface{}]interface{}{"name": "foo"}))); res != "[State1]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func BenchmarkRuleIndexMatch(b *testing.B) {
+	index := newMatchTestIndex()
+
+	events := []*Event{
+		NewEvent("e1", []string{"core", "main"}, nil),
+		NewEvent("e2", []string{"core", "state"}, map[interface{}]interface{}{"name": "foo"}),
+	}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		index.Match(events[i%len(events)])
+	}
+}
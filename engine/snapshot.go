@@ -0,0 +1,214 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/krotik/ecal/engine/pool"
+	"github.com/krotik/ecal/scope"
+)
+
+/*
+processorState is the serializable form of a processor snapshot.
+*/
+type processorState struct {
+	Rules    []*ruleState    `json:"rules"`    // Runtime settings of loaded rules
+	Cascades []*cascadeState `json:"cascades"` // Event cascades with queued tasks
+}
+
+/*
+ruleState contains the runtime settings of a rule.
+*/
+type ruleState struct {
+	Name     string `json:"name"`     // Name of the rule
+	Enabled  bool   `json:"enabled"`  // Flag if the rule is enabled
+	Priority int    `json:"priority"` // Priority of the rule
+}
+
+/*
+cascadeState contains the queued tasks of an event cascade.
+*/
+type cascadeState struct {
+	Scope map[string]bool `json:"scope"` // Rule scope of the cascade
+	Tasks []*taskState    `json:"tasks"` // Queued tasks in processing order
+}
+
+/*
+taskState is the serializable form of a queued task.
+*/
+type taskState struct {
+	Priority int                    `json:"priority"`       // Priority of the task monitor
+	Rule     string                 `json:"rule,omitempty"` // Rule which exclusively handles the event
+	Name     string                 `json:"name"`           // Name of the event
+	Kind     []string               `json:"kind"`           // Kind of the event
+	State    map[string]interface{} `json:"state"`          // State of the event
+}
+
+/*
+SaveState writes a snapshot of the processor state to a given writer. The
+snapshot contains the runtime settings of all loaded rules and all queued
+tasks which have not been processed yet (e.g. after a shutdown which timed
+out). Rule actions, pending delayed events and open collect windows are not
+part of the snapshot. The processor should be stopped to get a consistent
+snapshot.
+*/
+func (p *eventProcessor) SaveState(w io.Writer) error {
+	state := &processorState{[]*ruleState{}, []*cascadeState{}}
+
+	// Collect rule settings
+
+	rules := p.index().Rules()
+	names := make([]string, 0, len(rules))
+
+	for name := range rules {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	p.ruleSettingsLock.RLock()
+
+	for _, name := range names {
+		priority, ok := p.rulePriorities[name]
+		if !ok {
+			priority = rules[name].Priority
+		}
+
+		state.Rules = append(state.Rules, &ruleState{name, !p.disabledRules[name], priority})
+	}
+
+	p.ruleSettingsLock.RUnlock()
+
+	// Collect queued tasks - tasks of the same cascade are grouped together
+
+	var cascade *cascadeState
+	var cascadeID uint64
+
+	for _, t := range p.queue.Pending() {
+		rm := t.m.RootMonitor()
+
+		if cascade == nil || rm.ID() != cascadeID {
+			cascade = &cascadeState{rm.Scope().Definitions(), []*taskState{}}
+			cascadeID = rm.ID()
+			state.Cascades = append(state.Cascades, cascade)
+		}
+
+		ts := &taskState{
+			Priority: t.m.Priority(),
+			Name:     t.e.Name(),
+			Kind:     t.e.Kind(),
+		}
+
+		ts.State, _ = scope.ConvertECALToJSONObject(t.e.State()).(map[string]interface{})
+
+		if t.r != nil {
+			ts.Rule = t.r.Name
+		}
+
+		cascade.Tasks = append(cascade.Tasks, ts)
+	}
+
+	err := json.NewEncoder(w).Encode(state)
+
+	if err != nil {
+		err = fmt.Errorf("Could not save processor state: %v", err)
+	}
+
+	return err
+}
+
+/*
+LoadState restores a snapshot which was written with SaveState. The rules of
+the snapshot must have been loaded (actions are bound by rule name) and the
+processor must be stopped. Settings of rules which are not loaded anymore are
+ignored. Each restored cascade gets a new root monitor. Restored tasks are
+processed once the processor is started.
+*/
+func (p *eventProcessor) LoadState(r io.Reader) error {
+	var state processorState
+
+	if p.pool.Status() != pool.StatusStopped {
+		return fmt.Errorf("Cannot load state if the processor has not stopped")
+	}
+
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return fmt.Errorf("Could not load processor state: %v", err)
+	}
+
+	rules := p.index().Rules()
+
+	// Check that all rules which handle tasks exclusively are loaded
+
+	for _, c := range state.Cascades {
+		for _, t := range c.Tasks {
+			if _, ok := rules[t.Rule]; t.Rule != "" && !ok {
+				return fmt.Errorf("Unknown rule: %v", t.Rule)
+			}
+		}
+	}
+
+	// Restore rule settings
+
+	p.ruleSettingsLock.Lock()
+
+	for _, rs := range state.Rules {
+		if rule, ok := rules[rs.Name]; ok {
+
+			if rs.Enabled {
+				delete(p.disabledRules, rs.Name)
+			} else {
+				p.disabledRules[rs.Name] = true
+			}
+
+			if rs.Priority != rule.Priority {
+				p.rulePriorities[rs.Name] = rs.Priority
+			} else {
+				delete(p.rulePriorities, rs.Name)
+			}
+		}
+	}
+
+	p.ruleSettingsLock.Unlock()
+
+	// Restore queued tasks - the first task of a cascade is handled by the root
+	// monitor all following tasks by child monitors
+
+	for _, c := range state.Cascades {
+		rm := p.NewRootMonitor(nil, NewRuleScope(c.Scope))
+
+		for i, t := range c.Tasks {
+			var m Monitor = rm
+
+			if i > 0 {
+				m = rm.NewChildMonitor(t.Priority)
+			}
+
+			eventState, _ := scope.ConvertJSONToECALObject(t.State).(map[interface{}]interface{})
+			if eventState == nil {
+				eventState = map[interface{}]interface{}{}
+			}
+
+			event := NewEvent(t.Name, t.Kind, eventState)
+
+			m.Activate(event)
+
+			EventTracer.record(event, "eventProcessor.LoadState", "Restoring task")
+
+			p.pool.AddTask(newTask(p, m, event, rules[t.Rule]))
+		}
+	}
+
+	return nil
+}
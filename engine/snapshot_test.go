@@ -0,0 +1,223 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProcessorSnapshot(t *testing.T) {
+	var res []string
+	var lock sync.Mutex
+
+	newProc := func() *eventProcessor {
+		proc := NewDeterministicProcessor()
+
+		for i, name := range []string{"Rule1", "Rule2"} {
+			ruleName := name
+
+			proc.AddRule(&Rule{
+				Name:            name,
+				KindMatch:       []string{"core.*"},
+				ScopeMatch:      []string{},
+				StateMatch:      map[string]interface{}{},
+				Priority:        i,
+				SuppressionList: nil,
+				Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+					lock.Lock()
+					defer lock.Unlock()
+					res = append(res, fmt.Sprintf("%v:%v:%v", ruleName, e.Name(), e.State()["val"]))
+					return nil
+				},
+			})
+		}
+
+		return proc.(*eventProcessor)
+	}
+
+	proc := newProc()
+
+	proc.SetRuleEnabled("Rule1", false)
+	proc.SetRulePriority("Rule2", 5)
+
+	// Queue tasks of two cascades without processing them
+
+	rm := proc.NewRootMonitor(nil, nil)
+	e1 := NewEvent("event1", []string{"core", "main"}, map[interface{}]interface{}{"val": 1.0})
+	rm.Activate(e1)
+	proc.pool.AddTask(&Task{proc, rm, e1, nil})
+
+	m := rm.NewChildMonitor(2)
+	e2 := NewEvent("event2", []string{"core", "main"}, map[interface{}]interface{}{
+		"val": []interface{}{"a", map[interface{}]interface{}{1: "b"}}})
+	m.Activate(e2)
+	proc.pool.AddTask(&Task{proc, m, e2, nil})
+
+	rm2 := proc.NewRootMonitor(nil, NewRuleScope(map[string]bool{"data": true, "data.write": false}))
+	e3 := NewEvent("event3", []string{"core", "main"}, nil)
+	rm2.Activate(e3)
+	proc.pool.AddTask(&Task{proc, rm2, e3, proc.Rules()["Rule1"]})
+
+	var buf bytes.Buffer
+
+	if err := proc.SaveState(&buf); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := strings.TrimSpace(buf.String()); s != `{"rules":[{"name":"Rule1","enabled":false,"priority":0},`+
+		`{"name":"Rule2","enabled":true,"priority":5}],"cascades":[{"scope":{"":true},"tasks":[`+
+		`{"priority":0,"name":"event1","kind":["core","main"],"state":{"val":1}},`+
+		`{"priority":2,"name":"event2","kind":["core","main"],"state":{"val":["a",{"1":"b"}]}}]},`+
+		`{"scope":{"data":true,"data.write":false},"tasks":[`+
+		`{"priority":0,"rule":"Rule1","name":"event3","kind":["core","main"],"state":{}}]}]}` {
+		t.Error("Unexpected result:", s)
+		return
+	}
+
+	// Saving does not change the queue
+
+	if s := proc.queue.Size(); s != 3 {
+		t.Error("Unexpected result:", s)
+		return
+	}
+
+	// Restore the snapshot in a new processor
+
+	proc2 := newProc()
+
+	proc2.Start()
+
+	if err := proc2.LoadState(bytes.NewReader(buf.Bytes())); err == nil ||
+		err.Error() != "Cannot load state if the processor has not stopped" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	proc2.Finish()
+
+	if err := proc2.LoadState(strings.NewReader("{")); err == nil ||
+		err.Error() != "Could not load processor state: unexpected EOF" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := proc2.LoadState(strings.NewReader(`{"cascades":[{"tasks":[{"rule":"Rule3"}]}]}`)); err == nil ||
+		err.Error() != "Unknown rule: Rule3" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := proc2.LoadState(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if r := proc2.Rules()["Rule2"].String(); !strings.Contains(r, "Priority:1 ") {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	var buf2 bytes.Buffer
+
+	proc2.SaveState(&buf2)
+
+	if buf2.String() != buf.String() {
+		t.Error("Unexpected result:", buf2.String())
+		return
+	}
+
+	proc2.Start()
+	proc2.Finish()
+
+	// Rule1 is disabled but still handles the event which was assigned to it
+
+	if r := fmt.Sprint(res); r != "[Rule2:event1:1 Rule2:event2:[a map[1:b]] Rule1:event3:<nil>]" {
+		t.Error("Unexpected result:", r)
+		return
+	}
+
+	// Values which cannot be serialized cause an error
+
+	proc3 := newProc()
+
+	rm = proc3.NewRootMonitor(nil, nil)
+	e1 = NewEvent("event1", []string{"core", "main"}, map[interface{}]interface{}{"val": func() {}})
+	rm.Activate(e1)
+	proc3.pool.AddTask(&Task{proc3, rm, e1, nil})
+
+	if err := proc3.SaveState(&buf); err == nil ||
+		err.Error() != "Could not save processor state: json: unsupported type: func()" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestSnapshotOfRunningProcessor(t *testing.T) {
+	proc := NewProcessor(4)
+
+	proc.AddRule(&Rule{
+		Name:       "Rule1",
+		KindMatch:  []string{"core.*"},
+		ScopeMatch: []string{},
+		StateMatch: map[string]interface{}{},
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			return nil
+		},
+	})
+
+	proc.Start()
+	defer proc.Finish()
+
+	done := make(chan bool)
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 1000; i++ {
+			proc.AddEvent(NewEvent("event", []string{"core", "main"},
+				map[interface{}]interface{}{"val": i}), nil)
+		}
+	}()
+
+	// Tasks which run while a snapshot is written are not affected by the snapshot
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+
+		if err := proc.SaveState(&bytes.Buffer{}); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+}
+
+func TestRuleScopeDefinitions(t *testing.T) {
+	rs := NewRuleScope(map[string]bool{"": true, "core.data": false, "core.data.read": true})
+
+	if res := fmt.Sprint(rs.Definitions()); res != "map[:true core.data:false core.data.read:true]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(NewRuleScope(rs.Definitions()).IsAllowed("core.data.write")); res != "false" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -0,0 +1,333 @@
+//go:build kafka
+// +build kafka
+
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package source
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krotik/ecal/engine"
+	"github.com/segmentio/kafka-go"
+)
+
+/*
+Default settings of a Kafka source
+*/
+const (
+	KafkaDefaultGroupID    = "ecal"
+	KafkaDefaultMaxPending = 100
+	kafkaDialTimeout       = 10 * time.Second
+)
+
+/*
+KafkaReader reads and commits messages of a consumer group.
+*/
+type KafkaReader interface {
+
+	/*
+		FetchMessage reads the next message.
+	*/
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+
+	/*
+		CommitMessages commits the offsets of the given messages.
+	*/
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+
+	/*
+		Close closes the reader.
+	*/
+	Close() error
+}
+
+/*
+KafkaWriter writes messages to Kafka topics.
+*/
+type KafkaWriter interface {
+
+	/*
+		WriteMessages writes the given messages.
+	*/
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+
+	/*
+		Close closes the writer.
+	*/
+	Close() error
+}
+
+/*
+KafkaSource consumes a list of Kafka topics as part of a consumer group. Every
+message is added as an event to a processor. The event name is the topic and
+the event kind is "kafka" followed by the dot separated segments of the topic
+(e.g. topic orders.created has the kind kafka.orders.created). The event state
+contains the topic in "topic", the partition in "partition", the offset in
+"offset", the message key in "key" and the message data in "data" (JSON data
+is decoded).
+
+The offset of a message is committed once the event cascade of the message has
+finished. Offsets are committed in the order in which messages were fetched. If
+a message could not be added as an event then no further offsets of its
+partition are committed - the message and all following messages of the
+partition are delivered again once the consumer group restarts or rebalances.
+At most MaxPending messages are processed at the same time - the source stops
+fetching messages until the processor has caught up.
+*/
+type KafkaSource struct {
+	Processor   engine.Processor // Processor which receives the events
+	Brokers     []string         // Addresses of Kafka brokers (e.g. localhost:9092)
+	GroupID     string           // Consumer group ID
+	Topics      []string         // Topics to consume
+	MaxPending  int              // Maximum number of messages which are processed at the same time
+	StartOffset int64            // Offset for new consumer groups (kafka.FirstOffset or kafka.LastOffset)
+	Reader      KafkaReader      // Optional: Reader for messages (created on start if not set)
+	Writer      KafkaWriter      // Optional: Writer for messages (created on start if not set)
+
+	cancel  context.CancelFunc // Function to stop fetching messages
+	running bool               // Flag if the source is running
+	lock    *sync.Mutex        // Lock for the running state
+	wg      *sync.WaitGroup    // Wait group for the fetch and commit loops
+}
+
+/*
+kafkaPending is a message which is processed by the processor.
+*/
+type kafkaPending struct {
+	msg    kafka.Message // Fetched message
+	done   chan struct{} // Channel which is closed once processing has finished
+	commit bool          // Flag if the message offset should be committed
+}
+
+/*
+NewKafkaSource creates a new Kafka event source.
+*/
+func NewKafkaSource(proc engine.Processor, brokers []string, groupID string, topics []string) *KafkaSource {
+	return &KafkaSource{proc, brokers, groupID, topics, KafkaDefaultMaxPending, kafka.FirstOffset,
+		nil, nil, nil, false, &sync.Mutex{}, &sync.WaitGroup{}}
+}
+
+/*
+Start starts consuming messages.
+*/
+func (ks *KafkaSource) Start() error {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if ks.running {
+		return fmt.Errorf("Kafka source is already running")
+	}
+
+	if (ks.Reader == nil && len(ks.Topics) > 0) || ks.Writer == nil {
+
+		if len(ks.Brokers) == 0 {
+			return fmt.Errorf("No Kafka brokers given")
+		}
+
+		// Make sure that the brokers can be reached
+
+		ctx, cancel := context.WithTimeout(context.Background(), kafkaDialTimeout)
+		defer cancel()
+
+		conn, err := kafka.DialContext(ctx, "tcp", ks.Brokers[0])
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	}
+
+	if ks.Reader == nil && len(ks.Topics) > 0 {
+
+		if ks.GroupID == "" {
+			return fmt.Errorf("No Kafka consumer group ID given")
+		}
+
+		ks.Reader = kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     ks.Brokers,
+			GroupID:     ks.GroupID,
+			GroupTopics: ks.Topics,
+			StartOffset: ks.StartOffset,
+		})
+	}
+
+	if ks.Writer == nil {
+		ks.Writer = &kafka.Writer{
+			Addr:     kafka.TCP(ks.Brokers...),
+			Balancer: &kafka.Hash{},
+		}
+	}
+
+	ks.running = true
+
+	if ks.Reader != nil {
+		var ctx context.Context
+
+		maxPending := ks.MaxPending
+		if maxPending < 1 {
+			maxPending = 1
+		}
+
+		pending := make(chan *kafkaPending, maxPending)
+
+		ctx, ks.cancel = context.WithCancel(context.Background())
+
+		ks.wg.Add(2)
+
+		go ks.fetchLoop(ctx, pending)
+		go ks.commitLoop(pending)
+	}
+
+	return nil
+}
+
+/*
+Stop stops consuming messages. Messages which are currently processed are
+committed before the source stops.
+*/
+func (ks *KafkaSource) Stop() error {
+	var err error
+
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if !ks.running {
+		return fmt.Errorf("Kafka source is not running")
+	}
+
+	if ks.cancel != nil {
+		ks.cancel()
+		ks.wg.Wait()
+		ks.cancel = nil
+	}
+
+	if ks.Reader != nil {
+		err = ks.Reader.Close()
+	}
+
+	if werr := ks.Writer.Close(); err == nil {
+		err = werr
+	}
+
+	ks.running = false
+
+	return err
+}
+
+/*
+Publish writes a message with an optional key to a topic.
+*/
+func (ks *KafkaSource) Publish(topic string, key []byte, payload []byte) error {
+	ks.lock.Lock()
+	running := ks.running
+	ks.lock.Unlock()
+
+	if !running {
+		return fmt.Errorf("Kafka source is not running")
+	}
+
+	return ks.Writer.WriteMessages(context.Background(), kafka.Message{
+		Topic: topic,
+		Key:   key,
+		Value: payload,
+	})
+}
+
+/*
+fetchLoop fetches messages and adds them as events until the context is cancelled.
+*/
+func (ks *KafkaSource) fetchLoop(ctx context.Context, pending chan *kafkaPending) {
+	defer ks.wg.Done()
+	defer close(pending)
+
+	for {
+		msg, err := ks.Reader.FetchMessage(ctx)
+		if err != nil {
+			return
+		}
+
+		p := &kafkaPending{msg, make(chan struct{}), false}
+
+		// Adding to the pending channel blocks if too many messages are processed
+
+		select {
+		case pending <- p:
+		case <-ctx.Done():
+			return
+		}
+
+		go ks.processMessage(p)
+	}
+}
+
+/*
+processMessage adds a message as event and waits for the event cascade to finish.
+*/
+func (ks *KafkaSource) processMessage(p *kafkaPending) {
+	kind := []string{"kafka"}
+
+	for _, s := range strings.Split(p.msg.Topic, ".") {
+		if s != "" {
+			kind = append(kind, s)
+		}
+	}
+
+	event := engine.NewEvent(p.msg.Topic, kind, map[interface{}]interface{}{
+		"topic":     p.msg.Topic,
+		"partition": float64(p.msg.Partition),
+		"offset":    float64(p.msg.Offset),
+		"key":       string(p.msg.Key),
+		"data":      DecodeMessage(p.msg.Value),
+	})
+
+	// Messages which could not be added (e.g. the processor is stopped) are not committed
+
+	_, err := ks.Processor.AddEventAndWait(event, nil)
+
+	p.commit = err == nil
+	close(p.done)
+}
+
+/*
+kafkaPartition identifies a partition of a topic.
+*/
+type kafkaPartition struct {
+	topic     string
+	partition int
+}
+
+/*
+commitLoop commits the offsets of processed messages in the order in which they
+were fetched. Offsets are cumulative - committing the offset of a message also
+acknowledges all previous messages of its partition. Offsets of a partition are
+therefore no longer committed once a message of the partition has failed.
+*/
+func (ks *KafkaSource) commitLoop(pending chan *kafkaPending) {
+	defer ks.wg.Done()
+
+	failed := make(map[kafkaPartition]bool)
+
+	for p := range pending {
+		<-p.done
+
+		partition := kafkaPartition{p.msg.Topic, p.msg.Partition}
+
+		if !p.commit {
+			failed[partition] = true
+		} else if !failed[partition] {
+			ks.Reader.CommitMessages(context.Background(), p.msg)
+		}
+	}
+}
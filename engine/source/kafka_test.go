@@ -0,0 +1,261 @@
+//go:build kafka
+// +build kafka
+
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package source
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krotik/ecal/engine"
+	"github.com/segmentio/kafka-go"
+)
+
+/*
+testKafkaClient is a reader and writer which sends all written messages back
+to the reader and records committed offsets.
+*/
+type testKafkaClient struct {
+	messages  chan kafka.Message
+	committed chan int64
+	lock      *sync.Mutex
+	offset    int64
+	closed    int
+}
+
+func newTestKafkaClient() *testKafkaClient {
+	return &testKafkaClient{make(chan kafka.Message, 10), make(chan int64, 10), &sync.Mutex{}, 0, 0}
+}
+
+func (c *testKafkaClient) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-c.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (c *testKafkaClient) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		c.committed <- msg.Offset
+	}
+	return nil
+}
+
+func (c *testKafkaClient) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, msg := range msgs {
+		c.offset++
+		msg.Offset = c.offset
+		c.messages <- msg
+	}
+	return nil
+}
+
+func (c *testKafkaClient) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.closed++
+	return nil
+}
+
+func TestKafkaSource(t *testing.T) {
+	events := make(chan *engine.Event, 10)
+	release := make(chan bool)
+
+	proc := engine.NewProcessor(2)
+
+	proc.AddRule(&engine.Rule{
+		Name:       "TestRule",
+		KindMatch:  []string{"kafka.orders.*"},
+		ScopeMatch: []string{},
+		Action: func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error {
+			events <- e
+			<-release
+			return nil
+		},
+	})
+
+	proc.Start()
+	defer proc.Finish()
+
+	client := newTestKafkaClient()
+
+	src := NewKafkaSource(proc, nil, "mygroup", []string{"orders.created"})
+	src.MaxPending = 1
+	src.Reader = client
+	src.Writer = client
+
+	if err := src.Stop(); err == nil || err.Error() != "Kafka source is not running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := src.Publish("foo", nil, nil); err == nil || err.Error() != "Kafka source is not running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := src.Start(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := src.Start(); err == nil || err.Error() != "Kafka source is already running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := src.Publish("orders.created", []byte(fmt.Sprint("key", i)),
+			[]byte(fmt.Sprintf(`{"value":%v}`, i))); err != nil {
+			t.Error("Unexpected result:", err)
+			return
+		}
+	}
+
+	var received []*engine.Event
+
+	received = append(received, <-events)
+
+	// Only a limited number of messages should have been fetched
+
+	time.Sleep(100 * time.Millisecond)
+
+	if l := len(client.messages); l == 0 {
+		t.Error("All messages were fetched")
+		return
+	}
+
+	if l := len(client.committed); l != 0 {
+		t.Error("Unexpected number of committed messages:", l)
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		release <- true
+		received = append(received, <-events)
+	}
+
+	release <- true
+
+	sort.Slice(received, func(i, j int) bool {
+		return fmt.Sprint(received[i].State()["key"]) < fmt.Sprint(received[j].State()["key"])
+	})
+
+	if res := fmt.Sprint(received[0]); res !=
+		`Event: orders.created kafka.orders.created {"data":{"value":0},"key":"key0","offset":1,"partition":0,"topic":"orders.created"}` {
+		t.Error("Unexpected event:", res)
+		return
+	}
+
+	if res := fmt.Sprint(received[3].State()["key"]); res != "key3" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	for i := int64(1); i < 5; i++ {
+		if res := <-client.committed; res != i {
+			t.Error("Unexpected committed offset:", res)
+			return
+		}
+	}
+
+	if err := src.Stop(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if client.closed != 2 {
+		t.Error("Unexpected result:", client.closed)
+		return
+	}
+}
+
+func TestKafkaSourceErrors(t *testing.T) {
+	proc := engine.NewProcessor(1)
+
+	client := newTestKafkaClient()
+
+	src := NewKafkaSource(proc, nil, "mygroup", []string{"orders"})
+	src.Reader = client
+	src.Writer = client
+
+	if err := src.Start(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Messages which cannot be added to a stopped processor are not committed
+
+	src.Publish("orders", nil, []byte("foo"))
+
+	time.Sleep(100 * time.Millisecond)
+
+	proc.Start()
+	defer proc.Finish()
+
+	// Later messages of the same partition are not committed either since
+	// this would also acknowledge the failed message
+
+	src.Publish("orders", nil, []byte("bar"))
+	client.messages <- kafka.Message{Topic: "orders", Partition: 1, Offset: 10, Value: []byte("baz")}
+
+	select {
+	case res := <-client.committed:
+		if res != 10 {
+			t.Error("Unexpected committed offset:", res)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("No offset was committed")
+		return
+	}
+
+	if err := src.Stop(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if l := len(client.committed); l != 0 {
+		t.Error("Unexpected number of committed messages:", l)
+		return
+	}
+
+	src = NewKafkaSource(proc, nil, "mygroup", []string{"orders"})
+
+	if err := src.Start(); err == nil || err.Error() != "No Kafka brokers given" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	l, _ := net.Listen("tcp", "localhost:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	src = NewKafkaSource(proc, []string{addr}, "mygroup", []string{"orders"})
+
+	if err := src.Start(); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
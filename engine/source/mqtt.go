@@ -0,0 +1,501 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krotik/ecal/engine"
+)
+
+/*
+MQTT control packet types (MQTT 3.1.1)
+*/
+const (
+	mqttCONNECT     = 1
+	mqttCONNACK     = 2
+	mqttPUBLISH     = 3
+	mqttPUBACK      = 4
+	mqttSUBSCRIBE   = 8
+	mqttSUBACK      = 9
+	mqttPINGREQ     = 12
+	mqttPINGRESP    = 13
+	mqttDISCONNECT  = 14
+	mqttKeepAlive   = 60 // Keep alive interval in seconds
+	mqttDialTimeout = 10 * time.Second
+)
+
+/*
+MQTTSource connects to an MQTT broker and subscribes to a list of topics. Every
+message which is received is added as an event to a processor. The event name
+is the topic and the event kind is "mqtt" followed by the topic segments
+(e.g. topic home/kitchen/temp has the kind mqtt.home.kitchen.temp). The event
+state contains the topic in "topic" and the message data in "data" (JSON data
+is decoded). The connection of the source can also be used to publish messages.
+Only QoS level 0 (at most once delivery) is supported for publishing and subscribing.
+If the connection to the broker is lost then an event of kind source.mqtt.lost
+is added (see MQTTLostKind) and the source stops. It can be started again to
+reconnect.
+*/
+type MQTTSource struct {
+	Processor engine.Processor // Processor which receives the events
+	Address   string           // Address of the MQTT broker (e.g. localhost:1883)
+	ClientID  string           // Client ID for the broker
+	Topics    []string         // Topic filters to subscribe to
+	Username  string           // Optional: Username for the broker
+	Password  string           // Optional: Password for the broker
+
+	conn      net.Conn      // Connection to the broker (nil if there is no connection)
+	writeLock *sync.Mutex   // Lock for the connection
+	stop      chan bool     // Channel to stop the read and keep alive loops (nil if not running)
+	stopped   chan struct{} // Channel which is closed once the keep alive loop ended
+	packetID  uint16        // Counter for packet IDs
+	lock      *sync.Mutex   // Lock for the running state
+	closed    chan struct{} // Channel which is closed once the read loop ended
+}
+
+/*
+MQTTLostKind is the kind of events which report that an MQTT source lost the
+connection to its broker. The event has the address of the broker as name.
+Its state contains the address under "address", the client ID under
+"clientID" and the error which ended the connection under "error".
+*/
+var MQTTLostKind = []string{"source", "mqtt", "lost"}
+
+/*
+NewMQTTSource creates a new MQTT event source.
+*/
+func NewMQTTSource(proc engine.Processor, address string, clientID string, topics []string) *MQTTSource {
+	return &MQTTSource{proc, address, clientID, topics, "", "", nil, &sync.Mutex{},
+		nil, nil, 0, &sync.Mutex{}, nil}
+}
+
+/*
+Start connects to the broker and subscribes to all topics.
+*/
+func (ms *MQTTSource) Start() error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.stop != nil {
+		select {
+		case <-ms.closed:
+
+			// The connection was lost - clean up before reconnecting
+
+			ms.shutdown()
+
+		default:
+			return fmt.Errorf("MQTT source is already running")
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", ms.Address, mqttDialTimeout)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+
+	ms.writeLock.Lock()
+	ms.conn = conn
+	ms.writeLock.Unlock()
+
+	if err = ms.connect(conn, reader); err == nil && len(ms.Topics) > 0 {
+		err = ms.subscribe(conn, reader)
+	}
+
+	if err != nil {
+		ms.writeLock.Lock()
+		conn.Close()
+		ms.conn = nil
+		ms.writeLock.Unlock()
+
+		return err
+	}
+
+	ms.stop = make(chan bool)
+	ms.stopped = make(chan struct{})
+	ms.closed = make(chan struct{})
+
+	go ms.readLoop(conn, reader, ms.stop, ms.closed)
+	go ms.keepAlive(conn, ms.stop, ms.stopped)
+
+	return nil
+}
+
+/*
+Stop disconnects from the broker.
+*/
+func (ms *MQTTSource) Stop() error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.stop == nil {
+		return fmt.Errorf("MQTT source is not running")
+	}
+
+	return ms.shutdown()
+}
+
+/*
+shutdown stops the keep alive loop, disconnects from the broker (if the
+connection was not lost) and waits for the read loop to end. The lock of the
+source must be held.
+*/
+func (ms *MQTTSource) shutdown() error {
+	var err error
+
+	close(ms.stop)
+	<-ms.stopped
+
+	ms.writeLock.Lock()
+
+	if ms.conn != nil {
+		ms.conn.Write(encodeMQTTPacket(mqttDISCONNECT<<4, nil))
+		err = ms.conn.Close()
+		ms.conn = nil
+	}
+
+	ms.writeLock.Unlock()
+
+	// The read loop might still need the write lock to acknowledge a message
+
+	<-ms.closed
+
+	ms.stop = nil
+
+	return err
+}
+
+/*
+Publish publishes a message to a topic.
+*/
+func (ms *MQTTSource) Publish(topic string, payload []byte) error {
+	var buf bytes.Buffer
+
+	writeMQTTString(&buf, topic)
+	buf.Write(payload)
+
+	return ms.writePacket(mqttPUBLISH<<4, buf.Bytes())
+}
+
+/*
+connect sends the CONNECT packet and waits for the acknowledgement.
+*/
+func (ms *MQTTSource) connect(conn net.Conn, reader *bufio.Reader) error {
+	var buf bytes.Buffer
+
+	flags := byte(0x02) // Clean session
+
+	if ms.Username != "" {
+		flags |= 0x80
+	}
+	if ms.Password != "" {
+		flags |= 0x40
+	}
+
+	writeMQTTString(&buf, "MQTT")
+	buf.WriteByte(4) // Protocol level 3.1.1
+	buf.WriteByte(flags)
+	binary.Write(&buf, binary.BigEndian, uint16(mqttKeepAlive))
+	writeMQTTString(&buf, ms.ClientID)
+
+	if ms.Username != "" {
+		writeMQTTString(&buf, ms.Username)
+	}
+	if ms.Password != "" {
+		writeMQTTString(&buf, ms.Password)
+	}
+
+	err := ms.writePacket(mqttCONNECT<<4, buf.Bytes())
+
+	if err == nil {
+		var header byte
+		var data []byte
+
+		conn.SetReadDeadline(time.Now().Add(mqttDialTimeout))
+		defer conn.SetReadDeadline(time.Time{})
+
+		if header, data, err = readMQTTPacket(reader); err == nil {
+			if header>>4 != mqttCONNACK || len(data) != 2 {
+				err = fmt.Errorf("Unexpected response from MQTT broker")
+			} else if data[1] != 0 {
+				err = fmt.Errorf("MQTT broker refused connection (code %v)", data[1])
+			}
+		}
+	}
+
+	return err
+}
+
+/*
+subscribe sends a SUBSCRIBE packet for all topics and waits for the acknowledgement.
+*/
+func (ms *MQTTSource) subscribe(conn net.Conn, reader *bufio.Reader) error {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, ms.nextPacketID())
+
+	for _, topic := range ms.Topics {
+		writeMQTTString(&buf, topic)
+		buf.WriteByte(0) // QoS 0
+	}
+
+	err := ms.writePacket(mqttSUBSCRIBE<<4|0x02, buf.Bytes())
+
+	if err == nil {
+		var header byte
+		var data []byte
+
+		conn.SetReadDeadline(time.Now().Add(mqttDialTimeout))
+		defer conn.SetReadDeadline(time.Time{})
+
+		if header, data, err = readMQTTPacket(reader); err == nil {
+			if header>>4 != mqttSUBACK || len(data) != 2+len(ms.Topics) {
+				err = fmt.Errorf("Unexpected response from MQTT broker")
+			} else {
+				for i, code := range data[2:] {
+					if code == 0x80 {
+						err = fmt.Errorf("MQTT broker refused subscription to %v", ms.Topics[i])
+					}
+				}
+			}
+		}
+	}
+
+	return err
+}
+
+/*
+readLoop reads packets from the broker until the connection is closed. If the
+source was not stopped then the connection was lost and an event is added
+which reports the loss.
+*/
+func (ms *MQTTSource) readLoop(conn net.Conn, reader *bufio.Reader, stop chan bool, closed chan struct{}) {
+	var header byte
+	var data []byte
+	var err error
+
+	defer close(closed)
+
+	for err == nil {
+
+		// The broker answers the regular ping requests - a connection
+		// which stays silent for longer has been lost
+
+		conn.SetReadDeadline(time.Now().Add(mqttKeepAlive * 3 / 2 * time.Second))
+
+		if header, data, err = readMQTTPacket(reader); err == nil && header>>4 == mqttPUBLISH {
+			ms.handlePublish(header, data)
+		}
+	}
+
+	select {
+	case <-stop:
+		return
+	default:
+	}
+
+	ms.writeLock.Lock()
+
+	if ms.conn == conn {
+		conn.Close()
+		ms.conn = nil
+	}
+
+	ms.writeLock.Unlock()
+
+	if !ms.Processor.Stopped() {
+		event := engine.NewEvent(ms.Address, MQTTLostKind, map[interface{}]interface{}{
+			"address":  ms.Address,
+			"clientID": ms.ClientID,
+			"error":    err.Error(),
+		})
+
+		ms.Processor.AddEvent(event, ms.Processor.NewRootMonitor(nil, nil))
+	}
+}
+
+/*
+handlePublish handles an incoming PUBLISH packet.
+*/
+func (ms *MQTTSource) handlePublish(header byte, data []byte) {
+	if len(data) < 2 {
+		return
+	}
+
+	topicLen := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+topicLen {
+		return
+	}
+
+	topic := string(data[2 : 2+topicLen])
+	payload := data[2+topicLen:]
+
+	if qos := (header >> 1) & 0x03; qos > 0 && len(payload) >= 2 {
+
+		// Acknowledge messages which were sent with a higher QoS level
+
+		if qos == 1 {
+			ms.writePacket(mqttPUBACK<<4, payload[:2])
+		}
+
+		payload = payload[2:]
+	}
+
+	if !ms.Processor.Stopped() {
+		kind := []string{"mqtt"}
+
+		for _, s := range strings.Split(topic, "/") {
+			if s != "" {
+				kind = append(kind, s)
+			}
+		}
+
+		event := engine.NewEvent(topic, kind, map[interface{}]interface{}{
+			"topic": topic,
+			"data":  DecodeMessage(payload),
+		})
+
+		ms.Processor.AddEvent(event, ms.Processor.NewRootMonitor(nil, nil))
+	}
+}
+
+/*
+keepAlive sends regular ping requests to the broker. The connection is closed
+if a request cannot be sent - the read loop then reports the lost connection.
+*/
+func (ms *MQTTSource) keepAlive(conn net.Conn, stop chan bool, stopped chan struct{}) {
+	ticker := time.NewTicker(mqttKeepAlive / 2 * time.Second)
+
+	defer close(stopped)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := ms.writePacket(mqttPINGREQ<<4, nil); err != nil {
+				conn.Close()
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+/*
+nextPacketID returns the next packet ID.
+*/
+func (ms *MQTTSource) nextPacketID() uint16 {
+	ms.packetID++
+	if ms.packetID == 0 {
+		ms.packetID = 1
+	}
+	return ms.packetID
+}
+
+/*
+writePacket writes a control packet to the broker.
+*/
+func (ms *MQTTSource) writePacket(header byte, data []byte) error {
+	ms.writeLock.Lock()
+	defer ms.writeLock.Unlock()
+
+	if ms.conn == nil {
+		return fmt.Errorf("MQTT source is not running")
+	}
+
+	_, err := ms.conn.Write(encodeMQTTPacket(header, data))
+
+	return err
+}
+
+/*
+encodeMQTTPacket encodes a control packet.
+*/
+func encodeMQTTPacket(header byte, data []byte) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteByte(header)
+
+	// Encode remaining length
+
+	l := len(data)
+	for {
+		b := byte(l % 128)
+		l /= 128
+		if l > 0 {
+			b |= 0x80
+		}
+		buf.WriteByte(b)
+		if l == 0 {
+			break
+		}
+	}
+
+	buf.Write(data)
+
+	return buf.Bytes()
+}
+
+/*
+readMQTTPacket reads a control packet.
+*/
+func readMQTTPacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Decode remaining length
+
+	var l, multiplier = 0, 1
+
+	for i := 0; ; i++ {
+		var b byte
+
+		if b, err = reader.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+
+		l += int(b&0x7f) * multiplier
+		multiplier *= 128
+
+		if b&0x80 == 0 {
+			break
+		} else if i == 3 {
+			return 0, nil, fmt.Errorf("Invalid MQTT packet length")
+		}
+	}
+
+	data := make([]byte, l)
+	_, err = io.ReadFull(reader, data)
+
+	return header, data, err
+}
+
+/*
+writeMQTTString writes a length prefixed string.
+*/
+func writeMQTTString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
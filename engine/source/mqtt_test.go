@@ -0,0 +1,327 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/krotik/ecal/engine"
+)
+
+/*
+testMQTTBroker is a minimal broker which accepts a single client. Published
+messages are recorded and sent back to the client (as QoS 1 messages). The
+broker drops the connection if a message is published to a topic which
+contains "drop".
+*/
+type testMQTTBroker struct {
+	listener  net.Listener
+	connect   []byte
+	subscribe []byte
+	published chan string
+	connAck   byte
+}
+
+func newTestMQTTBroker(connAck byte) *testMQTTBroker {
+	l, _ := net.Listen("tcp", "localhost:0")
+	b := &testMQTTBroker{l, nil, nil, make(chan string, 10), connAck}
+	go b.run()
+	return b
+}
+
+func (b *testMQTTBroker) run() {
+	conn, err := b.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		header, data, err := readMQTTPacket(reader)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case mqttCONNECT:
+			b.connect = data
+			conn.Write(encodeMQTTPacket(mqttCONNACK<<4, []byte{0, b.connAck}))
+		case mqttSUBSCRIBE:
+			b.subscribe = data
+			ack := []byte{data[0], data[1]}
+			for i := 2; i < len(data); i += int(data[i])<<8 | int(data[i+1]) + 3 {
+				ack = append(ack, 0)
+			}
+			if bytes.Contains(data, []byte("forbidden")) {
+				ack[2] = 0x80
+			}
+			conn.Write(encodeMQTTPacket(mqttSUBACK<<4, ack))
+		case mqttPUBLISH:
+			if bytes.Contains(data, []byte("drop")) {
+				return
+			}
+
+			b.published <- fmt.Sprintf("%x", data)
+
+			// Send back as QoS 1 message with packet id 1
+
+			topicLen := int(data[0])<<8 | int(data[1])
+			msg := append([]byte{}, data[:2+topicLen]...)
+			msg = append(msg, 0, 1)
+			msg = append(msg, data[2+topicLen:]...)
+			conn.Write(encodeMQTTPacket(mqttPUBLISH<<4|0x02, msg))
+		case mqttPUBACK:
+			b.published <- fmt.Sprintf("puback %x", data)
+		case mqttDISCONNECT:
+			b.published <- "disconnect"
+			return
+		}
+	}
+}
+
+func TestMQTTSource(t *testing.T) {
+	events := make(chan *engine.Event, 10)
+
+	proc := engine.NewProcessor(1)
+
+	proc.AddRule(&engine.Rule{
+		Name:       "TestRule",
+		KindMatch:  []string{"mqtt.home.*.*"},
+		ScopeMatch: []string{},
+		Action: func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error {
+			events <- e
+			return nil
+		},
+	})
+
+	proc.Start()
+	defer proc.Finish()
+
+	broker := newTestMQTTBroker(0)
+	defer broker.listener.Close()
+
+	src := NewMQTTSource(proc, broker.listener.Addr().String(), "myclient", []string{"home/#"})
+	src.Username = "foo"
+	src.Password = "bar"
+
+	if err := src.Stop(); err == nil || err.Error() != "MQTT source is not running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := src.Publish("foo", nil); err == nil || err.Error() != "MQTT source is not running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := src.Start(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := src.Start(); err == nil || err.Error() != "MQTT source is already running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := fmt.Sprintf("%x", broker.connect); res !=
+		"00044d51545404c2003c00086d79636c69656e740003666f6f0003626172" {
+		t.Error("Unexpected connect packet:", res)
+		return
+	}
+
+	if res := fmt.Sprintf("%x", broker.subscribe); res != "00010006686f6d652f2300" {
+		t.Error("Unexpected subscribe packet:", res)
+		return
+	}
+
+	if err := src.Publish("home/kitchen/temp", []byte(`{"value":21}`)); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := <-broker.published; res != "0011686f6d652f6b69746368656e2f74656d707b2276616c7565223a32317d" {
+		t.Error("Unexpected publish packet:", res)
+		return
+	}
+
+	select {
+	case e := <-events:
+		if res := fmt.Sprint(e); res !=
+			`Event: home/kitchen/temp mqtt.home.kitchen.temp {"data":{"value":21},"topic":"home/kitchen/temp"}` {
+			t.Error("Unexpected event:", res)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("No event received")
+		return
+	}
+
+	if res := <-broker.published; res != "puback 0001" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := src.Stop(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := <-broker.published; res != "disconnect" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestMQTTSourceConnectionLost(t *testing.T) {
+	events := make(chan *engine.Event, 10)
+
+	proc := engine.NewProcessor(1)
+
+	proc.AddRule(&engine.Rule{
+		Name:       "TestRule",
+		KindMatch:  []string{"source.mqtt.lost"},
+		ScopeMatch: []string{},
+		Action: func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error {
+			events <- e
+			return nil
+		},
+	})
+
+	proc.Start()
+	defer proc.Finish()
+
+	broker := newTestMQTTBroker(0)
+	defer broker.listener.Close()
+
+	addr := broker.listener.Addr().String()
+	src := NewMQTTSource(proc, addr, "myclient", nil)
+
+	if err := src.Start(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := src.Publish("drop", nil); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	select {
+	case e := <-events:
+		if res := fmt.Sprint(e.Name(), " ", e.State()["clientID"], " ", e.State()["error"]); res !=
+			addr+" myclient EOF" {
+			t.Error("Unexpected event:", res)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("No event received")
+		return
+	}
+
+	if err := src.Publish("foo", nil); err == nil || err.Error() != "MQTT source is not running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// The source can reconnect after the connection was lost
+
+	broker = newTestMQTTBroker(0)
+	defer broker.listener.Close()
+
+	src.Address = broker.listener.Addr().String()
+
+	if err := src.Start(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := src.Stop(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := <-broker.published; res != "disconnect" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := src.Stop(); err == nil || err.Error() != "MQTT source is not running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestMQTTSourceErrors(t *testing.T) {
+	proc := engine.NewProcessor(1)
+
+	broker := newTestMQTTBroker(5)
+	defer broker.listener.Close()
+
+	src := NewMQTTSource(proc, broker.listener.Addr().String(), "myclient", nil)
+
+	if err := src.Start(); err == nil || err.Error() != "MQTT broker refused connection (code 5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	broker = newTestMQTTBroker(0)
+	defer broker.listener.Close()
+
+	src = NewMQTTSource(proc, broker.listener.Addr().String(), "myclient", []string{"forbidden"})
+
+	if err := src.Start(); err == nil || err.Error() != "MQTT broker refused subscription to forbidden" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	l, _ := net.Listen("tcp", "localhost:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	src = NewMQTTSource(proc, addr, "myclient", nil)
+
+	if err := src.Start(); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestMQTTPacketEncoding(t *testing.T) {
+
+	data := make([]byte, 321)
+
+	packet := encodeMQTTPacket(mqttPUBLISH<<4, data)
+
+	if res := fmt.Sprintf("%x", packet[:3]); res != "30c102" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	header, res, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet)))
+	if err != nil || header != mqttPUBLISH<<4 || len(res) != 321 {
+		t.Error("Unexpected result:", header, len(res), err)
+		return
+	}
+
+	if _, _, err := readMQTTPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff}))); err == nil ||
+		err.Error() != "Invalid MQTT packet length" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+/*
+Package source contains event sources which feed events from external systems
+into the processor of an ECA engine.
+*/
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/krotik/ecal/engine"
+	"github.com/krotik/ecal/scope"
+)
+
+/*
+WebSocketSource listens on a network address for WebSocket connections. Every
+message which is received on a connection is added as an event to a processor.
+The event state contains the message data in "data" (JSON data is decoded) and
+the address of the sender in "remoteAddr".
+*/
+type WebSocketSource struct {
+	Processor engine.Processor // Processor which receives the events
+	Address   string           // Address to listen on (e.g. localhost:8080)
+	Path      string           // Path which accepts WebSocket connections
+	EventName string           // Name of produced events
+	EventKind []string         // Kind of produced events
+
+	upgrader *websocket.Upgrader // Upgrader for HTTP connections
+	listener net.Listener        // Listener of the HTTP server
+	server   *http.Server        // HTTP server
+	conns    map[*websocket.Conn]bool
+	lock     *sync.Mutex
+}
+
+/*
+NewWebSocketSource creates a new WebSocket event source.
+*/
+func NewWebSocketSource(proc engine.Processor, address string, path string,
+	eventName string, eventKind []string) *WebSocketSource {
+
+	return &WebSocketSource{proc, address, path, eventName, eventKind,
+		&websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
+		nil, nil, make(map[*websocket.Conn]bool), &sync.Mutex{}}
+}
+
+/*
+Start starts listening for connections.
+*/
+func (ws *WebSocketSource) Start() error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.server != nil {
+		return fmt.Errorf("WebSocket source is already running")
+	}
+
+	listener, err := net.Listen("tcp", ws.Address)
+
+	if err == nil {
+		mux := http.NewServeMux()
+		mux.HandleFunc(ws.Path, ws.handleConnection)
+
+		ws.listener = listener
+		ws.server = &http.Server{Handler: mux}
+
+		go ws.server.Serve(listener)
+	}
+
+	return err
+}
+
+/*
+ListenAddress returns the address which the source is listening on or an
+empty string if it is not running.
+*/
+func (ws *WebSocketSource) ListenAddress() string {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.listener == nil {
+		return ""
+	}
+
+	return ws.listener.Addr().String()
+}
+
+/*
+Stop stops listening and closes all open connections.
+*/
+func (ws *WebSocketSource) Stop() error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.server == nil {
+		return fmt.Errorf("WebSocket source is not running")
+	}
+
+	err := ws.server.Close()
+
+	for conn := range ws.conns {
+		conn.Close()
+	}
+
+	ws.conns = make(map[*websocket.Conn]bool)
+	ws.server = nil
+	ws.listener = nil
+
+	return err
+}
+
+/*
+handleConnection handles a single WebSocket connection.
+*/
+func (ws *WebSocketSource) handleConnection(w http.ResponseWriter, r *http.Request) {
+	conn, err := ws.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	ws.lock.Lock()
+	ws.conns[conn] = true
+	ws.lock.Unlock()
+
+	defer func() {
+		ws.lock.Lock()
+		delete(ws.conns, conn)
+		ws.lock.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if !ws.Processor.Stopped() {
+			event := engine.NewEvent(ws.EventName, ws.EventKind, map[interface{}]interface{}{
+				"data":       DecodeMessage(msg),
+				"remoteAddr": conn.RemoteAddr().String(),
+			})
+
+			ws.Processor.AddEvent(event, ws.Processor.NewRootMonitor(nil, nil))
+		}
+	}
+}
+
+/*
+DecodeMessage decodes a message into an ECAL object. JSON data is decoded,
+everything else is returned as a string.
+*/
+func DecodeMessage(msg []byte) interface{} {
+	var data interface{}
+
+	if err := json.Unmarshal(msg, &data); err != nil {
+		return string(msg)
+	}
+
+	return scope.ConvertJSONToECALObject(data)
+}
+
+/*
+EncodeMessage encodes an ECAL object into a message. Strings are used as they
+are, everything else is encoded as JSON.
+*/
+func EncodeMessage(data interface{}) ([]byte, error) {
+	if s, ok := data.(string); ok {
+		return []byte(s), nil
+	}
+
+	return json.Marshal(scope.ConvertECALToJSONObject(data))
+}
@@ -0,0 +1,135 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package source
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/krotik/ecal/engine"
+)
+
+func TestWebSocketSource(t *testing.T) {
+	events := make(chan *engine.Event, 10)
+
+	proc := engine.NewProcessor(1)
+
+	proc.AddRule(&engine.Rule{
+		Name:       "TestRule",
+		KindMatch:  []string{"ws.message"},
+		ScopeMatch: []string{},
+		Action: func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error {
+			events <- e
+			return nil
+		},
+	})
+
+	proc.Start()
+	defer proc.Finish()
+
+	src := NewWebSocketSource(proc, "localhost:0", "/events", "wsevent", []string{"ws", "message"})
+
+	if addr := src.ListenAddress(); addr != "" {
+		t.Error("Unexpected result:", addr)
+		return
+	}
+
+	if err := src.Stop(); err == nil || err.Error() != "WebSocket source is not running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := src.Start(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := src.Start(); err == nil || err.Error() != "WebSocket source is already running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%v/events", src.ListenAddress()), nil)
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"foo":[1,2]}`))
+	conn.WriteMessage(websocket.TextMessage, []byte(`hello`))
+
+	// Events are processed concurrently so the order is not guaranteed
+
+	received := make(map[string]bool)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-events:
+			if e.Name() != "wsevent" || e.State()["remoteAddr"] != conn.LocalAddr().String() {
+				t.Error("Unexpected event:", e)
+				return
+			}
+			received[fmt.Sprint(e.State()["data"])] = true
+		case <-time.After(5 * time.Second):
+			t.Error("No event received")
+			return
+		}
+	}
+
+	if !received["map[foo:[1 2]]"] || !received["hello"] {
+		t.Error("Unexpected events:", received)
+		return
+	}
+
+	if err := src.Stop(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("Connection should be closed")
+		return
+	}
+
+	src = NewWebSocketSource(proc, "foo:bar", "/", "wsevent", []string{"ws"})
+
+	if err := src.Start(); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestMessageEncoding(t *testing.T) {
+
+	if res, err := EncodeMessage(map[interface{}]interface{}{"a": []interface{}{1, "b"}}); err != nil ||
+		string(res) != `{"a":[1,"b"]}` {
+		t.Error("Unexpected result:", string(res), err)
+		return
+	}
+
+	if res, err := EncodeMessage("foo"); err != nil || string(res) != `foo` {
+		t.Error("Unexpected result:", string(res), err)
+		return
+	}
+
+	if res := DecodeMessage([]byte(`"foo"`)); res != "foo" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := DecodeMessage([]byte(`{"a":{"b":1}}`)); fmt.Sprintf("%#v", res) !=
+		`map[interface {}]interface {}{"a":map[interface {}]interface {}{"b":1}}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
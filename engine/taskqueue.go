@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"math/rand"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/krotik/common/errorutil"
@@ -61,6 +62,15 @@ func (te *TaskError) Error() string {
 	return ret.String()
 }
 
+/*
+TaskResult datastructure to collect all rule results of an event.
+*/
+type TaskResult struct {
+	ResultMap map[string]interface{} // Rule results (rule name -> result)
+	Event     *Event                 // Event which was handled by the rules
+	Monitor   Monitor                // Event monitor
+}
+
 /*
 Task models a task which is created and executed by the processor.
 */
@@ -68,6 +78,37 @@ type Task struct {
 	p Processor // Processor which created the task
 	m Monitor   // Monitor which observes the task execution
 	e *Event    // Event which caused the task creation
+	r *Rule     // Rule which exclusively handles the event (nil if all matching rules should handle the event)
+}
+
+/*
+taskPool holds unused task objects. Tasks are created for every event and
+every triggered rule so reusing them takes pressure off the garbage
+collector. Events and monitors are not pooled as they can still be referenced
+after a task has finished (e.g. by errors, event cascades or ECAL code).
+*/
+var taskPool = sync.Pool{
+	New: func() interface{} {
+		return &Task{}
+	},
+}
+
+/*
+newTask returns a task object from the task pool.
+*/
+func newTask(p Processor, m Monitor, e *Event, r *Rule) *Task {
+	t := taskPool.Get().(*Task)
+	t.p, t.m, t.e, t.r = p, m, e, r
+	return t
+}
+
+/*
+release returns this task to the task pool. The task must not be used
+afterwards.
+*/
+func (t *Task) release() {
+	t.p, t.m, t.e, t.r = nil, nil, nil, nil
+	taskPool.Put(t)
 }
 
 /*
@@ -76,7 +117,13 @@ Run the task.
 func (t *Task) Run(tid uint64) error {
 	EventTracer.record(t.e, "Task.Run", "Running task")
 
-	errors := t.p.ProcessEvent(tid, t.e, t.m)
+	var errors map[string]error
+
+	if t.r != nil {
+		errors = t.p.(*eventProcessor).processRule(tid, t.r, t.e, t.m)
+	} else {
+		errors = t.p.ProcessEvent(tid, t.e, t.m)
+	}
 
 	if len(errors) > 0 {
 
@@ -87,6 +134,7 @@ func (t *Task) Run(tid uint64) error {
 	}
 
 	t.m.Finish()
+	t.release()
 
 	return nil
 }
@@ -103,24 +151,132 @@ HandleError handles an error which occurred during the run method.
 */
 func (t *Task) HandleError(e error) {
 	t.m.SetErrors(e.(*TaskError))
+	t.p.(*eventProcessor).notifyTaskError(e.(*TaskError))
 	t.m.Finish()
 	t.p.(*eventProcessor).notifyRootMonitorErrors(t.m.RootMonitor())
+	t.release()
 }
 
 /*
-TaskQueue models the queue of tasks for a processor.
+TaskQueue models the queue of tasks for a processor. Tasks are sorted into
+queue classes according to the kind of their event. Tasks of a class are
+always processed before tasks of the following classes. Tasks of events which
+do not match any class are put into a default class which has the lowest
+priority.
 */
 type TaskQueue struct {
-	lock         *sync.Mutex                        // Lock for queue
-	queues       map[uint64]*sortutil.PriorityQueue // Map from root monitor id to priority queue
-	messageQueue *pubsub.EventPump                  // Queue for message passing between components
+	lock            *sync.Mutex                        // Lock for queue
+	queues          map[uint64]*sortutil.PriorityQueue // Map from root monitor id to priority queue (default class)
+	classes         []*taskQueueClass                  // Queue classes ordered by priority (the default class is last)
+	starvationLimit int                                // Number of times a class with tasks can be skipped (0 for no limit)
+	messageQueue    *pubsub.EventPump                  // Queue for message passing between components
+	deterministic   bool                               // Flag if tasks of the oldest event cascade should always be picked first
+}
+
+/*
+taskQueueClass is a class of tasks in a task queue.
+*/
+type taskQueueClass struct {
+	kindMatch [][]string                         // Kind matches of the class (split into segments)
+	queues    map[uint64]*sortutil.PriorityQueue // Map from root monitor id to priority queue
+	skipped   int                                // Number of consecutive pops which skipped this class
+}
+
+/*
+matches checks if the kind of a given event matches this class.
+*/
+func (c *taskQueueClass) matches(event *Event) bool {
+	kind := event.Kind()
+
+	for _, segments := range c.kindMatch {
+		if len(segments) != len(kind) {
+			continue
+		}
+
+		match := true
+
+		for i, segment := range segments {
+			if !IsRuleKindWildcard(segment) && segment != kind[i] {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
 }
 
 /*
 NewTaskQueue creates a new TaskQueue object.
 */
 func NewTaskQueue(ep *pubsub.EventPump) *TaskQueue {
-	return &TaskQueue{&sync.Mutex{}, make(map[uint64]*sortutil.PriorityQueue), ep}
+	queues := make(map[uint64]*sortutil.PriorityQueue)
+
+	return &TaskQueue{&sync.Mutex{}, queues,
+		[]*taskQueueClass{{nil, queues, 0}}, 0, ep, false}
+}
+
+/*
+SetClasses sets the queue classes of this queue. Each class is given as a list
+of kind matches (e.g. alert.*). Classes are given in order of their priority.
+Tasks of events which do not match any class have the lowest priority. The
+starvation limit is the number of times a class with pending tasks can be
+skipped in a row in favour of a class with a higher priority - the class is
+picked the next time. A starvation limit of 0 means that classes with a lower
+priority are only picked once all classes with a higher priority are empty.
+Already queued tasks are sorted into the new classes.
+*/
+func (tq *TaskQueue) SetClasses(classes [][]string, starvationLimit int) {
+	tq.lock.Lock()
+	defer tq.lock.Unlock()
+
+	var tasks []*Task
+
+	for _, c := range tq.classes {
+		for _, q := range c.queues {
+			for q.Size() > 0 {
+				tasks = append(tasks, q.Pop().(*Task))
+			}
+		}
+	}
+
+	tq.classes = make([]*taskQueueClass, 0, len(classes)+1)
+
+	for _, kindMatches := range classes {
+		c := &taskQueueClass{nil, make(map[uint64]*sortutil.PriorityQueue), 0}
+
+		for _, kindMatch := range kindMatches {
+			c.kindMatch = append(c.kindMatch, strings.Split(kindMatch, RuleKindSeparator))
+		}
+
+		tq.classes = append(tq.classes, c)
+	}
+
+	tq.queues = make(map[uint64]*sortutil.PriorityQueue)
+	tq.classes = append(tq.classes, &taskQueueClass{nil, tq.queues, 0})
+	tq.starvationLimit = starvationLimit
+
+	for _, t := range tasks {
+		tq.class(t.e).push(t)
+	}
+}
+
+/*
+class returns the queue class of a given event. The queue lock must be held
+when calling this function.
+*/
+func (tq *TaskQueue) class(event *Event) *taskQueueClass {
+	for _, c := range tq.classes[:len(tq.classes)-1] {
+		if c.matches(event) {
+			return c
+		}
+	}
+
+	return tq.classes[len(tq.classes)-1]
 }
 
 /*
@@ -130,7 +286,12 @@ func (tq *TaskQueue) Clear() {
 	tq.lock.Lock()
 	defer tq.lock.Unlock()
 
-	tq.queues = make(map[uint64]*sortutil.PriorityQueue)
+	for _, c := range tq.classes {
+		c.queues = make(map[uint64]*sortutil.PriorityQueue)
+		c.skipped = 0
+	}
+
+	tq.queues = tq.classes[len(tq.classes)-1].queues
 }
 
 /*
@@ -140,37 +301,127 @@ func (tq *TaskQueue) Pop() pool.Task {
 	tq.lock.Lock()
 	defer tq.lock.Unlock()
 
+	if c := tq.nextClass(); c != nil {
+
+		if tq.deterministic {
+			return c.popOldest()
+		}
+
+		return c.popRandom()
+	}
+
+	return nil
+}
+
+/*
+nextClass returns the queue class from which the next task should be taken.
+The queue lock must be held when calling this function.
+*/
+func (tq *TaskQueue) nextClass() *taskQueueClass {
+	var pending []*taskQueueClass
+	var next int
+
+	for _, c := range tq.classes {
+		if c.clean() > 0 {
+			pending = append(pending, c)
+		} else {
+			c.skipped = 0
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// Pick the class with the highest priority unless a class with a lower
+	// priority has been skipped too often
+
+	if tq.starvationLimit > 0 {
+		for i, c := range pending[1:] {
+			if c.skipped >= tq.starvationLimit {
+				next = i + 1
+				break
+			}
+		}
+	}
+
+	pending[next].skipped = 0
+
+	for _, c := range pending[next+1:] {
+		c.skipped++
+	}
+
+	return pending[next]
+}
+
+/*
+clean removes all empty queues of this class and returns the number of
+pending tasks.
+*/
+func (c *taskQueueClass) clean() int {
+	var ret int
+
+	for k, v := range c.queues {
+		if s := v.Size(); s > 0 {
+			ret += s
+		} else {
+			delete(c.queues, k)
+		}
+	}
+
+	return ret
+}
+
+/*
+popRandom returns the next task of a random event cascade in this class.
+*/
+func (c *taskQueueClass) popRandom() pool.Task {
 	var popQueue *sortutil.PriorityQueue
 	var idx int
 
-	// Pick a random number between 0 and len(tq.queues) - 1
+	// Pick a random number between 0 and len(c.queues) - 1
 
-	if lq := len(tq.queues); lq > 0 {
+	if lq := len(c.queues); lq > 0 {
 		idx = rand.Intn(lq)
 	}
 
-	// Go through all queues and pick one - clean up while we are at it
+	// Go through all queues and pick one
 
-	for k, v := range tq.queues {
+	for _, v := range c.queues {
 
-		if v.Size() > 0 {
+		// Pick a random queue - pick the last if idx does not
+		// reach 0 before the end of the iteration.
 
-			// Pick a random queue - pick the last if idx does not
-			// reach 0 before the end of the iteration.
+		idx--
 
-			idx--
+		popQueue = v
 
-			popQueue = v
+		if idx <= 0 {
+			break
+		}
+	}
 
-			if idx <= 0 {
-				break
-			}
+	if popQueue != nil {
+		if res := popQueue.Pop(); res != nil {
+			return res.(*Task)
+		}
+	}
 
-		} else {
+	return nil
+}
 
-			// Remove empty queues
+/*
+popOldest returns the next task of the oldest event cascade (the root monitor
+with the lowest id) in this class.
+*/
+func (c *taskQueueClass) popOldest() pool.Task {
+	var popQueue *sortutil.PriorityQueue
+	var popID uint64
 
-			delete(tq.queues, k)
+	for k, v := range c.queues {
+		if popQueue == nil || k < popID {
+			popQueue = v
+			popID = k
 		}
 	}
 
@@ -183,6 +434,21 @@ func (tq *TaskQueue) Pop() pool.Task {
 	return nil
 }
 
+/*
+push adds a task to the queue of its event cascade in this class.
+*/
+func (c *taskQueueClass) push(task *Task) {
+	id := task.m.RootMonitor().ID()
+
+	q, ok := c.queues[id]
+	if !ok {
+		q = sortutil.NewPriorityQueue()
+		c.queues[id] = q
+	}
+
+	q.Push(task, task.m.Priority())
+}
+
 /*
 Push adds another task to the queue.
 */
@@ -190,17 +456,11 @@ func (tq *TaskQueue) Push(t pool.Task) {
 	tq.lock.Lock()
 	defer tq.lock.Unlock()
 
-	var q *sortutil.PriorityQueue
-	var ok bool
-
 	task := t.(*Task)
 
 	rm := task.m.RootMonitor()
-	id := rm.ID()
 
-	if q, ok = tq.queues[id]; !ok {
-		q = sortutil.NewPriorityQueue()
-		tq.queues[id] = q
+	if !tq.hasQueue(rm.ID()) {
 
 		// Add listener for finish
 
@@ -210,18 +470,90 @@ func (tq *TaskQueue) Push(t pool.Task) {
 				defer tq.lock.Unlock()
 
 				rm := eventSource.(*RootMonitor)
-				q := tq.queues[rm.ID()]
 
 				// Safeguard that no tasks are ever left over
 
-				errorutil.AssertTrue(q == nil || q.Size() == 0,
-					"Finished monitor left events behind")
+				for _, c := range tq.classes {
+					q := c.queues[rm.ID()]
+
+					errorutil.AssertTrue(q == nil || q.Size() == 0,
+						"Finished monitor left events behind")
+				}
 
 				tq.messageQueue.RemoveObservers(event, eventSource)
 			})
 	}
 
-	q.Push(task, task.m.Priority())
+	tq.class(task.e).push(task)
+}
+
+/*
+hasQueue checks if any class has a queue for a given root monitor id. The
+queue lock must be held when calling this function.
+*/
+func (tq *TaskQueue) hasQueue(id uint64) bool {
+	for _, c := range tq.classes {
+		if _, ok := c.queues[id]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Pending returns copies of all tasks in the queue without removing them. Tasks
+are ordered by the id of their root monitor (i.e. the age of their event
+cascade), then by the priority of their queue class and then by the order in
+which they would be popped from the queue of their cascade. The copies stay
+valid once the queued tasks have run and were returned to the task pool.
+*/
+func (tq *TaskQueue) Pending() []*Task {
+	var res []*Task
+
+	tq.lock.Lock()
+	defer tq.lock.Unlock()
+
+	idMap := make(map[uint64]bool)
+
+	for _, c := range tq.classes {
+		for id := range c.queues {
+			idMap[id] = true
+		}
+	}
+
+	ids := make([]uint64, 0, len(idMap))
+
+	for id := range idMap {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		for _, c := range tq.classes {
+			var tasks []*Task
+
+			q, ok := c.queues[id]
+			if !ok {
+				continue
+			}
+
+			// Pop all tasks and push them back in the same order
+
+			for q.Size() > 0 {
+				tasks = append(tasks, q.Pop().(*Task))
+			}
+
+			for _, t := range tasks {
+				q.Push(t, t.m.Priority())
+
+				res = append(res, &Task{t.p, t.m, t.e, t.r})
+			}
+		}
+	}
+
+	return res
 }
 
 /*
@@ -233,8 +565,10 @@ func (tq *TaskQueue) Size() int {
 
 	var ret int
 
-	for _, q := range tq.queues {
-		ret += q.Size()
+	for _, c := range tq.classes {
+		for _, q := range c.queues {
+			ret += q.Size()
+		}
 	}
 
 	return ret
@@ -36,7 +36,7 @@ func TestTaskQueue(t *testing.T) {
 
 	// Create now different tasks which come from the different monitors
 
-	t1 := &Task{proc, m1, event}
+	t1 := &Task{proc, m1, event, nil}
 
 	tq := NewTaskQueue(proc.(*eventProcessor).messageQueue)
 
@@ -72,10 +72,10 @@ func testTaskQueuePushPop(t *testing.T, tq *TaskQueue, proc Processor, event *Ev
 	m2 := newRootMonitor(nil, NewRuleScope(map[string]bool{"": true}), proc.(*eventProcessor).messageQueue)
 	m3 := newRootMonitor(nil, NewRuleScope(map[string]bool{"": true}), proc.(*eventProcessor).messageQueue)
 
-	t2 := &Task{proc, m2, event}
-	t3 := &Task{proc, m3, event}
-	t4 := &Task{proc, m2.NewChildMonitor(5), event}
-	t5 := &Task{proc, m2.NewChildMonitor(10), event}
+	t2 := &Task{proc, m2, event, nil}
+	t3 := &Task{proc, m3, event, nil}
+	t4 := &Task{proc, m2.NewChildMonitor(5), event, nil}
+	t5 := &Task{proc, m2.NewChildMonitor(10), event, nil}
 
 	tq.Push(t1)
 	tq.Push(t2)
@@ -142,7 +142,7 @@ func testTaskQueuePushPop(t *testing.T, tq *TaskQueue, proc Processor, event *Ev
 func testTaskQueueMisc(t *testing.T, tq *TaskQueue, t5 *Task) {
 	tq.Push(t5)
 
-	if fmt.Sprint(tq.queues) != "map[2:[ Task: EventProcessor 1 (workers:1) Monitor 5 (parent: Monitor 2 (parent: <nil> priority: 0 activated: false finished: false) priority: 10 activated: false finished: false) Event: DummyEvent main {} (10) ]]" {
+	if fmt.Sprint(tq.queues) != "map[2:[ Task: EventProcessor 1 (workers:1) Monitor 5 (parent: Monitor 2 (parent: <nil> priority: 0 activated: false finished: false) priority: 10 activated: false finished: false) Event: DummyEvent main null (10) ]]" {
 		t.Error("Unexpected queue:", tq.queues)
 		return
 	}
@@ -194,9 +194,9 @@ func TestTaskQueueCorrectPriorities(t *testing.T) {
 
 	// Create now different tasks which come from the different monitors
 
-	t1 := &Task{proc, m1, event}
-	t2 := &Task{proc, m1.NewChildMonitor(5), event}
-	t3 := &Task{proc, m1.NewChildMonitor(10), event}
+	t1 := &Task{proc, m1, event, nil}
+	t2 := &Task{proc, m1.NewChildMonitor(5), event, nil}
+	t3 := &Task{proc, m1.NewChildMonitor(10), event, nil}
 
 	tq := NewTaskQueue(proc.(*eventProcessor).messageQueue)
 
@@ -220,3 +220,195 @@ func TestTaskQueueCorrectPriorities(t *testing.T) {
 		return
 	}
 }
+
+func TestTaskQueueDeterministic(t *testing.T) {
+	proc := NewDeterministicProcessor()
+
+	event := &Event{
+		"DummyEvent",
+		[]string{"main"},
+		nil,
+	}
+
+	m1 := newRootMonitor(nil, NewRuleScope(map[string]bool{"": true}), proc.(*eventProcessor).messageQueue)
+	m2 := newRootMonitor(nil, NewRuleScope(map[string]bool{"": true}), proc.(*eventProcessor).messageQueue)
+
+	t1 := &Task{proc, m1, event, nil}
+	t2 := &Task{proc, m2, event, nil}
+	t3 := &Task{proc, m1.NewChildMonitor(5), event, nil}
+	t4 := &Task{proc, m2.NewChildMonitor(1), event, nil}
+
+	tq := NewTaskQueue(proc.(*eventProcessor).messageQueue)
+	tq.deterministic = true
+
+	tq.Push(t2)
+	tq.Push(t4)
+	tq.Push(t3)
+	tq.Push(t1)
+
+	// Tasks of the oldest cascade are always picked first
+
+	for i, expected := range []*Task{t1, t3, t2, t4} {
+		if res := tq.Pop(); res != expected {
+			t.Error("Unexpected task", i, ":", res)
+			return
+		}
+	}
+
+	if res := tq.Pop(); res != nil {
+		t.Error("Unexpected task:", res)
+		return
+	}
+}
+
+func TestTaskQueueClasses(t *testing.T) {
+	proc := NewDeterministicProcessor()
+
+	alert := &Event{"Alert", []string{"alert", "fire"}, nil}
+	metric := &Event{"Metric", []string{"metric", "cpu"}, nil}
+	bulk := &Event{"Bulk", []string{"bulk"}, nil}
+
+	m1 := newRootMonitor(nil, NewRuleScope(map[string]bool{"": true}), proc.(*eventProcessor).messageQueue)
+
+	// Bulk tasks have the highest monitor priority
+
+	b1 := &Task{proc, m1, bulk, nil}
+	b2 := &Task{proc, m1.NewChildMonitor(1), bulk, nil}
+	mt1 := &Task{proc, m1.NewChildMonitor(2), metric, nil}
+	a1 := &Task{proc, m1.NewChildMonitor(3), alert, nil}
+	a2 := &Task{proc, m1.NewChildMonitor(4), alert, nil}
+	a3 := &Task{proc, m1.NewChildMonitor(5), alert, nil}
+
+	tq := NewTaskQueue(proc.(*eventProcessor).messageQueue)
+	tq.deterministic = true
+
+	push := func() {
+		for _, task := range []*Task{b1, b2, mt1, a1, a2, a3} {
+			tq.Push(task)
+		}
+	}
+
+	popAll := func() string {
+		var res []string
+
+		for task := tq.Pop(); task != nil; task = tq.Pop() {
+			res = append(res, fmt.Sprint(task.(*Task).e.Name(), task.(*Task).m.Priority()))
+		}
+
+		return fmt.Sprint(res)
+	}
+
+	// Queued tasks are sorted into the new classes
+
+	push()
+
+	tq.SetClasses([][]string{{"alert.*"}, {"metric.{name}", "metric.mem.max"}}, 0)
+
+	if res := fmt.Sprint(tq.Pending()); res != fmt.Sprint([]*Task{a1, a2, a3, mt1, b1, b2}) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := popAll(); res != "[Alert3 Alert4 Alert5 Metric2 Bulk0 Bulk1]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Classes with a lower priority are picked after they were skipped too often
+
+	tq.SetClasses([][]string{{"alert.*"}, {"metric.{name}"}}, 1)
+
+	push()
+
+	if res := popAll(); res != "[Alert3 Metric2 Bulk0 Alert4 Bulk1 Alert5]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Removing all classes restores the default behaviour
+
+	tq.SetClasses(nil, 0)
+
+	push()
+
+	if res := popAll(); res != "[Bulk0 Bulk1 Metric2 Alert3 Alert4 Alert5]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Check that the queue can be cleared
+
+	tq.SetClasses([][]string{{"alert.*"}}, 0)
+
+	push()
+
+	tq.Clear()
+
+	if res := tq.Size(); res != 0 || len(tq.queues) != 0 {
+		t.Error("Unexpected result:", res, tq.queues)
+		return
+	}
+}
+
+func TestTaskPool(t *testing.T) {
+	proc := NewProcessor(1)
+
+	event := &Event{
+		"DummyEvent",
+		[]string{"main"},
+		nil,
+	}
+
+	m1 := newRootMonitor(nil, NewRuleScope(map[string]bool{"": true}), proc.(*eventProcessor).messageQueue)
+	m1.Activate(event)
+
+	t1 := newTask(proc, m1, event, nil)
+
+	if t1.p != proc || t1.m != m1 || t1.e != event || t1.r != nil {
+		t.Error("Unexpected result:", t1)
+		return
+	}
+
+	// A task which finished without errors is released
+
+	if err := t1.Run(1); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if t1.p != nil || t1.m != nil || t1.e != nil || t1.r != nil {
+		t.Error("Unexpected result:", t1)
+		return
+	}
+
+	// A task which has errors is released once the errors have been handled
+
+	rule := &Rule{
+		Name:   "FailingRule",
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error { return fmt.Errorf("foo") },
+	}
+
+	m2 := newRootMonitor(nil, NewRuleScope(map[string]bool{"": true}), proc.(*eventProcessor).messageQueue)
+	m2.Activate(event)
+
+	t2 := newTask(proc, m2, event, rule)
+
+	err := t2.Run(1)
+
+	if err == nil || t2.m != m2 {
+		t.Error("Unexpected result:", err, t2)
+		return
+	}
+
+	t2.HandleError(err)
+
+	if t2.p != nil || t2.m != nil || t2.e != nil || t2.r != nil {
+		t.Error("Unexpected result:", t2)
+		return
+	}
+
+	if errs := m2.AllErrors(); len(errs) != 1 || errs[0].ErrorMap["FailingRule"].Error() != "foo" {
+		t.Error("Unexpected result:", errs)
+		return
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package engine
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+TimerWheel schedules one-shot functions. Scheduled functions are kept in a
+ring of slots. A single goroutine advances the ring every tick and runs all
+functions of the current slot which are due. Functions with a delay longer
+than one revolution of the ring are kept for the required number of rounds.
+The goroutine only runs while functions are scheduled.
+*/
+type TimerWheel struct {
+	tick    time.Duration            // Duration of one tick
+	slots   []map[uint64]*timerEntry // Slots of the wheel
+	pos     int                      // Current slot
+	entries map[uint64]*timerEntry   // All scheduled entries
+	counter uint64                   // Counter for entry ids
+	running bool                     // Flag if the goroutine is running
+	lock    *sync.Mutex              // Lock for the wheel
+}
+
+/*
+timerEntry is a scheduled function.
+*/
+type timerEntry struct {
+	slot   int    // Slot of the entry
+	rounds int    // Remaining revolutions of the wheel before the entry is due
+	f      func() // Scheduled function
+}
+
+/*
+NewTimerWheel returns a new timer wheel with a given tick duration and number
+of slots.
+*/
+func NewTimerWheel(tick time.Duration, size int) *TimerWheel {
+	slots := make([]map[uint64]*timerEntry, size)
+
+	for i := range slots {
+		slots[i] = make(map[uint64]*timerEntry)
+	}
+
+	return &TimerWheel{tick, slots, 0, make(map[uint64]*timerEntry), 0, false, &sync.Mutex{}}
+}
+
+/*
+Schedule runs a function once after a given delay. The function is run at
+most one tick after the delay has passed. Returns an id which can be used to
+cancel the function.
+*/
+func (tw *TimerWheel) Schedule(delay time.Duration, f func()) uint64 {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	// The next tick can happen at any time - add one tick to ensure that
+	// the function does not run before the delay has passed
+
+	ticks := int(math.Ceil(float64(delay)/float64(tw.tick))) + 1
+
+	if ticks < 1 {
+		ticks = 1
+	}
+
+	tw.counter++
+	id := tw.counter
+
+	entry := &timerEntry{(tw.pos + ticks) % len(tw.slots), (ticks - 1) / len(tw.slots), f}
+
+	tw.slots[entry.slot][id] = entry
+	tw.entries[id] = entry
+
+	if !tw.running {
+		tw.running = true
+		go tw.run()
+	}
+
+	return id
+}
+
+/*
+Cancel cancels a scheduled function. Returns false if the function was not
+found (i.e. it has already run or was cancelled before).
+*/
+func (tw *TimerWheel) Cancel(id uint64) bool {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	entry, ok := tw.entries[id]
+
+	if ok {
+		delete(tw.slots[entry.slot], id)
+		delete(tw.entries, id)
+	}
+
+	return ok
+}
+
+/*
+Clear cancels all scheduled functions.
+*/
+func (tw *TimerWheel) Clear() {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	for id, entry := range tw.entries {
+		delete(tw.slots[entry.slot], id)
+		delete(tw.entries, id)
+	}
+}
+
+/*
+Pending returns the number of scheduled functions.
+*/
+func (tw *TimerWheel) Pending() int {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	return len(tw.entries)
+}
+
+/*
+run advances the wheel until no functions are scheduled anymore.
+*/
+func (tw *TimerWheel) run() {
+	ticker := time.NewTicker(tw.tick)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, f := range tw.advance() {
+			f()
+		}
+
+		tw.lock.Lock()
+
+		if len(tw.entries) == 0 {
+			tw.running = false
+			tw.lock.Unlock()
+			return
+		}
+
+		tw.lock.Unlock()
+	}
+}
+
+/*
+advance moves the wheel one slot forward and returns all functions which are due.
+*/
+func (tw *TimerWheel) advance() []func() {
+	var due []func()
+
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	tw.pos = (tw.pos + 1) % len(tw.slots)
+
+	for id, entry := range tw.slots[tw.pos] {
+		if entry.rounds > 0 {
+			entry.rounds--
+			continue
+		}
+
+		due = append(due, entry.f)
+		delete(tw.slots[tw.pos], id)
+		delete(tw.entries, id)
+	}
+
+	return due
+}
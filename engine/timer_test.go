@@ -0,0 +1,176 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTimerWheel(t *testing.T) {
+	var res []string
+	var lock sync.Mutex
+
+	// Small wheel so that entries need several rounds
+
+	tw := NewTimerWheel(5*time.Millisecond, 4)
+
+	record := func(s string) func() {
+		return func() {
+			lock.Lock()
+			defer lock.Unlock()
+			res = append(res, s)
+		}
+	}
+
+	start := time.Now()
+	var fired time.Duration
+
+	tw.Schedule(60*time.Millisecond, func() {
+		fired = time.Since(start)
+		record("c")()
+	})
+	tw.Schedule(0, record("a"))
+	tw.Schedule(20*time.Millisecond, record("b"))
+	id := tw.Schedule(30*time.Millisecond, record("x"))
+
+	if p := tw.Pending(); p != 4 {
+		t.Error("Unexpected result:", p)
+		return
+	}
+
+	if !tw.Cancel(id) {
+		t.Error("Cancel should succeed")
+		return
+	}
+
+	if tw.Cancel(id) {
+		t.Error("Second cancel should fail")
+		return
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	lock.Lock()
+	if fmt.Sprint(res) != "[a b c]" {
+		t.Error("Unexpected result:", res)
+		lock.Unlock()
+		return
+	}
+	lock.Unlock()
+
+	if fired < 60*time.Millisecond {
+		t.Error("Function ran too early:", fired)
+		return
+	}
+
+	if p := tw.Pending(); p != 0 {
+		t.Error("Unexpected result:", p)
+		return
+	}
+
+	// Check that the wheel can be restarted and cleared
+
+	res = nil
+
+	tw.Schedule(10*time.Millisecond, record("d"))
+	tw.Schedule(10*time.Millisecond, record("e"))
+	tw.Schedule(50*time.Millisecond, record("f"))
+
+	time.Sleep(30 * time.Millisecond)
+
+	tw.Clear()
+
+	time.Sleep(50 * time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	sort.Strings(res)
+
+	if fmt.Sprint(res) != "[d e]" || tw.Pending() != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestProcessorAddEventAfter(t *testing.T) {
+	var res []string
+	var lock sync.Mutex
+
+	proc := NewProcessor(1)
+
+	proc.AddRule(&Rule{
+		Name:            "rule1",
+		KindMatch:       []string{"core.*"},
+		ScopeMatch:      []string{"data"},
+		StateMatch:      nil,
+		Priority:        0,
+		SuppressionList: nil,
+		Action: func(p Processor, m Monitor, e *Event, tid uint64) error {
+			lock.Lock()
+			defer lock.Unlock()
+			res = append(res, e.Name())
+			return nil
+		},
+	})
+
+	proc.Start()
+
+	scope := NewRuleScope(map[string]bool{"data": true})
+
+	proc.AddEventAfter(20*time.Millisecond, NewEvent("delayed1", []string{"core", "main"}, nil), scope)
+	id := proc.AddEventAfter(20*time.Millisecond, NewEvent("delayed2", []string{"core", "main"}, nil), scope)
+	proc.AddEventAfter(20*time.Millisecond, NewEvent("noscope", []string{"core", "main"}, nil),
+		NewRuleScope(map[string]bool{"data": false}))
+
+	if !proc.CancelEvent(id) {
+		t.Error("Cancel should succeed")
+		return
+	}
+
+	lock.Lock()
+	if len(res) != 0 {
+		t.Error("Unexpected result:", res)
+		lock.Unlock()
+		return
+	}
+	lock.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Pending events are removed on reset
+
+	id = proc.AddEventAfter(50*time.Millisecond, NewEvent("delayed3", []string{"core", "main"}, nil), scope)
+
+	proc.Finish()
+
+	if err := proc.Reset(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if proc.CancelEvent(id) {
+		t.Error("Event should have been removed by reset")
+		return
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if fmt.Sprint(res) != "[delayed1]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -28,6 +28,15 @@ RuleKindWildcard is a wildcard for rule kinds
 */
 const RuleKindWildcard = "*"
 
+/*
+IsRuleKindWildcard checks if a segment of a rule kind is a wildcard. A wildcard
+is either RuleKindWildcard or a named wildcard of the form {name}.
+*/
+func IsRuleKindWildcard(segment string) bool {
+	return segment == RuleKindWildcard ||
+		(len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"))
+}
+
 // Messages
 // ========
 
@@ -130,6 +139,33 @@ func (rs *RuleScope) Add(scopePath string, allow bool) {
 	scopeDefs[ruleScopeAllowFlag] = allow
 }
 
+/*
+Definitions returns all definitions of the rule scope as a map from scope path
+to allow flag. The result can be used to create an identical rule scope with
+NewRuleScope.
+*/
+func (rs *RuleScope) Definitions() map[string]bool {
+	res := make(map[string]bool)
+
+	var collect func(path string, scopeDefs map[string]interface{})
+
+	collect = func(path string, scopeDefs map[string]interface{}) {
+		for k, v := range scopeDefs {
+			if k == ruleScopeAllowFlag {
+				res[path] = v.(bool)
+			} else if path == "" {
+				collect(k, v.(map[string]interface{}))
+			} else {
+				collect(path+"."+k, v.(map[string]interface{}))
+			}
+		}
+	}
+
+	collect("", rs.scopeDefs)
+
+	return res
+}
+
 // Rule sorting
 // ============
 
@@ -138,12 +174,18 @@ RuleSlice is a slice of rules
 */
 type RuleSlice []*Rule
 
-func (s RuleSlice) Len() int           { return len(s) }
-func (s RuleSlice) Less(i, j int) bool { return s[i].Priority < s[j].Priority }
-func (s RuleSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s RuleSlice) Len() int      { return len(s) }
+func (s RuleSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s RuleSlice) Less(i, j int) bool {
+	if s[i].Priority != s[j].Priority {
+		return s[i].Priority < s[j].Priority
+	}
+	return s[i].Name < s[j].Name
+}
 
 /*
-SortRuleSlice sorts a slice of rules.
+SortRuleSlice sorts a slice of rules according to their priority. Rules with
+the same priority are sorted by name.
 */
 func SortRuleSlice(a []*Rule) { sort.Sort(RuleSlice(a)) }
 
@@ -10,7 +10,10 @@
 
 package engine
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func TestRuleScope(t *testing.T) {
 
@@ -75,3 +78,19 @@ func TestRuleScope(t *testing.T) {
 		return
 	}
 }
+
+func TestSortRuleSlice(t *testing.T) {
+	rules := []*Rule{{Name: "c", Priority: 1}, {Name: "b", Priority: 0}, {Name: "d", Priority: 0}, {Name: "a", Priority: 1}}
+
+	SortRuleSlice(rules)
+
+	var names []string
+	for _, r := range rules {
+		names = append(names, r.Name)
+	}
+
+	if res := fmt.Sprint(names); res != "[b d a c]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -18,6 +18,16 @@ type ECALPluginFunction interface {
 	Run(args []interface{}) (interface{}, error) // Function execution with given arguments
 	DocString() string // Returns some function description
 }
+
+Plugins can export a manifest which describes the plugin. The plugin is rejected
+if the manifest declares a plugin API version which is not supported by the
+interpreter:
+
+type ECALPluginManifest interface {
+	Name() string    // Name of the plugin
+	Version() string // Version of the plugin
+	APIVersion() int // Plugin API version the plugin was written for
+}
 */
 
 package main
@@ -53,9 +63,29 @@ func (f *myfunc) DocString() string {
 	return "Myfunc is an example function"
 }
 
+type manifest struct {
+}
+
+func (m *manifest) Name() string {
+	return "myfunc"
+}
+
+func (m *manifest) Version() string {
+	return "1.0.0"
+}
+
+func (m *manifest) APIVersion() int {
+	return 1
+}
+
 // Exported bits
 
 /*
 ECALmyfunc is the exported function which can be used by ECAL
 */
 var ECALmyfunc myfunc
+
+/*
+ECALPluginManifest is the exported manifest of the plugin
+*/
+var ECALPluginManifest manifest
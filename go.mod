@@ -1,5 +1,10 @@
 module github.com/krotik/ecal
 
-go 1.12
+go 1.16
 
-require github.com/krotik/common v1.4.4
+require (
+	github.com/gorilla/websocket v1.4.2
+	github.com/krotik/common v1.4.4
+	github.com/segmentio/kafka-go v0.4.47 // only used with the kafka build tag
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -14,8 +14,13 @@ Package interpreter contains the ECAL interpreter.
 package interpreter
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -33,7 +38,14 @@ ecalDebugger is the inbuild default debugger.
 */
 type ecalDebugger struct {
 	breakPoints                map[string]bool                     // Break points (active or not)
+	breakPointConditions       map[string]*breakPointCondition     // Conditions of break points
+	breakPointTargets          map[uint64]string                   // Last conditional break point target of threads
+	watches                    map[uint64]map[string]*watch        // Watch expressions of threads
+	variableWatches            map[string]*watch                   // Watched variables (data break points)
+	history                    map[uint64]*datautil.RingBuffer     // Last visited states of threads
+	historySize                int                                 // Number of states which are recorded for each thread
 	interrogationStates        map[uint64]*interrogationState      // Collection of threads which are interrogated
+	killedThreads              map[uint64]bool                     // Threads which should raise a Cancelled error
 	callStacks                 map[uint64][]*parser.ASTNode        // Call stack locations of threads
 	callStackVsSnapshots       map[uint64][]map[string]interface{} // Call stack variable scope snapshots of threads
 	callStackGlobalVsSnapshots map[uint64][]map[string]interface{} // Call stack global variable scope snapshots of threads
@@ -46,6 +58,8 @@ type ecalDebugger struct {
 	mutexeOwners               map[string]uint64                   // A map of current mutex owners
 	mutexLog                   *datautil.RingBuffer                // A log of taken mutexes
 	threadpool                 *pool.ThreadPool                    // Reference to the thread pool of the processor
+	evalThreads                map[uint64]bool                     // Threads which evaluate expressions for the debugger
+	lastEvalThread             uint64                              // Counter for thread IDs of expression evaluations
 }
 
 /*
@@ -59,6 +73,156 @@ type interrogationState struct {
 	node         *parser.ASTNode   // Node on which the thread was last stopped
 	vs           parser.Scope      // Variable scope of the thread when it was last stopped
 	err          error             // Error which was returned by a function call
+	watchChange  string            // Description of the watch change which stopped the thread
+}
+
+/*
+breakPointCondition contains the conditions of a break point.
+*/
+type breakPointCondition struct {
+	expression string          // Condition expression (ECAL)
+	ast        *parser.ASTNode // Parsed condition expression
+	hitCount   int             // Break only on every n-th hit
+	hits       int             // Number of times the break point was hit
+	lock       *sync.Mutex     // Lock for the hit counter
+}
+
+/*
+newBreakPointCondition creates a new break point condition. Returns nil if
+no condition is given.
+*/
+func newBreakPointCondition(expression string, hitCount int) (*breakPointCondition, error) {
+	var ast *parser.ASTNode
+	var err error
+
+	if expression == "" && hitCount <= 0 {
+		return nil, nil
+	}
+
+	if expression != "" {
+		ast, err = parser.ParseWithRuntime("BreakPointCondition", expression,
+			NewECALRuntimeProvider("BreakPointCondition", nil, nil))
+
+		if err == nil {
+			err = ast.Runtime.Validate()
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid break point condition %v: %v", expression, err)
+		}
+	}
+
+	return &breakPointCondition{expression, ast, hitCount, 0, &sync.Mutex{}}, nil
+}
+
+/*
+check checks if the condition is met in a given variable scope. The break
+point is also hit if the condition cannot be evaluated.
+*/
+func (bpc *breakPointCondition) check(vs parser.Scope, tid uint64) (bool, error) {
+	var err error
+
+	hit := true
+
+	if bpc.ast != nil {
+		var res interface{}
+
+		// Evaluate the condition in its own scope so assignments do not leak
+
+		cvs := scope.NewScopeWithParent("BreakPointConditionScope", vs)
+
+		if res, err = bpc.ast.Runtime.Eval(cvs, make(map[string]interface{}), tid); err == nil {
+			var ok bool
+
+			if hit, ok = res.(bool); !ok {
+				err = fmt.Errorf("Result is not a boolean: %v", res)
+			}
+		}
+
+		if err != nil {
+			return true, fmt.Errorf("Could not evaluate break point condition %v: %v", bpc.expression, err)
+		}
+	}
+
+	if hit && bpc.hitCount > 0 {
+		bpc.lock.Lock()
+		bpc.hits++
+		hit = bpc.hits%bpc.hitCount == 0
+		bpc.lock.Unlock()
+	}
+
+	return hit, nil
+}
+
+/*
+watch is a watch expression or a watched variable. The thread is suspended
+when its value changes.
+*/
+type watch struct {
+	expression string            // Watch expression (ECAL) or variable name
+	ast        *parser.ASTNode   // Parsed watch expression (nil for watched variables)
+	values     map[uint64]string // Last known values of threads
+}
+
+/*
+newWatch creates a new watch expression. The expression is only parsed if
+isExpression is set - otherwise it is treated as a variable name.
+*/
+func newWatch(expression string, isExpression bool) (*watch, error) {
+	var ast *parser.ASTNode
+	var err error
+
+	if isExpression {
+		ast, err = parser.ParseWithRuntime("WatchExpression", expression,
+			NewECALRuntimeProvider("WatchExpression", nil, nil))
+
+		if err == nil {
+			err = ast.Runtime.Validate()
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid watch expression %v: %v", expression, err)
+		}
+	}
+
+	return &watch{expression, ast, make(map[uint64]string)}, nil
+}
+
+/*
+value returns the current value of this watch in a given variable scope.
+Returns false if a watched variable is not defined in the scope.
+*/
+func (w *watch) value(vs parser.Scope, tid uint64) (string, bool) {
+	var res interface{}
+	var ok bool
+	var err error
+
+	if w.ast != nil {
+
+		// Evaluate the expression in its own scope so assignments do not leak
+
+		cvs := scope.NewScopeWithParent("WatchExpressionScope", vs)
+
+		res, err = w.ast.Runtime.Eval(cvs, make(map[string]interface{}), tid)
+		ok = true
+
+	} else {
+		res, ok, err = vs.GetValue(w.expression)
+	}
+
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+
+	return fmt.Sprint(res), ok
+}
+
+/*
+historyEntry is a recorded state of a thread.
+*/
+type historyEntry struct {
+	node *parser.ASTNode        // Visited node
+	vs   map[string]interface{} // Variable scope snapshot when the node was visited
 }
 
 /*
@@ -90,6 +254,7 @@ func newInterrogationState(node *parser.ASTNode, vs parser.Scope) *interrogation
 		node,
 		vs,
 		nil,
+		"",
 	}
 }
 
@@ -99,7 +264,14 @@ NewECALDebugger returns a new debugger object.
 func NewECALDebugger(globalVS parser.Scope) util.ECALDebugger {
 	return &ecalDebugger{
 		breakPoints:                make(map[string]bool),
+		breakPointConditions:       make(map[string]*breakPointCondition),
+		breakPointTargets:          make(map[uint64]string),
+		watches:                    make(map[uint64]map[string]*watch),
+		variableWatches:            make(map[string]*watch),
+		history:                    make(map[uint64]*datautil.RingBuffer),
+		historySize:                0,
 		interrogationStates:        make(map[uint64]*interrogationState),
+		killedThreads:              make(map[uint64]bool),
 		callStacks:                 make(map[uint64][]*parser.ASTNode),
 		callStackVsSnapshots:       make(map[uint64][]map[string]interface{}),
 		callStackGlobalVsSnapshots: make(map[uint64][]map[string]interface{}),
@@ -112,6 +284,8 @@ func NewECALDebugger(globalVS parser.Scope) util.ECALDebugger {
 		mutexeOwners:               nil,
 		mutexLog:                   nil,
 		threadpool:                 nil,
+		evalThreads:                make(map[uint64]bool),
+		lastEvalThread:             0,
 	}
 }
 
@@ -187,6 +361,139 @@ func (ed *ecalDebugger) BreakOnError(flag bool) {
 	ed.breakOnError = flag
 }
 
+/*
+SetHistorySize sets the number of states which are recorded for each thread.
+A size of 0 disables the recording.
+*/
+func (ed *ecalDebugger) SetHistorySize(size int) {
+	ed.lock.Lock()
+	defer ed.lock.Unlock()
+
+	ed.historySize = size
+	ed.history = make(map[uint64]*datautil.RingBuffer)
+}
+
+/*
+Session returns the break points and settings of the debugger.
+*/
+func (ed *ecalDebugger) Session() *util.DebugSession {
+	ed.lock.RLock()
+	defer ed.lock.RUnlock()
+
+	session := &util.DebugSession{
+		BreakPoints:  []*util.DebugBreakPoint{},
+		BreakOnStart: ed.breakOnStart,
+		BreakOnError: ed.breakOnError,
+	}
+
+	for target, active := range ed.breakPoints {
+		i := strings.LastIndex(target, ":")
+		line, _ := strconv.Atoi(target[i+1:])
+
+		bp := &util.DebugBreakPoint{Source: target[:i], Line: line, Disabled: !active}
+
+		if c, ok := ed.breakPointConditions[target]; ok {
+			bp.Condition = c.expression
+			bp.HitCount = c.hitCount
+		}
+
+		session.BreakPoints = append(session.BreakPoints, bp)
+	}
+
+	sort.Slice(session.BreakPoints, func(i, j int) bool {
+		bpi, bpj := session.BreakPoints[i], session.BreakPoints[j]
+		return bpi.Source < bpj.Source || (bpi.Source == bpj.Source && bpi.Line < bpj.Line)
+	})
+
+	for name := range ed.variableWatches {
+		session.VariableWatches = append(session.VariableWatches, name)
+	}
+
+	sort.Strings(session.VariableWatches)
+
+	return session
+}
+
+/*
+LoadSession replaces the break points and settings of the debugger with the
+ones of a given session. The debugger is not changed if a break point of the
+session is invalid.
+*/
+func (ed *ecalDebugger) LoadSession(session *util.DebugSession) error {
+	breakPoints := make(map[string]bool)
+	breakPointConditions := make(map[string]*breakPointCondition)
+	variableWatches := make(map[string]*watch)
+
+	for _, bp := range session.BreakPoints {
+		if bp.Source == "" || bp.Line < 1 {
+			return fmt.Errorf("Invalid break point target: %v:%v", bp.Source, bp.Line)
+		}
+
+		cond, err := newBreakPointCondition(bp.Condition, bp.HitCount)
+
+		if err != nil {
+			return err
+		}
+
+		target := fmt.Sprintf("%v:%v", bp.Source, bp.Line)
+
+		breakPoints[target] = !bp.Disabled
+
+		if cond != nil {
+			breakPointConditions[target] = cond
+		}
+	}
+
+	for _, name := range session.VariableWatches {
+		variableWatches[name], _ = newWatch(name, false)
+	}
+
+	ed.lock.Lock()
+	defer ed.lock.Unlock()
+
+	ed.breakPoints = breakPoints
+	ed.breakPointConditions = breakPointConditions
+	ed.variableWatches = variableWatches
+	ed.breakOnStart = session.BreakOnStart
+	ed.breakOnError = session.BreakOnError
+
+	return nil
+}
+
+/*
+SaveDebugSession writes the break points and settings of a given debugger to a
+file.
+*/
+func SaveDebugSession(debugger util.ECALDebugger, file string) error {
+	data, err := json.MarshalIndent(debugger.Session(), "", "  ")
+
+	if err == nil {
+		err = ioutil.WriteFile(file, data, 0644)
+	}
+
+	return err
+}
+
+/*
+LoadDebugSession restores the break points and settings of a given debugger
+from a file which was written by SaveDebugSession.
+*/
+func LoadDebugSession(debugger util.ECALDebugger, file string) error {
+	data, err := ioutil.ReadFile(file)
+
+	if err == nil {
+		var session util.DebugSession
+
+		if err = json.Unmarshal(data, &session); err != nil {
+			return fmt.Errorf("Could not parse debug session file %v: %v", file, err)
+		}
+
+		err = debugger.LoadSession(&session)
+	}
+
+	return err
+}
+
 /*
 SetLockingState sets locking status information.
 */
@@ -210,12 +517,71 @@ func (ed *ecalDebugger) SetThreadPool(tp *pool.ThreadPool) {
 VisitState is called for every state during the execution of a program.
 */
 func (ed *ecalDebugger) VisitState(node *parser.ASTNode, vs parser.Scope, tid uint64) util.TraceableRuntimeError {
+	if ed.isEvalThread(tid) {
+		return nil
+	}
+
+	ed.recordHistory(node, vs, tid)
+	return ed.visitState(node, vs, tid)
+}
+
+/*
+recordHistory records a visited state of a thread if a history size is set.
+Only the first visited node of each line is recorded.
+*/
+func (ed *ecalDebugger) recordHistory(node *parser.ASTNode, vs parser.Scope, tid uint64) {
+	ed.lock.RLock()
+	historySize := ed.historySize
+	rb, ok := ed.history[tid]
+	ed.lock.RUnlock()
+
+	if historySize <= 0 || node.Token == nil {
+		return
+	}
+
+	if !ok {
+		rb = datautil.NewRingBuffer(historySize)
+
+		ed.lock.Lock()
+		ed.history[tid] = rb
+		ed.lock.Unlock()
+
+	} else if size := rb.Size(); size > 0 {
+		last := rb.Get(size - 1).(*historyEntry).node.Token
+
+		if last.Lline == node.Token.Lline && last.Lsource == node.Token.Lsource {
+			return
+		}
+	}
+
+	rb.Add(&historyEntry{node, ed.buildVsSnapshot(vs)})
+}
+
+/*
+visitState handles a state visit of a thread.
+*/
+func (ed *ecalDebugger) visitState(node *parser.ASTNode, vs parser.Scope, tid uint64) util.TraceableRuntimeError {
 
 	ed.lock.RLock()
 	_, ok := ed.callStacks[tid]
+	killed := ed.killedThreads[tid]
 	ed.lastVisit = time.Now().UnixNano()
 	ed.lock.RUnlock()
 
+	if killed && node.Token != nil {
+
+		// The thread should be killed - raise an error which can be handled
+		// by the running code
+
+		ed.lock.Lock()
+		delete(ed.killedThreads, tid)
+		delete(ed.interrogationStates, tid)
+		ed.lock.Unlock()
+
+		return util.NewRuntimeError(node.Token.Lsource, util.ErrCancelled,
+			"Thread was killed by the debugger", node).(util.TraceableRuntimeError)
+	}
+
 	if !ok {
 
 		// Make the debugger aware of running threads
@@ -257,7 +623,7 @@ func (ed *ecalDebugger) VisitState(node *parser.ASTNode, vs parser.Scope, tid ui
 						runtime.Goexit()
 					}
 
-					return ed.VisitState(node, vs, tid)
+					return ed.visitState(node, vs, tid)
 				}
 			case Stop, StepIn, StepOver:
 
@@ -272,31 +638,118 @@ func (ed *ecalDebugger) VisitState(node *parser.ASTNode, vs parser.Scope, tid ui
 				}
 			}
 
-		} else if active, ok := ed.breakPoints[targetIdentifier]; (ok && active) || ed.breakOnStart {
+		} else {
+			hit, condErr := ed.checkBreakPoint(targetIdentifier, vs, tid)
+			watchChange := ed.checkWatches(vs, tid)
+
+			if hit || watchChange != "" || ed.breakOnStart {
+
+				// A globally defined breakpoint has been hit or a watched value
+				// has changed - note the position in the thread specific map and wait
 
-			// A globally defined breakpoint has been hit - note the position
-			// in the thread specific map and wait
+				is := newInterrogationState(node, vs)
+				is.err = condErr
+				is.watchChange = watchChange
 
-			is := newInterrogationState(node, vs)
+				ed.lock.Lock()
+				ed.breakOnStart = false
+				ed.interrogationStates[tid] = is
+				ed.lock.Unlock()
+
+				is.cond.L.Lock()
+				is.cond.Wait()
+				is.cond.L.Unlock()
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+checkBreakPoint checks if a break point has been hit. Conditions are only
+checked once each time a thread reaches the line of a break point.
+*/
+func (ed *ecalDebugger) checkBreakPoint(target string, vs parser.Scope, tid uint64) (bool, error) {
+	ed.lock.RLock()
+	active, ok := ed.breakPoints[target]
+	cond := ed.breakPointConditions[target]
+	lastTarget, hasLastTarget := ed.breakPointTargets[tid]
+	ed.lock.RUnlock()
+
+	if hasLastTarget && lastTarget != target {
+
+		// The thread has left the line of a conditional break point
+
+		ed.lock.Lock()
+		delete(ed.breakPointTargets, tid)
+		ed.lock.Unlock()
+	}
+
+	if !ok || !active {
+		return false, nil
+	} else if cond == nil {
+		return true, nil
+	} else if hasLastTarget && lastTarget == target {
+		return false, nil
+	}
+
+	ed.lock.Lock()
+	ed.breakPointTargets[tid] = target
+	ed.lock.Unlock()
+
+	return cond.check(vs, tid)
+}
+
+/*
+checkWatches evaluates all watches of a thread and returns a description of
+all changed values. Returns an empty string if no value has changed.
+*/
+func (ed *ecalDebugger) checkWatches(vs parser.Scope, tid uint64) string {
+	var watches []*watch
+
+	ed.lock.RLock()
+	for _, w := range ed.watches[tid] {
+		watches = append(watches, w)
+	}
+	for _, w := range ed.variableWatches {
+		watches = append(watches, w)
+	}
+	ed.lock.RUnlock()
+
+	if len(watches) == 0 {
+		return ""
+	}
+
+	var changes []string
+
+	for _, w := range watches {
+		if val, ok := w.value(vs, tid); ok {
 
 			ed.lock.Lock()
-			ed.breakOnStart = false
-			ed.interrogationStates[tid] = is
+			oldVal, hasOldVal := w.values[tid]
+			w.values[tid] = val
 			ed.lock.Unlock()
 
-			is.cond.L.Lock()
-			is.cond.Wait()
-			is.cond.L.Unlock()
+			if hasOldVal && oldVal != val {
+				changes = append(changes, fmt.Sprintf("%v changed from %v to %v", w.expression, oldVal, val))
+			}
 		}
 	}
 
-	return nil
+	sort.Strings(changes)
+
+	return strings.Join(changes, ", ")
 }
 
 /*
 VisitStepInState is called before entering a function call.
 */
 func (ed *ecalDebugger) VisitStepInState(node *parser.ASTNode, vs parser.Scope, tid uint64) util.TraceableRuntimeError {
+	if ed.isEvalThread(tid) {
+		return nil
+	}
+
 	ed.lock.Lock()
 	defer ed.lock.Unlock()
 
@@ -316,7 +769,7 @@ func (ed *ecalDebugger) VisitStepInState(node *parser.ASTNode, vs parser.Scope,
 			// function call - the debugger should stop before entering
 
 			ed.lock.Unlock()
-			err = ed.VisitState(node, vs, tid)
+			err = ed.visitState(node, vs, tid)
 			ed.lock.Lock()
 		}
 
@@ -344,6 +797,10 @@ func (ed *ecalDebugger) VisitStepInState(node *parser.ASTNode, vs parser.Scope,
 VisitStepOutState is called after returning from a function call.
 */
 func (ed *ecalDebugger) VisitStepOutState(node *parser.ASTNode, vs parser.Scope, tid uint64, soErr error) util.TraceableRuntimeError {
+	if ed.isEvalThread(tid) {
+		return nil
+	}
+
 	ed.lock.Lock()
 	defer ed.lock.Unlock()
 
@@ -363,7 +820,12 @@ func (ed *ecalDebugger) VisitStepOutState(node *parser.ASTNode, vs parser.Scope,
 
 	is, ok := ed.interrogationStates[tid]
 
-	if ed.breakOnError && soErr != nil {
+	// Cancelled threads should not be suspended again
+
+	rerr, isRuntimeError := soErr.(*util.RuntimeError)
+	cancelled := isRuntimeError && rerr.Type == util.ErrCancelled
+
+	if ed.breakOnError && soErr != nil && !cancelled {
 
 		if !ok {
 			is = newInterrogationState(node, vs)
@@ -426,19 +888,44 @@ func (ed *ecalDebugger) RecordThreadFinished(tid uint64) {
 
 	if is, ok := ed.interrogationStates[tid]; !ok || !is.running {
 		delete(ed.interrogationStates, tid)
+		delete(ed.killedThreads, tid)
 		delete(ed.callStacks, tid)
 		delete(ed.callStackVsSnapshots, tid)
 		delete(ed.callStackGlobalVsSnapshots, tid)
+		delete(ed.breakPointTargets, tid)
+		delete(ed.watches, tid)
+		delete(ed.history, tid)
+
+		for _, w := range ed.variableWatches {
+			delete(w.values, tid)
+		}
 	}
 }
 
 /*
-SetBreakPoint sets a break point.
+SetBreakPoint sets a break point. The break point can have an optional
+condition (ECAL expression which is evaluated in the scope of the thread)
+and a hit count (break only on every n-th hit for which the condition is true).
 */
-func (ed *ecalDebugger) SetBreakPoint(source string, line int) {
-	ed.lock.Lock()
-	defer ed.lock.Unlock()
-	ed.breakPoints[fmt.Sprintf("%v:%v", source, line)] = true
+func (ed *ecalDebugger) SetBreakPoint(source string, line int, condition string, hitCount int) error {
+	cond, err := newBreakPointCondition(condition, hitCount)
+
+	if err == nil {
+		target := fmt.Sprintf("%v:%v", source, line)
+
+		ed.lock.Lock()
+		defer ed.lock.Unlock()
+
+		ed.breakPoints[target] = true
+
+		if cond != nil {
+			ed.breakPointConditions[target] = cond
+		} else {
+			delete(ed.breakPointConditions, target)
+		}
+	}
+
+	return err
 }
 
 /*
@@ -458,15 +945,84 @@ func (ed *ecalDebugger) RemoveBreakPoint(source string, line int) {
 	defer ed.lock.Unlock()
 	if line > 0 {
 		delete(ed.breakPoints, fmt.Sprintf("%v:%v", source, line))
+		delete(ed.breakPointConditions, fmt.Sprintf("%v:%v", source, line))
 	} else {
 		for k := range ed.breakPoints {
 			if ksource := strings.Split(k, ":")[0]; ksource == source {
 				delete(ed.breakPoints, k)
+				delete(ed.breakPointConditions, k)
 			}
 		}
 	}
 }
 
+/*
+SetWatch adds a watch expression to a thread. The thread is suspended when
+the value of the expression changes.
+*/
+func (ed *ecalDebugger) SetWatch(threadID uint64, expression string) error {
+	w, err := newWatch(expression, true)
+
+	if err == nil {
+		ed.lock.Lock()
+		defer ed.lock.Unlock()
+
+		if _, ok := ed.callStacks[threadID]; !ok {
+			return fmt.Errorf("Cannot find thread %v", threadID)
+		}
+
+		if _, ok := ed.watches[threadID]; !ok {
+			ed.watches[threadID] = make(map[string]*watch)
+		}
+
+		ed.watches[threadID][expression] = w
+	}
+
+	return err
+}
+
+/*
+RemoveWatch removes a watch expression from a thread. All watch expressions
+of the thread are removed if no expression is given.
+*/
+func (ed *ecalDebugger) RemoveWatch(threadID uint64, expression string) {
+	ed.lock.Lock()
+	defer ed.lock.Unlock()
+
+	if expression == "" {
+		delete(ed.watches, threadID)
+	} else if watches, ok := ed.watches[threadID]; ok {
+		delete(watches, expression)
+
+		if len(watches) == 0 {
+			delete(ed.watches, threadID)
+		}
+	}
+}
+
+/*
+SetVariableWatch adds a data break point for a variable. Every thread which
+changes the value of the variable is suspended.
+*/
+func (ed *ecalDebugger) SetVariableWatch(name string) {
+	w, _ := newWatch(name, false)
+
+	ed.lock.Lock()
+	defer ed.lock.Unlock()
+
+	ed.variableWatches[name] = w
+}
+
+/*
+RemoveVariableWatch removes a data break point for a variable.
+*/
+func (ed *ecalDebugger) RemoveVariableWatch(name string) {
+	ed.lock.Lock()
+	defer ed.lock.Unlock()
+
+	delete(ed.variableWatches, name)
+}
+
 /*
 ExtractValue copies a value from a suspended thread into the
 global variable scope.
@@ -538,6 +1094,66 @@ func (ed *ecalDebugger) InjectValue(threadID uint64, varName string, expression
 	return err
 }
 
+/*
+EvaluateExpression evaluates an expression in the variable scope of a suspended
+thread. The expression is evaluated in a copy of the variable scope so it
+cannot change the variables of the thread. Functions which are called by the
+expression run in their own thread which is ignored by the debugger (i.e. break
+points are not hit).
+*/
+func (ed *ecalDebugger) EvaluateExpression(threadID uint64, expression string) (interface{}, error) {
+	var ast *parser.ASTNode
+	var res interface{}
+	var err error
+
+	ed.lock.Lock()
+
+	is, ok := ed.interrogationStates[threadID]
+
+	if !ok || is.running {
+		ed.lock.Unlock()
+		return nil, fmt.Errorf("Cannot find suspended thread %v", threadID)
+	}
+
+	vs := scope.CopyScope(is.vs)
+
+	// Use thread IDs from the top of the ID range for evaluations
+
+	ed.lastEvalThread++
+	tid := math.MaxUint64 - ed.lastEvalThread
+	ed.evalThreads[tid] = true
+
+	ed.lock.Unlock()
+
+	defer func() {
+		ed.lock.Lock()
+		delete(ed.evalThreads, tid)
+		ed.lock.Unlock()
+	}()
+
+	ast, err = parser.ParseWithRuntime("EvaluateExpression", expression,
+		NewECALRuntimeProvider("EvaluateExpression", nil, nil))
+
+	if err == nil {
+		if err = ast.Runtime.Validate(); err == nil {
+			evs := scope.NewScopeWithParent("EvaluateExpressionScope", vs)
+			res, err = ast.Runtime.Eval(evs, make(map[string]interface{}), tid)
+		}
+	}
+
+	return res, err
+}
+
+/*
+isEvalThread checks if a given thread evaluates an expression for the debugger.
+*/
+func (ed *ecalDebugger) isEvalThread(tid uint64) bool {
+	ed.lock.RLock()
+	defer ed.lock.RUnlock()
+
+	return ed.evalThreads[tid]
+}
+
 /*
 Continue will continue a suspended thread.
 */
@@ -568,6 +1184,18 @@ func (ed *ecalDebugger) Continue(threadID uint64, contType util.ContType) {
 	}
 }
 
+/*
+KillThread raises a Cancelled error in a thread on its next state change.
+A suspended thread is resumed.
+*/
+func (ed *ecalDebugger) KillThread(threadID uint64) {
+	ed.lock.Lock()
+	ed.killedThreads[threadID] = true
+	ed.lock.Unlock()
+
+	ed.Continue(threadID, util.Resume)
+}
+
 /*
 Status returns the current status of the debugger.
 */
@@ -590,6 +1218,34 @@ func (ed *ecalDebugger) Status() interface{} {
 	}
 	res["sources"] = sources
 
+	if len(ed.breakPointConditions) > 0 {
+		conditions := make(map[string]interface{})
+
+		for k, c := range ed.breakPointConditions {
+			c.lock.Lock()
+			conditions[k] = map[string]interface{}{
+				"condition": c.expression,
+				"hitCount":  c.hitCount,
+				"hits":      c.hits,
+			}
+			c.lock.Unlock()
+		}
+
+		res["breakpointconditions"] = conditions
+	}
+
+	if len(ed.variableWatches) > 0 {
+		var names []string
+
+		for k := range ed.variableWatches {
+			names = append(names, k)
+		}
+
+		sort.Strings(names)
+
+		res["watchvars"] = names
+	}
+
 	for k, v := range ed.callStacks {
 		s := map[string]interface{}{
 			"callStack": ed.prettyPrintCallStack(v),
@@ -600,6 +1256,18 @@ func (ed *ecalDebugger) Status() interface{} {
 			s["error"] = is.err
 		}
 
+		if watches, ok := ed.watches[k]; ok {
+			var expressions []string
+
+			for e := range watches {
+				expressions = append(expressions, e)
+			}
+
+			sort.Strings(expressions)
+
+			s["watches"] = expressions
+		}
+
 		threadStates[fmt.Sprint(k)] = s
 	}
 
@@ -644,6 +1312,14 @@ func (ed *ecalDebugger) Describe(threadID uint64) interface{} {
 			"callStackVsSnapshotGlobal": ed.callStackGlobalVsSnapshots[threadID],
 		}
 
+		if is.watchChange != "" {
+			res["watchChange"] = is.watchChange
+		}
+
+		if watchValues := ed.watchValues(threadID); len(watchValues) > 0 {
+			res["watches"] = watchValues
+		}
+
 		if !is.running {
 
 			codeString, _ := parser.PrettyPrint(is.node)
@@ -657,6 +1333,56 @@ func (ed *ecalDebugger) Describe(threadID uint64) interface{} {
 	return res
 }
 
+/*
+History returns the last recorded states of a thread (oldest first).
+*/
+func (ed *ecalDebugger) History(threadID uint64) interface{} {
+	ed.lock.RLock()
+	rb, ok := ed.history[threadID]
+	ed.lock.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	res := make([]interface{}, 0, rb.Size())
+
+	for _, e := range rb.Slice() {
+		he := e.(*historyEntry)
+		codeString, _ := parser.PrettyPrint(he.node)
+
+		res = append(res, map[string]interface{}{
+			"code":   codeString,
+			"source": he.node.Token.Lsource,
+			"line":   he.node.Token.Lline,
+			"vs":     he.vs,
+		})
+	}
+
+	return res
+}
+
+/*
+watchValues returns the last known values of all watches of a thread.
+*/
+func (ed *ecalDebugger) watchValues(threadID uint64) map[string]interface{} {
+	res := make(map[string]interface{})
+
+	for e, w := range ed.watches[threadID] {
+		if val, ok := w.values[threadID]; ok {
+			res[e] = val
+		}
+	}
+
+	for e, w := range ed.variableWatches {
+		if val, ok := w.values[threadID]; ok {
+			res[e] = val
+		}
+	}
+
+	return res
+}
+
 func (ed *ecalDebugger) buildVsSnapshot(vs parser.Scope) map[string]interface{} {
 	vsValues := make(map[string]interface{})
 
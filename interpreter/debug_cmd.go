@@ -15,10 +15,12 @@ package interpreter
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
 	"github.com/krotik/ecal/util"
 )
 
@@ -27,15 +29,25 @@ DebugCommandsMap contains the mapping of inbuild debug commands.
 */
 var DebugCommandsMap = map[string]util.DebugCommand{
 	"breakonstart": &breakOnStartCommand{&inbuildDebugCommand{}},
+	"breakonerror": &breakOnErrorCommand{&inbuildDebugCommand{}},
 	"break":        &setBreakpointCommand{&inbuildDebugCommand{}},
 	"rmbreak":      &rmBreakpointCommand{&inbuildDebugCommand{}},
 	"disablebreak": &disableBreakpointCommand{&inbuildDebugCommand{}},
+	"watch":        &watchCommand{&inbuildDebugCommand{}},
+	"rmwatch":      &rmWatchCommand{&inbuildDebugCommand{}},
+	"watchvar":     &watchVarCommand{&inbuildDebugCommand{}},
+	"rmwatchvar":   &rmWatchVarCommand{&inbuildDebugCommand{}},
 	"cont":         &contCommand{&inbuildDebugCommand{}},
+	"kill":         &killCommand{&inbuildDebugCommand{}},
 	"describe":     &describeCommand{&inbuildDebugCommand{}},
 	"status":       &statusCommand{&inbuildDebugCommand{}},
+	"history":      &historyCommand{&inbuildDebugCommand{}},
 	"extract":      &extractCommand{&inbuildDebugCommand{}},
 	"inject":       &injectCommand{&inbuildDebugCommand{}},
+	"eval":         &evalCommand{&inbuildDebugCommand{}},
 	"lockstate":    &lockstateCommand{&inbuildDebugCommand{}},
+	"save":         &saveCommand{&inbuildDebugCommand{}},
+	"load":         &loadCommand{&inbuildDebugCommand{}},
 }
 
 /*
@@ -78,21 +90,44 @@ func (c *setBreakpointCommand) Run(debugger util.ECALDebugger, args []string) (i
 
 	if len(targetSplit) > 1 {
 		if line, err := strconv.Atoi(targetSplit[1]); err == nil {
+			var condition string
+			var hitCount int
 
-			debugger.SetBreakPoint(targetSplit[0], line)
+			// Parse optional condition and hit count: [if <expression>] [hit <count>]
 
-			return nil, nil
+			rest := strings.Join(args[1:], " ")
+
+			if m := breakHitCountRegexp.FindStringSubmatch(rest); m != nil {
+				if hitCount, _ = strconv.Atoi(m[2]); hitCount < 1 {
+					return nil, fmt.Errorf("Hit count should be a positive number")
+				}
+				rest = rest[:len(rest)-len(m[0])]
+			}
+
+			if rest != "" {
+				if !strings.HasPrefix(rest, "if ") {
+					return nil, fmt.Errorf("Invalid break condition - should be if <expression> [hit <count>]")
+				}
+				condition = strings.TrimSpace(rest[3:])
+			}
+
+			return nil, debugger.SetBreakPoint(targetSplit[0], line, condition, hitCount)
 		}
 	}
 
 	return nil, fmt.Errorf("Invalid break target - should be <source>:<line>")
 }
 
+/*
+breakHitCountRegexp matches the hit count at the end of a break command.
+*/
+var breakHitCountRegexp = regexp.MustCompile(`(^|\s+)hit\s+(\d+)$`)
+
 /*
 DocString returns a descriptive text about this command.
 */
 func (c *setBreakpointCommand) DocString() string {
-	return "Set a breakpoint specifying <source>:<line>"
+	return "Set a breakpoint specifying <source>:<line> [if <condition>] [hit <count>]"
 }
 
 // breakOnStartCommand
@@ -125,6 +160,36 @@ func (c *breakOnStartCommand) DocString() string {
 	return "Break on the start of the next execution."
 }
 
+// breakOnErrorCommand
+// ===================
+
+/*
+breakOnErrorCommand breaks if an error occurs.
+*/
+type breakOnErrorCommand struct {
+	*inbuildDebugCommand
+}
+
+/*
+Execute the debug command and return its result. It must be possible to
+convert the output data into a JSON string.
+*/
+func (c *breakOnErrorCommand) Run(debugger util.ECALDebugger, args []string) (interface{}, error) {
+	b := true
+	if len(args) > 0 {
+		b, _ = strconv.ParseBool(args[0])
+	}
+	debugger.BreakOnError(b)
+	return nil, nil
+}
+
+/*
+DocString returns a descriptive text about this command.
+*/
+func (c *breakOnErrorCommand) DocString() string {
+	return "Break if an error occurs."
+}
+
 // rmbreak
 // =======
 
@@ -211,6 +276,138 @@ func (c *disableBreakpointCommand) DocString() string {
 	return "Temporarily disable a breakpoint specifying <source>:<line>"
 }
 
+// watch
+// =====
+
+/*
+watchCommand adds a watch expression to a thread
+*/
+type watchCommand struct {
+	*inbuildDebugCommand
+}
+
+/*
+Execute the debug command and return its result. It must be possible to
+convert the output data into a JSON string.
+*/
+func (c *watchCommand) Run(debugger util.ECALDebugger, args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("Need a thread ID and an expression")
+	}
+
+	threadID, err := c.AssertNumParam(1, args[0])
+
+	if err == nil {
+		err = debugger.SetWatch(threadID, strings.Join(args[1:], " "))
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive text about this command.
+*/
+func (c *watchCommand) DocString() string {
+	return "Suspend a thread when the value of an expression changes. Specify <threadID> <expression>"
+}
+
+// rmwatch
+// =======
+
+/*
+rmWatchCommand removes a watch expression from a thread
+*/
+type rmWatchCommand struct {
+	*inbuildDebugCommand
+}
+
+/*
+Execute the debug command and return its result. It must be possible to
+convert the output data into a JSON string.
+*/
+func (c *rmWatchCommand) Run(debugger util.ECALDebugger, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Need a thread ID")
+	}
+
+	threadID, err := c.AssertNumParam(1, args[0])
+
+	if err == nil {
+		debugger.RemoveWatch(threadID, strings.Join(args[1:], " "))
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive text about this command.
+*/
+func (c *rmWatchCommand) DocString() string {
+	return "Remove a watch expression specifying <threadID> [<expression>] (removes all watch expressions of the thread if no expression is given)"
+}
+
+// watchvar
+// ========
+
+/*
+watchVarCommand adds a data breakpoint for a variable
+*/
+type watchVarCommand struct {
+	*inbuildDebugCommand
+}
+
+/*
+Execute the debug command and return its result. It must be possible to
+convert the output data into a JSON string.
+*/
+func (c *watchVarCommand) Run(debugger util.ECALDebugger, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("Need a variable name")
+	}
+
+	debugger.SetVariableWatch(args[0])
+
+	return nil, nil
+}
+
+/*
+DocString returns a descriptive text about this command.
+*/
+func (c *watchVarCommand) DocString() string {
+	return "Suspend any thread which changes the value of a variable. Specify <variable>"
+}
+
+// rmwatchvar
+// ==========
+
+/*
+rmWatchVarCommand removes a data breakpoint for a variable
+*/
+type rmWatchVarCommand struct {
+	*inbuildDebugCommand
+}
+
+/*
+Execute the debug command and return its result. It must be possible to
+convert the output data into a JSON string.
+*/
+func (c *rmWatchVarCommand) Run(debugger util.ECALDebugger, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("Need a variable name")
+	}
+
+	debugger.RemoveVariableWatch(args[0])
+
+	return nil, nil
+}
+
+/*
+DocString returns a descriptive text about this command.
+*/
+func (c *rmWatchVarCommand) DocString() string {
+	return "Remove a data breakpoint specifying <variable>"
+}
+
 // cont
 // ====
 
@@ -262,6 +459,41 @@ func (c *contCommand) DocString() string {
 	return "Continues a suspended thread. Specify <threadID> <Resume | StepIn | StepOver | StepOut>"
 }
 
+// kill
+// ====
+
+/*
+killCommand kills a running or suspended thread
+*/
+type killCommand struct {
+	*inbuildDebugCommand
+}
+
+/*
+Execute the debug command and return its result. It must be possible to
+convert the output data into a JSON string.
+*/
+func (c *killCommand) Run(debugger util.ECALDebugger, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("Need a thread ID")
+	}
+
+	threadID, err := c.AssertNumParam(1, args[0])
+
+	if err == nil {
+		debugger.KillThread(threadID)
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive text about this command.
+*/
+func (c *killCommand) DocString() string {
+	return "Kills a thread by raising a Cancelled error on its next state change. Specify <threadID>"
+}
+
 // describe
 // ========
 
@@ -300,6 +532,44 @@ func (c *describeCommand) DocString() string {
 	return "Describes a suspended thread."
 }
 
+// history
+// =======
+
+/*
+historyCommand shows the last recorded states of a thread
+*/
+type historyCommand struct {
+	*inbuildDebugCommand
+}
+
+/*
+Execute the debug command and return its result. It must be possible to
+convert the output data into a JSON string.
+*/
+func (c *historyCommand) Run(debugger util.ECALDebugger, args []string) (interface{}, error) {
+	var res interface{}
+
+	if len(args) != 1 {
+		return nil, fmt.Errorf("Need a thread ID")
+	}
+
+	threadID, err := c.AssertNumParam(1, args[0])
+
+	if err == nil {
+
+		res = debugger.History(threadID)
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive text about this command.
+*/
+func (c *historyCommand) DocString() string {
+	return "Shows the last recorded states of a thread (oldest first)."
+}
+
 // status
 // ======
 
@@ -406,6 +676,43 @@ func (c *injectCommand) DocString() string {
 	return "Copies a value from the global variable scope into a suspended thread."
 }
 
+// eval
+// ====
+
+/*
+evalCommand evaluates an expression in the variable scope of a suspended thread
+*/
+type evalCommand struct {
+	*inbuildDebugCommand
+}
+
+/*
+Execute the debug command and return its result. It must be possible to
+convert the output data into a JSON string.
+*/
+func (c *evalCommand) Run(debugger util.ECALDebugger, args []string) (interface{}, error) {
+	var res interface{}
+
+	if len(args) < 2 {
+		return nil, fmt.Errorf("Need a thread ID and an expression")
+	}
+
+	threadID, err := c.AssertNumParam(1, args[0])
+
+	if err == nil {
+		res, err = debugger.EvaluateExpression(threadID, strings.Join(args[1:], " "))
+	}
+
+	return scope.ConvertECALToJSONObject(res), err
+}
+
+/*
+DocString returns a descriptive text about this command.
+*/
+func (c *evalCommand) DocString() string {
+	return "Evaluates an expression in the variable scope of a suspended thread without changing it."
+}
+
 // lockstate
 // =========
 
@@ -430,3 +737,65 @@ DocString returns a descriptive text about this command.
 func (c *lockstateCommand) DocString() string {
 	return "Inspects the locking state."
 }
+
+// save
+// ====
+
+/*
+saveCommand saves the break points and settings of the debugger to a file
+*/
+type saveCommand struct {
+	*inbuildDebugCommand
+}
+
+/*
+Execute the debug command and return its result. It must be possible to
+convert the output data into a JSON string.
+*/
+func (c *saveCommand) Run(debugger util.ECALDebugger, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Need a file name as first parameter")
+	}
+
+	return nil, SaveDebugSession(debugger, args[0])
+}
+
+/*
+DocString returns a descriptive text about this command.
+*/
+func (c *saveCommand) DocString() string {
+	return "Save all breakpoints and settings to a file specifying <file>"
+}
+
+// load
+// ====
+
+/*
+loadCommand loads the break points and settings of the debugger from a file
+*/
+type loadCommand struct {
+	*inbuildDebugCommand
+}
+
+/*
+Execute the debug command and return its result. It must be possible to
+convert the output data into a JSON string.
+*/
+func (c *loadCommand) Run(debugger util.ECALDebugger, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Need a file name as first parameter")
+	}
+
+	if err := LoadDebugSession(debugger, args[0]); err != nil {
+		return nil, err
+	}
+
+	return debugger.Status(), nil
+}
+
+/*
+DocString returns a descriptive text about this command.
+*/
+func (c *loadCommand) DocString() string {
+	return "Replace all breakpoints and settings with the ones of a file specifying <file>"
+}
@@ -13,6 +13,10 @@ package interpreter
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -198,6 +202,433 @@ test3`[1:] {
 	}
 }
 
+func TestConditionalBreakpoints(t *testing.T) {
+	var err error
+
+	defer func() {
+		testDebugger = nil
+	}()
+
+	testDebugger = NewECALDebugger(nil)
+	testDebugger.BreakOnError(false)
+
+	_, err = testDebugger.HandleInput("break ECALEvalTest:4 if i > 5 hit 2")
+	errorutil.AssertOk(err)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	var tid uint64
+
+	go func() {
+		_, err = UnitTestEval(`
+a := 0
+for i in range(1, 10) {
+  a := a + i
+}
+log(a)
+`, nil)
+		if err != nil {
+			t.Error(err)
+		}
+
+		testDebugger.RecordThreadFinished(tid)
+
+		wg.Done()
+	}()
+
+	// The breakpoint should be hit on every second time the condition is true
+
+	for _, expected := range []string{"7", "9"} {
+
+		tid = waitForThreadSuspension(t)
+
+		out, err := testDebugger.HandleInput(fmt.Sprintf("describe %v", tid))
+		errorutil.AssertOk(err)
+
+		if res := fmt.Sprint(out.(map[string]interface{})["vs"].(map[string]interface{})["i"]); res != expected {
+			t.Error("Unexpected result:", res)
+			return
+		}
+
+		_, err = testDebugger.HandleInput(fmt.Sprintf("cont %v Resume", tid))
+		errorutil.AssertOk(err)
+	}
+
+	wg.Wait()
+
+	if testlogger.String() != "55" {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+
+	out, err := testDebugger.HandleInput(fmt.Sprintf("status"))
+
+	outBytes, _ := json.MarshalIndent(out, "", "  ")
+	outString := string(outBytes)
+
+	if err != nil || outString != `{
+  "breakonstart": false,
+  "breakpointconditions": {
+    "ECALEvalTest:4": {
+      "condition": "i \u003e 5",
+      "hitCount": 2,
+      "hits": 5
+    }
+  },
+  "breakpoints": {
+    "ECALEvalTest:4": true
+  },
+  "sources": [
+    "ECALEvalTest"
+  ],
+  "threads": {}
+}` {
+		t.Error("Unexpected result:", outString, err)
+		return
+	}
+
+	// Conditions which cannot be evaluated stop the thread with an error
+
+	_, err = testDebugger.HandleInput("break ECALEvalTest:2 if \"foo\"")
+	errorutil.AssertOk(err)
+
+	wg.Add(1)
+
+	go func() {
+		_, err = UnitTestEval(`
+a := 1
+log(a)
+`, nil)
+		if err != nil {
+			t.Error(err)
+		}
+
+		testDebugger.RecordThreadFinished(tid)
+
+		wg.Done()
+	}()
+
+	tid = waitForThreadSuspension(t)
+
+	out, err = testDebugger.HandleInput(fmt.Sprintf("describe %v", tid))
+	errorutil.AssertOk(err)
+
+	if res := fmt.Sprint(out.(map[string]interface{})["error"]); res !=
+		"Could not evaluate break point condition \"foo\": Result is not a boolean: foo" {
+		t.Error("Unexpected result:", res, out)
+		return
+	}
+
+	_, err = testDebugger.HandleInput(fmt.Sprintf("cont %v Resume", tid))
+	errorutil.AssertOk(err)
+
+	wg.Wait()
+
+	// Setting a breakpoint without conditions removes the conditions
+
+	_, err = testDebugger.HandleInput("break ECALEvalTest:4")
+	errorutil.AssertOk(err)
+	_, err = testDebugger.HandleInput("rmbreak ECALEvalTest:2")
+	errorutil.AssertOk(err)
+
+	out, err = testDebugger.HandleInput(fmt.Sprintf("status"))
+
+	outBytes, _ = json.MarshalIndent(out, "", "  ")
+	outString = string(outBytes)
+
+	if err != nil || outString != `{
+  "breakonstart": false,
+  "breakpoints": {
+    "ECALEvalTest:4": true
+  },
+  "sources": [
+    "ECALEvalTest"
+  ],
+  "threads": {}
+}` {
+		t.Error("Unexpected result:", outString, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err = testDebugger.HandleInput("break ECALEvalTest:4 if a >"); err == nil ||
+		!strings.HasPrefix(err.Error(), "Invalid break point condition a >: Parse error") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = testDebugger.HandleInput("break ECALEvalTest:4 hit 0"); err == nil ||
+		err.Error() != "Hit count should be a positive number" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = testDebugger.HandleInput("break ECALEvalTest:4 when a > 1"); err == nil ||
+		err.Error() != "Invalid break condition - should be if <expression> [hit <count>]" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestWatches(t *testing.T) {
+	var err error
+
+	defer func() {
+		testDebugger = nil
+	}()
+
+	testDebugger = NewECALDebugger(nil)
+	testDebugger.BreakOnError(false)
+
+	_, err = testDebugger.HandleInput("break ECALEvalTest:3")
+	errorutil.AssertOk(err)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	var tid uint64
+
+	go func() {
+		_, err = UnitTestEval(`
+a := 0
+b := 0
+for i in range(1, 5) {
+  a := a + i
+  if i == 3 {
+    b := 1
+  }
+}
+log(a, b)
+`, nil)
+		if err != nil {
+			t.Error(err)
+		}
+
+		testDebugger.RecordThreadFinished(tid)
+
+		wg.Done()
+	}()
+
+	tid = waitForThreadSuspension(t)
+
+	_, err = testDebugger.HandleInput(fmt.Sprintf("watch %v a > 5", tid))
+	errorutil.AssertOk(err)
+	_, err = testDebugger.HandleInput("watchvar b")
+	errorutil.AssertOk(err)
+	_, err = testDebugger.HandleInput("rmbreak ECALEvalTest:3")
+	errorutil.AssertOk(err)
+
+	out, err := testDebugger.HandleInput("status")
+
+	outBytes, _ := json.MarshalIndent(out, "", "  ")
+	outString := string(outBytes)
+
+	if err != nil || outString != `{
+  "breakonstart": false,
+  "breakpoints": {},
+  "sources": [
+    "ECALEvalTest"
+  ],
+  "threads": {
+    "`+fmt.Sprint(tid)+`": {
+      "callStack": [],
+      "error": null,
+      "threadRunning": false,
+      "watches": [
+        "a \u003e 5"
+      ]
+    }
+  },
+  "watchvars": [
+    "b"
+  ]
+}` {
+		t.Error("Unexpected result:", outString, err)
+		return
+	}
+
+	_, err = testDebugger.HandleInput(fmt.Sprintf("cont %v Resume", tid))
+	errorutil.AssertOk(err)
+
+	// The thread should be suspended once for each changed watch
+
+	for _, expected := range []string{"a > 5 changed from false to true", "b changed from 0 to 1"} {
+
+		tid = waitForThreadSuspension(t)
+
+		out, err := testDebugger.HandleInput(fmt.Sprintf("describe %v", tid))
+		errorutil.AssertOk(err)
+
+		if res := fmt.Sprint(out.(map[string]interface{})["watchChange"]); res != expected {
+			t.Error("Unexpected result:", res)
+			return
+		}
+
+		_, err = testDebugger.HandleInput(fmt.Sprintf("cont %v Resume", tid))
+		errorutil.AssertOk(err)
+	}
+
+	wg.Wait()
+
+	if testlogger.String() != "151" {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+
+	// Test error cases
+
+	if _, err = testDebugger.HandleInput("watch 1"); err == nil ||
+		err.Error() != "Need a thread ID and an expression" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = testDebugger.HandleInput("watch 99 a"); err == nil ||
+		err.Error() != "Cannot find thread 99" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = testDebugger.HandleInput("watch 99 a >"); err == nil ||
+		!strings.HasPrefix(err.Error(), "Invalid watch expression a >: Parse error") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = testDebugger.HandleInput("rmwatch"); err == nil ||
+		err.Error() != "Need a thread ID" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = testDebugger.HandleInput("watchvar"); err == nil ||
+		err.Error() != "Need a variable name" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = testDebugger.HandleInput("rmwatchvar"); err == nil ||
+		err.Error() != "Need a variable name" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = testDebugger.HandleInput("rmwatchvar b")
+	errorutil.AssertOk(err)
+
+	out, err = testDebugger.HandleInput("status")
+
+	outBytes, _ = json.MarshalIndent(out, "", "  ")
+	outString = string(outBytes)
+
+	if err != nil || outString != `{
+  "breakonstart": false,
+  "breakpoints": {},
+  "sources": [
+    "ECALEvalTest"
+  ],
+  "threads": {}
+}` {
+		t.Error("Unexpected result:", outString, err)
+		return
+	}
+}
+
+func TestHistory(t *testing.T) {
+	var err error
+
+	defer func() {
+		testDebugger = nil
+	}()
+
+	testDebugger = NewECALDebugger(nil)
+	testDebugger.SetHistorySize(3)
+
+	_, err = testDebugger.HandleInput("break ECALEvalTest:5")
+	errorutil.AssertOk(err)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	var tid uint64
+
+	go func() {
+		_, err = UnitTestEval(`
+a := 1
+b := a + 1
+c := b + 1
+log(a, b, c)
+a := 0
+`, nil)
+		if err != nil {
+			t.Error(err)
+		}
+
+		testDebugger.RecordThreadFinished(tid)
+
+		wg.Done()
+	}()
+
+	tid = waitForThreadSuspension(t)
+
+	out, err := testDebugger.HandleInput(fmt.Sprintf("history %v", tid))
+
+	outBytes, _ := json.MarshalIndent(out, "", "  ")
+	outString := string(outBytes)
+
+	if err != nil || outString != `[
+  {
+    "code": "b := a + 1",
+    "line": 3,
+    "source": "ECALEvalTest",
+    "vs": {
+      "a": 1
+    }
+  },
+  {
+    "code": "c := b + 1",
+    "line": 4,
+    "source": "ECALEvalTest",
+    "vs": {
+      "a": 1,
+      "b": 2
+    }
+  },
+  {
+    "code": "log(a, b, c)",
+    "line": 5,
+    "source": "ECALEvalTest",
+    "vs": {
+      "a": 1,
+      "b": 2,
+      "c": 3
+    }
+  }
+]` {
+		t.Error("Unexpected result:", outString, err)
+		return
+	}
+
+	_, err = testDebugger.HandleInput(fmt.Sprintf("cont %v Resume", tid))
+	errorutil.AssertOk(err)
+
+	wg.Wait()
+
+	// The history is removed once the thread has finished
+
+	if out, err = testDebugger.HandleInput(fmt.Sprintf("history %v", tid)); out != nil || err != nil {
+		t.Error("Unexpected result:", out, err)
+		return
+	}
+
+	if _, err = testDebugger.HandleInput("history"); err == nil || err.Error() != "Need a thread ID" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
 func TestDebugReset(t *testing.T) {
 	var err error
 
@@ -267,6 +698,205 @@ test2`[1:] {
 	}
 }
 
+func TestDebugSession(t *testing.T) {
+	var err error
+
+	dir, err := ioutil.TempDir("", "ecaldebugsession")
+	errorutil.AssertOk(err)
+	defer os.RemoveAll(dir)
+
+	sessionFile := filepath.Join(dir, "session.json")
+
+	debugger := NewECALDebugger(nil)
+
+	for _, cmd := range []string{
+		"break foo.ecal:12",
+		"break a/bar.ecal:3 if a > 1 hit 2",
+		"break bar.ecal:5",
+		"disablebreak bar.ecal:5",
+		"watchvar counter",
+		"breakonstart",
+		"breakonerror false",
+		"save " + sessionFile,
+	} {
+		_, err = debugger.HandleInput(cmd)
+		errorutil.AssertOk(err)
+	}
+
+	data, err := ioutil.ReadFile(sessionFile)
+	errorutil.AssertOk(err)
+
+	if string(data) != `{
+  "breakpoints": [
+    {
+      "source": "a/bar.ecal",
+      "line": 3,
+      "condition": "a \u003e 1",
+      "hitCount": 2
+    },
+    {
+      "source": "bar.ecal",
+      "line": 5,
+      "disabled": true
+    },
+    {
+      "source": "foo.ecal",
+      "line": 12
+    }
+  ],
+  "breakonstart": true,
+  "breakonerror": false,
+  "watchvars": [
+    "counter"
+  ]
+}` {
+		t.Error("Unexpected result:", string(data))
+		return
+	}
+
+	// Load the session into a new debugger - existing break points are replaced
+
+	debugger2 := NewECALDebugger(nil)
+
+	_, err = debugger2.HandleInput("break other.ecal:1")
+	errorutil.AssertOk(err)
+
+	out, err := debugger2.HandleInput("load " + sessionFile)
+	errorutil.AssertOk(err)
+
+	outBytes, _ := json.MarshalIndent(out, "", "  ")
+
+	if res := string(outBytes); res != `{
+  "breakonstart": true,
+  "breakpointconditions": {
+    "a/bar.ecal:3": {
+      "condition": "a \u003e 1",
+      "hitCount": 2,
+      "hits": 0
+    }
+  },
+  "breakpoints": {
+    "a/bar.ecal:3": true,
+    "bar.ecal:5": false,
+    "foo.ecal:12": true
+  },
+  "sources": null,
+  "threads": {},
+  "watchvars": [
+    "counter"
+  ]
+}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if !reflect.DeepEqual(debugger.Session(), debugger2.Session()) {
+		t.Error("Unexpected result:", debugger.Session(), debugger2.Session())
+		return
+	}
+
+	// Test error handling
+
+	if _, err = debugger2.HandleInput("save"); err == nil || err.Error() != "Need a file name as first parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = debugger2.HandleInput("load"); err == nil || err.Error() != "Need a file name as first parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	ioutil.WriteFile(sessionFile, []byte("{"), 0644)
+
+	if _, err = debugger2.HandleInput("load " + sessionFile); err == nil ||
+		err.Error() != fmt.Sprintf("Could not parse debug session file %v: unexpected end of JSON input", sessionFile) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for _, bp := range []*util.DebugBreakPoint{
+		{Source: "foo.ecal", Line: 0},
+		{Source: "foo.ecal", Line: 1, Condition: "a >"},
+	} {
+		if err = debugger2.LoadSession(&util.DebugSession{BreakPoints: []*util.DebugBreakPoint{bp}}); err == nil {
+			t.Error("Invalid break point should not be loaded:", bp)
+			return
+		}
+	}
+
+	// A failed load does not change the debugger
+
+	if !reflect.DeepEqual(debugger.Session(), debugger2.Session()) {
+		t.Error("Unexpected result:", debugger2.Session())
+		return
+	}
+}
+
+func TestKillThread(t *testing.T) {
+	var err error
+
+	defer func() {
+		testDebugger = nil
+	}()
+
+	testDebugger = NewECALDebugger(nil)
+
+	if _, err = testDebugger.HandleInput("break ECALEvalTest:5"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		_, err = UnitTestEval(`
+result := null
+log("test1")
+try {
+  log("test2")
+  log("test3")
+} except "Cancelled" as e {
+  result := e.detail
+}
+log("test4")
+`, vs)
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	waitForThreadSuspension(t)
+
+	if _, err := testDebugger.HandleInput("kill 1"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	wg.Wait()
+
+	if res := scope.ToObject(vs)["result"]; err != nil || res != "Thread was killed by the debugger" ||
+		testlogger.String() != "test1\ntest4" {
+		t.Error("Unexpected result:", res, testlogger.String(), err)
+		return
+	}
+
+	if _, err := testDebugger.HandleInput("kill"); err == nil || err.Error() != "Need a thread ID" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := testDebugger.HandleInput("kill foo"); err == nil || err.Error() != "Parameter 1 should be a number" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
 func TestErrorStop(t *testing.T) {
 	var err, evalError error
 
@@ -1411,6 +2041,118 @@ test3 b=49`[1:] {
 	}
 }
 
+func TestEvaluateExpressionDebugging(t *testing.T) {
+	var err error
+
+	defer func() {
+		testDebugger = nil
+	}()
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	testDebugger = NewECALDebugger(vs)
+
+	for _, cmd := range []string{"break ECALEvalTest:5", "break ECALEvalTest:9"} {
+		_, err = testDebugger.HandleInput(cmd)
+		errorutil.AssertOk(err)
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	go func() {
+		_, err = UnitTestEval(`
+b := {"x" : [1, 2]}
+func myfunc(p) {
+	a := 56
+	log("test2 a=", a)
+}
+func helper() {
+	c := 1
+	log("helper")
+	return c + 2
+}
+log("test1")
+myfunc(1)
+log("test3 b=", b)
+`, vs)
+		if err != nil {
+			t.Error(err)
+		}
+		wg.Done()
+	}()
+
+	tid := waitForThreadSuspension(t)
+
+	status, err := testDebugger.HandleInput("status")
+	errorutil.AssertOk(err)
+	statusBytes, _ := json.Marshal(status)
+
+	for cmd, expected := range map[string]string{
+		"eval %v a + p":                   `57`,
+		"eval %v b":                       `{"x":[1,2]}`,
+		"eval %v {\"y\" : [a, p], 1 : 2}": `{"1":2,"y":[56,1]}`,
+		"eval %v a := 1":                  `null`,
+		"eval %v b.x[0] := 9":             `null`,
+		"eval %v a":                       `56`,
+		"eval %v b.x":                     `[1,2]`,
+		"eval %v helper()":                `3`,
+		"eval %v myfunc":                  `"ecal.function: myfunc (Line 3, Pos 1)"`,
+	} {
+		out, err := testDebugger.HandleInput(fmt.Sprintf(cmd, tid))
+		errorutil.AssertOk(err)
+
+		if outBytes, _ := json.Marshal(out); string(outBytes) != expected {
+			t.Error("Unexpected result for", cmd, ":", string(outBytes))
+			return
+		}
+	}
+
+	// The evaluation should not change the state of the thread
+
+	status2, err := testDebugger.HandleInput("status")
+	errorutil.AssertOk(err)
+
+	if statusBytes2, _ := json.Marshal(status2); string(statusBytes) != string(statusBytes2) {
+		t.Error("Unexpected result:", string(statusBytes), string(statusBytes2))
+		return
+	}
+
+	// Test error handling
+
+	for cmd, expected := range map[string]string{
+		"eval":                           "Need a thread ID and an expression",
+		"eval 1":                         "Need a thread ID and an expression",
+		"eval x a":                       "Parameter 1 should be a number",
+		"eval 99 a":                      "Cannot find suspended thread 99",
+		fmt.Sprint("eval ", tid, " a +"): "Parse error in EvaluateExpression: Unexpected end",
+		fmt.Sprint("eval ", tid, " d()"): "ECAL error in EvaluateExpression (EvaluateExpression): Unknown construct (Unknown function: d) (Line:1 Pos:1)",
+	} {
+		if _, err := testDebugger.HandleInput(cmd); err == nil || err.Error() != expected {
+			t.Error("Unexpected result for", cmd, ":", err)
+			return
+		}
+	}
+
+	_, err = testDebugger.HandleInput(fmt.Sprintf("cont %v Resume", tid))
+	errorutil.AssertOk(err)
+
+	wg.Wait()
+
+	if testlogger.String() != `test1
+helper
+test2 a=56
+test3 b={
+  "x": [
+    1,
+    2
+  ]
+}` {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+}
+
 func TestSimpleStacktrace(t *testing.T) {
 
 	res, err := UnitTestEval(`
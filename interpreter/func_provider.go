@@ -11,13 +11,20 @@
 package interpreter
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/krotik/common/datautil"
 	"github.com/krotik/common/errorutil"
+	"github.com/krotik/common/sortutil"
 	"github.com/krotik/common/timeutil"
 	"github.com/krotik/ecal/engine"
 	"github.com/krotik/ecal/parser"
@@ -33,21 +40,58 @@ var InbuildFuncMap = map[string]util.ECALFunction{
 	"range":           &rangeFunc{&inbuildBaseFunc{}},
 	"new":             &newFunc{&inbuildBaseFunc{}},
 	"type":            &typeFunc{&inbuildBaseFunc{}},
+	"keys":            &keysFunc{&inbuildBaseFunc{}},
+	"values":          &valuesFunc{&inbuildBaseFunc{}},
+	"hasKey":          &hasKeyFunc{&inbuildBaseFunc{}},
+	"callable":        &callableFunc{&inbuildBaseFunc{}},
+	"memoize":         &memoizeFunc{&inbuildBaseFunc{}},
+	"parallelMap":     &parallelMapFunc{&inbuildBaseFunc{}},
+	"atomicAdd":       &atomicAddFunc{&inbuildBaseFunc{}},
+	"cas":             &casFunc{&inbuildBaseFunc{}},
 	"len":             &lenFunc{&inbuildBaseFunc{}},
+	"get":             &getFunc{&inbuildBaseFunc{}},
 	"del":             &delFunc{&inbuildBaseFunc{}},
 	"add":             &addFunc{&inbuildBaseFunc{}},
 	"concat":          &concatFunc{&inbuildBaseFunc{}},
+	"parseNum":        &parseNumFunc{&inbuildBaseFunc{}},
+	"formatNum":       &formatNumFunc{&inbuildBaseFunc{}},
+	"toFixed":         &toFixedFunc{&inbuildBaseFunc{}},
+	"band":            &bitwiseFunc{&inbuildBaseFunc{}, "band", 2},
+	"bor":             &bitwiseFunc{&inbuildBaseFunc{}, "bor", 2},
+	"bxor":            &bitwiseFunc{&inbuildBaseFunc{}, "bxor", 2},
+	"bnot":            &bitwiseFunc{&inbuildBaseFunc{}, "bnot", 1},
+	"shl":             &bitwiseFunc{&inbuildBaseFunc{}, "shl", 2},
+	"shr":             &bitwiseFunc{&inbuildBaseFunc{}, "shr", 2},
+	"bytes":           &bytesFunc{&inbuildBaseFunc{}},
+	"bytesToString":   &bytesToStringFunc{&inbuildBaseFunc{}},
+	"slice":           &sliceFunc{&inbuildBaseFunc{}},
 	"now":             &nowFunc{&inbuildBaseFunc{}},
 	"rand":            &randFunc{&inbuildBaseFunc{}},
 	"timestamp":       &timestampFunc{&inbuildBaseFunc{}},
 	"dumpenv":         &dumpenvFunc{&inbuildBaseFunc{}},
 	"doc":             &docFunc{&inbuildBaseFunc{}},
 	"sleep":           &sleepFunc{&inbuildBaseFunc{}},
+	"timerStart":      &timerStartFunc{&inbuildBaseFunc{}},
+	"timerElapsed":    &timerElapsedFunc{&inbuildBaseFunc{}},
+	"threadId":        &threadIDFunc{&inbuildBaseFunc{}},
 	"raise":           &raise{&inbuildBaseFunc{}},
+	"kind":            &kindFunc{&inbuildBaseFunc{}},
 	"addEvent":        &addevent{&inbuildBaseFunc{}},
 	"addEventAndWait": &addeventandwait{&addevent{&inbuildBaseFunc{}}},
+	"addEventAfter":   &addeventafter{&addevent{&inbuildBaseFunc{}}},
+	"cancelEvent":     &cancelevent{&inbuildBaseFunc{}},
+	"addEvents":       &addevents{&addevent{&inbuildBaseFunc{}}},
+	"getCascade":      &getCascade{&inbuildBaseFunc{}},
 	"setCronTrigger":  &setCronTrigger{&inbuildBaseFunc{}},
 	"setPulseTrigger": &setPulseTrigger{&inbuildBaseFunc{}},
+	"setSinkEnabled":  &setSinkEnabled{&inbuildBaseFunc{}},
+	"setSinkPriority": &setSinkPriority{&inbuildBaseFunc{}},
+	"addSink":         &addSink{&inbuildBaseFunc{}},
+	"removeSink":      &removeSink{&inbuildBaseFunc{}},
+	"listSinks":       &listSinks{&inbuildBaseFunc{}},
+	"whichSinks":      &whichSinks{&inbuildBaseFunc{}},
+	"invokeSink":      &invokeSink{&inbuildBaseFunc{}},
+	"circuitBreaker":  &circuitBreaker{&inbuildBaseFunc{}},
 }
 
 /*
@@ -76,6 +120,34 @@ func (ibf *inbuildBaseFunc) AssertNumParam(index int, val interface{}) (float64,
 	return resNum, err
 }
 
+/*
+AssertDurationParam converts a general interface{} parameter into a duration.
+Numbers are seconds. Strings can have a duration unit (e.g. 1.5s or 200ms).
+*/
+func (ibf *inbuildBaseFunc) AssertDurationParam(index int, val interface{}) (time.Duration, error) {
+	var err error
+
+	secs, ok := val.(float64)
+
+	if !ok {
+		str := fmt.Sprint(val)
+
+		if secs, err = parser.ParseNumber(str); err != nil {
+			var d time.Duration
+
+			// Try compound durations like 1m30s
+
+			if d, err = time.ParseDuration(str); err != nil {
+				err = fmt.Errorf("Parameter %v should be a duration", index)
+			}
+
+			return d, err
+		}
+	}
+
+	return time.Duration(secs * float64(time.Second)), err
+}
+
 /*
 AssertMapParam converts a general interface{} parameter into a map.
 */
@@ -263,7 +335,7 @@ func (rf *newFunc) addSuperClasses(vs parser.Scope, is map[string]interface{},
 		// Save previous init function
 
 		if funcVal, ok := v.(*function); ok {
-			newFunction := &function{funcVal.name, nil, obj, funcVal.declaration, funcVal.declarationVS}
+			newFunction := &function{funcVal.name, nil, obj, funcVal.declaration, funcVal.declarationVS, funcVal.generator}
 			if k == "init" {
 				newFunction.super = initSuperList
 				initFunc = newFunction
@@ -288,7 +360,7 @@ func (rf *newFunc) DocString() (string, error) {
 // =====
 
 /*
-typeFunc returns the underlying types and values of an object.
+typeFunc returns the type name of a value.
 */
 type typeFunc struct {
 	*inbuildBaseFunc
@@ -303,7 +375,7 @@ func (rf *typeFunc) Run(instanceID string, vs parser.Scope, is map[string]interf
 	err := fmt.Errorf("Need a value as first parameter")
 
 	if len(args) > 0 {
-		res = fmt.Sprintf("%#v", args[0])
+		res = typeOf(args[0])
 		err = nil
 	}
 
@@ -314,37 +386,32 @@ func (rf *typeFunc) Run(instanceID string, vs parser.Scope, is map[string]interf
 DocString returns a descriptive string.
 */
 func (rf *typeFunc) DocString() (string, error) {
-	return "Returns the underlying types and values of an object.", nil
+	return "Returns the type name of a value (null, number, string, boolean, list, map or function).", nil
 }
 
-// Len
-// ===
+// Keys
+// ====
 
 /*
-lenFunc returns the size of a list or map.
+keysFunc returns the keys of a map.
 */
-type lenFunc struct {
+type keysFunc struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *lenFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	var res float64
+func (rf *keysFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res []interface{}
 
-	err := fmt.Errorf("Need a list or a map as first parameter")
+	err := fmt.Errorf("Need a map as first parameter")
 
 	if len(args) > 0 {
-		argList, ok1 := args[0].([]interface{})
-		argMap, ok2 := args[0].(map[interface{}]interface{})
+		var argMap map[interface{}]interface{}
 
-		if ok1 {
-			res = float64(len(argList))
-			err = nil
-		} else if ok2 {
-			res = float64(len(argMap))
-			err = nil
+		if argMap, err = rf.AssertMapParam(1, args[0]); err == nil {
+			res = sortedMapKeys(argMap)
 		}
 	}
 
@@ -354,45 +421,38 @@ func (rf *lenFunc) Run(instanceID string, vs parser.Scope, is map[string]interfa
 /*
 DocString returns a descriptive string.
 */
-func (rf *lenFunc) DocString() (string, error) {
-	return "Returns the size of a list or map.", nil
+func (rf *keysFunc) DocString() (string, error) {
+	return "Returns the keys of a map as a sorted list.", nil
 }
 
-// Del
-// ===
+// Values
+// ======
 
 /*
-delFunc removes an element from a list or map.
+valuesFunc returns the values of a map.
 */
-type delFunc struct {
+type valuesFunc struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *delFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	var res interface{}
+func (rf *valuesFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res []interface{}
 
-	err := fmt.Errorf("Need a list or a map as first parameter and an index or key as second parameter")
+	err := fmt.Errorf("Need a map as first parameter")
 
-	if len(args) == 2 {
+	if len(args) > 0 {
+		var argMap map[interface{}]interface{}
 
-		if argList, ok1 := args[0].([]interface{}); ok1 {
-			var index float64
+		if argMap, err = rf.AssertMapParam(1, args[0]); err == nil {
+			res = make([]interface{}, 0, len(argMap))
 
-			index, err = rf.AssertNumParam(2, args[1])
-			if err == nil {
-				res = append(argList[:int(index)], argList[int(index+1):]...)
+			for _, k := range sortedMapKeys(argMap) {
+				res = append(res, argMap[k])
 			}
 		}
-
-		if argMap, ok2 := args[0].(map[interface{}]interface{}); ok2 {
-			key := fmt.Sprint(args[1])
-			delete(argMap, key)
-			res = argMap
-			err = nil
-		}
 	}
 
 	return res, err
@@ -401,44 +461,48 @@ func (rf *delFunc) Run(instanceID string, vs parser.Scope, is map[string]interfa
 /*
 DocString returns a descriptive string.
 */
-func (rf *delFunc) DocString() (string, error) {
-	return "Removes an item from a list or map.", nil
+func (rf *valuesFunc) DocString() (string, error) {
+	return "Returns the values of a map as a list (in the order of the sorted keys).", nil
 }
 
-// Add
-// ===
+/*
+sortedMapKeys returns the keys of a map sorted by their string value.
+*/
+func sortedMapKeys(m map[interface{}]interface{}) []interface{} {
+	keys := make([]interface{}, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sortutil.InterfaceStrings(keys)
+
+	return keys
+}
+
+// HasKey
+// ======
 
 /*
-addFunc adds an element to a list.
+hasKeyFunc checks if a map contains a given key.
 */
-type addFunc struct {
+type hasKeyFunc struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *addFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	var res interface{}
+func (rf *hasKeyFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res bool
 
-	err := fmt.Errorf("Need a list as first parameter and a value as second parameter")
+	err := fmt.Errorf("Need a map and a key as parameters")
 
 	if len(args) > 1 {
-		var argList []interface{}
-
-		if argList, err = rf.AssertListParam(1, args[0]); err == nil {
-			if len(args) == 3 {
-				var index float64
+		var argMap map[interface{}]interface{}
 
-				if index, err = rf.AssertNumParam(3, args[2]); err == nil {
-					argList = append(argList, 0)
-					copy(argList[int(index+1):], argList[int(index):])
-					argList[int(index)] = args[1]
-					res = argList
-				}
-			} else {
-				res = append(argList, args[1])
-			}
+		if argMap, err = rf.AssertMapParam(1, args[0]); err == nil {
+			_, res = argMap[args[1]]
 		}
 	}
 
@@ -448,45 +512,31 @@ func (rf *addFunc) Run(instanceID string, vs parser.Scope, is map[string]interfa
 /*
 DocString returns a descriptive string.
 */
-func (rf *addFunc) DocString() (string, error) {
-	return "Adds an item to a list. The item is added at the optionally given index or at the end if no index is specified.", nil
+func (rf *hasKeyFunc) DocString() (string, error) {
+	return "Checks if a map contains a given key.", nil
 }
 
-// Concat
-// ======
+// Callable
+// ========
 
 /*
-concatFunc joins one or more lists together.
+callableFunc checks if a value can be called as a function.
 */
-type concatFunc struct {
+type callableFunc struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *concatFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	var res interface{}
-
-	err := fmt.Errorf("Need at least two lists as parameters")
+func (rf *callableFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res bool
 
-	if len(args) > 1 {
-		var argList []interface{}
+	err := fmt.Errorf("Need a value as first parameter")
 
-		resList := make([]interface{}, 0)
+	if len(args) > 0 {
+		_, res = args[0].(util.ECALFunction)
 		err = nil
-
-		for _, a := range args {
-			if err == nil {
-				if argList, err = rf.AssertListParam(1, a); err == nil {
-					resList = append(resList, argList...)
-				}
-			}
-		}
-
-		if err == nil {
-			res = resList
-		}
 	}
 
 	return res, err
@@ -495,339 +545,2435 @@ func (rf *concatFunc) Run(instanceID string, vs parser.Scope, is map[string]inte
 /*
 DocString returns a descriptive string.
 */
-func (rf *concatFunc) DocString() (string, error) {
-	return "Joins one or more lists together. The result is a new list.", nil
+func (rf *callableFunc) DocString() (string, error) {
+	return "Checks if a value is a function which can be called.", nil
 }
 
-// dumpenv
+// memoize
 // =======
 
 /*
-dumpenvFunc returns the current variable environment as a string.
+memoizeDefaultSize is the default maximum number of cached results of a
+memoized function.
 */
-type dumpenvFunc struct {
+const memoizeDefaultSize = 1000
+
+/*
+memoizeFunc wraps a function so its results are cached.
+*/
+type memoizeFunc struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *dumpenvFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	return vs.String(), nil
+func (rf *memoizeFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var size, age float64 = memoizeDefaultSize, 0
+
+	err := fmt.Errorf("Need a function as first parameter")
+
+	if len(args) > 0 {
+		funcObj, ok := args[0].(util.ECALFunction)
+
+		if ok {
+			err = nil
+
+			if len(args) > 1 && args[1] != nil {
+				size, err = rf.AssertNumParam(2, args[1])
+			}
+
+			if err == nil && len(args) > 2 {
+				age, err = rf.AssertNumParam(3, args[2])
+			}
+
+			if err == nil && (size < 0 || age < 0) {
+				err = fmt.Errorf("Cache size and maximum age must not be negative")
+			}
+
+			if err == nil {
+				res = &memoizedFunction{funcObj, datautil.NewMapCache(uint64(size), int64(age))}
+			}
+		}
+	}
+
+	return res, err
 }
 
 /*
 DocString returns a descriptive string.
 */
-func (rf *dumpenvFunc) DocString() (string, error) {
-	return "Returns the current variable environment as a string.", nil
+func (rf *memoizeFunc) DocString() (string, error) {
+	return "Returns a function which caches the results of a given function (optional maximum cache size and maximum age in seconds).", nil
 }
 
-// now
-// ===
-
 /*
-nowFunc returns the current time in microseconds from 1st of January 1970 UTC.
+memoizedFunction is a function whose results are cached by its arguments.
 */
-type nowFunc struct {
-	*inbuildBaseFunc
+type memoizedFunction struct {
+	funcObj util.ECALFunction  // Wrapped function
+	cache   *datautil.MapCache // Cache of results
 }
 
 /*
-Run executes this function.
+Run executes this function. Results are only computed if the arguments have
+not been seen before. Errors are not cached.
 */
-func (rf *nowFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	t := time.Now().UnixNano() / int64(time.Microsecond)
-	return float64(t), nil
-}
+func (mf *memoizedFunction) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
 
-/*
-DocString returns a descriptive string.
-*/
-func (rf *nowFunc) DocString() (string, error) {
-	return "Returns the current time in microseconds from 1st of January 1970 UTC.", nil
-}
+	// The key contains the types of all arguments and map keys are sorted
 
-// rand
-// ====
+	key := fmt.Sprintf("%#v", args)
+
+	if res, ok := mf.cache.Get(key); ok {
+		return res, nil
+	}
+
+	res, err := mf.funcObj.Run(instanceID, vs, is, tid, args)
+
+	if err == nil {
+		mf.cache.Put(key, res)
+	}
+
+	return res, err
+}
 
 /*
-randFunc returns a pseudo-random number between 0 and 1 from the default source.
+DocString returns a descriptive string.
 */
-type randFunc struct {
-	*inbuildBaseFunc
+func (mf *memoizedFunction) DocString() (string, error) {
+	return mf.funcObj.DocString()
 }
 
 /*
-Run executes this function.
+String returns a string representation of this function.
 */
-func (rf *randFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	return rand.Float64(), nil
+func (mf *memoizedFunction) String() string {
+	return fmt.Sprintf("memoized %v", mf.funcObj)
 }
 
 /*
-DocString returns a descriptive string.
+MarshalJSON returns a string representation of this function - a function cannot
+be JSON encoded.
 */
-func (rf *randFunc) DocString() (string, error) {
-	return "Returns a pseudo-random number between 0 and 1 from the default source.", nil
+func (mf *memoizedFunction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mf.String())
 }
 
-// timestamp
-// ===
+// parallelMap
+// ===========
 
 /*
-timestampFunc returns a human readable time stamp string from a given number of microseconds since posix epoch time.
+parallelMapFunc calls a function for every item of a list concurrently.
 */
-type timestampFunc struct {
+type parallelMapFunc struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *timestampFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	var ret string
-	var err error
+func (rf *parallelMapFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var list []interface{}
+	var funcObj util.ECALFunction
+	var workers float64
 
-	micros := float64(time.Now().UnixNano() / int64(time.Microsecond))
-	loc := "UTC"
+	if len(args) < 2 {
+		return nil, fmt.Errorf("Need a list and a function as parameters")
+	}
 
-	if len(args) > 0 {
-		micros, err = rf.AssertNumParam(1, args[0])
+	erp := is["erp"].(*ECALRuntimeProvider)
+	node := is["astnode"].(*parser.ASTNode)
 
-		if len(args) > 1 {
-			loc = fmt.Sprint(args[1])
+	list, err := rf.AssertListParam(1, args[0])
+
+	if err == nil {
+		var ok bool
+
+		if funcObj, ok = args[1].(util.ECALFunction); !ok {
+			err = fmt.Errorf("Parameter 2 should be a function")
 		}
 	}
 
 	if err == nil {
-		var l *time.Location
+		workers = float64(erp.Processor.Workers())
 
-		tsTime := time.Unix(0, int64(micros*1000))
+		if len(args) > 2 && args[2] != nil {
+			if workers, err = rf.AssertNumParam(3, args[2]); err == nil && workers < 1 {
+				err = fmt.Errorf("Number of workers must be at least 1")
+			}
+		}
+	}
 
-		if l, err = time.LoadLocation(loc); err == nil {
-			ret = tsTime.In(l).Format("2006-01-02T15:04:05.999999Z07:MST")
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]interface{}, len(list))
+	errs := make([]error, len(list))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, int(workers))
+
+	for i, item := range list {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, item interface{}) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// Every iteration runs in its own thread with its own instance state
+
+			iis := map[string]interface{}{
+				"erp":     erp,
+				"astnode": node,
+			}
+
+			res[i], errs[i] = funcObj.Run(instanceID, vs, iis,
+				erp.Processor.ThreadPool().NewThreadID(), []interface{}{item, float64(i)})
+		}(i, item)
+	}
+
+	wg.Wait()
+
+	// Collect the errors of all failed iterations
+
+	var errList []interface{}
+
+	for i, e := range errs {
+		if e != nil {
+			errorItem := map[interface{}]interface{}{
+				"index": float64(i),
+				"error": e.Error(),
+			}
+
+			if rtError, ok := e.(*util.RuntimeError); ok {
+				errorItem["type"] = rtError.Type.Error()
+				errorItem["detail"] = rtError.Detail
+
+			} else if rtError, ok := e.(*util.RuntimeErrorWithDetail); ok {
+				errorItem["type"] = rtError.Type.Error()
+				errorItem["detail"] = rtError.Detail
+				errorItem["data"] = rtError.Data
+			}
+
+			errList = append(errList, errorItem)
 		}
 	}
 
-	return ret, err
+	if len(errList) > 0 {
+		return nil, &util.RuntimeErrorWithDetail{
+			RuntimeError: erp.NewRuntimeError(util.ErrParallel,
+				fmt.Sprintf("%v of %v iterations failed", len(errList), len(list)), node).(*util.RuntimeError),
+			Environment: vs,
+			Data:        errList,
+		}
+	}
+
+	return res, nil
 }
 
 /*
 DocString returns a descriptive string.
 */
-func (rf *timestampFunc) DocString() (string, error) {
-	return "Returns a human readable time stamp string from a given number of microseconds since posix epoch time.", nil
+func (rf *parallelMapFunc) DocString() (string, error) {
+	return "Calls a function for every item of a list concurrently and returns the list of results.", nil
 }
 
-// doc
-// ===
+// atomicAdd / cas
+// ===============
 
 /*
-docFunc returns the docstring of a function.
+globalScope returns the global scope of a given scope.
 */
-type docFunc struct {
+func globalScope(vs parser.Scope) parser.Scope {
+	for vs.Parent() != nil {
+		vs = vs.Parent()
+	}
+	return vs
+}
+
+/*
+atomicAddFunc adds a number to a global variable under an internal lock.
+*/
+type atomicAddFunc struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *docFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+func (rf *atomicAddFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
 	var res interface{}
-	err := fmt.Errorf("Need a function as parameter")
 
-	if len(args) > 0 {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("Need a variable name and a number as parameters")
+	}
 
-		funcObj, ok := args[0].(util.ECALFunction)
+	erp := is["erp"].(*ECALRuntimeProvider)
+	name := fmt.Sprint(args[0])
 
-		if args[0] == nil {
+	delta, err := rf.AssertNumParam(2, args[1])
 
-			// Try to lookup by the given identifier
+	if err == nil && erp.isConstant(name) {
+		err = fmt.Errorf("Cannot assign to constant %v", name)
+	}
 
-			c := is["astnode"].(*parser.ASTNode).Children[0].Children[0]
-			astring := c.Token.Val
+	if err == nil {
+		var val interface{}
 
-			if len(c.Children) > 0 {
-				astring = fmt.Sprintf("%v.%v", astring, c.Children[0].Token.Val)
+		gs := globalScope(vs)
+
+		erp.atomicLock.Lock()
+		defer erp.atomicLock.Unlock()
+
+		// Variables which are not defined yet start at 0
+
+		if val, _, err = gs.GetValue(name); err == nil {
+			if val == nil {
+				val = float64(0)
 			}
 
-			// Check for stdlib function
+			if num, ok := val.(float64); ok {
+				res = num + delta
+				err = gs.SetValue(name, res)
+			} else {
+				err = fmt.Errorf("Variable %v should be a number", name)
+			}
+		}
+	}
 
-			if funcObj, ok = stdlib.GetStdlibFunc(astring); !ok {
+	return res, err
+}
 
-				// Check for inbuild function
+/*
+DocString returns a descriptive string.
+*/
+func (rf *atomicAddFunc) DocString() (string, error) {
+	return "Adds a number to a global variable in an atomic operation and returns the new value.", nil
+}
 
-				funcObj, ok = InbuildFuncMap[astring]
+/*
+casFunc sets a global variable to a new value if it has an expected value.
+*/
+type casFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *casFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res bool
+	var err error
+
+	if len(args) < 3 {
+		return nil, fmt.Errorf("Need a variable name, an expected value and a new value as parameters")
+	}
+
+	erp := is["erp"].(*ECALRuntimeProvider)
+	name := fmt.Sprint(args[0])
+
+	switch args[1].(type) {
+	case nil, float64, string, bool, []byte:
+	default:
+		return nil, fmt.Errorf("Parameter 2 should be null, a number, a string, a boolean or bytes")
+	}
+
+	if erp.isConstant(name) {
+		return nil, fmt.Errorf("Cannot assign to constant %v", name)
+	}
+
+	gs := globalScope(vs)
+
+	erp.atomicLock.Lock()
+	defer erp.atomicLock.Unlock()
+
+	val, _, err := gs.GetValue(name)
+
+	if err == nil && valuesEqual(val, args[1]) {
+		if err = gs.SetValue(name, args[2]); err == nil {
+			res = true
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *casFunc) DocString() (string, error) {
+	return "Sets a global variable to a new value if it has an expected value (compare-and-swap). Returns if the value was set.", nil
+}
+
+// Len
+// ===
+
+/*
+lenFunc returns the size of a list or map.
+*/
+type lenFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *lenFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res float64
+
+	err := fmt.Errorf("Need a list, a map or bytes as first parameter")
+
+	if len(args) > 0 {
+		argList, ok1 := args[0].([]interface{})
+		argMap, ok2 := args[0].(map[interface{}]interface{})
+		argBytes, ok3 := args[0].([]byte)
+
+		if ok1 {
+			res = float64(len(argList))
+			err = nil
+		} else if ok2 {
+			res = float64(len(argMap))
+			err = nil
+		} else if ok3 {
+			res = float64(len(argBytes))
+			err = nil
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *lenFunc) DocString() (string, error) {
+	return "Returns the size of a list, map or bytes.", nil
+}
+
+// Get
+// ===
+
+/*
+getFunc safely retrieves a value from nested lists and maps.
+*/
+type getFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *getFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res, def interface{}
+	var path []interface{}
+
+	if len(args) < 2 {
+		return nil, fmt.Errorf("Need a list or map and a path as parameters")
+	}
+
+	if len(args) > 2 {
+		def = args[2]
+	}
+
+	if pathList, ok := args[1].([]interface{}); ok {
+		path = pathList
+	} else {
+		for _, key := range strings.Split(fmt.Sprint(args[1]), ".") {
+			path = append(path, key)
+		}
+	}
+
+	res = args[0]
+
+	for _, key := range path {
+		var ok bool
+
+		if res, ok = rf.getField(res, key); !ok {
+			return def, nil
+		}
+	}
+
+	if res == nil {
+		res = def
+	}
+
+	return res, nil
+}
+
+/*
+getField retrieves a single field of a list or a map. Returns false if the
+field does not exist.
+*/
+func (rf *getFunc) getField(container interface{}, key interface{}) (interface{}, bool) {
+
+	if containerMap, ok := container.(map[interface{}]interface{}); ok {
+		val, ok := containerMap[key]
+
+		if !ok {
+
+			// Keys given as strings might refer to number or string keys
+
+			if num, err := strconv.ParseFloat(fmt.Sprint(key), 64); err == nil {
+				val, ok = containerMap[num]
+			}
+
+			if !ok {
+				val, ok = containerMap[fmt.Sprint(key)]
+			}
+		}
+
+		return val, ok
+
+	} else if containerList, ok := container.([]interface{}); ok {
+
+		index, err := strconv.Atoi(fmt.Sprint(key))
+
+		if err == nil && index < 0 {
+
+			// Handle negative numbers
+
+			index = len(containerList) + index
+		}
+
+		if err == nil && index >= 0 && index < len(containerList) {
+			return containerList[index], true
+		}
+	}
+
+	return nil, false
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *getFunc) DocString() (string, error) {
+	return "Returns a value from nested lists and maps or a default value if the value does not exist.", nil
+}
+
+// Del
+// ===
+
+/*
+delFunc removes an element from a list or map.
+*/
+type delFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *delFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := fmt.Errorf("Need a list or a map as first parameter and an index or key as second parameter")
+
+	if len(args) == 2 {
+
+		if argList, ok1 := args[0].([]interface{}); ok1 {
+			var index float64
+
+			index, err = rf.AssertNumParam(2, args[1])
+			if err == nil {
+				res = append(argList[:int(index)], argList[int(index+1):]...)
+			}
+		}
+
+		if argMap, ok2 := args[0].(map[interface{}]interface{}); ok2 {
+			key := fmt.Sprint(args[1])
+			delete(argMap, key)
+			res = argMap
+			err = nil
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *delFunc) DocString() (string, error) {
+	return "Removes an item from a list or map.", nil
+}
+
+// Add
+// ===
+
+/*
+addFunc adds an element to a list.
+*/
+type addFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *addFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := fmt.Errorf("Need a list as first parameter and a value as second parameter")
+
+	if len(args) > 1 {
+		var argList []interface{}
+
+		if argList, err = rf.AssertListParam(1, args[0]); err == nil {
+			if len(args) == 3 {
+				var index float64
+
+				if index, err = rf.AssertNumParam(3, args[2]); err == nil {
+					argList = append(argList, 0)
+					copy(argList[int(index+1):], argList[int(index):])
+					argList[int(index)] = args[1]
+					res = argList
+				}
+			} else {
+				res = append(argList, args[1])
 			}
 		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *addFunc) DocString() (string, error) {
+	return "Adds an item to a list. The item is added at the optionally given index or at the end if no index is specified.", nil
+}
+
+// Concat
+// ======
+
+/*
+concatFunc joins one or more lists together.
+*/
+type concatFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *concatFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := fmt.Errorf("Need at least two lists as parameters")
+
+	if len(args) > 1 {
+		err = nil
+
+		if _, ok := args[0].([]byte); ok {
+			resBytes := make([]byte, 0)
+
+			for i, a := range args {
+				b, ok := a.([]byte)
+
+				if !ok {
+					return nil, fmt.Errorf("Parameter %v should be bytes", i+1)
+				}
+
+				resBytes = append(resBytes, b...)
+			}
+
+			res = resBytes
+
+		} else {
+			var argList []interface{}
+
+			resList := make([]interface{}, 0)
+
+			for _, a := range args {
+				if err == nil {
+					if argList, err = rf.AssertListParam(1, a); err == nil {
+						resList = append(resList, argList...)
+					}
+				}
+			}
+
+			if err == nil {
+				res = resList
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *concatFunc) DocString() (string, error) {
+	return "Joins one or more lists or bytes together. The result is a new list or new bytes.", nil
+}
+
+// parseNum
+// ========
+
+/*
+parseNumFunc parses a number from a string.
+*/
+type parseNumFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *parseNumFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := fmt.Errorf("Need a string as first parameter")
+
+	if len(args) > 0 {
+		if num, ok := args[0].(float64); ok {
+			return num, nil
+		}
+
+		str := strings.TrimSpace(fmt.Sprint(args[0]))
+
+		if res, err = strconv.ParseFloat(str, 64); err != nil {
+			if len(args) > 1 {
+				res, err = args[1], nil
+			} else {
+				res, err = nil, fmt.Errorf("Cannot parse number: %v", str)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *parseNumFunc) DocString() (string, error) {
+	return "Parses a number from a string. Returns an optional default value if the string is not a number.", nil
+}
+
+// formatNum
+// =========
+
+/*
+formatNumFunc formats a number with a given precision and separators.
+*/
+type formatNumFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *formatNumFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res string
+	var num float64
+
+	decimals := -1.
+	thousandsSep := ","
+	decimalSep := "."
+
+	err := fmt.Errorf("Need a number as first parameter")
+
+	if len(args) > 0 {
+		num, err = rf.AssertNumParam(1, args[0])
+
+		if err == nil && len(args) > 1 && args[1] != nil {
+			decimals, err = rf.AssertNumParam(2, args[1])
+		}
+
+		if len(args) > 2 {
+			thousandsSep = fmt.Sprint(args[2])
+		}
+
+		if len(args) > 3 {
+			decimalSep = fmt.Sprint(args[3])
+		}
+	}
+
+	if err == nil {
+		res = formatNumber(num, int(decimals), thousandsSep, decimalSep)
+	}
+
+	return res, err
+}
+
+/*
+formatNumber formats a number with a given number of decimals (-1 for the
+smallest number necessary) and a thousands and decimal separator.
+*/
+func formatNumber(num float64, decimals int, thousandsSep string, decimalSep string) string {
+	var buf strings.Builder
+
+	str := strconv.FormatFloat(num, 'f', decimals, 64)
+
+	if strings.HasPrefix(str, "-") {
+		buf.WriteString("-")
+		str = str[1:]
+	}
+
+	intPart := str
+	fracPart := ""
+
+	if i := strings.Index(str, "."); i != -1 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			buf.WriteString(thousandsSep)
+		}
+		buf.WriteRune(c)
+	}
+
+	if fracPart != "" {
+		buf.WriteString(decimalSep)
+		buf.WriteString(fracPart)
+	}
+
+	return buf.String()
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *formatNumFunc) DocString() (string, error) {
+	return "Formats a number with a given precision and thousands / decimal separators.", nil
+}
+
+// toFixed
+// =======
+
+/*
+toFixedFunc formats a number with a fixed number of decimals.
+*/
+type toFixedFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *toFixedFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res string
+	var num, decimals float64
+
+	err := fmt.Errorf("Need a number and the number of decimals as parameters")
+
+	if len(args) > 1 {
+		if num, err = rf.AssertNumParam(1, args[0]); err == nil {
+			if decimals, err = rf.AssertNumParam(2, args[1]); err == nil {
+				if decimals < 0 {
+					err = fmt.Errorf("Number of decimals must not be negative")
+				} else {
+					res = strconv.FormatFloat(num, 'f', int(decimals), 64)
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *toFixedFunc) DocString() (string, error) {
+	return "Formats a number with a fixed number of decimals.", nil
+}
+
+// Bitwise operations
+// ==================
+
+/*
+bitwiseFunc performs a bitwise operation on integer numbers.
+*/
+type bitwiseFunc struct {
+	*inbuildBaseFunc
+	op      string // Bitwise operation
+	numArgs int    // Number of required arguments
+}
+
+/*
+Run executes this function.
+*/
+func (rf *bitwiseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var err error
+
+	if len(args) < rf.numArgs {
+		return nil, fmt.Errorf("Need %v integer numbers as parameters", rf.numArgs)
+	}
+
+	ops := make([]int64, rf.numArgs)
+
+	for i := 0; i < rf.numArgs && err == nil; i++ {
+		ops[i], err = rf.assertIntParam(i+1, args[i])
+	}
+
+	if err == nil {
+		switch rf.op {
+		case "band":
+			res = float64(ops[0] & ops[1])
+		case "bor":
+			res = float64(ops[0] | ops[1])
+		case "bxor":
+			res = float64(ops[0] ^ ops[1])
+		case "bnot":
+			res = float64(^ops[0])
+		case "shl", "shr":
+			if ops[1] < 0 {
+				err = fmt.Errorf("Shift count must not be negative")
+			} else if rf.op == "shl" {
+				res = float64(ops[0] << uint64(ops[1]))
+			} else {
+				res = float64(ops[0] >> uint64(ops[1]))
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+assertIntParam converts a general interface{} parameter into an integer number.
+*/
+func (rf *bitwiseFunc) assertIntParam(index int, val interface{}) (int64, error) {
+	num, err := rf.AssertNumParam(index, val)
+
+	if err == nil && num != math.Trunc(num) {
+		err = fmt.Errorf("Parameter %v should be an integer number", index)
+	}
+
+	return int64(num), err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *bitwiseFunc) DocString() (string, error) {
+	switch rf.op {
+	case "band":
+		return "Returns the bitwise and of two integer numbers.", nil
+	case "bor":
+		return "Returns the bitwise or of two integer numbers.", nil
+	case "bxor":
+		return "Returns the bitwise exclusive or of two integer numbers.", nil
+	case "bnot":
+		return "Returns the bitwise complement of an integer number.", nil
+	case "shl":
+		return "Shifts the bits of an integer number to the left.", nil
+	}
+	return "Shifts the bits of an integer number to the right (the sign is preserved).", nil
+}
+
+/*
+bytesEncoding returns the encoding which is given as an optional parameter.
+*/
+func bytesEncoding(args []interface{}, index int) (string, error) {
+	encoding := "utf8"
+
+	if len(args) > index {
+		encoding = fmt.Sprint(args[index])
+	}
+
+	if encoding != "utf8" && encoding != "hex" && encoding != "base64" {
+		return "", fmt.Errorf("Unknown encoding: %v (supported are utf8, hex and base64)", encoding)
+	}
+
+	return encoding, nil
+}
+
+// bytes
+// =====
+
+/*
+bytesFunc creates bytes from a string or a list of byte values.
+*/
+type bytesFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *bytesFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res []byte
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Need a string or a list of byte values as first parameter")
+	}
+
+	encoding, err := bytesEncoding(args, 1)
+
+	if err == nil {
+		switch val := args[0].(type) {
+
+		case []byte:
+			res = append([]byte{}, val...)
+
+		case []interface{}:
+			res = make([]byte, len(val))
+
+			for i, v := range val {
+				if b, ok := v.(float64); ok && b >= 0 && b <= 255 && b == math.Trunc(b) {
+					res[i] = byte(b)
+				} else {
+					return nil, fmt.Errorf("Byte value must be an integer between 0 and 255: %v", v)
+				}
+			}
+
+		default:
+			str := fmt.Sprint(val)
+
+			switch encoding {
+			case "hex":
+				res, err = hex.DecodeString(str)
+			case "base64":
+				res, err = base64.StdEncoding.DecodeString(str)
+			default:
+				res = []byte(str)
+			}
+
+			if err != nil {
+				err = fmt.Errorf("Cannot decode %v string: %v", encoding, err)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *bytesFunc) DocString() (string, error) {
+	return "Creates bytes from a string with an optional encoding (utf8, hex or base64) or from a list of byte values.", nil
+}
+
+// bytesToString
+// =============
+
+/*
+bytesToStringFunc converts bytes into a string.
+*/
+type bytesToStringFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *bytesToStringFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Need bytes as first parameter")
+	}
+
+	b, ok := args[0].([]byte)
+
+	if !ok {
+		return nil, fmt.Errorf("Parameter 1 should be bytes")
+	}
+
+	encoding, err := bytesEncoding(args, 1)
+
+	if err == nil {
+		switch encoding {
+		case "hex":
+			res = hex.EncodeToString(b)
+		case "base64":
+			res = base64.StdEncoding.EncodeToString(b)
+		default:
+			res = string(b)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *bytesToStringFunc) DocString() (string, error) {
+	return "Converts bytes into a string with an optional encoding (utf8, hex or base64).", nil
+}
+
+// slice
+// =====
+
+/*
+sliceFunc returns a part of a list, bytes or a string.
+*/
+type sliceFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *sliceFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var size, start, end int
+
+	if len(args) < 2 {
+		return nil, fmt.Errorf("Need a list, bytes or a string and a start index as parameters")
+	}
+
+	switch val := args[0].(type) {
+	case []interface{}:
+		size = len(val)
+	case []byte:
+		size = len(val)
+	case string:
+		size = len([]rune(val))
+	default:
+		return nil, fmt.Errorf("Parameter 1 should be a list, bytes or a string")
+	}
+
+	// Indices are clamped to the size of the value - negative indices
+	// count from the end
+
+	index := func(i int, v interface{}, def int) (int, error) {
+		if v == nil {
+			return def, nil
+		}
+
+		n, err := rf.AssertNumParam(i, v)
+
+		if err == nil {
+			if n < 0 {
+				n += float64(size)
+			}
+			n = math.Max(0, math.Min(float64(size), n))
+		}
+
+		return int(n), err
+	}
+
+	start, err := index(2, args[1], 0)
+
+	if err == nil {
+		var endArg interface{}
+
+		if len(args) > 2 {
+			endArg = args[2]
+		}
+
+		if end, err = index(3, endArg, size); err == nil && end < start {
+			end = start
+		}
+	}
+
+	if err == nil {
+		switch val := args[0].(type) {
+		case []interface{}:
+			res = append([]interface{}{}, val[start:end]...)
+		case []byte:
+			res = append([]byte{}, val[start:end]...)
+		case string:
+			res = string([]rune(val)[start:end])
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *sliceFunc) DocString() (string, error) {
+	return "Returns a part of a list, bytes or a string from a start index up to (excluding) an optional end index.", nil
+}
+
+// dumpenv
+// =======
+
+/*
+dumpenvFunc returns the current variable environment as a string.
+*/
+type dumpenvFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *dumpenvFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	return vs.String(), nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *dumpenvFunc) DocString() (string, error) {
+	return "Returns the current variable environment as a string.", nil
+}
+
+// now
+// ===
+
+/*
+nowFunc returns the current time in microseconds from 1st of January 1970 UTC.
+*/
+type nowFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *nowFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	t := time.Now().UnixNano() / int64(time.Microsecond)
+	return float64(t), nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *nowFunc) DocString() (string, error) {
+	return "Returns the current time in microseconds from 1st of January 1970 UTC.", nil
+}
+
+// rand
+// ====
+
+/*
+randFunc returns a pseudo-random number between 0 and 1 from the default source.
+*/
+type randFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *randFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	return rand.Float64(), nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *randFunc) DocString() (string, error) {
+	return "Returns a pseudo-random number between 0 and 1 from the default source.", nil
+}
+
+// timestamp
+// ===
+
+/*
+timestampFunc returns a human readable time stamp string from a given number of microseconds since posix epoch time.
+*/
+type timestampFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *timestampFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var ret string
+	var err error
+
+	micros := float64(time.Now().UnixNano() / int64(time.Microsecond))
+	loc := "UTC"
+
+	if len(args) > 0 {
+		micros, err = rf.AssertNumParam(1, args[0])
+
+		if len(args) > 1 {
+			loc = fmt.Sprint(args[1])
+		}
+	}
+
+	if err == nil {
+		var l *time.Location
+
+		tsTime := time.Unix(0, int64(micros*1000))
+
+		if l, err = time.LoadLocation(loc); err == nil {
+			ret = tsTime.In(l).Format("2006-01-02T15:04:05.999999Z07:MST")
+		}
+	}
+
+	return ret, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *timestampFunc) DocString() (string, error) {
+	return "Returns a human readable time stamp string from a given number of microseconds since posix epoch time.", nil
+}
+
+// doc
+// ===
+
+/*
+docFunc returns the docstring of a function.
+*/
+type docFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *docFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	err := fmt.Errorf("Need a function as parameter")
+
+	if len(args) > 0 {
+
+		funcObj, ok := args[0].(util.ECALFunction)
+
+		if args[0] == nil {
+
+			// Try to lookup by the given identifier
+
+			c := is["astnode"].(*parser.ASTNode).Children[0].Children[0]
+			astring := c.Token.Val
+
+			if len(c.Children) > 0 {
+				astring = fmt.Sprintf("%v.%v", astring, c.Children[0].Token.Val)
+			}
+
+			// Check for stdlib function
+
+			if funcObj, ok = stdlib.GetStdlibFunc(astring); !ok {
+
+				// Check for inbuild function
+
+				funcObj, ok = InbuildFuncMap[astring]
+			}
+		}
+
+		if ok {
+			res, err = funcObj.DocString()
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *docFunc) DocString() (string, error) {
+	return "Returns the docstring of a function.", nil
+}
+
+// sleep
+// =====
+
+/*
+sleepFunc pauses the current thread for a duration.
+*/
+type sleepFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *sleepFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	err := fmt.Errorf("Need a duration as parameter")
+
+	if len(args) > 0 {
+		var d time.Duration
+
+		d, err = rf.AssertDurationParam(1, args[0])
+
+		if err == nil {
+
+			// A sink with a timeout should not sleep past its deadline
+
+			if dl := is["erp"].(*ECALRuntimeProvider).deadline(tid); !dl.IsZero() && time.Until(dl) < d {
+				d = time.Until(dl)
+			}
+
+			time.Sleep(d)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *sleepFunc) DocString() (string, error) {
+	return "Pauses the current thread for a duration in seconds or a duration string (e.g. 1.5s).", nil
+}
+
+// timerStart
+// ==========
+
+/*
+timerEpoch is the point in time from which timer handles are measured. Timer
+handles are based on the monotonic clock and are not affected by changes of
+the wall clock.
+*/
+var timerEpoch = time.Now()
+
+/*
+timerStartFunc starts a timer.
+*/
+type timerStartFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *timerStartFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	return time.Since(timerEpoch).Seconds(), nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *timerStartFunc) DocString() (string, error) {
+	return "Starts a timer and returns a handle for timerElapsed.", nil
+}
+
+// timerElapsed
+// ============
+
+/*
+timerElapsedFunc returns the time which has passed since a timer was started.
+*/
+type timerElapsedFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *timerElapsedFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	err := fmt.Errorf("Need a timer handle as parameter")
+
+	if len(args) > 0 {
+		var start float64
+
+		if start, err = rf.AssertNumParam(1, args[0]); err == nil {
+			res = time.Since(timerEpoch).Seconds() - start
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *timerElapsedFunc) DocString() (string, error) {
+	return "Returns the seconds which have passed since a timer was started.", nil
+}
+
+// threadId
+// ========
+
+/*
+threadIDFunc returns the ID of the current thread.
+*/
+type threadIDFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *threadIDFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	return float64(tid), nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *threadIDFunc) DocString() (string, error) {
+	return "Returns the ID of the current thread.", nil
+}
+
+// raise
+// =====
+
+/*
+raise returns an error. Outside of sinks this will stop the code execution
+if the error is not handled by try / except. Inside a sink only the specific sink
+will fail. This error can be used to break trigger sequences of sinks if
+FailOnFirstErrorInTriggerSequence is set.
+*/
+type raise struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *raise) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var err error
+	var detailMsg string
+	var detail interface{}
+
+	var errMap map[interface{}]interface{}
+
+	if len(args) > 0 {
+		errMap, _ = args[0].(map[interface{}]interface{})
+	}
+
+	if errMap != nil {
+
+		// Structured errors are given as a map
+
+		errType, ok := errMap["type"]
+		if !ok {
+			return nil, fmt.Errorf("Error map should have a type")
+		}
+
+		err = fmt.Errorf("%v", errType)
+
+		if errDetail, ok := errMap["detail"]; ok && errDetail != nil {
+			detailMsg = fmt.Sprint(errDetail)
+		}
+
+		detail = errMap["data"]
+
+	} else if len(args) > 0 {
+		err = fmt.Errorf("%v", args[0])
+		if len(args) > 1 {
+			if args[1] != nil {
+				detailMsg = fmt.Sprint(args[1])
+			}
+			if len(args) > 2 {
+				detail = args[2]
+			}
+		}
+	}
+
+	erp := is["erp"].(*ECALRuntimeProvider)
+	node := is["astnode"].(*parser.ASTNode)
+
+	return nil, &util.RuntimeErrorWithDetail{
+		RuntimeError: erp.NewRuntimeError(err, detailMsg, node).(*util.RuntimeError),
+		Environment:  vs,
+		Data:         detail,
+	}
+
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *raise) DocString() (string, error) {
+	return "Raise an error which stops the execution unless it is handled by a try/except block.", nil
+}
+
+// kind
+// ====
+
+/*
+kindFunc joins the given parts into an event kind.
+*/
+type kindFunc struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *kindFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	return joinKind(args)
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *kindFunc) DocString() (string, error) {
+	return "Joins the given parts into an event kind in dot notation.", nil
+}
+
+// addEvent
+// ========
+
+/*
+addevent adds an event to trigger sinks. This function will return immediately
+and not wait for the event cascade to finish. Use this function for event cascades.
+*/
+type addevent struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *addevent) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	return rf.addEvent(func(proc engine.Processor, event *engine.Event, scope *engine.RuleScope) (interface{}, error) {
+		var monitor engine.Monitor
+
+		parentMonitor, ok := is["monitor"]
+
+		if scope != nil || !ok {
+			monitor = proc.NewRootMonitor(nil, scope)
+		} else {
+			monitor = parentMonitor.(engine.Monitor).NewChildMonitor(0)
+		}
+
+		_, err := proc.AddEvent(event, monitor)
+		return nil, err
+	}, is, args, 0)
+}
+
+/*
+addEvent parses the event parameters (name, kind, state and an optional scope)
+and calls a given function to add the event. The offset is the number of
+parameters which precede the event parameters.
+*/
+func (rf *addevent) addEvent(addFunc func(engine.Processor, *engine.Event, *engine.RuleScope) (interface{}, error),
+	is map[string]interface{}, args []interface{}, offset int) (interface{}, error) {
+
+	var res interface{}
+	var stateMap map[interface{}]interface{}
+
+	erp := is["erp"].(*ECALRuntimeProvider)
+	proc := erp.Processor
+
+	if proc.Stopped() {
+		proc.Start()
+	}
+
+	err := fmt.Errorf("Need at least three parameters: name, kind and state")
+
+	if len(args) > 2 {
+
+		if stateMap, err = rf.AssertMapParam(offset+3, args[2]); err == nil {
+			var scope *engine.RuleScope
+
+			event := engine.NewEvent(
+				fmt.Sprint(args[0]),
+				strings.Split(fmt.Sprint(args[1]), "."),
+				stateMap,
+			)
+
+			if len(args) > 3 {
+
+				// Add optional scope - if not specified it is { "": true }
+
+				scope, err = rf.ruleScope(offset+4, args[3])
+			}
+
+			if err == nil {
+				res, err = addFunc(proc, event, scope)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+ruleScope converts a given scope parameter into a rule scope.
+*/
+func (rf *addevent) ruleScope(index int, arg interface{}) (*engine.RuleScope, error) {
+	var scope *engine.RuleScope
+
+	scopeMap, err := rf.AssertMapParam(index, arg)
+
+	if err == nil {
+		var scopeData = map[string]bool{}
+
+		for k, v := range scopeMap {
+			b, _ := strconv.ParseBool(fmt.Sprint(v))
+			scopeData[fmt.Sprint(k)] = b
+		}
+
+		scope = engine.NewRuleScope(scopeData)
+	}
+
+	return scope, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *addevent) DocString() (string, error) {
+	return "Adds an event to trigger sinks. This function will return " +
+		"immediately and not wait for the event cascade to finish.", nil
+}
+
+// addEventAndWait
+// ===============
+
+/*
+addeventandwait adds an event to trigger sinks. This function will return once
+the event cascade has finished and return all errors and results.
+*/
+type addeventandwait struct {
+	*addevent
+}
+
+/*
+Run executes this function.
+*/
+func (rf *addeventandwait) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	return rf.addEvent(func(proc engine.Processor, event *engine.Event, scope *engine.RuleScope) (interface{}, error) {
+		var res []interface{}
+		rm := proc.NewRootMonitor(nil, scope)
+		m, err := proc.AddEventAndWait(event, rm)
+
+		if m != nil {
+			var ids []uint64
+
+			items := make(map[uint64]map[interface{}]interface{})
+
+			// Errors and results of the same event are returned in one item
+
+			item := func(e *engine.Event, mon engine.Monitor) map[interface{}]interface{} {
+				i, ok := items[mon.ID()]
+
+				if !ok {
+					i = map[interface{}]interface{}{
+						"event":   eventObject(e),
+						"errors":  map[interface{}]interface{}{},
+						"results": map[interface{}]interface{}{},
+					}
+					items[mon.ID()] = i
+					ids = append(ids, mon.ID())
+				}
+
+				return i
+			}
+
+			for _, e := range m.(*engine.RootMonitor).AllErrors() {
+				item(e.Event, e.Monitor)["errors"] = errorObjects(e.ErrorMap)
+			}
+
+			for _, r := range m.(*engine.RootMonitor).AllResults() {
+				results := item(r.Event, r.Monitor)["results"].(map[interface{}]interface{})
+
+				for k, v := range r.ResultMap {
+					results[k] = v
+				}
+			}
+
+			// Sort by monitor id - this should give the correct order timewise
+
+			sortutil.UInt64s(ids)
+
+			for _, id := range ids {
+				res = append(res, items[id])
+			}
+		}
+
+		return res, err
+	}, is, args, 0)
+}
+
+/*
+eventObject converts an event into an ECAL object.
+*/
+func eventObject(e *engine.Event) map[interface{}]interface{} {
+	return map[interface{}]interface{}{
+		"name":  e.Name(),
+		"kind":  strings.Join(e.Kind(), "."),
+		"state": e.State(),
+	}
+}
+
+/*
+errorObjects converts a map of rule errors into an ECAL object.
+*/
+func errorObjects(errorMap map[string]error) map[interface{}]interface{} {
+	errors := map[interface{}]interface{}{}
+
+	for k, v := range errorMap {
+
+		// Note: The variable scope of the sink (se.environment)
+		// was also captured - for now it is not exposed to the
+		// language environment
+
+		errorItem := map[interface{}]interface{}{
+			"error": v.Error(),
+		}
+
+		if se, ok := v.(*util.RuntimeErrorWithDetail); ok {
+			errorItem["type"] = se.Type.Error()
+			errorItem["detail"] = se.Detail
+			errorItem["data"] = se.Data
+		}
+
+		errors[k] = errorItem
+	}
+
+	return errors
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *addeventandwait) DocString() (string, error) {
+	return "Adds an event to trigger sinks. This function will return once " +
+		"the event cascade has finished with all errors and results of the sinks.", nil
+}
+
+// addEventAfter
+// =============
+
+/*
+addeventafter adds an event to trigger sinks once a given delay has passed.
+This function returns immediately with a handle which can be used to cancel
+the event.
+*/
+type addeventafter struct {
+	*addevent
+}
+
+/*
+Run executes this function.
+*/
+func (rf *addeventafter) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := fmt.Errorf("Need at least four parameters: delay, name, kind and state")
+
+	if len(args) > 3 {
+		var delay float64
+
+		if delay, err = rf.AssertNumParam(1, args[0]); err == nil {
+			res, err = rf.addEvent(func(proc engine.Processor, event *engine.Event, scope *engine.RuleScope) (interface{}, error) {
+				id := proc.AddEventAfter(time.Duration(delay*float64(time.Second)), event, scope)
+				return float64(id), nil
+			}, is, args[1:], 1)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *addeventafter) DocString() (string, error) {
+	return "Adds an event to trigger sinks after a given number of seconds. This function " +
+		"returns immediately with a handle which can be used to cancel the event.", nil
+}
+
+// cancelEvent
+// ===========
+
+/*
+cancelevent cancels an event which was added with addEventAfter.
+*/
+type cancelevent struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *cancelevent) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := fmt.Errorf("Need an event handle as parameter")
+
+	if len(args) > 0 {
+		var handle float64
+
+		if handle, err = rf.AssertNumParam(1, args[0]); err == nil {
+			erp := is["erp"].(*ECALRuntimeProvider)
+			res = erp.Processor.CancelEvent(uint64(handle))
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *cancelevent) DocString() (string, error) {
+	return "Cancels an event which was added with addEventAfter. Returns false if the " +
+		"event was not pending anymore.", nil
+}
+
+// addEvents
+// =========
+
+/*
+addevents adds a list of events to trigger sinks. All events are queued at
+once. This function will return immediately and not wait for the event
+cascades to finish. Use this function if a sink fans out many events.
+*/
+type addevents struct {
+	*addevent
+}
+
+/*
+Run executes this function.
+*/
+func (rf *addevents) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var events []*engine.Event
+	var scope *engine.RuleScope
+	var list []interface{}
+
+	err := fmt.Errorf("Need a list of events as parameter")
+
+	if len(args) == 0 {
+		return nil, err
+	}
+
+	if list, err = rf.AssertListParam(1, args[0]); err != nil {
+		return nil, err
+	}
+
+	// Convert all event objects - each object has a name, kind and state
+
+	for i, item := range list {
+		var eventMap, stateMap map[interface{}]interface{}
+
+		if eventMap, err = rf.AssertMapParam(1, item); err == nil {
+			stateMap = map[interface{}]interface{}{}
+
+			if state, ok := eventMap["state"]; ok && state != nil {
+				if stateMap, ok = state.(map[interface{}]interface{}); !ok {
+					err = fmt.Errorf("State of event %v should be a map", i+1)
+				}
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, engine.NewEvent(
+			fmt.Sprint(eventMap["name"]),
+			strings.Split(fmt.Sprint(eventMap["kind"]), "."),
+			stateMap,
+		))
+	}
+
+	if len(args) > 1 {
+
+		// Add optional scope - if not specified it is { "": true }
+
+		scope, err = rf.ruleScope(2, args[1])
+	}
+
+	if err == nil {
+		proc := is["erp"].(*ECALRuntimeProvider).Processor
+
+		if proc.Stopped() {
+			proc.Start()
+		}
+
+		parentMonitor, ok := is["monitor"]
+
+		if scope != nil || !ok {
+
+			// Events outside of a sink or with an explicit scope start new cascades
+
+			for _, event := range events {
+				if _, err = proc.AddEvent(event, proc.NewRootMonitor(nil, scope)); err != nil {
+					break
+				}
+			}
+
+		} else {
+			_, err = proc.AddEvents(events, parentMonitor.(engine.Monitor))
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *addevents) DocString() (string, error) {
+	return "Adds a list of events (objects with name, kind and state) to trigger sinks. All " +
+		"events are queued at once. This function will return immediately.", nil
+}
+
+// getCascade
+// ==========
+
+/*
+getCascade returns the event cascade of the current sink.
+*/
+type getCascade struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (rf *getCascade) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	if m, ok := is["monitor"]; ok {
+		res = cascadeObject(m.(engine.Monitor).RootMonitor().CascadeTree())
+	}
+
+	return res, nil
+}
+
+/*
+cascadeObject converts a cascade tree into an ECAL object.
+*/
+func cascadeObject(node *engine.CascadeNode) map[interface{}]interface{} {
+	var event, activated, finished interface{}
+
+	if node.Event != nil {
+		event = eventObject(node.Event)
+	}
+
+	if !node.Activated.IsZero() {
+		activated = float64(node.Activated.UnixNano() / int64(time.Microsecond))
+	}
+
+	if !node.Finished.IsZero() {
+		finished = float64(node.Finished.UnixNano() / int64(time.Microsecond))
+	}
+
+	rules := make([]interface{}, 0, len(node.Rules))
+	for _, r := range node.Rules {
+		rules = append(rules, r)
+	}
+
+	results := make(map[interface{}]interface{}, len(node.Results))
+	for k, v := range node.Results {
+		results[k] = v
+	}
+
+	children := make([]interface{}, 0, len(node.Children))
+	for _, c := range node.Children {
+		children = append(children, cascadeObject(c))
+	}
+
+	return map[interface{}]interface{}{
+		"event":     event,
+		"rules":     rules,
+		"errors":    errorObjects(node.Errors),
+		"results":   results,
+		"activated": activated,
+		"finished":  finished,
+		"duration":  float64(node.Duration() / time.Microsecond),
+		"children":  children,
+	}
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (rf *getCascade) DocString() (string, error) {
+	return "Returns the event cascade of the current sink as a tree of events, rules, errors and timings.", nil
+}
+
+// setCronTrigger
+// ==============
+
+/*
+setCronTrigger adds a periodic cron job which fires events.
+*/
+type setCronTrigger struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (ct *setCronTrigger) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	err := fmt.Errorf("Need a cronspec, an event name and an event scope as parameters")
+
+	if len(args) > 2 {
+		var cs *timeutil.CronSpec
+
+		cronspec := fmt.Sprint(args[0])
+		eventname := fmt.Sprint(args[1])
+		eventkind := strings.Split(fmt.Sprint(args[2]), ".")
+
+		erp := is["erp"].(*ECALRuntimeProvider)
+		proc := erp.Processor
+
+		if proc.Stopped() {
+			proc.Start()
+		}
+
+		if cs, err = timeutil.NewCronSpec(cronspec); err == nil {
+			res = cs.String()
+
+			tick := 0
+
+			erp.addCronTrigger(cs, func() {
+				tick++
+				now := erp.Cron.NowFunc()
+				event := engine.NewEvent(eventname, eventkind, map[interface{}]interface{}{
+					"time":      now,
+					"timestamp": fmt.Sprintf("%d", now.UnixNano()/int64(time.Millisecond)),
+					"tick":      float64(tick),
+				})
+				monitor := proc.NewRootMonitor(nil, nil)
+
+				_, err := proc.AddEvent(event, monitor)
+
+				if status := proc.Status(); status != "Stopped" && status != "Stopping" {
+					errorutil.AssertTrue(err == nil,
+						fmt.Sprintf("Could not add cron event for trigger %v %v %v: %v",
+							cronspec, eventname, eventkind, err))
+				}
+			})
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (ct *setCronTrigger) DocString() (string, error) {
+	return "Adds a periodic cron job which fires events.", nil
+}
+
+// setPulseTrigger
+// ==============
+
+/*
+setPulseTrigger adds recurring events in very short intervals.
+*/
+type setPulseTrigger struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (pt *setPulseTrigger) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := fmt.Errorf("Need micro second interval, an event name and an event scope as parameters")
+
+	if len(args) > 2 {
+		var micros float64
+
+		micros, err = pt.AssertNumParam(1, args[0])
+
+		if err == nil {
+			eventname := fmt.Sprint(args[1])
+			eventkind := strings.Split(fmt.Sprint(args[2]), ".")
+
+			erp := is["erp"].(*ECALRuntimeProvider)
+			proc := erp.Processor
+
+			if proc.Stopped() {
+				proc.Start()
+			}
+
+			tick := 0
+
+			// The trigger stops once the processor shuts down
+
+			stop, done := proc.RegisterTrigger()
+			clock := proc.Clock()
+
+			go func() {
+				var lastmicros int64
+
+				defer done()
+
+				for {
+					select {
+					case <-stop:
+						return
+					case <-clock.After(time.Duration(micros) * time.Microsecond):
+					}
+
+					tick++
+					now := clock.Now()
+					micros := now.UnixNano() / int64(time.Microsecond)
+					event := engine.NewEvent(eventname, eventkind, map[interface{}]interface{}{
+						"currentMicros": float64(micros),
+						"lastMicros":    float64(lastmicros),
+						"timestamp":     fmt.Sprintf("%d", now.UnixNano()/int64(time.Microsecond)),
+						"tick":          float64(tick),
+					})
+					lastmicros = micros
+
+					monitor := proc.NewRootMonitor(nil, nil)
+					_, err := proc.AddEventAndWait(event, monitor)
+
+					if status := proc.Status(); status == "Stopped" || status == "Stopping" {
+						break
+					}
+
+					errorutil.AssertTrue(err == nil,
+						fmt.Sprintf("Could not add pulse event for trigger %v %v %v: %v",
+							micros, eventname, eventkind, err))
+				}
+			}()
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (pt *setPulseTrigger) DocString() (string, error) {
+	return "Adds recurring events in microsecond intervals.", nil
+}
+
+// setSinkEnabled
+// ==============
+
+/*
+setSinkEnabled enables or disables a sink while the processor is running.
+*/
+type setSinkEnabled struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (ss *setSinkEnabled) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := fmt.Errorf("Need a sink name and an enabled flag as parameters")
+
+	if len(args) > 1 {
+		var enabled bool
+
+		if enabled, err = strconv.ParseBool(fmt.Sprint(args[1])); err != nil {
+			err = fmt.Errorf("Parameter 2 should be a boolean")
+		} else {
+			erp := is["erp"].(*ECALRuntimeProvider)
+			err = erp.Processor.SetRuleEnabled(fmt.Sprint(args[0]), enabled)
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (ss *setSinkEnabled) DocString() (string, error) {
+	return "Enables or disables a sink. Disabled sinks do not trigger and do not suppress other sinks.", nil
+}
+
+// setSinkPriority
+// ===============
+
+/*
+setSinkPriority changes the priority of a sink while the processor is running.
+*/
+type setSinkPriority struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (ss *setSinkPriority) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := fmt.Errorf("Need a sink name and a priority as parameters")
+
+	if len(args) > 1 {
+		var priority float64
+
+		if priority, err = ss.AssertNumParam(2, args[1]); err == nil {
+			erp := is["erp"].(*ECALRuntimeProvider)
+			err = erp.Processor.SetRulePriority(fmt.Sprint(args[0]), int(math.Floor(priority)))
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (ss *setSinkPriority) DocString() (string, error) {
+	return "Changes the priority of a sink.", nil
+}
+
+// addSink
+// =======
+
+/*
+addSink adds a sink which calls a function for every event it handles. The
+sink can be added while the processor is running.
+*/
+type addSink struct {
+	*inbuildBaseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (as *addSink) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var kindMatchList []interface{}
+	var stateMatchMap map[interface{}]interface{}
+	var stateMatch map[string]interface{}
+
+	if len(args) < 4 {
+		return nil, fmt.Errorf("Need a sink name, a kind match list, a state match map and a function as parameters")
+	}
+
+	funcObj, ok := args[3].(util.ECALFunction)
+	if !ok {
+		return nil, fmt.Errorf("Parameter 4 should be a function")
+	}
+
+	kindMatchList, err := as.AssertListParam(2, args[1])
+
+	if err == nil && args[2] != nil {
+		if stateMatchMap, err = as.AssertMapParam(3, args[2]); err == nil {
+			stateMatch, err = makeStateMatch(stateMatchMap)
+		}
+	}
+
+	if err == nil {
+		erp := is["erp"].(*ECALRuntimeProvider)
+		node := is["astnode"].(*parser.ASTNode)
+
+		kindMatch := make([]string, 0, len(kindMatchList))
+
+		for _, k := range kindMatchList {
+			kindMatch = append(kindMatch, fmt.Sprint(k))
+		}
 
-		if ok {
-			res, err = funcObj.DocString()
+		rule := &engine.Rule{
+			Name:       fmt.Sprint(args[0]),
+			KindMatch:  kindMatch,
+			ScopeMatch: []string{},
+			StateMatch: stateMatch,
 		}
+
+		// The function is called with the event as parameter
+
+		rule.Action = newSinkAction(erp, node, rule, vs, 0,
+			func(sinkVS parser.Scope, sinkIs map[string]interface{}, tid uint64) error {
+				sinkIs["erp"] = erp
+				sinkIs["astnode"] = node
+
+				event, _, _ := sinkVS.GetValue("event")
+
+				_, err := funcObj.Run(instanceID, sinkVS, sinkIs, tid, []interface{}{event})
+				return err
+			})
+
+		err = erp.Processor.InsertRule(rule)
 	}
 
-	return res, err
+	return nil, err
 }
 
 /*
 DocString returns a descriptive string.
 */
-func (rf *docFunc) DocString() (string, error) {
-	return "Returns the docstring of a function.", nil
+func (as *addSink) DocString() (string, error) {
+	return "Adds a sink which calls a function for every event it handles.", nil
 }
 
-// sleep
-// =====
+// removeSink
+// ==========
 
 /*
-sleepFunc pauses the current thread for a number of micro seconds.
+removeSink removes a sink. The sink can be removed while the processor is running.
 */
-type sleepFunc struct {
+type removeSink struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *sleepFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	var res interface{}
-	err := fmt.Errorf("Need number of micro seconds as parameter")
-
-	if len(args) > 0 {
-		var micros float64
-
-		micros, err = rf.AssertNumParam(1, args[0])
-
-		if err == nil {
-			time.Sleep(time.Duration(micros) * time.Microsecond)
-		}
+func (rs *removeSink) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("Need a sink name as parameter")
 	}
 
-	return res, err
+	erp := is["erp"].(*ECALRuntimeProvider)
+
+	return nil, erp.Processor.RemoveRule(fmt.Sprint(args[0]))
 }
 
 /*
 DocString returns a descriptive string.
 */
-func (rf *sleepFunc) DocString() (string, error) {
-	return "Pauses the current thread for a number of micro seconds.", nil
+func (rs *removeSink) DocString() (string, error) {
+	return "Removes a sink.", nil
 }
 
-// raise
-// =====
+// listSinks
+// =========
 
 /*
-raise returns an error. Outside of sinks this will stop the code execution
-if the error is not handled by try / except. Inside a sink only the specific sink
-will fail. This error can be used to break trigger sequences of sinks if
-FailOnFirstErrorInTriggerSequence is set.
+listSinks returns information about all registered sinks.
 */
-type raise struct {
+type listSinks struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *raise) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	var err error
-	var detailMsg string
-	var detail interface{}
-
-	if len(args) > 0 {
-		err = fmt.Errorf("%v", args[0])
-		if len(args) > 1 {
-			if args[1] != nil {
-				detailMsg = fmt.Sprint(args[1])
-			}
-			if len(args) > 2 {
-				detail = args[2]
-			}
-		}
-	}
-
+func (ls *listSinks) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
 	erp := is["erp"].(*ECALRuntimeProvider)
-	node := is["astnode"].(*parser.ASTNode)
-
-	return nil, &util.RuntimeErrorWithDetail{
-		RuntimeError: erp.NewRuntimeError(err, detailMsg, node).(*util.RuntimeError),
-		Environment:  vs,
-		Data:         detail,
-	}
 
+	return scope.ConvertGoToECALObject(erp.Sinks()), nil
 }
 
 /*
 DocString returns a descriptive string.
 */
-func (rf *raise) DocString() (string, error) {
-	return "Raise an error which stops the execution unless it is handled by a try/except block.", nil
+func (ls *listSinks) DocString() (string, error) {
+	return "Returns a list of all registered sinks.", nil
 }
 
-// addEvent
-// ========
+// whichSinks
+// ==========
 
 /*
-addevent adds an event to trigger sinks. This function will return immediately
-and not wait for the event cascade to finish. Use this function for event cascades.
+whichSinks returns the sinks which would be triggered by an event without
+running them.
 */
-type addevent struct {
+type whichSinks struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *addevent) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	return rf.addEvent(func(proc engine.Processor, event *engine.Event, scope *engine.RuleScope) (interface{}, error) {
-		var monitor engine.Monitor
-
-		parentMonitor, ok := is["monitor"]
-
-		if scope != nil || !ok {
-			monitor = proc.NewRootMonitor(nil, scope)
-		} else {
-			monitor = parentMonitor.(engine.Monitor).NewChildMonitor(0)
-		}
-
-		_, err := proc.AddEvent(event, monitor)
-		return nil, err
-	}, is, args)
-}
-
-func (rf *addevent) addEvent(addFunc func(engine.Processor, *engine.Event, *engine.RuleScope) (interface{}, error),
-	is map[string]interface{}, args []interface{}) (interface{}, error) {
-
+func (ws *whichSinks) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
 	var res interface{}
 	var stateMap map[interface{}]interface{}
 
 	erp := is["erp"].(*ECALRuntimeProvider)
-	proc := erp.Processor
-
-	if proc.Stopped() {
-		proc.Start()
-	}
 
-	err := fmt.Errorf("Need at least three parameters: name, kind and state")
+	err := fmt.Errorf("Need at least two parameters: kind and state")
 
-	if len(args) > 2 {
+	if len(args) > 1 {
 
-		if stateMap, err = rf.AssertMapParam(3, args[2]); err == nil {
+		if stateMap, err = ws.AssertMapParam(2, args[1]); err == nil {
 			var scope *engine.RuleScope
 
-			event := engine.NewEvent(
-				fmt.Sprint(args[0]),
-				strings.Split(fmt.Sprint(args[1]), "."),
-				stateMap,
-			)
+			event := engine.NewEvent("dryrun", strings.Split(fmt.Sprint(args[0]), "."), stateMap)
 
-			if len(args) > 3 {
+			if len(args) > 2 {
 				var scopeMap map[interface{}]interface{}
 
-				// Add optional scope - if not specified it is { "": true }
-
-				if scopeMap, err = rf.AssertMapParam(4, args[3]); err == nil {
+				if scopeMap, err = ws.AssertMapParam(3, args[2]); err == nil {
 					var scopeData = map[string]bool{}
 
 					for k, v := range scopeMap {
@@ -840,7 +2986,13 @@ func (rf *addevent) addEvent(addFunc func(engine.Processor, *engine.Event, *engi
 			}
 
 			if err == nil {
-				res, err = addFunc(proc, event, scope)
+				names := []interface{}{}
+
+				for _, rule := range erp.Processor.DryRun(event, scope) {
+					names = append(names, rule.Name)
+				}
+
+				res = names
 			}
 		}
 	}
@@ -851,135 +3003,64 @@ func (rf *addevent) addEvent(addFunc func(engine.Processor, *engine.Event, *engi
 /*
 DocString returns a descriptive string.
 */
-func (rf *addevent) DocString() (string, error) {
-	return "Adds an event to trigger sinks. This function will return " +
-		"immediately and not wait for the event cascade to finish.", nil
+func (ws *whichSinks) DocString() (string, error) {
+	return "Returns the names of all sinks which would be triggered by an event " +
+		"in the order of their execution without running them.", nil
 }
 
-// addEventAndWait
-// ===============
+// invokeSink
+// ==========
 
 /*
-addeventandwait adds an event to trigger sinks. This function will return once
-the event cascade has finished and return all errors.
+invokeSink runs the body of a sink directly with a synthesized event. The event
+is not added to the processor - matching conditions and suppressions of the
+sink are not checked.
 */
-type addeventandwait struct {
-	*addevent
+type invokeSink struct {
+	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (rf *addeventandwait) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	return rf.addEvent(func(proc engine.Processor, event *engine.Event, scope *engine.RuleScope) (interface{}, error) {
-		var res []interface{}
-		rm := proc.NewRootMonitor(nil, scope)
-		m, err := proc.AddEventAndWait(event, rm)
-
-		if m != nil {
-			allErrors := m.(*engine.RootMonitor).AllErrors()
-
-			for _, e := range allErrors {
-
-				errors := map[interface{}]interface{}{}
-				for k, v := range e.ErrorMap {
-
-					// Note: The variable scope of the sink (se.environment)
-					// was also captured - for now it is not exposed to the
-					// language environment
+func (iv *invokeSink) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var stateMap map[interface{}]interface{}
 
-					errorItem := map[interface{}]interface{}{
-						"error": v.Error(),
-					}
+	erp := is["erp"].(*ECALRuntimeProvider)
 
-					if se, ok := v.(*util.RuntimeErrorWithDetail); ok {
-						errorItem["type"] = se.Type.Error()
-						errorItem["detail"] = se.Detail
-						errorItem["data"] = se.Data
-					}
+	err := fmt.Errorf("Need at least two parameters: name and state")
 
-					errors[k] = errorItem
-				}
+	if len(args) > 1 {
 
-				item := map[interface{}]interface{}{
-					"event": map[interface{}]interface{}{
-						"name":  e.Event.Name(),
-						"kind":  strings.Join(e.Event.Kind(), "."),
-						"state": e.Event.State(),
-					},
-					"errors": errors,
-				}
+		if stateMap, err = iv.AssertMapParam(2, args[1]); err == nil {
+			name := fmt.Sprint(args[0])
+			rule, ok := erp.Processor.Rules()[name]
 
-				res = append(res, item)
+			if !ok {
+				return nil, fmt.Errorf("Unknown sink: %v", name)
 			}
-		}
-
-		return res, err
-	}, is, args)
-}
-
-/*
-DocString returns a descriptive string.
-*/
-func (rf *addeventandwait) DocString() (string, error) {
-	return "Adds an event to trigger sinks. This function will " +
-		"return once the event cascade has finished.", nil
-}
-
-// setCronTrigger
-// ==============
-
-/*
-setCronTrigger adds a periodic cron job which fires events.
-*/
-type setCronTrigger struct {
-	*inbuildBaseFunc
-}
-
-/*
-Run executes this function.
-*/
-func (ct *setCronTrigger) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	var res interface{}
-	err := fmt.Errorf("Need a cronspec, an event name and an event scope as parameters")
 
-	if len(args) > 2 {
-		var cs *timeutil.CronSpec
-
-		cronspec := fmt.Sprint(args[0])
-		eventname := fmt.Sprint(args[1])
-		eventkind := strings.Split(fmt.Sprint(args[2]), ".")
-
-		erp := is["erp"].(*ECALRuntimeProvider)
-		proc := erp.Processor
+			// The event has by default the first kind which is matched by the sink
 
-		if proc.Stopped() {
-			proc.Start()
-		}
+			var kind []string
 
-		if cs, err = timeutil.NewCronSpec(cronspec); err == nil {
-			res = cs.String()
+			if len(args) > 2 {
+				kind = strings.Split(fmt.Sprint(args[2]), ".")
+			} else if len(rule.KindMatch) > 0 {
+				kind = strings.Split(rule.KindMatch[0], ".")
+			}
 
-			tick := 0
+			event := engine.NewEvent(name, kind, stateMap)
+			monitor := erp.Processor.NewRootMonitor(nil, nil)
 
-			erp.Cron.RegisterSpec(cs, func() {
-				tick++
-				now := erp.Cron.NowFunc()
-				event := engine.NewEvent(eventname, eventkind, map[interface{}]interface{}{
-					"time":      now,
-					"timestamp": fmt.Sprintf("%d", now.UnixNano()/int64(time.Millisecond)),
-					"tick":      float64(tick),
-				})
-				monitor := proc.NewRootMonitor(nil, nil)
+			monitor.Activate(event)
 
-				_, err := proc.AddEvent(event, monitor)
+			if err = rule.Action(erp.Processor, monitor, event, tid); err == nil {
+				res = monitor.Results()[rule.Name]
+			}
 
-				if status := proc.Status(); status != "Stopped" && status != "Stopping" {
-					errorutil.AssertTrue(err == nil,
-						fmt.Sprintf("Could not add cron event for trigger %v %v %v: %v",
-							cronspec, eventname, eventkind, err))
-				}
-			})
+			monitor.Finish()
 		}
 	}
 
@@ -989,82 +3070,111 @@ func (ct *setCronTrigger) Run(instanceID string, vs parser.Scope, is map[string]
 /*
 DocString returns a descriptive string.
 */
-func (ct *setCronTrigger) DocString() (string, error) {
-	return "Adds a periodic cron job which fires events.", nil
+func (iv *invokeSink) DocString() (string, error) {
+	return "Runs the body of a sink directly with an event which has a given state " +
+		"and returns the value which was returned by the sink.", nil
 }
 
-// setPulseTrigger
+// circuitBreaker
 // ==============
 
 /*
-setPulseTrigger adds recurring events in very short intervals.
+circuitBreaker sets up a named circuit breaker for a list of sinks or returns
+the state of an existing circuit breaker.
 */
-type setPulseTrigger struct {
+type circuitBreaker struct {
 	*inbuildBaseFunc
 }
 
 /*
 Run executes this function.
 */
-func (pt *setPulseTrigger) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
-	err := fmt.Errorf("Need micro second interval, an event name and an event scope as parameters")
+func (cb *circuitBreaker) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var opts map[interface{}]interface{}
 
-	if len(args) > 2 {
-		var micros float64
+	erp := is["erp"].(*ECALRuntimeProvider)
 
-		micros, err = pt.AssertNumParam(1, args[0])
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Need a breaker name and optionally a map of options as parameters")
+	}
 
-		if err == nil {
-			eventname := fmt.Sprint(args[1])
-			eventkind := strings.Split(fmt.Sprint(args[2]), ".")
+	name := fmt.Sprint(args[0])
 
-			erp := is["erp"].(*ECALRuntimeProvider)
-			proc := erp.Processor
+	erp.breakersLock.Lock()
+	defer erp.breakersLock.Unlock()
 
-			if proc.Stopped() {
-				proc.Start()
+	if len(args) > 1 {
+		var sinks []interface{}
+		var failures float64 = 5
+		var cooldown = 30 * time.Second
+		var err error
+
+		if opts, err = cb.AssertMapParam(2, args[1]); err == nil {
+			if sinks, err = cb.AssertListParam(2, opts["sinks"]); err != nil {
+				err = fmt.Errorf("Option sinks should be a list of sink names")
 			}
+		}
 
-			tick := 0
+		if v, ok := opts["failures"]; err == nil && ok {
+			if failures, err = cb.AssertNumParam(2, v); err == nil && failures < 1 {
+				err = fmt.Errorf("Option failures should be a positive number")
+			}
+		}
 
-			go func() {
-				var lastmicros int64
+		if v, ok := opts["cooldown"]; err == nil && ok {
+			cooldown, err = cb.AssertDurationParam(2, v)
+		}
 
-				for {
-					time.Sleep(time.Duration(micros) * time.Microsecond)
+		if err != nil {
+			return nil, err
+		}
 
-					tick++
-					now := time.Now()
-					micros := now.UnixNano() / int64(time.Microsecond)
-					event := engine.NewEvent(eventname, eventkind, map[interface{}]interface{}{
-						"currentMicros": float64(micros),
-						"lastMicros":    float64(lastmicros),
-						"timestamp":     fmt.Sprintf("%d", now.UnixNano()/int64(time.Microsecond)),
-						"tick":          float64(tick),
-					})
-					lastmicros = micros
+		breaker := &ruleBreaker{engine.NewRuleBreaker(name, int(failures), cooldown), nil}
 
-					monitor := proc.NewRootMonitor(nil, nil)
-					_, err := proc.AddEventAndWait(event, monitor)
+		// Remove a previous breaker with the same name from its sinks
 
-					if status := proc.Status(); status == "Stopped" || status == "Stopping" {
-						break
-					}
+		if old, ok := erp.breakers[name]; ok {
+			for _, sink := range old.sinks {
+				erp.Processor.SetRuleBreaker(sink, nil)
+			}
+		}
 
-					errorutil.AssertTrue(err == nil,
-						fmt.Sprintf("Could not add pulse event for trigger %v %v %v: %v",
-							micros, eventname, eventkind, err))
-				}
-			}()
+		for _, sink := range sinks {
+			if err = erp.Processor.SetRuleBreaker(fmt.Sprint(sink), breaker.RuleBreaker); err != nil {
+				return nil, err
+			}
+			breaker.sinks = append(breaker.sinks, fmt.Sprint(sink))
 		}
+
+		erp.breakers[name] = breaker
 	}
 
-	return nil, err
+	breaker, ok := erp.breakers[name]
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown circuit breaker: %v", name)
+	}
+
+	state, failures := breaker.State()
+	sinks := make([]interface{}, len(breaker.sinks))
+
+	for i, sink := range breaker.sinks {
+		sinks[i] = sink
+	}
+
+	return map[interface{}]interface{}{
+		"name":      name,
+		"state":     state,
+		"failures":  float64(failures),
+		"threshold": float64(breaker.Threshold),
+		"cooldown":  breaker.Cooldown.Seconds(),
+		"sinks":     sinks,
+	}, nil
 }
 
 /*
 DocString returns a descriptive string.
 */
-func (pt *setPulseTrigger) DocString() (string, error) {
-	return "Adds recurring events in microsecond intervals.", nil
+func (cb *circuitBreaker) DocString() (string, error) {
+	return "Sets up a named circuit breaker for a list of sinks and returns its state.", nil
 }
@@ -11,6 +11,7 @@
 package interpreter
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
@@ -18,7 +19,10 @@ import (
 	"time"
 
 	"github.com/krotik/common/errorutil"
+	"github.com/krotik/common/stringutil"
 	"github.com/krotik/common/timeutil"
+	"github.com/krotik/ecal/engine"
+	"github.com/krotik/ecal/scope"
 	"github.com/krotik/ecal/stdlib"
 )
 
@@ -114,7 +118,7 @@ identifier: type
 `[1:])
 	errorutil.AssertOk(err)
 
-	if res != "map[interface {}]interface {}{interface {}(nil):[]interface {}{1, 2, 3}}" {
+	if res != "map" {
 		t.Error("Unexpected result: ", res, err)
 		return
 	}
@@ -328,7 +332,7 @@ doc(foo)`, nil)
 		`doc(len)`, nil)
 	errorutil.AssertOk(err)
 
-	if fmt.Sprint(res) != `Returns the size of a list or map.` {
+	if fmt.Sprint(res) != `Returns the size of a list, map or bytes.` {
 		t.Error("Unexpected result: ", res, err)
 		return
 	}
@@ -381,12 +385,415 @@ identifier: a
 		return
 	}
 
-	_, err = UnitTestEval(`sleep(10)`, nil)
+	_, err = UnitTestEval(`sleep(10us)`, nil)
 
 	if err != nil {
 		t.Error("Unexpected result: ", err)
 		return
 	}
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err = UnitTestEval(`
+t := timerStart()
+sleep(0.01)
+sleep("5ms")
+sleep("0m0.005s")
+a := timerElapsed(t)
+`, vs)
+
+	if a, _, _ := vs.GetValue("a"); err != nil || a.(float64) < 0.02 || a.(float64) > 10 {
+		t.Error("Unexpected result: ", a, err)
+		return
+	}
+
+	_, err = UnitTestEval(`sleep("5 seconds")`, nil)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Parameter 1 should be a duration) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`timerElapsed()`, nil)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Need a timer handle as parameter) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+func TestGetFunction(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+m := {"a" : {"b" : [1, {"c" : "foo"}], 1 : "bar", "d" : null}}
+result1 := get(m, "a.b.1.c")
+result2 := get(m, "a.b.-1.c")
+result3 := get(m, "a.x.c")
+result4 := get(m, "a.b.5.c", "def")
+result5 := get(m, ["a", 1])
+result6 := get(m, "a.1")
+result7 := get(m, "a.d", 0)
+result8 := get(m, "a.b.1.c.d", 0)
+result9 := get(null, "a", 1)
+`, vs)
+
+	if vsRes := vs.String(); err != nil || vsRes != `GlobalScope {
+    m (map[interface {}]interface {}) : {"a":{"1":"bar","b":[1,{"c":"foo"}],"d":null}}
+    result1 (string) : foo
+    result2 (string) : foo
+    result3 (<nil>) : null
+    result4 (string) : def
+    result5 (string) : bar
+    result6 (string) : bar
+    result7 (float64) : 0
+    result8 (float64) : 0
+    result9 (float64) : 1
+}` {
+		t.Error("Unexpected result: ", vsRes, err)
+		return
+	}
+
+	_, err = UnitTestEval(`get(m)`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Need a list or map and a path as parameters) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+func TestIntrospectionFunctions(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+func myfunc() {
+}
+m := {"b" : 2, "a" : 1, 3 : "c"}
+result1 := [type(null), type(1), type("a"), type(true), type([]), type(m), type(myfunc)]
+result2 := keys(m)
+result3 := values(m)
+result4 := [hasKey(m, "a"), hasKey(m, 3), hasKey(m, "x")]
+result5 := [callable(myfunc), callable(m), callable(null)]
+`, vs)
+
+	if res := fmt.Sprint(scope.ToObject(vs)["result1"], scope.ToObject(vs)["result2"],
+		scope.ToObject(vs)["result3"], scope.ToObject(vs)["result4"],
+		scope.ToObject(vs)["result5"]); err != nil ||
+		res != "[null number string boolean list map function] [3 a b] [c 1 2] [true true false] [true false false]" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	_, err = UnitTestEval(`keys([1,2])`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Parameter 1 should be a map) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`hasKey(m)`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Need a map and a key as parameters) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+func TestNumberFunctions(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+result1 := [parseNum("12.5"), parseNum(" -3 "), parseNum(7), parseNum("1e3")]
+result2 := [parseNum("foo", 0), parseNum("", null)]
+result3 := [formatNum(1234567.891), formatNum(1234567.891, 2), formatNum(-1234.5, 0), formatNum(123, 2)]
+result4 := [formatNum(1234567.891, 1, ".", ","), formatNum(1234567, null, " ")]
+result5 := [toFixed(1.005, 1), toFixed(2, 3), toFixed("3.14159", 2)]
+`, vs)
+
+	if res := fmt.Sprintf("%#v %#v %#v %#v %#v", scope.ToObject(vs)["result1"], scope.ToObject(vs)["result2"],
+		scope.ToObject(vs)["result3"], scope.ToObject(vs)["result4"],
+		scope.ToObject(vs)["result5"]); err != nil || res != `[]interface {}{12.5, -3, 7, 1000} `+
+		`[]interface {}{0, interface {}(nil)} `+
+		`[]interface {}{"1,234,567.891", "1,234,567.89", "-1,234", "123.00"} `+
+		`[]interface {}{"1.234.567,9", "1 234 567"} `+
+		`[]interface {}{"1.0", "2.000", "3.14"}` {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	_, err = UnitTestEval(`parseNum("foo")`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Cannot parse number: foo) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`formatNum("foo")`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Parameter 1 should be a number) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`toFixed(1, -1)`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Number of decimals must not be negative) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`toFixed(1)`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Need a number and the number of decimals as parameters) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+func TestBitwiseFunctions(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+flags := 180
+result1 := [band(flags, 15), bor(flags, 1), bxor(flags, 255), bnot(0), bnot(5)]
+result2 := [shl(1, 10), shr(flags, 4), shr(-16, 2), band(shr(flags, 2), 1) == 1]
+`, vs)
+
+	if res := fmt.Sprint(scope.ToObject(vs)["result1"], scope.ToObject(vs)["result2"]); err != nil ||
+		res != "[4 181 75 -1 -6] [1024 11 -4 true]" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	_, err = UnitTestEval(`band(1.5, 1)`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Parameter 1 should be an integer number) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`shl(1, -1)`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Shift count must not be negative) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`bor(1)`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Need 2 integer numbers as parameters) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+func TestBytesFunctions(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+data := bytes("48656c6c6f", "hex")
+data[0] := 104
+result1 := [type(data), len(data), data[1], data[-1], bytesToString(data)]
+result2 := [bytesToString(data, "hex"), bytesToString(data, "base64"), bytesToString(bytes("aGVsbG8=", "base64"))]
+result3 := [bytesToString(slice(data, 1, 3)), bytesToString(slice(data, -2)), data == bytes("hello"), data != bytes([104])]
+result4 := [bytesToString(concat(bytes("a"), bytes([98, 99]), data)), bytesToString(bytes("äb"), "hex")]
+result5 := []
+for b in bytes("ab") {
+  result5 := add(result5, b)
+}
+result6 := [slice([1, 2, 3, 4], 1, -1), slice("äbcd", 1, 2), slice("abc", 5), slice("abc", 2, 1), slice("abc", 0, null)]
+`, vs)
+
+	obj := scope.ToObject(vs)
+
+	if res := fmt.Sprint(obj["result1"], obj["result2"], obj["result3"], obj["result4"], obj["result5"], obj["result6"]); err != nil ||
+		res != "[bytes 5 101 111 hello] [68656c6c6f aGVsbG8= hello] [el lo true true] [abchello c3a462] [97 98] [[2 3] b   abc]" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	// Test error cases
+
+	for code, expected := range map[string]string{
+		`bytes()`:                      "Need a string or a list of byte values as first parameter",
+		`bytes("a", "foo")`:            "Unknown encoding: foo (supported are utf8, hex and base64)",
+		`bytes("xyz", "hex")`:          "Cannot decode hex string: encoding/hex: invalid byte: U+0078 'x'",
+		`bytes([1, 256])`:              "Byte value must be an integer between 0 and 255: 256",
+		`bytesToString()`:              "Need bytes as first parameter",
+		`bytesToString("a")`:           "Parameter 1 should be bytes",
+		`slice([1])`:                   "Need a list, bytes or a string and a start index as parameters",
+		`slice(1, 2)`:                  "Parameter 1 should be a list, bytes or a string",
+		`slice([1], "a")`:              "Parameter 2 should be a number",
+		`concat(bytes("a"), [1])`:      "Parameter 2 should be bytes",
+		`len(1)`:                       "Need a list, a map or bytes as first parameter",
+		`b := bytes("a"); b[0] := 1.5`: "Byte value must be an integer between 0 and 255: 1.5",
+	} {
+		if _, err = UnitTestEval(code, vs); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Unexpected result: ", code, err)
+			return
+		}
+	}
+}
+
+func TestMemoize(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+calls := 0
+/*
+Squares a number.
+*/
+func square(x) {
+  calls := calls + 1
+  if x < 0 {
+    raise("negative")
+  }
+  return x * x
+}
+fast := memoize(square, 2)
+result3 := null
+result1 := [fast(2), fast(2), fast(3), fast(3), calls]
+result2 := [fast(2 - 1), fast(1), calls]
+try {
+  fast(-1)
+} except e {
+  result3 := e.type
+}
+try {
+  fast(-1)
+} except e {
+  result3 := [result3, e.type, calls]
+}
+result4 := [callable(fast), type(fast), doc(fast)]
+`, vs)
+
+	obj := scope.ToObject(vs)
+
+	if res := fmt.Sprint(obj["result1"], obj["result2"], obj["result3"], obj["result4"]); err != nil ||
+		res != "[4 4 9 9 2] [1 1 3] [negative negative 5] [true function Squares a number.]" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	for code, expected := range map[string]string{
+		`memoize()`:                    "Need a function as first parameter",
+		`memoize(1)`:                   "Need a function as first parameter",
+		`func f() {}; memoize(f, "a")`: "Parameter 2 should be a number",
+		`func f() {}; memoize(f, -1)`:  "Cache size and maximum age must not be negative",
+	} {
+		if _, err = UnitTestEval(code, vs); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Unexpected result: ", code, err)
+			return
+		}
+	}
+}
+
+func TestParallelMap(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+running := 0
+maxRunning := 0
+func work(x, i) {
+  mutex m {
+    running := running + 1
+    if running > maxRunning {
+      maxRunning := running
+    }
+  }
+  sleep(20ms)
+  mutex m {
+    running := running - 1
+  }
+  return x * 10 + i
+}
+result1 := parallelMap([1, 2, 3, 4], work, 2)
+result1 := [result1, maxRunning, parallelMap([], work)]
+
+func check(x, i) {
+  if x % 2 == 0 {
+    raise("Even", "Even number {{x}}", x)
+  }
+  return x
+}
+result2 := null
+try {
+  parallelMap([1, 2, 3, 4], check)
+} except e {
+  result2 := [e.type, e.detail, e.data]
+}
+`, vs)
+
+	obj := scope.ToObject(vs)
+
+	if res := fmt.Sprint(obj["result1"]); err != nil || res != "[[10 21 32 43] 2 []]" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	if res := stringutil.ConvertToString(obj["result2"]); res != `["Error in parallel iteration","2 of 4 iterations failed",`+
+		`[{"data":2,"detail":"Even number 2","error":"ECAL error in ECALTestRuntime (ECALEvalTest): Even (Even number 2) (Line:22 Pos:5)","index":1,"type":"Even"},`+
+		`{"data":4,"detail":"Even number 4","error":"ECAL error in ECALTestRuntime (ECALEvalTest): Even (Even number 4) (Line:22 Pos:5)","index":3,"type":"Even"}]]` {
+		t.Error("Unexpected result: ", res)
+		return
+	}
+
+	for code, expected := range map[string]string{
+		`parallelMap([1])`:                      "Need a list and a function as parameters",
+		`parallelMap(1, 2)`:                     "Parameter 1 should be a list",
+		`parallelMap([1], 2)`:                   "Parameter 2 should be a function",
+		`func f() {}; parallelMap([1], f, 0)`:   "Number of workers must be at least 1",
+		`func f() {}; parallelMap([1], f, "a")`: "Parameter 3 should be a number",
+	} {
+		if _, err = UnitTestEval(code, vs); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Unexpected result: ", code, err)
+			return
+		}
+	}
+}
+
+func TestAtomicFunctions(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+items := []
+for i in range(1, 50) {
+  items := add(items, i)
+}
+func inc(x, i) {
+  return atomicAdd("counter", x)
+}
+parallelMap(items, inc, 8)
+result1 := [counter, atomicAdd("counter", -1275), atomicAdd("counter", 0.5)]
+
+state := "idle"
+func casInScope() {
+  return cas("state", "idle", "busy")
+}
+result2 := [casInScope(), cas("state", "idle", "busy"), state, cas("newvar", null, 1), newvar]
+`, vs)
+
+	obj := scope.ToObject(vs)
+
+	if res := fmt.Sprint(obj["result1"], obj["result2"]); err != nil || res != "[1275 0 0.5] [true false busy true 1]" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	for code, expected := range map[string]string{
+		`atomicAdd("a")`:                  "Need a variable name and a number as parameters",
+		`atomicAdd("a", "b")`:             "Parameter 2 should be a number",
+		`a := "x"; atomicAdd("a", 1)`:     "Variable a should be a number",
+		`const A := 1; atomicAdd("A", 1)`: "Cannot assign to constant A",
+		`cas("a", 1)`:                     "Need a variable name, an expected value and a new value as parameters",
+		`cas("a", [1], 2)`:                "Parameter 2 should be null, a number, a string, a boolean or bytes",
+		`const B := 1; cas("B", 1, 2)`:    "Cannot assign to constant B",
+	} {
+		if _, err = UnitTestEval(code, vs); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Unexpected result: ", code, err)
+			return
+		}
+	}
 }
 
 func TestCronTrigger(t *testing.T) {
@@ -418,11 +825,16 @@ log("Cron:", setCronTrigger("1 1 *%10 * * *", "cronevent", "foo.bar"))
 
 	testcron.Start()
 	timeutil.WaitTestingCron(testcron)
+	testprocessor.Finish()
 
 	if testlogger.String() != `
 Cron:at second 1 of minute 1 of every 10th hour every day
 test rule - Handling request: {
+  "cascade": {},
   "kind": "foo.bar",
+  "kindparams": {
+    "1": "bar"
+  },
   "name": "cronevent",
   "state": {
     "tick": 1,
@@ -431,7 +843,11 @@ test rule - Handling request: {
   }
 }
 test rule - Handling request: {
+  "cascade": {},
   "kind": "foo.bar",
+  "kindparams": {
+    "1": "bar"
+  },
   "name": "cronevent",
   "state": {
     "tick": 2,
@@ -440,7 +856,11 @@ test rule - Handling request: {
   }
 }
 test rule - Handling request: {
+  "cascade": {},
   "kind": "foo.bar",
+  "kindparams": {
+    "1": "bar"
+  },
   "name": "cronevent",
   "state": {
     "tick": 3,
@@ -482,7 +902,16 @@ setPulseTrigger(100, "pulseevent", "foo.bar")
 	}
 
 	time.Sleep(100 * time.Millisecond)
-	testprocessor.Finish()
+
+	// The pulse trigger stops when the processor shuts down
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := testprocessor.Shutdown(ctx); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
 
 	if !strings.Contains(testlogger.String(), "Handling request") {
 		t.Error("Unexpected result:", testlogger.String())
@@ -490,6 +919,515 @@ setPulseTrigger(100, "pulseevent", "foo.bar")
 	}
 }
 
+func TestVirtualClockTriggers(t *testing.T) {
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+	clock := engine.NewVirtualClock(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	erp.SetClock(clock)
+
+	_, err := UnitTestEvalWithRuntimeProvider(
+		`
+sink test
+  kindmatch [ "foo.*" ],
+{
+	log(event.name, " ", event.state.tick)
+}
+
+setPulseTrigger(1000000, "pulse", "foo.pulse")
+setCronTrigger("0 30 * * * *", "cron", "foo.cron")
+`, nil, erp)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Unit tests replace the cron object
+
+	erp.SetClock(clock)
+
+	clock.WaitTimers(1)
+	clock.Advance(time.Second)
+	clock.WaitTimers(1)
+
+	if res := erp.FireCronTriggers(); res != 0 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	clock.Advance(30*time.Minute - time.Second)
+	clock.WaitTimers(1)
+
+	if res := erp.FireCronTriggers(); res != 1 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := erp.Processor.Shutdown(context.Background()); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := testlogger.String(); res != `
+pulse 1
+pulse 2
+cron 1`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestAddEventAfter(t *testing.T) {
+
+	for code, msg := range map[string]string{
+		`addEventAfter("test", "foo", "bar", {})`: "Parameter 1 should be a number",
+		`addEventAfter(1, "foo", "bar")`:          "Need at least four parameters: delay, name, kind and state",
+		`addEventAfter(1, "foo", "bar", "baz")`:   "Parameter 4 should be a map",
+		`addEventAfter(1, "foo", "bar", {}, 1)`:   "Parameter 5 should be a map",
+		`cancelEvent()`:                           "Need an event handle as parameter",
+		`cancelEvent("foo")`:                      "Parameter 1 should be a number",
+	} {
+		if res, err := UnitTestEval(code, nil); err == nil ||
+			err.Error() != fmt.Sprintf("ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (%v) (Line:1 Pos:1)", msg) {
+			t.Error("Unexpected result: ", code, res, err)
+			return
+		}
+	}
+
+	_, err := UnitTestEval(
+		`
+sink test
+  kindmatch [ "foo.*" ],
+{
+	log("Handling: ", event.name)
+}
+
+addEventAfter(0.05, "delayed1", "foo.bar", {})
+h := addEventAfter(0.05, "delayed2", "foo.bar", {})
+log("Cancelled: ", cancelEvent(h))
+log("Cancelled: ", cancelEvent(h))
+addEventAndWait("direct", "foo.bar", {})
+`, nil)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	testprocessor.Finish()
+
+	if testlogger.String() != `
+Cancelled: true
+Cancelled: false
+Handling: direct
+Handling: delayed1`[1:] {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+}
+
+func TestAddEvents(t *testing.T) {
+
+	for code, msg := range map[string]string{
+		`addEvents()`:                   "Need a list of events as parameter",
+		`addEvents("foo")`:              "Parameter 1 should be a list",
+		`addEvents(["foo"])`:            "Parameter 1 should be a map",
+		`addEvents([{"state": 1}])`:     "State of event 1 should be a map",
+		`addEvents([{"state": {}}], 1)`: "Parameter 2 should be a map",
+	} {
+		if res, err := UnitTestEval(code, nil); err == nil ||
+			err.Error() != fmt.Sprintf("ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (%v) (Line:1 Pos:1)", msg) {
+			t.Error("Unexpected result: ", code, res, err)
+			return
+		}
+	}
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+handled := 0
+
+sink fan
+    kindmatch [ "fan" ],
+	{
+        events := []
+        for i in range(1, 100) {
+            events := add(events, {"name": "child", "kind": "child", "state": {"i": i}})
+        }
+        addEvents(events)
+	}
+
+sink child
+    kindmatch [ "child" ],
+	{
+        atomicAdd("handled", event.state.i)
+	}
+
+addEventAndWait("fan", "fan", {})
+result1 := handled
+
+addEvents([{"name": "a", "kind": "child", "state": {"i": 1}}], {"": true})
+addEvents([{"name": "b", "kind": "child"}])
+`, vs)
+
+	errorutil.AssertOk(err)
+
+	testprocessor.Finish()
+
+	obj := scope.ToObject(vs)
+
+	if res := fmt.Sprint(obj["result1"], " ", obj["handled"]); res != "5050 5051" {
+		t.Error("Unexpected result:", res, testlogger.String())
+		return
+	}
+}
+
+func TestGetCascade(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+sink r1
+    kindmatch [ "root" ],
+	{
+        addEvent("child", "child", {})
+	}
+
+sink r2
+    kindmatch [ "child" ],
+	{
+        c := getCascade()
+        log("root: ", c.event.name, " ", c.rules[0], " ", c.activated != null)
+        log("child: ", c.children[0].event.name, " ", c.children[0].rules[0], " ", c.children[0].finished)
+        raise("MyError", "foo")
+	}
+
+res := addEventAndWait("root", "root", {})
+log("outside: ", getCascade())
+`, vs)
+
+	if err != nil || testlogger.String() != `
+root: root r1 true
+child: child r2 null
+outside: null`[1:] {
+		t.Error("Unexpected result:", testlogger.String(), err)
+		return
+	}
+
+	if res := fmt.Sprint(scope.ToObject(vs)["res"]); res != "[map[errors:map[r2:map[data:<nil> detail:foo error:ECAL error in ECALTestRuntime (ECALEvalTest): MyError (foo) (Line:14 Pos:9) type:MyError]] event:map[kind:child name:child state:map[]] results:map[]]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestSinkSettings(t *testing.T) {
+
+	for code, msg := range map[string]string{
+		`setSinkEnabled("foo")`:         "Need a sink name and an enabled flag as parameters",
+		`setSinkEnabled("foo", "bar")`:  "Parameter 2 should be a boolean",
+		`setSinkEnabled("foo", false)`:  "Unknown rule: foo",
+		`setSinkPriority("foo")`:        "Need a sink name and a priority as parameters",
+		`setSinkPriority("foo", "bar")`: "Parameter 2 should be a number",
+		`setSinkPriority("foo", 1)`:     "Unknown rule: foo",
+	} {
+		if res, err := UnitTestEval(code, nil); err == nil ||
+			err.Error() != fmt.Sprintf("ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (%v) (Line:1 Pos:1)", msg) {
+			t.Error("Unexpected result: ", code, res, err)
+			return
+		}
+	}
+
+	_, err := UnitTestEval(
+		`
+sink rule1
+  kindmatch [ "foo.*" ],
+  suppresses [ "rule3" ],
+{
+	log("rule1")
+}
+
+sink rule2
+  kindmatch [ "foo.*" ],
+  priority 1,
+{
+	log("rule2")
+}
+
+sink rule3
+  kindmatch [ "foo.*" ],
+  priority 2,
+{
+	log("rule3")
+}
+
+addEventAndWait("test", "foo.bar", {})
+setSinkEnabled("rule1", false)
+addEventAndWait("test", "foo.bar", {})
+setSinkPriority("rule3", 0)
+addEventAndWait("test", "foo.bar", {})
+setSinkEnabled("rule1", true)
+addEventAndWait("test", "foo.bar", {})
+`, nil)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if testlogger.String() != `
+rule1
+rule2
+rule2
+rule3
+rule3
+rule2
+rule1
+rule2`[1:] {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+}
+
+func TestDynamicSinks(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	for code, msg := range map[string]string{
+		`addSink("foo", [], {})`:                                  "Need a sink name, a kind match list, a state match map and a function as parameters",
+		`addSink("foo", [], {}, 1)`:                               "Parameter 4 should be a function",
+		`func f() {}; addSink("foo", "a", {}, f)`:                 "Parameter 2 should be a list",
+		`func f() {}; addSink("foo", ["a"], 1, f)`:                "Parameter 3 should be a map",
+		`func f() {}; addSink("foo", ["a"], {"a": {"~" : 1}}, f)`: "Invalid state condition for a: Unknown state condition operator: ~",
+		`func f() {}; addSink("foo", [], null, f)`:                "Cannot add rule without a kind match: foo",
+		`removeSink()`:      "Need a sink name as parameter",
+		`removeSink("foo")`: "Unknown rule: foo",
+	} {
+		if res, err := UnitTestEval(code, nil); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("Runtime error (%v)", msg)) {
+			t.Error("Unexpected result: ", code, res, err)
+			return
+		}
+	}
+
+	_, err := UnitTestEval(
+		`
+config := [
+  {"name" : "high", "kind" : "sensor.*", "limit" : 30},
+  {"name" : "low", "kind" : "sensor.temp", "limit" : 10}
+]
+
+func makeHandler(name) {
+  return func(event) {
+    log(name, ": ", event.name, " ", event.kind, " ", event.state.temp)
+  }
+}
+
+for c in config {
+  addSink(c.name, [c.kind], {"temp" : {">" : c.limit}}, makeHandler(c.name))
+}
+
+addEventAndWait("e1", "sensor.temp", {"temp" : 35})
+addEventAndWait("e2", "sensor.temp", {"temp" : 20})
+
+removeSink("high")
+
+func fail(event) {
+  raise("MyError", "foo")
+}
+
+addSink("all", ["sensor.*"], null, fail)
+
+res := addEventAndWait("e3", "sensor.temp", {"temp" : 35})
+`, vs)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if testlogger.String() != `
+high: e1 sensor.temp 35
+low: e1 sensor.temp 35
+low: e2 sensor.temp 20`[1:] {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+
+	// Errors are reported like errors of declared sinks
+
+	if res := fmt.Sprint(scope.ToObject(vs)["res"]); !strings.Contains(res, "errors:map[all:map[data:<nil> detail:foo error:ECAL error in ECALTestRuntime (ECALEvalTest): MyError (foo) (Line:23 Pos:3) type:MyError]]") {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestListSinks(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+/*
+Handles temperature readings
+*/
+sink temp
+    kindmatch [ "sensor.temp" ],
+    scopematch [ "sensor.read" ],
+    statematch { "temp" : { ">" : 30 }, "unit" : "C" },
+    priority 2,
+    suppresses [ "all" ],
+	{
+	}
+
+func f(event) {}
+
+addSink("all", ["sensor.*"], null, f)
+
+setSinkEnabled("all", false)
+setSinkPriority("temp", 5)
+
+res := listSinks()
+`, vs)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := fmt.Sprint(scope.ToObject(vs)["res"]); res != "[map[desc: enabled:false kindmatch:[sensor.*] name:all priority:0 scopematch:[] statematch:map[] suppresses:[]] "+
+		"map[desc:Handles temperature readings enabled:true kindmatch:[sensor.temp] name:temp priority:5 scopematch:[sensor.read] statematch:map[temp:map[>:30] unit:C] suppresses:[all]]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestWhichSinks(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink temp
+    kindmatch [ "sensor.temp" ],
+    statematch { "temp" : { ">" : 30 } },
+    priority 2,
+	{
+        log("temp")
+	}
+
+sink read
+    kindmatch [ "sensor.*" ],
+    scopematch [ "sensor.read" ],
+    priority 1,
+	{
+        log("read")
+	}
+
+sink all
+    kindmatch [ "sensor.*" ],
+    priority 3,
+	{
+        log("all")
+	}
+
+res1 := whichSinks("sensor.temp", { "temp" : 35 })
+res2 := whichSinks("sensor.temp", { "temp" : 25 }, { "sensor" : false })
+res3 := whichSinks("foo", {})
+`, vs)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := fmt.Sprint(scope.ToObject(vs)["res1"], scope.ToObject(vs)["res2"],
+		scope.ToObject(vs)["res3"]); res != "[read temp all] [all] []" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if testlogger.String() != "" {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+
+	_, err = UnitTestEval(`whichSinks("foo")`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Need at least two parameters: kind and state) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(`whichSinks("foo", {}, 1)`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Parameter 3 should be a map) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestInvokeSink(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink price
+    kindmatch [ "order.{type}" ],
+    statematch { "amount" : { ">" : 100 } },
+	{
+        log("price ", event.name, " ", event.kind, " ", event.kindparams.type)
+        if event.state.amount < 0 {
+            raise("InvalidAmount", "Negative amount", event.state.amount)
+        }
+        return event.state.amount * 2
+	}
+
+sink nothing
+    kindmatch [ "foo" ],
+	{
+	}
+
+res1 := invokeSink("price", { "amount" : 5 })
+res2 := invokeSink("price", { "amount" : 6 }, "order.express")
+res3 := invokeSink("nothing", {})
+res4 := null
+
+try {
+    invokeSink("price", { "amount" : -1 })
+} except "InvalidAmount" as e {
+    res4 := e.data
+}
+`, vs)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	obj := scope.ToObject(vs)
+
+	if res := fmt.Sprint(obj["res1"], " ", obj["res2"], " ", obj["res3"], " ", obj["res4"]); res != "10 12 <nil> -1" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if testlogger.String() != `
+price price order.{type} {type}
+price price order.express express
+price price order.{type} {type}`[1:] {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+
+	for code, msg := range map[string]string{
+		`invokeSink("foo")`:     "Need at least two parameters: name and state",
+		`invokeSink("foo", 1)`:  "Parameter 2 should be a map",
+		`invokeSink("foo", {})`: "Unknown sink: foo",
+	} {
+		if res, err := UnitTestEval(code, nil); err == nil ||
+			err.Error() != fmt.Sprintf("ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (%v) (Line:1 Pos:1)", msg) {
+			t.Error("Unexpected result: ", code, res, err)
+			return
+		}
+	}
+}
+
 func TestDocstrings(t *testing.T) {
 	for k, v := range InbuildFuncMap {
 		if res, _ := v.DocString(); res == "" {
@@ -531,3 +1469,83 @@ func TestErrorConditions(t *testing.T) {
 	}
 
 }
+
+func TestCircuitBreaker(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+sink payment
+    kindmatch [ "payment" ],
+	{
+        if event.state.fail {
+            raise("Unavailable", "Payment service is down")
+        }
+	}
+
+sink breakerWatch
+    kindmatch [ "circuit.*" ],
+	{
+        log("{{event.kind}} {{event.name}} {{event.state.rule}} {{event.state.failures}}")
+	}
+
+cb := circuitBreaker("payments", { "sinks" : [ "payment" ], "failures" : 2, "cooldown" : 50ms })
+
+addEventAndWait("pay", "payment", { "fail" : true })
+addEventAndWait("pay", "payment", { "fail" : true })
+res := addEventAndWait("pay", "payment", { "fail" : false })
+state := circuitBreaker("payments")
+
+sleep(60ms)
+
+addEventAndWait("pay", "payment", { "fail" : false })
+state2 := circuitBreaker("payments")
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	obj := scope.ToObject(vs)
+	res := obj["res"].([]interface{})[0].(map[interface{}]interface{})["errors"]
+
+	if res := fmt.Sprint(obj["cb"], " ", res); res !=
+		"map[cooldown:0.05 failures:0 name:payments sinks:[payment] state:closed threshold:2] map[payment:map[error:Circuit breaker is open: payments]]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(obj["state"].(map[interface{}]interface{})["state"], " ",
+		obj["state2"].(map[interface{}]interface{})["state"]); res != "open closed" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := testlogger.String(); res != `
+circuit.open payments payment 2
+circuit.close payments payment 0`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	_, err = UnitTestEval(`circuitBreaker("foo")`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Unknown circuit breaker: foo) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(`circuitBreaker("foo", { "sinks" : [ "bar" ] })`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Unknown rule: bar) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(`circuitBreaker("foo", { "failures" : 0 })`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Option sinks should be a list of sink names) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/krotik/common/stringutil"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/stdlib"
+)
+
+/*
+GoObject is a bridge which exposes a Go struct to ECAL. Field reads and writes
+as well as method calls are reflected onto the Go value. Nested structs are
+exposed as GoObjects as well.
+*/
+type GoObject struct {
+	value reflect.Value // Pointer to the bridged struct
+}
+
+/*
+NewGoObject creates a new bridge for a given pointer to a Go struct.
+*/
+func NewGoObject(obj interface{}) (*GoObject, error) {
+	rv := reflect.ValueOf(obj)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Go object must be a pointer to a struct (got %T)", obj)
+	}
+
+	return &GoObject{rv}, nil
+}
+
+/*
+RegisterGoObject exposes a Go struct as a variable in a given scope. The
+object must be a pointer to a struct.
+*/
+func (erp *ECALRuntimeProvider) RegisterGoObject(vs parser.Scope, name string, obj interface{}) error {
+	goObj, err := NewGoObject(obj)
+
+	if err == nil {
+		err = vs.SetValue(name, goObj)
+	}
+
+	return err
+}
+
+/*
+Value returns the bridged Go value.
+*/
+func (g *GoObject) Value() interface{} {
+	return g.value.Interface()
+}
+
+/*
+field returns a field of the bridged struct by its ECAL name (the name of the
+field or the name given in its json tag).
+*/
+func (g *GoObject) field(name string) (reflect.Value, bool) {
+	st := g.value.Elem().Type()
+
+	for i := 0; i < st.NumField(); i++ {
+		if fname, ok := scope.StructFieldName(st.Field(i)); ok && fname == name {
+			return g.value.Elem().Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+/*
+GetField returns the value of a field or a method of the bridged struct.
+*/
+func (g *GoObject) GetField(name string) (interface{}, bool, error) {
+
+	if f, ok := g.field(name); ok {
+
+		// Nested structs are bridged so changes are reflected on the Go value
+
+		if f.Kind() == reflect.Struct {
+			return &GoObject{f.Addr()}, true, nil
+		} else if f.Kind() == reflect.Ptr && !f.IsNil() && f.Elem().Kind() == reflect.Struct {
+			return &GoObject{f}, true, nil
+		}
+
+		return scope.ConvertGoToECALObject(f.Interface()), true, nil
+	}
+
+	if m := g.value.MethodByName(name); m.IsValid() {
+		return stdlib.NewECALFunctionAdapter(m, fmt.Sprintf("Method %v of %v",
+			name, g.value.Elem().Type())), true, nil
+	}
+
+	return nil, false, nil
+}
+
+/*
+SetField sets the value of a field of the bridged struct.
+*/
+func (g *GoObject) SetField(name string, value interface{}) error {
+	f, ok := g.field(name)
+
+	if !ok {
+		return fmt.Errorf("Go object %v has no field %v", g.value.Elem().Type(), name)
+	}
+
+	if goObj, ok := value.(*GoObject); ok {
+		value = goObj.Value()
+
+		if f.Kind() == reflect.Struct {
+			value = goObj.value.Elem().Interface()
+		}
+
+		if rv := reflect.ValueOf(value); rv.Type().AssignableTo(f.Type()) {
+			f.Set(rv)
+			return nil
+		}
+	}
+
+	return scope.ConvertECALToGoObject(value, f.Addr().Interface())
+}
+
+/*
+FieldNames returns the names of all fields of the bridged struct.
+*/
+func (g *GoObject) FieldNames() []string {
+	var names []string
+
+	st := g.value.Elem().Type()
+
+	for i := 0; i < st.NumField(); i++ {
+		if name, ok := scope.StructFieldName(st.Field(i)); ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+/*
+String returns a string representation of this Go object.
+*/
+func (g *GoObject) String() string {
+	return stringutil.ConvertToString(scope.ConvertGoToECALObject(g.Value()))
+}
+
+/*
+MarshalJSON returns a JSON representation of the fields of this Go object.
+*/
+func (g *GoObject) MarshalJSON() ([]byte, error) {
+	return json.Marshal(stringutil.ConvertToJSONMarshalableObject(
+		scope.ConvertGoToECALObject(g.Value())))
+}
@@ -0,0 +1,147 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/krotik/ecal/scope"
+)
+
+type testAddress struct {
+	City string
+}
+
+type testCounter struct {
+	Name    string `json:"name"`
+	Count   int    `json:"count"`
+	Tags    []string
+	Address testAddress
+	Parent  *testCounter
+	secret  int
+}
+
+func (c *testCounter) Inc(n int) int {
+	c.Count += n
+	return c.Count
+}
+
+func TestGoObject(t *testing.T) {
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+	vs := scope.NewScope(scope.GlobalScope)
+
+	counter := &testCounter{Name: "foo", Count: 1, Parent: &testCounter{Name: "bar"}}
+
+	if err := erp.RegisterGoObject(vs, "obj", counter); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	res, err := UnitTestEvalWithRuntimeProvider(`
+obj.count := obj.count + 1
+obj.name := "{{obj.name}}x"
+obj.Tags := ["a", "b"]
+obj.Address.City := "Berlin"
+obj.Parent.count := 5
+obj.Inc(10)
+`, vs, erp)
+
+	if err != nil || res != 12. {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if counter.Count != 12 || counter.Name != "foox" || fmt.Sprint(counter.Tags) != "[a b]" ||
+		counter.Address.City != "Berlin" || counter.Parent.Count != 5 {
+		t.Error("Unexpected result:", counter)
+		return
+	}
+
+	res, err = UnitTestEvalWithRuntimeProvider(`
+result := []
+for f in obj.Tags {
+  result := add(result, f)
+}
+[result, obj.Address.City, obj.Parent.name, obj.secret]
+`, vs, erp)
+
+	if err != nil || fmt.Sprint(res) != "[[a b] Berlin bar <nil>]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Go objects can be assigned to other Go objects
+
+	if _, err = UnitTestEvalWithRuntimeProvider(`obj.Parent := obj.Parent.Parent`, vs, erp); err != nil ||
+		counter.Parent != nil {
+		t.Error("Unexpected result:", counter, err)
+		return
+	}
+
+	if _, err = UnitTestEvalWithRuntimeProvider(`
+obj.Parent := obj
+obj.Parent.Address := {"City" : "Paris"}
+`, vs, erp); err != nil || counter.Parent != counter || counter.Address.City != "Paris" {
+		t.Error("Unexpected result:", counter, err)
+		return
+	}
+	counter.Parent = nil
+
+	goObj, _, _ := vs.GetValue("obj")
+
+	if res := fmt.Sprint(goObj.(*GoObject).FieldNames()); res != "[Address Parent Tags count name]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := goObj.(*GoObject).String(); res != `{"Address":{"City":"Paris"},"Parent":null,"Tags":["a","b"],"count":12,"name":"foox"}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res, err := json.Marshal(goObj); err != nil || string(res) != `{"Address":{"City":"Paris"},"Parent":null,"Tags":["a","b"],"count":12,"name":"foox"}` {
+		t.Error("Unexpected result:", string(res), err)
+		return
+	}
+
+	if goObj.(*GoObject).Value() != counter {
+		t.Error("Unexpected result:", goObj)
+		return
+	}
+
+	// Test error cases
+
+	if err := erp.RegisterGoObject(vs, "obj2", *counter); err == nil ||
+		err.Error() != "Go object must be a pointer to a struct (got interpreter.testCounter)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = UnitTestEvalWithRuntimeProvider(`obj.foo := 1`, vs, erp); err == nil ||
+		err.Error() != "Go object interpreter.testCounter has no field foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = UnitTestEvalWithRuntimeProvider(`obj.count := "a"`, vs, erp); err == nil ||
+		err.Error() != "Cannot convert a (type string) into int (value)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = UnitTestEvalWithRuntimeProvider(`obj.foo.bar := 1`, vs, erp); err == nil ||
+		err.Error() != "Variable obj.foo is not a container" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
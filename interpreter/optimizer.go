@@ -0,0 +1,154 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package interpreter
+
+import (
+	"strings"
+
+	"github.com/krotik/ecal/config"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+)
+
+/*
+foldableNodes are all operators which can be evaluated during validation if
+all their operands are constant.
+*/
+var foldableNodes = map[string]bool{
+	parser.NodePLUS:      true,
+	parser.NodeMINUS:     true,
+	parser.NodeTIMES:     true,
+	parser.NodeDIV:       true,
+	parser.NodeDIVINT:    true,
+	parser.NodeMODINT:    true,
+	parser.NodeGEQ:       true,
+	parser.NodeLEQ:       true,
+	parser.NodeNEQ:       true,
+	parser.NodeEQ:        true,
+	parser.NodeGT:        true,
+	parser.NodeLT:        true,
+	parser.NodeAND:       true,
+	parser.NodeOR:        true,
+	parser.NodeNOT:       true,
+	parser.NodeLIKE:      true,
+	parser.NodeHASPREFIX: true,
+	parser.NodeHASSUFFIX: true,
+	parser.NodeTERNARY:   true,
+	parser.NodeCOALESCE:  true,
+}
+
+/*
+optimizing returns if code should be optimized during validation. Optimized
+code skips the evaluation of some nodes - the optimizer is therefore not used
+if a debugger or profiler is attached.
+*/
+func (erp *ECALRuntimeProvider) optimizing() bool {
+	return erp.Debugger == nil && erp.Profiler == nil && config.Bool(config.Optimize)
+}
+
+/*
+constantValue returns the value of a validated node if the node is a constant.
+*/
+func constantValue(node *parser.ASTNode) (interface{}, bool) {
+	switch rt := node.Runtime.(type) {
+	case *numberValueRuntime:
+		return rt.numValue, true
+	case *stringValueRuntime:
+
+		// Strings with interpolation are not constant
+
+		if !node.Token.AllowEscapes || !strings.Contains(node.Token.Val, "{{") {
+			return node.Token.Val, true
+		}
+	case *trueRuntime:
+		return true, true
+	case *falseRuntime:
+		return false, true
+	case *nullRuntime:
+		return nil, true
+	case *constantRuntime:
+		return rt.value, true
+	}
+
+	return nil, false
+}
+
+/*
+foldConstant replaces the runtime of a validated operator node with its value
+if all operands are constant. Operators which return an error or a value which
+is not a simple value are not replaced (errors should be raised when the code
+is executed).
+*/
+func foldConstant(erp *ECALRuntimeProvider, node *parser.ASTNode) {
+
+	if !foldableNodes[node.Name] {
+		return
+	}
+
+	for _, c := range node.Children {
+		if _, ok := constantValue(c); !ok {
+			return
+		}
+	}
+
+	res, err := node.Runtime.Eval(scope.NewScope(scope.GlobalScope), make(map[string]interface{}), 0)
+
+	if err == nil {
+		switch res.(type) {
+		case nil, bool, float64, string:
+			crt := &constantRuntime{newBaseRuntime(erp, node), res}
+			crt.validated = true
+			node.Runtime = crt
+		}
+	}
+}
+
+/*
+constantRuntime is the runtime component for an operator which has been
+evaluated during validation.
+*/
+type constantRuntime struct {
+	*baseRuntime
+	value interface{} // Value of the operator
+}
+
+/*
+Eval evaluate this runtime component.
+*/
+func (rt *constantRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint64) (interface{}, error) {
+	_, err := rt.baseRuntime.Eval(vs, is, tid)
+	return rt.value, err
+}
+
+/*
+flattenStatements returns the statements which need to be evaluated for a
+given statements node. Nested statements are flattened and constant statements
+are removed (except the last one which is the result of the statements).
+*/
+func flattenStatements(node *parser.ASTNode) []*parser.ASTNode {
+	var res []*parser.ASTNode
+
+	for i, c := range node.Children {
+
+		if c.Name == parser.NodeSTATEMENTS {
+			if _, ok := c.Runtime.(*statementsRuntime); ok {
+				res = append(res, flattenStatements(c)...)
+				continue
+			}
+		}
+
+		if _, ok := constantValue(c); !ok || i == len(node.Children)-1 {
+			res = append(res, c)
+		}
+	}
+
+	return res
+}
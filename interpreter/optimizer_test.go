@@ -0,0 +1,121 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/krotik/ecal/config"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+)
+
+func TestOptimizer(t *testing.T) {
+
+	parse := func(code string) (*parser.ASTNode, parser.Scope, error) {
+		erp := NewECALRuntimeProvider("ECALOptimizerTest", nil, nil)
+		vs := scope.NewScope(scope.GlobalScope)
+
+		ast, err := parser.ParseWithRuntime("ECALOptimizerTest", code, erp)
+
+		if err == nil {
+			if err = ast.Runtime.Validate(); err == nil {
+				_, err = ast.Runtime.Eval(vs, make(map[string]interface{}), erp.Processor.ThreadPool().NewThreadID())
+			}
+		}
+
+		return ast, vs, err
+	}
+
+	ast, vs, err := parse(`
+a := 1 + 2 * -3
+b := a + 2 * 3
+c := not (1 < 2 and "foo" like "^f") ? "x" : "y"
+d := "{{a}}" + 1
+`)
+
+	if err == nil || err.Error() != "ECAL error in ECALOptimizerTest (ECALOptimizerTest): Operand is not a number ({{a}}) (Line:5 Pos:6)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := fmt.Sprint(scope.ToObject(vs)); res != "map[a:-5 b:1 c:y]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Only constant expressions are folded
+
+	for i, expected := range []string{"*interpreter.constantRuntime", "*interpreter.plusOpRuntime",
+		"*interpreter.constantRuntime", "*interpreter.plusOpRuntime"} {
+
+		if res := fmt.Sprintf("%T", ast.Children[i].Children[1].Runtime); res != expected {
+			t.Error("Unexpected result:", i, res)
+			return
+		}
+	}
+
+	if res := fmt.Sprintf("%T", ast.Children[1].Children[1].Children[1].Runtime); res != "*interpreter.constantRuntime" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Constant statements are not evaluated (except the last one)
+
+	ast, _, err = parse(`
+1
+"foo"
+a := 1
+2 + 3
+`)
+
+	if res := len(ast.Runtime.(*statementsRuntime).statements); err != nil || res != 2 {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Calls of stdlib and inbuild functions are resolved during validation -
+	// variables still take precedence
+
+	ast, vs, err = parse(`
+a := len([1, 2])
+b := math.floor(1.5)
+func len(x) {
+  return 5
+}
+c := len([1, 2])
+`)
+
+	if res := fmt.Sprint(scope.ToObject(vs)["a"], scope.ToObject(vs)["b"], scope.ToObject(vs)["c"]); err != nil || res != "2 1 5" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := ast.Children[1].Children[1].Runtime.(*identifierRuntime).funcName; res != "math.floor" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// The optimizer can be switched off
+
+	config.Config[config.Optimize] = false
+	defer func() {
+		config.Config[config.Optimize] = true
+	}()
+
+	ast, _, err = parse(`a := 1 + 2`)
+
+	if res := fmt.Sprintf("%T", ast.Children[1].Runtime); err != nil || res != "*interpreter.plusOpRuntime" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
@@ -0,0 +1,299 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package interpreter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krotik/ecal/parser"
+)
+
+/*
+Profiler collects execution time statistics per function and per source line.
+A profiler is enabled by setting it on an ECALRuntimeProvider.
+*/
+type Profiler struct {
+	functions map[string]*ProfileEntry        // Statistics of functions and sinks
+	lines     map[string]*ProfileEntry        // Statistics of source lines
+	stacks    map[string]time.Duration        // Exclusive time of call stacks (for flame graphs)
+	threads   map[uint64]*profilerThreadState // Current state of all profiled threads
+	lock      *sync.Mutex                     // Lock for the profiler
+}
+
+/*
+ProfileEntry contains the statistics of a function or a source line. The
+inclusive time of a function contains the time spent in called functions,
+the exclusive time does not. For source lines both times are the same.
+*/
+type ProfileEntry struct {
+	Name      string        // Function name or source line (<source>:<line>)
+	Count     int64         // Number of calls or line visits
+	Inclusive time.Duration // Inclusive time
+	Exclusive time.Duration // Exclusive time
+}
+
+/*
+profilerFrame is a function call of a profiled thread.
+*/
+type profilerFrame struct {
+	name      string        // Name of the called function
+	start     time.Time     // Start time of the call
+	childTime time.Duration // Time spent in called functions
+}
+
+/*
+profilerThreadState contains the current state of a profiled thread.
+*/
+type profilerThreadState struct {
+	stack     []*profilerFrame // Current call stack of the thread
+	active    map[string]int   // Number of active calls of each function (for recursion)
+	line      string           // Line which is currently executed
+	lineStart time.Time        // Time when the execution of the current line started
+}
+
+/*
+NewProfiler returns a new profiler object.
+*/
+func NewProfiler() *Profiler {
+	return &Profiler{
+		functions: make(map[string]*ProfileEntry),
+		lines:     make(map[string]*ProfileEntry),
+		stacks:    make(map[string]time.Duration),
+		threads:   make(map[uint64]*profilerThreadState),
+		lock:      &sync.Mutex{},
+	}
+}
+
+/*
+Reset removes all collected statistics.
+*/
+func (p *Profiler) Reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.functions = make(map[string]*ProfileEntry)
+	p.lines = make(map[string]*ProfileEntry)
+	p.stacks = make(map[string]time.Duration)
+	p.threads = make(map[uint64]*profilerThreadState)
+}
+
+/*
+threadState returns the state of a given thread. This function assumes that
+the lock is held.
+*/
+func (p *Profiler) threadState(tid uint64) *profilerThreadState {
+	ts, ok := p.threads[tid]
+
+	if !ok {
+		ts = &profilerThreadState{nil, make(map[string]int), "", time.Time{}}
+		p.threads[tid] = ts
+	}
+
+	return ts
+}
+
+/*
+switchLine attributes the elapsed time to the current line of a thread and
+sets a new current line. The visit of the new line is only counted if the
+visit flag is set. This function assumes that the lock is held.
+*/
+func (p *Profiler) switchLine(ts *profilerThreadState, line string, now time.Time, visit bool) {
+	if ts.line != "" {
+		entry := p.lines[ts.line]
+		elapsed := now.Sub(ts.lineStart)
+
+		entry.Inclusive += elapsed
+		entry.Exclusive += elapsed
+	}
+
+	if line != "" {
+		entry, ok := p.lines[line]
+
+		if !ok {
+			entry = &ProfileEntry{Name: line}
+			p.lines[line] = entry
+		}
+
+		if visit {
+			entry.Count++
+		}
+	}
+
+	ts.line = line
+	ts.lineStart = now
+}
+
+/*
+VisitState is called for every state during the execution of a program.
+*/
+func (p *Profiler) VisitState(node *parser.ASTNode, tid uint64) {
+	if node.Token == nil {
+		return
+	}
+
+	line := fmt.Sprintf("%v:%v", node.Token.Lsource, node.Token.Lline)
+	now := time.Now()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if ts := p.threadState(tid); ts.line != line {
+		p.switchLine(ts, line, now, true)
+	}
+}
+
+/*
+StepIn is called before entering a function call or a sink.
+*/
+func (p *Profiler) StepIn(name string, tid uint64) {
+	now := time.Now()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	ts := p.threadState(tid)
+
+	ts.stack = append(ts.stack, &profilerFrame{name, now, 0})
+	ts.active[name]++
+}
+
+/*
+StepOut is called after returning from a function call or a sink. The given
+node is the node of the function call (nil for sinks).
+*/
+func (p *Profiler) StepOut(node *parser.ASTNode, tid uint64) {
+	now := time.Now()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	ts := p.threadState(tid)
+
+	if len(ts.stack) == 0 {
+		return
+	}
+
+	// Execution continues on the line of the function call - after a sink
+	// has finished the thread is no longer executing any line
+
+	line := ""
+	if node != nil && node.Token != nil {
+		line = fmt.Sprintf("%v:%v", node.Token.Lsource, node.Token.Lline)
+	}
+
+	p.switchLine(ts, line, now, false)
+
+	frame := ts.stack[len(ts.stack)-1]
+	total := now.Sub(frame.start)
+	exclusive := total - frame.childTime
+
+	var names []string
+	for _, f := range ts.stack {
+		names = append(names, f.name)
+	}
+	p.stacks[strings.Join(names, ";")] += exclusive
+
+	ts.stack = ts.stack[:len(ts.stack)-1]
+	ts.active[frame.name]--
+
+	if len(ts.stack) > 0 {
+		ts.stack[len(ts.stack)-1].childTime += total
+	}
+
+	entry, ok := p.functions[frame.name]
+
+	if !ok {
+		entry = &ProfileEntry{Name: frame.name}
+		p.functions[frame.name] = entry
+	}
+
+	entry.Count++
+	entry.Exclusive += exclusive
+
+	// Recursive calls are only counted once for the inclusive time
+
+	if ts.active[frame.name] == 0 {
+		entry.Inclusive += total
+	}
+}
+
+/*
+Functions returns the statistics of all functions and sinks ordered by their
+exclusive time (highest first).
+*/
+func (p *Profiler) Functions() []ProfileEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return sortedProfileEntries(p.functions)
+}
+
+/*
+Lines returns the statistics of all source lines ordered by their time
+(highest first).
+*/
+func (p *Profiler) Lines() []ProfileEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return sortedProfileEntries(p.lines)
+}
+
+/*
+sortedProfileEntries returns a sorted copy of a map of profile entries.
+*/
+func sortedProfileEntries(entries map[string]*ProfileEntry) []ProfileEntry {
+	res := make([]ProfileEntry, 0, len(entries))
+
+	for _, e := range entries {
+		res = append(res, *e)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Exclusive == res[j].Exclusive {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].Exclusive > res[j].Exclusive
+	})
+
+	return res
+}
+
+/*
+Folded returns the exclusive time (in microseconds) of all recorded call
+stacks in the folded stack format which is used by flame graph tools
+(e.g. flamegraph.pl or speedscope). Each line contains a call stack with
+semicolon separated function names followed by the time.
+*/
+func (p *Profiler) Folded() string {
+	var buf bytes.Buffer
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	stacks := make([]string, 0, len(p.stacks))
+	for s := range p.stacks {
+		stacks = append(stacks, s)
+	}
+
+	sort.Strings(stacks)
+
+	for _, s := range stacks {
+		buf.WriteString(fmt.Sprintf("%v %v\n", s, p.stacks[s].Microseconds()))
+	}
+
+	return buf.String()
+}
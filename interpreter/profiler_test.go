@@ -0,0 +1,122 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfiler(t *testing.T) {
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+	erp.Profiler = NewProfiler()
+
+	_, err := UnitTestEvalWithRuntimeProvider(`
+func fib(n) {
+  if n < 2 {
+    return n
+  }
+  return fib(n - 1) + fib(n - 2)
+}
+
+sink slow
+  kindmatch [ "foo" ],
+{
+  log(fib(5))
+  sleep(5ms)
+}
+
+addEventAndWait("myevent", "foo", {})
+`, nil, erp)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if testlogger.String() != "5" {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+
+	funcs := make(map[string]ProfileEntry)
+
+	for _, e := range erp.Profiler.Functions() {
+		funcs[e.Name] = e
+	}
+
+	if res := fmt.Sprint(funcs["fib"].Count, funcs["sleep"].Count, funcs["sink slow"].Count,
+		funcs["addEventAndWait"].Count); res != "15 1 1 1" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// The sink includes the sleep and fib calls but has little exclusive time
+
+	if s := funcs["sink slow"]; s.Inclusive < 5*time.Millisecond ||
+		s.Inclusive < funcs["sleep"].Inclusive+funcs["fib"].Inclusive ||
+		s.Exclusive >= funcs["sleep"].Exclusive {
+		t.Error("Unexpected result:", s, funcs["sleep"], funcs["fib"])
+		return
+	}
+
+	// Recursive calls are only counted once for the inclusive time
+
+	if f := funcs["fib"]; f.Inclusive < f.Exclusive || f.Inclusive > funcs["sink slow"].Inclusive {
+		t.Error("Unexpected result:", f)
+		return
+	}
+
+	lines := make(map[string]ProfileEntry)
+
+	for _, e := range erp.Profiler.Lines() {
+		lines[e.Name] = e
+	}
+
+	if res := fmt.Sprint(lines["ECALEvalTest:3"].Count, lines["ECALEvalTest:6"].Count,
+		lines["ECALEvalTest:12"].Count, lines["ECALEvalTest:13"].Count); res != "15 7 1 1" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// The waiting time for the event cascade is attributed to the line
+	// which added the event
+
+	if l := erp.Profiler.Lines()[0]; l.Name != "ECALEvalTest:16" || l.Exclusive < lines["ECALEvalTest:13"].Exclusive {
+		t.Error("Unexpected result:", l)
+		return
+	}
+
+	if l := lines["ECALEvalTest:13"]; l.Exclusive < 5*time.Millisecond {
+		t.Error("Unexpected result:", l)
+		return
+	}
+
+	folded := erp.Profiler.Folded()
+
+	for _, stack := range []string{"addEventAndWait ", "sink slow ", "sink slow;fib ",
+		"sink slow;fib;fib;fib;fib;fib ", "sink slow;sleep "} {
+
+		if !strings.Contains(folded, "\n"+stack) && !strings.HasPrefix(folded, stack) {
+			t.Error("Unexpected result:", folded)
+			return
+		}
+	}
+
+	erp.Profiler.Reset()
+
+	if res := fmt.Sprint(erp.Profiler.Functions(), erp.Profiler.Lines(), erp.Profiler.Folded()); res != "[] []" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -71,6 +71,15 @@ func (rt *assignmentRuntime) Validate() error {
 			err = rt.erp.NewRuntimeError(util.ErrVarAccess,
 				"Must have a variable or list of variables on the left side of the assignment", rt.node)
 		}
+
+		// Constants cannot be assigned
+
+		for _, v := range rt.leftSide {
+			if err == nil && rt.erp.isConstant(v.node.Token.Val) {
+				err = rt.erp.NewRuntimeError(util.ErrVarAccess,
+					fmt.Sprintf("Cannot assign to constant %v", v.node.Token.Val), rt.node)
+			}
+		}
 	}
 
 	return err
@@ -212,3 +221,139 @@ func (rt *letRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint6
 
 	return res, err
 }
+
+/*
+constRuntime is the runtime component for constant declarations.
+*/
+type constRuntime struct {
+	*baseRuntime
+}
+
+/*
+constRuntimeInst returns a new runtime component instance.
+*/
+func constRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &constRuntime{newBaseRuntime(erp, node)}
+}
+
+/*
+Validate this node and all its child nodes.
+*/
+func (rt *constRuntime) Validate() error {
+	var err error
+
+	rt.validated = true
+
+	name := rt.node.Children[0].Token.Val
+	value := rt.node.Children[1]
+
+	if value.Name == parser.NodeENUM {
+
+		// Enum constants are not assignments - only their values are validated
+
+		value.Runtime.(*voidRuntime).validated = true
+
+		for _, c := range value.Children {
+			if err == nil {
+				if c.Name == parser.NodeIDENTIFIER && len(c.Children) == 0 {
+					err = c.Runtime.Validate()
+
+				} else if c.Name == parser.NodeASSIGN && c.Children[0].Name == parser.NodeIDENTIFIER &&
+					len(c.Children[0].Children) == 0 {
+
+					c.Runtime.(*assignmentRuntime).validated = true
+
+					if err = c.Children[0].Runtime.Validate(); err == nil {
+						err = c.Children[1].Runtime.Validate()
+					}
+
+				} else {
+					err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
+						"Enum constants must be simple variables with an optional value", rt.node)
+				}
+			}
+		}
+
+	} else {
+
+		err = value.Runtime.Validate()
+	}
+
+	if err == nil {
+		err = rt.node.Children[0].Runtime.Validate()
+	}
+
+	if err == nil {
+		rt.erp.constantsLock.Lock()
+		defer rt.erp.constantsLock.Unlock()
+
+		if decl, ok := rt.erp.constants[name]; ok && decl != rt.node {
+			err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
+				fmt.Sprintf("Constant %v is already declared", name), rt.node)
+		} else {
+			rt.erp.constants[name] = rt.node
+		}
+	}
+
+	return err
+}
+
+/*
+Eval evaluate this runtime component.
+*/
+func (rt *constRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint64) (interface{}, error) {
+	var val interface{}
+
+	_, err := rt.baseRuntime.Eval(vs, is, tid)
+
+	if err == nil {
+		value := rt.node.Children[1]
+
+		if value.Name == parser.NodeENUM {
+
+			// Enum constants without a value are numbered consecutively
+
+			enum := make(map[interface{}]interface{})
+			counter := float64(0)
+
+			for _, c := range value.Children {
+				var cval interface{} = counter
+
+				if c.Name == parser.NodeASSIGN {
+					if cval, err = c.Children[1].Runtime.Eval(vs, is, tid); err != nil {
+						break
+					}
+
+					if num, ok := cval.(float64); ok {
+						counter = num
+					}
+
+					c = c.Children[0]
+				}
+
+				enum[c.Token.Val] = cval
+				counter++
+			}
+
+			val = enum
+
+		} else {
+
+			val, err = value.Runtime.Eval(vs, is, tid)
+		}
+
+		if err == nil {
+
+			// Constants are always declared in the global scope
+
+			gvs := vs
+			for gvs.Parent() != nil {
+				gvs = gvs.Parent()
+			}
+
+			err = gvs.SetValue(rt.node.Children[0].Token.Val, val)
+		}
+	}
+
+	return val, err
+}
@@ -315,3 +315,65 @@ foo()`, vs)
 		return
 	}
 }
+
+func TestConstDeclaration(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	res, err := UnitTestEval(`
+func init() {
+	const MaxSize := 10 * 2
+	const Color { RED, GREEN := 5, BLUE, BLACK := "black" }
+}
+init()
+a := MaxSize + Color.BLUE
+`, vs)
+
+	if vsRes := vs.String(); err != nil || res != nil || vsRes != `GlobalScope {
+    Color (map[interface {}]interface {}) : {"BLACK":"black","BLUE":6,"GREEN":5,"RED":0}
+    MaxSize (float64) : 20
+    a (float64) : 26
+    init (*interpreter.function) : ecal.function: init (Line 2, Pos 1)
+}` {
+		t.Error("Unexpected result: ", vsRes, res, err)
+		return
+	}
+
+	res, err = UnitTestEval(`
+const MaxSize := 10
+func foo() {
+	MaxSize := 2
+}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Cannot assign to constant MaxSize) (Line:4 Pos:10)" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	res, err = UnitTestEval(`
+const Color { RED, GREEN }
+Color.RED := 1
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Cannot assign to constant Color) (Line:3 Pos:11)" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	res, err = UnitTestEval(`
+const MaxSize := 10
+const MaxSize := 20
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Constant MaxSize is already declared) (Line:3 Pos:1)" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	res, err = UnitTestEval(`const Color { RED, GREEN.x }`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Enum constants must be simple variables with an optional value) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+}
@@ -11,12 +11,14 @@
 package interpreter
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
 	"strings"
 
 	"github.com/krotik/common/errorutil"
 	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
 )
 
 // Basic Boolean Operator Runtimes
@@ -184,13 +186,27 @@ func (rt *equalOpRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid u
 	if err == nil {
 
 		res, err = rt.genOp(func(n1 interface{}, n2 interface{}) interface{} {
-			return n1 == n2
+			return valuesEqual(n1, n2)
 		}, vs, is, tid)
 	}
 
 	return res, err
 }
 
+/*
+valuesEqual checks if two values are equal. Bytes are compared by content.
+*/
+func valuesEqual(n1 interface{}, n2 interface{}) bool {
+	if b1, ok := n1.([]byte); ok {
+		b2, ok := n2.([]byte)
+		return ok && bytes.Equal(b1, b2)
+	} else if _, ok := n2.([]byte); ok {
+		return false
+	}
+
+	return n1 == n2
+}
+
 type notequalOpRuntime struct {
 	*operatorRuntime
 }
@@ -213,7 +229,7 @@ func (rt *notequalOpRuntime) Eval(vs parser.Scope, is map[string]interface{}, ti
 	if err == nil {
 
 		res, err = rt.genOp(func(n1 interface{}, n2 interface{}) interface{} {
-			return n1 != n2
+			return !valuesEqual(n1, n2)
 		}, vs, is, tid)
 	}
 
@@ -474,3 +490,83 @@ func (rt *notinOpRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid u
 
 	return res, err
 }
+
+// Conditional expressions
+// =======================
+
+type ternaryOpRuntime struct {
+	*operatorRuntime
+}
+
+/*
+ternaryOpRuntimeInst returns a new runtime component instance.
+*/
+func ternaryOpRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &ternaryOpRuntime{&operatorRuntime{newBaseRuntime(erp, node)}}
+}
+
+/*
+Eval evaluate this runtime component.
+*/
+func (rt *ternaryOpRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint64) (interface{}, error) {
+	var res interface{}
+
+	_, err := rt.baseRuntime.Eval(vs, is, tid)
+
+	if err == nil {
+		var cond interface{}
+
+		errorutil.AssertTrue(len(rt.node.Children) == 3,
+			fmt.Sprint("Operation requires 3 operands", rt.node))
+
+		if cond, err = rt.node.Children[0].Runtime.Eval(vs, is, tid); err == nil {
+
+			condbool, ok := cond.(bool)
+			if !ok {
+				return nil, rt.erp.NewRuntimeError(util.ErrNotABoolean,
+					rt.errorDetailString(rt.node.Children[0].Token, cond), rt.node.Children[0])
+			}
+
+			// Only the selected value is evaluated
+
+			if condbool {
+				res, err = rt.node.Children[1].Runtime.Eval(vs, is, tid)
+			} else {
+				res, err = rt.node.Children[2].Runtime.Eval(vs, is, tid)
+			}
+		}
+	}
+
+	return res, err
+}
+
+type coalesceOpRuntime struct {
+	*operatorRuntime
+}
+
+/*
+coalesceOpRuntimeInst returns a new runtime component instance.
+*/
+func coalesceOpRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &coalesceOpRuntime{&operatorRuntime{newBaseRuntime(erp, node)}}
+}
+
+/*
+Eval evaluate this runtime component.
+*/
+func (rt *coalesceOpRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint64) (interface{}, error) {
+	var res interface{}
+
+	_, err := rt.baseRuntime.Eval(vs, is, tid)
+
+	if err == nil {
+
+		// The default value is only evaluated if the value is null
+
+		if res, err = rt.node.Children[0].Runtime.Eval(vs, is, tid); err == nil && res == nil {
+			res, err = rt.node.Children[1].Runtime.Eval(vs, is, tid)
+		}
+	}
+
+	return res, err
+}
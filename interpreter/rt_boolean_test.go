@@ -339,3 +339,104 @@ notin
 		return
 	}
 }
+
+func TestConditionalExpressions(t *testing.T) {
+
+	res, err := UnitTestEvalAndAST(
+		`1 > 2 ? "a" : "b"`, nil,
+		`
+ternary
+  >
+    number: 1
+    number: 2
+  string: 'a'
+  string: 'b'
+`[1:])
+
+	if fmt.Sprint(res) != "b" || err != nil {
+		t.Error(res, err)
+		return
+	}
+
+	// Only the selected value is evaluated
+
+	res, err = UnitTestEval(
+		`true ? 1 : raise("foo")`, nil)
+
+	if fmt.Sprint(res) != "1" || err != nil {
+		t.Error(res, err)
+		return
+	}
+
+	res, err = UnitTestEval(
+		`false ? 1 : false ? 2 : 3`, nil)
+
+	if fmt.Sprint(res) != "3" || err != nil {
+		t.Error(res, err)
+		return
+	}
+
+	res, err = UnitTestEval(
+		`c := true; {"a" : c ? 1 : 2, "b" : not c ? 1 : 2}`, nil)
+
+	if fmt.Sprint(res) != "map[a:1 b:2]" || err != nil {
+		t.Error(res, err)
+		return
+	}
+
+	res, err = UnitTestEval(
+		`l := [1, 2]; false ? l[1:2] : [l[0], true ? 3 : 4]`, nil)
+
+	if fmt.Sprint(res) != "[1 3]" || err != nil {
+		t.Error(res, err)
+		return
+	}
+
+	res, err = UnitTestEval(
+		`1 ? 1 : 2`, nil)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Operand is not a boolean (1) (Line:1 Pos:1)" {
+		t.Error(res, err)
+		return
+	}
+
+	res, err = UnitTestEvalAndAST(
+		`a := {"b" : 1}; a.c ?? a.b ?? 3`, nil,
+		`
+statements
+  :=
+    identifier: a
+    map
+      kvp
+        string: 'b'
+        number: 1
+  coalesce
+    coalesce
+      identifier: a
+        identifier: c
+      identifier: a
+        identifier: b
+    number: 3
+`[1:])
+
+	if fmt.Sprint(res) != "1" || err != nil {
+		t.Error(res, err)
+		return
+	}
+
+	res, err = UnitTestEval(
+		`false ?? raise("foo")`, nil)
+
+	if fmt.Sprint(res) != "false" || err != nil {
+		t.Error(res, err)
+		return
+	}
+
+	res, err = UnitTestEval(
+		`x ?? 1 + 2`, nil)
+
+	if fmt.Sprint(res) != "3" || err != nil {
+		t.Error(res, err)
+		return
+	}
+}
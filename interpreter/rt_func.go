@@ -13,8 +13,13 @@ package interpreter
 import (
 	"encoding/json"
 	"fmt"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/krotik/common/stringutil"
+	"github.com/krotik/ecal/config"
 	"github.com/krotik/ecal/parser"
 	"github.com/krotik/ecal/scope"
 	"github.com/krotik/ecal/util"
@@ -25,13 +30,14 @@ returnRuntime is a special runtime for return statements in functions.
 */
 type returnRuntime struct {
 	*baseRuntime
+	tailCall bool // Flag if the return value is a function call in tail position
 }
 
 /*
 voidRuntimeInst returns a new runtime component instance.
 */
 func returnRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
-	return &returnRuntime{newBaseRuntime(erp, node)}
+	return &returnRuntime{newBaseRuntime(erp, node), false}
 }
 
 /*
@@ -51,7 +57,14 @@ func (rt *returnRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid ui
 	if err == nil {
 		var res interface{}
 
-		if len(rt.node.Children) > 0 {
+		if rt.tailCall {
+
+			// Do not execute a call of an ECAL function - the calling
+			// function runs it once this function has returned
+
+			res, err = rt.node.Children[0].Runtime.Eval(vs, map[string]interface{}{tailCallState: true}, tid)
+
+		} else if len(rt.node.Children) > 0 {
 			res, err = rt.node.Children[0].Runtime.Eval(vs, is, tid)
 		} else {
 			res = nil
@@ -73,6 +86,104 @@ type returnValue struct {
 	returnValue interface{}
 }
 
+/*
+tailCallState is the key of the instance state which marks a function call in
+tail position.
+*/
+const tailCallState = "tailcall"
+
+/*
+tailCall is a call of an ECAL function which is returned by another function
+instead of being executed (tail call elimination). The calling function runs
+the call so recursion in tail position does not grow the call stack.
+*/
+type tailCall struct {
+	function *function     // Function which should be called
+	args     []interface{} // Arguments of the call
+}
+
+/*
+isTailCall checks if a given expression of a return statement is a plain
+function call (e.g. foo(x) or obj.foo(x)) which can be eliminated.
+*/
+func isTailCall(node *parser.ASTNode) bool {
+	for node.Name == parser.NodeIDENTIFIER && len(node.Children) == 1 {
+		if node = node.Children[0]; node.Name == parser.NodeFUNCCALL {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+markTailCalls marks all return statements in a given function body which
+return a function call in tail position. Return statements inside constructs
+which do work after their body (e.g. try or mutex) are not in tail position.
+*/
+func markTailCalls(node *parser.ASTNode) {
+	for _, c := range node.Children {
+		switch c.Name {
+		case parser.NodeRETURN:
+			if rt, ok := c.Runtime.(*returnRuntime); ok && len(c.Children) > 0 {
+				rt.tailCall = isTailCall(c.Children[0])
+			}
+		case parser.NodeIF, parser.NodeSTATEMENTS:
+			markTailCalls(c)
+		}
+	}
+}
+
+/*
+yieldRuntime is a special runtime for yield statements in generator functions.
+*/
+type yieldRuntime struct {
+	*baseRuntime
+}
+
+/*
+yieldRuntimeInst returns a new runtime component instance.
+*/
+func yieldRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &yieldRuntime{newBaseRuntime(erp, node)}
+}
+
+/*
+Eval evaluate this runtime component.
+*/
+func (rt *yieldRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint64) (interface{}, error) {
+
+	_, err := rt.baseRuntime.Eval(vs, is, tid)
+
+	if err == nil {
+		var res interface{}
+
+		if len(rt.node.Children) > 0 {
+			res, err = rt.node.Children[0].Runtime.Eval(vs, is, tid)
+		}
+
+		if err == nil {
+			rt.erp.generatorsLock.Lock()
+			g, ok := rt.erp.generators[tid]
+			rt.erp.generatorsLock.Unlock()
+
+			if !ok {
+				err = rt.erp.NewRuntimeError(util.ErrInvalidState,
+					"Yield can only be used inside a function", rt.node)
+
+			} else if !g.yield(res) {
+
+				// The consumer of the generator has stopped - unwind the function
+				// (the error cannot be handled by a try block)
+
+				err = rt.erp.NewRuntimeError(util.ErrGeneratorStopped, "", rt.node)
+			}
+		}
+	}
+
+	return nil, err
+}
+
 /*
 funcRuntime is the runtime component for function declarations.
 */
@@ -87,6 +198,47 @@ func funcRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runt
 	return &funcRuntime{newBaseRuntime(erp, node)}
 }
 
+/*
+Validate this node and all its child nodes.
+*/
+func (rt *funcRuntime) Validate() error {
+	err := rt.baseRuntime.Validate()
+
+	if err == nil {
+		var types []*parser.ASTNode
+
+		// Collect all type annotations of the parameters and the return value
+
+		for _, c := range rt.node.Children {
+			if c.Name == parser.NodePARAMS {
+				for _, p := range c.Children {
+					if t := paramType(p); t != nil {
+						types = append(types, t)
+					}
+				}
+			} else if c.Name == parser.NodeTYPE {
+				types = append(types, c.Children[0])
+			}
+		}
+
+		for _, t := range types {
+			if stringutil.IndexOf(t.Token.Val, knownTypes) == -1 {
+				return rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
+					fmt.Sprintf("Unknown type: %v (known types are: %v)", t.Token.Val,
+						strings.Join(knownTypes, ", ")), t)
+			}
+		}
+
+		// Generators return their values differently
+
+		if body := rt.node.Children[len(rt.node.Children)-1]; !isGeneratorBody(body) {
+			markTailCalls(body)
+		}
+	}
+
+	return err
+}
+
 /*
 Eval evaluate this runtime component.
 */
@@ -102,7 +254,7 @@ func (rt *funcRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint
 			name = rt.node.Children[0].Token.Val
 		}
 
-		fc = &function{name, nil, nil, rt.node, vs}
+		fc = &function{name, nil, nil, rt.node, vs, isGeneratorBody(rt.node.Children[len(rt.node.Children)-1])}
 
 		if name != "" {
 			vs.SetValue(name, fc)
@@ -121,6 +273,101 @@ type function struct {
 	this          interface{}     // Function context
 	declaration   *parser.ASTNode // Function declaration node
 	declarationVS parser.Scope    // Function declaration scope
+	generator     bool            // Flag if this function is a generator (contains yield statements)
+}
+
+/*
+knownTypes are all types which can be used in type annotations.
+*/
+var knownTypes = []string{"any", "number", "string", "boolean", "list", "bytes", "map", "function"}
+
+/*
+paramName returns the name of a function parameter.
+*/
+func paramName(p *parser.ASTNode) string {
+	if p.Name == parser.NodeIDENTIFIER {
+		return p.Token.Val
+	} else if p.Name == parser.NodePRESET {
+		return paramName(p.Children[0])
+	}
+	return p.Children[0].Token.Val
+}
+
+/*
+paramType returns the type annotation of a function parameter or nil if the
+parameter has no type annotation.
+*/
+func paramType(p *parser.ASTNode) *parser.ASTNode {
+	if p.Name == parser.NodeTYPE {
+		return p.Children[1]
+	} else if p.Name == parser.NodePRESET {
+		return paramType(p.Children[0])
+	}
+	return nil
+}
+
+/*
+typeOf returns the type name of a given value.
+*/
+func typeOf(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "list"
+	case []byte:
+		return "bytes"
+	case map[interface{}]interface{}:
+		return "map"
+	case util.ECALFunction:
+		return "function"
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+/*
+checkType checks a value against a type annotation. Depending on the
+configuration a type mismatch is either returned as an error or only logged.
+*/
+func checkType(erp *ECALRuntimeProvider, typeNode *parser.ASTNode, val interface{}, what string) error {
+	var err error
+
+	if expected := typeNode.Token.Val; expected != "any" && expected != typeOf(val) {
+
+		err = erp.NewRuntimeError(util.ErrTypeMismatch,
+			fmt.Sprintf("%v should be of type %v (got %v)", what, expected, typeOf(val)), typeNode)
+
+		if config.Bool(config.TypeCheckWarnOnly) {
+			erp.Logger.LogError(err)
+			err = nil
+		}
+	}
+
+	return err
+}
+
+/*
+isGeneratorBody checks if a function body contains yield statements. Yield
+statements of nested function declarations are not considered.
+*/
+func isGeneratorBody(node *parser.ASTNode) bool {
+	if node.Name == parser.NodeYIELD {
+		return true
+	}
+
+	for _, c := range node.Children {
+		if c.Name != parser.NodeFUNC && isGeneratorBody(c) {
+			return true
+		}
+	}
+
+	return false
 }
 
 /*
@@ -129,14 +376,60 @@ have a reference to a context state - this.
 */
 func (f *function) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
 	var res interface{}
+	var returnType *parser.ASTNode
+	var returnTypes []*parser.ASTNode
 	var err error
 
+	erp := f.declaration.Runtime.(*funcRuntime).erp
+
+	for {
+		res, returnType, err = f.call(erp, tid, args)
+
+		if returnType != nil {
+			returnTypes = append(returnTypes, returnType)
+		}
+
+		// Execute calls in tail position here so they do not grow the stack
+
+		tc, ok := res.(*tailCall)
+
+		if err != nil || !ok {
+			break
+		}
+
+		f, args = tc.function, tc.args
+	}
+
+	// The result must match the return types of all functions in a chain
+	// of tail calls
+
+	for i := len(returnTypes) - 1; i >= 0 && err == nil; i-- {
+		err = checkType(erp, returnTypes[i], res, "Return value")
+	}
+
+	return res, err
+}
+
+/*
+call binds the parameters of this function and executes its body. Returns the
+result and the annotated return type of this function.
+*/
+func (f *function) call(erp *ECALRuntimeProvider, tid uint64, args []interface{}) (interface{}, *parser.ASTNode, error) {
+	var res interface{}
+	var err error
+
+	var returnType *parser.ASTNode
+
 	nameOffset := 0
 	if f.declaration.Children[0].Name == parser.NodeIDENTIFIER {
 		nameOffset = 1
 	}
 	params := f.declaration.Children[0+nameOffset].Children
-	body := f.declaration.Children[1+nameOffset]
+	body := f.declaration.Children[len(f.declaration.Children)-1]
+
+	if rt := f.declaration.Children[1+nameOffset]; rt.Name == parser.NodeTYPE {
+		returnType = rt.Children[0]
+	}
 
 	// Create varscope for the body - not a child scope but a new root
 
@@ -149,38 +442,53 @@ func (f *function) Run(instanceID string, vs parser.Scope, is map[string]interfa
 		fvs.SetValue("super", f.super)
 	}
 
+	// Default values are evaluated at call time in the function scope so they
+	// can refer to previous parameters
+
+	scope.SetParentOfScope(fvs, f.declarationVS)
+
 	for i, p := range params {
 		var name string
 		var val interface{}
 
 		if err == nil {
-			name = ""
+			name = paramName(p)
+
+			if p.Name == parser.NodeVARARGS {
 
-			if p.Name == parser.NodeIDENTIFIER {
-				name = p.Token.Val
+				// Collect all remaining arguments in a list
 
+				rest := []interface{}{}
 				if i < len(args) {
-					val = args[i]
+					rest = append(rest, args[i:]...)
 				}
+				val = rest
+
+			} else if i < len(args) {
+				val = args[i]
+
 			} else if p.Name == parser.NodePRESET {
-				name = p.Children[0].Token.Val
+				val, err = p.Children[1].Runtime.Eval(fvs, make(map[string]interface{}), tid)
+			}
 
-				if i < len(args) {
-					val = args[i]
-				} else {
-					val, err = p.Children[1].Runtime.Eval(vs, is, tid)
-				}
+			if t := paramType(p); t != nil && err == nil {
+				err = checkType(erp, t, val, fmt.Sprintf("Parameter %v", name))
 			}
 
-			if name != "" {
-				fvs.SetValue(name, val)
+			if err == nil {
+				fvs.SetLocalValue(name, val)
 			}
 		}
 	}
 
 	if err == nil {
 
-		scope.SetParentOfScope(fvs, f.declarationVS)
+		// Calling a generator function returns a generator which runs
+		// the function body on demand
+
+		if f.generator {
+			return newGenerator(erp, f, fvs, body), nil, nil
+		}
 
 		res, err = body.Runtime.Eval(fvs, make(map[string]interface{}), tid)
 
@@ -192,7 +500,7 @@ func (f *function) Run(instanceID string, vs parser.Scope, is map[string]interfa
 		}
 	}
 
-	return res, err
+	return res, returnType, err
 }
 
 /*
@@ -221,3 +529,200 @@ be JSON encoded.
 func (f *function) MarshalJSON() ([]byte, error) {
 	return json.Marshal(f.String())
 }
+
+/*
+generator runs the body of a generator function on demand. The body runs in its
+own goroutine which is paused at every yield statement until the next value
+is requested.
+*/
+type generator struct {
+	f       *function      // Generator function
+	body    *generatorBody // Function body which is run by the generator
+	started bool           // Flag if the body has been started
+	done    bool           // Flag if the generator has finished
+	lock    *sync.Mutex    // Lock for the generator state
+}
+
+/*
+generatorBody holds the state which is shared with the goroutine of a generator
+function body. It does not refer back to the generator so a generator which is
+no longer used can be garbage collected while its body is paused.
+*/
+type generatorBody struct {
+	erp       *ECALRuntimeProvider // Runtime provider of the generator
+	vs        parser.Scope         // Variable scope of the function body
+	body      *parser.ASTNode      // Function body
+	tid       uint64               // Thread ID of the function body
+	consumer  uint64               // Thread ID of the consumer which requested the last value
+	depthBase int32                // Call depth of the consumer when the body was resumed
+	values    chan interface{}     // Channel for yielded values (closed once the body has finished)
+	resume    chan bool            // Channel to resume the body (closed to stop the body)
+	err       error                // Error of the function body
+	stopped   bool                 // Flag if the body has been stopped (only accessed by the body)
+}
+
+/*
+newGenerator creates a new generator.
+*/
+func newGenerator(erp *ECALRuntimeProvider, f *function, vs parser.Scope, body *parser.ASTNode) *generator {
+	return &generator{f, &generatorBody{erp, vs, body, 0, 0, 0, make(chan interface{}), make(chan bool),
+		nil, false}, false, false, &sync.Mutex{}}
+}
+
+/*
+Next returns the next value of the generator for a consuming thread. The second
+return value is false if the generator has finished.
+*/
+func (g *generator) Next(tid uint64) (interface{}, bool, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.done {
+		return nil, false, nil
+	}
+
+	if !g.started {
+		g.started = true
+		g.body.tid = g.body.erp.NewThreadID()
+
+		g.body.erp.generatorsLock.Lock()
+		g.body.erp.generators[g.body.tid] = g.body
+		g.body.erp.generatorsLock.Unlock()
+
+		// Stop the body if the generator is dropped before it has finished
+
+		runtime.SetFinalizer(g, (*generator).release)
+
+		g.body.attach(tid)
+
+		go g.body.run()
+
+	} else {
+		g.body.attach(tid)
+
+		g.body.resume <- true
+	}
+
+	val, ok := <-g.body.values
+
+	if !ok {
+		g.done = true
+		return nil, false, g.body.err
+	}
+
+	return val, true, nil
+}
+
+/*
+Close stops the generator. The function body is unwound from the yield
+statement where it is paused.
+*/
+func (g *generator) Close() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.started && !g.done {
+		close(g.body.resume)
+
+		// Wait for the body to finish
+
+		for range g.body.values {
+		}
+	}
+
+	g.done = true
+}
+
+/*
+release stops the body of a generator which is no longer used without waiting
+for it to finish.
+*/
+func (g *generator) release() {
+	if g.started && !g.done {
+		g.done = true
+		close(g.body.resume)
+	}
+}
+
+/*
+attach runs the paused body on behalf of a consuming thread. The body continues
+the call depth of the consumer and is subject to its cancellation requests and
+deadlines (see ECALRuntimeProvider.generatorConsumer).
+*/
+func (b *generatorBody) attach(consumer uint64) {
+	b.erp.generatorsLock.Lock()
+	b.consumer = consumer
+	b.erp.generatorsLock.Unlock()
+
+	depth := int32(1) // Call of the generator function
+
+	if counter, ok := b.erp.callDepths.Load(consumer); ok {
+		depth += atomic.LoadInt32(counter.(*int32))
+	}
+
+	counter, _ := b.erp.callDepths.LoadOrStore(b.tid, new(int32))
+	atomic.AddInt32(counter.(*int32), depth-b.depthBase)
+
+	b.depthBase = depth
+}
+
+/*
+run runs the function body.
+*/
+func (b *generatorBody) run() {
+	_, err := b.body.Runtime.Eval(b.vs, make(map[string]interface{}), b.tid)
+
+	if _, ok := err.(*returnValue); ok {
+		err = nil
+	} else if rterr, ok := err.(*util.RuntimeError); ok && rterr.Type == util.ErrGeneratorStopped {
+		err = nil
+	}
+
+	b.err = err
+
+	b.erp.generatorsLock.Lock()
+	delete(b.erp.generators, b.tid)
+	b.erp.generatorsLock.Unlock()
+
+	b.erp.callDepths.Delete(b.tid)
+
+	if b.erp.Debugger != nil {
+		b.erp.Debugger.RecordThreadFinished(b.tid)
+	}
+
+	close(b.values)
+}
+
+/*
+yield passes a value to the consumer of the generator and waits until the
+next value is requested. Returns false if the body should stop.
+*/
+func (b *generatorBody) yield(val interface{}) bool {
+	if b.stopped {
+		return false
+	}
+
+	select {
+	case b.values <- val:
+		b.stopped = !<-b.resume
+	case <-b.resume:
+		b.stopped = true // The generator was closed before the value was taken
+	}
+
+	return !b.stopped
+}
+
+/*
+String returns a string representation of this generator.
+*/
+func (g *generator) String() string {
+	return fmt.Sprintf("ecal.generator: %v (%v)", g.f.name, g.f.declaration.Token.PosString())
+}
+
+/*
+MarshalJSON returns a string representation of this generator - a generator
+cannot be JSON encoded.
+*/
+func (g *generator) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.String())
+}
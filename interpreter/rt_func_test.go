@@ -11,10 +11,18 @@
 package interpreter
 
 import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/krotik/common/stringutil"
+	"github.com/krotik/ecal/config"
 	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/util"
 )
 
 func TestFunctions(t *testing.T) {
@@ -257,6 +265,736 @@ result1 := fib(12)
 	}
 }
 
+func TestFunctionParameters(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+a := 10
+b := 20
+count := 0
+func next() {
+  count := count + 1
+  return count
+}
+func myfunc(a, b=a + 1, c=next(), *rest) {
+  return [a, b, c, rest]
+}
+result1 := myfunc(1)
+result2 := myfunc(1, 2)
+result3 := myfunc(1, 2, 3, 4, 5)
+result4 := myfunc(5)
+`, vs)
+
+	if vsRes := vs.String(); err != nil || vsRes != `GlobalScope {
+    a (float64) : 10
+    b (float64) : 20
+    count (float64) : 3
+    myfunc (*interpreter.function) : ecal.function: myfunc (Line 9, Pos 1)
+    next (*interpreter.function) : ecal.function: next (Line 5, Pos 1)
+    result1 ([]interface {}) : [1,2,1,[]]
+    result2 ([]interface {}) : [1,2,2,[]]
+    result3 ([]interface {}) : [1,2,3,[4,5]]
+    result4 ([]interface {}) : [5,6,3,[]]
+}` {
+		t.Error("Unexpected result: ", vsRes, err)
+		return
+	}
+
+	_, err = UnitTestEval(`
+func sum(*numbers) {
+  res := 0
+  for n in numbers {
+    res := res + n
+  }
+  return res
+}
+result1 := sum()
+result2 := sum(1, 2, 3)
+`, vs)
+
+	if res, _, _ := vs.GetValue("result2"); err != nil || res != 6. {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	if res, _, _ := vs.GetValue("result1"); res != 0. {
+		t.Error("Unexpected result: ", res)
+		return
+	}
+
+	_, err = UnitTestEval(`
+func myfunc(a=raise("foo")) {
+}
+myfunc()
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): foo () (Line:2 Pos:15)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+func myfunc(a: number, f: function, c: any, b: string="x", *rest) : list {
+  return [a, b, c, rest]
+}
+result1 := myfunc(1, myfunc, null, "a", 1, 2)
+result2 := myfunc(2, myfunc, [])
+`, vs)
+
+	if res, _, _ := vs.GetValue("result1"); err != nil || fmt.Sprint(res) != "[1 a <nil> [1 2]]" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	if res, _, _ := vs.GetValue("result2"); fmt.Sprint(res) != "[2 x [] []]" {
+		t.Error("Unexpected result: ", res)
+		return
+	}
+
+	_, err = UnitTestEval(`myfunc("1")`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Type mismatch (Parameter a should be of type number (got string)) (Line:2 Pos:16)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`
+func myfunc(a: boolean) : map {
+  return a
+}
+myfunc(true)
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Type mismatch (Return value should be of type map (got boolean)) (Line:2 Pos:27)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`
+func myfunc(a: integer) {
+}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Unknown type: integer (known types are: any, number, string, boolean, list, bytes, map, function)) (Line:2 Pos:16)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// Type mismatches can be reported as log messages only
+
+	config.Config[config.TypeCheckWarnOnly] = true
+	defer func() {
+		config.Config[config.TypeCheckWarnOnly] = false
+	}()
+
+	res, err := UnitTestEval(`
+func myfunc(a: string) : list {
+  return a
+}
+myfunc(1)
+`, vs)
+
+	if err != nil || res != 1. || testlogger.String() != `error: ECAL error in ECALTestRuntime (ECALEvalTest): Type mismatch (Parameter a should be of type string (got number)) (Line:2 Pos:16)
+error: ECAL error in ECALTestRuntime (ECALEvalTest): Type mismatch (Return value should be of type list (got number)) (Line:2 Pos:26)` {
+		t.Error("Unexpected result: ", res, err, testlogger.String())
+		return
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+
+	config.Config[config.MaxCallDepth] = 100
+	config.Config[config.TraceDepth] = 4
+	defer func() {
+		config.Config[config.MaxCallDepth] = config.DefaultConfig[config.MaxCallDepth]
+		config.Config[config.TraceDepth] = config.DefaultConfig[config.TraceDepth]
+	}()
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+func rec(n) {
+  if n == 0 {
+    return 0
+  }
+  return rec(n - 1) + 1
+}
+a := rec(99)
+b := rec(100)
+`, vs)
+
+	if res, _, _ := vs.GetValue("a"); err == nil || res != 99. ||
+		err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Maximum call depth exceeded (Call depth limit is 100) (Line:6 Pos:10)" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	if res := strings.Join(err.(util.TraceableRuntimeError).GetTraceString(), "\n"); res != `rec(n - 1) (ECALEvalTest:6)
+rec(n - 1) (ECALEvalTest:6)
+... 96 frames omitted ...
+rec(n - 1) (ECALEvalTest:6)
+rec(100) (ECALEvalTest:9)` {
+		t.Error("Unexpected result: ", res)
+		return
+	}
+
+	// The call depth is reset after the error
+
+	if res, err := UnitTestEval(`rec(99)`, vs); err != nil || res != 99. {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	// The limit can be switched off (the limit is read when the runtime
+	// provider is created)
+
+	config.Config[config.MaxCallDepth] = 0
+
+	if res, err := UnitTestEval(`
+func rec(n) {
+  if n == 0 {
+    return 0
+  }
+  return rec(n - 1) + 1
+}
+rec(200)
+`, vs); err != nil || res != 200. {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+
+	config.Config[config.MaxCallDepth] = 100
+	defer func() {
+		config.Config[config.MaxCallDepth] = config.DefaultConfig[config.MaxCallDepth]
+	}()
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+func sum(n, acc=0) {
+  if n == 0 {
+    return acc
+  }
+  return sum(n - 1, acc + n)
+}
+
+func isEven(n) {
+  if n == 0 {
+    return true
+  } elif n == 1 {
+    return false
+  }
+  return isOdd(n - 1)
+}
+
+func isOdd(n) {
+  return isEven(n - 1)
+}
+
+Counter := {
+  "count" : 0,
+  "run" : func(n) {
+    if n > 0 {
+      this.count := this.count + 1
+      return this.run(n - 1)
+    }
+    return this.count
+  }
+}
+
+result1 := sum(10000)
+result2 := isEven(10001)
+c := new(Counter)
+result3 := c.run(1000)
+result4 := sum(10)
+`, vs)
+
+	if res := fmt.Sprint(vs.String()); err != nil || !strings.Contains(res, "result1 (float64) : 50005000") ||
+		!strings.Contains(res, "result2 (bool) : false") || !strings.Contains(res, "result3 (float64) : 1000") ||
+		!strings.Contains(res, "result4 (float64) : 55") {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	// Calls which are not in tail position still grow the call stack
+
+	_, err = UnitTestEval(`
+func sum2(n) {
+  if n == 0 {
+    return 0
+  }
+  try {
+    return sum2(n - 1)
+  }
+}
+sum2(1000)
+`, vs)
+
+	if err == nil || !strings.Contains(err.Error(), "Maximum call depth exceeded") {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`
+func sum3(n) {
+  if n == 0 {
+    return 0
+  }
+  return 1 + sum3(n - 1)
+}
+sum3(1000)
+`, vs)
+
+	if err == nil || !strings.Contains(err.Error(), "Maximum call depth exceeded") {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// Return types of all functions in a chain of tail calls are checked
+
+	_, err = UnitTestEval(`
+func f1(n) : number {
+  return n
+}
+func f2(n) : string {
+  return f1(n)
+}
+f2(1)
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Type mismatch (Return value should be of type string (got number)) (Line:5 Pos:14)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// Errors in tail calls are reported
+
+	_, err = UnitTestEval(`
+func f3(n) {
+  if n == 0 {
+    raise("myerror")
+  }
+  return f3(n - 1)
+}
+f3(1000)
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): myerror () (Line:4 Pos:5)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+func TestCallFunction(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+
+	_, err := UnitTestEvalWithRuntimeProvider(`
+func describe(item, factor) {
+  return {
+    "total" : item.price * item.count * factor,
+    "tags" : item.tags
+  }
+}
+notAFunction := 1
+`, vs, erp)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	type item struct {
+		Price float32  `json:"price"`
+		Count int      `json:"count"`
+		Tags  []string `json:"tags"`
+	}
+
+	res, err := erp.CallFunction(vs, "describe", &item{1.5, 4, []string{"a"}}, 2)
+
+	if err != nil || fmt.Sprintf("%#v", res) != `map[interface {}]interface {}{"tags":[]interface {}{"a"}, "total":12}` {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	var result struct {
+		Total int
+		Tags  []string
+	}
+
+	if err := scope.ConvertECALToGoObject(map[interface{}]interface{}{
+		"Total": res.(map[interface{}]interface{})["total"],
+		"Tags":  res.(map[interface{}]interface{})["tags"],
+	}, &result); err != nil || fmt.Sprint(result) != "{12 [a]}" {
+		t.Error("Unexpected result:", result, err)
+		return
+	}
+
+	if _, err := erp.CallFunction(vs, "foo"); err == nil || err.Error() != "Unknown function: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := erp.CallFunction(vs, "notAFunction"); err == nil || err.Error() != "Variable notAFunction is not a function" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestCancelThread(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+
+	var err error
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		_, err = UnitTestEvalWithRuntimeProvider(`
+result := null
+tid := threadId()
+try {
+  for true {
+    sleep(1ms)
+  }
+} except "Cancelled" as e {
+  result := e.detail
+}
+after := true
+`, vs, erp)
+	}()
+
+	var tid interface{}
+
+	for tid == nil {
+		time.Sleep(time.Millisecond)
+		tid, _, _ = vs.GetValue("tid")
+	}
+
+	erp.CancelThread(uint64(tid.(float64)))
+
+	wg.Wait()
+
+	if res := fmt.Sprint(scope.ToObject(vs)["result"], " ", scope.ToObject(vs)["after"]); err != nil ||
+		res != fmt.Sprintf("Thread %v was cancelled true", tid) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Uncaught cancellations stop the execution
+
+	next := erp.NewThreadID() + 1
+	erp.CancelThread(next)
+
+	_, err = UnitTestEvalWithRuntimeProvider(`
+a := 1
+b := 2
+`, vs, erp)
+
+	if err == nil || err.Error() != fmt.Sprintf("ECAL error in ECALTestRuntime (ECALEvalTest): Cancelled (Thread %v was cancelled) (Line:2 Pos:3)", next) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestGenerators(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	res, err := UnitTestEval(`
+func mygen(n) {
+  for i in range(1, n) {
+    yield i * 2
+  }
+  yield
+}
+
+gen := mygen(3)
+result1 := []
+for x in gen {
+  result1 := add(result1, x)
+}
+`, vs)
+
+	if vsRes := vs.String(); err != nil || res != nil || vsRes != `GlobalScope {
+    gen (*interpreter.generator) : ecal.generator: mygen (Line 2, Pos 1)
+    mygen (*interpreter.function) : ecal.function: mygen (Line 2, Pos 1)
+    result1 ([]interface {}) : [2,4,6,null]
+    block: loop (Line:11 Pos:1) {
+        x (<nil>) : null
+    }
+}` {
+		t.Error("Unexpected result: ", vsRes, res, err)
+		return
+	}
+
+	// A generator which has finished produces no more values
+
+	_, err = UnitTestEval(`
+for x in gen {
+  raise("unexpected")
+}
+`, vs)
+
+	if err != nil {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// Values are only produced on demand - break stops the generator
+
+	vs = scope.NewScope(scope.GlobalScope)
+
+	res, err = UnitTestEval(`
+produced := 0
+func mygen() {
+  i := 0
+  for true {
+    produced := produced + 1
+    yield i
+    i := i + 1
+  }
+}
+result1 := 0
+for x in mygen() {
+  if x == 3 {
+    break
+  }
+  result1 := result1 + x
+}
+result2 := produced
+`, vs)
+
+	if res, _, _ := vs.GetValue("result1"); err != nil || res != 3. {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	if res, _, _ := vs.GetValue("result2"); res != 4. {
+		t.Error("Unexpected result: ", res)
+		return
+	}
+
+	// Return ends a generator
+
+	_, err = UnitTestEval(`
+func mygen() {
+  yield 1
+  return
+  yield 2
+}
+result1 := []
+for x in mygen() {
+  result1 := add(result1, x)
+}
+`, vs)
+
+	if res, _, _ := vs.GetValue("result1"); err != nil || fmt.Sprint(res) != "[1]" {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	// Nested functions do not make the outer function a generator
+
+	_, err = UnitTestEval(`
+func myfunc() {
+  f := func() {
+    yield 1
+  }
+  return f
+}
+result1 := myfunc()
+`, vs)
+
+	if res, _, _ := vs.GetValue("result1"); err != nil || !res.(*function).generator {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	// Errors in the generator body are passed to the consumer
+
+	_, err = UnitTestEval(`
+func mygen() {
+  yield 1
+  raise("myerror", "Something went wrong")
+}
+for x in mygen() {
+}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): myerror (Something went wrong) (Line:4 Pos:3)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// Yield can only be used in functions
+
+	_, err = UnitTestEval(`
+yield 1
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid state (Yield can only be used inside a function) (Line:2 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// Generators can be closed before they were started
+
+	g := &generator{}
+	g.lock = &sync.Mutex{}
+	g.Close()
+
+	if res, ok, err := g.Next(0); res != nil || ok || err != nil {
+		t.Error("Unexpected result: ", res, ok, err)
+		return
+	}
+
+	// Stopping a generator cannot be handled in its body
+
+	res, err = UnitTestEval(`
+caught := 0
+func mygen() {
+  for i in range(1, 5) {
+    try {
+      yield i
+    } except {
+      caught := caught + 1
+    }
+  }
+}
+for x in mygen() {
+  break
+}
+caught
+`, vs)
+
+	if res != float64(0) || err != nil {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	// Generators which are dropped before they have finished are stopped
+
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+
+	res, err = UnitTestEvalWithRuntimeProvider(`
+func mygen() {
+  for i in range(1, 1000) {
+    yield i
+  }
+}
+mygen()
+`, vs, erp)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, ok, err := res.(*generator).Next(0); err != nil || !ok || res != float64(1) {
+		t.Error("Unexpected result: ", res, ok, err)
+		return
+	}
+
+	res = nil
+
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+
+		erp.generatorsLock.Lock()
+		running := len(erp.generators)
+		erp.generatorsLock.Unlock()
+
+		if running == 0 {
+			return
+		}
+	}
+
+	t.Error("Generator body was not stopped")
+}
+
+func TestGeneratorConsumer(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+
+	newGen := func() *generator {
+		res, err := UnitTestEvalWithRuntimeProvider(`
+func rec(n) {
+  return n == 0 ? 0 : rec(n - 1)
+}
+func mygen() {
+  yield 1
+  yield rec(5)
+}
+mygen()
+`, vs, erp)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		return res.(*generator)
+	}
+
+	// The body is cancelled together with its consumer
+
+	consumer := erp.NewThreadID()
+
+	gen := newGen()
+	erp.CancelThread(consumer)
+
+	if _, _, err := gen.Next(consumer); err == nil ||
+		err.Error() != fmt.Sprintf("ECAL error in ECALTestRuntime (ECALEvalTest): Cancelled (Thread %v was cancelled) (Line:6 Pos:3)", consumer) {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	// The body is bound by the deadline of its consumer
+
+	gen = newGen()
+	erp.setDeadline(consumer, time.Now())
+
+	if _, _, err := gen.Next(consumer); err == nil ||
+		err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Timeout (Sink did not finish within its timeout) (Line:6 Pos:3)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	erp.setDeadline(consumer, time.Time{})
+
+	// The body continues the call depth of its consumer
+
+	atomic.StoreInt32(&erp.maxCallDepth, 10)
+	defer atomic.StoreInt32(&erp.maxCallDepth, 0)
+
+	gen = newGen()
+
+	if res, ok, err := gen.Next(consumer); res != float64(1) || !ok || err != nil {
+		t.Error("Unexpected result: ", res, ok, err)
+		return
+	}
+
+	depth := int32(5)
+	erp.callDepths.Store(consumer, &depth)
+	defer erp.callDepths.Delete(consumer)
+
+	if _, _, err := gen.Next(consumer); err == nil || !strings.Contains(err.Error(), "Call depth limit is 10") {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
 func TestObjectInstantiation(t *testing.T) {
 
 	vs := scope.NewScope(scope.GlobalScope)
@@ -324,13 +1062,13 @@ result2 := result1.getId() + result1.id
 	if err == nil {
 		v, _, _ := vs.GetValue("result1")
 		if res := stringutil.ConvertToPrettyString(v); res != `{
-  "getId": "ecal.function:  (Line 45, Pos 42)",
+  "getId": "ecal.function:  (Line 45, Pos 13)",
   "getTest": "ecal.function:  (Line 22, Pos 15)",
   "id": 123,
   "idx": 500,
-  "init": "ecal.function:  (Line 38, Pos 32)",
+  "init": "ecal.function:  (Line 38, Pos 12)",
   "name": "baseclass",
-  "setId": "ecal.function:  (Line 51, Pos 39)",
+  "setId": "ecal.function:  (Line 51, Pos 13)",
   "super": [
     {
       "init": "ecal.function:  (Line 15, Pos 12)",
@@ -356,9 +1094,9 @@ result2 := result1.getId() + result1.id
 	if vsRes := vs.String(); err != nil || res != nil || vsRes != `GlobalScope {
     Bar (map[interface {}]interface {}) : {"init":"ecal.function:  (Line 15, Pos 12)","super":[{"init":"ecal.function:  (Line 5, Pos 12)","name":"base"}],"test":""}
     Bar2 (map[interface {}]interface {}) : {"getTest":"ecal.function:  (Line 22, Pos 15)"}
-    Foo (map[interface {}]interface {}) : {"getId":"ecal.function:  (Line 45, Pos 42)","id":0,"idx":0,"init":"ecal.function:  (Line 38, Pos 32)","setId":"ecal.function:  (Line 51, Pos 39)","super":[{"init":"ecal.function:  (Line 15, Pos 12)","super":[{"init":"ecal.function:  (Line 5, Pos 12)","name":"base"}],"test":""},{"getTest":"ecal.function:  (Line 22, Pos 15)"}]}
+    Foo (map[interface {}]interface {}) : {"getId":"ecal.function:  (Line 45, Pos 13)","id":0,"idx":0,"init":"ecal.function:  (Line 38, Pos 12)","setId":"ecal.function:  (Line 51, Pos 13)","super":[{"init":"ecal.function:  (Line 15, Pos 12)","super":[{"init":"ecal.function:  (Line 5, Pos 12)","name":"base"}],"test":""},{"getTest":"ecal.function:  (Line 22, Pos 15)"}]}
     Super (map[interface {}]interface {}) : {"init":"ecal.function:  (Line 5, Pos 12)","name":"base"}
-    result1 (map[interface {}]interface {}) : {"getId":"ecal.function:  (Line 45, Pos 42)","getTest":"ecal.function:  (Line 22, Pos 15)","id":123,"idx":500,"init":"ecal.function:  (Line 38, Pos 32)","name":"baseclass","setId":"ecal.function:  (Line 51, Pos 39)","super":[{"init":"ecal.function:  (Line 15, Pos 12)","super":[{"init":"ecal.function:  (Line 5, Pos 12)","name":"base"}],"test":""},{"getTest":"ecal.function:  (Line 22, Pos 15)"}],"test":"tester"}
+    result1 (map[interface {}]interface {}) : {"getId":"ecal.function:  (Line 45, Pos 13)","getTest":"ecal.function:  (Line 22, Pos 15)","id":123,"idx":500,"init":"ecal.function:  (Line 38, Pos 12)","name":"baseclass","setId":"ecal.function:  (Line 51, Pos 13)","super":[{"init":"ecal.function:  (Line 15, Pos 12)","super":[{"init":"ecal.function:  (Line 5, Pos 12)","name":"base"}],"test":""},{"getTest":"ecal.function:  (Line 22, Pos 15)"}],"test":"tester"}
     result2 (float64) : 623
 }` {
 		t.Error("Unexpected result: ", vsRes, res, err)
@@ -12,6 +12,7 @@ package interpreter
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/krotik/common/errorutil"
 	"github.com/krotik/ecal/parser"
@@ -30,6 +31,7 @@ type baseRuntime struct {
 	erp        *ECALRuntimeProvider // Runtime provider
 	node       *parser.ASTNode      // AST node which this runtime component is servicing
 	validated  bool
+	nested     bool // Flag if this runtime component is part of a larger validated AST
 }
 
 var instanceCounter uint64 // Global instance counter to create unique identifiers for every runtime component instance
@@ -40,17 +42,40 @@ Validate this node and all its child nodes.
 func (rt *baseRuntime) Validate() error {
 	rt.validated = true
 
+	// Only the root of a validated AST checks for undefined variables
+
+	checkVariables := !rt.nested && rt.erp.VarCheckScope != nil
+
+	if checkVariables {
+		markNested(rt.node)
+	}
+
 	// Validate all children
 
 	for _, child := range rt.node.Children {
 		if err := child.Runtime.Validate(); err != nil {
 			return err
 		}
+
+		if rt.erp.optimizing() {
+			foldConstant(rt.erp, child)
+		}
+	}
+
+	if checkVariables {
+		return rt.erp.ValidateVariables(rt.node, rt.erp.VarCheckScope)
 	}
 
 	return nil
 }
 
+/*
+setNested marks this runtime component as part of a larger validated AST.
+*/
+func (rt *baseRuntime) setNested() {
+	rt.nested = true
+}
+
 /*
 Eval evaluate this runtime component.
 */
@@ -59,6 +84,10 @@ func (rt *baseRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint
 
 	errorutil.AssertTrue(rt.validated, "Runtime component has not been validated - please call Validate() before Eval()")
 
+	if rt.erp.Profiler != nil {
+		rt.erp.Profiler.VisitState(rt.node, tid)
+	}
+
 	if rt.erp.Debugger != nil {
 		err = rt.erp.Debugger.VisitState(rt.node, vs, tid)
 		rt.erp.Debugger.SetLockingState(rt.erp.MutexeOwners, rt.erp.MutexLog)
@@ -72,8 +101,7 @@ func (rt *baseRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint
 newBaseRuntime returns a new instance of baseRuntime.
 */
 func newBaseRuntime(erp *ECALRuntimeProvider, node *parser.ASTNode) *baseRuntime {
-	instanceCounter++
-	return &baseRuntime{fmt.Sprint(instanceCounter), erp, node, false}
+	return &baseRuntime{fmt.Sprint(atomic.AddUint64(&instanceCounter, 1)), erp, node, false, false}
 }
 
 // Void Runtime
@@ -126,10 +154,40 @@ func importRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Ru
 }
 
 /*
-Validate this node and all its child nodes.
+Validate this node and all its child nodes. Selected symbols are checked
+against the top-level declarations of the imported code if it can be resolved.
 */
 func (rt *importRuntime) Validate() error {
-	return rt.baseRuntime.Validate()
+	err := rt.baseRuntime.Validate()
+
+	if err == nil && rt.erp.ImportLocator != nil && rt.node.Children[1].Name == parser.NodeIMPORTLIST {
+		var codeText string
+		var ast *parser.ASTNode
+
+		// Code which cannot be resolved or parsed yet is reported on evaluation
+
+		importPath, rerr := rt.resolveImportPath(rt.node.Children[0].Token.Val)
+
+		if rerr == nil {
+			if codeText, rerr = rt.erp.ImportLocator.Resolve(importPath); rerr == nil {
+				ast, rerr = parser.Parse(importPath, codeText)
+			}
+		}
+
+		if rerr == nil {
+			symbols := topLevelSymbols(ast)
+
+			for _, c := range rt.node.Children[1].Children {
+				if name, _ := importSymbol(c); !symbols[name] {
+					err = rt.erp.NewRuntimeError(util.ErrVarAccess,
+						fmt.Sprintf("Symbol %v is not defined in %v", name, importPath), c)
+					break
+				}
+			}
+		}
+	}
+
+	return err
 }
 
 /*
@@ -146,18 +204,29 @@ func (rt *importRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid ui
 
 		var importPath interface{}
 		if importPath, err = rt.node.Children[0].Runtime.Eval(vs, is, tid); err == nil {
+			var resolvedPath, codeText string
 
-			var codeText string
-			if codeText, err = rt.erp.ImportLocator.Resolve(fmt.Sprint(importPath)); err == nil {
+			if resolvedPath, err = rt.resolveImportPath(fmt.Sprint(importPath)); err == nil {
+				codeText, err = rt.erp.ImportLocator.Resolve(resolvedPath)
+			}
+
+			if err == nil {
 				var ast *parser.ASTNode
 
-				if ast, err = parser.ParseWithRuntime(fmt.Sprint(importPath), codeText, rt.erp); err == nil {
+				// Imported code is named after its import path so relative
+				// imports of the imported code can be resolved
+
+				if ast, err = parser.ParseWithRuntime(resolvedPath, codeText, rt.erp); err == nil {
 					if err = ast.Runtime.Validate(); err == nil {
 
 						ivs := scope.NewScope(scope.GlobalScope)
 						if _, err = ast.Runtime.Eval(ivs, make(map[string]interface{}), tid); err == nil {
-							irt := rt.node.Children[1].Runtime.(*identifierRuntime)
-							irt.Set(vs, is, tid, scope.ToObject(ivs))
+							if rt.node.Children[1].Name == parser.NodeIMPORTLIST {
+								err = rt.setSymbols(vs, is, tid, ivs, resolvedPath)
+							} else {
+								irt := rt.node.Children[1].Runtime.(*identifierRuntime)
+								irt.Set(vs, is, tid, scope.ToObject(ivs))
+							}
 						}
 					}
 				}
@@ -168,6 +237,107 @@ func (rt *importRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid ui
 	return nil, err
 }
 
+/*
+resolveImportPath resolves a given import path of this import statement to an
+import path which is relative to the code root.
+*/
+func (rt *importRuntime) resolveImportPath(importPath string) (string, error) {
+	source := rt.node.Token.Lsource
+
+	if resolver, ok := rt.erp.ImportLocator.(util.ECALImportPathResolver); ok {
+		return resolver.ResolveImportPath(source, importPath)
+	}
+
+	return util.ResolveImportPath(source, importPath)
+}
+
+/*
+setSymbols sets the selected symbols of an import in the current scope.
+*/
+func (rt *importRuntime) setSymbols(vs parser.Scope, is map[string]interface{}, tid uint64,
+	ivs parser.Scope, importPath string) error {
+	var err error
+
+	for _, c := range rt.node.Children[1].Children {
+		name, alias := importSymbol(c)
+
+		val, ok, _ := ivs.GetValue(name)
+
+		if !ok {
+			err = rt.erp.NewRuntimeError(util.ErrVarAccess,
+				fmt.Sprintf("Symbol %v is not defined in %v", name, importPath), c)
+			break
+		}
+
+		if err = alias.Runtime.(*identifierRuntime).Set(vs, is, tid, val); err != nil {
+			break
+		}
+	}
+
+	return err
+}
+
+/*
+importSymbol returns the name of a selected symbol of an import and the
+identifier node which should be set in the current scope.
+*/
+func importSymbol(node *parser.ASTNode) (string, *parser.ASTNode) {
+	if node.Name == parser.NodeAS {
+		return node.Children[0].Token.Val, node.Children[1]
+	}
+	return node.Token.Val, node
+}
+
+/*
+topLevelSymbols returns the names of all variables, functions and constants
+which are declared by top-level statements of a given AST.
+*/
+func topLevelSymbols(ast *parser.ASTNode) map[string]bool {
+	var define func(node *parser.ASTNode)
+
+	res := make(map[string]bool)
+
+	define = func(node *parser.ASTNode) {
+		if node.Name == parser.NodeLET {
+			node = node.Children[0]
+		}
+
+		if node.Name == parser.NodeIDENTIFIER && len(node.Children) == 0 {
+			res[node.Token.Val] = true
+		} else if node.Name == parser.NodeLIST {
+			for _, c := range node.Children {
+				define(c)
+			}
+		}
+	}
+
+	statements := []*parser.ASTNode{ast}
+
+	if ast.Name == parser.NodeSTATEMENTS {
+		statements = ast.Children
+	}
+
+	for _, node := range statements {
+		switch node.Name {
+
+		case parser.NodeASSIGN, parser.NodeLET, parser.NodeCONST, parser.NodeFUNC:
+			define(node.Children[0])
+
+		case parser.NodeIMPORT:
+			if c := node.Children[1]; c.Name == parser.NodeIMPORTLIST {
+				for _, s := range c.Children {
+					_, alias := importSymbol(s)
+					define(alias)
+				}
+			} else {
+				define(c)
+			}
+		}
+	}
+
+	return res
+}
+
 // Not Implemented Runtime
 // =======================
 
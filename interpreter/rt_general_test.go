@@ -99,6 +99,112 @@ statements
 		return
 	}
 
+	// Import selected symbols
+
+	vs = scope.NewScope(scope.GlobalScope)
+
+	il.Files["lib/strutil"] = `
+func capitalize(s) {
+    return "{{s}}!"
+}
+pad := func(s) {
+    return " {{s}}"
+}
+let [x, y] := [1, 2]
+const Max := 10
+import "foo/bar" (b)
+`
+
+	res, err = UnitTestEvalAndASTAndImport(
+		`
+	   import "lib/strutil" (capitalize, pad as padLeft, y, Max, b as c)
+	   a := padLeft(capitalize("test"))`, vs,
+		`
+statements
+  import
+    string: 'lib/strutil'
+    importlist
+      identifier: capitalize
+      as
+        identifier: pad
+        identifier: padLeft
+      identifier: y
+      identifier: Max
+      as
+        identifier: b
+        identifier: c
+  :=
+    identifier: a
+    identifier: padLeft
+      funccall
+        identifier: capitalize
+          funccall
+            string: 'test'
+`[1:], il)
+
+	if vsRes := vs.String(); err != nil || res != nil || vsRes != `GlobalScope {
+    Max (float64) : 10
+    a (string) :  test!
+    c (float64) : 123
+    capitalize (*interpreter.function) : ecal.function: capitalize (Line 2, Pos 1)
+    padLeft (*interpreter.function) : ecal.function:  (Line 5, Pos 8)
+    y (float64) : 2
+}` {
+		t.Error("Unexpected result: ", vsRes, res, err)
+		return
+	}
+
+	_, err = UnitTestEvalAndASTAndImport(`import "lib/strutil" (capitalize, trim)`, vs, "", il)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Symbol trim is not defined in lib/strutil) (Line:1 Pos:35)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Variables of nested blocks are not visible
+
+	il.Files["lib/dynamic"] = `
+if true {
+    z := 1
+}
+`
+
+	_, err = UnitTestEvalAndASTAndImport(`import "lib/dynamic" (z)`, vs, "", il)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Symbol z is not defined in lib/dynamic) (Line:1 Pos:23)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Relative imports are resolved against the importing code
+
+	vs = scope.NewScope(scope.GlobalScope)
+
+	il.Files["lib/sub/a"] = `
+import "../b" as b
+import "./c" (c)
+a := b.b + c
+`
+	il.Files["lib/b"] = `b := 1`
+	il.Files["lib/sub/c"] = `c := 2`
+	il.Files["lib/sub/d"] = `import "../../../foo" as foo`
+
+	_, err = UnitTestEvalAndASTAndImport(`import "lib/sub/a" (a)`, vs, "", il)
+
+	if vsRes := vs.String(); err != nil || vsRes != `GlobalScope {
+    a (float64) : 3
+}` {
+		t.Error("Unexpected result: ", vsRes, err)
+		return
+	}
+
+	_, err = UnitTestEvalAndASTAndImport(`import "./lib/sub/d" as d`, vs, "", il)
+
+	if err == nil || err.Error() != "Import path is outside of code root: ../../../foo (imported from lib/sub/d)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
 	n, _ := parser.Parse("a", "a")
 	imp := &importRuntime{newBaseRuntime(NewECALRuntimeProvider("a", nil, nil), n)}
 	n.Runtime = imp
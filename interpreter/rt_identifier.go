@@ -13,6 +13,7 @@ package interpreter
 import (
 	"fmt"
 	"strings"
+	"sync/atomic"
 
 	"github.com/krotik/common/stringutil"
 	"github.com/krotik/ecal/parser"
@@ -26,13 +27,52 @@ identifierRuntime is the runtime component for identifiers.
 */
 type identifierRuntime struct {
 	*baseRuntime
+	funcName string            // Name of a stdlib or inbuild function which is called by this identifier
+	funcObj  util.ECALFunction // Function object which was resolved during validation
 }
 
 /*
 identifierRuntimeInst returns a new runtime component instance.
 */
 func identifierRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
-	return &identifierRuntime{newBaseRuntime(erp, node)}
+	return &identifierRuntime{newBaseRuntime(erp, node), "", nil}
+}
+
+/*
+Validate this node and all its child nodes.
+*/
+func (rt *identifierRuntime) Validate() error {
+	err := rt.baseRuntime.Validate()
+
+	if err == nil && rt.erp.optimizing() {
+		var name string
+
+		// Pre-resolve calls of stdlib and inbuild functions (e.g. len(x) or math.floor(x))
+
+		if len(rt.node.Children) > 0 {
+			if c := rt.node.Children[0]; c.Name == parser.NodeFUNCCALL {
+				name = rt.node.Token.Val
+			} else if c.Name == parser.NodeIDENTIFIER && len(c.Children) > 0 &&
+				c.Children[0].Name == parser.NodeFUNCCALL {
+				name = fmt.Sprintf("%v.%v", rt.node.Token.Val, c.Token.Val)
+			}
+		}
+
+		if name != "" {
+			funcObj, ok := stdlib.GetStdlibFunc(name)
+
+			if !ok {
+				funcObj, ok = InbuildFuncMap[name]
+			}
+
+			if ok {
+				rt.funcName = name
+				rt.funcObj = funcObj
+			}
+		}
+	}
+
+	return err
 }
 
 /*
@@ -183,7 +223,13 @@ func (rt *identifierRuntime) resolveFunctionObject(astring string, result interf
 
 		funcObj, ok = result.(util.ECALFunction)
 
-		if !ok {
+		if !ok && rt.funcObj != nil && astring == rt.funcName {
+
+			// Use the function which was resolved during validation
+
+			funcObj, ok = rt.funcObj, true
+
+		} else if !ok {
 
 			// Check for stdlib function
 
@@ -228,16 +274,39 @@ func (rt *identifierRuntime) executeFunction(astring string, funcObj util.ECALFu
 			rt.erp.Logger.LogDebug(args...)
 		}
 
+	} else if f, ok := funcObj.(*function); ok && !f.generator && is[tailCallState] == true {
+
+		// The call is in tail position - the calling function executes it
+
+		result = &tailCall{f, args}
+
 	} else {
 
+		// Stop runaway recursion before the Go stack is exhausted
+
+		if !rt.erp.enterCall(tid) {
+			return nil, rt.erp.NewRuntimeError(util.ErrMaxCallDepth,
+				fmt.Sprintf("Call depth limit is %v", atomic.LoadInt32(&rt.erp.maxCallDepth)), node)
+		}
+
+		defer rt.erp.leaveCall(tid)
+
 		if rt.erp.Debugger != nil {
 			rt.erp.Debugger.VisitStepInState(node, vs, tid)
 		}
 
+		if rt.erp.Profiler != nil {
+			rt.erp.Profiler.StepIn(astring, tid)
+		}
+
 		// Execute the function
 
 		result, err = funcObj.Run(rt.instanceID, vs, is, tid, args)
 
+		if rt.erp.Profiler != nil {
+			rt.erp.Profiler.StepOut(node, tid)
+		}
+
 		if rt.erp.Debugger != nil {
 			rt.erp.Debugger.VisitStepOutState(node, vs, tid, err)
 		}
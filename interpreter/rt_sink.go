@@ -11,10 +11,17 @@
 package interpreter
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/krotik/common/stringutil"
+	"github.com/krotik/ecal/config"
 	"github.com/krotik/ecal/engine"
 	"github.com/krotik/ecal/parser"
 	"github.com/krotik/ecal/scope"
@@ -48,10 +55,16 @@ func (rt *sinkRuntime) Validate() error {
 		for _, child := range rt.node.Children[1:] {
 			switch child.Name {
 			case parser.NodeKINDMATCH:
+				err = rt.validateKindMatch(child)
 			case parser.NodeSCOPEMATCH:
 			case parser.NodeSTATEMATCH:
 			case parser.NodePRIORITY:
 			case parser.NodeSUPPRESSES:
+			case parser.NodeDEDUP:
+			case parser.NodeCOLLECT:
+			case parser.NodeTIMEOUT:
+			case parser.NodeRETRIES:
+			case parser.NodeBACKOFF:
 			case parser.NodeSTATEMENTS:
 				continue
 			default:
@@ -69,6 +82,92 @@ func (rt *sinkRuntime) Validate() error {
 	return err
 }
 
+/*
+validateKindMatch checks all kind matches of a sink which can be determined
+without evaluating code. These are string constants, constants declared with
+const (including members of enum constants) and calls of kind() with
+string constant parameters.
+*/
+func (rt *sinkRuntime) validateKindMatch(child *parser.ASTNode) error {
+	var err error
+
+	list := child.Children[0]
+
+	if list.Name != parser.NodeLIST {
+		return nil
+	}
+
+	for _, item := range list.Children {
+		var kind *parser.ASTNode
+
+		if item.Name == parser.NodeSTRING {
+			kind = item
+
+		} else if item.Name == parser.NodeIDENTIFIER {
+
+			if decl, ok := rt.erp.getConstant(item.Token.Val); ok {
+				value := decl.Children[1]
+
+				if value.Name != parser.NodeENUM {
+					if len(item.Children) == 0 {
+						kind = value
+					}
+
+				} else if len(item.Children) > 0 && item.Children[0].Name == parser.NodeIDENTIFIER {
+					member := item.Children[0].Token.Val
+					found := false
+
+					for _, c := range value.Children {
+						if c.Name == parser.NodeASSIGN {
+							if c.Children[0].Token.Val == member {
+								found, kind = true, c.Children[1]
+							}
+						} else if c.Token.Val == member {
+							found = true
+						}
+					}
+
+					if !found {
+						err = rt.erp.NewRuntimeError(util.ErrVarAccess,
+							fmt.Sprintf("Constant %v has no member %v", item.Token.Val, member), item)
+					}
+				}
+
+			} else if item.Token.Val == "kind" && len(item.Children) == 1 &&
+				item.Children[0].Name == parser.NodeFUNCCALL {
+
+				var parts []interface{}
+
+				for _, p := range item.Children[0].Children {
+					if p.Name != parser.NodeSTRING {
+						parts = nil
+						break
+					}
+					parts = append(parts, p.Token.Val)
+				}
+
+				if parts != nil {
+					if _, kerr := joinKind(parts); kerr != nil {
+						err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct, kerr.Error(), item)
+					}
+				}
+			}
+		}
+
+		if err == nil && kind != nil && kind.Name == parser.NodeSTRING {
+			if kerr := checkKind(kind.Token.Val); kerr != nil {
+				err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct, kerr.Error(), item)
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	return err
+}
+
 /*
 Eval evaluate this runtime component.
 */
@@ -77,9 +176,11 @@ func (rt *sinkRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint
 
 	if err == nil {
 		var rule *engine.Rule
+		var settings *sinkSettings
 		var statements *parser.ASTNode
+		var timeout time.Duration
 
-		rule, statements, err = rt.createRule(vs, is, tid)
+		rule, settings, statements, timeout, err = rt.createRule(vs, is, tid)
 
 		if err == nil && statements != nil {
 
@@ -89,77 +190,157 @@ func (rt *sinkRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint
 				rule.Desc = strings.TrimSpace(rt.node.Meta[0].Value())
 			}
 
-			rule.Action = func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error { // Action of the rule
+			rule.Action = newSinkAction(rt.erp, rt.node, rule, vs, timeout,
+				func(sinkVS parser.Scope, sinkIs map[string]interface{}, tid uint64) error {
+					_, err := statements.Runtime.Eval(sinkVS, sinkIs, tid)
+					return err
+				})
 
-				// Create a new root variable scope
+			if err = rt.erp.Processor.AddRule(rule); err == nil {
+				err = settings.apply(rt.erp.Processor, rule.Name)
+			}
 
-				sinkVS := scope.NewScope(fmt.Sprintf("sink: %v", rule.Name))
+			if err != nil {
+				err = rt.erp.NewRuntimeError(util.ErrInvalidState, err.Error(), rt.node)
+			}
+		}
+	}
 
-				// Create a new instance state with the monitor - everything called
-				// by the rule will have access to the current monitor.
+	return nil, err
+}
 
-				sinkIs := map[string]interface{}{
-					"monitor": m,
-				}
+/*
+cascadeScopeKey is the key of the cascade scope in the context of a root monitor.
+*/
+const cascadeScopeKey = "ecal.cascade"
 
-				err = sinkVS.SetValue("event", map[interface{}]interface{}{
-					"name":  e.Name(),
-					"kind":  strings.Join(e.Kind(), engine.RuleKindSeparator),
-					"state": e.State(),
-				})
+/*
+cascadeScope is an object which is shared by all sinks of an event cascade. It
+is stored in the context of the root monitor. Reading and writing of fields is
+protected by a lock.
+*/
+type cascadeScope struct {
+	lock *sync.RWMutex               // Lock for the fields
+	data map[interface{}]interface{} // Fields of the cascade scope
+}
 
-				if err == nil {
-					scope.SetParentOfScope(sinkVS, vs)
+/*
+cascadeScopeOf returns the cascade scope of the event cascade of a given monitor.
+*/
+func cascadeScopeOf(m engine.Monitor) *cascadeScope {
+	return m.RootMonitor().ContextValue(cascadeScopeKey, func() interface{} {
+		return &cascadeScope{&sync.RWMutex{}, make(map[interface{}]interface{})}
+	}).(*cascadeScope)
+}
 
-					if _, err = statements.Runtime.Eval(sinkVS, sinkIs, tid); err != nil {
+/*
+GetField returns the value of a field.
+*/
+func (cs *cascadeScope) GetField(name string) (interface{}, bool, error) {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
 
-						if sre, ok := err.(*util.RuntimeErrorWithDetail); ok {
-							sre.Environment = sinkVS
+	val, ok := cs.data[name]
 
-						} else {
-							var data interface{}
-							rerr := rt.erp.NewRuntimeError(util.ErrSink, err.Error(), rt.node).(*util.RuntimeError)
+	return val, ok, nil
+}
 
-							if e, ok := err.(*util.RuntimeError); ok {
-								rerr = e
-							} else if r, ok := err.(*returnValue); ok {
-								rerr = r.RuntimeError
-								data = r.returnValue
-							}
+/*
+SetField sets the value of a field.
+*/
+func (cs *cascadeScope) SetField(name string, value interface{}) error {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
 
-							// Provide additional information for unexpected errors
+	cs.data[name] = value
 
-							err = &util.RuntimeErrorWithDetail{
-								RuntimeError: rerr,
-								Environment:  sinkVS,
-								Data:         data,
-							}
-						}
-					}
-				}
+	return nil
+}
 
-				return err
-			}
+/*
+FieldNames returns the names of all fields.
+*/
+func (cs *cascadeScope) FieldNames() []string {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
 
-			if err = rt.erp.Processor.AddRule(rule); err != nil {
-				err = rt.erp.NewRuntimeError(util.ErrInvalidState, err.Error(), rt.node)
-			}
-		}
+	names := make([]string, 0, len(cs.data))
+
+	for k := range cs.data {
+		names = append(names, fmt.Sprint(k))
 	}
 
-	return nil, err
+	sort.Strings(names)
+
+	return names
+}
+
+/*
+String returns a string representation of this cascade scope.
+*/
+func (cs *cascadeScope) String() string {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+
+	return stringutil.ConvertToString(cs.data)
+}
+
+/*
+MarshalJSON returns a JSON representation of the fields of this cascade scope.
+*/
+func (cs *cascadeScope) MarshalJSON() ([]byte, error) {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+
+	return json.Marshal(stringutil.ConvertToJSONMarshalableObject(cs.data))
 }
 
 /*
-createRule creates a rule for the ECA engine.
+sinkSettings are the runtime settings of a sink which are kept by the processor.
+*/
+type sinkSettings struct {
+	dedup   *engine.RuleDedup   // Deduplication of events
+	collect *engine.RuleCollect // Aggregation of events
+	retry   *engine.RuleRetry   // Retry policy for failing actions
+}
+
+/*
+apply sets the settings for the rule of a sink in a given processor.
+*/
+func (s *sinkSettings) apply(p engine.Processor, name string) error {
+	var err error
+
+	if s.dedup != nil {
+		err = p.SetRuleDedup(name, s.dedup)
+	}
+
+	if err == nil && s.collect != nil {
+		err = p.SetRuleCollect(name, s.collect)
+	}
+
+	if err == nil && s.retry != nil {
+		err = p.SetRuleRetry(name, s.retry)
+	}
+
+	return err
+}
+
+/*
+createRule creates a rule for the ECA engine. Returns the rule, the runtime
+settings of the sink, the statements of the sink and the timeout of the sink.
 */
 func (rt *sinkRuntime) createRule(vs parser.Scope, is map[string]interface{},
-	tid uint64) (*engine.Rule, *parser.ASTNode, error) {
+	tid uint64) (*engine.Rule, *sinkSettings, *parser.ASTNode, time.Duration, error) {
 
 	var kindMatch, scopeMatch, suppresses []string
 	var stateMatch map[string]interface{}
 	var priority int
+	var dedup *engine.RuleDedup
+	var collect *engine.RuleCollect
 	var statements *parser.ASTNode
+	var timeout, backoff time.Duration
+	var retry *engine.RuleRetry
+	var backoffNode *parser.ASTNode
 	var err error
 
 	// Create default scope
@@ -177,7 +358,7 @@ func (rt *sinkRuntime) createRule(vs parser.Scope, is map[string]interface{},
 		switch child.Name {
 
 		case parser.NodeKINDMATCH:
-			kindMatch, err = rt.makeStringList(child, vs, is, tid)
+			kindMatch, err = rt.makeKindMatch(child, vs, is, tid)
 			break
 
 		case parser.NodeSCOPEMATCH:
@@ -186,11 +367,10 @@ func (rt *sinkRuntime) createRule(vs parser.Scope, is map[string]interface{},
 
 		case parser.NodeSTATEMATCH:
 			var val interface{}
-			stateMatch = make(map[string]interface{})
 
 			if val, err = child.Runtime.Eval(vs, is, tid); err == nil {
-				for k, v := range val.(map[interface{}]interface{}) {
-					stateMatch[fmt.Sprint(k)] = v
+				if stateMatch, err = makeStateMatch(val.(map[interface{}]interface{})); err != nil {
+					err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct, err.Error(), child)
 				}
 			}
 			break
@@ -207,6 +387,63 @@ func (rt *sinkRuntime) createRule(vs parser.Scope, is map[string]interface{},
 			suppresses, err = rt.makeStringList(child, vs, is, tid)
 			break
 
+		case parser.NodeDEDUP:
+			dedup, err = rt.makeDedup(child, vs, is, tid)
+			break
+
+		case parser.NodeCOLLECT:
+			var val interface{}
+
+			if val, err = child.Runtime.Eval(vs, is, tid); err == nil {
+				if window := val.(float64); window > 0 {
+					collect = engine.NewRuleCollect(time.Duration(window * float64(time.Second)))
+				} else {
+					err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
+						"Collect needs a positive window (in seconds)", child)
+				}
+			}
+			break
+
+		case parser.NodeTIMEOUT:
+			var val interface{}
+
+			if val, err = child.Runtime.Eval(vs, is, tid); err == nil {
+				if secs := val.(float64); secs > 0 {
+					timeout = time.Duration(secs * float64(time.Second))
+				} else {
+					err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
+						"Timeout needs a positive duration (in seconds)", child)
+				}
+			}
+			break
+
+		case parser.NodeRETRIES:
+			var val interface{}
+
+			if val, err = child.Runtime.Eval(vs, is, tid); err == nil {
+				if retries := val.(float64); retries >= 1 && retries == math.Floor(retries) {
+					retry = engine.NewRuleRetry(int(retries), 0)
+				} else {
+					err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
+						"Retries needs a positive whole number", child)
+				}
+			}
+			break
+
+		case parser.NodeBACKOFF:
+			var val interface{}
+
+			if val, err = child.Runtime.Eval(vs, is, tid); err == nil {
+				if secs := val.(float64); secs >= 0 {
+					backoff = time.Duration(secs * float64(time.Second))
+					backoffNode = child
+				} else {
+					err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
+						"Backoff needs a duration (in seconds)", child)
+				}
+			}
+			break
+
 		case parser.NodeSTATEMENTS:
 			statements = child
 			break
@@ -217,6 +454,15 @@ func (rt *sinkRuntime) createRule(vs parser.Scope, is map[string]interface{},
 		}
 	}
 
+	if err == nil && backoffNode != nil {
+		if retry != nil {
+			retry.Backoff = backoff
+		} else {
+			err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
+				"Backoff needs a number of retries", backoffNode)
+		}
+	}
+
 	return &engine.Rule{
 		Name:            sinkName,   // Name
 		KindMatch:       kindMatch,  // Kind match
@@ -224,7 +470,217 @@ func (rt *sinkRuntime) createRule(vs parser.Scope, is map[string]interface{},
 		StateMatch:      stateMatch, // No state match
 		Priority:        priority,   // Priority of the rule
 		SuppressionList: suppresses, // List of suppressed rules by this rule
-	}, statements, err
+	}, &sinkSettings{dedup, collect, retry}, statements, timeout, err
+}
+
+/*
+makeStateMatch converts an ECAL map into the state match of a rule. Maps in
+the values are conditions with operators (e.g. { ">" : 30 }).
+*/
+func makeStateMatch(val map[interface{}]interface{}) (map[string]interface{}, error) {
+	stateMatch := make(map[string]interface{})
+
+	for k, v := range val {
+
+		if spec, ok := v.(map[interface{}]interface{}); ok {
+			condSpec := make(map[string]interface{})
+
+			for op, opVal := range spec {
+				condSpec[fmt.Sprint(op)] = opVal
+			}
+
+			cond, err := engine.NewRuleStateCondition(condSpec)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid state condition for %v: %v", k, err)
+			}
+
+			v = cond
+		}
+
+		stateMatch[fmt.Sprint(k)] = v
+	}
+
+	return stateMatch, nil
+}
+
+/*
+newSinkAction creates the action of a sink rule. For each event the given run
+function is called with a new variable scope, which contains the event and
+has the given scope as parent, and with a new instance state, which contains
+the current monitor. The event contains the cascade scope of the root monitor.
+A value which is returned by the sink is recorded as the result of the rule in
+the monitor. Errors are returned with the sink environment. A sink which runs
+longer than the given timeout (or the SinkTimeout config value if no timeout is
+given) is aborted with a timeout error at the next statement.
+*/
+func newSinkAction(erp *ECALRuntimeProvider, node *parser.ASTNode, rule *engine.Rule, vs parser.Scope,
+	timeout time.Duration, run func(sinkVS parser.Scope, sinkIs map[string]interface{}, tid uint64) error) engine.RuleAction {
+
+	return func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error {
+
+		// Create a new root variable scope
+
+		sinkVS := scope.NewScope(fmt.Sprintf("sink: %v", rule.Name))
+
+		// Create a new instance state with the monitor - everything called
+		// by the rule will have access to the current monitor.
+
+		sinkIs := map[string]interface{}{
+			"monitor": m,
+		}
+
+		kindParams := make(map[interface{}]interface{})
+
+		for k, v := range rule.KindParams(e) {
+
+			// Segments of unnamed wildcards are stored under their position
+
+			if pos, err := strconv.Atoi(k); err == nil {
+				kindParams[float64(pos)] = v
+			} else {
+				kindParams[k] = v
+			}
+		}
+
+		err := sinkVS.SetValue("event", map[interface{}]interface{}{
+			"name":       e.Name(),
+			"kind":       strings.Join(e.Kind(), engine.RuleKindSeparator),
+			"kindparams": kindParams,
+			"state":      e.State(),
+			"cascade":    cascadeScopeOf(m),
+		})
+
+		if err == nil {
+			scope.SetParentOfScope(sinkVS, vs)
+
+			if erp.Profiler != nil {
+				erp.Profiler.StepIn(fmt.Sprintf("sink %v", rule.Name), tid)
+			}
+
+			sinkTimeout := timeout
+
+			if sinkTimeout == 0 {
+				sinkTimeout = time.Duration(config.Int(config.SinkTimeout)) * time.Second
+			}
+
+			if sinkTimeout > 0 {
+				deadline := time.Now().Add(sinkTimeout)
+				prev := erp.deadline(tid)
+
+				// Sinks which are run within other sinks (e.g. by invokeSink)
+				// cannot extend the deadline of the calling sink
+
+				if !prev.IsZero() && prev.Before(deadline) {
+					deadline = prev
+				}
+
+				erp.setDeadline(tid, deadline)
+				defer erp.setDeadline(tid, prev)
+			}
+
+			err = run(sinkVS, sinkIs, tid)
+
+			if erp.Profiler != nil {
+				erp.Profiler.StepOut(nil, tid)
+			}
+
+			if r, ok := err.(*returnValue); ok {
+				m.SetResult(rule.Name, r.returnValue)
+				err = nil
+			}
+
+			if err != nil {
+
+				if sre, ok := err.(*util.RuntimeErrorWithDetail); ok {
+					sre.Environment = sinkVS
+
+				} else {
+					rerr := erp.NewRuntimeError(util.ErrSink, err.Error(), node).(*util.RuntimeError)
+
+					if e, ok := err.(*util.RuntimeError); ok {
+						rerr = e
+					}
+
+					// Provide additional information for unexpected errors
+
+					err = &util.RuntimeErrorWithDetail{
+						RuntimeError: rerr,
+						Environment:  sinkVS,
+					}
+				}
+			}
+		}
+
+		return err
+	}
+}
+
+/*
+makeDedup evaluates a given child node into a deduplication object. The child
+node should be a map with a window (in seconds) and an optional key which can
+be a state key or a list of state keys.
+*/
+func (rt *sinkRuntime) makeDedup(child *parser.ASTNode, vs parser.Scope,
+	is map[string]interface{}, tid uint64) (*engine.RuleDedup, error) {
+
+	var keys []string
+
+	val, err := child.Runtime.Eval(vs, is, tid)
+
+	if err == nil {
+		spec := val.(map[interface{}]interface{})
+		window, ok := spec["window"].(float64)
+
+		if !ok || window <= 0 {
+			return nil, rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
+				"Dedup needs a positive window (in seconds)", child)
+		}
+
+		switch key := spec["key"].(type) {
+		case nil:
+		case []interface{}:
+			for _, k := range key {
+				keys = append(keys, fmt.Sprint(k))
+			}
+		default:
+			keys = []string{fmt.Sprint(key)}
+		}
+
+		return engine.NewRuleDedup(time.Duration(window*float64(time.Second)), keys), nil
+	}
+
+	return nil, err
+}
+
+/*
+makeKindMatch evaluates a given child node into a list of kind matches.
+*/
+func (rt *sinkRuntime) makeKindMatch(child *parser.ASTNode, vs parser.Scope,
+	is map[string]interface{}, tid uint64) ([]string, error) {
+
+	var ret []string
+
+	val, err := child.Runtime.Eval(vs, is, tid)
+
+	if err == nil {
+		for _, v := range val.([]interface{}) {
+			kind, ok := v.(string)
+
+			if !ok {
+				err = fmt.Errorf("Kind match must be a string: %v", v)
+			} else {
+				err = checkKind(kind)
+			}
+
+			if err != nil {
+				return nil, rt.erp.NewRuntimeError(util.ErrInvalidConstruct, err.Error(), child)
+			}
+
+			ret = append(ret, kind)
+		}
+	}
+
+	return ret, err
 }
 
 /*
@@ -246,6 +702,38 @@ func (rt *sinkRuntime) makeStringList(child *parser.ASTNode, vs parser.Scope,
 	return ret, err
 }
 
+/*
+checkKind checks that a given event kind or kind match has no empty segments.
+*/
+func checkKind(kind string) error {
+	for _, segment := range strings.Split(kind, engine.RuleKindSeparator) {
+		if segment == "" {
+			return fmt.Errorf("Kind %v contains an empty segment", strconv.Quote(kind))
+		}
+	}
+
+	return nil
+}
+
+/*
+joinKind joins the given parts into an event kind.
+*/
+func joinKind(parts []interface{}) (string, error) {
+	var segments []string
+
+	if len(parts) == 0 {
+		return "", fmt.Errorf("Need at least one part for a kind")
+	}
+
+	for _, p := range parts {
+		segments = append(segments, fmt.Sprint(p))
+	}
+
+	kind := strings.Join(segments, engine.RuleKindSeparator)
+
+	return kind, checkKind(kind)
+}
+
 // Sink child nodes
 // ================
 
@@ -286,7 +774,7 @@ func (rt *sinkDetailRuntime) Eval(vs parser.Scope, is map[string]interface{}, ti
 						rt.node)
 				}
 
-			} else if rt.valType == "int" {
+			} else if rt.valType == "int" || rt.valType == "number" {
 
 				if _, ok := ret.(float64); !ok {
 					return nil, rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
@@ -334,3 +822,38 @@ suppressesRuntimeInst returns a new runtime component instance.
 func suppressesRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
 	return &sinkDetailRuntime{newBaseRuntime(erp, node), "list"}
 }
+
+/*
+dedupRuntimeInst returns a new runtime component instance.
+*/
+func dedupRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &sinkDetailRuntime{newBaseRuntime(erp, node), "map"}
+}
+
+/*
+collectRuntimeInst returns a new runtime component instance.
+*/
+func collectRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &sinkDetailRuntime{newBaseRuntime(erp, node), "number"}
+}
+
+/*
+retriesRuntimeInst returns a new runtime component instance.
+*/
+func retriesRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &sinkDetailRuntime{newBaseRuntime(erp, node), "number"}
+}
+
+/*
+backoffRuntimeInst returns a new runtime component instance.
+*/
+func backoffRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &sinkDetailRuntime{newBaseRuntime(erp, node), "number"}
+}
+
+/*
+timeoutRuntimeInst returns a new runtime component instance.
+*/
+func timeoutRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &sinkDetailRuntime{newBaseRuntime(erp, node), "number"}
+}
@@ -11,10 +11,16 @@
 package interpreter
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/krotik/ecal/config"
 	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/util"
 )
 
 func TestEventProcessing(t *testing.T) {
@@ -143,20 +149,16 @@ rule2 - Tracking user:foo
 rule3 - Logging user:foo
 ErrorResult:[
   {
-    "errors": {
-      "rule3": {
-        "data": 123,
-        "detail": "Return value: 123",
-        "error": "ECAL error in ECALTestRuntime (ECALEvalTest): *** return *** (Return value: 123) (Line:26 Pos:9)",
-        "type": "*** return ***"
-      }
-    },
+    "errors": {},
     "event": {
       "kind": "web.log",
       "name": "Rule1Event2",
       "state": {
         "user": "foo"
       }
+    },
+    "results": {
+      "rule3": 123
     }
   }
 ] false
@@ -179,7 +181,8 @@ ErrorResult:[
       "state": {
         "user": "bar"
       }
-    }
+    },
+    "results": {}
   }
 ] false`[1:] {
 		t.Error("Unexpected result:", testlogger.String())
@@ -394,4 +397,752 @@ sink test
 		return
 	}
 
+	_, err = UnitTestEval(
+		`
+sink test
+    kindmatch [ "foo" ],
+    dedup { "key" : "id" },
+	{
+        log("rule1 - Handling request: ", event.kind)
+	}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Dedup needs a positive window (in seconds)) (Line:4 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(
+		`
+sink test
+    kindmatch [ "foo" ],
+    collect 0,
+	{
+        log("rule1 - Handling request: ", event.kind)
+	}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Collect needs a positive window (in seconds)) (Line:4 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(
+		`
+sink test
+    kindmatch [ "foo" ],
+    collect "10",
+	{
+        log("rule1 - Handling request: ", event.kind)
+	}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Expected a number as value) (Line:4 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestSinkResults(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink lookup
+    kindmatch [ "user.lookup" ],
+	{
+        addEvent("audit", "user.audit", event.state)
+        return { "name" : "Bob", "id" : event.state.id }
+	}
+
+sink audit
+    kindmatch [ "user.audit" ],
+	{
+        return "audited {{event.state.id}}"
+	}
+
+sink check
+    kindmatch [ "user.lookup" ],
+    priority 1,
+	{
+        if event.state.id == 2 {
+            raise("NotFound", "Unknown user", event.state.id)
+        }
+        return
+	}
+
+res := addEventAndWait("request", "user.lookup", { "id" : 1 })
+user := res[0].results.lookup
+audit := res[1].results.audit
+
+res2 := addEventAndWait("request", "user.lookup", { "id" : 2 })
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	obj := scope.ToObject(vs)
+
+	if res := fmt.Sprint(obj["user"], " ", obj["audit"], " ", len(obj["res"].([]interface{}))); res != "map[id:1 name:Bob] audited 1 2" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	res2 := obj["res2"].([]interface{})[0].(map[interface{}]interface{})
+
+	if res := fmt.Sprint(res2["results"], " ", res2["errors"].(map[interface{}]interface{})["check"].(map[interface{}]interface{})["type"]); res != "map[lookup:map[id:2 name:Bob]] NotFound" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestSinkCascadeScope(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink order
+    kindmatch [ "order" ],
+	{
+        event.cascade.total := 0
+        event.cascade.items := []
+        for i in range(1, 10) {
+            addEvent("item", "order.item", { "price" : i })
+        }
+	}
+
+sink item
+    kindmatch [ "order.item" ],
+	{
+        mutex cascade {
+            event.cascade.total := event.cascade.total + event.state.price
+            event.cascade.items := add(event.cascade.items, event.state.price)
+            if len(event.cascade.items) == 10 {
+                addEvent("summary", "order.summary", {})
+            }
+        }
+	}
+
+sink summary
+    kindmatch [ "order.summary" ],
+	{
+        return [event.cascade.total, len(event.cascade.items), event.cascade.foo]
+	}
+
+res1 := addEventAndWait("order1", "order", {})
+res2 := addEventAndWait("order2", "order", {})
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	obj := scope.ToObject(vs)
+
+	for _, name := range []string{"res1", "res2"} {
+		res := obj[name].([]interface{})
+		last := res[len(res)-1].(map[interface{}]interface{})
+
+		if res := fmt.Sprint(len(res), " ", last["results"]); res != "1 map[summary:[55 10 <nil>]]" {
+			t.Error("Unexpected result:", name, res)
+			return
+		}
+	}
+
+	cs := &cascadeScope{&sync.RWMutex{}, map[interface{}]interface{}{}}
+
+	cs.SetField("b", 1.0)
+	cs.SetField("a", []interface{}{"x"})
+
+	if res, _ := json.Marshal(cs); fmt.Sprint(cs.FieldNames(), " ", cs, " ", string(res)) !=
+		`[a b] {"a":["x"],"b":1} {"a":["x"],"b":1}` {
+		t.Error("Unexpected result:", cs.FieldNames(), cs, string(res))
+		return
+	}
+}
+
+func TestSinkDedup(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink sensor
+    kindmatch [ "sensor.temp" ],
+    dedup { "window" : 60, "key" : ["id", "reading.value"] },
+	{
+        log("sensor ", event.state.id, " ", event.state.reading.value)
+	}
+
+sink all
+    kindmatch [ "sensor.humidity" ],
+    dedup { "window" : 0.05 },
+	{
+        log("humidity ", event.state.value)
+	}
+
+addEventAndWait("t1", "sensor.temp", {"id" : 1, "reading" : {"value" : 20, "ts" : 1}})
+addEventAndWait("t2", "sensor.temp", {"id" : 1, "reading" : {"value" : 20, "ts" : 2}})
+addEventAndWait("t3", "sensor.temp", {"id" : 2, "reading" : {"value" : 20, "ts" : 3}})
+addEventAndWait("t4", "sensor.temp", {"id" : 1, "reading" : {"value" : 21, "ts" : 4}})
+addEventAndWait("t5", "sensor.temp", {"id" : 2, "reading" : {"value" : 20, "ts" : 5}})
+
+addEventAndWait("h1", "sensor.humidity", {"value" : 50})
+addEventAndWait("h2", "sensor.humidity", {"value" : 50})
+addEventAndWait("h3", "sensor.humidity", {"value" : 51})
+sleep(100ms)
+addEventAndWait("h4", "sensor.humidity", {"value" : 50})
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if testlogger.String() != `
+sensor 1 20
+sensor 2 20
+sensor 1 21
+humidity 50
+humidity 51
+humidity 50`[1:] {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+}
+
+func TestSinkCollect(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink collector
+    kindmatch [ "sensor.*" ],
+    collect 0.05,
+	{
+        names := []
+        for e in event.state.events {
+            names := add(names, e.name)
+        }
+        log("collected ", event.name, " ", names, " ", event.state.events[0].kind)
+	}
+
+addEventAndWait("t1", "sensor.temp", {"value" : 20})
+addEventAndWait("t2", "sensor.temp", {"value" : 21})
+addEventAndWait("h1", "sensor.humidity", {"value" : 50})
+sleep(150ms)
+addEventAndWait("t3", "sensor.temp", {"value" : 22})
+sleep(150ms)
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if testlogger.String() != `
+collected t1 [
+  "t1",
+  "t2",
+  "h1"
+] sensor.temp
+collected t3 [
+  "t3"
+] sensor.temp`[1:] {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+}
+
+func TestSinkKindParams(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink orders
+    kindmatch [ "order.*.created" ],
+	{
+        log("order ", event.kindparams[1])
+	}
+
+sink devices
+    kindmatch [ "device.{id}.temp" ],
+	{
+        log("device ", event.kindparams.id, " ", event.kind)
+	}
+
+sink plain
+    kindmatch [ "plain" ],
+	{
+        log("plain ", len(event.kindparams))
+	}
+
+addEventAndWait("o1", "order.123.created", {})
+addEventAndWait("o2", "order.123.deleted", {})
+addEventAndWait("d1", "device.d42.temp", {})
+addEventAndWait("p1", "plain", {})
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if testlogger.String() != `
+order 123
+device d42 device.d42.temp
+plain 0`[1:] {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+}
+
+func TestSinkKindConstants(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+const OrderCreated := kind("order", "created")
+const Kinds { DEVICE := "device.{id}.temp", PLAIN := "plain" }
+
+sink events
+    kindmatch [ OrderCreated, Kinds.DEVICE, kind("plain") ],
+	{
+        log("sink ", event.kind)
+	}
+
+addEventAndWait("o1", kind("order", "created"), {})
+addEventAndWait("d1", kind("device", "d42", "temp"), {})
+addEventAndWait("p1", Kinds.PLAIN, {})
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if testlogger.String() != `
+sink order.created
+sink device.d42.temp
+sink plain`[1:] {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+
+	_, err = UnitTestEval(
+		`
+const Kinds { ORDER := "order.created" }
+
+sink orders
+    kindmatch [ Kinds.ORDR ],
+	{
+        log("sink ", event.kind)
+	}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Constant Kinds has no member ORDR) (Line:5 Pos:17)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(
+		`
+const OrderCreated := "order..created"
+
+sink orders
+    kindmatch [ OrderCreated ],
+	{
+        log("sink ", event.kind)
+	}
+`, vs)
+
+	if err == nil || err.Error() != `ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Kind "order..created" contains an empty segment) (Line:5 Pos:17)` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(
+		`
+sink orders
+    kindmatch [ kind("order", "") ],
+	{
+        log("sink ", event.kind)
+	}
+`, vs)
+
+	if err == nil || err.Error() != `ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Kind "order." contains an empty segment) (Line:3 Pos:17)` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(
+		`
+k := null
+sink orders
+    kindmatch [ k ],
+	{
+        log("sink ", event.kind)
+	}
+`, vs)
+
+	if err == nil || err.Error() != `ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Kind match must be a string: <nil>) (Line:4 Pos:5)` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(`kind()`, vs)
+
+	if err == nil || err.Error() != `ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Need at least one part for a kind) (Line:1 Pos:1)` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestSinkStateConditions(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink alert
+    kindmatch [ "sensor" ],
+    statematch { "temp" : { ">" : 30 }, "status" : { "not" : "ok" } },
+	{
+        log("alert ", event.name)
+	}
+
+sink range
+    kindmatch [ "sensor" ],
+    statematch { "temp" : { ">=" : 10, "<" : 20 }, "status" : { "in" : [ "ok", "warn" ] } },
+	{
+        log("range ", event.name)
+	}
+
+addEventAndWait("e1", "sensor", {"temp" : 35, "status" : "fail"})
+addEventAndWait("e2", "sensor", {"temp" : 35, "status" : "ok"})
+addEventAndWait("e3", "sensor", {"temp" : 15, "status" : "warn"})
+addEventAndWait("e4", "sensor", {"temp" : 20, "status" : "warn"})
+addEventAndWait("e5", "sensor", {"temp" : 15})
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if testlogger.String() != `
+alert e1
+range e3`[1:] {
+		t.Error("Unexpected result:", testlogger.String())
+		return
+	}
+
+	_, err = UnitTestEval(
+		`
+sink test
+    kindmatch [ "sensor" ],
+    statematch { "temp" : { "~" : 30 } },
+	{
+	}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Invalid state condition for temp: Unknown state condition operator: ~) (Line:4 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestSinkCascadeLimits(t *testing.T) {
+	config.Config[config.MaxKindRepeat] = 5
+	defer func() {
+		config.Config[config.MaxKindRepeat] = config.DefaultConfig[config.MaxKindRepeat]
+	}()
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink echo
+    kindmatch [ "echo" ],
+	{
+        addEvent("echo", "echo", {})
+	}
+
+res := addEventAndWait("echo", "echo", {})
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	res := scope.ToObject(vs)["res"].([]interface{})
+	last := res[len(res)-1].(map[interface{}]interface{})["errors"].(map[interface{}]interface{})
+
+	if res := fmt.Sprint(len(res), " ", last["CascadeAborted"]); res !=
+		"2 map[error:Event kind re-triggers itself in a loop: Event kind echo was added 6 times in a row (limit is 5)]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestSinkConfigChange(t *testing.T) {
+	defer func() {
+		for k, v := range config.DefaultConfig {
+			config.Config[k] = v
+		}
+	}()
+
+	vs := scope.NewScope(scope.GlobalScope)
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+
+	_, err := UnitTestEvalWithRuntimeProvider(
+		`
+sink configchange
+    kindmatch [ "config.change" ],
+	{
+        log("{{event.state.key}}: {{event.state.old}} -> {{event.state.new}}")
+        debug("config changed")
+	}
+`, vs, erp)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	erp.Logger, _ = util.NewLogLevelLogger(testlogger, "info")
+
+	defer config.AddChangeListener(erp.ApplyConfigChange)()
+
+	erp.Processor.Start()
+
+	if err := config.Load(map[string]interface{}{
+		config.WorkerCount:   6,
+		config.QueueWarnSize: 20,
+		config.MaxKindRepeat: 3,
+		config.MaxCallDepth:  50,
+		config.LogLevel:      "debug",
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	erp.Processor.Finish()
+
+	// Config change events are handled concurrently
+
+	lines := strings.Split(testlogger.String(), "\n")
+	sort.Strings(lines)
+
+	if res := strings.Join(lines, "\n"); res != `LogLevel: info -> debug
+MaxCallDepth: 10000 -> 50
+MaxKindRepeat: 0 -> 3
+QueueWarnSize: 10 -> 20
+WorkerCount: 4 -> 6
+debug: Config option LogLevel changed from info to debug
+debug: Config option MaxCallDepth changed from 10000 to 50
+debug: Config option MaxKindRepeat changed from 0 to 3
+debug: Config option QueueWarnSize changed from 10 to 20
+debug: Config option WorkerCount changed from 4 to 6
+debug: config changed
+debug: config changed
+debug: config changed
+debug: config changed
+debug: config changed` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := erp.Processor.Workers(); res != 6 || erp.Processor.ThreadPool().TooManyThreshold != 20 ||
+		erp.maxCallDepth != 50 {
+		t.Error("Unexpected result:", res, erp.Processor.ThreadPool().TooManyThreshold, erp.maxCallDepth)
+		return
+	}
+}
+
+func TestSinkTimeout(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink slow
+    kindmatch [ "slow" ],
+    timeout 50ms,
+	{
+        for true {
+            try {
+                sleep(1s)
+                log("woken")
+            } except e {
+                log("caught ", e.type)
+            }
+        }
+	}
+
+sink quick
+    kindmatch [ "quick" ],
+    timeout 1s,
+	{
+        return "done"
+	}
+
+res := addEventAndWait("slow", "slow", {})
+res2 := addEventAndWait("quick", "quick", {})
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	obj := scope.ToObject(vs)
+	errs := obj["res"].([]interface{})[0].(map[interface{}]interface{})["errors"].(map[interface{}]interface{})
+	res2 := obj["res2"].([]interface{})[0].(map[interface{}]interface{})
+
+	if res := fmt.Sprint(errs["slow"].(map[interface{}]interface{})["type"], " ",
+		errs["slow"].(map[interface{}]interface{})["detail"], " ", res2["results"], " ", res2["errors"]); res !=
+		"Timeout Sink did not finish within its timeout map[quick:done] map[]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// The timeout cannot be handled in the sink
+
+	if res := testlogger.String(); res != "" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Sinks without a timeout use the global timeout
+
+	config.Config[config.SinkTimeout] = 1
+	defer func() {
+		config.Config[config.SinkTimeout] = config.DefaultConfig[config.SinkTimeout]
+	}()
+
+	_, err = UnitTestEval(
+		`
+sink slow
+    kindmatch [ "slow" ],
+	{
+        sleep(1m)
+        log("woken")
+	}
+
+res := addEventAndWait("slow", "slow", {})
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	errs = scope.ToObject(vs)["res"].([]interface{})[0].(map[interface{}]interface{})["errors"].(map[interface{}]interface{})
+
+	if res := fmt.Sprint(errs["slow"].(map[interface{}]interface{})["type"], " ", testlogger.String()); res != "Timeout " {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	_, err = UnitTestEval(
+		`
+sink slow
+    kindmatch [ "slow" ],
+    timeout 0,
+	{
+	}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Timeout needs a positive duration (in seconds)) (Line:4 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestSinkRetries(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(
+		`
+sink flaky
+    kindmatch [ "job.*" ],
+    retries 2,
+    backoff 1ms,
+	{
+        event.cascade.attempts := (event.cascade.attempts ?? 0) + 1
+        if event.cascade.attempts <= event.state.fails {
+            raise("Unavailable", "Attempt {{event.cascade.attempts}} failed")
+        }
+        return event.cascade.attempts
+	}
+
+sink failed
+    kindmatch [ "retry.exhausted" ],
+	{
+        log("{{event.name}} {{event.state.rule}} {{event.state.event.kind}} {{event.state.attempts}}: {{event.state.error}}")
+	}
+
+res := addEventAndWait("job", "job.run", { "fails" : 2 })
+res2 := addEventAndWait("job", "job.run", { "fails" : 5 })
+`, vs)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	obj := scope.ToObject(vs)
+	res := obj["res"].([]interface{})[0].(map[interface{}]interface{})
+	res2 := obj["res2"].([]interface{})[0].(map[interface{}]interface{})
+
+	if res := fmt.Sprint(res["results"], " ", res["errors"], " ",
+		res2["errors"].(map[interface{}]interface{})["flaky"].(map[interface{}]interface{})["detail"]); res !=
+		"map[flaky:3] map[] Attempt 3 failed" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := testlogger.String(); res != "flaky flaky job.run 3: ECAL error in ECALTestRuntime (ECALEvalTest): Unavailable (Attempt 3 failed) (Line:9 Pos:13)" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	_, err = UnitTestEval(
+		`
+sink flaky
+    kindmatch [ "job.*" ],
+    backoff 1ms,
+	{
+	}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Backoff needs a number of retries) (Line:4 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(
+		`
+sink flaky
+    kindmatch [ "job.*" ],
+    retries 1.5,
+	{
+	}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Retries needs a positive whole number) (Line:4 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
 }
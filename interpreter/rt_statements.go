@@ -12,10 +12,14 @@ package interpreter
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/krotik/common/errorutil"
 	"github.com/krotik/common/sortutil"
+	"github.com/krotik/common/stringutil"
 	"github.com/krotik/ecal/parser"
 	"github.com/krotik/ecal/scope"
 	"github.com/krotik/ecal/util"
@@ -29,13 +33,29 @@ statementsRuntime is the runtime component for sequences of statements.
 */
 type statementsRuntime struct {
 	*baseRuntime
+	statements []*parser.ASTNode // Statements which are evaluated
 }
 
 /*
 statementsRuntimeInst returns a new runtime component instance.
 */
 func statementsRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
-	return &statementsRuntime{newBaseRuntime(erp, node)}
+	return &statementsRuntime{newBaseRuntime(erp, node), nil}
+}
+
+/*
+Validate this node and all its child nodes.
+*/
+func (rt *statementsRuntime) Validate() error {
+	err := rt.baseRuntime.Validate()
+
+	rt.statements = rt.node.Children
+
+	if err == nil && rt.erp.optimizing() {
+		rt.statements = flattenStatements(rt.node)
+	}
+
+	return err
 }
 
 /*
@@ -46,7 +66,18 @@ func (rt *statementsRuntime) Eval(vs parser.Scope, is map[string]interface{}, ti
 	_, err := rt.baseRuntime.Eval(vs, is, tid)
 
 	if err == nil {
-		for _, child := range rt.node.Children {
+		for _, child := range rt.statements {
+
+			if cancelled, ok := rt.erp.cancelRequested(tid); ok {
+				return nil, rt.erp.NewRuntimeError(util.ErrCancelled,
+					fmt.Sprintf("Thread %v was cancelled", cancelled), child)
+			}
+
+			if d := rt.erp.deadline(tid); !d.IsZero() && time.Now().After(d) {
+				return nil, rt.erp.NewRuntimeError(util.ErrTimeout,
+					"Sink did not finish within its timeout", child)
+			}
+
 			if res, err = child.Runtime.Eval(vs, is, tid); err != nil {
 				return nil, err
 			}
@@ -204,6 +235,21 @@ func (rt *loopRuntime) Validate() error {
 	return err
 }
 
+/*
+newLoopInstanceState creates a new instance state for a loop. The monitor of a
+sink is kept so events which are added in the loop belong to the event cascade
+of the sink.
+*/
+func newLoopInstanceState(is map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{})
+
+	if m, ok := is["monitor"]; ok {
+		res["monitor"] = m
+	}
+
+	return res
+}
+
 /*
 Eval evaluate this runtime component.
 */
@@ -220,7 +266,7 @@ func (rt *loopRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint
 
 		// Create a new instance scope - elements in each loop iteration start from scratch
 
-		is = make(map[string]interface{})
+		is = newLoopInstanceState(is)
 
 		if rt.node.Children[0].Name == parser.NodeGUARD {
 
@@ -254,7 +300,13 @@ func (rt *loopRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint
 
 		} else if rt.node.Children[0].Name == parser.NodeIN {
 
-			err = rt.handleIterator(vs, is, tid)
+			err = rt.handleIterator(vs, is, tid, func() error {
+
+				// Execute block
+
+				_, err := rt.node.Children[1].Runtime.Eval(vs, is, tid)
+				return err
+			})
 		}
 	}
 
@@ -262,12 +314,17 @@ func (rt *loopRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint
 }
 
 /*
-handleIterator handles iterator functions for loops.
+handleIterator handles iterator functions for loops. The given block function is
+called for every iteration once the loop variables have been set.
 */
-func (rt *loopRuntime) handleIterator(vs parser.Scope, is map[string]interface{}, tid uint64) error {
+func (rt *loopRuntime) handleIterator(vs parser.Scope, is map[string]interface{}, tid uint64, block func() error) error {
 	var res interface{}
 
-	iterator, err := rt.getIterator(vs, is, tid)
+	iterator, closer, err := rt.getIterator(vs, is, tid)
+
+	if closer != nil {
+		defer closer()
+	}
 
 	vars := rt.leftInVarName
 
@@ -304,9 +361,7 @@ func (rt *loopRuntime) handleIterator(vs parser.Scope, is map[string]interface{}
 					err.Error(), rt.node)
 			}
 
-			// Execute block
-
-			_, err = rt.node.Children[1].Runtime.Eval(vs, is, tid)
+			err = block()
 		}
 
 		// Check for continue
@@ -350,10 +405,12 @@ func (rt *loopRuntime) getIteratorValue(iterator func() (interface{}, error)) (i
 }
 
 /*
-getIterator create an iterator object.
+getIterator create an iterator object. Also returns an optional function which
+should be called once the loop has finished.
 */
-func (rt *loopRuntime) getIterator(vs parser.Scope, is map[string]interface{}, tid uint64) (func() (interface{}, error), error) {
+func (rt *loopRuntime) getIterator(vs parser.Scope, is map[string]interface{}, tid uint64) (func() (interface{}, error), func(), error) {
 	var iterator func() (interface{}, error)
+	var closer func()
 
 	it := rt.node.Children[0].Children[1]
 
@@ -374,7 +431,20 @@ func (rt *loopRuntime) getIterator(vs parser.Scope, is map[string]interface{}, t
 
 		// We got a value over which we need to iterate
 
-		if valList, isList := val.([]interface{}); isList {
+		if gen, isGen := val.(*generator); isGen {
+
+			// Generators produce values on demand
+
+			iterator = func() (interface{}, error) {
+				res, ok, err := gen.Next(tid)
+				if err == nil && !ok {
+					err = rt.erp.NewRuntimeError(util.ErrEndOfIteration, "", rt.node)
+				}
+				return res, err
+			}
+			closer = gen.Close
+
+		} else if valList, isList := val.([]interface{}); isList {
 
 			index := -1
 			end := len(valList)
@@ -387,6 +457,19 @@ func (rt *loopRuntime) getIterator(vs parser.Scope, is map[string]interface{}, t
 				return valList[index], nil
 			}
 
+		} else if valBytes, isBytes := val.([]byte); isBytes {
+
+			index := -1
+			end := len(valBytes)
+
+			iterator = func() (interface{}, error) {
+				index++
+				if index >= end {
+					return nil, rt.erp.NewRuntimeError(util.ErrEndOfIteration, "", rt.node)
+				}
+				return float64(valBytes[index]), nil
+			}
+
 		} else if valMap, isMap := val.(map[interface{}]interface{}); isMap {
 			var keys []interface{}
 
@@ -426,7 +509,88 @@ func (rt *loopRuntime) getIterator(vs parser.Scope, is map[string]interface{}, t
 		}
 	}
 
-	return iterator, err
+	return iterator, closer, err
+}
+
+// Comprehensions
+// ==============
+
+/*
+comprehensionRuntime is the runtime for list and map comprehensions. A
+comprehension is evaluated like a loop statement which collects the value
+expression of every iteration.
+*/
+type comprehensionRuntime struct {
+	*loopRuntime
+}
+
+/*
+comprehensionRuntimeInst returns a new runtime component instance.
+*/
+func comprehensionRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &comprehensionRuntime{&loopRuntime{newBaseRuntime(erp, node), nil}}
+}
+
+/*
+Eval evaluate this runtime component.
+*/
+func (rt *comprehensionRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint64) (interface{}, error) {
+	var res interface{}
+
+	_, err := rt.baseRuntime.Eval(vs, is, tid)
+
+	if err == nil {
+		var l []interface{}
+		m := make(map[interface{}]interface{})
+
+		exp := rt.node.Children[1]
+
+		// Create a new variable scope
+
+		vs = vs.NewChild(scope.NameFromASTNode(rt.node))
+
+		// Create a new instance scope
+
+		is = newLoopInstanceState(is)
+
+		err = rt.handleIterator(vs, is, tid, func() error {
+			var key, val interface{}
+			var err error
+
+			if len(rt.node.Children) > 2 {
+				var guardres interface{}
+
+				// Evaluate guard
+
+				if guardres, err = rt.node.Children[2].Runtime.Eval(vs, is, tid); err != nil || !guardres.(bool) {
+					return err
+				}
+			}
+
+			if rt.node.Name == parser.NodeLISTCOMP {
+
+				if val, err = exp.Runtime.Eval(vs, is, tid); err == nil {
+					l = append(l, val)
+				}
+
+			} else if key, err = exp.Children[0].Runtime.Eval(vs, is, tid); err == nil {
+
+				if val, err = exp.Children[1].Runtime.Eval(vs, is, tid); err == nil {
+					m[key] = val
+				}
+			}
+
+			return err
+		})
+
+		res = l
+
+		if rt.node.Name == parser.NodeMAPCOMP {
+			res = m
+		}
+	}
+
+	return res, err
 }
 
 // Break statement
@@ -526,6 +690,12 @@ func (rt *tryRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint6
 
 		res, err = rt.node.Children[0].Runtime.Eval(tvs, is, tid)
 
+		// A stopped generator must unwind its body
+
+		if rtError, ok := err.(*util.RuntimeError); ok && rtError.Type == util.ErrGeneratorStopped {
+			return nil, err
+		}
+
 		// Evaluate except clauses
 
 		if err != nil {
@@ -600,7 +770,7 @@ func (rt *tryRuntime) evalExcept(vs parser.Scope, is map[string]interface{},
 
 		ret = true
 
-	} else if len(except.Children) == 2 {
+	} else if len(except.Children) == 2 && except.Children[0].Name == parser.NodeIDENTIFIER {
 
 		// We have statements and the error object is available - any exception is handled here
 
@@ -624,7 +794,7 @@ func (rt *tryRuntime) evalExcept(vs parser.Scope, is map[string]interface{},
 				// we would need to generate a new error while trying to handle another error
 				errorutil.AssertOk(evalErr)
 
-				ret = exceptError == fmt.Sprint(errObj["type"])
+				ret = matchErrorType(fmt.Sprint(exceptError), fmt.Sprint(errObj["type"]))
 
 			} else if ret && child.Name == parser.NodeAS {
 				errorVar = child.Children[0].Token.Val
@@ -644,16 +814,57 @@ func (rt *tryRuntime) evalExcept(vs parser.Scope, is map[string]interface{},
 	return ret, newerror
 }
 
+/*
+matchErrorType checks if an error type matches a given pattern. Error types
+can form a hierarchy using dot notation (e.g. net.timeout). A * segment in the
+pattern matches any single segment - a trailing * matches one or more segments
+(e.g. net.* matches net.timeout and net.timeout.read).
+*/
+func matchErrorType(pattern string, errType string) bool {
+
+	if pattern == errType {
+		return true
+	}
+
+	patternSegs := strings.Split(pattern, ".")
+	typeSegs := strings.Split(errType, ".")
+
+	for i, seg := range patternSegs {
+
+		if i >= len(typeSegs) {
+			return false
+		}
+
+		if seg == "*" {
+			if i == len(patternSegs)-1 {
+				return true
+			}
+		} else if seg != typeSegs[i] {
+			return false
+		}
+	}
+
+	return len(patternSegs) == len(typeSegs)
+}
+
 // Mutex Runtime
 // =============
 
 /*
-mutexRuntime is the runtime for mutex blocks.
+mutexRuntime is the runtime for mutex blocks. A mutex block can take its
+mutex exclusively (write - the default), shared with other readers (read) or
+exclusively only if it is free (trylock). A trylock block returns true if it
+was executed and false otherwise.
 */
 type mutexRuntime struct {
 	*baseRuntime
 }
 
+/*
+mutexModes are all known modes of a mutex block.
+*/
+var mutexModes = []string{"read", "write", "trylock"}
+
 /*
 mutexRuntimeInst returns a new runtime component instance.
 */
@@ -661,6 +872,25 @@ func mutexRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Run
 	return &mutexRuntime{newBaseRuntime(erp, node)}
 }
 
+/*
+Validate this node and all its child nodes.
+*/
+func (rt *mutexRuntime) Validate() error {
+	err := rt.baseRuntime.Validate()
+
+	if err == nil && len(rt.node.Children) == 3 {
+		mode := rt.node.Children[1]
+
+		if stringutil.IndexOf(mode.Token.Val, mutexModes) == -1 {
+			err = rt.erp.NewRuntimeError(util.ErrInvalidConstruct,
+				fmt.Sprintf("Unknown mutex mode: %v (known modes are: %v)", mode.Token.Val,
+					strings.Join(mutexModes, ", ")), mode)
+		}
+	}
+
+	return err
+}
+
 /*
 Eval evaluate this runtime component.
 */
@@ -671,9 +901,15 @@ func (rt *mutexRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uin
 
 	if err == nil {
 
-		// Get the name of the mutex
+		// Get the name and the mode of the mutex
 
 		name := rt.node.Children[0].Token.Val
+		mode := "write"
+		block := rt.node.Children[len(rt.node.Children)-1]
+
+		if len(rt.node.Children) == 3 {
+			mode = rt.node.Children[1].Token.Val
+		}
 
 		// Take mutex to modify the mutex map
 
@@ -683,22 +919,61 @@ func (rt *mutexRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uin
 
 		mutex, ok := rt.erp.Mutexes[name]
 		if !ok {
-			mutex = &sync.Mutex{}
+			mutex = &sync.RWMutex{}
 			rt.erp.Mutexes[name] = mutex
 		}
 
 		// Try to take the mutex if this thread does not already own it
 
 		owner, ok := rt.erp.MutexeOwners[name]
+		reader := rt.erp.mutexReaders[name][tid]
 
 		rt.erp.MutexesMutex.Unlock()
 
-		if !ok || owner != tid {
+		if ok && owner == tid || reader && mode == "read" {
+
+			rt.erp.MutexLog.Add(fmt.Sprintf("Thread: %v - attempted to take lock %v twice", tid, name))
+
+		} else if reader {
+
+			// A read lock cannot be upgraded - waiting for the exclusive lock
+			// would wait forever
+
+			return nil, rt.erp.NewRuntimeError(util.ErrInvalidState,
+				fmt.Sprintf("Cannot take exclusive lock %v while holding a read lock", name), rt.node)
+
+		} else if mode == "read" {
+
+			rt.erp.MutexLog.Add(fmt.Sprintf("Thread: %v - attempting to take read lock %v at %v:%v",
+				tid, name, rt.node.Token.Lsource, rt.node.Token.Lline))
+
+			mutex.RLock()
+
+			rt.erp.MutexLog.Add(fmt.Sprintf("Thread: %v - took read lock %v", tid, name))
+
+			rt.setReader(name, tid, true)
+
+			defer func() {
+				rt.erp.MutexLog.Add(fmt.Sprintf("Thread: %v - releasing read lock %v", tid, name))
+
+				rt.setReader(name, tid, false)
+
+				mutex.RUnlock()
+			}()
+
+		} else {
 
 			rt.erp.MutexLog.Add(fmt.Sprintf("Thread: %v - attempting to take lock %v with owner %v at %v:%v",
 				tid, name, owner, rt.node.Token.Lsource, rt.node.Token.Lline))
 
-			mutex.Lock()
+			if mode == "trylock" {
+				if !mutex.TryLock() {
+					rt.erp.MutexLog.Add(fmt.Sprintf("Thread: %v - lock %v is taken", tid, name))
+					return false, nil
+				}
+			} else {
+				mutex.Lock()
+			}
 
 			rt.erp.MutexLog.Add(fmt.Sprintf("Thread: %v - took lock %v with owner %v", tid, name, owner))
 
@@ -719,17 +994,174 @@ func (rt *mutexRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uin
 
 				mutex.Unlock()
 			}()
-
-		} else if owner == tid {
-
-			rt.erp.MutexLog.Add(fmt.Sprintf("Thread: %v - attempted to take lock %v twice", tid, name))
 		}
 
 		rt.erp.MutexLog.Add(fmt.Sprintf("Thread: %v - execute critical section %v", tid, name))
 
 		tvs := vs.NewChild(scope.NameFromASTNode(rt.node))
-		res, err = rt.node.Children[1].Runtime.Eval(tvs, is, tid)
+		res, err = block.Runtime.Eval(tvs, is, tid)
+
+		if mode == "trylock" {
+			res = err == nil
+		}
 	}
 
 	return res, err
 }
+
+/*
+setReader registers or unregisters a thread as reader of a mutex.
+*/
+func (rt *mutexRuntime) setReader(name string, tid uint64, reading bool) {
+	rt.erp.MutexesMutex.Lock()
+	defer rt.erp.MutexesMutex.Unlock()
+
+	readers, ok := rt.erp.mutexReaders[name]
+
+	if reading {
+		if !ok {
+			readers = make(map[uint64]bool)
+			rt.erp.mutexReaders[name] = readers
+		}
+		readers[tid] = true
+	} else {
+		delete(readers, tid)
+		if len(readers) == 0 {
+			delete(rt.erp.mutexReaders, name)
+		}
+	}
+}
+
+// Assert Runtime
+// ==============
+
+/*
+assertRuntime is the runtime for assert statements.
+*/
+type assertRuntime struct {
+	*baseRuntime
+}
+
+/*
+assertRuntimeInst returns a new runtime component instance.
+*/
+func assertRuntimeInst(erp *ECALRuntimeProvider, node *parser.ASTNode) parser.Runtime {
+	return &assertRuntime{newBaseRuntime(erp, node)}
+}
+
+/*
+Eval evaluate this runtime component.
+*/
+func (rt *assertRuntime) Eval(vs parser.Scope, is map[string]interface{}, tid uint64) (interface{}, error) {
+	var ret interface{}
+
+	_, err := rt.baseRuntime.Eval(vs, is, tid)
+
+	if err == nil {
+		exp := rt.node.Children[0]
+
+		if ret, err = exp.Runtime.Eval(vs, is, tid); err == nil && (ret == nil || ret == false || ret == 0) {
+			var msg interface{}
+
+			if len(rt.node.Children) > 1 {
+				msg, err = rt.node.Children[1].Runtime.Eval(vs, is, tid)
+			}
+
+			if err == nil {
+				err = rt.assertionError(exp, msg, vs, is, tid)
+			}
+		}
+	}
+
+	return nil, err
+}
+
+/*
+assertionError creates the error of a failed assertion. The error detail contains
+the pretty printed expression and the values of all variables in the expression.
+*/
+func (rt *assertRuntime) assertionError(exp *parser.ASTNode, msg interface{},
+	vs parser.Scope, is map[string]interface{}, tid uint64) error {
+
+	expString, _ := parser.PrettyPrint(exp)
+
+	detail := expString
+	if msg != nil {
+		detail = fmt.Sprintf("%v: %v", msg, expString)
+	}
+
+	// Collect the current values of all variables in the expression - variable
+	// access which involves function calls is not evaluated again
+
+	vars := make(map[interface{}]interface{})
+	var names []string
+
+	var collectVars func(node *parser.ASTNode)
+	collectVars = func(node *parser.ASTNode) {
+
+		if node.Name == parser.NodeIDENTIFIER {
+
+			if !containsFuncCall(node) {
+				name, _ := parser.PrettyPrint(node)
+
+				if _, ok := vars[name]; !ok {
+					if val, err := node.Runtime.Eval(vs, is, tid); err == nil {
+						vars[name] = val
+						names = append(names, name)
+					}
+				}
+			}
+
+			return
+		}
+
+		for _, c := range node.Children {
+			if c.Name != parser.NodeFUNC {
+				collectVars(c)
+			}
+		}
+	}
+
+	collectVars(exp)
+
+	if len(names) > 0 {
+		var values []string
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			val := vars[name]
+
+			if s, ok := val.(string); ok {
+				val = fmt.Sprintf("%q", s)
+			}
+
+			values = append(values, fmt.Sprintf("%v=%v", name, val))
+		}
+
+		detail = fmt.Sprintf("%v (%v)", detail, strings.Join(values, ", "))
+	}
+
+	return &util.RuntimeErrorWithDetail{
+		RuntimeError: rt.erp.NewRuntimeError(util.ErrAssertionFailed, detail, rt.node).(*util.RuntimeError),
+		Environment:  vs,
+		Data:         vars,
+	}
+}
+
+/*
+containsFuncCall checks if a given AST contains a function call.
+*/
+func containsFuncCall(node *parser.ASTNode) bool {
+	if node.Name == parser.NodeFUNCCALL {
+		return true
+	}
+
+	for _, c := range node.Children {
+		if containsFuncCall(c) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -11,9 +11,12 @@
 package interpreter
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/util"
 )
 
 func TestGuardStatements(t *testing.T) {
@@ -903,6 +906,80 @@ for [a, b] in [[1,2],[3,4],[5,6,7]] {
 	}
 }
 
+func TestComprehensions(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+l := [1, 2, 3, 4, 5]
+m := {"a" : 1, "b" : 2, "c" : 3}
+a := "x"
+result1 := [a * 2 for a in l if a > 3]
+result2 := [[a, b] for [a, b] in m]
+result3 := {k : v * 10 for [k, v] in m if v != 2}
+result4 := {a : a * a for a in range(1, 3)}
+result5 := [a for a in l if a > 10]
+result6 := [b for [a, b] in {"x": {"y": 1}}]
+`[1:], vs)
+
+	if vsRes := vs.String(); err != nil || vsRes != `GlobalScope {
+    a (string) : x
+    l ([]interface {}) : [1,2,3,4,5]
+    m (map[interface {}]interface {}) : {"a":1,"b":2,"c":3}
+    result1 ([]interface {}) : [8,10]
+    result2 ([]interface {}) : [["a",1],["b",2],["c",3]]
+    result3 (map[interface {}]interface {}) : {"a":10,"c":30}
+    result4 (map[interface {}]interface {}) : {"1":1,"2":4,"3":9}
+    result5 ([]interface {}) : null
+    result6 ([]interface {}) : [{"y":1}]
+    block: listcomp (Line:4 Pos:12) {
+    }
+    block: listcomp (Line:5 Pos:12) {
+        b (float64) : 3
+    }
+    block: mapcomp (Line:6 Pos:12) {
+        k (string) : c
+        v (float64) : 3
+    }
+    block: mapcomp (Line:7 Pos:12) {
+    }
+    block: listcomp (Line:8 Pos:12) {
+    }
+    block: listcomp (Line:9 Pos:12) {
+        b (map[interface {}]interface {}) : {"y":1}
+    }
+}` {
+		t.Error("Unexpected result: ", vsRes, err)
+		return
+	}
+
+	_, err = UnitTestEval(`
+[a + 1 for a in ["x", 1]]
+`[1:], vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Operand is not a number (a=x) (Line:1 Pos:2)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(`
+[a for [a, b] in [[1,2],[3,4],3]]
+`[1:], vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Result for loop variable is not a list (value is 3)) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(`
+{a : 1 for a[1] in [1,2]}
+`[1:], vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Must have a simple variable on the left side of the In expression) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
 func TestTryStatements(t *testing.T) {
 
 	vs := scope.NewScope(scope.GlobalScope)
@@ -1120,6 +1197,133 @@ all good`[1:] {
 	}
 }
 
+func TestTryStatementsErrorTypes(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+func handle(errType) {
+  try {
+    raise({"type" : errType, "detail" : "Some detail", "data" : 1})
+  } except "net.timeout" as e {
+    return ["timeout", e.detail, e.data]
+  } except "net.*" as e {
+    return ["net", e.type]
+  } except "*.fatal" {
+    return ["fatal"]
+  }
+}
+result1 := handle("net.timeout")
+result2 := handle("net.refused")
+result3 := handle("net.timeout.read")
+result4 := handle("db.fatal")
+`, vs)
+
+	if vsRes := vs.String(); err != nil || vsRes != `GlobalScope {
+    handle (*interpreter.function) : ecal.function: handle (Line 2, Pos 1)
+    result1 ([]interface {}) : ["timeout","Some detail",1]
+    result2 ([]interface {}) : ["net","net.refused"]
+    result3 ([]interface {}) : ["net","net.timeout.read"]
+    result4 ([]interface {}) : ["fatal"]
+}` {
+		t.Error("Unexpected result: ", vsRes, err)
+		return
+	}
+
+	_, err = UnitTestEval(`handle("net")`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): net (Some detail) (Line:4 Pos:5)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`handle("db.fatal.x")`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): db.fatal.x (Some detail) (Line:4 Pos:5)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`raise({"detail" : "foo"})`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Runtime error (Error map should have a type) (Line:1 Pos:1)" {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+}
+
+func TestAssertStatements(t *testing.T) {
+	vs := scope.NewScope(scope.GlobalScope)
+
+	_, err := UnitTestEval(`
+a := 1
+b := {"x" : "foo"}
+assert a == 1 and b.x == "foo"
+assert true, "Should not fail"
+`, vs)
+
+	if err != nil {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`assert a > 1 and b.x == "foo", "Value too small"`, vs)
+
+	if err == nil || err.Error() != `ECAL error in ECALTestRuntime (ECALEvalTest): Assertion failed (Value too small: a > 1 and b.x == "foo" (a=1, b.x="foo")) (Line:1 Pos:1)` {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	if data := fmt.Sprint(err.(*util.RuntimeErrorWithDetail).Data); data != "map[a:1 b.x:foo]" {
+		t.Error("Unexpected result: ", data)
+		return
+	}
+
+	// Variables which are accessed through function calls are not evaluated again
+
+	_, err = UnitTestEval(`assert len(b) == 2 or a == 2`, vs)
+
+	if err == nil || err.Error() != `ECAL error in ECALTestRuntime (ECALEvalTest): Assertion failed (len(b) == 2 or a == 2 (a=1)) (Line:1 Pos:1)` {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`assert false`, vs)
+
+	if err == nil || err.Error() != `ECAL error in ECALTestRuntime (ECALEvalTest): Assertion failed (false) (Line:1 Pos:1)` {
+		t.Error("Unexpected result: ", err)
+		return
+	}
+
+	_, err = UnitTestEval(`
+result1 := null
+try {
+  assert a == 2, "Check"
+} except "Assertion failed" as e {
+  result1 := e.detail
+}
+`, vs)
+
+	if res, _, _ := vs.GetValue("result1"); err != nil || res != `Check: a == 2 (a=1)` {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+
+	// Scripts can still define their own assert function
+
+	_, err = UnitTestEval(`
+func assert(x) {
+  return x == 1
+}
+result2 := assert(a)
+assert result2
+`, vs)
+
+	if res, _, _ := vs.GetValue("result2"); err != nil || res != true {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
+}
+
 func TestMutexStatements(t *testing.T) {
 
 	vs := scope.NewScope(scope.GlobalScope)
@@ -1212,3 +1416,84 @@ statements
 		t.Error("Unexpected variable scope:", vs)
 	}
 }
+
+func TestMutexModes(t *testing.T) {
+
+	vs := scope.NewScope(scope.GlobalScope)
+
+	// Read locks can be taken while holding a read or an exclusive lock
+
+	_, err := UnitTestEval(`
+a := []
+mutex foo read {
+	a := add(a, 1)
+	mutex foo read {
+		a := add(a, 2)
+	}
+}
+mutex foo write {
+	mutex foo read {
+		a := add(a, 3)
+	}
+	r := mutex foo trylock {
+		a := add(a, 4)
+	}
+	a := add(a, r)
+}
+`, vs)
+
+	if res := fmt.Sprint(scope.ToObject(vs)["a"]); err != nil || res != "[1 2 3 4 true]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// A trylock block is skipped if the mutex is taken by another thread
+
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+	mutex := &sync.RWMutex{}
+	erp.Mutexes["foo"] = mutex
+
+	mutex.RLock()
+
+	_, err = UnitTestEvalWithRuntimeProvider(`
+c := 0
+d := 0
+b := mutex foo trylock {
+	c := 1
+}
+mutex foo read {
+	d := 1
+}
+`, vs, erp)
+
+	mutex.RUnlock()
+
+	if res := fmt.Sprint(scope.ToObject(vs)["b"], scope.ToObject(vs)["c"], scope.ToObject(vs)["d"]); err != nil || res != "false 0 1" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Read locks cannot be upgraded
+
+	_, err = UnitTestEval(`
+mutex foo read {
+	mutex foo {
+	}
+}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid state (Cannot take exclusive lock foo while holding a read lock) (Line:3 Pos:2)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err = UnitTestEval(`
+mutex foo exclusive {
+}
+`, vs)
+
+	if err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Invalid construct (Unknown mutex mode: exclusive (known modes are: read, write, trylock)) (Line:2 Pos:11)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
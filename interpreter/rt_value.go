@@ -12,7 +12,6 @@ package interpreter
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/krotik/ecal/parser"
@@ -41,7 +40,7 @@ func (rt *numberValueRuntime) Validate() error {
 	err := rt.baseRuntime.Validate()
 
 	if err == nil {
-		rt.numValue, err = strconv.ParseFloat(rt.node.Token.Val, 64)
+		rt.numValue, err = parser.ParseNumber(rt.node.Token.Val)
 	}
 
 	return err
@@ -95,6 +94,13 @@ func (rt *stringValueRuntime) Eval(vs parser.Scope, is map[string]interface{}, t
 
 			if ierr == nil {
 
+				// Interpolated code is evaluated in the local scope and is
+				// therefore not checked for undefined variables
+
+				if nrt, ok := ast.Runtime.(nestedRuntime); ok {
+					nrt.setNested()
+				}
+
 				if ierr = ast.Runtime.Validate(); ierr == nil {
 					var res interface{}
 
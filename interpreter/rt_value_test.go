@@ -39,6 +39,21 @@ string: 'test'
 		t.Error("Unexpected result: ", res, err)
 		return
 	}
+
+	res, err = UnitTestEvalAndAST(
+		`200ms + 1.5m + 4KiB`, nil,
+		`
+plus
+  plus
+    number: 200ms
+    number: 1.5m
+  number: 4KiB
+`[1:])
+
+	if err != nil || res != 4186.2 {
+		t.Error("Unexpected result: ", res, err)
+		return
+	}
 }
 
 func TestStringInterpolation(t *testing.T) {
@@ -0,0 +1,323 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package interpreter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/krotik/common/stringutil"
+	"github.com/krotik/ecal/engine"
+	"github.com/krotik/ecal/parser"
+)
+
+/*
+Edge types of a rule graph
+*/
+const (
+	RuleGraphEdgeEvent      = "event"      // A sink adds an event which triggers another sink
+	RuleGraphEdgeSuppresses = "suppresses" // A sink suppresses another sink
+)
+
+/*
+ruleGraphEventFuncs maps functions which add events to the position of the
+event kind parameter.
+*/
+var ruleGraphEventFuncs = map[string]int{
+	"addEvent":        1,
+	"addEventAndWait": 1,
+	"addEventAfter":   2,
+}
+
+/*
+RuleGraph is the potential event cascade topology of a set of sinks. It is
+determined by static analysis of ECAL code: Sinks are connected if a sink
+adds an event (via addEvent, addEventAndWait or addEventAfter in its body)
+which matches the kind match of another sink or if a sink suppresses another
+sink. Event kinds and kind matches can be string constants, constants declared
+with const or calls of kind() with string constants. All other event kinds
+cannot be determined and are counted as dynamic events.
+*/
+type RuleGraph struct {
+	Sinks []*RuleGraphSink `json:"sinks"` // Sinks ordered by name
+	Edges []*RuleGraphEdge `json:"edges"` // Edges between sinks
+
+	constants map[string]*parser.ASTNode // Declared constants
+}
+
+/*
+RuleGraphSink is a sink in a rule graph.
+*/
+type RuleGraphSink struct {
+	Name          string   `json:"name"`          // Name of the sink
+	Source        string   `json:"source"`        // Source of the sink declaration
+	Line          int      `json:"line"`          // Line of the sink declaration
+	KindMatch     []string `json:"kindmatch"`     // Kind matches which could be determined
+	Suppresses    []string `json:"suppresses"`    // Suppressed sinks
+	Events        []string `json:"events"`        // Kinds of added events which could be determined
+	DynamicEvents int      `json:"dynamicevents"` // Number of added events with an unknown kind
+}
+
+/*
+RuleGraphEdge is an edge between two sinks in a rule graph.
+*/
+type RuleGraphEdge struct {
+	From  string `json:"from"`  // Name of the source sink
+	To    string `json:"to"`    // Name of the target sink
+	Type  string `json:"type"`  // Type of the edge
+	Label string `json:"label"` // Event kind for event edges
+}
+
+/*
+NewRuleGraph analyses the sinks of a given set of ASTs (source name -> AST).
+*/
+func NewRuleGraph(asts map[string]*parser.ASTNode) *RuleGraph {
+	var sources []string
+
+	g := &RuleGraph{[]*RuleGraphSink{}, []*RuleGraphEdge{}, make(map[string]*parser.ASTNode)}
+
+	for s := range asts {
+		sources = append(sources, s)
+	}
+
+	sort.Strings(sources)
+
+	// Collect all constants first since sinks may refer to constants of other sources
+
+	for _, s := range sources {
+		for _, c := range topLevelStatements(asts[s]) {
+			if c.Name == parser.NodeCONST {
+				g.constants[c.Children[0].Token.Val] = c
+			}
+		}
+	}
+
+	for _, s := range sources {
+		for _, c := range topLevelStatements(asts[s]) {
+			if c.Name == parser.NodeSINK {
+				g.Sinks = append(g.Sinks, g.analyseSink(s, c))
+			}
+		}
+	}
+
+	sort.SliceStable(g.Sinks, func(i, j int) bool {
+		return g.Sinks[i].Name < g.Sinks[j].Name
+	})
+
+	g.connect()
+
+	return g
+}
+
+/*
+topLevelStatements returns the top level statements of an AST.
+*/
+func topLevelStatements(ast *parser.ASTNode) []*parser.ASTNode {
+	if ast.Name != parser.NodeSTATEMENTS {
+
+		// Code with a single statement has no statements node
+
+		return []*parser.ASTNode{ast}
+	}
+
+	return ast.Children
+}
+
+/*
+analyseSink determines kind matches, suppressions and added events of a sink.
+*/
+func (g *RuleGraph) analyseSink(source string, node *parser.ASTNode) *RuleGraphSink {
+	var visit func(n *parser.ASTNode)
+
+	sink := &RuleGraphSink{node.Children[0].Token.Val, source, node.Token.Lline,
+		[]string{}, []string{}, []string{}, 0}
+
+	for _, c := range node.Children[1:] {
+		switch c.Name {
+
+		case parser.NodeKINDMATCH:
+			if list := c.Children[0]; list.Name == parser.NodeLIST {
+				for _, item := range list.Children {
+					if kind, ok := g.staticKind(item); ok {
+						sink.KindMatch = append(sink.KindMatch, kind)
+					}
+				}
+			}
+
+		case parser.NodeSUPPRESSES:
+			if list := c.Children[0]; list.Name == parser.NodeLIST {
+				for _, item := range list.Children {
+					if item.Name == parser.NodeSTRING {
+						sink.Suppresses = append(sink.Suppresses, item.Token.Val)
+					}
+				}
+			}
+		}
+	}
+
+	visit = func(n *parser.ASTNode) {
+		if n.Name == parser.NodeIDENTIFIER && len(n.Children) == 1 &&
+			n.Children[0].Name == parser.NodeFUNCCALL {
+
+			if pos, ok := ruleGraphEventFuncs[n.Token.Val]; ok {
+				if args := n.Children[0].Children; len(args) > pos {
+					if kind, ok := g.staticKind(args[pos]); ok {
+						sink.Events = append(sink.Events, kind)
+					} else {
+						sink.DynamicEvents++
+					}
+				}
+			}
+		}
+
+		for _, c := range n.Children {
+			visit(c)
+		}
+	}
+
+	visit(node.Children[len(node.Children)-1])
+
+	return sink
+}
+
+/*
+staticKind determines the value of an event kind expression without
+evaluating code.
+*/
+func (g *RuleGraph) staticKind(node *parser.ASTNode) (string, bool) {
+
+	if node.Name == parser.NodeSTRING {
+		return node.Token.Val, true
+
+	} else if node.Name != parser.NodeIDENTIFIER {
+		return "", false
+	}
+
+	if decl, ok := g.constants[node.Token.Val]; ok {
+		value := decl.Children[1]
+
+		if value.Name != parser.NodeENUM {
+			if len(node.Children) == 0 {
+				return g.staticKind(value)
+			}
+
+		} else if len(node.Children) == 1 && node.Children[0].Name == parser.NodeIDENTIFIER &&
+			len(node.Children[0].Children) == 0 {
+
+			for _, c := range value.Children {
+				if c.Name == parser.NodeASSIGN && c.Children[0].Token.Val == node.Children[0].Token.Val {
+					return g.staticKind(c.Children[1])
+				}
+			}
+		}
+
+	} else if node.Token.Val == "kind" && len(node.Children) == 1 &&
+		node.Children[0].Name == parser.NodeFUNCCALL {
+
+		var parts []interface{}
+
+		for _, p := range node.Children[0].Children {
+			part, ok := g.staticKind(p)
+			if !ok {
+				return "", false
+			}
+			parts = append(parts, part)
+		}
+
+		if kind, err := joinKind(parts); err == nil {
+			return kind, true
+		}
+	}
+
+	return "", false
+}
+
+/*
+connect adds all edges between the sinks of this graph.
+*/
+func (g *RuleGraph) connect() {
+	for _, from := range g.Sinks {
+		for _, kind := range from.Events {
+			for _, to := range g.Sinks {
+				for _, kindMatch := range to.KindMatch {
+					if kindMatches(kindMatch, kind) {
+						g.Edges = append(g.Edges, &RuleGraphEdge{from.Name, to.Name, RuleGraphEdgeEvent, kind})
+						break
+					}
+				}
+			}
+		}
+
+		for _, name := range from.Suppresses {
+			g.Edges = append(g.Edges, &RuleGraphEdge{from.Name, name, RuleGraphEdgeSuppresses, ""})
+		}
+	}
+}
+
+/*
+kindMatches checks if a given kind match matches a given event kind.
+*/
+func kindMatches(kindMatch string, kind string) bool {
+	matchSegments := strings.Split(kindMatch, engine.RuleKindSeparator)
+	kindSegments := strings.Split(kind, engine.RuleKindSeparator)
+
+	if len(matchSegments) != len(kindSegments) {
+		return false
+	}
+
+	for i, segment := range matchSegments {
+		if !engine.IsRuleKindWildcard(segment) && segment != kindSegments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+DOT returns this graph in the DOT language of Graphviz.
+*/
+func (g *RuleGraph) DOT() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("digraph rules {\n")
+
+	for _, s := range g.Sinks {
+		label := s.Name
+
+		if len(s.KindMatch) > 0 {
+			label = fmt.Sprintf("%v\n%v", label, strings.Join(s.KindMatch, ", "))
+		}
+
+		if s.DynamicEvents > 0 {
+			label = fmt.Sprintf("%v\n(%v dynamic event%v)", label, s.DynamicEvents, stringutil.Plural(s.DynamicEvents))
+		}
+
+		buf.WriteString(fmt.Sprintf("  %v [label=%v];\n", strconv.Quote(s.Name), strconv.Quote(label)))
+	}
+
+	for _, e := range g.Edges {
+		if e.Type == RuleGraphEdgeSuppresses {
+			buf.WriteString(fmt.Sprintf("  %v -> %v [label=\"suppresses\", style=dashed];\n",
+				strconv.Quote(e.From), strconv.Quote(e.To)))
+		} else {
+			buf.WriteString(fmt.Sprintf("  %v -> %v [label=%v];\n",
+				strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(e.Label)))
+		}
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
@@ -0,0 +1,93 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package interpreter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/krotik/common/errorutil"
+	"github.com/krotik/ecal/parser"
+)
+
+func TestRuleGraph(t *testing.T) {
+
+	kinds, err := parser.Parse("kinds.ecal", `
+const Orders { CREATED := "order.created", SHIPPED := kind("order", "shipped") }
+`)
+	errorutil.AssertOk(err)
+
+	main, err := parser.Parse("main.ecal", `
+sink created
+    kindmatch [ Orders.CREATED ],
+    suppresses [ "audit" ],
+	{
+        addEvent("ship", Orders.SHIPPED, {})
+        addEvent("dyn", event.state.kind, {})
+	}
+
+sink shipped
+    kindmatch [ "order.*" ],
+	{
+        if event.kind == "order.shipped" {
+            addEventAfter(10, "mail", kind("mail", "send"), {})
+        }
+	}
+
+sink audit
+    kindmatch [ "order.created", "mail.{type}" ],
+	{
+	}
+
+addEvent("start", "order.created", {})
+`)
+	errorutil.AssertOk(err)
+
+	g := NewRuleGraph(map[string]*parser.ASTNode{
+		"kinds.ecal": kinds,
+		"main.ecal":  main,
+	})
+
+	if res := g.DOT(); res != `
+digraph rules {
+  "audit" [label="audit\norder.created, mail.{type}"];
+  "created" [label="created\norder.created\n(1 dynamic event)"];
+  "shipped" [label="shipped\norder.*"];
+  "created" -> "shipped" [label="order.shipped"];
+  "created" -> "audit" [label="suppresses", style=dashed];
+  "shipped" -> "audit" [label="mail.send"];
+}
+`[1:] {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	res, err := json.Marshal(g.Sinks[1])
+	errorutil.AssertOk(err)
+
+	if string(res) != `{"name":"created","source":"main.ecal","line":2,"kindmatch":["order.created"],`+
+		`"suppresses":["audit"],"events":["order.shipped"],"dynamicevents":1}` {
+		t.Error("Unexpected result:", string(res))
+		return
+	}
+
+	// A single statement has no statements node
+
+	single, err := parser.Parse("single.ecal", `sink s kindmatch [ "a" ], { addEvent("x", "a", {}) }`)
+	errorutil.AssertOk(err)
+
+	g = NewRuleGraph(map[string]*parser.ASTNode{"single.ecal": single})
+
+	if len(g.Edges) != 1 || g.Edges[0].From != "s" || g.Edges[0].To != "s" {
+		t.Error("Unexpected result:", g.Edges)
+		return
+	}
+}
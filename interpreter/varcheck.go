@@ -0,0 +1,332 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package interpreter
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/krotik/common/stringutil"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/stdlib"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+varCheckScope models a variable scope while checking an AST for undefined
+variables.
+*/
+type varCheckScope struct {
+	defs   map[string]bool // Variables which are assigned in this scope
+	parent *varCheckScope  // Enclosing scope
+}
+
+/*
+newVarCheckScope creates a new variable check scope.
+*/
+func newVarCheckScope(parent *varCheckScope, defs ...string) *varCheckScope {
+	s := &varCheckScope{make(map[string]bool), parent}
+
+	for _, d := range defs {
+		s.defs[d] = true
+	}
+
+	return s
+}
+
+/*
+isDefined checks if a variable is assigned in this or any enclosing scope.
+*/
+func (s *varCheckScope) isDefined(name string) bool {
+	for ; s != nil; s = s.parent {
+		if s.defs[name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+varCheckRead is a variable read which needs to be checked.
+*/
+type varCheckRead struct {
+	node  *parser.ASTNode // Identifier node of the read
+	scope *varCheckScope  // Scope of the read
+}
+
+/*
+ValidateVariables checks a validated AST for reads of variables which are never
+assigned in any enclosing scope. Variables of the given global scope as well as
+build-in and stdlib functions are considered to be defined. The returned error
+contains a suggestion if a similar variable name exists. The check is part of
+the validation if the VarCheckScope of the runtime provider is set.
+*/
+func (erp *ECALRuntimeProvider) ValidateVariables(ast *parser.ASTNode, vs parser.Scope) error {
+	var reads []varCheckRead
+	var visit, visitAccess, define func(node *parser.ASTNode, s *varCheckScope)
+
+	root := newVarCheckScope(nil)
+
+	visitAccess = func(node *parser.ASTNode, s *varCheckScope) {
+
+		// Only the first identifier of an access string is a variable read
+
+		for _, c := range node.Children {
+			if c.Name == parser.NodeIDENTIFIER {
+				visitAccess(c, s)
+			} else {
+				visit(c, s)
+			}
+		}
+	}
+
+	define = func(node *parser.ASTNode, s *varCheckScope) {
+		if node.Name == parser.NodeIDENTIFIER && len(node.Children) == 0 {
+			s.defs[node.Token.Val] = true
+		} else if node.Name == parser.NodeLIST {
+			for _, c := range node.Children {
+				define(c, s)
+			}
+		} else {
+			visit(node, s)
+		}
+	}
+
+	visit = func(node *parser.ASTNode, s *varCheckScope) {
+
+		switch node.Name {
+
+		case parser.NodeIDENTIFIER:
+
+			// Atomic operations create global variables by name (e.g. atomicAdd("cnt", 1))
+
+			if name := node.Token.Val; (name == "atomicAdd" || name == "cas") &&
+				len(node.Children) == 1 && node.Children[0].Name == parser.NodeFUNCCALL {
+
+				if args := node.Children[0].Children; len(args) > 0 && args[0].Name == parser.NodeSTRING {
+					root.defs[args[0].Token.Val] = true
+				}
+			}
+
+			reads = append(reads, varCheckRead{node, s})
+			visitAccess(node, s)
+
+		case parser.NodeASSIGN:
+			left := node.Children[0]
+
+			if left.Name == parser.NodeLET {
+				left = left.Children[0]
+			}
+
+			define(left, s)
+			visit(node.Children[1], s)
+
+		case parser.NodeLET:
+			define(node.Children[0], s)
+
+		case parser.NodeIMPORT:
+			if symbols := node.Children[1]; symbols.Name == parser.NodeIMPORTLIST {
+				for _, c := range symbols.Children {
+					_, alias := importSymbol(c)
+					s.defs[alias.Token.Val] = true
+				}
+			} else {
+				s.defs[symbols.Token.Val] = true
+			}
+
+		case parser.NodeCONST:
+
+			// Constants are always declared in the global scope
+
+			root.defs[node.Children[0].Token.Val] = true
+
+			if value := node.Children[1]; value.Name == parser.NodeENUM {
+				for _, c := range value.Children {
+					if c.Name == parser.NodeASSIGN {
+						visit(c.Children[1], s)
+					}
+				}
+			} else {
+				visit(value, s)
+			}
+
+		case parser.NodeFUNC:
+			fs := newVarCheckScope(s, "this", "super")
+
+			children := node.Children
+			if children[0].Name == parser.NodeIDENTIFIER {
+				s.defs[children[0].Token.Val] = true
+				children = children[1:]
+			}
+
+			for _, p := range children[0].Children {
+				fs.defs[paramName(p)] = true
+
+				if p.Name == parser.NodePRESET {
+					visit(p.Children[1], fs)
+				}
+			}
+
+			visit(children[len(children)-1], fs)
+
+		case parser.NodeSINK:
+			visit(node.Children[len(node.Children)-1], newVarCheckScope(s, "event"))
+
+		case parser.NodeLOOP, parser.NodeLISTCOMP, parser.NodeMAPCOMP:
+			ls := newVarCheckScope(s)
+
+			if in := node.Children[0]; in.Name == parser.NodeIN {
+				define(in.Children[0], ls)
+				visit(in.Children[1], s)
+			} else {
+				visit(in, ls)
+			}
+
+			for _, c := range node.Children[1:] {
+				visit(c, ls)
+			}
+
+		case parser.NodeEXCEPT:
+			es := newVarCheckScope(s)
+
+			for i, c := range node.Children {
+				if c.Name == parser.NodeAS {
+					define(c.Children[0], es)
+				} else if c.Name == parser.NodeIDENTIFIER && i < len(node.Children)-1 {
+					define(c, es)
+				} else if c.Name == parser.NodeSTATEMENTS {
+					visit(c, es)
+				}
+			}
+
+		case parser.NodeMUTEX:
+			visit(node.Children[len(node.Children)-1], s)
+
+		case parser.NodeSTATEMENTS:
+			if node != ast {
+				s = newVarCheckScope(s)
+			}
+
+			for _, c := range node.Children {
+				visit(c, s)
+			}
+
+		default:
+			for _, c := range node.Children {
+				visit(c, s)
+			}
+		}
+	}
+
+	visit(ast, root)
+
+	for _, r := range reads {
+		name := r.node.Token.Val
+
+		if !r.scope.isDefined(name) && !erp.isKnownGlobal(name, vs) {
+			detail := fmt.Sprintf("Variable %v is not assigned in any enclosing scope", name)
+
+			if suggestion := erp.suggestVariable(name, r.scope, vs); suggestion != "" {
+				detail = fmt.Sprintf("%v - did you mean %v?", detail, suggestion)
+			}
+
+			return erp.NewRuntimeError(util.ErrVarAccess, detail, r.node)
+		}
+	}
+
+	return nil
+}
+
+/*
+nestedRuntime is a runtime component which can be marked as part of a larger
+validated AST.
+*/
+type nestedRuntime interface {
+	setNested()
+}
+
+/*
+markNested marks the runtime components of all nodes below a given node as
+nested.
+*/
+func markNested(node *parser.ASTNode) {
+	for _, c := range node.Children {
+		if nrt, ok := c.Runtime.(nestedRuntime); ok {
+			nrt.setNested()
+		}
+
+		markNested(c)
+	}
+}
+
+/*
+isKnownGlobal checks if a given name is a variable of the global scope or a
+build-in or stdlib function.
+*/
+func (erp *ECALRuntimeProvider) isKnownGlobal(name string, vs parser.Scope) bool {
+
+	if vs != nil {
+		if _, ok, _ := vs.GetValue(name); ok {
+			return true
+		}
+	}
+
+	if _, ok := InbuildFuncMap[name]; ok || stringutil.IndexOf(name, []string{"log", "error", "debug"}) != -1 {
+		return true
+	}
+
+	if _, ok := stdlib.GetStdlibFunc(name); ok {
+		return true
+	}
+
+	_, ok := stdlib.GetPkgDocString(name)
+
+	return ok
+}
+
+/*
+suggestVariable looks for a known variable name which is similar to a given name.
+*/
+func (erp *ECALRuntimeProvider) suggestVariable(name string, s *varCheckScope, vs parser.Scope) string {
+	var candidates []string
+
+	for ; s != nil; s = s.parent {
+		for d := range s.defs {
+			candidates = append(candidates, d)
+		}
+	}
+
+	if vs != nil {
+		for k := range scope.ToObject(vs) {
+			candidates = append(candidates, fmt.Sprint(k))
+		}
+	}
+
+	for k := range InbuildFuncMap {
+		candidates = append(candidates, k)
+	}
+
+	sort.Strings(candidates)
+
+	suggestion := ""
+	bestDistance := 3 // Only suggest names with a maximum distance of 2
+
+	for _, c := range candidates {
+		if d := stringutil.LevenshteinDistance(name, c); d < bestDistance && d < len(name) {
+			suggestion = c
+			bestDistance = d
+		}
+	}
+
+	return suggestion
+}
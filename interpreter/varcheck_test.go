@@ -0,0 +1,181 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package interpreter
+
+import (
+	"testing"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+)
+
+func TestValidateVariables(t *testing.T) {
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+	vs := scope.NewScope(scope.GlobalScope)
+	vs.SetValue("hostValue", 1)
+
+	validate := func(code string) error {
+		ast, err := parser.ParseWithRuntime("ECALEvalTest", code, erp)
+
+		if err == nil {
+			if err = ast.Runtime.Validate(); err == nil {
+				err = erp.ValidateVariables(ast, vs)
+			}
+		}
+
+		return err
+	}
+
+	if err := validate(`
+import "foo.ecal" as foo
+const MaxSize := 10
+const Color { RED, GREEN := MaxSize }
+
+counter := hostValue + MaxSize + Color.RED
+
+func inc(step, factor=step * 2, *rest) {
+	counter := counter + step * factor + len(rest) + this.x
+	return foo.bar(counter)
+}
+
+sink mysink
+	kindmatch [ "foo.*" ],
+{
+	log(event.name, math.floor(1.5))
+
+	for [k, v] in event.state {
+		let x := k
+		try {
+			raise(x, v)
+		} except "test" as e {
+			log(e.detail)
+		}
+	}
+}
+
+mutex m {
+	l := [a * 2 for a in range(1, 5) if a > counter]
+	m := {k : v for [k, v] in {"a" : 1}}
+	[x, y] := [l, m]
+	x.foo := y[inc(1)]
+}
+`); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := validate(`
+counter := 1
+res := countr + 1
+`); err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Variable countr is not assigned in any enclosing scope - did you mean counter?) (Line:3 Pos:8)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := validate(`
+func foo() {
+	if true {
+		x := 1
+	}
+	return x
+}
+`); err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Variable x is not assigned in any enclosing scope) (Line:6 Pos:9)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := validate(`log(hostValu, lenn([]))`); err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Variable hostValu is not assigned in any enclosing scope - did you mean hostValue?) (Line:1 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := validate(`lenn([])`); err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Variable lenn is not assigned in any enclosing scope - did you mean len?) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Atomic operations create global variables by name
+
+	if err := validate(`
+atomicAdd("cnt", 1)
+func foo() {
+	cas("flag", null, true)
+	return flag
+}
+log(cnt, foo())
+`); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := validate(`
+atomicAdd("cnt", 1)
+log(cnnt)
+`); err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Variable cnnt is not assigned in any enclosing scope - did you mean cnt?) (Line:3 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestValidateVariablesOnValidation(t *testing.T) {
+	erp := NewECALRuntimeProvider("ECALTestRuntime", nil, nil)
+	vs := scope.NewScope(scope.GlobalScope)
+	vs.SetValue("hostValue", float64(1))
+
+	validate := func(code string) error {
+		ast, err := parser.ParseWithRuntime("ECALEvalTest", code, erp)
+
+		if err == nil {
+			err = ast.Runtime.Validate()
+		}
+
+		return err
+	}
+
+	// Without a scope the check is not part of the validation
+
+	if err := validate(`log(hostValu)`); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	erp.VarCheckScope = vs
+
+	if err := validate(`log(hostValu)`); err == nil || err.Error() != "ECAL error in ECALTestRuntime (ECALEvalTest): Cannot access variable (Variable hostValu is not assigned in any enclosing scope - did you mean hostValue?) (Line:1 Pos:5)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Nested statements and interpolated strings see the variables of their
+	// enclosing scopes
+
+	code := `
+func foo(x) {
+	if x > 0 {
+		y := x + hostValue
+		return "{{y}}"
+	}
+}
+res := foo(1)
+`
+	ast, err := parser.ParseWithRuntime("ECALEvalTest", code, erp)
+
+	if err == nil {
+		if err = ast.Runtime.Validate(); err == nil {
+			_, err = ast.Runtime.Eval(vs, make(map[string]interface{}), erp.NewThreadID())
+		}
+	}
+
+	if res, _, _ := vs.GetValue("res"); err != nil || res != "2" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
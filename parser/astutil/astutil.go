@@ -0,0 +1,272 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+/*
+Package astutil contains utilities to query and transform ECAL ASTs. It is
+intended for authors of tools such as linters, analysers or code
+modification tools.
+
+Transformed ASTs can be turned back into code with parser.PrettyPrint. Code
+comments are stored as meta data of AST nodes and are kept when a node is
+replaced by a node without comments. Note that the runtime components of an
+AST are not updated by transformations - transformed code should be
+re-parsed before it is executed.
+*/
+package astutil
+
+import (
+	"fmt"
+
+	"github.com/krotik/ecal/parser"
+)
+
+/*
+VisitFunc is called for every visited node of an AST. The path contains all
+parent nodes of the visited node starting with the root node. Returning
+false skips the children of the node.
+*/
+type VisitFunc func(node *parser.ASTNode, path []*parser.ASTNode) bool
+
+/*
+RewriteFunc is called for every node of an AST during a rewrite. The path
+contains all parent nodes of the node starting with the root node. The
+returned node replaces the given node - returning the given node keeps it
+and returning nil removes it from its parent.
+*/
+type RewriteFunc func(node *parser.ASTNode, path []*parser.ASTNode) (*parser.ASTNode, error)
+
+/*
+Walk visits all nodes of an AST in depth-first order. Parent nodes are
+visited before their children.
+*/
+func Walk(ast *parser.ASTNode, visit VisitFunc) {
+	walk(ast, nil, visit)
+}
+
+/*
+walk visits a node and its children.
+*/
+func walk(node *parser.ASTNode, path []*parser.ASTNode, visit VisitFunc) {
+	if node == nil || !visit(node, path) {
+		return
+	}
+
+	childPath := append(path[:len(path):len(path)], node)
+
+	for _, child := range node.Children {
+		walk(child, childPath, visit)
+	}
+}
+
+/*
+Find returns all nodes of an AST for which a given function returns true.
+*/
+func Find(ast *parser.ASTNode, match func(node *parser.ASTNode, path []*parser.ASTNode) bool) []*parser.ASTNode {
+	var res []*parser.ASTNode
+
+	Walk(ast, func(node *parser.ASTNode, path []*parser.ASTNode) bool {
+		if match(node, path) {
+			res = append(res, node)
+		}
+		return true
+	})
+
+	return res
+}
+
+/*
+FindByName returns all nodes of an AST which have one of the given node
+names (e.g. parser.NodeFUNCCALL).
+*/
+func FindByName(ast *parser.ASTNode, names ...string) []*parser.ASTNode {
+	nameSet := make(map[string]bool)
+
+	for _, n := range names {
+		nameSet[n] = true
+	}
+
+	return Find(ast, func(node *parser.ASTNode, path []*parser.ASTNode) bool {
+		return nameSet[node.Name]
+	})
+}
+
+/*
+FindIdentifiers returns all identifier nodes of an AST with a given value
+(e.g. all usages of a variable or function).
+*/
+func FindIdentifiers(ast *parser.ASTNode, value string) []*parser.ASTNode {
+	return Find(ast, func(node *parser.ASTNode, path []*parser.ASTNode) bool {
+		return node.Name == parser.NodeIDENTIFIER && node.Token != nil && node.Token.Val == value
+	})
+}
+
+/*
+Rewrite transforms an AST. The rewrite function is called for every node -
+children are rewritten before their parents. Returns the new root of the AST
+(nil if the root has been removed).
+*/
+func Rewrite(ast *parser.ASTNode, rewrite RewriteFunc) (*parser.ASTNode, error) {
+	if ast == nil {
+		return nil, nil
+	}
+
+	return rewriteNode(ast, nil, rewrite)
+}
+
+/*
+rewriteNode rewrites a node and its children.
+*/
+func rewriteNode(node *parser.ASTNode, path []*parser.ASTNode, rewrite RewriteFunc) (*parser.ASTNode, error) {
+	childPath := append(path[:len(path):len(path)], node)
+	children := make([]*parser.ASTNode, 0, len(node.Children))
+
+	for _, child := range node.Children {
+		newChild, err := rewriteNode(child, childPath, rewrite)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if newChild != nil {
+			children = append(children, newChild)
+		}
+	}
+
+	node.Children = children
+
+	newNode, err := rewrite(node, path)
+
+	if err == nil && newNode != nil && newNode != node {
+		keepMeta(node, newNode)
+	}
+
+	return newNode, err
+}
+
+/*
+Replace replaces a node of an AST with another node. Returns the new root of
+the AST. Returns an error if the node could not be found.
+*/
+func Replace(ast *parser.ASTNode, old *parser.ASTNode, replacement *parser.ASTNode) (*parser.ASTNode, error) {
+	if ast == old {
+		keepMeta(old, replacement)
+		return replacement, nil
+	}
+
+	var found bool
+
+	Walk(ast, func(node *parser.ASTNode, path []*parser.ASTNode) bool {
+		for i, child := range node.Children {
+			if child == old {
+				keepMeta(old, replacement)
+				node.Children[i] = replacement
+				found = true
+			}
+		}
+		return !found
+	})
+
+	if !found {
+		return ast, fmt.Errorf("Node not found in AST: %v", old.Name)
+	}
+
+	return ast, nil
+}
+
+/*
+keepMeta copies the comments of a replaced node to its replacement if the
+replacement has no comments. The parser attaches pre comments to the first
+node and post comments to the last node of an expression - these are
+attached to the replacement node itself.
+*/
+func keepMeta(old *parser.ASTNode, replacement *parser.ASTNode) {
+	if replacement == nil || len(edgeMeta(replacement, true))+len(edgeMeta(replacement, false)) > 0 {
+		return
+	}
+
+	for _, m := range edgeMeta(old, true) {
+		if m.Type() == parser.MetaDataPreComment {
+			replacement.Meta = append(replacement.Meta, m)
+		}
+	}
+
+	for _, m := range edgeMeta(old, false) {
+		if m.Type() == parser.MetaDataPostComment {
+			replacement.Meta = append(replacement.Meta, m)
+		}
+	}
+}
+
+/*
+edgeMeta collects the meta data along the first (leftmost) or last
+(rightmost) path of an AST.
+*/
+func edgeMeta(node *parser.ASTNode, first bool) []parser.MetaData {
+	var res []parser.MetaData
+
+	for node != nil {
+		res = append(res, node.Meta...)
+
+		if len(node.Children) == 0 {
+			break
+		} else if first {
+			node = node.Children[0]
+		} else {
+			node = node.Children[len(node.Children)-1]
+		}
+	}
+
+	return res
+}
+
+/*
+Clone returns a deep copy of an AST. Tokens and meta data are copied as well
+but runtime components are not.
+*/
+func Clone(ast *parser.ASTNode) *parser.ASTNode {
+	if ast == nil {
+		return nil
+	}
+
+	c := *ast
+	c.Runtime = nil
+
+	if ast.Token != nil {
+		token := *ast.Token
+		c.Token = &token
+	}
+
+	c.Meta = append([]parser.MetaData(nil), ast.Meta...)
+	c.Children = make([]*parser.ASTNode, len(ast.Children))
+
+	for i, child := range ast.Children {
+		c.Children[i] = Clone(child)
+	}
+
+	return &c
+}
+
+/*
+ParseExpression parses a single expression or statement which can be used
+as replacement in a transformation.
+*/
+func ParseExpression(code string) (*parser.ASTNode, error) {
+	ast, err := parser.Parse("expression", code)
+
+	if err == nil && ast.Name == parser.NodeSTATEMENTS && len(ast.Children) != 1 {
+		err = fmt.Errorf("Code should contain a single expression or statement: %v", code)
+	}
+
+	if err == nil && ast.Name == parser.NodeSTATEMENTS {
+		ast = ast.Children[0]
+	}
+
+	return ast, err
+}
@@ -0,0 +1,196 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package astutil
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/krotik/ecal/parser"
+)
+
+const testCode = `
+/* Compute the result */
+a := foo(1, 2)
+
+func bar(x) {
+  y := 1 # Initial value
+  return foo(x, y)
+}
+
+log(bar(a) + 1)
+`
+
+func TestQuery(t *testing.T) {
+	ast, err := parser.Parse("test", testCode)
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	var names []string
+
+	Walk(ast, func(node *parser.ASTNode, path []*parser.ASTNode) bool {
+		names = append(names, fmt.Sprintf("%v%v", strings.Repeat(" ", len(path)), node.Name))
+		return node.Name != parser.NodeFUNC // Do not descend into functions
+	})
+
+	if res := strings.Join(names, "\n"); res != `statements
+ :=
+  identifier
+  identifier
+   funccall
+    number
+    number
+ function
+ identifier
+  funccall
+   plus
+    identifier
+     funccall
+      identifier
+    number` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	var calls []string
+
+	for _, n := range FindIdentifiers(ast, "foo") {
+		calls = append(calls, fmt.Sprint(n.Token.Lline))
+	}
+
+	if res := strings.Join(calls, " "); res != "3 7" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := len(FindByName(ast, parser.NodeFUNCCALL, parser.NodeRETURN)); res != 5 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Find with path
+
+	res := Find(ast, func(node *parser.ASTNode, path []*parser.ASTNode) bool {
+		return node.Name == parser.NodeNUMBER && path[len(path)-1].Name == parser.NodePLUS
+	})
+
+	if len(res) != 1 || res[0].Token.Val != "1" || res[0].Token.Lline != 10 {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestTransform(t *testing.T) {
+	ast, err := parser.Parse("test", testCode)
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	orig := Clone(ast)
+
+	// Rename all calls of foo to baz, change the initial value of y and
+	// remove all log statements
+
+	ast, err = Rewrite(ast, func(node *parser.ASTNode, path []*parser.ASTNode) (*parser.ASTNode, error) {
+		if node.Name == parser.NodeIDENTIFIER && node.Token.Val == "foo" {
+			return ParseExpression("baz()")
+		} else if node.Name == parser.NodeNUMBER && path[len(path)-1].Name == parser.NodeASSIGN {
+			return ParseExpression("10")
+		} else if node.Name == parser.NodeIDENTIFIER && node.Token.Val == "log" {
+			return nil, nil
+		}
+		return node, nil
+	})
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Replace the first assignment - comments are kept
+
+	a := FindByName(ast, parser.NodeASSIGN)[0]
+
+	replacement, err := ParseExpression("a := 5 * (1 + 2)")
+	if err == nil {
+		ast, err = Replace(ast, a, replacement)
+	}
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := parser.PrettyPrint(ast); err != nil || res != `/* Compute the result */
+a := 5 * (1 + 2)
+
+func bar(x) {
+    y := 10 # Initial value
+    return baz()
+}` {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// The clone was not modified
+
+	if res, err := parser.PrettyPrint(orig); err != nil || res != `/* Compute the result */
+a := foo(1, 2)
+
+func bar(x) {
+    y := 1 # Initial value
+    return foo(x, y)
+}
+
+log(bar(a) + 1)` {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := Replace(ast, a, replacement); err == nil || err.Error() != "Node not found in AST: :=" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := ParseExpression("a := 1; b := 2"); err == nil ||
+		err.Error() != "Code should contain a single expression or statement: a := 1; b := 2" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := Rewrite(ast, func(node *parser.ASTNode, path []*parser.ASTNode) (*parser.ASTNode, error) {
+		return nil, fmt.Errorf("foo")
+	}); err == nil || err.Error() != "foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := Rewrite(nil, nil); res != nil || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := Replace(ast, ast, replacement); res != replacement || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := Clone(nil); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
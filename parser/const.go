@@ -81,6 +81,12 @@ const (
 	TokenMAP        // MAP value
 	TokenPARAMS     // Function parameters
 	TokenGUARD      // Conditional statements
+	TokenLISTCOMP   // List comprehension
+	TokenMAPCOMP    // Map comprehension
+	TokenVARARGS    // Variadic function parameter
+	TokenENUM       // Enum constant declaration
+	TokenTYPE       // Type annotation
+	TokenIMPORTLIST // Selected symbols of an import
 
 	TOKENodeSYMBOLS // Used to separate symbols from other tokens in this list
 
@@ -127,6 +133,11 @@ const (
 	TokenASSIGN
 	TokenLET
 
+	// Conditional expressions
+
+	TokenQUESTION
+	TokenCOALESCE
+
 	TOKENodeKEYWORDS // Used to separate keywords from other tokens in this list
 
 	// Import statement
@@ -142,11 +153,17 @@ const (
 	TokenSTATEMATCH
 	TokenPRIORITY
 	TokenSUPPRESSES
+	TokenDEDUP
+	TokenCOLLECT
+	TokenTIMEOUT
+	TokenRETRIES
+	TokenBACKOFF
 
 	// Function definition
 
 	TokenFUNC
 	TokenRETURN
+	TokenYIELD
 
 	// Boolean operators
 
@@ -191,6 +208,14 @@ const (
 
 	TokenMUTEX
 
+	// Assert statement
+
+	TokenASSERT
+
+	// Constant declaration
+
+	TokenCONST
+
 	TokenENDLIST
 )
 
@@ -220,6 +245,12 @@ const (
 	NodeMAP        = "map"        // Map value
 	NodePARAMS     = "params"     // Function parameters
 	NodeGUARD      = "guard"      // Guard expressions for conditional statements
+	NodeLISTCOMP   = "listcomp"   // List comprehension
+	NodeMAPCOMP    = "mapcomp"    // Map comprehension
+	NodeVARARGS    = "varargs"    // Variadic function parameter
+	NodeENUM       = "enum"       // Enum constant declaration
+	NodeTYPE       = "type"       // Type annotation
+	NodeIMPORTLIST = "importlist" // Selected symbols of an import
 
 	// Condition operators
 
@@ -249,6 +280,11 @@ const (
 	NodeASSIGN = ":="
 	NodeLET    = "let"
 
+	// Conditional expressions
+
+	NodeTERNARY  = "ternary"
+	NodeCOALESCE = "coalesce"
+
 	// Import statement
 
 	NodeIMPORT = "import"
@@ -261,11 +297,17 @@ const (
 	NodeSTATEMATCH = "statematch"
 	NodePRIORITY   = "priority"
 	NodeSUPPRESSES = "suppresses"
+	NodeDEDUP      = "dedup"
+	NodeCOLLECT    = "collect"
+	NodeTIMEOUT    = "timeout"
+	NodeRETRIES    = "retries"
+	NodeBACKOFF    = "backoff"
 
 	// Function definition
 
 	NodeFUNC   = "function"
 	NodeRETURN = "return"
+	NodeYIELD  = "yield"
 
 	// Boolean operators
 
@@ -308,4 +350,12 @@ const (
 	// Mutex block
 
 	NodeMUTEX = "mutex"
+
+	// Assert statement
+
+	NodeASSERT = "assert"
+
+	// Constant declaration
+
+	NodeCONST = "const"
 )
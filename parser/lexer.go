@@ -14,6 +14,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
@@ -31,6 +32,56 @@ numberPattern is a hint pattern for numbers.
 */
 var numberPattern = regexp.MustCompile("^[0-9].*$")
 
+/*
+numberUnits are the units which can directly follow a number literal. A number
+with a duration unit is converted to seconds and a number with a size unit is
+converted to bytes. Sub-second units are divisors to avoid rounding errors.
+*/
+var numberUnits = map[string]struct{ mul, div float64 }{
+	"ns":  {1, 1e9},
+	"us":  {1, 1e6},
+	"ms":  {1, 1e3},
+	"s":   {1, 1},
+	"m":   {60, 1},
+	"h":   {3600, 1},
+	"d":   {86400, 1},
+	"B":   {1, 1},
+	"KB":  {1e3, 1},
+	"MB":  {1e6, 1},
+	"GB":  {1e9, 1},
+	"TB":  {1e12, 1},
+	"KiB": {1 << 10, 1},
+	"MiB": {1 << 20, 1},
+	"GiB": {1 << 30, 1},
+	"TiB": {1 << 40, 1},
+}
+
+/*
+ParseNumber parses the value of a number literal. The value may have a
+duration unit (e.g. 5s, 200ms) or a size unit (e.g. 10MB, 4KiB).
+*/
+func ParseNumber(val string) (float64, error) {
+	i := len(val)
+
+	for i > 0 && unicode.IsLetter(rune(val[i-1])) {
+		i--
+	}
+
+	res, err := strconv.ParseFloat(val[:i], 64)
+
+	if err == nil && i < len(val) {
+		unit, ok := numberUnits[val[i:]]
+
+		if !ok {
+			return 0, fmt.Errorf("Unknown unit %v in number %v", val[i:], val)
+		}
+
+		res = res * unit.mul / unit.div
+	}
+
+	return res, err
+}
+
 /*
 LexToken represents a token which is returned by the lexer.
 */
@@ -305,6 +356,11 @@ var SymbolMap = map[string]LexTokenID{
 	// Assignment statement
 
 	":=": TokenASSIGN,
+
+	// Conditional expressions
+
+	"?":  TokenQUESTION,
+	"??": TokenCOALESCE,
 }
 
 // Lexer
@@ -320,12 +376,18 @@ Function which represents the current state of the lexer and returns the next st
 */
 type lexFunc func(*lexer) lexFunc
 
+/*
+lexReaderChunkSize is the number of bytes which are read at once when lexing
+from a reader.
+*/
+const lexReaderChunkSize = 4096
+
 /*
 Lexer data structure
 */
 type lexer struct {
 	name           string        // Name to identify the input
-	input          string        // Input string of the lexer
+	input          []byte        // Input of the lexer (window of the input when reading from a reader)
 	pos            int           // Current rune pointer
 	line           int           // Current line pointer
 	lastnl         int           // Last newline position
@@ -333,13 +395,28 @@ type lexer struct {
 	width          int           // Width of last rune
 	start          int           // Start position of the current red token
 	tokens         chan LexToken // Channel for lexer output
+	offset         int           // Position of the first character of the input window
+	mark           int           // Position before which the input is no longer needed
+	reader         io.Reader     // Reader which provides further input (nil if all input has been read)
+	readErr        error         // Error which occurred while reading from the reader
 }
 
 /*
 Lex lexes a given input. Returns a channel which contains tokens.
 */
 func Lex(name string, input string) chan LexToken {
-	l := &lexer{name, input, 0, 0, 0, 0, 0, 0, make(chan LexToken)}
+	l := &lexer{name, []byte(input), 0, 0, 0, 0, 0, 0, make(chan LexToken), 0, 0, nil, nil}
+	go l.run()
+	return l.tokens
+}
+
+/*
+LexReader lexes the input of a given reader. Returns a channel which contains
+tokens. The input is read incrementally - only the part of the input which
+belongs to the current token is kept in memory.
+*/
+func LexReader(name string, reader io.Reader) chan LexToken {
+	l := &lexer{name, nil, 0, 0, 0, 0, 0, 0, make(chan LexToken), 0, 0, reader, nil}
 	go l.run()
 	return l.tokens
 }
@@ -382,20 +459,22 @@ the rune pointer.
 */
 func (l *lexer) next(peek int) rune {
 
+	pos := l.pos
+	if peek > 0 {
+		pos += peek - 1
+	}
+
+	l.fill(pos + utf8.UTFMax)
+
 	// Check if we reached the end
 
-	if int(l.pos) >= len(l.input) {
+	if l.pos >= l.offset+len(l.input) {
 		return RuneEOF
 	}
 
 	// Decode the next rune
 
-	pos := l.pos
-	if peek > 0 {
-		pos += peek - 1
-	}
-
-	r, w := utf8.DecodeRuneInString(l.input[pos:])
+	r, w := utf8.DecodeRune(l.input[pos-l.offset:])
 
 	if peek == 0 {
 		l.width = w
@@ -405,6 +484,56 @@ func (l *lexer) next(peek int) rune {
 	return r
 }
 
+/*
+fill reads from the reader of the lexer until the input window contains the
+input up to a given position or until all input has been read.
+*/
+func (l *lexer) fill(pos int) {
+	for l.reader != nil && l.offset+len(l.input) < pos {
+
+		// Remove input which is no longer needed if it takes up at least half
+		// of the input window
+
+		if d := l.mark - l.offset; d > 0 && d >= len(l.input)/2 {
+			l.input = l.input[:copy(l.input, l.input[d:])]
+			l.offset = l.mark
+		}
+
+		if cap(l.input)-len(l.input) < lexReaderChunkSize {
+			input := make([]byte, len(l.input), 2*cap(l.input)+lexReaderChunkSize)
+			copy(input, l.input)
+			l.input = input
+		}
+
+		n, err := l.reader.Read(l.input[len(l.input):cap(l.input)])
+
+		l.input = l.input[:len(l.input)+n]
+
+		if err != nil {
+			l.reader = nil
+
+			if err != io.EOF {
+				l.readErr = err
+			}
+		}
+	}
+}
+
+/*
+discard marks all input before the current rune pointer as no longer needed.
+Must only be called between tokens.
+*/
+func (l *lexer) discard() {
+	l.mark = l.pos
+}
+
+/*
+text returns the input between two positions.
+*/
+func (l *lexer) text(start int, end int) string {
+	return string(l.input[start-l.offset : end-l.offset])
+}
+
 /*
 backup sets the pointer one rune back. Can only be called once per next call.
 */
@@ -427,12 +556,20 @@ emitToken passes a token back to the client.
 */
 func (l *lexer) emitToken(t LexTokenID) {
 	if t == TokenEOF {
+
+		// Input which could not be read is reported instead of the end
+
+		if l.readErr != nil {
+			l.emitError(fmt.Sprintf("Could not read input: %v", l.readErr))
+			return
+		}
+
 		l.emitTokenAndValue(t, "", false, false)
 		return
 	}
 
 	if l.tokens != nil {
-		l.tokens <- LexToken{t, l.start, l.input[l.start:l.pos], false, false, l.skippedNewline, l.name,
+		l.tokens <- LexToken{t, l.start, l.text(l.start, l.pos), false, false, l.skippedNewline, l.name,
 			l.line + 1, l.start - l.lastnl + 1}
 	}
 }
@@ -465,6 +602,8 @@ skipWhiteSpace skips any number of whitespace characters. Returns false if the p
 reaches EOF while skipping whitespaces.
 */
 func skipWhiteSpace(l *lexer) bool {
+	l.discard()
+
 	r := l.next(0)
 	l.skippedNewline = 0
 
@@ -566,6 +705,29 @@ func lexNumberBlock(l *lexer) {
 	}
 }
 
+/*
+lexNumberUnit lexes a unit which directly follows a number. Returns an empty
+string if the number is not followed by a known unit.
+*/
+func lexNumberUnit(l *lexer) string {
+	start := l.pos
+
+	for unicode.IsLetter(l.next(1)) {
+		l.next(0)
+	}
+
+	unit := l.text(start, l.pos)
+
+	if _, ok := numberUnits[unit]; !ok || unicode.IsNumber(l.next(1)) || l.next(1) == '_' {
+		if unit != "" {
+			l.backup(l.pos - start)
+		}
+		unit = ""
+	}
+
+	return unit
+}
+
 // State functions
 // ===============
 
@@ -598,7 +760,7 @@ func lexToken(l *lexer) lexFunc {
 	// First try to parse a number
 
 	lexNumberBlock(l)
-	identifierCandidate := l.input[l.start:l.pos]
+	identifierCandidate := l.text(l.start, l.pos)
 	keywordCandidate := strings.ToLower(identifierCandidate)
 
 	// Check for number
@@ -607,7 +769,7 @@ func lexToken(l *lexer) lexFunc {
 		_, err := strconv.ParseFloat(keywordCandidate, 64)
 
 		if err == nil {
-			l.emitTokenAndValue(TokenNUMBER, keywordCandidate, false, false)
+			l.emitTokenAndValue(TokenNUMBER, keywordCandidate+lexNumberUnit(l), false, false)
 			return lexToken
 		}
 	}
@@ -616,7 +778,7 @@ func lexToken(l *lexer) lexFunc {
 		l.backup(l.pos - l.start)
 	}
 	lexTextBlock(l, true)
-	identifierCandidate = l.input[l.start:l.pos]
+	identifierCandidate = l.text(l.start, l.pos)
 	keywordCandidate = strings.ToLower(identifierCandidate)
 
 	// Check for keyword
@@ -703,7 +865,7 @@ func lexValue(l *lexer) lexFunc {
 	}
 
 	if allowEscapes {
-		val := l.input[l.start+1 : l.pos-1]
+		val := l.text(l.start+1, l.pos-1)
 
 		// Interpret escape sequences right away
 
@@ -724,7 +886,7 @@ func lexValue(l *lexer) lexFunc {
 
 	} else {
 
-		l.emitTokenAndValue(TokenSTRING, l.input[l.start+2:l.pos-1], false, false)
+		l.emitTokenAndValue(TokenSTRING, l.text(l.start+2, l.pos-1), false, false)
 	}
 
 	//  Set newline
@@ -752,13 +914,14 @@ func lexComment(l *lexer) lexFunc {
 			r = l.next(0)
 		}
 
-		l.emitTokenAndValue(TokenPOSTCOMMENT, l.input[l.start:l.pos], false, false)
+		l.emitTokenAndValue(TokenPOSTCOMMENT, l.text(l.start, l.pos), false, false)
 
 		if r == RuneEOF {
 			return nil
 		}
 
 		l.line++
+		l.lastnl = l.pos
 
 	} else {
 
@@ -785,7 +948,7 @@ func lexComment(l *lexer) lexFunc {
 			}
 		}
 
-		l.emitTokenAndValue(TokenPRECOMMENT, l.input[l.start:l.pos-1], false, false)
+		l.emitTokenAndValue(TokenPRECOMMENT, l.text(l.start, l.pos-1), false, false)
 
 		// Consume final /
 
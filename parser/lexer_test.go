@@ -12,12 +12,15 @@ package parser
 
 import (
 	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestNextItem(t *testing.T) {
 
-	l := &lexer{"Test", "1234", 0, 0, 0, 0, 0, 0, make(chan LexToken)}
+	l := &lexer{"Test", []byte("1234"), 0, 0, 0, 0, 0, 0, make(chan LexToken), 0, 0, nil, nil}
 
 	r := l.next(1)
 
@@ -70,14 +73,14 @@ func TestEquals(t *testing.T) {
 		return
 	}
 
-	if ok, msg := l[0].Equals(l[1], false); ok || msg != `ID is different 54 vs 7
+	if ok, msg := l[0].Equals(l[1], false); ok || msg != `ID is different 68 vs 7
 Pos is different 0 vs 5
 Val is different not vs test
 Identifier is different false vs true
 Lline is different 1 vs 2
 Lpos is different 1 vs 2
 {
-  "ID": 54,
+  "ID": 68,
   "Pos": 0,
   "Val": "not",
   "Identifier": false,
@@ -136,6 +139,31 @@ func TestBasicTokenLexing(t *testing.T) {
 		return
 	}
 
+	// Test numbers with units
+
+	input = `5s+200ms*10MB-4KiB 1.5e+2h`
+	if res := LexToList("mytest", input); fmt.Sprint(res) !=
+		`[v:"5s" + v:"200ms" * v:"10MB" - v:"4KiB" v:"1.5e+2h" EOF]` {
+		t.Error("Unexpected lexer result:\n  ", res)
+		return
+	}
+
+	for in, out := range map[string]string{
+		"200ms": "0.2",
+		"1.5h":  "5400",
+		"10MB":  "1e+07",
+		"4KiB":  "4096",
+		"300ns": "3e-07",
+		"12":    "12",
+		"4x":    "0 Unknown unit x in number 4x",
+		"s":     `0 strconv.ParseFloat: parsing "": invalid syntax`,
+	} {
+		if res, err := ParseNumber(in); fmt.Sprint(res) != out && fmt.Sprint(res, " ", err) != out {
+			t.Error("Unexpected result:", in, res, err)
+			return
+		}
+	}
+
 	// Test invalid identifier
 
 	input = `5test`
@@ -145,6 +173,13 @@ func TestBasicTokenLexing(t *testing.T) {
 		return
 	}
 
+	input = `5s1 10mb`
+	if res := LexToList("mytest", input); fmt.Sprint(res) !=
+		`[v:"5" "s1" v:"10" "mb" EOF]` {
+		t.Error("Unexpected lexer result:\n  ", res)
+		return
+	}
+
 	input = `@test`
 	if res := LexToList("mytest", input); fmt.Sprint(res) !=
 		`[Error: Cannot parse identifier '@test'. Identifies may only contain [a-zA-Z] and [a-zA-Z0-9] from the second character (Line 1, Pos 1) EOF]` {
@@ -347,3 +382,63 @@ suppresses [ "myothersink" ]
 		return
 	}
 }
+
+func TestReaderLexing(t *testing.T) {
+
+	input := `/*
+  Pre comment ü
+*/
+a := "multi
+line ö string" # post comment
+b := r'raw "string"' + 1.5e+2
+func foo(x) {
+    return x != [1, {"a" : 'b'}]
+}
+`
+
+	// Build an input which is larger than the chunk size of the lexer
+
+	input += strings.Repeat(input, lexReaderChunkSize/len(input)+1)
+
+	expected := fmt.Sprint(LexToList("mytest", input))
+
+	if res := fmt.Sprint(lexReaderToList("mytest", strings.NewReader(input))); res != expected {
+		t.Error("Unexpected lexer result:\n  ", res)
+		return
+	}
+
+	// Read one byte at a time (e.g. runes are split across reads)
+
+	if res := fmt.Sprint(lexReaderToList("mytest", iotest.OneByteReader(strings.NewReader(input)))); res != expected {
+		t.Error("Unexpected lexer result:\n  ", res)
+		return
+	}
+
+	// A large token which spans multiple chunks
+
+	longString := strings.Repeat("x", 3*lexReaderChunkSize)
+
+	if res := lexReaderToList("mytest", strings.NewReader(`a := "`+longString+`"`)); len(res) != 4 ||
+		res[2].Val != longString || res[3].ID != TokenEOF {
+		t.Error("Unexpected lexer result:", len(res))
+		return
+	}
+
+	// Read errors are reported
+
+	if res := fmt.Sprint(lexReaderToList("mytest", iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("a := 1"))))); res !=
+		`["a" Error: Could not read input: timeout (Line 1, Pos 1)]` {
+		t.Error("Unexpected lexer result:", res)
+		return
+	}
+}
+
+func lexReaderToList(name string, reader io.Reader) []LexToken {
+	var tokens []LexToken
+
+	for t := range LexReader(name, reader) {
+		tokens = append(tokens, t)
+	}
+
+	return tokens
+}
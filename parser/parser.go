@@ -12,6 +12,8 @@ package parser
 
 import (
 	"fmt"
+	"io"
+	"strings"
 )
 
 /*
@@ -39,6 +41,12 @@ func init() {
 		TokenMAP:        {NodeMAP, nil, nil, nil, nil, 0, nil, nil},
 		TokenPARAMS:     {NodePARAMS, nil, nil, nil, nil, 0, nil, nil},
 		TokenGUARD:      {NodeGUARD, nil, nil, nil, nil, 0, nil, nil},
+		TokenLISTCOMP:   {NodeLISTCOMP, nil, nil, nil, nil, 0, nil, nil},
+		TokenMAPCOMP:    {NodeMAPCOMP, nil, nil, nil, nil, 0, nil, nil},
+		TokenVARARGS:    {NodeVARARGS, nil, nil, nil, nil, 0, nil, nil},
+		TokenENUM:       {NodeENUM, nil, nil, nil, nil, 0, nil, nil},
+		TokenTYPE:       {NodeTYPE, nil, nil, nil, nil, 0, nil, nil},
+		TokenIMPORTLIST: {NodeIMPORTLIST, nil, nil, nil, nil, 0, nil, nil},
 
 		// Condition operators
 
@@ -66,7 +74,7 @@ func init() {
 
 		// Grouping
 
-		TokenCOLON: {NodeKVP, nil, nil, nil, nil, 60, nil, ldInfix},
+		TokenCOLON: {NodeKVP, nil, nil, nil, nil, 60, nil, ldKVP},
 		TokenEQUAL: {NodePRESET, nil, nil, nil, nil, 60, nil, ldInfix},
 
 		// Arithmetic operators
@@ -83,6 +91,11 @@ func init() {
 		TokenASSIGN: {NodeASSIGN, nil, nil, nil, nil, 10, nil, ldInfix},
 		TokenLET:    {NodeLET, nil, nil, nil, nil, 0, ndPrefix, nil},
 
+		// Conditional expressions
+
+		TokenQUESTION: {NodeTERNARY, nil, nil, nil, nil, 15, nil, ldTernary},
+		TokenCOALESCE: {NodeCOALESCE, nil, nil, nil, nil, 25, nil, ldInfix},
+
 		// Import statement
 
 		TokenIMPORT: {NodeIMPORT, nil, nil, nil, nil, 0, ndImport, nil},
@@ -96,11 +109,17 @@ func init() {
 		TokenSTATEMATCH: {NodeSTATEMATCH, nil, nil, nil, nil, 150, ndPrefix, nil},
 		TokenPRIORITY:   {NodePRIORITY, nil, nil, nil, nil, 150, ndPrefix, nil},
 		TokenSUPPRESSES: {NodeSUPPRESSES, nil, nil, nil, nil, 150, ndPrefix, nil},
+		TokenDEDUP:      {NodeDEDUP, nil, nil, nil, nil, 150, ndPrefix, nil},
+		TokenCOLLECT:    {NodeCOLLECT, nil, nil, nil, nil, 150, ndPrefix, nil},
+		TokenTIMEOUT:    {NodeTIMEOUT, nil, nil, nil, nil, 150, ndPrefix, nil},
+		TokenRETRIES:    {NodeRETRIES, nil, nil, nil, nil, 150, ndPrefix, nil},
+		TokenBACKOFF:    {NodeBACKOFF, nil, nil, nil, nil, 150, ndPrefix, nil},
 
 		// Function definition
 
 		TokenFUNC:   {NodeFUNC, nil, nil, nil, nil, 0, ndFunc, nil},
 		TokenRETURN: {NodeRETURN, nil, nil, nil, nil, 0, ndReturn, nil},
+		TokenYIELD:  {NodeYIELD, nil, nil, nil, nil, 0, ndReturn, nil},
 
 		// Boolean operators
 
@@ -144,6 +163,14 @@ func init() {
 		// Mutex statement
 
 		TokenMUTEX: {NodeMUTEX, nil, nil, nil, nil, 0, ndMutex, nil},
+
+		// Assert statement
+
+		TokenASSERT: {NodeASSERT, nil, nil, nil, nil, 0, ndAssert, nil},
+
+		// Constant declaration
+
+		TokenCONST: {NodeCONST, nil, nil, nil, nil, 0, ndConst, nil},
 	}
 }
 
@@ -154,10 +181,12 @@ func init() {
 Parser data structure
 */
 type parser struct {
-	name   string          // Name to identify the input
-	node   *ASTNode        // Current ast node
-	tokens *LABuffer       // Buffer which is connected to the channel which contains lex tokens
-	rp     RuntimeProvider // Runtime provider which creates runtime components
+	name         string          // Name to identify the input
+	node         *ASTNode        // Current ast node
+	tokens       *LABuffer       // Buffer which is connected to the channel which contains lex tokens
+	rp           RuntimeProvider // Runtime provider which creates runtime components
+	ternaryColon bool            // Flag if a colon ends the first value of a conditional expression
+	mapColon     bool            // Flag if a colon separates the key and the value of a map entry
 }
 
 /*
@@ -172,50 +201,212 @@ ParseWithRuntime parses a given input string and returns an AST decorated with
 runtime components.
 */
 func ParseWithRuntime(name string, input string, rp RuntimeProvider) (*ASTNode, error) {
+	return parse(name, Lex(name, input), rp)
+}
+
+/*
+ParseReader parses the input of a given reader and returns an AST. The input
+is lexed incrementally so large inputs do not need to be held in memory as a
+whole.
+*/
+func ParseReader(name string, reader io.Reader) (*ASTNode, error) {
+	return ParseReaderWithRuntime(name, reader, nil)
+}
+
+/*
+ParseReaderWithRuntime parses the input of a given reader and returns an AST
+decorated with runtime components.
+*/
+func ParseReaderWithRuntime(name string, reader io.Reader, rp RuntimeProvider) (*ASTNode, error) {
+	return parse(name, LexReader(name, reader), rp)
+}
+
+/*
+ParseResult is the result of parsing an input with error recovery.
+*/
+type ParseResult struct {
+	AST    *ASTNode // AST of all statements which could be parsed
+	Errors []error  // All syntax errors in the order of their appearance
+}
+
+/*
+ParseAll parses a given input string and returns an AST together with all
+syntax errors in the input. The parser resynchronizes after an error at the
+next statement boundary and continues parsing. The returned AST contains all
+statements which could be parsed (if there were errors the root is always a
+statements node).
+*/
+func ParseAll(name string, input string) *ParseResult {
+	return ParseAllWithRuntime(name, input, nil)
+}
+
+/*
+ParseAllWithRuntime parses a given input string and returns an AST decorated
+with runtime components together with all syntax errors in the input.
+*/
+func ParseAllWithRuntime(name string, input string, rp RuntimeProvider) *ParseResult {
+	ast, errs := parseStatements(name, Lex(name, input), rp, true)
+	return &ParseResult{ast, errs}
+}
+
+/*
+parse parses a given channel of lex tokens and returns an AST decorated with
+runtime components.
+*/
+func parse(name string, tokens chan LexToken, rp RuntimeProvider) (*ASTNode, error) {
+	var err error
+
+	ast, errs := parseStatements(name, tokens, rp, false)
+
+	if len(errs) > 0 {
+		err = errs[0]
+	}
+
+	return ast, err
+}
+
+/*
+parseStatements parses a given channel of lex tokens into a list of statements.
+If recovery is enabled the parser continues after an error with the next
+statement otherwise it stops at the first error.
+*/
+func parseStatements(name string, tokens chan LexToken, rp RuntimeProvider, recovery bool) (*ASTNode, []error) {
+	var statements []*ASTNode
+	var errs []error
+
+	// Consume remaining tokens if the parser stops early (e.g. on an error)
+	// so the lexer can finish
+
+	defer func() {
+		go func() {
+			for range tokens {
+			}
+		}()
+	}()
 
 	// Create a new parser with a look-ahead buffer of 3
 
-	p := &parser{name, nil, NewLABuffer(Lex(name, input), 3), rp}
+	p := &parser{name, nil, NewLABuffer(tokens, 3), rp, false, false}
 
 	// Read and set initial AST node
 
 	node, err := p.next()
 
 	if err != nil {
-		return nil, err
+		return nil, []error{err}
 	}
 
 	p.node = node
 
-	n, err := p.run(0)
+	for {
+		start := *p.node.Token
+
+		acceptStatementKeyword(p)
 
-	if err == nil && hasMoreStatements(p, n) {
+		n, err := p.run(0)
 
-		st := astNodeMap[TokenSTATEMENTS].instance(p, nil)
-		st.Children = append(st.Children, n)
+		if err == nil {
+			statements = append(statements, n)
 
-		for err == nil && hasMoreStatements(p, n) {
+			if !hasMoreStatements(p, n) {
 
-			// Skip semicolons
+				if p.node == nil || p.node.Token.ID == TokenEOF {
+					break
+				}
 
-			if p.node.Token.ID == TokenSEMICOLON {
-				skipToken(p, TokenSEMICOLON)
+				token := *p.node.Token
+				err = p.newParserError(ErrUnexpectedEnd, fmt.Sprintf("extra token id:%v (%v)",
+					token.ID, token), token)
+
+			} else if p.node.Token.ID == TokenSEMICOLON {
+
+				// Skip semicolons
+
+				err = skipToken(p, TokenSEMICOLON)
 			}
+		}
 
-			n, err = p.run(0)
-			st.Children = append(st.Children, n)
+		if err != nil {
+			errs = append(errs, err)
+
+			if !recovery || !p.resync(start, err, &errs) {
+				break
+			}
 		}
+	}
+
+	if len(statements) == 1 && len(errs) == 0 {
+
+		// Code with a single statement has no statements node
 
-		n = st
+		return statements[0], nil
 	}
 
-	if err == nil && p.node != nil && p.node.Token.ID != TokenEOF {
-		token := *p.node.Token
-		err = p.newParserError(ErrUnexpectedEnd, fmt.Sprintf("extra token id:%v (%v)",
-			token.ID, token), token)
+	st := astNodeMap[TokenSTATEMENTS].instance(p, nil)
+	st.Children = statements
+
+	return st, errs
+}
+
+/*
+resync skips over all tokens which belong to a statement which could not be
+parsed. The next statement starts either after a semicolon or with the first
+token on a following line which is not indented further than the start of the
+failed statement and which is not nested inside the failed statement. Returns
+false if there is no next statement.
+*/
+func (p *parser) resync(start LexToken, err error, errs *[]error) bool {
+	var nerr error
+
+	errLine := start.Lline
+
+	if perr, ok := err.(*Error); ok && perr.Line > errLine {
+		errLine = perr.Line
+	}
+
+	depth := 0
+
+	for p.node != nil && p.node.Token.ID != TokenEOF {
+		token := p.node.Token
+
+		switch token.ID {
+		case TokenLPAREN, TokenLBRACK, TokenLBRACE:
+			if depth == 0 && token.Lline > errLine && token.Lpos <= start.Lpos {
+				return true
+			}
+			depth++
+
+		case TokenRPAREN, TokenRBRACK, TokenRBRACE:
+
+			// Closing tokens without an opening token close a block which
+			// was opened before the error
+
+			if depth > 0 {
+				depth--
+			}
+
+		case TokenSEMICOLON:
+			if depth == 0 {
+				if nerr = skipToken(p, TokenSEMICOLON); nerr != nil {
+					*errs = append(*errs, nerr)
+					return false
+				}
+				return p.node.Token.ID != TokenEOF
+			}
+
+		default:
+			if depth == 0 && token.Lline > errLine && token.Lpos <= start.Lpos {
+				return true
+			}
+		}
+
+		if p.node, nerr = p.next(); nerr != nil {
+			*errs = append(*errs, nerr)
+			return false
+		}
 	}
 
-	return n, err
+	return false
 }
 
 /*
@@ -325,6 +516,12 @@ func (p *parser) next() (*ASTNode, error) {
 
 		return nil, p.newParserError(ErrLexicalError, token.Val, token)
 
+	} else if token.ID == TokenCOLON && p.ternaryColon {
+
+		// The colon ends the first value of a conditional expression
+
+		return ternaryColonNode.instance(p, &token), nil
+
 	} else if node, ok := astNodeMap[token.ID]; ok {
 
 		// We got a normal AST component
@@ -360,7 +557,12 @@ func ndInner(p *parser, self *ASTNode) (*ASTNode, error) {
 
 	// Get the inner expression
 
+	restore := p.colonContext(false, false)
+
 	exp, err := p.run(0)
+
+	restore()
+
 	if err != nil {
 		return nil, err
 	}
@@ -399,7 +601,13 @@ func ndImport(p *parser, self *ASTNode) (*ASTNode, error) {
 
 	err := acceptChild(p, self, TokenSTRING)
 
-	if err == nil {
+	if err == nil && p.node.Token.ID == TokenLPAREN {
+
+		// Parse a list of selected symbols
+
+		err = ndImportList(p, self)
+
+	} else if err == nil {
 
 		// Must specify AS
 
@@ -414,6 +622,64 @@ func ndImport(p *parser, self *ASTNode) (*ASTNode, error) {
 	return self, err
 }
 
+/*
+ndImportList is used to parse the selected symbols of an import. Each symbol
+can be given an alias with AS.
+*/
+func ndImportList(p *parser, self *ASTNode) error {
+	importList := astNodeMap[TokenIMPORTLIST].instance(p, p.node.Token)
+	self.Children = append(self.Children, importList)
+
+	err := skipToken(p, TokenLPAREN)
+
+	for err == nil && IsNotEndAndNotTokens(p, []LexTokenID{TokenRPAREN}) {
+
+		if err = acceptChild(p, importList, TokenIDENTIFIER); err == nil {
+
+			if p.node.Token.ID == TokenAS {
+				as := p.node
+				symbol := importList.Children[len(importList.Children)-1]
+
+				if err = skipToken(p, TokenAS); err == nil {
+					as.Children = append(as.Children, symbol)
+
+					if err = acceptChild(p, as, TokenIDENTIFIER); err == nil {
+						importList.Children[len(importList.Children)-1] = as
+					}
+				}
+			}
+
+			// Skip commas
+
+			if err == nil && p.node.Token.ID == TokenCOMMA {
+				err = skipToken(p, TokenCOMMA)
+			}
+		}
+	}
+
+	if err == nil {
+		if len(importList.Children) == 0 {
+			err = p.newParserError(ErrUnexpectedToken, p.node.Token.Val, *p.node.Token)
+		} else {
+			err = skipToken(p, TokenRPAREN)
+		}
+	}
+
+	return err
+}
+
+/*
+sinkKeywordMap contains keywords which are only recognised at the start of a
+sink property. Everywhere else they are normal identifiers.
+*/
+var sinkKeywordMap = map[string]LexTokenID{
+	"dedup":   TokenDEDUP,
+	"collect": TokenCOLLECT,
+	"timeout": TokenTIMEOUT,
+	"retries": TokenRETRIES,
+	"backoff": TokenBACKOFF,
+}
+
 /*
 ndSink is used to parse sinks.
 */
@@ -429,6 +695,8 @@ func ndSkink(p *parser, self *ASTNode) (*ASTNode, error) {
 		// Parse the rest of the parameters as children until we reach the body
 
 		for err == nil && IsNotEndAndNotTokens(p, []LexTokenID{TokenLBRACE}) {
+			acceptSinkKeyword(p)
+
 			if exp, err = p.run(150); err == nil {
 				self.Children = append(self.Children, exp)
 
@@ -451,6 +719,73 @@ func ndSkink(p *parser, self *ASTNode) (*ASTNode, error) {
 	return ret, err
 }
 
+/*
+acceptSinkKeyword turns the current node into a sink property keyword if it is
+an identifier which names one.
+*/
+func acceptSinkKeyword(p *parser) {
+	if p.node.Token.ID != TokenIDENTIFIER {
+		return
+	}
+
+	if id, ok := sinkKeywordMap[strings.ToLower(p.node.Token.Val)]; ok {
+		token := *p.node.Token
+		token.ID = id
+		token.Identifier = false
+
+		node := astNodeMap[id].instance(p, &token)
+		node.Meta = p.node.Meta
+		p.node = node
+	}
+}
+
+/*
+statementKeywordMap contains keywords which are only recognised at the start of
+a statement. Outside of this position they can still be used as names (e.g. of
+variables or functions).
+*/
+var statementKeywordMap = map[string]LexTokenID{
+	"yield":  TokenYIELD,
+	"assert": TokenASSERT,
+	"const":  TokenCONST,
+}
+
+/*
+acceptStatementKeyword turns the current node into a statement keyword if it is
+an identifier which names one and which is not used as a name. A name is
+assigned, accessed or called directly (e.g. assert := 1 or assert(x)). A
+constant declaration must be followed by the name of the constant.
+*/
+func acceptStatementKeyword(p *parser) {
+	if p.node == nil || p.node.Token.ID != TokenIDENTIFIER {
+		return
+	}
+
+	id, ok := statementKeywordMap[strings.ToLower(p.node.Token.Val)]
+
+	if !ok {
+		return
+	}
+
+	token := *p.node.Token
+	next, _ := p.tokens.Peek(0)
+
+	adjacent := next.Pos == token.Pos+len(token.Val)
+
+	if next.ID == TokenASSIGN || next.ID == TokenDOT ||
+		(adjacent && (next.ID == TokenLPAREN || next.ID == TokenLBRACK)) ||
+		(id == TokenCONST && next.ID != TokenIDENTIFIER) {
+		return
+	}
+
+	token.ID = id
+	token.Identifier = false
+
+	node := astNodeMap[id].instance(p, &token)
+	node.Meta = p.node.Meta
+	p.node = node
+}
+
 /*
 ndFunc is used to parse function definitions.
 */
@@ -467,6 +802,8 @@ func ndFunc(p *parser, self *ASTNode) (*ASTNode, error) {
 	// Read in parameters
 
 	if err == nil {
+		restore := p.colonContext(false, false)
+
 		err = skipToken(p, TokenLPAREN)
 
 		params := astNodeMap[TokenPARAMS].instance(p, nil)
@@ -474,22 +811,59 @@ func ndFunc(p *parser, self *ASTNode) (*ASTNode, error) {
 
 		for err == nil && IsNotEndAndNotTokens(p, []LexTokenID{TokenRPAREN}) {
 
+			if p.node.Token.ID == TokenTIMES {
+
+				// Parse a variadic parameter which must be the last parameter
+
+				varargs := astNodeMap[TokenVARARGS].instance(p, p.node.Token)
+
+				if err = skipToken(p, TokenTIMES); err == nil {
+					if err = acceptChild(p, varargs, TokenIDENTIFIER); err == nil {
+						params.Children = append(params.Children, varargs)
+
+						if p.node.Token.ID != TokenRPAREN {
+							err = p.newParserError(ErrUnexpectedToken,
+								"Variadic parameter must be the last parameter", *p.node.Token)
+						}
+					}
+				}
+
+				continue
+			}
+
 			// Parse all the expressions inside
 
 			if exp, err = p.run(0); err == nil {
-				params.Children = append(params.Children, exp)
+				if exp, err = typedParam(p, exp); err == nil {
+					params.Children = append(params.Children, exp)
 
-				if p.node.Token.ID == TokenCOMMA {
-					err = skipToken(p, TokenCOMMA)
+					if p.node.Token.ID == TokenCOMMA {
+						err = skipToken(p, TokenCOMMA)
+					}
 				}
 			}
 		}
 
+		restore()
+
 		if err == nil {
 			err = skipToken(p, TokenRPAREN)
 		}
 	}
 
+	if err == nil && p.node.Token.ID == TokenCOLON {
+
+		// Parse the return type
+
+		returnType := astNodeMap[TokenTYPE].instance(p, p.node.Token)
+
+		if err = skipToken(p, TokenCOLON); err == nil {
+			if err = acceptChild(p, returnType, TokenIDENTIFIER); err == nil {
+				self.Children = append(self.Children, returnType)
+			}
+		}
+	}
+
 	if err == nil {
 
 		// Parse the body
@@ -500,6 +874,39 @@ func ndFunc(p *parser, self *ASTNode) (*ASTNode, error) {
 	return self, err
 }
 
+/*
+typedParam converts a function parameter of the form name: type into a type
+annotation.
+*/
+func typedParam(p *parser, exp *ASTNode) (*ASTNode, error) {
+	param := exp
+
+	if exp.Name == NodePRESET {
+		param = exp.Children[0]
+	}
+
+	if param.Name == NodeKVP {
+
+		if param.Children[0].Name != NodeIDENTIFIER || len(param.Children[0].Children) != 0 ||
+			param.Children[1].Name != NodeIDENTIFIER || len(param.Children[1].Children) != 0 {
+
+			return nil, p.newParserError(ErrUnexpectedToken,
+				"Type annotation must be a parameter name followed by a type name", *param.Token)
+		}
+
+		typed := astNodeMap[TokenTYPE].instance(p, param.Token)
+		typed.Children = param.Children
+
+		if exp.Name == NodePRESET {
+			exp.Children[0] = typed
+		} else {
+			exp = typed
+		}
+	}
+
+	return exp, nil
+}
+
 /*
 ndReturn is used to parse return statements.
 */
@@ -536,8 +943,6 @@ func ndIdentifier(p *parser, self *ASTNode) (*ASTNode, error) {
 			err = parseFuncCall(current)
 		} else if p.node.Token.ID == TokenLBRACK && p.node.Token.Lline == self.Token.Lline {
 
-			skipToken(p, TokenLBRACK)
-
 			// Composition access needs to be on the same line as the identifier
 			// as we might otherwise have a list
 
@@ -564,6 +969,8 @@ func ndIdentifier(p *parser, self *ASTNode) (*ASTNode, error) {
 	parseFuncCall = func(current *ASTNode) error {
 		var exp *ASTNode
 
+		restore := p.colonContext(false, false)
+
 		err := skipToken(p, TokenLPAREN)
 
 		fc := astNodeMap[TokenFUNCCALL].instance(p, nil)
@@ -584,6 +991,8 @@ func ndIdentifier(p *parser, self *ASTNode) (*ASTNode, error) {
 			}
 		}
 
+		restore()
+
 		if err == nil {
 			if err = skipToken(p, TokenRPAREN); err == nil {
 				err = parseMore(current)
@@ -595,14 +1004,23 @@ func ndIdentifier(p *parser, self *ASTNode) (*ASTNode, error) {
 
 	parseCompositionAccess = func(current *ASTNode) error {
 		var exp *ASTNode
-		var err error
+
+		restore := p.colonContext(false, false)
+
+		err := skipToken(p, TokenLBRACK)
 
 		ca := astNodeMap[TokenCOMPACCESS].instance(p, nil)
 		current.Children = append(current.Children, ca)
 
 		// Parse all the expressions inside the directives
 
-		if exp, err = p.run(0); err == nil {
+		if err == nil {
+			exp, err = p.run(0)
+		}
+
+		restore()
+
+		if err == nil {
 			ca.Children = append(ca.Children, exp)
 
 			if err = skipToken(p, TokenRBRACK); err == nil {
@@ -623,6 +1041,10 @@ func ndList(p *parser, self *ASTNode) (*ASTNode, error) {
 	var err error
 	var exp *ASTNode
 
+	// A colon inside a list never ends a conditional expression
+
+	restore := p.colonContext(false, false)
+
 	// Create a list token
 
 	st := astNodeMap[TokenLIST].instance(p, self.Token)
@@ -634,6 +1056,17 @@ func ndList(p *parser, self *ASTNode) (*ASTNode, error) {
 		// Parse all the expressions inside
 
 		if exp, err = p.run(0); err == nil {
+
+			if len(st.Children) == 0 && p.node.Token.ID == TokenFOR {
+
+				// The expression is part of a list comprehension
+
+				st = astNodeMap[TokenLISTCOMP].instance(p, self.Token)
+				err = parseComprehension(p, st, exp)
+
+				break
+			}
+
 			st.Children = append(st.Children, exp)
 
 			if p.node.Token.ID == TokenCOMMA {
@@ -642,6 +1075,8 @@ func ndList(p *parser, self *ASTNode) (*ASTNode, error) {
 		}
 	}
 
+	restore()
+
 	if err == nil {
 		err = skipToken(p, TokenRBRACK)
 	}
@@ -658,6 +1093,11 @@ func ndMap(p *parser, self *ASTNode) (*ASTNode, error) {
 	var err error
 	var exp *ASTNode
 
+	// The colon always separates key-value pairs inside a map (even inside a
+	// conditional expression)
+
+	restore := p.colonContext(false, true)
+
 	// Create a map token
 
 	st := astNodeMap[TokenMAP].instance(p, self.Token)
@@ -669,6 +1109,23 @@ func ndMap(p *parser, self *ASTNode) (*ASTNode, error) {
 		// Parse all the expressions inside
 
 		if exp, err = p.run(0); err == nil {
+
+			if len(st.Children) == 0 && p.node.Token.ID == TokenFOR {
+
+				// The expression is part of a map comprehension
+
+				if exp.Token.ID != TokenCOLON {
+					err = p.newParserError(ErrUnexpectedToken,
+						"Map comprehension must start with a key-value pair", *exp.Token)
+					break
+				}
+
+				st = astNodeMap[TokenMAPCOMP].instance(p, self.Token)
+				err = parseComprehension(p, st, exp)
+
+				break
+			}
+
 			st.Children = append(st.Children, exp)
 
 			if p.node.Token.ID == TokenCOMMA {
@@ -677,6 +1134,10 @@ func ndMap(p *parser, self *ASTNode) (*ASTNode, error) {
 		}
 	}
 
+	// Restore the colon before reading the token after the closing brace
+
+	restore()
+
 	if err == nil {
 		err = skipToken(p, TokenRBRACE)
 	}
@@ -686,6 +1147,44 @@ func ndMap(p *parser, self *ASTNode) (*ASTNode, error) {
 	return st, err
 }
 
+/*
+parseComprehension parses the loop part of a comprehension. The comprehension
+node gets the in expression, the value expression and an optional guard as
+children.
+*/
+func parseComprehension(p *parser, self *ASTNode, exp *ASTNode) error {
+
+	err := skipToken(p, TokenFOR)
+
+	if err == nil {
+		var in *ASTNode
+
+		if in, err = p.run(0); err == nil {
+
+			if in.Token.ID != TokenIN {
+				return p.newParserError(ErrUnexpectedToken,
+					"Comprehension must have an in expression", *in.Token)
+			}
+
+			self.Children = append(self.Children, in, exp)
+
+			if p.node.Token.ID == TokenIF {
+				var guard *ASTNode
+
+				if err = skipToken(p, TokenIF); err == nil {
+					if guard, err = p.run(0); err == nil {
+						g := astNodeMap[TokenGUARD].instance(p, nil)
+						g.Children = append(g.Children, guard)
+						self.Children = append(self.Children, g)
+					}
+				}
+			}
+		}
+	}
+
+	return err
+}
+
 /*
 ndGuard is used to parse a conditional statement.
 */
@@ -844,13 +1343,17 @@ func ndOtherwiseFinally(p *parser, try *ASTNode, err error) (*ASTNode, error) {
 }
 
 /*
-ndMutex is used to parse a mutex block.
+ndMutex is used to parse a mutex block with an optional locking mode.
 */
 func ndMutex(p *parser, self *ASTNode) (*ASTNode, error) {
 	var block *ASTNode
 
 	err := acceptChild(p, self, TokenIDENTIFIER)
 
+	if err == nil && p.node.Token.ID == TokenIDENTIFIER {
+		err = acceptChild(p, self, TokenIDENTIFIER)
+	}
+
 	if err == nil {
 		block, err = parseInnerStatements(p, self)
 	}
@@ -858,6 +1361,79 @@ func ndMutex(p *parser, self *ASTNode) (*ASTNode, error) {
 	return block, err
 }
 
+/*
+ndAssert is used to parse an assert statement with an optional message.
+*/
+func ndAssert(p *parser, self *ASTNode) (*ASTNode, error) {
+
+	exp, err := p.run(0)
+
+	if err == nil {
+		self.Children = append(self.Children, exp)
+
+		if p.node != nil && p.node.Token.ID == TokenCOMMA {
+			var msg *ASTNode
+
+			if err = skipToken(p, TokenCOMMA); err == nil {
+				if msg, err = p.run(0); err == nil {
+					self.Children = append(self.Children, msg)
+				}
+			}
+		}
+	}
+
+	return self, err
+}
+
+/*
+ndConst is used to parse a constant declaration. A constant is either declared
+with a single value or as a group of enum constants.
+*/
+func ndConst(p *parser, self *ASTNode) (*ASTNode, error) {
+	var exp *ASTNode
+
+	// Must specify a name
+
+	err := acceptChild(p, self, TokenIDENTIFIER)
+
+	if err == nil {
+
+		if p.node.Token.ID == TokenLBRACE {
+
+			// Parse the enum constants - a constant is either an identifier or
+			// an assignment of a value
+
+			enum := astNodeMap[TokenENUM].instance(p, p.node.Token)
+			self.Children = append(self.Children, enum)
+
+			err = skipToken(p, TokenLBRACE)
+
+			for err == nil && IsNotEndAndNotTokens(p, []LexTokenID{TokenRBRACE}) {
+
+				if exp, err = p.run(0); err == nil {
+					enum.Children = append(enum.Children, exp)
+
+					if p.node.Token.ID == TokenCOMMA {
+						err = skipToken(p, TokenCOMMA)
+					}
+				}
+			}
+
+			if err == nil {
+				err = skipToken(p, TokenRBRACE)
+			}
+
+		} else if err = skipToken(p, TokenASSIGN); err == nil {
+
+			if exp, err = p.run(0); err == nil {
+				self.Children = append(self.Children, exp)
+			}
+		}
+	}
+
+	return self, err
+}
+
 // Standard left denotation functions
 // ==================================
 
@@ -877,9 +1453,79 @@ func ldInfix(p *parser, self *ASTNode, left *ASTNode) (*ASTNode, error) {
 	return self, nil
 }
 
+/*
+ldKVP is used for key-value pairs. The value of a map entry extends up to the
+next comma so it can be any expression (e.g. a conditional expression).
+*/
+func ldKVP(p *parser, self *ASTNode, left *ASTNode) (*ASTNode, error) {
+
+	if !p.mapColon {
+		return ldInfix(p, self, left)
+	}
+
+	right, err := p.run(0)
+	if err != nil {
+		return nil, err
+	}
+
+	self.Children = append(self.Children, left)
+	self.Children = append(self.Children, right)
+
+	return self, nil
+}
+
+/*
+ternaryColonNode is used for a colon which ends the first value of a conditional
+expression.
+*/
+var ternaryColonNode = &ASTNode{"", nil, nil, nil, nil, 0, nil, nil}
+
+/*
+ldTernary is used to parse a conditional expression (cond ? a : b).
+*/
+func ldTernary(p *parser, self *ASTNode, left *ASTNode) (*ASTNode, error) {
+
+	// The colon ends the first value while parsing a conditional expression
+
+	restore := p.colonContext(true, false)
+
+	first, err := p.run(0)
+
+	restore()
+
+	if err == nil {
+		var second *ASTNode
+
+		if err = skipToken(p, TokenCOLON); err == nil {
+
+			// Conditional expressions are right associative
+
+			if second, err = p.run(self.binding - 1); err == nil {
+				self.Children = append(self.Children, left, first, second)
+			}
+		}
+	}
+
+	return self, err
+}
+
 // Helper functions
 // ================
 
+/*
+colonContext sets how a colon is parsed while reading the tokens of a nested
+expression. Returns a function which restores the previous context - it must be
+called before the token after the nested expression is read.
+*/
+func (p *parser) colonContext(ternaryColon bool, mapColon bool) func() {
+	ternaryColonBak, mapColonBak := p.ternaryColon, p.mapColon
+	p.ternaryColon, p.mapColon = ternaryColon, mapColon
+
+	return func() {
+		p.ternaryColon, p.mapColon = ternaryColonBak, mapColonBak
+	}
+}
+
 /*
 IsNotEndAndToken checks if the next token is of a specific type or the end has been reached.
 */
@@ -970,9 +1616,15 @@ a right brace '}'.
 */
 func parseInnerStatements(p *parser, self *ASTNode) (*ASTNode, error) {
 
+	// Statements inside braces are never part of a conditional expression or
+	// a map entry
+
+	restore := p.colonContext(false, false)
+
 	// Must start with an opening brace
 
 	if err := skipToken(p, TokenLBRACE); err != nil {
+		restore()
 		return nil, err
 	}
 
@@ -985,6 +1637,8 @@ func parseInnerStatements(p *parser, self *ASTNode) (*ASTNode, error) {
 
 	if p.node != nil && p.node.Token.ID != TokenRBRACE {
 
+		acceptStatementKeyword(p)
+
 		n, err := p.run(0)
 
 		if p.node != nil && p.node.Token.ID != TokenEOF {
@@ -999,17 +1653,22 @@ func parseInnerStatements(p *parser, self *ASTNode) (*ASTNode, error) {
 					break
 				}
 
+				acceptStatementKeyword(p)
+
 				n, err = p.run(0)
 				st.Children = append(st.Children, n)
 			}
 		}
 
 		if err != nil {
+			restore()
 			return nil, err
 		}
 	}
 
 	// Must end with a closing brace
 
+	restore()
+
 	return self, skipToken(p, TokenRBRACE)
 }
@@ -12,6 +12,7 @@ package parser
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -232,6 +233,142 @@ or
 	}
 }
 
+func TestConditionalExpressionParsing(t *testing.T) {
+	input := "x := a > 1 and b ? {\"a\" : 1} : c ?? d ? 1 + 2 : 3"
+	expectedOutput := `
+:=
+  identifier: x
+  ternary
+    and
+      >
+        identifier: a
+        number: 1
+      identifier: b
+    map
+      kvp
+        string: 'a'
+        number: 1
+    ternary
+      coalesce
+        identifier: c
+        identifier: d
+      plus
+        number: 1
+        number: 2
+      number: 3
+`[1:]
+
+	res, err := UnitTestParseWithPPResult("mytest", input, `x := a > 1 and b ? {"a" : 1} : c ?? d ? 1 + 2 : 3`)
+
+	if err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = "{ a : (b ?? 1) + 2, c : (d ? e : f) }"
+	expectedOutput = `
+map
+  kvp
+    identifier: a
+    plus
+      coalesce
+        identifier: b
+        number: 1
+      number: 2
+  kvp
+    identifier: c
+    ternary
+      identifier: d
+      identifier: e
+      identifier: f
+`[1:]
+
+	res, err = UnitTestParseWithPPResult("mytest", input, `{a : (b ?? 1) + 2, c : (d ? e : f)}`)
+
+	if err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	// The value of a map entry can be a conditional expression
+
+	input = `{"a" : c ? 1 : 2, "b" : d}`
+	expectedOutput = `
+map
+  kvp
+    string: 'a'
+    ternary
+      identifier: c
+      number: 1
+      number: 2
+  kvp
+    string: 'b'
+    identifier: d
+`[1:]
+
+	res, err = UnitTestParseWithPPResult("mytest", input, `{"a" : (c ? 1 : 2), "b" : d}`)
+
+	if err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	// A colon inside brackets does not end the first value
+
+	input = `c ? l[1:2] : f(x[a:b], (d ? 1 : 2))`
+	expectedOutput = `
+ternary
+  identifier: c
+  identifier: l
+    compaccess
+      kvp
+        number: 1
+        number: 2
+  identifier: f
+    funccall
+      identifier: x
+        compaccess
+          kvp
+            identifier: a
+            identifier: b
+      ternary
+        identifier: d
+        number: 1
+        number: 2
+`[1:]
+
+	if res, err := UnitTestParse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = "a ? b c"
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected term (c) (Line:1 Pos:7)" {
+		t.Error(err)
+		return
+	}
+
+	// Conditional expressions and maps can be parsed concurrently
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := Parse("mytest", "x := a ? {b : c ? d : e} : f"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
 func TestCompositionStructureParsing(t *testing.T) {
 
 	// Assignment of map
@@ -324,6 +461,61 @@ statements
 		return
 	}
 
+	input = `x := [a * 2 for a in l if a > 3]; y := {k : v for [k, v] in m}`
+	expectedOutput = `
+statements
+  :=
+    identifier: x
+    listcomp
+      in
+        identifier: a
+        identifier: l
+      times
+        identifier: a
+        number: 2
+      guard
+        >
+          identifier: a
+          number: 3
+  :=
+    identifier: y
+    mapcomp
+      in
+        list
+          identifier: k
+          identifier: v
+        identifier: m
+      kvp
+        identifier: k
+        identifier: v
+`[1:]
+
+	if res, err := UnitTestParse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `x := [a for 1]`
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected term (Comprehension must have an in expression) (Line:1 Pos:13)" {
+		t.Error(err)
+		return
+	}
+
+	input = `x := {a for a in l}`
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected term (Map comprehension must start with a key-value pair) (Line:1 Pos:7)" {
+		t.Error(err)
+		return
+	}
+
+	input = `x := [a for a in l, 1]`
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected term (,) (Line:1 Pos:19)" {
+		t.Error(err)
+		return
+	}
+
 	input = `x := [1,2];[a,b] := x`
 	expectedOutput = `
 statements
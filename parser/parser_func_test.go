@@ -35,6 +35,43 @@ statements
 		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
 		return
 	}
+
+	input = `import "lib/strutil.ecal" (capitalize, pad as padLeft,)
+import "lib/math.ecal" (sum)`
+	expectedOutput = `
+statements
+  import
+    string: 'lib/strutil.ecal'
+    importlist
+      identifier: capitalize
+      as
+        identifier: pad
+        identifier: padLeft
+  import
+    string: 'lib/math.ecal'
+    importlist
+      identifier: sum
+`[1:]
+
+	if res, err := UnitTestParseWithPPResult("mytest", input, `import "lib/strutil.ecal" (capitalize, pad as padLeft)
+import "lib/math.ecal" (sum)`); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `import "lib/strutil.ecal" ()`
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected term ()) (Line:1 Pos:28)" {
+		t.Error(err)
+		return
+	}
+
+	input = `import "lib/strutil.ecal" (capitalize as)`
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected term ()) (Line:1 Pos:41)" {
+		t.Error(err)
+		return
+	}
 }
 
 func TestSinkParsing(t *testing.T) {
@@ -45,7 +82,12 @@ func TestSinkParsing(t *testing.T) {
 	scopematch [ "data.read", "data.write" ],
 	statematch { "priority:" : 5, test: 1, "bla 1": null },
 	priority 0,
-	suppresses [ "test1", test2 ]
+	suppresses [ "test1", test2 ],
+	dedup { "window" : 10, "key" : "id" },
+	collect 5,
+	timeout 200ms,
+	retries 3,
+	backoff 100ms
 	{
 		print("test1");
 		print("test2")
@@ -79,6 +121,22 @@ sink
     list
       string: 'test1'
       identifier: test2
+  dedup
+    map
+      kvp
+        string: 'window'
+        number: 10
+      kvp
+        string: 'key'
+        string: 'id'
+  collect
+    number: 5
+  timeout
+    number: 200ms
+  retries
+    number: 3
+  backoff
+    number: 100ms
   statements
     identifier: print
       funccall
@@ -116,6 +174,64 @@ sink
 		return
 	}
 
+	// Sink property keywords are only recognised in a sink header
+
+	input = `
+timeout := 5
+backoff := 1
+retries := 1
+collect := 1
+dedup := 1
+a.b.timeout := 1
+log(event.state.timeout)
+sink mySink
+    kindmatch [ "foo" ],
+	timeout timeout
+	{
+	}
+`
+	expectedOutput = `
+statements
+  :=
+    identifier: timeout
+    number: 5
+  :=
+    identifier: backoff
+    number: 1
+  :=
+    identifier: retries
+    number: 1
+  :=
+    identifier: collect
+    number: 1
+  :=
+    identifier: dedup
+    number: 1
+  :=
+    identifier: a
+      identifier: b
+        identifier: timeout
+    number: 1
+  identifier: log
+    funccall
+      identifier: event
+        identifier: state
+          identifier: timeout
+  sink
+    identifier: mySink
+    kindmatch
+      list
+        string: 'foo'
+    timeout
+      identifier: timeout
+    statements
+`[1:]
+
+	if res, err := UnitTestParse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
 	input = `
 	sink fooBar
     ==
@@ -197,6 +313,134 @@ function
 		return
 	}
 
+	input = `
+func mygen(n) {
+  yield
+  yield n * 2
+}
+`
+	expectedOutput = `
+function
+  identifier: mygen
+  params
+    identifier: n
+  statements
+    yield
+    yield
+      times
+        identifier: n
+        number: 2
+`[1:]
+
+	if res, err := UnitTestParse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+func myfunc(a, b=a + 1, *rest) {
+  return rest
+}
+`
+	expectedOutput = `
+function
+  identifier: myfunc
+  params
+    identifier: a
+    preset
+      identifier: b
+      plus
+        identifier: a
+        number: 1
+    varargs
+      identifier: rest
+  statements
+    return
+      identifier: rest
+`[1:]
+
+	if res, err := UnitTestParseWithPPResult("mytest", input, `func myfunc(a, b=a + 1, *rest) {
+    return rest
+}`); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `
+func myfunc(a: number, b: string="x", c, *rest) : list {
+  return [a, b]
+}
+`
+	expectedOutput = `
+function
+  identifier: myfunc
+  params
+    type
+      identifier: a
+      identifier: number
+    preset
+      type
+        identifier: b
+        identifier: string
+      string: 'x'
+    identifier: c
+    varargs
+      identifier: rest
+  type
+    identifier: list
+  statements
+    return
+      list
+        identifier: a
+        identifier: b
+`[1:]
+
+	if res, err := UnitTestParseWithPPResult("mytest", input, `func myfunc(a: number, b: string="x", c, *rest): list {
+    return [a, b]
+}`); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `x := func(a) : map {}`
+	expectedOutput = `
+:=
+  identifier: x
+  function
+    params
+      identifier: a
+    type
+      identifier: map
+    statements
+`[1:]
+
+	if res, err := UnitTestParseWithPPResult("mytest", input, `x := func (a): map {
+}`); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `func myfunc(a: b.c) {}`
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected term (Type annotation must be a parameter name followed by a type name) (Line:1 Pos:14)" {
+		t.Error(err)
+		return
+	}
+
+	input = `func myfunc(*rest, a) {}`
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected term (Variadic parameter must be the last parameter) (Line:1 Pos:18)" {
+		t.Error(err)
+		return
+	}
+
+	input = `func myfunc(*1) {}`
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected term (1) (Line:1 Pos:14)" {
+		t.Error(err)
+		return
+	}
+
 	input = `
 func() {
   a := 1
@@ -12,7 +12,9 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestStatementParsing(t *testing.T) {
@@ -138,6 +140,157 @@ number: 1 #  foo   foo bar
 	}
 }
 
+func TestReaderParsing(t *testing.T) {
+	var buf strings.Builder
+
+	// Generate a large data table
+
+	buf.WriteString("/* Data table */\ntable := [\n")
+	for i := 0; i < 2000; i++ {
+		buf.WriteString(fmt.Sprintf("  {\"id\" : %v, \"name\" : \"item%v\"},\n", i, i))
+	}
+	buf.WriteString("]\nlog(len(table))\n")
+
+	input := buf.String()
+
+	expected, err := Parse("test", input)
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	ast, err := ParseReader("test", strings.NewReader(input))
+
+	if err != nil || ast.String() != expected.String() {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if ok, msg := ast.Equals(expected, false); !ok {
+		t.Error("Unexpected result:", msg)
+		return
+	}
+
+	// Errors are reported like errors of string input
+
+	if _, err := ParseReader("test", strings.NewReader("a := 1\nb := 1 +")); err == nil || err.Error() != "Parse error in test: Unexpected end" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := ParseReader("test", iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("a := 1")))); err == nil ||
+		err.Error() != "Parse error in test: Lexical error (Could not read input: timeout) (Line:1 Pos:1)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestParseAll(t *testing.T) {
+
+	input := `a := 1
+b := )
+c := 3
+func foo() {
+  x := [1, 2
+  y := 1
+}
+d := 4 e := 5
+f := 6; g := ) ; h := 7
+i := {
+  "a" : 1,,
+}
+j := 8
+`
+	expectedOutput := `
+statements
+  :=
+    identifier: a
+    number: 1
+  :=
+    identifier: c
+    number: 3
+  :=
+    identifier: d
+    number: 4
+  :=
+    identifier: f
+    number: 6
+  :=
+    identifier: h
+    number: 7
+  :=
+    identifier: j
+    number: 8
+`[1:]
+
+	expectedErrors := `
+Parse error in test: Term cannot start an expression ()) (Line:2 Pos:6)
+Parse error in test: Term cannot start an expression (}) (Line:7 Pos:1)
+Parse error in test: Unexpected end (extra token id:7 ("e")) (Line:8 Pos:8)
+Parse error in test: Term cannot start an expression ()) (Line:9 Pos:14)
+Parse error in test: Term cannot start an expression (,) (Line:11 Pos:11)`[1:]
+
+	res := ParseAll("test", input)
+
+	var errs []string
+	for _, err := range res.Errors {
+		errs = append(errs, err.Error())
+	}
+
+	if fmt.Sprint(res.AST) != expectedOutput || strings.Join(errs, "\n") != expectedErrors {
+		t.Error("Unexpected result:\n", res.AST, strings.Join(errs, "\n"))
+		return
+	}
+
+	// Nested statements are skipped until the indentation of the failed statement
+
+	res = ParseAll("test", "a := 1\n  b := )\n    c := 1\n  d := 1\nif a {\n  b := )\n}\ne := 1")
+
+	if fmt.Sprint(res.AST) != `
+statements
+  :=
+    identifier: a
+    number: 1
+  :=
+    identifier: d
+    number: 1
+  :=
+    identifier: e
+    number: 1
+`[1:] || fmt.Sprint(res.Errors) != "[Parse error in test: Term cannot start an expression ()) (Line:2 Pos:8) "+
+		"Parse error in test: Term cannot start an expression ()) (Line:6 Pos:8)]" {
+		t.Error("Unexpected result:\n", res.AST, res.Errors)
+		return
+	}
+
+	// Lexer errors stop the parser
+
+	res = ParseAll("test", "a := 1\nb := 'unclosed\nc := 1")
+
+	if len(res.AST.Children) != 1 || fmt.Sprint(res.Errors) != "[Parse error in test: Lexical error "+
+		"(Unexpected end while reading string value (unclosed quotes)) (Line:2 Pos:6)]" {
+		t.Error("Unexpected result:\n", res.AST, res.Errors)
+		return
+	}
+
+	// Without errors the result is the same as a normal parse
+
+	for _, input := range []string{"a := 1", "a := 1\nb := 2; c := 3", "a := 1;", ""} {
+		ast, err := Parse("test", input)
+		res := ParseAll("test", input)
+
+		if err != nil {
+			if fmt.Sprint(res.Errors) != fmt.Sprint([]error{err}) {
+				t.Error("Unexpected result:", input, res.Errors, err)
+				return
+			}
+		} else if len(res.Errors) != 0 || fmt.Sprint(res.AST) != fmt.Sprint(ast) {
+			t.Error("Unexpected result:", input, res.AST, ast)
+			return
+		}
+	}
+}
+
 func TestErrorConditions(t *testing.T) {
 
 	input := ``
@@ -168,7 +321,7 @@ func TestErrorConditions(t *testing.T) {
 
 	input = `a := 1 + a`
 
-	p := &parser{"test", nil, NewLABuffer(Lex("test", input), 3), nil}
+	p := &parser{"test", nil, NewLABuffer(Lex("test", input), 3), nil, false, false}
 	node, _ := p.next()
 	p.node = node
 
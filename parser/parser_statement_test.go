@@ -181,6 +181,176 @@ mutex
 		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
 		return
 	}
+
+	input = `
+a := mutex foo trylock {
+	print(1)
+}
+`
+	expectedOutput = `
+:=
+  identifier: a
+  mutex
+    identifier: foo
+    identifier: trylock
+    statements
+      identifier: print
+        funccall
+          number: 1
+`[1:]
+
+	if res, err := UnitTestParse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+}
+
+func TestAssertParsing(t *testing.T) {
+
+	input := `
+assert a > 1
+assert len(b) == 2 and c, "Unexpected " + c
+`
+	expectedOutput := `
+statements
+  assert
+    >
+      identifier: a
+      number: 1
+  assert
+    and
+      ==
+        identifier: len
+          funccall
+            identifier: b
+        number: 2
+      identifier: c
+    plus
+      string: 'Unexpected '
+      identifier: c
+`[1:]
+
+	if res, err := UnitTestParseWithPPResult("mytest", input, `assert a > 1
+assert len(b) == 2 and c, "Unexpected " + c`); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `assert a,`
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected end" {
+		t.Error(err)
+		return
+	}
+}
+
+func TestConstParsing(t *testing.T) {
+
+	input := `
+const MaxSize := 10 * 2
+const Color { RED, GREEN := 5, BLUE }
+const Empty {}
+`
+	expectedOutput := `
+statements
+  const
+    identifier: MaxSize
+    times
+      number: 10
+      number: 2
+  const
+    identifier: Color
+    enum
+      identifier: RED
+      :=
+        identifier: GREEN
+        number: 5
+      identifier: BLUE
+  const
+    identifier: Empty
+    enum
+`[1:]
+
+	if res, err := UnitTestParseWithPPResult("mytest", input, `const MaxSize := 10 * 2
+const Color {
+    RED,
+    GREEN := 5,
+    BLUE
+}
+const Empty {}`); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
+
+	input = `const a 1`
+	if _, err := UnitTestParse("mytest", input); err == nil || err.Error() !=
+		"Parse error in mytest: Unexpected term (1) (Line:1 Pos:9)" {
+		t.Error(err)
+		return
+	}
+}
+
+func TestStatementKeywordNames(t *testing.T) {
+
+	// Statement keywords are only recognised at the start of a statement and
+	// can still be used as names
+
+	input := `
+assert := 1
+yield.x := assert
+const[0] := yield(assert)
+assert(a, const)
+func f(assert, yield, const) {
+	yield [assert]
+	assert (yield), "msg"
+	const c := {"const" : const}
+}
+`
+	expectedOutput := `
+statements
+  :=
+    identifier: assert
+    number: 1
+  :=
+    identifier: yield
+      identifier: x
+    identifier: assert
+  :=
+    identifier: const
+      compaccess
+        number: 0
+    identifier: yield
+      funccall
+        identifier: assert
+  identifier: assert
+    funccall
+      identifier: a
+      identifier: const
+  function
+    identifier: f
+    params
+      identifier: assert
+      identifier: yield
+      identifier: const
+    statements
+      yield
+        list
+          identifier: assert
+      assert
+        identifier: yield
+        string: 'msg'
+      const
+        identifier: c
+        map
+          kvp
+            string: 'const'
+            identifier: const
+`[1:]
+
+	if res, err := UnitTestParse("mytest", input); err != nil || fmt.Sprint(res) != expectedOutput {
+		t.Error("Unexpected parser output:\n", res, "expected was:\n", expectedOutput, "Error:", err)
+		return
+	}
 }
 
 func TestLoopParsing(t *testing.T) {
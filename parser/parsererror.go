@@ -13,6 +13,7 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 /*
@@ -52,6 +53,92 @@ func (pe *Error) Error() string {
 	return ret
 }
 
+/*
+ErrorWithSource returns a human-readable string representation of this error
+followed by an excerpt of the given source code which shows the line of the
+error with a caret under the offending token. The output contains ANSI colors
+if the color flag is set.
+*/
+func (pe *Error) ErrorWithSource(source string, color bool) string {
+	return FormatErrorWithSource(pe.Error(), source, pe.Line, pe.Pos, color)
+}
+
+/*
+ANSI escape sequences for colored error messages
+*/
+const (
+	ansiReset = "\x1b[0m"
+	ansiError = "\x1b[1;31m"
+	ansiDim   = "\x1b[2m"
+)
+
+/*
+FormatErrorWithSource formats an error message with an excerpt of the source
+code at a given line and position (both starting with 1). Only the message is
+returned if the position is not within the source.
+*/
+func FormatErrorWithSource(msg string, source string, line int, pos int, color bool) string {
+	var buf strings.Builder
+
+	if color {
+		buf.WriteString(ansiError + msg + ansiReset)
+	} else {
+		buf.WriteString(msg)
+	}
+
+	if excerpt := SourceExcerpt(source, line, pos, color); excerpt != "" {
+		buf.WriteString("\n")
+		buf.WriteString(excerpt)
+	}
+
+	return buf.String()
+}
+
+/*
+SourceExcerpt returns the line of a given source code with a caret under a
+given position. Line and position start with 1 - the position is a byte offset
+in the line. Returns an empty string if the line is not within the source.
+*/
+func SourceExcerpt(source string, line int, pos int, color bool) string {
+	lines := strings.Split(source, "\n")
+
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	text := strings.TrimRight(lines[line-1], "\r")
+
+	if pos < 1 {
+		pos = 1
+	} else if pos > len(text)+1 {
+		pos = len(text) + 1
+	}
+
+	// Keep tabs in front of the caret so it lines up with the token
+
+	var indent strings.Builder
+
+	for _, r := range text[:pos-1] {
+		if r == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+
+	gutter := fmt.Sprintf("%4d | ", line)
+	emptyGutter := strings.Repeat(" ", len(gutter)-2) + "| "
+	caret := "^"
+
+	if color {
+		gutter = ansiDim + gutter + ansiReset
+		emptyGutter = ansiDim + emptyGutter + ansiReset
+		caret = ansiError + caret + ansiReset
+	}
+
+	return fmt.Sprintf("%v%v\n%v%v%v", gutter, text, emptyGutter, indent.String(), caret)
+}
+
 /*
 Parser related error types
 */
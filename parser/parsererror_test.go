@@ -0,0 +1,55 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package parser
+
+import (
+	"testing"
+)
+
+func TestErrorWithSource(t *testing.T) {
+
+	source := "a := 1\r\n\tb := [\"ü\" + ]\nc := 1"
+
+	_, err := Parse("test", source)
+
+	if res := err.(*Error).ErrorWithSource(source, false); res != `Parse error in test: Term cannot start an expression (]) (Line:2 Pos:15)
+   2 | 	b := ["ü" + ]
+     | 	            ^` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := err.(*Error).ErrorWithSource(source, true); res != "\x1b[1;31mParse error in test: Term cannot start an expression (]) (Line:2 Pos:15)\x1b[0m\n"+
+		"\x1b[2m   2 | \x1b[0m\tb := [\"ü\" + ]\n\x1b[2m     | \x1b[0m\t            \x1b[1;31m^\x1b[0m" {
+		t.Errorf("Unexpected result: %q", res)
+		return
+	}
+
+	// Positions after the end of the line point to the end of the line
+
+	if res := SourceExcerpt("a := (", 1, 10, false); res != `   1 | a := (
+     |       ^` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Positions outside of the source produce no excerpt
+
+	if res := SourceExcerpt("a := 1", 2, 1, false); res != "" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := FormatErrorWithSource("foo", "a := 1", 0, 0, false); res != "foo" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -53,7 +53,15 @@ func init() {
 		// TokenLIST - Special case (handled in code)
 		// TokenMAP - Special case (handled in code)
 		// TokenPARAMS - Special case (handled in code)
-		NodeGUARD + "_1": template.Must(template.New(NodeGUARD).Parse("{{.c1}}")),
+		// TokenENUM - Special case (handled in code)
+		// TokenIMPORTLIST - Special case (handled in code)
+		NodeTYPE + "_1":     template.Must(template.New(NodeTYPE).Parse("{{.c1}}")),
+		NodeTYPE + "_2":     template.Must(template.New(NodeTYPE).Parse("{{.c1}}: {{.c2}}")),
+		NodeGUARD + "_1":    template.Must(template.New(NodeGUARD).Parse("{{.c1}}")),
+		NodeLISTCOMP + "_2": template.Must(template.New(NodeLISTCOMP).Parse("[{{.c2}} for {{.c1}}]")),
+		NodeLISTCOMP + "_3": template.Must(template.New(NodeLISTCOMP).Parse("[{{.c2}} for {{.c1}} if {{.c3}}]")),
+		NodeMAPCOMP + "_2":  template.Must(template.New(NodeMAPCOMP).Parse(`{{"{"}}{{.c2}} for {{.c1}}{{"}"}}`)),
+		NodeMAPCOMP + "_3":  template.Must(template.New(NodeMAPCOMP).Parse(`{{"{"}}{{.c2}} for {{.c1}} if {{.c3}}{{"}"}}`)),
 
 		// Condition operators
 
@@ -66,8 +74,9 @@ func init() {
 
 		// Separators
 
-		NodeKVP + "_2":    template.Must(template.New(NodeKVP).Parse("{{.c1}} : {{.c2}}")),
-		NodePRESET + "_2": template.Must(template.New(NodePRESET).Parse("{{.c1}}={{.c2}}")),
+		NodeKVP + "_2":     template.Must(template.New(NodeKVP).Parse("{{.c1}} : {{.c2}}")),
+		NodePRESET + "_2":  template.Must(template.New(NodePRESET).Parse("{{.c1}}={{.c2}}")),
+		NodeVARARGS + "_1": template.Must(template.New(NodeVARARGS).Parse("*{{.c1}}")),
 
 		// Arithmetic operators
 
@@ -85,10 +94,16 @@ func init() {
 		NodeASSIGN + "_2": template.Must(template.New(NodeASSIGN).Parse("{{.c1}} := {{.c2}}")),
 		NodeLET + "_1":    template.Must(template.New(NodeASSIGN).Parse("let {{.c1}}")),
 
+		// Conditional expressions
+
+		NodeTERNARY + "_3":  template.Must(template.New(NodeTERNARY).Parse("{{.c1}} ? {{.c2}} : {{.c3}}")),
+		NodeCOALESCE + "_2": template.Must(template.New(NodeCOALESCE).Parse("{{.c1}} ?? {{.c2}}")),
+
 		// Import statement
 
 		NodeIMPORT + "_2": template.Must(template.New(NodeIMPORT).Parse("import {{.c1}} as {{.c2}}")),
 		NodeAS + "_1":     template.Must(template.New(NodeRETURN).Parse("as {{.c1}}")),
+		NodeAS + "_2":     template.Must(template.New(NodeAS).Parse("{{.c1}} as {{.c2}}")),
 
 		// Sink definition
 
@@ -98,6 +113,11 @@ func init() {
 		NodeSTATEMATCH + "_1": template.Must(template.New(NodeSTATEMATCH).Parse("statematch {{.c1}}")),
 		NodePRIORITY + "_1":   template.Must(template.New(NodePRIORITY).Parse("priority {{.c1}}")),
 		NodeSUPPRESSES + "_1": template.Must(template.New(NodeSUPPRESSES).Parse("suppresses {{.c1}}")),
+		NodeDEDUP + "_1":      template.Must(template.New(NodeDEDUP).Parse("dedup {{.c1}}")),
+		NodeCOLLECT + "_1":    template.Must(template.New(NodeCOLLECT).Parse("collect {{.c1}}")),
+		NodeTIMEOUT + "_1":    template.Must(template.New(NodeTIMEOUT).Parse("timeout {{.c1}}")),
+		NodeRETRIES + "_1":    template.Must(template.New(NodeRETRIES).Parse("retries {{.c1}}")),
+		NodeBACKOFF + "_1":    template.Must(template.New(NodeBACKOFF).Parse("backoff {{.c1}}")),
 
 		// Function definition
 
@@ -105,6 +125,8 @@ func init() {
 		NodeFUNC + "_3":   template.Must(template.New(NodeFUNC).Parse("func {{.c1}}{{.c2}} {\n{{.c3}}}")),
 		NodeRETURN:        template.Must(template.New(NodeRETURN).Parse("return")),
 		NodeRETURN + "_1": template.Must(template.New(NodeRETURN).Parse("return {{.c1}}")),
+		NodeYIELD:         template.Must(template.New(NodeYIELD).Parse("yield")),
+		NodeYIELD + "_1":  template.Must(template.New(NodeYIELD).Parse("yield {{.c1}}")),
 
 		// Boolean operators
 
@@ -148,13 +170,25 @@ func init() {
 		// Mutex block
 
 		NodeMUTEX + "_2": template.Must(template.New(NodeLOOP).Parse("mutex {{.c1}} {\n{{.c2}}}\n")),
+		NodeMUTEX + "_3": template.Must(template.New(NodeLOOP).Parse("mutex {{.c1}} {{.c2}} {\n{{.c3}}}\n")),
+
+		// Assert statement
+
+		NodeASSERT + "_1": template.Must(template.New(NodeASSERT).Parse("assert {{.c1}}")),
+		NodeASSERT + "_2": template.Must(template.New(NodeASSERT).Parse("assert {{.c1}}, {{.c2}}")),
+
+		// Constant declaration
+
+		// TokenCONST - Special case (handled in code)
 	}
 
 	bracketPrecedenceMap = map[string]bool{
-		NodePLUS:  true,
-		NodeMINUS: true,
-		NodeAND:   true,
-		NodeOR:    true,
+		NodePLUS:     true,
+		NodeMINUS:    true,
+		NodeAND:      true,
+		NodeOR:       true,
+		NodeTERNARY:  true,
+		NodeCOALESCE: true,
 	}
 }
 
@@ -252,11 +286,17 @@ func ppPostProcessing(ast *ASTNode, path []*ASTNode, ppString string) string {
 			NodeSTATEMENTS,
 			NodeMAP,
 			NodeLIST,
+			NodeENUM,
 			NodeKINDMATCH,
 			NodeSTATEMATCH,
 			NodeSCOPEMATCH,
 			NodePRIORITY,
 			NodeSUPPRESSES,
+			NodeDEDUP,
+			NodeCOLLECT,
+			NodeTIMEOUT,
+			NodeRETRIES,
+			NodeBACKOFF,
 		}) != -1 {
 			parent := path[len(path)-2]
 
@@ -267,10 +307,15 @@ func ppPostProcessing(ast *ASTNode, path []*ASTNode, ppString string) string {
 
 			if stringutil.IndexOf(parent.Name, []string{
 				NodeRETURN,
+				NodeYIELD,
+				NodeASSERT,
+				NodeCONST,
 				NodeIN,
 				NodeASSIGN,
 				NodePRESET,
 				NodeKVP,
+				NodeTERNARY,
+				NodeCOALESCE,
 				NodeLIST,
 				NodeFUNCCALL,
 				NodeKINDMATCH,
@@ -278,6 +323,11 @@ func ppPostProcessing(ast *ASTNode, path []*ASTNode, ppString string) string {
 				NodeSCOPEMATCH,
 				NodePRIORITY,
 				NodeSUPPRESSES,
+				NodeDEDUP,
+				NodeCOLLECT,
+				NodeTIMEOUT,
+				NodeRETRIES,
+				NodeBACKOFF,
 			}) == -1 {
 				ret = fmt.Sprintf("%v%v", indentSpaces, ret)
 			}
@@ -401,6 +451,39 @@ func ppSpecialDefs(ast *ASTNode, path []*ASTNode, tempParam map[string]string, b
 		buf.WriteString(tempParam[fmt.Sprint("c", len(ast.Children))])
 		buf.WriteString("}\n")
 
+		return ppPostProcessing(ast, path, buf.String()), true
+
+	} else if ast.Name == NodeFUNC && numChildren > 2 && ast.Children[numChildren-2].Name == NodeTYPE {
+
+		// Function with return type
+
+		buf.WriteString("func ")
+
+		for i := 1; i < numChildren-1; i++ {
+			buf.WriteString(tempParam[fmt.Sprint("c", i)])
+		}
+
+		buf.WriteString(": ")
+		buf.WriteString(tempParam[fmt.Sprint("c", numChildren-1)])
+		buf.WriteString(" {\n")
+		buf.WriteString(tempParam[fmt.Sprint("c", numChildren)])
+		buf.WriteString("}")
+
+		return ppPostProcessing(ast, path, buf.String()), true
+
+	} else if ast.Name == NodeCONST {
+
+		buf.WriteString("const ")
+		buf.WriteString(tempParam["c1"])
+
+		if ast.Children[1].Name == NodeENUM {
+			buf.WriteString(" ")
+		} else {
+			buf.WriteString(" := ")
+		}
+
+		buf.WriteString(tempParam["c2"])
+
 		return ppPostProcessing(ast, path, buf.String()), true
 	}
 
@@ -441,7 +524,7 @@ func ppContainerBlocks(ast *ASTNode, path []*ASTNode, tempParam map[string]strin
 
 		return ppPostProcessing(ast, path, buf.String()), true
 
-	} else if ast.Name == NodeMAP {
+	} else if ast.Name == NodeMAP || ast.Name == NodeENUM {
 		multilineThreshold := 2
 		buf.WriteString("{")
 
@@ -554,7 +637,16 @@ func ppSpecialStatements(ast *ASTNode, path []*ASTNode, tempParam map[string]str
 
 		return ppPostProcessing(ast, path, buf.String()), true
 
-	} else if ast.Name == NodePARAMS {
+	} else if ast.Name == NodeIMPORT && ast.Children[1].Name == NodeIMPORTLIST {
+
+		buf.WriteString("import ")
+		buf.WriteString(tempParam["c1"])
+		buf.WriteString(" ")
+		buf.WriteString(tempParam["c2"])
+
+		return ppPostProcessing(ast, path, buf.String()), true
+
+	} else if ast.Name == NodePARAMS || ast.Name == NodeIMPORTLIST {
 
 		buf.WriteString("(")
 		i := 1
@@ -315,6 +315,31 @@ func TestSpecialCasePrinting1(t *testing.T) {
 		return
 	}
 
+	input = `func mygen() { yield
+yield {"a":1,"b":1,"c":1,"d":1} }`
+
+	if err := UnitTestPrettyPrinting(input, "",
+		`func mygen() {
+    yield
+    yield {
+        "a" : 1,
+        "b" : 1,
+        "c" : 1,
+        "d" : 1
+    }
+}`); err != nil {
+		t.Error(err)
+		return
+	}
+
+	input = `x := [a*2 for a in l];y:={k:v*2 for [k,v] in m if v>1}`
+
+	if err := UnitTestPrettyPrinting(input, "",
+		`x := [a * 2 for a in l]
+y := {k : v * 2 for [k, v] in m if v > 1}`); err != nil {
+		t.Error(err)
+		return
+	}
 }
 
 func TestSpecialCasePrinting2(t *testing.T) {
@@ -326,6 +351,11 @@ sink RegisterNewPlayer
   statematch {"a":1,"b":1,"c":1,"d":1}
 scopematch []
 suppresses ["abs"]
+dedup {"window":10}
+collect   5
+timeout  1.5s
+retries 2
+backoff   1s
 priority 0
 {
 log("1223")
@@ -357,6 +387,11 @@ sink RegisterNewPlayer
     }
     scopematch []
     suppresses ["abs"]
+    dedup {"window" : 10}
+    collect 5
+    timeout 1.5s
+    retries 2
+    backoff 1s
     priority 0
 {
     log("1223")
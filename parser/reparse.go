@@ -0,0 +1,276 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+TextEdit describes a change of a source text. The text between the byte
+offsets Start and End (exclusive) is replaced by Text.
+*/
+type TextEdit struct {
+	Start int    // Start offset of the replaced text
+	End   int    // End offset of the replaced text (exclusive)
+	Text  string // New text
+}
+
+/*
+Apply applies this edit to a given source text.
+*/
+func (e TextEdit) Apply(source string) (string, error) {
+	if e.Start < 0 || e.Start > e.End || e.End > len(source) {
+		return "", fmt.Errorf("Invalid edit range %v-%v for source of length %v", e.Start, e.End, len(source))
+	}
+
+	return source[:e.Start] + e.Text + source[e.End:], nil
+}
+
+/*
+Reparse applies an edit to a source text and returns the AST and the text of
+the changed source. Only the top-level statements which are affected by the
+edit are parsed again - all other statements of the given AST are reused (the
+given AST must be the AST of the given source and is modified). The result
+is the same as parsing the changed source as a whole.
+*/
+func Reparse(name string, ast *ASTNode, source string, edit TextEdit) (*ASTNode, string, error) {
+	return ReparseWithRuntime(name, ast, source, edit, nil)
+}
+
+/*
+ReparseWithRuntime applies an edit to a source text and returns the AST
+decorated with runtime components and the text of the changed source. Only
+the top-level statements which are affected by the edit are parsed again.
+*/
+func ReparseWithRuntime(name string, ast *ASTNode, source string, edit TextEdit, rp RuntimeProvider) (*ASTNode, string, error) {
+	newSource, err := edit.Apply(source)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if ast == nil {
+		ast, err = ParseWithRuntime(name, newSource, rp)
+		return ast, newSource, err
+	}
+
+	res := reparseStatements(name, ast, source, newSource, edit, rp)
+
+	if res == nil {
+
+		// The edit could not be applied to a part of the AST - parse the
+		// whole source again
+
+		res, err = ParseWithRuntime(name, newSource, rp)
+	}
+
+	return res, newSource, err
+}
+
+/*
+reparseStatements parses only the top-level statements which are affected by
+an edit. Returns nil if the whole source needs to be parsed again.
+*/
+func reparseStatements(name string, ast *ASTNode, source string, newSource string,
+	edit TextEdit, rp RuntimeProvider) *ASTNode {
+
+	statements := ast.Children
+
+	if ast.Name != NodeSTATEMENTS {
+
+		// Code with a single statement has no statements node
+
+		statements = []*ASTNode{ast}
+	}
+
+	// Determine where each statement starts (including its pre comments)
+
+	firstTokens := make([]*LexToken, len(statements))
+	starts := make([]int, len(statements))
+
+	for i, s := range statements {
+		if firstTokens[i] = firstLexToken(s); firstTokens[i] == nil {
+			return nil
+		}
+		starts[i] = firstTokens[i].Pos
+
+		if i == 0 {
+			starts[i] = 0
+		} else if firstTokens[i].ID == TokenPRECOMMENT {
+			starts[i] -= 2 // Include the opening /*
+		}
+	}
+
+	// Find the statements which contain the start and the end of the edit and
+	// include one additional statement on each side
+
+	from, to := 0, 0
+
+	for i, start := range starts {
+		if start <= edit.Start {
+			from = i
+		}
+		if start <= edit.End {
+			to = i
+		}
+	}
+
+	last := to
+
+	if from > 0 {
+		from--
+	}
+	if to < len(statements)-1 {
+		to++
+	}
+
+	delta := len(edit.Text) - (edit.End - edit.Start)
+
+	chunkStart := starts[from]
+	chunkEnd := len(newSource)
+
+	if to < len(statements)-1 {
+		chunkEnd = starts[to+1] + delta
+	}
+
+	chunkAST, err := ParseWithRuntime(name, newSource[chunkStart:chunkEnd], rp)
+
+	if err != nil {
+		return nil
+	}
+
+	chunkStatements := chunkAST.Children
+
+	if chunkAST.Name != NodeSTATEMENTS {
+		chunkStatements = []*ASTNode{chunkAST}
+	}
+
+	// Move the parsed statements to their position in the source
+
+	lineOffset := firstTokens[from].Lline - 1
+	posOffset := column(newSource, chunkStart) - 1
+
+	if from == 0 {
+		lineOffset = 0
+	}
+
+	for _, s := range chunkStatements {
+		walkLexTokens(s, func(t *LexToken) {
+			if t.Lline == 1 {
+				t.Lpos += posOffset
+			}
+			t.Pos += chunkStart
+			t.Lline += lineOffset
+		})
+	}
+
+	// Newlines before the first token of the chunk were not seen when parsing
+	// the chunk (the text before the chunk was not changed)
+
+	if from > 0 {
+		firstLexToken(chunkStatements[0]).PrefixNewlines = firstTokens[from].PrefixNewlines
+	}
+
+	// The last parsed statement must be the unchanged statement after the edit
+	// otherwise the edit changed how the following statements are separated
+
+	if to > last {
+		if t := firstLexToken(chunkStatements[len(chunkStatements)-1]); t.Pos != firstTokens[to].Pos+delta {
+			return nil
+		}
+	}
+
+	// Move the statements after the edit
+
+	if to < len(statements)-1 {
+		endLine := strings.Count(source[:edit.End], "\n") + 1
+		lineDelta := strings.Count(edit.Text, "\n") - strings.Count(source[edit.Start:edit.End], "\n")
+		colDelta := column(newSource, edit.Start+len(edit.Text)) - column(source, edit.End)
+
+		for _, s := range statements[to+1:] {
+			walkLexTokens(s, func(t *LexToken) {
+				if t.Lline == endLine {
+					t.Lpos += colDelta
+				}
+				t.Pos += delta
+				t.Lline += lineDelta
+			})
+		}
+	}
+
+	// Splice the parsed statements into the list of statements
+
+	newStatements := make([]*ASTNode, 0, len(statements)-(to-from+1)+len(chunkStatements))
+	newStatements = append(newStatements, statements[:from]...)
+	newStatements = append(newStatements, chunkStatements...)
+	newStatements = append(newStatements, statements[to+1:]...)
+
+	if len(newStatements) == 1 {
+		return newStatements[0]
+	}
+
+	if ast.Name != NodeSTATEMENTS {
+		ast = astNodeMap[TokenSTATEMENTS].instance(&parser{name, nil, nil, rp, false, false}, nil)
+	}
+
+	ast.Children = newStatements
+
+	return ast
+}
+
+/*
+firstLexToken returns the first lexer token of an AST (this is the first pre
+comment if the AST has pre comments).
+*/
+func firstLexToken(ast *ASTNode) *LexToken {
+	var first *LexToken
+
+	walkLexTokens(ast, func(t *LexToken) {
+
+		// Post comments belong to a previous token
+
+		if t.ID != TokenPOSTCOMMENT && (first == nil || t.Pos < first.Pos) {
+			first = t
+		}
+	})
+
+	return first
+}
+
+/*
+walkLexTokens calls a given function for all lexer tokens of an AST including
+the tokens of comments.
+*/
+func walkLexTokens(ast *ASTNode, f func(*LexToken)) {
+	if ast.Token != nil {
+		f(ast.Token)
+	}
+
+	for _, m := range ast.Meta {
+		if t, ok := m.(*LexToken); ok {
+			f(t)
+		}
+	}
+
+	for _, c := range ast.Children {
+		walkLexTokens(c, f)
+	}
+}
+
+/*
+column returns the column (starting with 1) of a given position in a source
+text.
+*/
+func column(source string, pos int) int {
+	return pos - strings.LastIndex(source[:pos], "\n")
+}
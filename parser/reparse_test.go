@@ -0,0 +1,198 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+const reparseTestSource = `/*
+ Test program
+*/
+import "foo" as bar
+
+a := 1 # The a
+b := [1, 2, {"x" : "y"}]; c := a + 1
+
+/* Add two numbers */
+func add(x, y=2) {
+  return x + y
+}
+
+# Post comment
+
+sink mysink
+  kindmatch [ "foo.*" ],
+  {
+    log("event", event)
+  }
+
+if a == 1 {
+  b := add(a, 3)
+} elif a > 2 { c := "multi"
+} else {
+  /* inner */
+  d := r'raw'
+}
+e := b[1]
+`
+
+/*
+dumpTokens returns a string representation of an AST including the positions
+of all tokens.
+*/
+func dumpTokens(ast *ASTNode) string {
+	var buf bytes.Buffer
+
+	buf.WriteString(ast.String())
+
+	walkLexTokens(ast, func(t *LexToken) {
+		buf.WriteString(fmt.Sprintf("%v:%q@%v(%v:%v)+%v ", t.ID, t.Val, t.Pos, t.Lline, t.Lpos, t.PrefixNewlines))
+	})
+
+	return buf.String()
+}
+
+func TestReparse(t *testing.T) {
+
+	ast, err := Parse("test", reparseTestSource)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Change a single statement
+
+	source := reparseTestSource
+	oldSink := ast.Children[6]
+
+	ast, source, err = Reparse("test", ast, source, TextEdit{62, 63, "42"})
+
+	if err != nil || source[48:68] != "# The a\nb := [42, 2," {
+		t.Error("Unexpected result:", err, source[48:68])
+		return
+	}
+
+	if res := dumpTokens(ast); res != dumpTokens(parseOrFail(t, source)) {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Statements which were not affected are reused
+
+	if ast.Children[6] != oldSink {
+		t.Error("Statement was not reused")
+		return
+	}
+
+	// Invalid edits
+
+	if _, _, err = Reparse("test", ast, source, TextEdit{5, 4, ""}); err == nil ||
+		err.Error() != fmt.Sprintf("Invalid edit range 5-4 for source of length %v", len(source)) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, _, err = Reparse("test", ast, source, TextEdit{5, 4000, ""}); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Parse errors are reported like errors of a full parse
+
+	_, _, err = Reparse("test", ast, source, TextEdit{62, 62, ")"})
+
+	if _, ferr := Parse("test", source[:62]+")"+source[62:]); err == nil || err.Error() != ferr.Error() {
+		t.Error("Unexpected result:", err, ferr)
+		return
+	}
+
+	// Without an AST the whole source is parsed
+
+	if ast, source, err = Reparse("test", nil, "a := 1", TextEdit{5, 6, "2"}); err != nil ||
+		source != "a := 2" || ast.String() != parseOrFail(t, "a := 2").String() {
+		t.Error("Unexpected result:", ast, source, err)
+		return
+	}
+
+	// Single statements become a list of statements and vice versa
+
+	if ast, source, err = Reparse("test", ast, source, TextEdit{6, 6, "\nb := 3"}); err != nil ||
+		dumpTokens(ast) != dumpTokens(parseOrFail(t, source)) {
+		t.Error("Unexpected result:", ast, source, err)
+		return
+	}
+
+	if ast, source, err = Reparse("test", ast, source, TextEdit{0, 7, ""}); err != nil ||
+		dumpTokens(ast) != dumpTokens(parseOrFail(t, source)) {
+		t.Error("Unexpected result:", ast, source, err)
+		return
+	}
+}
+
+func TestReparseRandomEdits(t *testing.T) {
+	snippets := []string{"", " ", "\n", "1", "a", "+", "x := 5", "\n\nlog(1)\n", "}", "{", "/* c */",
+		"# c\n", ";", "\"", "func f() {}\n", "ü"}
+
+	r := rand.New(rand.NewSource(1))
+
+	source := reparseTestSource
+	ast := parseOrFail(t, source)
+
+	for i := 0; i < 2000; i++ {
+		start := r.Intn(len(source) + 1)
+		end := start + r.Intn(10)
+		if end > len(source) {
+			end = len(source)
+		}
+		edit := TextEdit{start, end, snippets[r.Intn(len(snippets))]}
+
+		newAST, newSource, err := Reparse("test", ast, source, edit)
+		expectedAST, expectedErr := Parse("test", newSource)
+
+		if fmt.Sprint(err) != fmt.Sprint(expectedErr) {
+			t.Error("Unexpected result:", edit, err, expectedErr)
+			return
+		}
+
+		if err == nil {
+			if res, expected := dumpTokens(newAST), dumpTokens(expectedAST); res != expected {
+				i := 0
+				for i < len(res) && i < len(expected) && res[i] == expected[i] {
+					i++
+				}
+				t.Errorf("Unexpected result for edit %v of:\n%v\nResult:\n%v\nExpected:\n%v", edit, source, res[i:], expected[i:])
+				return
+			}
+
+			ast, source = newAST, newSource
+
+		} else if r.Intn(2) == 0 {
+
+			// Start again from a valid source
+
+			source = reparseTestSource
+			ast = parseOrFail(t, source)
+		}
+	}
+}
+
+func parseOrFail(t *testing.T, source string) *ASTNode {
+	ast, err := Parse("test", source)
+	if err != nil {
+		t.Fatal("Unexpected result:", err)
+	}
+	return ast
+}
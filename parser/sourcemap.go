@@ -0,0 +1,136 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package parser
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+SourceMapEntry maps the position of a token in pretty printed code to its
+position in the original code.
+*/
+type SourceMapEntry struct {
+	Line     int `json:"line"`     // Line in the pretty printed code
+	Pos      int `json:"pos"`      // Position in the line of the pretty printed code
+	OrigLine int `json:"origLine"` // Line in the original code
+	OrigPos  int `json:"origPos"`  // Position in the line of the original code
+}
+
+/*
+SourceMap links pretty printed code to the original code. Entries are ordered
+by their position in the pretty printed code.
+*/
+type SourceMap struct {
+	Source  string            `json:"source"`  // Name of the original source
+	Entries []*SourceMapEntry `json:"entries"` // Mapping entries for all tokens
+}
+
+/*
+OriginalLine returns the line in the original code of the first token on a
+given line of the pretty printed code.
+*/
+func (sm *SourceMap) OriginalLine(line int) (int, bool) {
+	i := sort.Search(len(sm.Entries), func(i int) bool {
+		return sm.Entries[i].Line >= line
+	})
+
+	if i < len(sm.Entries) && sm.Entries[i].Line == line {
+		return sm.Entries[i].OrigLine, true
+	}
+
+	return 0, false
+}
+
+/*
+FormattedLine returns the line in the pretty printed code of the first token
+on a given line of the original code.
+*/
+func (sm *SourceMap) FormattedLine(origLine int) (int, bool) {
+	var res *SourceMapEntry
+
+	for _, e := range sm.Entries {
+		if e.OrigLine == origLine && (res == nil || e.OrigPos < res.OrigPos) {
+			res = e
+		}
+	}
+
+	if res == nil {
+		return 0, false
+	}
+
+	return res.Line, true
+}
+
+/*
+PrettyPrintWithSourceMap produces pretty printed code from a given AST
+together with a source map which links the pretty printed code to the
+original positions of the tokens in the AST.
+*/
+func PrettyPrintWithSourceMap(ast *ASTNode) (string, *SourceMap, error) {
+	var sm *SourceMap
+
+	res, err := PrettyPrint(ast)
+
+	if err == nil {
+		var ppAST *ASTNode
+
+		source := ""
+		if ast.Token != nil {
+			source = ast.Token.Lsource
+		}
+
+		// Parse the pretty printed code and match it against the given AST
+
+		if ppAST, err = Parse(source, res); err == nil {
+			sm = &SourceMap{source, nil}
+
+			if err = buildSourceMap(sm, ast, ppAST); err == nil {
+				sort.SliceStable(sm.Entries, func(i, j int) bool {
+					if sm.Entries[i].Line == sm.Entries[j].Line {
+						return sm.Entries[i].Pos < sm.Entries[j].Pos
+					}
+					return sm.Entries[i].Line < sm.Entries[j].Line
+				})
+			}
+		}
+	}
+
+	return res, sm, err
+}
+
+/*
+buildSourceMap adds entries to a source map for a node of the original AST and
+its corresponding node in the AST of the pretty printed code.
+*/
+func buildSourceMap(sm *SourceMap, orig *ASTNode, pp *ASTNode) error {
+	if orig.Name != pp.Name || len(orig.Children) != len(pp.Children) {
+		return fmt.Errorf("Pretty printed code has a different structure (%v vs %v)", orig.Name, pp.Name)
+	}
+
+	if sm.Source == "" && orig.Token != nil {
+		sm.Source = orig.Token.Lsource
+	}
+
+	if orig.Token != nil && pp.Token != nil {
+		sm.Entries = append(sm.Entries, &SourceMapEntry{
+			pp.Token.Lline, pp.Token.Lpos, orig.Token.Lline, orig.Token.Lpos})
+	}
+
+	for i, child := range orig.Children {
+		if err := buildSourceMap(sm, child, pp.Children[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	ast, err := Parse("mysource", `
+a:=1;b:=[1,2,3,4,5]
+func foo(x) { return x+1 }
+
+
+
+log(foo(a))
+`)
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	res, sm, err := PrettyPrintWithSourceMap(ast)
+
+	if err != nil || res != `a := 1
+b := [
+    1,
+    2,
+    3,
+    4,
+    5
+]
+func foo(x) {
+    return x + 1
+}
+
+log(foo(a))` {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	var lines []string
+
+	for i := 1; i <= 14; i++ {
+		origLine, ok := sm.OriginalLine(i)
+		lines = append(lines, fmt.Sprintf("%v:%v:%v", i, origLine, ok))
+	}
+
+	if res := fmt.Sprint(lines); res != "[1:2:true 2:2:true 3:2:true 4:2:true 5:2:true "+
+		"6:2:true 7:2:true 8:0:false 9:3:true 10:3:true 11:0:false 12:0:false 13:7:true 14:0:false]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	lines = nil
+
+	for i := 1; i <= 8; i++ {
+		line, ok := sm.FormattedLine(i)
+		lines = append(lines, fmt.Sprintf("%v:%v:%v", i, line, ok))
+	}
+
+	if res := fmt.Sprint(lines); res != "[1:0:false 2:1:true 3:9:true 4:0:false 5:0:false 6:0:false 7:13:true 8:0:false]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	jsonBytes, _ := json.Marshal(sm.Entries[0:2])
+
+	if res := fmt.Sprint(sm.Source, " ", string(jsonBytes)); res !=
+		`mysource [{"line":1,"pos":1,"origLine":2,"origPos":1},{"line":1,"pos":3,"origLine":2,"origPos":2}]` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Test error cases
+
+	if _, _, err := PrettyPrintWithSourceMap(nil); err == nil || err.Error() != "Nil pointer in AST" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	ast2, _ := Parse("mysource", "a := 1")
+
+	if err := buildSourceMap(&SourceMap{}, ast, ast2); err == nil ||
+		err.Error() != "Pretty printed code has a different structure (statements vs :=)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -15,6 +15,8 @@ package scope
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/krotik/common/stringutil"
 	"github.com/krotik/ecal/parser"
@@ -28,6 +30,24 @@ const (
 	FuncPrefix  = "func:"
 )
 
+/*
+function has the same methods as util.ECALFunction. The util package cannot be
+imported here since its tests depend on this package.
+*/
+type function interface {
+	Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error)
+	DocString() (string, error)
+}
+
+/*
+object has the same methods as util.ECALObject.
+*/
+type object interface {
+	GetField(name string) (interface{}, bool, error)
+	SetField(name string, value interface{}) error
+	FieldNames() []string
+}
+
 /*
 NameFromASTNode returns a scope name from a given ASTNode.
 */
@@ -64,6 +84,61 @@ func ToScope(name string, o map[interface{}]interface{}) parser.Scope {
 	return vs
 }
 
+/*
+CopyScope returns a copy of a given scope and all its parent scopes. Lists and
+maps are copied deeply so changes to the copy do not affect the original
+scope. Functions and all other values are not copied.
+*/
+func CopyScope(vs parser.Scope) parser.Scope {
+	var parent parser.Scope
+
+	if vs.Parent() != nil {
+		parent = CopyScope(vs.Parent())
+	}
+
+	res := NewScopeWithParent(vs.Name(), parent).(*varsScope)
+
+	if s, ok := vs.(*varsScope); ok {
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+
+		for k, v := range s.storage {
+			res.storage[k] = copyValue(v)
+		}
+	}
+
+	return res
+}
+
+/*
+copyValue returns a deep copy of lists and maps. All other values are returned
+as they are.
+*/
+func copyValue(v interface{}) interface{} {
+	switch val := v.(type) {
+
+	case []interface{}:
+		res := make([]interface{}, len(val))
+
+		for i, lv := range val {
+			res[i] = copyValue(lv)
+		}
+
+		return res
+
+	case map[interface{}]interface{}:
+		res := make(map[interface{}]interface{}, len(val))
+
+		for mk, mv := range val {
+			res[mk] = copyValue(mv)
+		}
+
+		return res
+	}
+
+	return v
+}
+
 /*
 ConvertJSONToECALObject converts a JSON container structure into an object which
 can be used by ECAL.
@@ -138,3 +213,254 @@ func ConvertECALToJSONObject(v interface{}) interface{} {
 
 	return res
 }
+
+/*
+ConvertGoToECALObject converts a Go value into an object which can be used by
+ECAL. Numbers are converted to float64, slices and arrays into lists, maps into
+maps and structs into maps of their exported fields (a json tag can be used to
+change the name of a field or to exclude it). Pointers are dereferenced. ECAL
+functions, ECAL objects and values which cannot be converted are returned as
+they are.
+*/
+func ConvertGoToECALObject(v interface{}) interface{} {
+
+	if v == nil {
+		return nil
+	}
+
+	if _, ok := v.(function); ok {
+		return v
+	} else if _, ok := v.(object); ok {
+		return v
+	}
+
+	return convertGoValue(reflect.ValueOf(v))
+}
+
+/*
+convertGoValue converts a reflected Go value into an ECAL object.
+*/
+func convertGoValue(rv reflect.Value) interface{} {
+
+	switch rv.Kind() {
+
+	case reflect.Invalid:
+		return nil
+
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		if f, ok := rv.Interface().(function); ok {
+			return f
+		}
+		return convertGoValue(rv.Elem())
+
+	case reflect.Bool:
+		return rv.Bool()
+
+	case reflect.String:
+		return rv.String()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint())
+
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+
+		res := make([]interface{}, rv.Len())
+
+		for i := 0; i < rv.Len(); i++ {
+			res[i] = convertGoValue(rv.Index(i))
+		}
+
+		return res
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+
+		res := make(map[interface{}]interface{})
+
+		for _, k := range rv.MapKeys() {
+			res[convertGoValue(k)] = convertGoValue(rv.MapIndex(k))
+		}
+
+		return res
+
+	case reflect.Struct:
+		res := make(map[interface{}]interface{})
+		rt := rv.Type()
+
+		for i := 0; i < rt.NumField(); i++ {
+			if name, ok := StructFieldName(rt.Field(i)); ok {
+				res[name] = convertGoValue(rv.Field(i))
+			}
+		}
+
+		return res
+	}
+
+	return rv.Interface()
+}
+
+/*
+StructFieldName returns the ECAL name of a struct field (the field name or the
+name given in its json tag) and if the field should be included at all.
+*/
+func StructFieldName(field reflect.StructField) (string, bool) {
+
+	if field.PkgPath != "" {
+		return "", false // Unexported field
+	}
+
+	name := field.Name
+
+	if tag := field.Tag.Get("json"); tag != "" {
+		tagName := strings.Split(tag, ",")[0]
+
+		if tagName == "-" {
+			return "", false
+		} else if tagName != "" {
+			name = tagName
+		}
+	}
+
+	return name, true
+}
+
+/*
+ConvertECALToGoObject converts an ECAL object into a given Go value. The target
+must be a pointer. Numbers are converted into the number type of the target,
+lists into slices or arrays and maps into maps or structs (using the same
+field names as ConvertGoToECALObject).
+*/
+func ConvertECALToGoObject(v interface{}, target interface{}) error {
+	rv := reflect.ValueOf(target)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Target must be a non-nil pointer")
+	}
+
+	return convertECALValue(v, rv.Elem(), "value")
+}
+
+/*
+convertECALValue converts an ECAL object into a reflected Go value.
+*/
+func convertECALValue(v interface{}, target reflect.Value, path string) error {
+	var err error
+
+	if v == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	val := reflect.ValueOf(v)
+
+	if target.Kind() == reflect.Interface && val.Type().Implements(target.Type()) {
+		target.Set(val)
+		return nil
+	}
+
+	switch target.Kind() {
+
+	case reflect.Ptr:
+		ptr := reflect.New(target.Type().Elem())
+
+		if err = convertECALValue(v, ptr.Elem(), path); err == nil {
+			target.Set(ptr)
+		}
+
+		return err
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+
+		if num, ok := v.(float64); ok {
+			target.Set(reflect.ValueOf(num).Convert(target.Type()))
+			return nil
+		}
+
+	case reflect.Slice, reflect.Array:
+
+		if list, ok := v.([]interface{}); ok {
+			if target.Kind() == reflect.Slice {
+				target.Set(reflect.MakeSlice(target.Type(), len(list), len(list)))
+			} else if target.Len() != len(list) {
+				return fmt.Errorf("Cannot convert list of size %v into array of size %v (%v)",
+					len(list), target.Len(), path)
+			}
+
+			for i, lv := range list {
+				if err = convertECALValue(lv, target.Index(i), fmt.Sprintf("%v.%v", path, i)); err != nil {
+					break
+				}
+			}
+
+			return err
+		}
+
+	case reflect.Map:
+
+		if m, ok := v.(map[interface{}]interface{}); ok {
+			res := reflect.MakeMapWithSize(target.Type(), len(m))
+
+			for mk, mv := range m {
+				k := reflect.New(target.Type().Key()).Elem()
+				e := reflect.New(target.Type().Elem()).Elem()
+
+				if err = convertECALValue(mk, k, path); err == nil {
+					err = convertECALValue(mv, e, fmt.Sprintf("%v.%v", path, mk))
+				}
+
+				if err != nil {
+					return err
+				}
+
+				res.SetMapIndex(k, e)
+			}
+
+			target.Set(res)
+
+			return nil
+		}
+
+	case reflect.Struct:
+
+		if m, ok := v.(map[interface{}]interface{}); ok {
+			rt := target.Type()
+
+			for i := 0; i < rt.NumField(); i++ {
+				if name, ok := StructFieldName(rt.Field(i)); ok {
+					if mv, ok := m[name]; ok {
+						if err = convertECALValue(mv, target.Field(i), fmt.Sprintf("%v.%v", path, name)); err != nil {
+							return err
+						}
+					}
+				}
+			}
+
+			return nil
+		}
+
+	default:
+
+		if val.Type().ConvertibleTo(target.Type()) {
+			target.Set(val.Convert(target.Type()))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Cannot convert %v (type %T) into %v (%v)", v, v, target.Type(), path)
+}
@@ -41,6 +41,52 @@ func TestScopeConversion(t *testing.T) {
 	}
 }
 
+func TestCopyScope(t *testing.T) {
+	vs := NewScope(GlobalScope)
+	vs.SetValue("a", 1)
+	vs.SetValue("b", map[interface{}]interface{}{"x": []interface{}{1, 2}})
+
+	cvs := vs.NewChild("child")
+	cvs.SetValue("c", []interface{}{map[interface{}]interface{}{"y": 3}})
+
+	cvs2 := CopyScope(cvs)
+
+	if cvs.String() != cvs2.String() {
+		t.Error("Unexpected result:", cvs.String(), cvs2.String())
+		return
+	}
+
+	// Changes to the copy should not affect the original
+
+	cvs2.SetValue("a", 2)
+	cvs2.SetValue("d", 4)
+
+	b, _, _ := cvs2.GetValue("b")
+	b.(map[interface{}]interface{})["x"].([]interface{})[0] = 5
+
+	c, _, _ := cvs2.GetValue("c")
+	c.([]interface{})[0].(map[interface{}]interface{})["y"] = 6
+
+	if res := cvs.String(); res != `GlobalScope {
+    a (int) : 1
+    b (map[interface {}]interface {}) : {"x":[1,2]}
+    child {
+        c ([]interface {}) : [{"y":3}]
+    }
+}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := cvs2.Parent().String(); res != `GlobalScope {
+    a (int) : 2
+    b (map[interface {}]interface {}) : {"x":[5,2]}
+}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
 func TestConvertJSONToECALObject(t *testing.T) {
 
 	testJSONStructure := map[string]interface{}{
@@ -85,3 +131,116 @@ func TestConvertJSONToECALObject(t *testing.T) {
 		return
 	}
 }
+
+type testStruct struct {
+	Name     string
+	Count    int              `json:"count"`
+	Tags     []string         `json:"tags,omitempty"`
+	Ignored  string           `json:"-"`
+	Props    map[string]uint8 `json:"props"`
+	Child    *testStruct      `json:"child"`
+	Scores   [2]float32       `json:"scores"`
+	Any      interface{}      `json:"any"`
+	internal string
+}
+
+func TestConvertGoToECALObject(t *testing.T) {
+	f := &testFunc{"f"}
+
+	res := ConvertGoToECALObject(&testStruct{
+		Name:     "foo",
+		Count:    5,
+		Tags:     []string{"a", "b"},
+		Ignored:  "x",
+		Props:    map[string]uint8{"p": 1},
+		Child:    &testStruct{Name: "bar"},
+		Scores:   [2]float32{0.5, 1},
+		Any:      f,
+		internal: "y",
+	})
+
+	m := res.(map[interface{}]interface{})
+
+	if m["any"] != f {
+		t.Error("Function should be kept:", m["any"])
+		return
+	}
+
+	delete(m, "any")
+
+	if typeString := fmt.Sprintf("%#v", m); typeString != `map[interface {}]interface {}{`+
+		`"Name":"foo", "child":map[interface {}]interface {}{"Name":"bar", "any":interface {}(nil), `+
+		`"child":interface {}(nil), "count":0, "props":interface {}(nil), "scores":[]interface {}{0, 0}, `+
+		`"tags":interface {}(nil)}, "count":5, "props":map[interface {}]interface {}{"p":1}, `+
+		`"scores":[]interface {}{0.5, 1}, "tags":[]interface {}{"a", "b"}}` {
+		t.Error("Unexpected result:", typeString)
+		return
+	}
+
+	if res := ConvertGoToECALObject(nil); res != nil {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := ConvertGoToECALObject(map[int]bool{1: true}); fmt.Sprintf("%#v", res) != `map[interface {}]interface {}{1:true}` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	c := make(chan int)
+
+	if res := ConvertGoToECALObject(c); res != c {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
+
+func TestConvertECALToGoObject(t *testing.T) {
+	var res testStruct
+
+	err := ConvertECALToGoObject(map[interface{}]interface{}{
+		"Name":    "foo",
+		"count":   5.,
+		"tags":    []interface{}{"a", "b"},
+		"props":   map[interface{}]interface{}{"p": 1.},
+		"child":   map[interface{}]interface{}{"Name": "bar"},
+		"scores":  []interface{}{0.5, 1.},
+		"any":     []interface{}{1.},
+		"Ignored": "x",
+	}, &res)
+
+	if err != nil || fmt.Sprintf("%v %v %v %v %v %v %v %v", res.Name, res.Count, res.Tags, res.Props,
+		res.Child.Name, res.Scores, res.Any, res.Ignored) != "foo 5 [a b] map[p:1] bar [0.5 1] [1] " {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	var num int
+
+	if err := ConvertECALToGoObject(1., num); err == nil || err.Error() != "Target must be a non-nil pointer" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := ConvertECALToGoObject("1", &num); err == nil || err.Error() != "Cannot convert 1 (type string) into int (value)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := ConvertECALToGoObject(map[interface{}]interface{}{"scores": []interface{}{1.}}, &res); err == nil ||
+		err.Error() != "Cannot convert list of size 1 into array of size 2 (value.scores)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := ConvertECALToGoObject(map[interface{}]interface{}{"props": map[interface{}]interface{}{"p": "x"}}, &res); err == nil ||
+		err.Error() != "Cannot convert x (type string) into uint8 (value.props.p)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := ConvertECALToGoObject(nil, &res); err != nil || res.Name != "" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
@@ -0,0 +1,277 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package scope
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/krotik/ecal/parser"
+)
+
+/*
+Markers for values which cannot be expressed directly in JSON
+*/
+const (
+	serializedMap  = "$map"  // Map with keys which are not strings
+	serializedFunc = "$func" // Reference to a function
+)
+
+/*
+Serialize converts the variables of a scope into a JSON snapshot. Maps, lists,
+numbers, strings, booleans and null values are stored by value. Functions are
+stored by reference (i.e. the path of the variable which holds them) and are
+bound again on restore. Child scopes are not included.
+*/
+func Serialize(vs parser.Scope) ([]byte, error) {
+	var err error
+
+	res := make(map[string]interface{})
+
+	for k, v := range ToObject(vs) {
+		name := fmt.Sprint(k)
+
+		if res[name], err = serializeValue(v, name); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.MarshalIndent(res, "", "  ")
+}
+
+/*
+serializeValue converts a value into an object which can be marshalled into JSON.
+*/
+func serializeValue(v interface{}, path string) (interface{}, error) {
+	var err error
+
+	switch val := v.(type) {
+
+	case nil, bool, float64, string:
+		return val, nil
+
+	case []interface{}:
+		res := make([]interface{}, len(val))
+
+		for i, lv := range val {
+			if res[i], err = serializeValue(lv, fmt.Sprintf("%v.%v", path, i)); err != nil {
+				return nil, err
+			}
+		}
+
+		return res, nil
+
+	case map[interface{}]interface{}:
+		plain := true
+
+		for mk := range val {
+			if s, ok := mk.(string); !ok || strings.HasPrefix(s, "$") {
+				plain = false
+				break
+			}
+		}
+
+		if plain {
+			res := make(map[string]interface{})
+
+			for mk, mv := range val {
+				if res[mk.(string)], err = serializeValue(mv, fmt.Sprintf("%v.%v", path, mk)); err != nil {
+					return nil, err
+				}
+			}
+
+			return res, nil
+		}
+
+		// Maps with keys which are not strings are stored as a list of key / value pairs
+
+		keys := make([]interface{}, 0, len(val))
+		for mk := range val {
+			keys = append(keys, mk)
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+
+		pairs := make([]interface{}, 0, len(val))
+
+		for _, mk := range keys {
+			var sk, sv interface{}
+
+			if sk, err = serializeValue(mk, path); err == nil {
+				sv, err = serializeValue(val[mk], fmt.Sprintf("%v.%v", path, mk))
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			pairs = append(pairs, []interface{}{sk, sv})
+		}
+
+		return map[string]interface{}{serializedMap: pairs}, nil
+
+	case function:
+		return map[string]interface{}{serializedFunc: path}, nil
+	}
+
+	return nil, fmt.Errorf("Cannot serialize value of %v (type %T)", path, v)
+}
+
+/*
+Deserialize restores the variables of a JSON snapshot into a scope. Function
+references are bound to the functions which are currently stored under the
+same path in the scope (null if there is no such function).
+*/
+func Deserialize(vs parser.Scope, data []byte) error {
+	var snapshot map[string]interface{}
+
+	err := json.Unmarshal(data, &snapshot)
+
+	if err == nil {
+		current := ToObject(vs)
+		values := make(map[string]interface{})
+
+		// Deserialize all values before changing the scope so function
+		// references are resolved against the current state
+
+		for k, v := range snapshot {
+			if values[k], err = deserializeValue(v, current); err != nil {
+				return err
+			}
+		}
+
+		for k, v := range values {
+			if err = vs.SetValue(k, v); err != nil {
+				break
+			}
+		}
+	}
+
+	return err
+}
+
+/*
+deserializeValue converts an unmarshalled JSON object into an ECAL value.
+*/
+func deserializeValue(v interface{}, current map[interface{}]interface{}) (interface{}, error) {
+	var err error
+
+	switch val := v.(type) {
+
+	case []interface{}:
+		res := make([]interface{}, len(val))
+
+		for i, lv := range val {
+			if res[i], err = deserializeValue(lv, current); err != nil {
+				return nil, err
+			}
+		}
+
+		return res, nil
+
+	case map[string]interface{}:
+
+		if path, ok := val[serializedFunc]; ok && len(val) == 1 {
+			return lookupFunction(fmt.Sprint(path), current), nil
+		}
+
+		res := make(map[interface{}]interface{})
+
+		if pairs, ok := val[serializedMap]; ok && len(val) == 1 {
+			pairList, ok := pairs.([]interface{})
+
+			if !ok {
+				return nil, fmt.Errorf("Invalid map in snapshot: %v", pairs)
+			}
+
+			for _, p := range pairList {
+				var mk, mv interface{}
+
+				pair, ok := p.([]interface{})
+
+				if !ok || len(pair) != 2 {
+					return nil, fmt.Errorf("Invalid map entry in snapshot: %v", p)
+				}
+
+				if mk, err = deserializeValue(pair[0], current); err == nil {
+					mv, err = deserializeValue(pair[1], current)
+				}
+
+				if err != nil {
+					return nil, err
+				}
+
+				res[mk] = mv
+			}
+
+			return res, nil
+		}
+
+		for mk, mv := range val {
+			if res[mk], err = deserializeValue(mv, current); err != nil {
+				return nil, err
+			}
+		}
+
+		return res, nil
+	}
+
+	return v, nil
+}
+
+/*
+lookupFunction looks up a function by its variable path.
+*/
+func lookupFunction(path string, current map[interface{}]interface{}) interface{} {
+	var val interface{} = current
+
+	for _, p := range strings.Split(path, ".") {
+		switch container := val.(type) {
+		case map[interface{}]interface{}:
+			if v, ok := container[p]; ok {
+				val = v
+			} else {
+				val = lookupMapKey(container, p)
+			}
+		case []interface{}:
+			var i int
+			if _, err := fmt.Sscanf(p, "%d", &i); err == nil && i >= 0 && i < len(container) {
+				val = container[i]
+			} else {
+				val = nil
+			}
+		default:
+			val = nil
+		}
+	}
+
+	if f, ok := val.(function); ok {
+		return f
+	}
+
+	return nil
+}
+
+/*
+lookupMapKey looks up a map value by the string representation of its key.
+*/
+func lookupMapKey(m map[interface{}]interface{}, key string) interface{} {
+	for k, v := range m {
+		if fmt.Sprint(k) == key {
+			return v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package scope
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/krotik/ecal/parser"
+)
+
+type testFunc struct {
+	name string
+}
+
+func (tf *testFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	return nil, nil
+}
+
+func (tf *testFunc) DocString() (string, error) {
+	return tf.name, nil
+}
+
+func TestSerialize(t *testing.T) {
+	f1 := &testFunc{"f1"}
+	f2 := &testFunc{"f2"}
+
+	vs := NewScope(GlobalScope)
+
+	vs.SetValue("a", 1.)
+	vs.SetValue("b", []interface{}{"x", true, nil, f1})
+	vs.SetValue("c", map[interface{}]interface{}{
+		"d": map[interface{}]interface{}{1.: "one", "$x": 2.},
+		"e": f2,
+	})
+	vs.SetValue("f", f1)
+
+	data, err := Serialize(vs)
+
+	if err != nil || string(data) != `{
+  "a": 1,
+  "b": [
+    "x",
+    true,
+    null,
+    {
+      "$func": "b.3"
+    }
+  ],
+  "c": {
+    "d": {
+      "$map": [
+        [
+          "$x",
+          2
+        ],
+        [
+          1,
+          "one"
+        ]
+      ]
+    },
+    "e": {
+      "$func": "c.e"
+    }
+  },
+  "f": {
+    "$func": "f"
+  }
+}` {
+		t.Error("Unexpected result:", string(data), err)
+		return
+	}
+
+	// Restore into a scope which has new function definitions
+
+	f1new := &testFunc{"f1new"}
+
+	vs2 := NewScope(GlobalScope)
+	vs2.SetValue("f", f1new)
+	vs2.SetValue("b", []interface{}{nil, nil, nil, f1new})
+
+	if err := Deserialize(vs2, data); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	obj := ToObject(vs2)
+	c := obj["c"].(map[interface{}]interface{})
+
+	if res := fmt.Sprint(obj["a"], " ", obj["b"].([]interface{})[:3], " ", c["d"]); res != "1 [x true <nil>] map[$x:2 1:one]" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if obj["f"] != f1new || obj["b"].([]interface{})[3] != f1new || c["e"] != nil {
+		t.Error("Unexpected result:", obj)
+		return
+	}
+
+	if _, ok := c["d"].(map[interface{}]interface{})[1.]; !ok {
+		t.Error("Number keys should be restored as numbers")
+		return
+	}
+
+	// Test error cases
+
+	vs.SetValue("g", map[interface{}]interface{}{"h": []interface{}{make(chan int)}})
+
+	if _, err := Serialize(vs); err == nil || err.Error() != "Cannot serialize value of g.h.0 (type chan int)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := Deserialize(vs2, []byte("[")); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := Deserialize(vs2, []byte(`{"a" : {"$map" : 1}}`)); err == nil || err.Error() != "Invalid map in snapshot: 1" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := Deserialize(vs2, []byte(`{"a" : {"$map" : [[1]]}}`)); err == nil || err.Error() != "Invalid map entry in snapshot: [1]" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
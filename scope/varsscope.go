@@ -167,6 +167,10 @@ func (s *varsScope) setValue(varName string, varValue interface{}) error {
 
 					mapContainer[fieldIndex] = varValue
 
+				} else if objContainer, ok := container.(object); ok {
+
+					err = objContainer.SetField(fieldIndex, varValue)
+
 				} else if listContainer, ok := container.([]interface{}); ok {
 					var index int
 
@@ -189,6 +193,19 @@ func (s *varsScope) setValue(varName string, varValue interface{}) error {
 						err = fmt.Errorf("List %v needs a number index not: %v",
 							strings.Join(cFields[:len(cFields)-1], "."), fieldIndex)
 					}
+				} else if bytesContainer, ok := container.([]byte); ok {
+					var index int
+
+					if index, err = bytesIndex(bytesContainer, fieldIndex,
+						strings.Join(cFields[:len(cFields)-1], ".")); err == nil {
+
+						if b, ok := varValue.(float64); ok && b >= 0 && b <= 255 && b == float64(int(b)) {
+							bytesContainer[index] = byte(b)
+						} else {
+							err = fmt.Errorf("Byte value must be an integer between 0 and 255: %v", varValue)
+						}
+					}
+
 				} else {
 					err = fmt.Errorf("Variable %v is not a container",
 						strings.Join(cFields[:len(cFields)-1], "."))
@@ -230,6 +247,13 @@ func (s *varsScope) containerAccess(container interface{}, cFields []string, fie
 				strings.Join(cFields[:len(cFields)-len(fields)+1], "."))
 		}
 
+	} else if objContainer, ok := container.(object); ok {
+
+		if container, ok, err = objContainer.GetField(fields[0]); err == nil && !ok {
+			err = fmt.Errorf("Container field %v does not exist",
+				strings.Join(cFields[:len(cFields)-len(fields)+1], "."))
+		}
+
 	} else if listContainer, ok := container.([]interface{}); ok {
 		var index int
 
@@ -268,6 +292,28 @@ func (s *varsScope) containerAccess(container interface{}, cFields []string, fie
 	return container, err
 }
 
+/*
+bytesIndex returns the position of an index in a byte array. Negative indices
+count from the end.
+*/
+func bytesIndex(bytesContainer []byte, fieldIndex string, name string) (int, error) {
+	index, err := strconv.Atoi(fieldIndex)
+
+	if err != nil {
+		return 0, fmt.Errorf("Bytes %v need a number index not: %v", name, fieldIndex)
+	}
+
+	if index < 0 {
+		index = len(bytesContainer) + index
+	}
+
+	if index < 0 || index >= len(bytesContainer) {
+		return 0, fmt.Errorf("Out of bounds access to bytes %v with index: %v", name, fieldIndex)
+	}
+
+	return index, nil
+}
+
 /*
 getScopeForVariable returns the scope (this or a parent scope) which holds a
 given variable.
@@ -333,6 +379,10 @@ func (s *varsScope) getValue(varName string) (interface{}, bool, error) {
 					retContainer = mapContainer[fields[0]]
 				}
 
+			} else if objContainer, ok := container.(object); ok {
+
+				retContainer, _, err = objContainer.GetField(fields[0])
+
 			} else if listContainer, ok := container.([]interface{}); ok {
 				var index int
 
@@ -357,6 +407,15 @@ func (s *varsScope) getValue(varName string) (interface{}, bool, error) {
 						strings.Join(cFields[:len(cFields)-len(fields)], "."), fields[0])
 				}
 
+			} else if bytesContainer, ok := container.([]byte); ok {
+				var index int
+
+				if index, err = bytesIndex(bytesContainer, fields[0],
+					strings.Join(cFields[:len(cFields)-len(fields)], ".")); err == nil {
+
+					retContainer = float64(bytesContainer[index])
+				}
+
 			} else {
 				err = fmt.Errorf("Variable %v is not a container",
 					strings.Join(cFields[:len(cFields)-len(fields)], "."))
@@ -272,6 +272,67 @@ func TestVarScopeGet(t *testing.T) {
 	}
 }
 
+func TestVarScopeBytes(t *testing.T) {
+	vs := NewScope("test")
+
+	vs.SetValue("data", map[interface{}]interface{}{"b": []byte{1, 2, 255}})
+
+	if res := fmt.Sprint(vs.GetValue("data.b.0")); res != "1 true <nil>" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(vs.GetValue("data.b.-1")); res != "255 true <nil>" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := vs.SetValue("data.b.1", 10.); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := vs.SetValue("data.b.-1", 0.); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := fmt.Sprint(vs.GetValue("data.b")); res != "[1 10 0] true <nil>" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(vs.GetValue("data.b.3")); res != "<nil> false Out of bounds access to bytes data.b with index: 3" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(vs.GetValue("data.b.a")); res != "<nil> false Bytes data.b need a number index not: a" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res := fmt.Sprint(vs.GetValue("data.b.0.1")); res != "<nil> false Variable data.b.0 is not a container" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if err := vs.SetValue("data.b.-4", 1.); err == nil || err.Error() != "Out of bounds access to bytes data.b with index: -4" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := vs.SetValue("data.b.0", 256.); err == nil || err.Error() != "Byte value must be an integer between 0 and 255: 256" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := vs.SetValue("data.b.0", "a"); err == nil || err.Error() != "Byte value must be an integer between 0 and 255: a" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
 func TestVarScopeDump(t *testing.T) {
 
 	// Build a small tree of VS
@@ -0,0 +1,414 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+/*
+Package server contains an API server which exposes the ECA engine of an ECAL
+runtime provider to other systems. The API follows the JSON-RPC 2.0
+specification - requests are sent as HTTP POST requests.
+*/
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/krotik/ecal/interpreter"
+	"github.com/krotik/ecal/scope"
+)
+
+/*
+JSON-RPC error codes
+*/
+const (
+	ErrCodeParse          = -32700
+	ErrCodeInvalidRequest = -32600
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInvalidParams  = -32602
+	ErrCodeServer         = -32000
+)
+
+/*
+APIServer is a JSON-RPC 2.0 server for an ECAL runtime provider.
+*/
+type APIServer struct {
+	RuntimeProvider *interpreter.ECALRuntimeProvider // Runtime provider which is exposed
+	Address         string                           // Address to listen on (e.g. localhost:33275)
+	Token           string                           // Token which clients must send to authenticate (blank for no authentication)
+
+	listener net.Listener  // Listener of the HTTP server
+	server   *http.Server  // HTTP server
+	done     chan struct{} // Channel which is closed once the server has stopped
+	lock     *sync.Mutex   // Lock for the server state
+}
+
+/*
+NewAPIServer creates a new API server.
+*/
+func NewAPIServer(erp *interpreter.ECALRuntimeProvider, address string) *APIServer {
+	return &APIServer{erp, address, "", nil, nil, nil, &sync.Mutex{}}
+}
+
+/*
+Start starts the API server.
+*/
+func (s *APIServer) Start() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.server != nil {
+		return fmt.Errorf("API server is already running")
+	}
+
+	listener, err := net.Listen("tcp", s.Address)
+
+	if err == nil {
+		s.listener = listener
+		s.server = &http.Server{Handler: s}
+		s.done = make(chan struct{})
+
+		go func(server *http.Server, done chan struct{}) {
+			server.Serve(listener)
+			close(done)
+		}(s.server, s.done)
+	}
+
+	return err
+}
+
+/*
+ListenAddress returns the actual address the server is listening on.
+*/
+func (s *APIServer) ListenAddress() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.listener == nil {
+		return ""
+	}
+
+	return s.listener.Addr().String()
+}
+
+/*
+Stop stops the API server.
+*/
+func (s *APIServer) Stop() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.server == nil {
+		return fmt.Errorf("API server is not running")
+	}
+
+	err := s.server.Close()
+	<-s.done
+
+	s.server = nil
+	s.listener = nil
+
+	return err
+}
+
+/*
+IsExposed returns true if the server listens on a non-loopback address and
+does not require authentication.
+*/
+func (s *APIServer) IsExposed() bool {
+	host, _, err := net.SplitHostPort(s.ListenAddress())
+
+	if err != nil || s.Token != "" {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip == nil || !ip.IsLoopback()
+}
+
+/*
+Wait waits until the API server has stopped.
+*/
+func (s *APIServer) Wait() {
+	s.lock.Lock()
+	done := s.done
+	s.lock.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+/*
+apiRequest is a JSON-RPC request.
+*/
+type apiRequest struct {
+	Version string                 `json:"jsonrpc"`
+	Method  string                 `json:"method"`
+	Params  map[string]interface{} `json:"params"`
+	ID      *json.RawMessage       `json:"id"`
+}
+
+/*
+apiError is a JSON-RPC error.
+*/
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+/*
+Error returns a string representation of this error.
+*/
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+/*
+ServeHTTP handles a JSON-RPC request.
+*/
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req apiRequest
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.authenticate(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var result interface{}
+	var resErr *apiError
+	var id *json.RawMessage
+
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+
+	if err != nil {
+		resErr = &apiError{ErrCodeParse, fmt.Sprintf("Could not parse request: %v", err)}
+
+	} else {
+		id = req.ID
+
+		if req.Version != "2.0" || req.Method == "" {
+			resErr = &apiError{ErrCodeInvalidRequest, "Invalid JSON-RPC 2.0 request"}
+
+		} else if method, ok := apiMethods[req.Method]; !ok {
+			resErr = &apiError{ErrCodeMethodNotFound, fmt.Sprintf("Unknown method: %v", req.Method)}
+
+		} else {
+
+			if req.Params == nil {
+				req.Params = map[string]interface{}{}
+			}
+
+			if result, err = method(s, req.Params); err != nil {
+				var ok bool
+
+				if resErr, ok = err.(*apiError); !ok {
+					resErr = &apiError{ErrCodeServer, err.Error()}
+				}
+			}
+		}
+
+		if id == nil && resErr == nil {
+
+			// Notifications do not get a response
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	// A response has either a result or an error
+
+	res := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+	}
+
+	if resErr != nil {
+		res["error"] = resErr
+	} else {
+		res["result"] = scope.ConvertECALToJSONObject(result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+/*
+authenticate checks that a request contains the expected token in the form:
+Authorization: Bearer <token>
+*/
+func (s *APIServer) authenticate(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+
+	auth := r.Header.Get("Authorization")
+
+	return strings.HasPrefix(auth, "Bearer ") &&
+		subtle.ConstantTimeCompare([]byte(strings.TrimSpace(auth[7:])), []byte(s.Token)) == 1
+}
+
+/*
+apiMethods contains all methods of the API.
+*/
+var apiMethods = map[string]func(*APIServer, map[string]interface{}) (interface{}, error){
+	"addEvent":        apiAddEvent,
+	"addEventAndWait": apiAddEventAndWait,
+	"rules":           apiRules,
+	"status":          apiStatus,
+	"setCronTrigger":  apiSetCronTrigger,
+	"setPulseTrigger": apiSetPulseTrigger,
+}
+
+/*
+apiAddEvent adds an event to the processor and returns immediately.
+Parameters are name, kind, state and an optional scope.
+*/
+func apiAddEvent(s *APIServer, params map[string]interface{}) (interface{}, error) {
+	return s.runInbuildFunc("addEvent", params, 3, "name", "kind", "state", "scope")
+}
+
+/*
+apiAddEventAndWait adds an event to the processor and waits for the event
+cascade to finish. Returns the errors of the cascade. Parameters are name,
+kind, state and an optional scope.
+*/
+func apiAddEventAndWait(s *APIServer, params map[string]interface{}) (interface{}, error) {
+	res, err := s.runInbuildFunc("addEventAndWait", params, 3, "name", "kind", "state", "scope")
+
+	if res == nil && err == nil {
+		res = []interface{}{}
+	}
+
+	return res, err
+}
+
+/*
+apiRules returns all rules of the processor ordered by name.
+*/
+func apiRules(s *APIServer, params map[string]interface{}) (interface{}, error) {
+	var names []string
+
+	rules := s.RuntimeProvider.Processor.Rules()
+
+	for name := range rules {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	res := make([]interface{}, 0, len(names))
+
+	for _, name := range names {
+		r := rules[name]
+
+		res = append(res, map[string]interface{}{
+			"name":            r.Name,
+			"desc":            r.Desc,
+			"kindMatch":       r.KindMatch,
+			"scopeMatch":      r.ScopeMatch,
+			"stateMatch":      r.StateMatch,
+			"priority":        r.Priority,
+			"suppressionList": r.SuppressionList,
+		})
+	}
+
+	return res, nil
+}
+
+/*
+apiStatus returns the status and metrics of the processor.
+*/
+func apiStatus(s *APIServer, params map[string]interface{}) (interface{}, error) {
+	proc := s.RuntimeProvider.Processor
+	state := proc.ThreadPool().State()
+
+	return map[string]interface{}{
+		"name":          s.RuntimeProvider.Name,
+		"status":        proc.Status(),
+		"workers":       proc.Workers(),
+		"rules":         len(proc.Rules()),
+		"taskQueueSize": state["TaskQueueSize"],
+		"totalThreads":  len(state["TotalWorkerThreads"].([]uint64)),
+		"idleThreads":   len(state["IdleWorkerThreads"].([]uint64)),
+	}, nil
+}
+
+/*
+apiSetCronTrigger adds a periodic cron job which fires events. Parameters are
+cronspec, name and kind.
+*/
+func apiSetCronTrigger(s *APIServer, params map[string]interface{}) (interface{}, error) {
+	return s.runInbuildFunc("setCronTrigger", params, 3, "cronspec", "name", "kind")
+}
+
+/*
+apiSetPulseTrigger adds recurring events in very short intervals. Parameters
+are micros, name and kind.
+*/
+func apiSetPulseTrigger(s *APIServer, params map[string]interface{}) (interface{}, error) {
+	return s.runInbuildFunc("setPulseTrigger", params, 3, "micros", "name", "kind")
+}
+
+/*
+runInbuildFunc runs an inbuild function of the interpreter. The named
+parameters are converted into a list of arguments. The first given number of
+parameter names are mandatory. Event kinds can be given as a list.
+*/
+func (s *APIServer) runInbuildFunc(name string, params map[string]interface{},
+	required int, paramNames ...string) (interface{}, error) {
+
+	var args []interface{}
+
+	for i, pname := range paramNames {
+		val, ok := params[pname]
+
+		if !ok {
+			if i < required {
+				return nil, &apiError{ErrCodeInvalidParams,
+					fmt.Sprintf("Missing parameter: %v (required are: %v)", pname,
+						strings.Join(paramNames[:required], ", "))}
+			}
+			break
+		}
+
+		if kindList, ok := val.([]interface{}); ok && pname == "kind" {
+			var kind []string
+
+			for _, k := range kindList {
+				kind = append(kind, fmt.Sprint(k))
+			}
+
+			val = strings.Join(kind, ".")
+		}
+
+		args = append(args, scope.ConvertJSONToECALObject(val))
+	}
+
+	return interpreter.InbuildFuncMap[name].Run("", nil,
+		map[string]interface{}{"erp": s.RuntimeProvider}, s.RuntimeProvider.NewThreadID(), args)
+}
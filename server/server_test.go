@@ -0,0 +1,280 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/krotik/ecal/interpreter"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/util"
+)
+
+func sendRequest(addr string, method string, body string) (string, error) {
+	return sendAuthRequest(addr, method, body, "")
+}
+
+func sendAuthRequest(addr string, method string, body string, auth string) (string, error) {
+	var res string
+
+	req, err := http.NewRequest(method, "http://"+addr, bytes.NewBufferString(body))
+
+	if err == nil {
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		var resp *http.Response
+
+		if resp, err = http.DefaultClient.Do(req); err == nil {
+			var data []byte
+
+			defer resp.Body.Close()
+
+			if data, err = ioutil.ReadAll(resp.Body); err == nil {
+				res = strings.TrimSpace(string(data))
+			}
+		}
+	}
+
+	return res, err
+}
+
+func TestAPIServer(t *testing.T) {
+	logger := util.NewMemoryLogger(10)
+	erp := interpreter.NewECALRuntimeProvider("testserver", nil, logger)
+
+	ast, err := parser.ParseWithRuntime("test", `
+sink Orders
+  kindmatch [ "order.*" ],
+  statematch { "amount" : NULL },
+{
+  log("Order: ", event.state.amount)
+  if event.state.amount > 10 {
+    raise("TooMuch", "Amount too high", event.state.amount)
+  }
+}
+`, erp)
+
+	if err == nil {
+		if err = ast.Runtime.Validate(); err == nil {
+			_, err = ast.Runtime.Eval(scope.NewScope(scope.GlobalScope), make(map[string]interface{}), 0)
+		}
+	}
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	erp.Processor.Start()
+	defer erp.Processor.Finish()
+
+	srv := NewAPIServer(erp, "localhost:0")
+
+	if err := srv.Stop(); err == nil || err.Error() != "API server is not running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := srv.Start(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := srv.Start(); err == nil || err.Error() != "API server is already running" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	addr := srv.ListenAddress()
+
+	res, err := sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"addEventAndWait","params":{
+"name":"myorder","kind":["order","new"],"state":{"amount":5}},"id":1}`)
+	if res != `{"id":1,"jsonrpc":"2.0","result":[]}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res := logger.String(); res != "Order: 5" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	res, err = sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"addEventAndWait","params":{
+"name":"myorder","kind":"order.new","state":{"amount":15}},"id":"2"}`)
+	if res != `{"id":"2","jsonrpc":"2.0","result":[{"errors":{"Orders":{"data":15,"detail":"Amount too high",`+
+		`"error":"ECAL error in testserver (test): TooMuch (Amount too high) (Line:8 Pos:5)","type":"TooMuch"}},`+
+		`"event":{"kind":"order.new","name":"myorder","state":{"amount":15}},"results":{}}]}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"addEvent","params":{
+"name":"myorder","kind":"order.new","state":{"amount":1}},"id":3}`)
+	if res != `{"id":3,"jsonrpc":"2.0","result":null}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"rules","id":4}`)
+	if res != `{"id":4,"jsonrpc":"2.0","result":[{"desc":"","kindMatch":["order.*"],"name":"Orders",`+
+		`"priority":0,"scopeMatch":[],"stateMatch":{"amount":null},"suppressionList":null}]}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"status","id":5}`)
+	if !strings.HasPrefix(res, `{"id":5,"jsonrpc":"2.0","result":{"idleThreads":`) ||
+		!strings.Contains(res, `"name":"testserver","rules":1,"status":"Running"`) || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"setCronTrigger","params":{
+"cronspec":"1 * * * * *","name":"cronevent","kind":"cron.event"},"id":6}`)
+	if res != `{"id":6,"jsonrpc":"2.0","result":"at second 1 of every minute every day"}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Notifications have no response
+
+	res, err = sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"status"}`)
+	if res != `` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Test error cases
+
+	res, err = sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"addEvent","params":{"name":"foo"},"id":7}`)
+	if res != `{"error":{"code":-32602,"message":"Missing parameter: kind (required are: name, kind, state)"},"id":7,"jsonrpc":"2.0"}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"addEvent","params":{
+"name":"foo","kind":"foo","state":"bar"},"id":8}`)
+	if res != `{"error":{"code":-32000,"message":"Parameter 3 should be a map"},"id":8,"jsonrpc":"2.0"}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"foo","id":9}`)
+	if res != `{"error":{"code":-32601,"message":"Unknown method: foo"},"id":9,"jsonrpc":"2.0"}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendRequest(addr, "POST", `{"method":"status","id":10}`)
+	if res != `{"error":{"code":-32600,"message":"Invalid JSON-RPC 2.0 request"},"id":10,"jsonrpc":"2.0"}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendRequest(addr, "POST", `{"jsonrpc":"2.0"`)
+	if res != `{"error":{"code":-32700,"message":"Could not parse request: unexpected end of JSON input"},"id":null,"jsonrpc":"2.0"}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendRequest(addr, "GET", ``)
+	if res != `Only POST requests are supported` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	stopped := make(chan bool)
+
+	go func() {
+		srv.Wait()
+		stopped <- true
+	}()
+
+	if err := srv.Stop(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	<-stopped
+
+	if addr := srv.ListenAddress(); addr != "" {
+		t.Error("Unexpected result:", addr)
+		return
+	}
+}
+
+func TestAPIServerToken(t *testing.T) {
+	erp := interpreter.NewECALRuntimeProvider("testserver", nil, util.NewMemoryLogger(10))
+
+	erp.Processor.Start()
+	defer erp.Processor.Finish()
+
+	srv := NewAPIServer(erp, "localhost:0")
+	srv.Token = "secret"
+
+	if err := srv.Start(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+	defer srv.Stop()
+
+	if srv.IsExposed() {
+		t.Error("Server should not be exposed")
+		return
+	}
+
+	addr := srv.ListenAddress()
+
+	res, err := sendRequest(addr, "POST", `{"jsonrpc":"2.0","method":"rules","id":1}`)
+	if res != `Unauthorized` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendAuthRequest(addr, "POST", `{"jsonrpc":"2.0","method":"rules","id":1}`, "Bearer foo")
+	if res != `Unauthorized` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = sendAuthRequest(addr, "POST", `{"jsonrpc":"2.0","method":"rules","id":1}`, "Bearer secret")
+	if res != `{"id":1,"jsonrpc":"2.0","result":[]}` || err != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	srv2 := NewAPIServer(erp, ":0")
+
+	if err := srv2.Start(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+	defer srv2.Stop()
+
+	if !srv2.IsExposed() {
+		t.Error("Server should be exposed")
+		return
+	}
+
+	srv2.Token = "secret"
+
+	if srv2.IsExposed() {
+		t.Error("Server should not be exposed")
+		return
+	}
+}
@@ -0,0 +1,385 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+cryptoFuncMap contains all functions of the crypto package.
+*/
+var cryptoFuncMap = map[string]util.ECALFunction{
+	"hash":         &cryptoHashFunc{&baseFunc{}},
+	"hmac":         &cryptoHmacFunc{&baseFunc{}},
+	"equal":        &cryptoEqualFunc{&baseFunc{}},
+	"base64Encode": &cryptoBase64EncodeFunc{&baseFunc{}},
+	"base64Decode": &cryptoBase64DecodeFunc{&baseFunc{}},
+	"hexEncode":    &cryptoHexEncodeFunc{&baseFunc{}},
+	"hexDecode":    &cryptoHexDecodeFunc{&baseFunc{}},
+	"uuid":         &cryptoUUIDFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("crypto", "Hashing, encoding and random identifier functions.", cryptoFuncMap)
+}
+
+/*
+cryptoHashAlgorithms contains all supported hash algorithms.
+*/
+var cryptoHashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+/*
+cryptoHashAlgorithm returns the hash constructor of a given algorithm name.
+*/
+func cryptoHashAlgorithm(name interface{}) (func() hash.Hash, error) {
+	h, ok := cryptoHashAlgorithms[fmt.Sprint(name)]
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown hash algorithm: %v (supported are md5, sha1 and sha256)", name)
+	}
+
+	return h, nil
+}
+
+/*
+cryptoEncode encodes a hash sum as hex (default) or base64 string.
+*/
+func cryptoEncode(sum []byte, args []interface{}, index int) (string, error) {
+	encoding := "hex"
+
+	if len(args) > index {
+		encoding = fmt.Sprint(args[index])
+	}
+
+	switch encoding {
+	case "hex":
+		return hex.EncodeToString(sum), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(sum), nil
+	}
+
+	return "", fmt.Errorf("Unknown encoding: %v (supported are hex and base64)", encoding)
+}
+
+/*
+cryptoBase64Encoding returns the standard or the URL base64 encoding.
+*/
+func cryptoBase64Encoding(args []interface{}, index int) *base64.Encoding {
+	if len(args) > index && args[index] == true {
+		return base64.URLEncoding
+	}
+
+	return base64.StdEncoding
+}
+
+// hash
+// ====
+
+/*
+cryptoHashFunc calculates a hash sum.
+*/
+type cryptoHashFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *cryptoHashFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 2, "an algorithm and a string")
+
+	if err == nil {
+		var newHash func() hash.Hash
+
+		if newHash, err = cryptoHashAlgorithm(args[0]); err == nil {
+			h := newHash()
+			h.Write(bytesParam(args[1]))
+
+			res, err = cryptoEncode(h.Sum(nil), args, 2)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *cryptoHashFunc) DocString() (string, error) {
+	return "Calculates the hash sum (md5, sha1 or sha256) of a string.", nil
+}
+
+// hmac
+// ====
+
+/*
+cryptoHmacFunc calculates a keyed hash message authentication code.
+*/
+type cryptoHmacFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *cryptoHmacFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 3, "an algorithm, a key and a string")
+
+	if err == nil {
+		var newHash func() hash.Hash
+
+		if newHash, err = cryptoHashAlgorithm(args[0]); err == nil {
+			h := hmac.New(newHash, bytesParam(args[1]))
+			h.Write(bytesParam(args[2]))
+
+			res, err = cryptoEncode(h.Sum(nil), args, 3)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *cryptoHmacFunc) DocString() (string, error) {
+	return "Calculates the HMAC (md5, sha1 or sha256) of a string with a given key.", nil
+}
+
+// equal
+// =====
+
+/*
+cryptoEqualFunc compares two strings in constant time.
+*/
+type cryptoEqualFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *cryptoEqualFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 2, "two strings")
+
+	if err == nil {
+		res = subtle.ConstantTimeCompare(bytesParam(args[0]), bytesParam(args[1])) == 1
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *cryptoEqualFunc) DocString() (string, error) {
+	return "Compares two strings in constant time (e.g. to verify signatures).", nil
+}
+
+// base64Encode
+// ============
+
+/*
+cryptoBase64EncodeFunc encodes a string as base64.
+*/
+type cryptoBase64EncodeFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *cryptoBase64EncodeFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a string")
+
+	if err == nil {
+		res = cryptoBase64Encoding(args, 1).EncodeToString(bytesParam(args[0]))
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *cryptoBase64EncodeFunc) DocString() (string, error) {
+	return "Encodes a string as base64 (optionally URL safe).", nil
+}
+
+// base64Decode
+// ============
+
+/*
+cryptoBase64DecodeFunc decodes a base64 string.
+*/
+type cryptoBase64DecodeFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *cryptoBase64DecodeFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a string")
+
+	if err == nil {
+		var data []byte
+
+		if data, err = cryptoBase64Encoding(args, 1).DecodeString(fmt.Sprint(args[0])); err == nil {
+			res = string(data)
+		} else {
+			err = fmt.Errorf("Could not decode base64 string: %v", err)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *cryptoBase64DecodeFunc) DocString() (string, error) {
+	return "Decodes a base64 string (optionally URL safe).", nil
+}
+
+// hexEncode
+// =========
+
+/*
+cryptoHexEncodeFunc encodes a string as hex.
+*/
+type cryptoHexEncodeFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *cryptoHexEncodeFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a string")
+
+	if err == nil {
+		res = hex.EncodeToString(bytesParam(args[0]))
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *cryptoHexEncodeFunc) DocString() (string, error) {
+	return "Encodes a string as hex.", nil
+}
+
+// hexDecode
+// =========
+
+/*
+cryptoHexDecodeFunc decodes a hex string.
+*/
+type cryptoHexDecodeFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *cryptoHexDecodeFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a string")
+
+	if err == nil {
+		var data []byte
+
+		if data, err = hex.DecodeString(fmt.Sprint(args[0])); err == nil {
+			res = string(data)
+		} else {
+			err = fmt.Errorf("Could not decode hex string: %v", err)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *cryptoHexDecodeFunc) DocString() (string, error) {
+	return "Decodes a hex string.", nil
+}
+
+// uuid
+// ====
+
+/*
+cryptoUUIDFunc generates a random UUID.
+*/
+type cryptoUUIDFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *cryptoUUIDFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+
+	if err == nil {
+		b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+		b[8] = (b[8] & 0x3f) | 0x80 // Variant RFC 4122
+
+		res = fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *cryptoUUIDFunc) DocString() (string, error) {
+	return "Generates a random (version 4) UUID.", nil
+}
@@ -0,0 +1,144 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func runCryptoFunc(name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("crypto." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, nil, 0, args)
+}
+
+func TestCryptoHash(t *testing.T) {
+
+	for _, test := range [][]interface{}{
+		{"hash", []interface{}{"md5", "foo"}, "acbd18db4cc2f85cedef654fccc4a4d8"},
+		{"hash", []interface{}{"sha1", "foo"}, "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33"},
+		{"hash", []interface{}{"sha256", "foo"}, "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"},
+		{"hash", []interface{}{"sha256", "foo", "base64"}, "LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564="},
+		{"hash", []interface{}{"md5", []byte("foo")}, "acbd18db4cc2f85cedef654fccc4a4d8"},
+		{"hmac", []interface{}{"sha256", "key", "The quick brown fox jumps over the lazy dog"},
+			"f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{"hmac", []interface{}{"md5", "key", "The quick brown fox jumps over the lazy dog"},
+			"80070713463e7749b90c2dc24911e275"},
+		{"equal", []interface{}{"foo", "foo"}, true},
+		{"equal", []interface{}{"foo", "bar"}, false},
+		{"equal", []interface{}{[]byte("foo"), "foo"}, true},
+	} {
+		res, err := runCryptoFunc(test[0].(string), test[1].([]interface{})...)
+
+		if err != nil || res != test[2] {
+			t.Error("Unexpected result:", test, res, err)
+			return
+		}
+	}
+
+	if _, err := runCryptoFunc("hash", "sha512", "foo"); err == nil ||
+		err.Error() != "Unknown hash algorithm: sha512 (supported are md5, sha1 and sha256)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runCryptoFunc("hmac", "sha1", "key", "foo", "bar"); err == nil ||
+		err.Error() != "Unknown encoding: bar (supported are hex and base64)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runCryptoFunc("hmac", "sha1", "key"); err == nil ||
+		err.Error() != "Need an algorithm, a key and a string as parameters" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runCryptoFunc("hash", "sha1"); err == nil ||
+		err.Error() != "Need an algorithm and a string as parameters" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runCryptoFunc("equal", "foo"); err == nil ||
+		err.Error() != "Need two strings as parameters" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestCryptoEncoding(t *testing.T) {
+
+	for _, test := range [][]interface{}{
+		{"base64Encode", []interface{}{"\xff\xfe"}, "//4="},
+		{"base64Encode", []interface{}{"\xff\xfe", true}, "__4="},
+		{"base64Decode", []interface{}{"//4="}, "\xff\xfe"},
+		{"base64Decode", []interface{}{"__4=", true}, "\xff\xfe"},
+		{"hexEncode", []interface{}{"foo"}, "666f6f"},
+		{"hexDecode", []interface{}{"666f6f"}, "foo"},
+	} {
+		res, err := runCryptoFunc(test[0].(string), test[1].([]interface{})...)
+
+		if err != nil || res != test[2] {
+			t.Error("Unexpected result:", test, res, err)
+			return
+		}
+	}
+
+	if _, err := runCryptoFunc("base64Decode", "__4="); err == nil ||
+		!strings.HasPrefix(err.Error(), "Could not decode base64 string:") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runCryptoFunc("hexDecode", "xyz"); err == nil ||
+		!strings.HasPrefix(err.Error(), "Could not decode hex string:") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for _, name := range []string{"base64Encode", "base64Decode", "hexEncode", "hexDecode"} {
+		if _, err := runCryptoFunc(name); err == nil || err.Error() != "Need a string as parameter" {
+			t.Error("Unexpected result:", name, err)
+			return
+		}
+	}
+}
+
+func TestCryptoUUID(t *testing.T) {
+	uuidRegex := regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$")
+
+	res1, err := runCryptoFunc("uuid")
+
+	if err != nil || !uuidRegex.MatchString(fmt.Sprint(res1)) {
+		t.Error("Unexpected result:", res1, err)
+		return
+	}
+
+	res2, err := runCryptoFunc("uuid")
+
+	if err != nil || !uuidRegex.MatchString(fmt.Sprint(res2)) || res1 == res2 {
+		t.Error("Unexpected result:", res1, res2, err)
+		return
+	}
+
+	for name, f := range cryptoFuncMap {
+		if res, _ := f.DocString(); res == "" {
+			t.Error("Unexpected result:", name, res)
+			return
+		}
+	}
+}
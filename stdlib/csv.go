@@ -0,0 +1,277 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/krotik/common/sortutil"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+csvFuncMap contains all functions of the csv package.
+*/
+var csvFuncMap = map[string]util.ECALFunction{
+	"parse":     &csvParseFunc{&baseFunc{}},
+	"stringify": &csvStringifyFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("csv", "CSV parsing and serialization functions.", csvFuncMap)
+}
+
+/*
+csvDelimiter returns the delimiter which is given in an options map (default is a comma).
+*/
+func csvDelimiter(options map[interface{}]interface{}) (rune, error) {
+	d, ok := options["delimiter"]
+
+	if !ok {
+		return ',', nil
+	}
+
+	ds := fmt.Sprint(d)
+
+	if utf8.RuneCountInString(ds) != 1 {
+		return 0, fmt.Errorf("Delimiter must be a single character: %v", ds)
+	}
+
+	r, _ := utf8.DecodeRuneInString(ds)
+
+	return r, nil
+}
+
+/*
+csvCell converts an ECAL value into the string of a CSV cell.
+*/
+func csvCell(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// parse
+// =====
+
+/*
+csvParseFunc parses a CSV string into a list of rows.
+*/
+type csvParseFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *csvParseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var options map[interface{}]interface{}
+
+	err := f.AssertMinParams(args, 1, "a CSV string")
+
+	if err == nil && len(args) > 1 && args[1] != nil {
+		options, err = f.AssertMapParam(2, args[1])
+	}
+
+	if err == nil {
+		var records [][]string
+
+		r := csv.NewReader(strings.NewReader(fmt.Sprint(args[0])))
+		r.FieldsPerRecord = -1
+
+		if r.Comma, err = csvDelimiter(options); err == nil {
+			if records, err = r.ReadAll(); err != nil {
+				err = fmt.Errorf("Could not parse CSV: %v", err)
+			}
+		}
+
+		if err == nil {
+			rows := make([]interface{}, 0, len(records))
+
+			if header, ok := options["header"]; ok && header == true && len(records) > 0 {
+
+				// Use the first row as keys for all following rows
+
+				for _, record := range records[1:] {
+					row := make(map[interface{}]interface{})
+
+					for i, column := range records[0] {
+						if i < len(record) {
+							row[column] = record[i]
+						} else {
+							row[column] = nil
+						}
+					}
+
+					rows = append(rows, row)
+				}
+
+			} else {
+
+				for _, record := range records {
+					row := make([]interface{}, len(record))
+
+					for i, cell := range record {
+						row[i] = cell
+					}
+
+					rows = append(rows, row)
+				}
+			}
+
+			res = rows
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *csvParseFunc) DocString() (string, error) {
+	return "Parses a CSV string into a list of rows with optional options (delimiter, header).", nil
+}
+
+// stringify
+// =========
+
+/*
+csvStringifyFunc converts a list of rows into a CSV string.
+*/
+type csvStringifyFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *csvStringifyFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var rows []interface{}
+	var options map[interface{}]interface{}
+
+	err := f.AssertMinParams(args, 1, "a list of rows")
+
+	if err == nil {
+		rows, err = f.AssertListParam(1, args[0])
+	}
+
+	if err == nil && len(args) > 1 && args[1] != nil {
+		options, err = f.AssertMapParam(2, args[1])
+	}
+
+	if err == nil {
+		var columns []string
+		var buf bytes.Buffer
+
+		w := csv.NewWriter(&buf)
+
+		if w.Comma, err = csvDelimiter(options); err == nil {
+			columns, err = f.columns(rows, options)
+		}
+
+		// A header is written by default if there are named columns
+
+		if header, ok := options["header"]; err == nil && len(columns) > 0 && (!ok || header == true) {
+			err = w.Write(columns)
+		}
+
+		for i := 0; err == nil && i < len(rows); i++ {
+			var record []string
+
+			switch row := rows[i].(type) {
+
+			case map[interface{}]interface{}:
+				for _, c := range columns {
+					record = append(record, csvCell(row[c]))
+				}
+
+			case []interface{}:
+				for _, cell := range row {
+					record = append(record, csvCell(cell))
+				}
+
+			default:
+				err = fmt.Errorf("Row %v should be a list or a map", i+1)
+			}
+
+			if err == nil {
+				err = w.Write(record)
+			}
+		}
+
+		if err == nil {
+			w.Flush()
+			res = buf.String()
+		}
+	}
+
+	return res, err
+}
+
+/*
+columns determines the column names of a list of rows. The names are either
+given as an option or are the sorted keys of all map rows.
+*/
+func (f *csvStringifyFunc) columns(rows []interface{}, options map[interface{}]interface{}) ([]string, error) {
+	var res []string
+
+	if c, ok := options["columns"]; ok {
+		columns, err := f.AssertListParam(2, c)
+
+		if err != nil {
+			return nil, fmt.Errorf("Option columns should be a list")
+		}
+
+		for _, c := range columns {
+			res = append(res, fmt.Sprint(c))
+		}
+
+		return res, nil
+	}
+
+	var keys []interface{}
+	seen := make(map[interface{}]bool)
+
+	for _, row := range rows {
+		if m, ok := row.(map[interface{}]interface{}); ok {
+			for k := range m {
+				if !seen[k] {
+					seen[k] = true
+					keys = append(keys, k)
+				}
+			}
+		}
+	}
+
+	sortutil.InterfaceStrings(keys)
+
+	for _, k := range keys {
+		res = append(res, fmt.Sprint(k))
+	}
+
+	return res, nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *csvStringifyFunc) DocString() (string, error) {
+	return "Converts a list of rows (lists or maps) into a CSV string with optional options (delimiter, header, columns).", nil
+}
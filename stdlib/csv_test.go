@@ -0,0 +1,128 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	parse, _ := GetStdlibFunc("csv.parse")
+	stringify, _ := GetStdlibFunc("csv.stringify")
+
+	data := "name,count,comment\nfoo,1,\"a, b\"\nbar,2\n"
+
+	res, err := parse.Run("", nil, nil, 0, []interface{}{data})
+
+	if err != nil || fmt.Sprint(res) != "[[name count comment] [foo 1 a, b] [bar 2]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = parse.Run("", nil, nil, 0, []interface{}{data, map[interface{}]interface{}{"header": true}})
+
+	if err != nil || fmt.Sprint(res) != "[map[comment:a, b count:1 name:foo] map[comment:<nil> count:2 name:bar]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = parse.Run("", nil, nil, 0, []interface{}{"a;b\n1;2", map[interface{}]interface{}{"delimiter": ";", "header": true}})
+
+	if err != nil || fmt.Sprint(res) != "[map[a:1 b:2]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Stringify lists and maps
+
+	res, err = stringify.Run("", nil, nil, 0, []interface{}{[]interface{}{
+		[]interface{}{"foo", 1., "a, b"},
+		[]interface{}{"bar", nil, 0.5},
+	}})
+
+	if err != nil || res != "foo,1,\"a, b\"\nbar,,0.5\n" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	rows := []interface{}{
+		map[interface{}]interface{}{"name": "foo", "count": 1.},
+		map[interface{}]interface{}{"name": "bar", "comment": "x"},
+	}
+
+	res, err = stringify.Run("", nil, nil, 0, []interface{}{rows})
+
+	if err != nil || res != "comment,count,name\n,1,foo\nx,,bar\n" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = stringify.Run("", nil, nil, 0, []interface{}{rows, map[interface{}]interface{}{
+		"columns": []interface{}{"name", "count"}, "delimiter": "\t"}})
+
+	if err != nil || res != "name\tcount\nfoo\t1\nbar\t\n" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = stringify.Run("", nil, nil, 0, []interface{}{rows, map[interface{}]interface{}{"header": false}})
+
+	if err != nil || res != ",1,foo\nx,,bar\n" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := parse.Run("", nil, nil, 0, []interface{}{}); err == nil || err.Error() != "Need a CSV string as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := parse.Run("", nil, nil, 0, []interface{}{"a", "b"}); err == nil || err.Error() != "Parameter 2 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := parse.Run("", nil, nil, 0, []interface{}{"a", map[interface{}]interface{}{"delimiter": ";;"}}); err == nil ||
+		err.Error() != "Delimiter must be a single character: ;;" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := parse.Run("", nil, nil, 0, []interface{}{"a,\"b"}); err == nil ||
+		err.Error() != `Could not parse CSV: parse error on line 1, column 5: extraneous or missing " in quoted-field` {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := stringify.Run("", nil, nil, 0, []interface{}{}); err == nil || err.Error() != "Need a list of rows as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := stringify.Run("", nil, nil, 0, []interface{}{"a"}); err == nil || err.Error() != "Parameter 1 should be a list" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := stringify.Run("", nil, nil, 0, []interface{}{[]interface{}{"a"}}); err == nil || err.Error() != "Row 1 should be a list or a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := stringify.Run("", nil, nil, 0, []interface{}{rows, map[interface{}]interface{}{"columns": "a"}}); err == nil ||
+		err.Error() != "Option columns should be a list" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
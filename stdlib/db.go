@@ -0,0 +1,348 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+dbFuncMap contains all functions of the db package.
+*/
+var dbFuncMap = map[string]util.ECALFunction{
+	"open":  &dbOpenFunc{&baseFunc{}},
+	"query": &dbQueryFunc{&baseFunc{}},
+	"exec":  &dbExecFunc{&baseFunc{}},
+	"close": &dbCloseFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("db", "SQL database access to databases which are configured by the embedder.", dbFuncMap)
+}
+
+/*
+AssertDBParam converts a general interface{} parameter into a database connection.
+*/
+func (bf *baseFunc) AssertDBParam(index int, val interface{}) (*sql.DB, error) {
+	if db, ok := getHandle(val).(*sql.DB); ok {
+		return db, nil
+	}
+
+	return nil, fmt.Errorf("Parameter %v should be an open database connection", index)
+}
+
+/*
+dbParams converts an optional list of query parameters into values which can
+be bound by a database driver.
+*/
+func (bf *baseFunc) dbParams(args []interface{}, index int) ([]interface{}, error) {
+	var err error
+	var list []interface{}
+
+	if len(args) <= index || args[index] == nil {
+		return nil, nil
+	}
+
+	if list, err = bf.AssertListParam(index+1, args[index]); err != nil {
+		return nil, err
+	}
+
+	params := make([]interface{}, len(list))
+
+	for i, p := range list {
+		switch v := p.(type) {
+		case float64:
+
+			// Integer numbers are bound as integers
+
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				params[i] = int64(v)
+			} else {
+				params[i] = v
+			}
+
+		case map[interface{}]interface{}, []interface{}:
+			var data []byte
+
+			if data, err = json.Marshal(scope.ConvertECALToJSONObject(v)); err != nil {
+				return nil, fmt.Errorf("Query parameter %v cannot be converted to JSON: %v", i+1, err)
+			}
+
+			params[i] = string(data)
+
+		default:
+			params[i] = v
+		}
+	}
+
+	return params, nil
+}
+
+/*
+dbValue converts a value which was read from a database into an ECAL value.
+*/
+func dbValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case []byte:
+		return string(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		return timeToTimestamp(v)
+	}
+
+	return val
+}
+
+// open
+// ====
+
+/*
+dbOpenFunc opens a database connection.
+*/
+type dbOpenFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *dbOpenFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a database name")
+
+	if err == nil {
+		name := fmt.Sprint(args[0])
+		provider, ok := is["erp"].(util.ECALDatabaseProvider)
+
+		var driver, dsn string
+
+		if ok {
+			driver, dsn, ok = provider.GetDatabase(name)
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("Unknown database: %v", name)
+		}
+
+		var db *sql.DB
+
+		if db, err = sql.Open(driver, dsn); err == nil {
+			if err = db.Ping(); err == nil {
+				res = addHandle("db", db)
+			} else {
+				db.Close()
+			}
+		}
+
+		if err != nil {
+			err = fmt.Errorf("Could not open database %v: %v", name, err)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *dbOpenFunc) DocString() (string, error) {
+	return "Opens a connection to a configured database and returns a connection handle.", nil
+}
+
+// query
+// =====
+
+/*
+dbQueryFunc runs a query which returns rows.
+*/
+type dbQueryFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *dbQueryFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var db *sql.DB
+	var params []interface{}
+
+	err := f.AssertMinParams(args, 2, "a connection and a query")
+
+	if err == nil {
+		if db, err = f.AssertDBParam(1, args[0]); err == nil {
+			params, err = f.dbParams(args, 2)
+		}
+	}
+
+	if err == nil {
+		var rows *sql.Rows
+
+		if rows, err = db.Query(fmt.Sprint(args[1]), params...); err == nil {
+			defer rows.Close()
+
+			var cols []string
+
+			if cols, err = rows.Columns(); err == nil {
+				result := make([]interface{}, 0)
+
+				for err == nil && rows.Next() {
+					vals := make([]interface{}, len(cols))
+					ptrs := make([]interface{}, len(cols))
+
+					for i := range vals {
+						ptrs[i] = &vals[i]
+					}
+
+					if err = rows.Scan(ptrs...); err == nil {
+						row := make(map[interface{}]interface{}, len(cols))
+
+						for i, col := range cols {
+							row[col] = dbValue(vals[i])
+						}
+
+						result = append(result, row)
+					}
+				}
+
+				if err == nil {
+					err = rows.Err()
+				}
+
+				res = result
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Could not run query: %v", err)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *dbQueryFunc) DocString() (string, error) {
+	return "Runs a query with optional parameters and returns all rows as a list of maps.", nil
+}
+
+// exec
+// ====
+
+/*
+dbExecFunc runs a statement which does not return rows.
+*/
+type dbExecFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *dbExecFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var db *sql.DB
+	var params []interface{}
+
+	err := f.AssertMinParams(args, 2, "a connection and a statement")
+
+	if err == nil {
+		if db, err = f.AssertDBParam(1, args[0]); err == nil {
+			params, err = f.dbParams(args, 2)
+		}
+	}
+
+	if err == nil {
+		var result sql.Result
+
+		if result, err = db.Exec(fmt.Sprint(args[1]), params...); err == nil {
+			var rowsAffected, lastInsertID interface{}
+
+			// Not all drivers support both values
+
+			if n, err := result.RowsAffected(); err == nil {
+				rowsAffected = float64(n)
+			}
+			if n, err := result.LastInsertId(); err == nil {
+				lastInsertID = float64(n)
+			}
+
+			res = map[interface{}]interface{}{
+				"rowsAffected": rowsAffected,
+				"lastInsertId": lastInsertID,
+			}
+
+		} else {
+
+			err = fmt.Errorf("Could not run statement: %v", err)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *dbExecFunc) DocString() (string, error) {
+	return "Runs a statement with optional parameters which does not return rows.", nil
+}
+
+// close
+// =====
+
+/*
+dbCloseFunc closes a database connection.
+*/
+type dbCloseFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *dbCloseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 1, "a connection")
+
+	if err == nil {
+		var db *sql.DB
+
+		if db, err = f.AssertDBParam(1, args[0]); err == nil {
+			removeHandle(args[0])
+			err = db.Close()
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *dbCloseFunc) DocString() (string, error) {
+	return "Closes a database connection.", nil
+}
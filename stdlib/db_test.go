@@ -0,0 +1,225 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+testDBDriver is a database driver which returns its query parameters as rows.
+*/
+type testDBDriver struct {
+}
+
+func (d *testDBDriver) Open(dsn string) (driver.Conn, error) {
+	if dsn == "fail" {
+		return nil, fmt.Errorf("Cannot connect")
+	}
+	return &testDBConn{}, nil
+}
+
+type testDBConn struct {
+}
+
+func (c *testDBConn) Prepare(query string) (driver.Stmt, error) {
+	if strings.Contains(query, "invalid") {
+		return nil, fmt.Errorf("Syntax error")
+	}
+	return &testDBStmt{query}, nil
+}
+
+func (c *testDBConn) Close() error {
+	return nil
+}
+
+func (c *testDBConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("Not supported")
+}
+
+type testDBStmt struct {
+	query string
+}
+
+func (s *testDBStmt) Close() error {
+	return nil
+}
+
+func (s *testDBStmt) NumInput() int {
+	return -1
+}
+
+func (s *testDBStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s *testDBStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &testDBRows{args, 0}, nil
+}
+
+type testDBRows struct {
+	args []driver.Value
+	pos  int
+}
+
+func (r *testDBRows) Columns() []string {
+	return []string{"idx", "value", "type", "raw", "created"}
+}
+
+func (r *testDBRows) Close() error {
+	return nil
+}
+
+func (r *testDBRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.args) {
+		return io.EOF
+	}
+
+	dest[0] = int64(r.pos)
+	dest[1] = r.args[r.pos]
+	dest[2] = fmt.Sprintf("%T", r.args[r.pos])
+	dest[3] = []byte("raw")
+	dest[4] = time.Unix(1608804672, 0)
+
+	r.pos++
+
+	return nil
+}
+
+func init() {
+	sql.Register("ecaltest", &testDBDriver{})
+}
+
+type testDatabaseProvider struct {
+}
+
+func (p *testDatabaseProvider) GetDatabase(name string) (string, string, bool) {
+	if name == "unknown" {
+		return "", "", false
+	}
+	return "ecaltest", name, true
+}
+
+func runDBFunc(erp interface{}, name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("db." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, map[string]interface{}{"erp": erp}, 0, args)
+}
+
+func TestDB(t *testing.T) {
+	erp := &testDatabaseProvider{}
+
+	conn, err := runDBFunc(erp, "open", "main")
+
+	if err != nil || !strings.HasPrefix(fmt.Sprint(conn), "db-") {
+		t.Error("Unexpected result:", conn, err)
+		return
+	}
+
+	res, err := runDBFunc(erp, "query", conn, "SELECT * FROM foo WHERE a = ? AND b = ?", []interface{}{
+		float64(1), 1.5, "foo", true, nil, map[interface{}]interface{}{"a": []interface{}{float64(1)}}})
+
+	if err != nil || fmt.Sprint(res) != "[map[created:1.608804672e+09 idx:0 raw:raw type:int64 value:1] "+
+		"map[created:1.608804672e+09 idx:1 raw:raw type:float64 value:1.5] "+
+		"map[created:1.608804672e+09 idx:2 raw:raw type:string value:foo] "+
+		"map[created:1.608804672e+09 idx:3 raw:raw type:bool value:true] "+
+		"map[created:1.608804672e+09 idx:4 raw:raw type:<nil> value:<nil>] "+
+		`map[created:1.608804672e+09 idx:5 raw:raw type:string value:{"a":[1]}]]` {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if row := res.([]interface{})[0].(map[interface{}]interface{}); row["idx"] != float64(0) || row["value"] != float64(1) {
+		t.Error("Unexpected result:", row)
+		return
+	}
+
+	if res, err = runDBFunc(erp, "query", conn, "SELECT * FROM foo"); err != nil || fmt.Sprint(res) != "[]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err = runDBFunc(erp, "exec", conn, "UPDATE foo SET a = ?", []interface{}{"x"}); err != nil ||
+		fmt.Sprint(res) != "map[lastInsertId:<nil> rowsAffected:1]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = runDBFunc(erp, "query", conn, "invalid"); err == nil || err.Error() != "Could not run query: Syntax error" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runDBFunc(erp, "exec", conn, "invalid"); err == nil || err.Error() != "Could not run statement: Syntax error" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runDBFunc(erp, "exec", conn, "foo", "bar"); err == nil || err.Error() != "Parameter 3 should be a list" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runDBFunc(erp, "query", conn); err == nil || err.Error() != "Need a connection and a query as parameters" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runDBFunc(erp, "close", conn); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runDBFunc(erp, "query", conn, "SELECT 1"); err == nil || err.Error() != "Parameter 1 should be an open database connection" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runDBFunc(erp, "close", conn); err == nil || err.Error() != "Parameter 1 should be an open database connection" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runDBFunc(erp, "open", "unknown"); err == nil || err.Error() != "Unknown database: unknown" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runDBFunc(nil, "open", "main"); err == nil || err.Error() != "Unknown database: main" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runDBFunc(erp, "open", "fail"); err == nil || err.Error() != "Could not open database fail: Cannot connect" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runDBFunc(erp, "open"); err == nil || err.Error() != "Need a database name as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for name, f := range dbFuncMap {
+		if res, _ := f.DocString(); res == "" {
+			t.Error("Unexpected result:", name, res)
+			return
+		}
+	}
+}
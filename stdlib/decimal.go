@@ -0,0 +1,317 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+decimalFuncMap contains all functions of the decimal package.
+*/
+var decimalFuncMap = map[string]util.ECALFunction{
+	"add":      &decimalArithFunc{&baseFunc{}, "add"},
+	"sub":      &decimalArithFunc{&baseFunc{}, "sub"},
+	"mul":      &decimalArithFunc{&baseFunc{}, "mul"},
+	"div":      &decimalArithFunc{&baseFunc{}, "div"},
+	"round":    &decimalRoundFunc{&baseFunc{}},
+	"cmp":      &decimalCmpFunc{&baseFunc{}},
+	"toNumber": &decimalToNumberFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("decimal", "Fixed-point decimal arithmetic. Decimals are strings.", decimalFuncMap)
+}
+
+/*
+decimalPattern matches a valid decimal number.
+*/
+var decimalPattern = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+/*
+decimalParam converts a parameter into an exact rational number. Returns also
+the scale (number of digits after the decimal point) of the parameter. Numbers
+are converted with the shortest representation which identifies them (e.g.
+0.1 is 0.1 and not 0.1000000000000000055511151231257827).
+*/
+func decimalParam(index int, val interface{}) (*big.Rat, int, error) {
+	var s string
+
+	if f, ok := val.(float64); ok {
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	} else {
+		s = strings.TrimSpace(fmt.Sprint(val))
+	}
+
+	if !decimalPattern.MatchString(s) {
+		return nil, 0, fmt.Errorf("Parameter %v should be a decimal number", index)
+	}
+
+	scale := 0
+	if i := strings.Index(s, "."); i != -1 {
+		scale = len(s) - i - 1
+	}
+
+	r, _ := new(big.Rat).SetString(s)
+
+	return r, scale, nil
+}
+
+/*
+scaleParam converts a parameter into a scale.
+*/
+func scaleParam(index int, val interface{}) (int, error) {
+	s, ok := val.(float64)
+
+	if !ok || s < 0 || s != float64(int(s)) {
+		return 0, fmt.Errorf("Parameter %v should be a non-negative integer", index)
+	}
+
+	return int(s), nil
+}
+
+/*
+formatDecimal rounds a rational number to a given scale and returns it as a
+string. Values are rounded half away from zero (e.g. 0.125 becomes 0.13 and
+-0.125 becomes -0.13 with a scale of 2).
+*/
+func formatDecimal(r *big.Rat, scale int) string {
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(factor))
+
+	num := new(big.Int).Abs(scaled.Num())
+	quo, rem := new(big.Int).QuoRem(num, scaled.Denom(), new(big.Int))
+
+	if rem.Mul(rem, big.NewInt(2)).Cmp(scaled.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+
+	digits := quo.String()
+
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+
+	if scaled.Sign() < 0 && quo.Sign() != 0 {
+		digits = "-" + digits
+	}
+
+	return digits
+}
+
+// add, sub, mul, div
+// ==================
+
+/*
+decimalArithFunc implements the arithmetic functions of the decimal package.
+*/
+type decimalArithFunc struct {
+	*baseFunc
+	op string
+}
+
+/*
+Run executes this function.
+*/
+func (f *decimalArithFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var a, b *big.Rat
+	var scaleA, scaleB, scale int
+	var err error
+
+	if f.op == "div" {
+		err = f.AssertMinParams(args, 3, "two decimal numbers and a scale")
+	} else {
+		err = f.AssertMinParams(args, 2, "two decimal numbers")
+	}
+
+	if err == nil {
+		if a, scaleA, err = decimalParam(1, args[0]); err == nil {
+			if b, scaleB, err = decimalParam(2, args[1]); err == nil {
+
+				// By default the result has as many digits after the decimal
+				// point as needed to be exact
+
+				if scale = scaleA; scaleB > scaleA {
+					scale = scaleB
+				}
+
+				if f.op == "mul" {
+					scale = scaleA + scaleB
+				}
+
+				if len(args) > 2 {
+					scale, err = scaleParam(3, args[2])
+				}
+
+				if err == nil {
+					r := new(big.Rat)
+
+					switch f.op {
+					case "add":
+						r.Add(a, b)
+					case "sub":
+						r.Sub(a, b)
+					case "mul":
+						r.Mul(a, b)
+					case "div":
+						if b.Sign() == 0 {
+							err = fmt.Errorf("Division by zero")
+						} else {
+							r.Quo(a, b)
+						}
+					}
+
+					if err == nil {
+						res = formatDecimal(r, scale)
+					}
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *decimalArithFunc) DocString() (string, error) {
+	switch f.op {
+	case "add":
+		return "Adds two decimal numbers. An optional scale sets the digits after the decimal point.", nil
+	case "sub":
+		return "Subtracts two decimal numbers. An optional scale sets the digits after the decimal point.", nil
+	case "mul":
+		return "Multiplies two decimal numbers. An optional scale sets the digits after the decimal point.", nil
+	}
+	return "Divides two decimal numbers and rounds the result to a given scale.", nil
+}
+
+// round
+// =====
+
+/*
+decimalRoundFunc rounds a decimal number.
+*/
+type decimalRoundFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *decimalRoundFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var r *big.Rat
+	var scale int
+
+	err := f.AssertMinParams(args, 2, "a decimal number and a scale")
+
+	if err == nil {
+		if r, _, err = decimalParam(1, args[0]); err == nil {
+			if scale, err = scaleParam(2, args[1]); err == nil {
+				res = formatDecimal(r, scale)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *decimalRoundFunc) DocString() (string, error) {
+	return "Rounds a decimal number or a number half away from zero to a given scale.", nil
+}
+
+// cmp
+// ===
+
+/*
+decimalCmpFunc compares two decimal numbers.
+*/
+type decimalCmpFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *decimalCmpFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var a, b *big.Rat
+
+	err := f.AssertMinParams(args, 2, "two decimal numbers")
+
+	if err == nil {
+		if a, _, err = decimalParam(1, args[0]); err == nil {
+			if b, _, err = decimalParam(2, args[1]); err == nil {
+				res = float64(a.Cmp(b))
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *decimalCmpFunc) DocString() (string, error) {
+	return "Compares two decimal numbers and returns -1, 0 or 1.", nil
+}
+
+// toNumber
+// ========
+
+/*
+decimalToNumberFunc converts a decimal number into a number.
+*/
+type decimalToNumberFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *decimalToNumberFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var r *big.Rat
+
+	err := f.AssertMinParams(args, 1, "a decimal number")
+
+	if err == nil {
+		if r, _, err = decimalParam(1, args[0]); err == nil {
+			res, _ = r.Float64()
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *decimalToNumberFunc) DocString() (string, error) {
+	return "Converts a decimal number into a (floating point) number.", nil
+}
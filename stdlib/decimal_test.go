@@ -0,0 +1,98 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"testing"
+)
+
+func runDecimalFunc(name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("decimal." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, nil, 0, args)
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+
+	a, b := 0.1, 0.2
+
+	if res := a + b; fmt.Sprint(res) != "0.30000000000000004" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	for _, test := range []struct {
+		name string
+		args []interface{}
+		res  interface{}
+	}{
+		{"add", []interface{}{0.1, 0.2}, "0.3"},
+		{"add", []interface{}{"0.10", 0.2}, "0.30"},
+		{"add", []interface{}{"19.99", "0.01", 0.}, "20"},
+		{"add", []interface{}{1., 2., 2.}, "3.00"},
+		{"sub", []interface{}{0.3, 0.1}, "0.2"},
+		{"sub", []interface{}{"1", "1.005"}, "-0.005"},
+		{"sub", []interface{}{"1", "1.005", 2.}, "-0.01"},
+		{"sub", []interface{}{"1", "1.004", 2.}, "0.00"},
+		{"mul", []interface{}{"1.10", 3.}, "3.30"},
+		{"mul", []interface{}{"19.99", "0.19", 2.}, "3.80"},
+		{"mul", []interface{}{1.15, 1.15}, "1.3225"},
+		{"div", []interface{}{10., 3., 2.}, "3.33"},
+		{"div", []interface{}{-2., 3., 4.}, "-0.6667"},
+		{"div", []interface{}{"1", 8., 0.}, "0"},
+		{"div", []interface{}{"1", 2., 0.}, "1"},
+		{"round", []interface{}{2.675, 2.}, "2.68"},
+		{"round", []interface{}{"-0.125", 2.}, "-0.13"},
+		{"round", []interface{}{0.5, 0.}, "1"},
+		{"round", []interface{}{12., 2.}, "12.00"},
+		{"round", []interface{}{"0.0004", 3.}, "0.000"},
+		{"round", []interface{}{" +7.5 ", 0.}, "8"},
+		{"cmp", []interface{}{"0.30", a + b}, -1.},
+		{"cmp", []interface{}{"0.30", "0.3"}, 0.},
+		{"cmp", []interface{}{1., "-1"}, 1.},
+		{"toNumber", []interface{}{"0.30"}, 0.3},
+		{"toNumber", []interface{}{"-12"}, -12.},
+	} {
+		if res, err := runDecimalFunc(test.name, test.args...); err != nil || res != test.res {
+			t.Error("Unexpected result:", test.name, test.args, res, err)
+			return
+		}
+	}
+}
+
+func TestDecimalErrors(t *testing.T) {
+
+	for _, test := range []struct {
+		name string
+		args []interface{}
+		err  string
+	}{
+		{"add", []interface{}{1.}, "Need two decimal numbers as parameters"},
+		{"div", []interface{}{1., 2.}, "Need two decimal numbers and a scale as parameters"},
+		{"round", []interface{}{1.}, "Need a decimal number and a scale as parameters"},
+		{"toNumber", []interface{}{}, "Need a decimal number as parameter"},
+		{"add", []interface{}{"1,5", 1.}, "Parameter 1 should be a decimal number"},
+		{"sub", []interface{}{1., "1e3"}, "Parameter 2 should be a decimal number"},
+		{"mul", []interface{}{1., 1., -1.}, "Parameter 3 should be a non-negative integer"},
+		{"round", []interface{}{1., 1.5}, "Parameter 2 should be a non-negative integer"},
+		{"div", []interface{}{1., "0.00", 2.}, "Division by zero"},
+		{"cmp", []interface{}{"a", 1.}, "Parameter 1 should be a decimal number"},
+		{"toNumber", []interface{}{nil}, "Parameter 1 should be a decimal number"},
+	} {
+		if res, err := runDecimalFunc(test.name, test.args...); err == nil || err.Error() != test.err {
+			t.Error("Unexpected result:", test.name, test.args, res, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,330 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+fileFuncMap contains all functions of the file package.
+*/
+var fileFuncMap = map[string]util.ECALFunction{
+	"readFile":   &fileReadFunc{&baseFunc{}},
+	"writeFile":  &fileWriteFunc{&baseFunc{}, false},
+	"appendFile": &fileWriteFunc{&baseFunc{}, true},
+	"list":       &fileListFunc{&baseFunc{}},
+	"stat":       &fileStatFunc{&baseFunc{}},
+	"remove":     &fileRemoveFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("file", "File system functions which are confined to the root directory of the interpreter.", fileFuncMap)
+}
+
+/*
+AssertPathParam converts a general interface{} parameter into an absolute file
+path inside the file root of the runtime provider.
+*/
+func (bf *baseFunc) AssertPathParam(is map[string]interface{}, val interface{}) (string, error) {
+	var root string
+
+	if sandbox, ok := is["erp"].(util.ECALFileSandbox); ok {
+		root = sandbox.GetFileRoot()
+	}
+
+	if root == "" {
+		return "", fmt.Errorf("File operations are not allowed (no file root directory)")
+	}
+
+	var path, realRoot, realPath string
+
+	root, err := filepath.Abs(root)
+
+	if err == nil {
+		realRoot, err = filepath.EvalSymlinks(root)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("Invalid file root %v: %v", root, err)
+	}
+
+	path = filepath.Join(root, filepath.Clean(string(filepath.Separator)+fmt.Sprint(val)))
+
+	// Resolve symlinks of the path or its parent directory so links
+	// cannot point outside of the root directory
+
+	if realPath, err = filepath.EvalSymlinks(path); err != nil {
+		var info os.FileInfo
+
+		if info, err = os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+
+			// A dangling link would be followed when the file is created
+
+			err = fmt.Errorf("dangling symbolic link")
+
+		} else if realPath, err = filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+			realPath = filepath.Join(realPath, filepath.Base(path))
+		}
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("Invalid path %v: %v", val, err)
+	}
+
+	if ok, _ := util.IsSubpath(realRoot, realPath); !ok {
+		return "", fmt.Errorf("Path is outside of file root: %v", val)
+	}
+
+	return path, nil
+}
+
+// readFile
+// ========
+
+/*
+fileReadFunc reads the contents of a file.
+*/
+type fileReadFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *fileReadFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a file path")
+
+	if err == nil {
+		var path string
+
+		if path, err = f.AssertPathParam(is, args[0]); err == nil {
+			var b []byte
+
+			if b, err = ioutil.ReadFile(path); err == nil {
+				if len(args) > 1 && args[1] == true {
+					res = b
+				} else {
+					res = string(b)
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *fileReadFunc) DocString() (string, error) {
+	return "Reads the contents of a file as a string (or as bytes if the binary flag is set).", nil
+}
+
+// writeFile / appendFile
+// ======================
+
+/*
+fileWriteFunc writes a string into a file.
+*/
+type fileWriteFunc struct {
+	*baseFunc
+	append bool
+}
+
+/*
+Run executes this function.
+*/
+func (f *fileWriteFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 2, "a file path and a content string")
+
+	if err == nil {
+		var path string
+
+		if path, err = f.AssertPathParam(is, args[0]); err == nil {
+			var file *os.File
+
+			flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if f.append {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			}
+
+			if file, err = os.OpenFile(path, flags, 0644); err == nil {
+				_, err = file.Write(bytesParam(args[1]))
+
+				if cerr := file.Close(); err == nil {
+					err = cerr
+				}
+			}
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *fileWriteFunc) DocString() (string, error) {
+	if f.append {
+		return "Appends a string to a file. The file is created if it does not exist.", nil
+	}
+	return "Writes a string into a file. An existing file is overwritten.", nil
+}
+
+// list
+// ====
+
+/*
+fileListFunc lists the contents of a directory.
+*/
+type fileListFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *fileListFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	dir := interface{}("")
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	path, err := f.AssertPathParam(is, dir)
+
+	if err == nil {
+		var infos []os.FileInfo
+
+		if infos, err = ioutil.ReadDir(path); err == nil {
+			names := make([]interface{}, 0, len(infos))
+
+			for _, info := range infos {
+				names = append(names, info.Name())
+			}
+
+			res = names
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *fileListFunc) DocString() (string, error) {
+	return "Lists the names of all entries in a directory (default is the root directory).", nil
+}
+
+// stat
+// ====
+
+/*
+fileStatFunc returns information about a file.
+*/
+type fileStatFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *fileStatFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a file path")
+
+	if err == nil {
+		var path string
+
+		if path, err = f.AssertPathParam(is, args[0]); err == nil {
+			var info os.FileInfo
+
+			if info, err = os.Stat(path); err == nil {
+				res = map[interface{}]interface{}{
+					"name":    info.Name(),
+					"size":    float64(info.Size()),
+					"isDir":   info.IsDir(),
+					"mode":    info.Mode().String(),
+					"modTime": timeToTimestamp(info.ModTime()),
+				}
+			} else if os.IsNotExist(err) {
+				res, err = nil, nil
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *fileStatFunc) DocString() (string, error) {
+	return "Returns information about a file or null if the file does not exist.", nil
+}
+
+// remove
+// ======
+
+/*
+fileRemoveFunc removes a file or directory.
+*/
+type fileRemoveFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *fileRemoveFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 1, "a file path")
+
+	if err == nil {
+		var path string
+
+		if path, err = f.AssertPathParam(is, args[0]); err == nil {
+			var root string
+
+			if root, err = f.AssertPathParam(is, ""); err == nil && root == path {
+				err = fmt.Errorf("Cannot remove file root")
+			}
+
+			if err == nil {
+				if len(args) > 1 && args[1] == true {
+					err = os.RemoveAll(path)
+				} else {
+					err = os.Remove(path)
+				}
+			}
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *fileRemoveFunc) DocString() (string, error) {
+	return "Removes a file or an empty directory. Non-empty directories are removed if the recursive flag is set.", nil
+}
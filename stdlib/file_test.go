@@ -0,0 +1,227 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testFileSandbox struct {
+	root string
+}
+
+func (s *testFileSandbox) GetFileRoot() string {
+	return s.root
+}
+
+func runFileFunc(root string, name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("file." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, map[string]interface{}{"erp": &testFileSandbox{root}}, 0, args)
+}
+
+func TestFileOperations(t *testing.T) {
+	root, err := ioutil.TempDir("", "ecalfiletest")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(root)
+
+	if _, err := runFileFunc(root, "writeFile", "foo.txt", "hello"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "appendFile", "/foo.txt", 123); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runFileFunc(root, "readFile", "foo.txt"); err != nil || res != "hello123" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "writeFile", "foo.txt", "bar"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runFileFunc(root, "readFile", "foo.txt"); err != nil || res != "bar" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "writeFile", "foo.bin", []byte{0, 1, 255}); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runFileFunc(root, "readFile", "foo.bin", true); err != nil || fmt.Sprint(res) != "[0 1 255]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "remove", "foo.bin"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	os.Mkdir(filepath.Join(root, "sub"), 0755)
+	runFileFunc(root, "writeFile", "sub/a.txt", "a")
+
+	if res, err := runFileFunc(root, "list"); err != nil || fmt.Sprint(res) != "[foo.txt sub]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := runFileFunc(root, "list", "sub"); err != nil || fmt.Sprint(res) != "[a.txt]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err := runFileFunc(root, "stat", "foo.txt")
+	if m, ok := res.(map[interface{}]interface{}); err != nil || !ok ||
+		m["name"] != "foo.txt" || m["size"] != float64(3) || m["isDir"] != false {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := runFileFunc(root, "stat", "bar.txt"); err != nil || res != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "remove", "sub"); err == nil {
+		t.Error("Non-empty directory should not be removed")
+		return
+	}
+
+	if _, err := runFileFunc(root, "remove", "sub", true); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "remove", "foo.txt"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runFileFunc(root, "list", ""); err != nil || fmt.Sprint(res) != "[]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "readFile", "foo.txt"); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for name, f := range fileFuncMap {
+		if doc, err := f.DocString(); doc == "" || err != nil {
+			t.Error("Missing docstring for:", name)
+			return
+		}
+	}
+}
+
+func TestFileSandbox(t *testing.T) {
+	root, err := ioutil.TempDir("", "ecalfiletest")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(root)
+
+	outside, err := ioutil.TempDir("", "ecalfiletestoutside")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(outside)
+
+	// Paths are always relative to the root
+
+	if _, err := runFileFunc(root, "writeFile", "../../foo.txt", "x"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runFileFunc(root, "list"); err != nil || fmt.Sprint(res) != "[foo.txt]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Links must not lead outside of the root
+
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "writeFile", "link/foo.txt", "x"); err == nil ||
+		err.Error() != "Path is outside of file root: link/foo.txt" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := os.Symlink(filepath.Join(outside, "new.txt"), filepath.Join(root, "dangling")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "writeFile", "dangling", "x"); err == nil ||
+		err.Error() != "Invalid path dangling: dangling symbolic link" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !os.IsNotExist(err) {
+		t.Error("File outside of the root should not exist:", err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "remove", "/"); err == nil || err.Error() != "Cannot remove file root" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "readFile", "a/b/c"); err == nil ||
+		!strings.HasPrefix(err.Error(), "Invalid path a/b/c") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runFileFunc("", "readFile", "foo.txt"); err == nil ||
+		err.Error() != "File operations are not allowed (no file root directory)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runFileFunc(filepath.Join(root, "xxx"), "readFile", "foo.txt"); err == nil ||
+		!strings.HasPrefix(err.Error(), "Invalid file root") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runFileFunc(root, "readFile"); err == nil || err.Error() != "Need a file path as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,352 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+graphFuncMap contains all functions of the graph package.
+*/
+var graphFuncMap = map[string]util.ECALFunction{
+	"query":      &graphQueryFunc{&baseFunc{}},
+	"fetchNode":  &graphFetchNodeFunc{&baseFunc{}},
+	"storeNode":  &graphStoreNodeFunc{&baseFunc{}},
+	"removeNode": &graphRemoveNodeFunc{&baseFunc{}},
+	"storeEdge":  &graphStoreEdgeFunc{&baseFunc{}},
+	"removeEdge": &graphRemoveEdgeFunc{&baseFunc{}},
+	"traverse":   &graphTraverseFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("graph", "Access to a graph database (e.g. EliasDB) provided by the embedder.", graphFuncMap)
+}
+
+/*
+graphNodeAttrs are the attributes which are required for a node.
+*/
+var graphNodeAttrs = []string{"key", "kind"}
+
+/*
+graphEdgeAttrs are the attributes which are required for an edge.
+*/
+var graphEdgeAttrs = []string{"key", "kind", "end1key", "end1kind", "end2key", "end2kind"}
+
+/*
+graphStore returns the graph store of the runtime provider.
+*/
+func graphStore(is map[string]interface{}) (util.ECALGraphStore, error) {
+	if gp, ok := is["erp"].(util.ECALGraphProvider); ok {
+		if gs := gp.GetGraphStore(); gs != nil {
+			return gs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No graph store available")
+}
+
+/*
+AssertGraphDataParam converts a general interface{} parameter into a node or
+an edge which has all required attributes.
+*/
+func (bf *baseFunc) AssertGraphDataParam(index int, val interface{}, attrs []string) (map[string]interface{}, error) {
+	m, err := bf.AssertMapParam(index, val)
+
+	if err == nil {
+		data := scope.ConvertECALToJSONObject(m).(map[string]interface{})
+
+		for _, attr := range attrs {
+			if v, ok := data[attr]; !ok || v == nil || v == "" {
+				return nil, fmt.Errorf("Parameter %v should have a %v attribute", index, attr)
+			}
+		}
+
+		return data, nil
+	}
+
+	return nil, err
+}
+
+// query
+// =====
+
+/*
+graphQueryFunc runs a graph query.
+*/
+type graphQueryFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *graphQueryFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var gs util.ECALGraphStore
+
+	err := f.AssertMinParams(args, 2, "a partition and a query")
+
+	if err == nil {
+		if gs, err = graphStore(is); err == nil {
+			if res, err = gs.Query(fmt.Sprint(args[0]), fmt.Sprint(args[1])); err == nil {
+				res = scope.ConvertJSONToECALObject(res)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *graphQueryFunc) DocString() (string, error) {
+	return "Runs a query in a partition of the graph database.", nil
+}
+
+// fetchNode
+// =========
+
+/*
+graphFetchNodeFunc fetches a node.
+*/
+type graphFetchNodeFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *graphFetchNodeFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var gs util.ECALGraphStore
+
+	err := f.AssertMinParams(args, 3, "a partition, a node key and a node kind")
+
+	if err == nil {
+		if gs, err = graphStore(is); err == nil {
+			var node map[string]interface{}
+
+			if node, err = gs.FetchNode(fmt.Sprint(args[0]), fmt.Sprint(args[1]), fmt.Sprint(args[2])); err == nil && node != nil {
+				res = scope.ConvertJSONToECALObject(node)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *graphFetchNodeFunc) DocString() (string, error) {
+	return "Fetches a node from the graph database (null if the node does not exist).", nil
+}
+
+// storeNode
+// =========
+
+/*
+graphStoreNodeFunc stores a node.
+*/
+type graphStoreNodeFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *graphStoreNodeFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var gs util.ECALGraphStore
+
+	err := f.AssertMinParams(args, 2, "a partition and a node")
+
+	if err == nil {
+		if gs, err = graphStore(is); err == nil {
+			var node map[string]interface{}
+
+			if node, err = f.AssertGraphDataParam(2, args[1], graphNodeAttrs); err == nil {
+				err = gs.StoreNode(fmt.Sprint(args[0]), node)
+			}
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *graphStoreNodeFunc) DocString() (string, error) {
+	return "Stores a node in the graph database.", nil
+}
+
+// removeNode
+// ==========
+
+/*
+graphRemoveNodeFunc removes a node.
+*/
+type graphRemoveNodeFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *graphRemoveNodeFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var gs util.ECALGraphStore
+
+	err := f.AssertMinParams(args, 3, "a partition, a node key and a node kind")
+
+	if err == nil {
+		if gs, err = graphStore(is); err == nil {
+			err = gs.RemoveNode(fmt.Sprint(args[0]), fmt.Sprint(args[1]), fmt.Sprint(args[2]))
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *graphRemoveNodeFunc) DocString() (string, error) {
+	return "Removes a node and all its edges from the graph database.", nil
+}
+
+// storeEdge
+// =========
+
+/*
+graphStoreEdgeFunc stores an edge.
+*/
+type graphStoreEdgeFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *graphStoreEdgeFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var gs util.ECALGraphStore
+
+	err := f.AssertMinParams(args, 2, "a partition and an edge")
+
+	if err == nil {
+		if gs, err = graphStore(is); err == nil {
+			var edge map[string]interface{}
+
+			if edge, err = f.AssertGraphDataParam(2, args[1], graphEdgeAttrs); err == nil {
+				err = gs.StoreEdge(fmt.Sprint(args[0]), edge)
+			}
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *graphStoreEdgeFunc) DocString() (string, error) {
+	return "Stores an edge between two nodes in the graph database.", nil
+}
+
+// removeEdge
+// ==========
+
+/*
+graphRemoveEdgeFunc removes an edge.
+*/
+type graphRemoveEdgeFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *graphRemoveEdgeFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var gs util.ECALGraphStore
+
+	err := f.AssertMinParams(args, 3, "a partition, an edge key and an edge kind")
+
+	if err == nil {
+		if gs, err = graphStore(is); err == nil {
+			err = gs.RemoveEdge(fmt.Sprint(args[0]), fmt.Sprint(args[1]), fmt.Sprint(args[2]))
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *graphRemoveEdgeFunc) DocString() (string, error) {
+	return "Removes an edge from the graph database.", nil
+}
+
+// traverse
+// ========
+
+/*
+graphTraverseFunc follows the edges of a node.
+*/
+type graphTraverseFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *graphTraverseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var gs util.ECALGraphStore
+
+	err := f.AssertMinParams(args, 4, "a partition, a node key, a node kind and a traversal spec")
+
+	if err == nil {
+		if gs, err = graphStore(is); err == nil {
+			var nodes, edges []map[string]interface{}
+
+			if nodes, edges, err = gs.Traverse(fmt.Sprint(args[0]), fmt.Sprint(args[1]),
+				fmt.Sprint(args[2]), fmt.Sprint(args[3])); err == nil {
+
+				if nodes == nil {
+					nodes = []map[string]interface{}{}
+				}
+				if edges == nil {
+					edges = []map[string]interface{}{}
+				}
+
+				res = map[interface{}]interface{}{
+					"nodes": scope.ConvertJSONToECALObject(nodes),
+					"edges": scope.ConvertJSONToECALObject(edges),
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *graphTraverseFunc) DocString() (string, error) {
+	return "Follows the edges of a node and returns the found nodes and traversed edges.", nil
+}
@@ -0,0 +1,208 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/krotik/ecal/util"
+)
+
+/*
+testGraphStore is a simple in-memory graph store.
+*/
+type testGraphStore struct {
+	nodes map[string]map[string]interface{}
+	edges map[string]map[string]interface{}
+}
+
+func newTestGraphStore() *testGraphStore {
+	return &testGraphStore{make(map[string]map[string]interface{}), make(map[string]map[string]interface{})}
+}
+
+func (gs *testGraphStore) Query(partition string, query string) (interface{}, error) {
+	if query == "fail" {
+		return nil, fmt.Errorf("Invalid query")
+	}
+	return map[string]interface{}{"partition": partition, "rows": []interface{}{len(gs.nodes)}}, nil
+}
+
+func (gs *testGraphStore) FetchNode(partition string, key string, kind string) (map[string]interface{}, error) {
+	return gs.nodes[partition+key+kind], nil
+}
+
+func (gs *testGraphStore) StoreNode(partition string, node map[string]interface{}) error {
+	gs.nodes[fmt.Sprint(partition, node["key"], node["kind"])] = node
+	return nil
+}
+
+func (gs *testGraphStore) RemoveNode(partition string, key string, kind string) error {
+	if _, ok := gs.nodes[partition+key+kind]; !ok {
+		return fmt.Errorf("Node does not exist")
+	}
+	delete(gs.nodes, partition+key+kind)
+	return nil
+}
+
+func (gs *testGraphStore) StoreEdge(partition string, edge map[string]interface{}) error {
+	gs.edges[fmt.Sprint(partition, edge["key"], edge["kind"])] = edge
+	return nil
+}
+
+func (gs *testGraphStore) RemoveEdge(partition string, key string, kind string) error {
+	delete(gs.edges, partition+key+kind)
+	return nil
+}
+
+func (gs *testGraphStore) Traverse(partition string, key string, kind string, spec string) ([]map[string]interface{}, []map[string]interface{}, error) {
+	var nodes, edges []map[string]interface{}
+
+	for _, e := range gs.edges {
+		if e["end1key"] == key && e["end1kind"] == kind {
+			edges = append(edges, e)
+			nodes = append(nodes, gs.nodes[fmt.Sprint(partition, e["end2key"], e["end2kind"])])
+		}
+	}
+
+	return nodes, edges, nil
+}
+
+type testGraphProvider struct {
+	gs util.ECALGraphStore
+}
+
+func (p *testGraphProvider) GetGraphStore() util.ECALGraphStore {
+	return p.gs
+}
+
+func runGraphFunc(erp interface{}, name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("graph." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, map[string]interface{}{"erp": erp}, 0, args)
+}
+
+func TestGraph(t *testing.T) {
+	erp := &testGraphProvider{newTestGraphStore()}
+
+	for _, node := range []map[interface{}]interface{}{
+		{"key": "123", "kind": "Person", "name": "Alice", "tags": []interface{}{"a"}},
+		{"key": "456", "kind": "Person", "name": "Bob"},
+	} {
+		if _, err := runGraphFunc(erp, "storeNode", "main", node); err != nil {
+			t.Error("Unexpected result:", err)
+			return
+		}
+	}
+
+	res, err := runGraphFunc(erp, "fetchNode", "main", "123", "Person")
+
+	if err != nil || fmt.Sprint(res) != "map[key:123 kind:Person name:Alice tags:[a]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, ok := res.(map[interface{}]interface{}); !ok {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if res, err = runGraphFunc(erp, "fetchNode", "main", "789", "Person"); err != nil || res != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = runGraphFunc(erp, "storeEdge", "main", map[interface{}]interface{}{
+		"key": "e1", "kind": "Knows", "end1key": "123", "end1kind": "Person", "end1role": "friend",
+		"end2key": "456", "end2kind": "Person", "end2role": "friend"}); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err = runGraphFunc(erp, "traverse", "main", "123", "Person", ":::"); err != nil ||
+		fmt.Sprint(res) != "map[edges:[map[end1key:123 end1kind:Person end1role:friend end2key:456 "+
+			"end2kind:Person end2role:friend key:e1 kind:Knows]] nodes:[map[key:456 kind:Person name:Bob]]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = runGraphFunc(erp, "removeEdge", "main", "e1", "Knows"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err = runGraphFunc(erp, "traverse", "main", "123", "Person", ":::"); err != nil ||
+		fmt.Sprint(res) != "map[edges:[] nodes:[]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err = runGraphFunc(erp, "query", "main", "get Person"); err != nil ||
+		fmt.Sprint(res) != "map[partition:main rows:[2]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = runGraphFunc(erp, "removeNode", "main", "123", "Person"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runGraphFunc(erp, "removeNode", "main", "123", "Person"); err == nil || err.Error() != "Node does not exist" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runGraphFunc(erp, "query", "main", "fail"); err == nil || err.Error() != "Invalid query" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runGraphFunc(erp, "storeNode", "main", map[interface{}]interface{}{"key": "123"}); err == nil ||
+		err.Error() != "Parameter 2 should have a kind attribute" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runGraphFunc(erp, "storeEdge", "main", map[interface{}]interface{}{"key": "e1", "kind": "Knows",
+		"end1key": "123", "end1kind": "Person"}); err == nil ||
+		err.Error() != "Parameter 2 should have a end2key attribute" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runGraphFunc(erp, "storeNode", "main", "foo"); err == nil || err.Error() != "Parameter 2 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runGraphFunc(erp, "traverse", "main", "123", "Person"); err == nil ||
+		err.Error() != "Need a partition, a node key, a node kind and a traversal spec as parameters" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for _, erp := range []interface{}{nil, &testGraphProvider{}} {
+		if _, err = runGraphFunc(erp, "query", "main", "get Person"); err == nil || err.Error() != "No graph store available" {
+			t.Error("Unexpected result:", err)
+			return
+		}
+	}
+
+	for name, f := range graphFuncMap {
+		if res, _ := f.DocString(); res == "" {
+			t.Error("Unexpected result:", name, res)
+			return
+		}
+	}
+}
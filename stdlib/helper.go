@@ -0,0 +1,193 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/krotik/common/errorutil"
+	"github.com/krotik/ecal/engine"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+addInternalStdlibPkg adds a package which is implemented as part of stdlib
+together with all its functions.
+*/
+func addInternalStdlibPkg(pkg string, docstring string, funcMap map[string]util.ECALFunction) {
+	errorutil.AssertOk(AddStdlibPkg(pkg, docstring))
+
+	for name, funcObj := range funcMap {
+		errorutil.AssertOk(AddStdlibFunc(pkg, name, funcObj))
+	}
+}
+
+/*
+handles holds all objects (e.g. open connections) which are referenced from
+ECAL code by a handle id.
+*/
+var handles = make(map[string]interface{})
+
+/*
+handleCounter is used to create unique handle ids.
+*/
+var handleCounter uint64
+
+/*
+handlesLock is the lock for handles.
+*/
+var handlesLock = &sync.Mutex{}
+
+/*
+addHandle registers an object and returns its handle id.
+*/
+func addHandle(prefix string, obj interface{}) string {
+	handlesLock.Lock()
+	defer handlesLock.Unlock()
+
+	handleCounter++
+	id := fmt.Sprintf("%v-%v", prefix, handleCounter)
+	handles[id] = obj
+
+	return id
+}
+
+/*
+getHandle returns the object of a handle id or nil if the handle does not exist.
+*/
+func getHandle(id interface{}) interface{} {
+	handlesLock.Lock()
+	defer handlesLock.Unlock()
+
+	return handles[fmt.Sprint(id)]
+}
+
+/*
+removeHandle removes a handle and returns its object or nil if the handle does not exist.
+*/
+func removeHandle(id interface{}) interface{} {
+	handlesLock.Lock()
+	defer handlesLock.Unlock()
+
+	obj := handles[fmt.Sprint(id)]
+	delete(handles, fmt.Sprint(id))
+
+	return obj
+}
+
+/*
+runningProcessor returns the processor of the ECA engine from the runtime
+provider. The processor is started if necessary.
+*/
+func runningProcessor(is map[string]interface{}) (engine.Processor, error) {
+	ep, ok := is["erp"].(util.ECALEngineProvider)
+
+	if !ok {
+		return nil, fmt.Errorf("No ECA engine available")
+	}
+
+	proc := ep.GetProcessor()
+
+	if proc.Stopped() {
+		proc.Start()
+	}
+
+	return proc, nil
+}
+
+/*
+baseFunc is the base structure for functions which are implemented as part
+of stdlib providing some utility functions.
+*/
+type baseFunc struct {
+}
+
+/*
+AssertNumParam converts a general interface{} parameter into a number.
+*/
+func (bf *baseFunc) AssertNumParam(index int, val interface{}) (float64, error) {
+	var err error
+
+	resNum, ok := val.(float64)
+
+	if !ok {
+
+		resNum, err = strconv.ParseFloat(fmt.Sprint(val), 64)
+		if err != nil {
+			err = fmt.Errorf("Parameter %v should be a number", index)
+		}
+	}
+
+	return resNum, err
+}
+
+/*
+AssertMapParam converts a general interface{} parameter into a map.
+*/
+func (bf *baseFunc) AssertMapParam(index int, val interface{}) (map[interface{}]interface{}, error) {
+
+	valMap, ok := val.(map[interface{}]interface{})
+
+	if ok {
+		return valMap, nil
+	}
+
+	return nil, fmt.Errorf("Parameter %v should be a map", index)
+}
+
+/*
+AssertListParam converts a general interface{} parameter into a list.
+*/
+func (bf *baseFunc) AssertListParam(index int, val interface{}) ([]interface{}, error) {
+
+	valList, ok := val.([]interface{})
+
+	if ok {
+		return valList, nil
+	}
+
+	return nil, fmt.Errorf("Parameter %v should be a list", index)
+}
+
+/*
+AssertMinParams checks that a given list of arguments has at least a number of items.
+*/
+func (bf *baseFunc) AssertMinParams(args []interface{}, min int, desc string) error {
+	if len(args) < min {
+		return fmt.Errorf("Need %v as parameter%v", desc, plural(min))
+	}
+
+	return nil
+}
+
+/*
+bytesParam returns the bytes of a parameter. Bytes are returned as they are -
+all other values are converted into a string first.
+*/
+func bytesParam(val interface{}) []byte {
+	if b, ok := val.([]byte); ok {
+		return b
+	}
+
+	return []byte(fmt.Sprint(val))
+}
+
+/*
+plural returns the string 's' if the parameter is greater than one.
+*/
+func plural(l int) string {
+	if l > 1 {
+		return "s"
+	}
+	return ""
+}
@@ -0,0 +1,231 @@
+//go:build kafka
+// +build kafka
+
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/krotik/ecal/engine"
+	"github.com/krotik/ecal/engine/source"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+	"github.com/segmentio/kafka-go"
+)
+
+/*
+kafkaFuncMap contains all functions of the kafka package.
+*/
+var kafkaFuncMap = map[string]util.ECALFunction{
+	"connect": &kafkaConnectFunc{&baseFunc{}},
+	"publish": &kafkaPublishFunc{&baseFunc{}},
+	"close":   &kafkaCloseFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("kafka", "Kafka consumer groups which turn messages into events and Kafka producers.", kafkaFuncMap)
+}
+
+/*
+AssertKafkaParam converts a general interface{} parameter into a Kafka connection.
+*/
+func (bf *baseFunc) AssertKafkaParam(index int, val interface{}) (*source.KafkaSource, error) {
+	if src, ok := getHandle(val).(*source.KafkaSource); ok {
+		return src, nil
+	}
+
+	return nil, fmt.Errorf("Parameter %v should be an open Kafka connection", index)
+}
+
+// connect
+// =======
+
+/*
+kafkaConnectFunc connects to a Kafka cluster.
+*/
+type kafkaConnectFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *kafkaConnectFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var brokers, topics []string
+
+	err := f.AssertMinParams(args, 1, "a list of brokers")
+
+	if err == nil {
+		if brokerList, ok := args[0].([]interface{}); ok {
+			for _, b := range brokerList {
+				brokers = append(brokers, fmt.Sprint(b))
+			}
+		} else {
+			brokers = strings.Split(fmt.Sprint(args[0]), ",")
+		}
+	}
+
+	if err == nil && len(args) > 1 && args[1] != nil {
+		var topicList []interface{}
+
+		if topicList, err = f.AssertListParam(2, args[1]); err == nil {
+			for _, t := range topicList {
+				topics = append(topics, fmt.Sprint(t))
+			}
+		}
+	}
+
+	options := map[interface{}]interface{}{}
+
+	if err == nil && len(args) > 2 {
+		options, err = f.AssertMapParam(3, args[2])
+	}
+
+	if err == nil {
+		var proc engine.Processor
+
+		if proc, err = runningProcessor(is); err == nil {
+			for _, broker := range brokers {
+				if err = assertNetworkAllowed(is, broker); err != nil {
+					break
+				}
+			}
+		}
+
+		if err == nil {
+			groupID := source.KafkaDefaultGroupID
+
+			if id, ok := options["groupID"]; ok {
+				groupID = fmt.Sprint(id)
+			}
+
+			src := source.NewKafkaSource(proc, brokers, groupID, topics)
+
+			if maxPending, ok := options["maxPending"]; ok {
+				var num float64
+
+				if num, err = f.AssertNumParam(3, maxPending); err == nil {
+					src.MaxPending = int(num)
+				}
+			}
+
+			if startOffset, ok := options["startOffset"]; ok {
+				switch fmt.Sprint(startOffset) {
+				case "first":
+					src.StartOffset = kafka.FirstOffset
+				case "last":
+					src.StartOffset = kafka.LastOffset
+				default:
+					err = fmt.Errorf("Start offset should be first or last")
+				}
+			}
+
+			if err == nil {
+				if err = src.Start(); err == nil {
+					res = addHandle("kafka", src)
+				} else {
+					err = fmt.Errorf("Could not connect to %v: %v", strings.Join(brokers, ","), err)
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *kafkaConnectFunc) DocString() (string, error) {
+	return "Connects to a list of Kafka brokers, consumes a list of topics as part of a consumer group and " +
+		"returns a connection handle. Received messages are added as events.", nil
+}
+
+// publish
+// =======
+
+/*
+kafkaPublishFunc publishes a message.
+*/
+type kafkaPublishFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *kafkaPublishFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 3, "a connection, a topic and a message")
+
+	if err == nil {
+		var src *source.KafkaSource
+
+		if src, err = f.AssertKafkaParam(1, args[0]); err == nil {
+			var msg, key []byte
+
+			if len(args) > 3 && args[3] != nil {
+				key = []byte(fmt.Sprint(args[3]))
+			}
+
+			if msg, err = source.EncodeMessage(args[2]); err == nil {
+				err = src.Publish(fmt.Sprint(args[1]), key, msg)
+			}
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *kafkaPublishFunc) DocString() (string, error) {
+	return "Publishes a message with an optional key to a topic. Values which are not strings are sent as JSON.", nil
+}
+
+// close
+// =====
+
+/*
+kafkaCloseFunc closes a Kafka connection.
+*/
+type kafkaCloseFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *kafkaCloseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 1, "a connection")
+
+	if err == nil {
+		var src *source.KafkaSource
+
+		if src, err = f.AssertKafkaParam(1, args[0]); err == nil {
+			removeHandle(args[0])
+			err = src.Stop()
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *kafkaCloseFunc) DocString() (string, error) {
+	return "Closes a Kafka connection. Messages which are currently processed are committed first.", nil
+}
@@ -0,0 +1,160 @@
+//go:build kafka
+// +build kafka
+
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/krotik/ecal/engine"
+	"github.com/krotik/ecal/engine/source"
+	"github.com/segmentio/kafka-go"
+)
+
+/*
+testKafkaWriter records all written messages.
+*/
+type testKafkaWriter struct {
+	messages []kafka.Message
+}
+
+func (w *testKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *testKafkaWriter) Close() error {
+	return nil
+}
+
+func runKafkaFunc(erp interface{}, name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("kafka." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, map[string]interface{}{"erp": erp}, 0, args)
+}
+
+func TestKafka(t *testing.T) {
+	proc := engine.NewProcessor(1)
+	defer proc.Finish()
+
+	ep := &testEngineProvider{proc}
+
+	writer := &testKafkaWriter{}
+
+	src := source.NewKafkaSource(proc, nil, "", nil)
+	src.Writer = writer
+
+	if err := src.Start(); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	conn := addHandle("kafka", src)
+
+	if _, err := runKafkaFunc(ep, "publish", conn, "orders", map[interface{}]interface{}{"value": 5}, "foo"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runKafkaFunc(ep, "publish", conn, "orders", "bar"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res := fmt.Sprintf("%v %s %s / %v %s %s", writer.messages[0].Topic, writer.messages[0].Key,
+		writer.messages[0].Value, writer.messages[1].Topic, writer.messages[1].Key,
+		writer.messages[1].Value); res != `orders foo {"value":5} / orders  bar` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if _, err := runKafkaFunc(ep, "close", conn); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runKafkaFunc(ep, "publish", conn, "foo", "bar"); err == nil ||
+		err.Error() != "Parameter 1 should be an open Kafka connection" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	l, _ := net.Listen("tcp", "localhost:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	if _, err := runKafkaFunc(ep, "connect", []interface{}{addr}, []interface{}{"orders"}); err == nil ||
+		err.Error() != fmt.Sprintf("Network access to %v is not allowed", addr) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	sep := &testSecureEngineProvider{ep, &testSecurityPolicy{allowed: []string{addr}}}
+
+	if _, err := runKafkaFunc(sep, "connect", addr+",localhost:1", []interface{}{"orders"}); err == nil ||
+		err.Error() != "Network access to localhost:1 is not allowed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runKafkaFunc(sep, "connect", []interface{}{addr}, []interface{}{"orders"}); err == nil ||
+		!strings.HasPrefix(err.Error(), "Could not connect to "+addr) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runKafkaFunc(sep, "connect", addr, nil, map[interface{}]interface{}{"startOffset": "foo"}); err == nil ||
+		err.Error() != "Start offset should be first or last" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runKafkaFunc(sep, "connect", addr, nil, map[interface{}]interface{}{"maxPending": "foo"}); err == nil ||
+		err.Error() != "Parameter 3 should be a number" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runKafkaFunc(ep, "connect", "foo", "bar"); err == nil || err.Error() != "Parameter 2 should be a list" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runKafkaFunc(ep, "connect", "foo", nil, "bar"); err == nil || err.Error() != "Parameter 3 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runKafkaFunc(nil, "connect", "foo"); err == nil || err.Error() != "No ECA engine available" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runKafkaFunc(nil, "close"); err == nil || err.Error() != "Need a connection as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for name, f := range kafkaFuncMap {
+		if doc, err := f.DocString(); doc == "" || err != nil {
+			t.Error("Missing docstring for:", name)
+			return
+		}
+	}
+}
@@ -0,0 +1,243 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+mailFuncMap contains all functions of the mail package.
+*/
+var mailFuncMap = map[string]util.ECALFunction{
+	"send": &mailSendFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("mail", "Functions to send emails via SMTP.", mailFuncMap)
+}
+
+// send
+// ====
+
+/*
+mailSendFunc sends an email via an SMTP server.
+*/
+type mailSendFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *mailSendFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var options map[interface{}]interface{}
+	var to, cc, bcc []string
+
+	err := f.AssertMinParams(args, 5, "a server, a sender, recipients, a subject and a body")
+
+	if err == nil {
+		err = assertNetworkAllowed(is, fmt.Sprint(args[0]))
+	}
+
+	if err == nil {
+		to, err = f.addressList(3, args[2])
+	}
+
+	if err == nil && len(args) > 5 && args[5] != nil {
+		options, err = f.AssertMapParam(6, args[5])
+	}
+
+	if err == nil {
+		if cc, err = f.addressList(6, options["cc"]); err == nil {
+			bcc, err = f.addressList(6, options["bcc"])
+		}
+	}
+
+	if err == nil {
+		msg := f.message(fmt.Sprint(args[1]), to, cc, fmt.Sprint(args[3]), fmt.Sprint(args[4]),
+			options["html"] == true)
+
+		if err = f.send(fmt.Sprint(args[0]), fmt.Sprint(args[1]),
+			append(append(to, cc...), bcc...), msg, options); err != nil {
+
+			err = fmt.Errorf("Could not send mail: %v", err)
+		}
+	}
+
+	return nil, err
+}
+
+/*
+addressList converts a parameter into a list of addresses. The parameter can be
+a single address or a list of addresses.
+*/
+func (f *mailSendFunc) addressList(index int, val interface{}) ([]string, error) {
+	var res []string
+
+	switch v := val.(type) {
+	case nil:
+	case []interface{}:
+		for _, a := range v {
+			res = append(res, fmt.Sprint(a))
+		}
+	case map[interface{}]interface{}:
+		return nil, fmt.Errorf("Parameter %v should be an address or a list of addresses", index)
+	default:
+		res = append(res, fmt.Sprint(v))
+	}
+
+	return res, nil
+}
+
+/*
+message builds a MIME message. The body is encoded as quoted-printable UTF-8 text.
+*/
+func (f *mailSendFunc) message(from string, to []string, cc []string, subject string, body string, html bool) []byte {
+	var buf bytes.Buffer
+
+	contentType := "text/plain"
+	if html {
+		contentType = "text/html"
+	}
+
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%v: %v\r\n", name, value)
+	}
+
+	header("From", from)
+	header("To", strings.Join(to, ", "))
+	if len(cc) > 0 {
+		header("Cc", strings.Join(cc, ", "))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", contentType+"; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	w.Write([]byte(body))
+	w.Close()
+
+	return buf.Bytes()
+}
+
+/*
+send delivers a message to an SMTP server. Depending on the tls option the
+connection is encrypted with STARTTLS (auto if supported by the server,
+starttls to require it), from the start (tls) or not at all (none).
+*/
+func (f *mailSendFunc) send(server string, from string, rcpts []string, msg []byte,
+	options map[interface{}]interface{}) error {
+
+	var c *smtp.Client
+	var err error
+
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return err
+	}
+
+	tlsMode := "auto"
+	if t, ok := options["tls"]; ok {
+		tlsMode = fmt.Sprint(t)
+	}
+
+	tlsConfig := &tls.Config{ServerName: host}
+
+	switch tlsMode {
+	case "tls":
+		var conn *tls.Conn
+
+		if conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", server, tlsConfig); err == nil {
+			c, err = smtp.NewClient(conn, host)
+		}
+
+	case "auto", "starttls", "none":
+		var conn net.Conn
+
+		if conn, err = net.DialTimeout("tcp", server, 30*time.Second); err == nil {
+			if c, err = smtp.NewClient(conn, host); err == nil && tlsMode != "none" {
+
+				if ok, _ := c.Extension("STARTTLS"); ok {
+					err = c.StartTLS(tlsConfig)
+				} else if tlsMode == "starttls" {
+					err = fmt.Errorf("Server does not support STARTTLS")
+				}
+			}
+		}
+
+	default:
+		return fmt.Errorf("Unknown TLS mode: %v (supported are auto, starttls, tls and none)", tlsMode)
+	}
+
+	if err != nil {
+		if c != nil {
+			c.Close()
+		}
+		return err
+	}
+
+	defer c.Close()
+
+	if user, ok := options["username"]; ok {
+		err = c.Auth(smtp.PlainAuth("", fmt.Sprint(user), fmt.Sprint(options["password"]), host))
+	}
+
+	if err == nil {
+		err = c.Mail(from)
+	}
+
+	for _, rcpt := range rcpts {
+		if err == nil {
+			err = c.Rcpt(rcpt)
+		}
+	}
+
+	if err == nil {
+		var w interface {
+			Write([]byte) (int, error)
+			Close() error
+		}
+
+		if w, err = c.Data(); err == nil {
+			if _, err = w.Write(msg); err == nil {
+				err = w.Close()
+			}
+		}
+	}
+
+	if err == nil {
+		err = c.Quit()
+	}
+
+	return err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *mailSendFunc) DocString() (string, error) {
+	return "Sends an email via an SMTP server with optional options (tls, username, password, cc, bcc, html).", nil
+}
@@ -0,0 +1,197 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+/*
+testSMTPServer is a minimal SMTP server which records all received commands.
+*/
+func testSMTPServer(t *testing.T, commands chan string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		defer l.Close()
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(commands)
+				return
+			}
+			line = strings.TrimSpace(line)
+			commands <- line
+
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				fmt.Fprint(conn, "250-localhost\r\n250 AUTH PLAIN\r\n")
+			case strings.HasPrefix(line, "AUTH"):
+				fmt.Fprint(conn, "235 OK\r\n")
+			case line == "DATA":
+				fmt.Fprint(conn, "354 Go ahead\r\n")
+				var data []string
+				for {
+					l, _ := r.ReadString('\n')
+					if l == ".\r\n" {
+						break
+					}
+					data = append(data, strings.TrimRight(l, "\r\n"))
+				}
+				commands <- strings.Join(data, "\n")
+				fmt.Fprint(conn, "250 OK\r\n")
+			case line == "QUIT":
+				fmt.Fprint(conn, "221 Bye\r\n")
+				close(commands)
+				return
+			case strings.HasPrefix(line, "RCPT TO:<bad"):
+				fmt.Fprint(conn, "550 No such user\r\n")
+			default:
+				fmt.Fprint(conn, "250 OK\r\n")
+			}
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestMailSend(t *testing.T) {
+	send, _ := GetStdlibFunc("mail.send")
+
+	commands := make(chan string, 100)
+	server := testSMTPServer(t, commands)
+
+	policy := &testSecurityPolicy{allowed: []string{server, "foo"}}
+	is := map[string]interface{}{"erp": policy}
+
+	if _, err := send.Run("", nil, nil, 0, []interface{}{server, "ecal@example.com", "a@example.com", "a", "b"}); err == nil ||
+		err.Error() != fmt.Sprintf("Network access to %v is not allowed", server) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	_, err := send.Run("", nil, is, 0, []interface{}{server, "ecal@example.com",
+		[]interface{}{"a@example.com", "b@example.com"}, "Alarm ü", "Temperature is too high\nValue: 30°",
+		map[interface{}]interface{}{
+			"tls":      "auto",
+			"username": "user",
+			"password": "pass",
+			"cc":       "c@example.com",
+			"bcc":      []interface{}{"d@example.com"},
+		}})
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	var received []string
+	for c := range commands {
+		received = append(received, c)
+	}
+
+	res := regexp.MustCompile("Date: .*").ReplaceAllString(strings.Join(received, "\n"), "Date: xxx")
+
+	if res != `EHLO localhost
+AUTH PLAIN AHVzZXIAcGFzcw==
+MAIL FROM:<ecal@example.com>
+RCPT TO:<a@example.com>
+RCPT TO:<b@example.com>
+RCPT TO:<c@example.com>
+RCPT TO:<d@example.com>
+DATA
+From: ecal@example.com
+To: a@example.com, b@example.com
+Cc: c@example.com
+Subject: =?utf-8?q?Alarm_=C3=BC?=
+Date: xxx
+MIME-Version: 1.0
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+Temperature is too high
+Value: 30=C2=B0
+QUIT` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	// Test error cases
+
+	commands = make(chan string, 100)
+	server = testSMTPServer(t, commands)
+	policy.allowed = append(policy.allowed, server)
+
+	if _, err := send.Run("", nil, is, 0, []interface{}{server, "ecal@example.com", "bad@example.com", "a", "b",
+		map[interface{}]interface{}{"html": true}}); err == nil || !strings.HasPrefix(err.Error(), "Could not send mail: 550") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	commands = make(chan string, 100)
+	server = testSMTPServer(t, commands)
+	policy.allowed = append(policy.allowed, server)
+
+	if _, err := send.Run("", nil, is, 0, []interface{}{server, "ecal@example.com", "a@example.com", "a", "b",
+		map[interface{}]interface{}{"tls": "starttls"}}); err == nil || err.Error() != "Could not send mail: Server does not support STARTTLS" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := send.Run("", nil, is, 0, []interface{}{server, "ecal@example.com", "a@example.com", "a", "b",
+		map[interface{}]interface{}{"tls": "foo"}}); err == nil ||
+		err.Error() != "Could not send mail: Unknown TLS mode: foo (supported are auto, starttls, tls and none)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := send.Run("", nil, is, 0, []interface{}{"foo", "ecal@example.com", "a@example.com", "a", "b"}); err == nil ||
+		err.Error() != "Could not send mail: address foo: missing port in address" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := send.Run("", nil, is, 0, []interface{}{server, "ecal@example.com", map[interface{}]interface{}{}, "a", "b"}); err == nil ||
+		err.Error() != "Parameter 3 should be an address or a list of addresses" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := send.Run("", nil, is, 0, []interface{}{server, "ecal@example.com", "a@example.com", "a", "b", "c"}); err == nil ||
+		err.Error() != "Parameter 6 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := send.Run("", nil, is, 0, []interface{}{server}); err == nil ||
+		err.Error() != "Need a server, a sender, recipients, a subject and a body as parameters" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/krotik/ecal/engine"
+	"github.com/krotik/ecal/engine/source"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+mqttFuncMap contains all functions of the mqtt package.
+*/
+var mqttFuncMap = map[string]util.ECALFunction{
+	"connect": &mqttConnectFunc{&baseFunc{}},
+	"publish": &mqttPublishFunc{&baseFunc{}},
+	"close":   &mqttCloseFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("mqtt", "MQTT client connections which turn messages into events.", mqttFuncMap)
+}
+
+/*
+AssertMQTTParam converts a general interface{} parameter into an MQTT connection.
+*/
+func (bf *baseFunc) AssertMQTTParam(index int, val interface{}) (*source.MQTTSource, error) {
+	if src, ok := getHandle(val).(*source.MQTTSource); ok {
+		return src, nil
+	}
+
+	return nil, fmt.Errorf("Parameter %v should be an open MQTT connection", index)
+}
+
+// connect
+// =======
+
+/*
+mqttConnectFunc connects to an MQTT broker.
+*/
+type mqttConnectFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *mqttConnectFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var topics []string
+
+	err := f.AssertMinParams(args, 1, "a broker address")
+
+	if err == nil && len(args) > 1 && args[1] != nil {
+		var topicList []interface{}
+
+		if topicList, err = f.AssertListParam(2, args[1]); err == nil {
+			for _, t := range topicList {
+				topics = append(topics, fmt.Sprint(t))
+			}
+		}
+	}
+
+	options := map[interface{}]interface{}{}
+
+	if err == nil && len(args) > 2 {
+		options, err = f.AssertMapParam(3, args[2])
+	}
+
+	if err == nil {
+		var proc engine.Processor
+
+		if proc, err = runningProcessor(is); err == nil {
+			err = assertNetworkAllowed(is, fmt.Sprint(args[0]))
+		}
+
+		if err == nil {
+			clientID := fmt.Sprintf("ecal-%x", time.Now().UnixNano())
+
+			if id, ok := options["clientID"]; ok {
+				clientID = fmt.Sprint(id)
+			}
+
+			src := source.NewMQTTSource(proc, fmt.Sprint(args[0]), clientID, topics)
+
+			if user, ok := options["username"]; ok {
+				src.Username = fmt.Sprint(user)
+			}
+			if pass, ok := options["password"]; ok {
+				src.Password = fmt.Sprint(pass)
+			}
+
+			if err = src.Start(); err == nil {
+				res = addHandle("mqtt", src)
+			} else {
+				err = fmt.Errorf("Could not connect to %v: %v", args[0], err)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *mqttConnectFunc) DocString() (string, error) {
+	return "Connects to an MQTT broker, subscribes to a list of topics and returns a connection handle. " +
+		"Received messages are added as events.", nil
+}
+
+// publish
+// =======
+
+/*
+mqttPublishFunc publishes a message.
+*/
+type mqttPublishFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *mqttPublishFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 3, "a connection, a topic and a message")
+
+	if err == nil {
+		var src *source.MQTTSource
+
+		if src, err = f.AssertMQTTParam(1, args[0]); err == nil {
+			var msg []byte
+
+			if msg, err = source.EncodeMessage(args[2]); err == nil {
+				err = src.Publish(fmt.Sprint(args[1]), msg)
+			}
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *mqttPublishFunc) DocString() (string, error) {
+	return "Publishes a message to a topic. Values which are not strings are sent as JSON.", nil
+}
+
+// close
+// =====
+
+/*
+mqttCloseFunc closes an MQTT connection.
+*/
+type mqttCloseFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *mqttCloseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 1, "a connection")
+
+	if err == nil {
+		var src *source.MQTTSource
+
+		if src, err = f.AssertMQTTParam(1, args[0]); err == nil {
+			removeHandle(args[0])
+			err = src.Stop()
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *mqttCloseFunc) DocString() (string, error) {
+	return "Closes an MQTT connection.", nil
+}
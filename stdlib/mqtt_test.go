@@ -0,0 +1,163 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krotik/ecal/engine"
+)
+
+/*
+runTestMQTTBroker runs a minimal MQTT broker which acknowledges connect and
+subscribe requests and sends all published messages back to the client.
+Only packets with a remaining length of less than 128 bytes are supported.
+*/
+func runTestMQTTBroker(l net.Listener) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+
+		data := make([]byte, header[1])
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+
+		switch header[0] >> 4 {
+		case 1: // CONNECT
+			conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 8: // SUBSCRIBE
+			conn.Write([]byte{0x90, 0x03, data[0], data[1], 0x00})
+		case 3: // PUBLISH
+			conn.Write(append(header, data...))
+		}
+	}
+}
+
+func runMQTTFunc(erp interface{}, name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("mqtt." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, map[string]interface{}{"erp": erp}, 0, args)
+}
+
+func TestMQTT(t *testing.T) {
+	events := make(chan *engine.Event, 10)
+
+	proc := engine.NewProcessor(1)
+
+	proc.AddRule(&engine.Rule{
+		Name:       "TestRule",
+		KindMatch:  []string{"mqtt.sensor.*"},
+		ScopeMatch: []string{},
+		Action: func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error {
+			events <- e
+			return nil
+		},
+	})
+	defer proc.Finish()
+
+	l, _ := net.Listen("tcp", "localhost:0")
+	defer l.Close()
+
+	ep := &testSecureEngineProvider{&testEngineProvider{proc}, &testSecurityPolicy{allowed: []string{l.Addr().String()}}}
+
+	if _, err := runMQTTFunc(&testEngineProvider{proc}, "connect", l.Addr().String()); err == nil ||
+		err.Error() != fmt.Sprintf("Network access to %v is not allowed", l.Addr()) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	go runTestMQTTBroker(l)
+
+	conn, err := runMQTTFunc(ep, "connect", l.Addr().String(), []interface{}{"sensor/+"},
+		map[interface{}]interface{}{"clientID": "foo"})
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runMQTTFunc(ep, "publish", conn, "sensor/temp", map[interface{}]interface{}{"value": 5}); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	select {
+	case e := <-events:
+		if res := fmt.Sprint(e); res != `Event: sensor/temp mqtt.sensor.temp {"data":{"value":5},"topic":"sensor/temp"}` {
+			t.Error("Unexpected event:", res)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("No event received")
+		return
+	}
+
+	if _, err := runMQTTFunc(ep, "close", conn); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runMQTTFunc(ep, "publish", conn, "foo", "bar"); err == nil ||
+		err.Error() != "Parameter 1 should be an open MQTT connection" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	l.Close()
+
+	if _, err := runMQTTFunc(ep, "connect", l.Addr().String()); err == nil ||
+		!strings.HasPrefix(err.Error(), "Could not connect to "+l.Addr().String()) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runMQTTFunc(ep, "connect", "foo", "bar"); err == nil || err.Error() != "Parameter 2 should be a list" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runMQTTFunc(ep, "connect", "foo", nil, "bar"); err == nil || err.Error() != "Parameter 3 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runMQTTFunc(nil, "connect", "foo"); err == nil || err.Error() != "No ECA engine available" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runMQTTFunc(nil, "close"); err == nil || err.Error() != "Need a connection as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for name, f := range mqttFuncMap {
+		if doc, err := f.DocString(); doc == "" || err != nil {
+			t.Error("Missing docstring for:", name)
+			return
+		}
+	}
+}
@@ -0,0 +1,523 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+netFuncMap contains all functions of the net package.
+*/
+var netFuncMap = map[string]util.ECALFunction{
+	"dial":    &netDialFunc{&baseFunc{}},
+	"listen":  &netListenFunc{&baseFunc{}},
+	"accept":  &netAcceptFunc{&baseFunc{}},
+	"send":    &netSendFunc{&baseFunc{}},
+	"receive": &netReceiveFunc{&baseFunc{}},
+	"close":   &netCloseFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("net", "TCP and UDP sockets which are confined by the network policy of the interpreter.", netFuncMap)
+}
+
+/*
+netMaxDatagramSize is the maximum size of a received UDP datagram.
+*/
+const netMaxDatagramSize = 65535
+
+/*
+netConn models an open TCP connection or UDP socket.
+*/
+type netConn struct {
+	conn     net.Conn       // Connected socket (nil for unconnected UDP sockets)
+	packet   net.PacketConn // Unconnected UDP socket which was created by listen
+	mode     string         // Mode of the connection (line, raw or datagram)
+	binary   bool           // Flag if received data should be returned as bytes
+	pending  []byte         // Data which was received but not yet returned
+	readLock *sync.Mutex    // Lock for reading from the connection
+}
+
+/*
+netListener models a TCP listener.
+*/
+type netListener struct {
+	listener *net.TCPListener // Listener for new connections
+	mode     string           // Mode of accepted connections
+	binary   bool             // Flag if accepted connections return bytes
+}
+
+/*
+AssertNetConnParam converts a general interface{} parameter into a network connection.
+*/
+func (bf *baseFunc) AssertNetConnParam(index int, val interface{}) (*netConn, error) {
+	if conn, ok := getHandle(val).(*netConn); ok {
+		return conn, nil
+	}
+
+	return nil, fmt.Errorf("Parameter %v should be an open network connection", index)
+}
+
+/*
+assertNetworkAllowed checks the network policy of the interpreter for a given address.
+*/
+func assertNetworkAllowed(is map[string]interface{}, address string) error {
+	if policy, ok := is["erp"].(util.ECALSecurityPolicy); !ok || !policy.IsNetworkAllowed(address) {
+		return fmt.Errorf("Network access to %v is not allowed", address)
+	}
+
+	return nil
+}
+
+/*
+netOptions determines protocol, mode and binary flag from the parameters of
+dial and listen.
+*/
+func (bf *baseFunc) netOptions(args []interface{}) (string, string, bool, error) {
+	var options map[interface{}]interface{}
+	var err error
+
+	protocol := fmt.Sprint(args[0])
+
+	if protocol != "tcp" && protocol != "udp" {
+		return "", "", false, fmt.Errorf("Unknown protocol: %v (supported are tcp and udp)", protocol)
+	}
+
+	if len(args) > 2 && args[2] != nil {
+		if options, err = bf.AssertMapParam(3, args[2]); err != nil {
+			return "", "", false, err
+		}
+	}
+
+	mode := "datagram"
+
+	if protocol == "tcp" {
+		mode = "line"
+
+		if m, ok := options["mode"]; ok {
+			if mode = fmt.Sprint(m); mode != "line" && mode != "raw" {
+				return "", "", false, fmt.Errorf("Unknown mode: %v (supported are line and raw)", mode)
+			}
+		}
+	}
+
+	return protocol, mode, options["binary"] == true, nil
+}
+
+/*
+netTimeout returns the deadline for an optional timeout parameter in seconds.
+*/
+func (bf *baseFunc) netTimeout(args []interface{}, index int) (time.Time, error) {
+	var deadline time.Time
+
+	if len(args) > index && args[index] != nil {
+		secs, err := bf.AssertNumParam(index+1, args[index])
+
+		if err != nil {
+			return deadline, err
+		}
+
+		deadline = time.Now().Add(time.Duration(secs * float64(time.Second)))
+	}
+
+	return deadline, nil
+}
+
+/*
+isTimeout checks if an error was caused by a timeout.
+*/
+func isTimeout(err error) bool {
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
+
+// dial
+// ====
+
+/*
+netDialFunc opens a TCP connection or a connected UDP socket.
+*/
+type netDialFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *netDialFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 2, "a protocol and an address")
+
+	if err == nil {
+		var protocol, mode string
+		var binary bool
+
+		address := fmt.Sprint(args[1])
+
+		if protocol, mode, binary, err = f.netOptions(args); err == nil {
+			if err = assertNetworkAllowed(is, address); err == nil {
+				var conn net.Conn
+
+				if conn, err = net.DialTimeout(protocol, address, 30*time.Second); err == nil {
+					res = addHandle("net", &netConn{conn, nil, mode, binary, nil, &sync.Mutex{}})
+				} else {
+					err = fmt.Errorf("Could not connect to %v: %v", address, err)
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *netDialFunc) DocString() (string, error) {
+	return "Opens a TCP connection or a UDP socket to an address with optional options (mode, binary) and returns a connection handle.", nil
+}
+
+// listen
+// ======
+
+/*
+netListenFunc listens for TCP connections or UDP datagrams.
+*/
+type netListenFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *netListenFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 2, "a protocol and an address")
+
+	if err == nil {
+		var protocol, mode string
+		var binary bool
+
+		address := fmt.Sprint(args[1])
+
+		if protocol, mode, binary, err = f.netOptions(args); err == nil {
+			if err = assertNetworkAllowed(is, address); err == nil {
+
+				if protocol == "tcp" {
+					var l net.Listener
+
+					if l, err = net.Listen(protocol, address); err == nil {
+						res = addHandle("netl", &netListener{l.(*net.TCPListener), mode, binary})
+					}
+
+				} else {
+					var pc net.PacketConn
+
+					if pc, err = net.ListenPacket(protocol, address); err == nil {
+						res = addHandle("net", &netConn{nil, pc, mode, binary, nil, &sync.Mutex{}})
+					}
+				}
+
+				if err != nil {
+					err = fmt.Errorf("Could not listen on %v: %v", address, err)
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *netListenFunc) DocString() (string, error) {
+	return "Listens on an address for TCP connections or UDP datagrams and returns a listener or connection handle.", nil
+}
+
+// accept
+// ======
+
+/*
+netAcceptFunc waits for a new connection on a TCP listener.
+*/
+type netAcceptFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *netAcceptFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a listener")
+
+	if err == nil {
+		l, ok := getHandle(args[0]).(*netListener)
+
+		if !ok {
+			return nil, fmt.Errorf("Parameter 1 should be an open TCP listener")
+		}
+
+		var deadline time.Time
+
+		if deadline, err = f.netTimeout(args, 1); err == nil {
+			var conn net.Conn
+
+			l.listener.SetDeadline(deadline)
+
+			if conn, err = l.listener.Accept(); err == nil {
+				res = addHandle("net", &netConn{conn, nil, l.mode, l.binary, nil, &sync.Mutex{}})
+			} else if isTimeout(err) {
+				err = nil
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *netAcceptFunc) DocString() (string, error) {
+	return "Waits for a new connection on a TCP listener. Returns null if an optional timeout in seconds was reached.", nil
+}
+
+// send
+// ====
+
+/*
+netSendFunc sends data over a network connection.
+*/
+type netSendFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *netSendFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 2, "a connection and data")
+
+	if err == nil {
+		var c *netConn
+
+		if c, err = f.AssertNetConnParam(1, args[0]); err == nil {
+			data := bytesParam(args[1])
+
+			if c.mode == "line" && !bytes.HasSuffix(data, []byte("\n")) {
+				data = append(append([]byte{}, data...), '\n')
+			}
+
+			if c.packet != nil {
+				var addr net.Addr
+
+				if len(args) < 3 {
+					return nil, fmt.Errorf("Need a target address to send a datagram from a listening socket")
+				}
+
+				address := fmt.Sprint(args[2])
+
+				if err = assertNetworkAllowed(is, address); err == nil {
+					if addr, err = net.ResolveUDPAddr("udp", address); err == nil {
+						_, err = c.packet.WriteTo(data, addr)
+					}
+				}
+
+			} else {
+				_, err = c.conn.Write(data)
+			}
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *netSendFunc) DocString() (string, error) {
+	return "Sends a string or bytes over a network connection (a line in line mode or a datagram for UDP).", nil
+}
+
+// receive
+// =======
+
+/*
+netReceiveFunc receives data from a network connection.
+*/
+type netReceiveFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *netReceiveFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a connection")
+
+	if err == nil {
+		var c *netConn
+		var deadline time.Time
+
+		if c, err = f.AssertNetConnParam(1, args[0]); err == nil {
+			if deadline, err = f.netTimeout(args, 1); err == nil {
+				c.readLock.Lock()
+				defer c.readLock.Unlock()
+
+				res, err = f.receive(c, deadline)
+
+				if isTimeout(err) {
+					res, err = nil, nil
+				} else if err == io.EOF {
+					err = fmt.Errorf("Connection was closed")
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+receive reads the next line, chunk or datagram from a connection.
+*/
+func (f *netReceiveFunc) receive(c *netConn, deadline time.Time) (interface{}, error) {
+	var data []byte
+	var addr net.Addr
+	var err error
+
+	buf := make([]byte, netMaxDatagramSize)
+
+	if c.packet != nil {
+		var n int
+
+		c.packet.SetReadDeadline(deadline)
+
+		if n, addr, err = c.packet.ReadFrom(buf); err == nil {
+			data = buf[:n]
+		}
+
+	} else if c.mode == "line" {
+
+		// Read until a complete line is available - partial lines are kept
+		// for the next call
+
+		c.conn.SetReadDeadline(deadline)
+
+		for i := bytes.IndexByte(c.pending, '\n'); i == -1 && err == nil; i = bytes.IndexByte(c.pending, '\n') {
+			var n int
+
+			n, err = c.conn.Read(buf)
+			c.pending = append(c.pending, buf[:n]...)
+		}
+
+		if i := bytes.IndexByte(c.pending, '\n'); i != -1 {
+			data = bytes.TrimSuffix(c.pending[:i], []byte("\r"))
+			c.pending = append([]byte{}, c.pending[i+1:]...)
+			err = nil
+		}
+
+	} else {
+		var n int
+
+		c.conn.SetReadDeadline(deadline)
+
+		if n, err = c.conn.Read(buf); err == nil {
+			data = buf[:n]
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var res interface{} = string(data)
+
+	if c.binary {
+		res = append([]byte{}, data...)
+	}
+
+	if addr != nil {
+
+		// Datagrams of listening sockets are returned with the address of the sender
+
+		res = map[interface{}]interface{}{
+			"data":       res,
+			"remoteAddr": addr.String(),
+		}
+	}
+
+	return res, nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *netReceiveFunc) DocString() (string, error) {
+	return "Waits for data from a network connection. Returns null if an optional timeout in seconds was reached.", nil
+}
+
+// close
+// =====
+
+/*
+netCloseFunc closes a network connection or listener.
+*/
+type netCloseFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *netCloseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 1, "a connection or a listener")
+
+	if err == nil {
+		switch handle := removeHandle(args[0]).(type) {
+		case *netConn:
+			if handle.packet != nil {
+				err = handle.packet.Close()
+			} else {
+				err = handle.conn.Close()
+			}
+		case *netListener:
+			err = handle.listener.Close()
+		default:
+			err = fmt.Errorf("Parameter 1 should be an open network connection or listener")
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *netCloseFunc) DocString() (string, error) {
+	return "Closes a network connection or listener.", nil
+}
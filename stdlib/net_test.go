@@ -0,0 +1,256 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"testing"
+)
+
+func runNetFunc(erp interface{}, name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("net." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, map[string]interface{}{"erp": erp}, 0, args)
+}
+
+func TestNetTCP(t *testing.T) {
+	policy := &testSecurityPolicy{allowed: []string{"127.0.0.1:0"}}
+
+	l, err := runNetFunc(policy, "listen", "tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+	defer runNetFunc(policy, "close", l)
+
+	address := getHandle(l).(*netListener).listener.Addr().String()
+	policy.allowed = append(policy.allowed, address)
+
+	if res, err := runNetFunc(policy, "accept", l, 0.01); err != nil || res != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	client, err := runNetFunc(policy, "dial", "tcp", address)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	server, err := runNetFunc(policy, "accept", l, 5)
+
+	if err != nil || server == nil {
+		t.Error("Unexpected result:", server, err)
+		return
+	}
+
+	// Line mode
+
+	if _, err := runNetFunc(policy, "send", client, "hello"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "send", client, []byte("foo\r\nbar\n")); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for _, expected := range []interface{}{"hello", "foo", "bar", nil} {
+		if res, err := runNetFunc(policy, "receive", server, 1); err != nil || res != expected {
+			t.Error("Unexpected result:", res, err)
+			return
+		}
+	}
+
+	// Partial lines are kept until they are complete
+
+	getHandle(client).(*netConn).conn.Write([]byte("ba"))
+
+	if res, err := runNetFunc(policy, "receive", server, 0.01); err != nil || res != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "send", client, "z"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runNetFunc(policy, "receive", server, 1); err != nil || res != "baz" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "close", client); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runNetFunc(policy, "receive", server); err == nil || err.Error() != "Connection was closed" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	runNetFunc(policy, "close", server)
+
+	// Raw and binary mode
+
+	client, err = runNetFunc(policy, "dial", "tcp", address, map[interface{}]interface{}{"mode": "raw", "binary": true})
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+	defer runNetFunc(policy, "close", client)
+
+	server, _ = runNetFunc(policy, "accept", l, 5)
+	defer runNetFunc(policy, "close", server)
+
+	if _, err := runNetFunc(policy, "send", server, "pong"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runNetFunc(policy, "receive", client, 5); err != nil || fmt.Sprintf("%s", res) != "pong\n" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := runNetFunc(policy, "dial", "tcp", "127.0.0.1:1"); err == nil || err.Error() != "Network access to 127.0.0.1:1 is not allowed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runNetFunc(nil, "listen", "tcp", address); err == nil || err.Error() != "Network access to "+address+" is not allowed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "dial", "foo", address); err == nil || err.Error() != "Unknown protocol: foo (supported are tcp and udp)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "dial", "tcp", address, map[interface{}]interface{}{"mode": "foo"}); err == nil ||
+		err.Error() != "Unknown mode: foo (supported are line and raw)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "dial", "tcp", address, "foo"); err == nil || err.Error() != "Parameter 3 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "dial", "tcp"); err == nil || err.Error() != "Need a protocol and an address as parameters" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "accept", client); err == nil || err.Error() != "Parameter 1 should be an open TCP listener" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "send", l, "a"); err == nil || err.Error() != "Parameter 1 should be an open network connection" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "receive", client, "a"); err == nil || err.Error() != "Parameter 2 should be a number" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "close", "foo"); err == nil || err.Error() != "Parameter 1 should be an open network connection or listener" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestNetUDP(t *testing.T) {
+	policy := &testSecurityPolicy{allowed: []string{"127.0.0.1:0"}}
+
+	server, err := runNetFunc(policy, "listen", "udp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+	defer runNetFunc(policy, "close", server)
+
+	address := getHandle(server).(*netConn).packet.LocalAddr().String()
+	policy.allowed = append(policy.allowed, address)
+
+	client, err := runNetFunc(policy, "dial", "udp", address, map[interface{}]interface{}{"binary": true})
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+	defer runNetFunc(policy, "close", client)
+
+	if _, err := runNetFunc(policy, "send", client, []byte{1, 2, 3}); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	res, err := runNetFunc(policy, "receive", server, 5)
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	msg := res.(map[interface{}]interface{})
+	clientAddress := fmt.Sprint(msg["remoteAddr"])
+
+	if msg["data"] != "\x01\x02\x03" {
+		t.Error("Unexpected result:", msg)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "send", server, "reply", clientAddress); err == nil ||
+		err.Error() != "Network access to "+clientAddress+" is not allowed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	policy.allowed = append(policy.allowed, clientAddress)
+
+	if _, err := runNetFunc(policy, "send", server, "reply", clientAddress); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runNetFunc(policy, "receive", client, 5); err != nil || fmt.Sprint(res) != "[114 101 112 108 121]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := runNetFunc(policy, "receive", client, 0.01); err != nil || res != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runNetFunc(policy, "send", server, "reply"); err == nil ||
+		err.Error() != "Need a target address to send a datagram from a listening socket" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+osFuncMap contains all functions of the os package.
+*/
+var osFuncMap = map[string]util.ECALFunction{
+	"exec":   &osExecFunc{&baseFunc{}},
+	"env":    &osEnvFunc{&baseFunc{}},
+	"setenv": &osSetenvFunc{&baseFunc{}},
+	"args":   &osArgsFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("os", "Operating system functions.", osFuncMap)
+}
+
+// exec
+// ====
+
+/*
+osExecFunc runs an OS process.
+*/
+type osExecFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *osExecFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var cmdArgs []interface{}
+	var options map[interface{}]interface{}
+
+	err := f.AssertMinParams(args, 1, "a command")
+
+	if err == nil {
+		cmd := fmt.Sprint(args[0])
+
+		if policy, ok := is["erp"].(util.ECALSecurityPolicy); !ok || !policy.IsExecAllowed(cmd) {
+			return nil, fmt.Errorf("Execution of command %v is not allowed", cmd)
+		}
+
+		if len(args) > 1 && args[1] != nil {
+			cmdArgs, err = f.AssertListParam(2, args[1])
+		}
+
+		if err == nil && len(args) > 2 && args[2] != nil {
+			options, err = f.AssertMapParam(3, args[2])
+		}
+
+		if err == nil {
+			res, err = f.exec(is, cmd, cmdArgs, options)
+		}
+	}
+
+	return res, err
+}
+
+/*
+exec runs a command with the given arguments and options.
+*/
+func (f *osExecFunc) exec(is map[string]interface{}, cmd string, cmdArgs []interface{},
+	options map[interface{}]interface{}) (interface{}, error) {
+	var err error
+	var timeout float64
+
+	ctx := context.Background()
+
+	if t, ok := options["timeout"]; ok {
+		if timeout, err = f.AssertNumParam(3, t); err != nil {
+			return nil, fmt.Errorf("Option timeout should be a number")
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout*float64(time.Second)))
+		defer cancel()
+	}
+
+	strArgs := make([]string, 0, len(cmdArgs))
+	for _, a := range cmdArgs {
+		strArgs = append(strArgs, fmt.Sprint(a))
+	}
+
+	proc := exec.CommandContext(ctx, cmd, strArgs...)
+
+	// The working directory is confined to the file root
+
+	if dir, ok := options["dir"]; ok {
+		if proc.Dir, err = f.AssertPathParam(is, dir); err != nil {
+			return nil, err
+		}
+	} else if sandbox, ok := is["erp"].(util.ECALFileSandbox); ok {
+		proc.Dir = sandbox.GetFileRoot()
+	}
+
+	if env, ok := options["env"]; ok {
+		var envMap map[interface{}]interface{}
+
+		if envMap, err = f.AssertMapParam(3, env); err != nil {
+			return nil, fmt.Errorf("Option env should be a map")
+		}
+
+		// Like os.setenv the environment may only be changed if all commands
+		// may be executed (e.g. LD_PRELOAD or PATH could start any program)
+
+		if policy, ok := is["erp"].(util.ECALSecurityPolicy); len(envMap) > 0 && (!ok || !policy.IsExecAllowed("*")) {
+			return nil, fmt.Errorf("Option env is not allowed")
+		}
+
+		proc.Env = os.Environ()
+
+		for k, v := range envMap {
+			proc.Env = append(proc.Env, fmt.Sprintf("%v=%v", k, v))
+		}
+	}
+
+	if stdin, ok := options["stdin"]; ok {
+		proc.Stdin = strings.NewReader(fmt.Sprint(stdin))
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	proc.Stdout = &stdout
+	proc.Stderr = &stderr
+
+	exitCode := 0
+	timedOut := false
+
+	if err = proc.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			exitCode, timedOut, err = -1, true, nil
+		} else if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode, err = exitErr.ExitCode(), nil
+		} else {
+			return nil, fmt.Errorf("Could not execute command %v: %v", cmd, err)
+		}
+	}
+
+	return map[interface{}]interface{}{
+		"exitCode": float64(exitCode),
+		"stdout":   stdout.String(),
+		"stderr":   stderr.String(),
+		"timeout":  timedOut,
+	}, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *osExecFunc) DocString() (string, error) {
+	return "Executes an OS command with a list of arguments and an optional map of options (timeout, dir, env, stdin).", nil
+}
+
+// env
+// ===
+
+/*
+osEnvFunc reads environment variables.
+*/
+type osEnvFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *osEnvFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+
+	if len(args) == 0 {
+		env := make(map[interface{}]interface{})
+
+		for _, kv := range os.Environ() {
+			if i := strings.Index(kv, "="); i > 0 {
+				env[kv[:i]] = kv[i+1:]
+			}
+		}
+
+		return env, nil
+	}
+
+	if val, ok := os.LookupEnv(fmt.Sprint(args[0])); ok {
+		return val, nil
+	}
+
+	return nil, nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *osEnvFunc) DocString() (string, error) {
+	return "Returns the value of an environment variable (null if not set) or a map of all environment variables if no name is given.", nil
+}
+
+// setenv
+// ======
+
+/*
+osSetenvFunc sets environment variables.
+*/
+type osSetenvFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *osSetenvFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 1, "a variable name")
+
+	if err == nil {
+		name := fmt.Sprint(args[0])
+
+		// The environment is inherited by executed processes (e.g. PATH) so it
+		// may only be changed if all commands may be executed
+
+		if policy, ok := is["erp"].(util.ECALSecurityPolicy); !ok || !policy.IsExecAllowed("*") {
+			return nil, fmt.Errorf("Changing environment variable %v is not allowed", name)
+		}
+
+		if len(args) < 2 || args[1] == nil {
+			err = os.Unsetenv(name)
+		} else {
+			err = os.Setenv(name, fmt.Sprint(args[1]))
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *osSetenvFunc) DocString() (string, error) {
+	return "Sets the value of an environment variable. The variable is removed if no value is given. Requires that all commands may be executed.", nil
+}
+
+// args
+// ====
+
+/*
+osArgsFunc returns the program arguments.
+*/
+type osArgsFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *osArgsFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	res := []interface{}{}
+
+	if ap, ok := is["erp"].(util.ECALArgsProvider); ok {
+		for _, arg := range ap.GetArgs() {
+			res = append(res, arg)
+		}
+	}
+
+	return res, nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *osArgsFunc) DocString() (string, error) {
+	return "Returns the program arguments as a list. The first item is the name of the program.", nil
+}
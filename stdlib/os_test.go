@@ -0,0 +1,216 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testSecurityPolicy struct {
+	testFileSandbox
+	allowed []string
+}
+
+func (s *testSecurityPolicy) GetArgs() []string {
+	return []string{"prog", "foo"}
+}
+
+func (s *testSecurityPolicy) IsExecAllowed(cmd string) bool {
+	for _, a := range s.allowed {
+		if a == "*" || a == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *testSecurityPolicy) IsNetworkAllowed(address string) bool {
+	for _, a := range s.allowed {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+func runOSFunc(erp interface{}, name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("os." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, map[string]interface{}{"erp": erp}, 0, args)
+}
+
+func TestOSExec(t *testing.T) {
+	root, err := ioutil.TempDir("", "ecalostest")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(root)
+
+	os.Mkdir(filepath.Join(root, "sub"), 0755)
+
+	policy := &testSecurityPolicy{testFileSandbox{root}, []string{"sh"}}
+
+	res, err := runOSFunc(policy, "exec", "sh", []interface{}{"-c", "echo foo; echo bar >&2; exit 3"})
+	if err != nil || fmt.Sprint(res) != "map[exitCode:3 stderr:bar\n stdout:foo\n timeout:false]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = runOSFunc(policy, "exec", "sh", []interface{}{"-c", "true"},
+		map[interface{}]interface{}{"env": map[interface{}]interface{}{"LD_PRELOAD": "/tmp/evil.so"}}); err == nil ||
+		err.Error() != "Option env is not allowed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	res, err = runOSFunc(&testSecurityPolicy{testFileSandbox{root}, []string{"*"}}, "exec", "sh", []interface{}{"-c", "pwd; echo $FOO; cat"},
+		map[interface{}]interface{}{
+			"dir":   "sub",
+			"env":   map[interface{}]interface{}{"FOO": 123},
+			"stdin": "input",
+		})
+	if realRoot, _ := filepath.EvalSymlinks(root); err != nil || !strings.HasSuffix(fmt.Sprint(res),
+		fmt.Sprintf("stdout:%v\n123\ninput timeout:false]", filepath.Join(realRoot, "sub"))) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runOSFunc(policy, "exec", "sh", []interface{}{"-c", "exec sleep 5"},
+		map[interface{}]interface{}{"timeout": 0.1})
+	if err != nil || fmt.Sprint(res) != "map[exitCode:-1 stderr: stdout: timeout:true]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = runOSFunc(policy, "exec", "ls"); err == nil || err.Error() != "Execution of command ls is not allowed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runOSFunc(nil, "exec", "sh"); err == nil || err.Error() != "Execution of command sh is not allowed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	policy.allowed = append(policy.allowed, "ecal-unknown-command")
+
+	if _, err = runOSFunc(policy, "exec", "ecal-unknown-command"); err == nil ||
+		!strings.HasPrefix(err.Error(), "Could not execute command ecal-unknown-command") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runOSFunc(policy, "exec", "sh", "foo"); err == nil || err.Error() != "Parameter 2 should be a list" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runOSFunc(policy, "exec", "sh", nil, "foo"); err == nil || err.Error() != "Parameter 3 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runOSFunc(policy, "exec", "sh", nil, map[interface{}]interface{}{"timeout": "x"}); err == nil ||
+		err.Error() != "Option timeout should be a number" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runOSFunc(policy, "exec", "sh", nil, map[interface{}]interface{}{"env": "x"}); err == nil ||
+		err.Error() != "Option env should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runOSFunc(policy, "exec", "sh", nil, map[interface{}]interface{}{"dir": "../.."}); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runOSFunc(policy, "exec"); err == nil || err.Error() != "Need a command as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for name, f := range osFuncMap {
+		if doc, err := f.DocString(); doc == "" || err != nil {
+			t.Error("Missing docstring for:", name)
+			return
+		}
+	}
+}
+
+func TestOSEnvAndArgs(t *testing.T) {
+
+	if res, err := runOSFunc(nil, "args"); err != nil || fmt.Sprint(res) != "[]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	policy := &testSecurityPolicy{}
+
+	if res, err := runOSFunc(policy, "args"); err != nil || fmt.Sprint(res) != "[prog foo]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	policy = &testSecurityPolicy{allowed: []string{"*"}}
+
+	if _, err := runOSFunc(nil, "setenv", "PATH", "/tmp"); err == nil ||
+		err.Error() != "Changing environment variable PATH is not allowed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runOSFunc(&testSecurityPolicy{allowed: []string{"echo"}}, "setenv", "PATH", "/tmp"); err == nil ||
+		err.Error() != "Changing environment variable PATH is not allowed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runOSFunc(policy, "setenv", "ECAL_TEST_VAR", 123); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runOSFunc(nil, "env", "ECAL_TEST_VAR"); err != nil || res != "123" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := runOSFunc(nil, "env"); err != nil || res.(map[interface{}]interface{})["ECAL_TEST_VAR"] != "123" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runOSFunc(policy, "setenv", "ECAL_TEST_VAR"); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runOSFunc(nil, "env", "ECAL_TEST_VAR"); err != nil || res != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runOSFunc(policy, "setenv"); err == nil || err.Error() != "Need a variable name as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
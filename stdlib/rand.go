@@ -0,0 +1,241 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+randFuncMap contains all functions of the rand package.
+*/
+var randFuncMap = map[string]util.ECALFunction{
+	"seed":    &randSeedFunc{&baseFunc{}},
+	"float":   &randFloatFunc{&baseFunc{}},
+	"int":     &randIntFunc{&baseFunc{}},
+	"choice":  &randChoiceFunc{&baseFunc{}},
+	"shuffle": &randShuffleFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("rand", "Pseudo random number functions.", randFuncMap)
+}
+
+/*
+randSource is the random number generator of the rand package. It is
+seeded with the current time unless a seed is set with rand.seed.
+*/
+var randSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+/*
+randLock is the lock for randSource.
+*/
+var randLock = &sync.Mutex{}
+
+// seed
+// ====
+
+/*
+randSeedFunc seeds the random number generator.
+*/
+type randSeedFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *randSeedFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 1, "a seed")
+
+	if err == nil {
+		var seed float64
+
+		if seed, err = f.AssertNumParam(1, args[0]); err == nil {
+			randLock.Lock()
+			randSource.Seed(int64(seed))
+			randLock.Unlock()
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *randSeedFunc) DocString() (string, error) {
+	return "Seeds the random number generator to produce a reproducible sequence.", nil
+}
+
+// float
+// =====
+
+/*
+randFloatFunc returns a random number.
+*/
+type randFloatFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *randFloatFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	randLock.Lock()
+	defer randLock.Unlock()
+
+	return randSource.Float64(), nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *randFloatFunc) DocString() (string, error) {
+	return "Returns a random number in [0.0, 1.0).", nil
+}
+
+// int
+// ===
+
+/*
+randIntFunc returns a random integer in a range.
+*/
+type randIntFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *randIntFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var min, max float64
+
+	err := f.AssertMinParams(args, 2, "a minimum and a maximum")
+
+	if err == nil {
+		if min, err = f.AssertNumParam(1, args[0]); err == nil {
+			if max, err = f.AssertNumParam(2, args[1]); err == nil {
+				min, max = math.Ceil(min), math.Floor(max)
+
+				if max < min {
+					err = fmt.Errorf("Maximum %v is less than minimum %v", args[1], args[0])
+				} else {
+					randLock.Lock()
+					res = min + float64(randSource.Int63n(int64(max-min)+1))
+					randLock.Unlock()
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *randIntFunc) DocString() (string, error) {
+	return "Returns a random integer between a minimum and a maximum (both inclusive).", nil
+}
+
+// choice
+// ======
+
+/*
+randChoiceFunc returns a random item of a list.
+*/
+type randChoiceFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *randChoiceFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var list []interface{}
+
+	err := f.AssertMinParams(args, 1, "a list")
+
+	if err == nil {
+		if list, err = f.AssertListParam(1, args[0]); err == nil {
+			if len(list) == 0 {
+				err = fmt.Errorf("Cannot choose from an empty list")
+			} else {
+				randLock.Lock()
+				res = list[randSource.Intn(len(list))]
+				randLock.Unlock()
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *randChoiceFunc) DocString() (string, error) {
+	return "Returns a random item of a list.", nil
+}
+
+// shuffle
+// =======
+
+/*
+randShuffleFunc returns a shuffled copy of a list.
+*/
+type randShuffleFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *randShuffleFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var list []interface{}
+
+	err := f.AssertMinParams(args, 1, "a list")
+
+	if err == nil {
+		if list, err = f.AssertListParam(1, args[0]); err == nil {
+			shuffled := make([]interface{}, len(list))
+			copy(shuffled, list)
+
+			randLock.Lock()
+			randSource.Shuffle(len(shuffled), func(i, j int) {
+				shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+			})
+			randLock.Unlock()
+
+			res = shuffled
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *randShuffleFunc) DocString() (string, error) {
+	return "Returns a shuffled copy of a list.", nil
+}
@@ -0,0 +1,163 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"testing"
+)
+
+func runRandFunc(name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("rand." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, nil, 0, args)
+}
+
+func TestRandSeed(t *testing.T) {
+
+	sequence := func() string {
+		var res []interface{}
+
+		for i := 0; i < 5; i++ {
+			f, _ := runRandFunc("float")
+			n, _ := runRandFunc("int", 1, 100)
+			c, _ := runRandFunc("choice", []interface{}{"a", "b", "c"})
+			res = append(res, f, n, c)
+		}
+
+		s, _ := runRandFunc("shuffle", []interface{}{1, 2, 3, 4, 5, 6})
+
+		return fmt.Sprint(res, s)
+	}
+
+	if _, err := runRandFunc("seed", 42); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	seq1 := sequence()
+
+	runRandFunc("seed", 42)
+
+	if seq2 := sequence(); seq1 != seq2 {
+		t.Error("Unexpected result:", seq1, seq2)
+		return
+	}
+
+	runRandFunc("seed", 43)
+
+	if seq3 := sequence(); seq1 == seq3 {
+		t.Error("Unexpected result:", seq1, seq3)
+		return
+	}
+
+	if _, err := runRandFunc("seed"); err == nil || err.Error() != "Need a seed as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runRandFunc("seed", "foo"); err == nil || err.Error() != "Parameter 1 should be a number" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestRandFunctions(t *testing.T) {
+
+	for i := 0; i < 100; i++ {
+		if res, err := runRandFunc("float"); err != nil || res.(float64) < 0 || res.(float64) >= 1 {
+			t.Error("Unexpected result:", res, err)
+			return
+		}
+	}
+
+	seen := make(map[float64]bool)
+
+	for i := 0; i < 200; i++ {
+		res, err := runRandFunc("int", -1.5, 2)
+
+		if n := res.(float64); err != nil || n < -1 || n > 2 {
+			t.Error("Unexpected result:", res, err)
+			return
+		}
+
+		seen[res.(float64)] = true
+	}
+
+	if len(seen) != 4 {
+		t.Error("Unexpected result:", seen)
+		return
+	}
+
+	if res, err := runRandFunc("int", 5, 5); err != nil || res != float64(5) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runRandFunc("int", 5, 4); err == nil || err.Error() != "Maximum 4 is less than minimum 5" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runRandFunc("int", 5); err == nil || err.Error() != "Need a minimum and a maximum as parameters" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runRandFunc("int", 5, "x"); err == nil || err.Error() != "Parameter 2 should be a number" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runRandFunc("choice", []interface{}{"a"}); err != nil || res != "a" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runRandFunc("choice", []interface{}{}); err == nil || err.Error() != "Cannot choose from an empty list" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runRandFunc("choice", "a"); err == nil || err.Error() != "Parameter 1 should be a list" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	list := []interface{}{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	res, err := runRandFunc("shuffle", list)
+
+	if shuffled := res.([]interface{}); err != nil || len(shuffled) != len(list) ||
+		fmt.Sprint(list) != "[1 2 3 4 5 6 7 8 9 10]" {
+		t.Error("Unexpected result:", res, list, err)
+		return
+	}
+
+	if res, err := runRandFunc("shuffle", []interface{}{}); err != nil || fmt.Sprint(res) != "[]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runRandFunc("shuffle"); err == nil || err.Error() != "Need a list as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for name, f := range randFuncMap {
+		if res, _ := f.DocString(); res == "" {
+			t.Error("Unexpected result:", name, res)
+			return
+		}
+	}
+}
@@ -14,7 +14,10 @@ import (
 	"fmt"
 	"plugin"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/krotik/ecal/util"
 )
@@ -29,6 +32,47 @@ internalStdlibDocMap holds the docstrings for all registered functions
 */
 var internalStdlibDocMap = make(map[string]string)
 
+/*
+internalStdlibPluginMap holds all functions which were loaded from plugins
+*/
+var internalStdlibPluginMap = make(map[string]*StdlibPlugin)
+
+/*
+internalStdlibLock is the lock for the internal maps which can be changed
+while the interpreter is running
+*/
+var internalStdlibLock = &sync.RWMutex{}
+
+/*
+StdlibPlugin is a stdlib function which was loaded from a plugin.
+*/
+type StdlibPlugin struct {
+	Package string // Package of the function
+	Name    string // Name of the function
+	Path    string // Path of the plugin file
+	Symbol  string // Symbol of the function in the plugin
+
+	PluginName    string // Name of the plugin from its manifest
+	PluginVersion string // Version of the plugin from its manifest
+
+	calls    int32 // Number of running calls of the function
+	unloaded int32 // Flag if the function was unloaded
+}
+
+/*
+FullName returns the full name of the plugin function.
+*/
+func (p *StdlibPlugin) FullName() string {
+	return fmt.Sprintf("%v.%v", p.Package, p.Name)
+}
+
+/*
+Calls returns the number of running calls of the plugin function.
+*/
+func (p *StdlibPlugin) Calls() int {
+	return int(atomic.LoadInt32(&p.calls))
+}
+
 /*
 pluginLookup is an interface for required function of the plugin object - only used for unit testing.
 */
@@ -46,13 +90,13 @@ AddStdlibPkg adds a package to stdlib. A package needs to be added before functi
 can be added.
 */
 func AddStdlibPkg(pkg string, docstring string) error {
-	_, ok1 := GetPkgDocString(pkg)
-	_, ok2 := internalStdlibDocMap[pkg]
-
-	if ok1 || ok2 {
+	if _, ok := GetPkgDocString(pkg); ok {
 		return fmt.Errorf("Package %v already exists", pkg)
 	}
 
+	internalStdlibLock.Lock()
+	defer internalStdlibLock.Unlock()
+
 	internalStdlibDocMap[pkg] = docstring
 
 	return nil
@@ -62,13 +106,13 @@ func AddStdlibPkg(pkg string, docstring string) error {
 AddStdlibFunc adds a function to stdlib.
 */
 func AddStdlibFunc(pkg string, name string, funcObj util.ECALFunction) error {
-	_, ok1 := GetPkgDocString(pkg)
-	_, ok2 := internalStdlibDocMap[pkg]
-
-	if !ok1 && !ok2 {
+	if _, ok := GetPkgDocString(pkg); !ok {
 		return fmt.Errorf("Package %v does not exist", pkg)
 	}
 
+	internalStdlibLock.Lock()
+	defer internalStdlibLock.Unlock()
+
 	internalStdlibFuncMap[fmt.Sprintf("%v.%v", pkg, name)] = funcObj
 
 	return nil
@@ -108,14 +152,19 @@ The plugin needs to be build as a Go plugin (https://golang.org/pkg/plugin):
 go build -buildmode=plugin -o myfunc.so myfunc.go
 
 And have an exported variable (passed here as symName) which conforms
-to util.ECALPluginFunction.
+to util.ECALPluginFunction. The plugin can export a manifest variable
+ECALPluginManifest which conforms to util.ECALPluginManifest. Plugins which
+declare a different plugin API version than util.ECALPluginAPIVersion are
+rejected. A function which was previously loaded from a plugin is replaced
+unless it is still running.
+
+Note: Go caches opened plugins by their path - a changed plugin file needs
+to be loaded from a new path.
 */
 func AddStdlibPluginFunc(pkg string, name string, path string, symName string) error {
 	var err error
 	var plug pluginLookup
 
-	AddStdlibPkg(pkg, "Functions provided by plugins")
-
 	if plug, err = plugin.Open(path); err == nil || pluginTestLookup != nil {
 		var sym plugin.Symbol
 
@@ -123,16 +172,50 @@ func AddStdlibPluginFunc(pkg string, name string, path string, symName string) e
 			plug = pluginTestLookup
 		}
 
-		if sym, err = plug.Lookup(symName); err == nil {
+		var manifest util.ECALPluginManifest
+
+		if manifest, err = lookupPluginManifest(plug, path); err == nil {
+			sym, err = plug.Lookup(symName)
+		}
+
+		if err == nil {
 
 			if stdlibPluginFunc, ok := sym.(util.ECALPluginFunction); ok {
+				p := &StdlibPlugin{pkg, name, path, symName, "", "", 0, 0}
+
+				if manifest != nil {
+					p.PluginName = manifest.Name()
+					p.PluginVersion = manifest.Version()
+				}
 
 				adapterFunc := func(a ...interface{}) (interface{}, error) {
+
+					// Track running calls so the function is not unloaded while in use
+
+					atomic.AddInt32(&p.calls, 1)
+					defer atomic.AddInt32(&p.calls, -1)
+
+					if atomic.LoadInt32(&p.unloaded) == 1 {
+						return nil, fmt.Errorf("Plugin function %v was unloaded", p.FullName())
+					}
+
 					return stdlibPluginFunc.Run(a)
 				}
 
-				err = AddStdlibFunc(pkg, name, &ECALFunctionAdapter{
-					reflect.ValueOf(adapterFunc), stdlibPluginFunc.DocString()})
+				if err = unloadStdlibPluginFunc(p.FullName(), false); err == nil {
+
+					// Unloading may have removed the package of the function
+
+					AddStdlibPkg(pkg, "Functions provided by plugins")
+
+					if err = AddStdlibFunc(pkg, name, &ECALFunctionAdapter{
+						reflect.ValueOf(adapterFunc), stdlibPluginFunc.DocString()}); err == nil {
+
+						internalStdlibLock.Lock()
+						internalStdlibPluginMap[p.FullName()] = p
+						internalStdlibLock.Unlock()
+					}
+				}
 
 			} else {
 
@@ -144,6 +227,122 @@ func AddStdlibPluginFunc(pkg string, name string, path string, symName string) e
 	return err
 }
 
+/*
+lookupPluginManifest looks up the manifest of a plugin and checks that the
+plugin was written for the supported plugin API version. Returns nil if the
+plugin has no manifest.
+*/
+func lookupPluginManifest(plug pluginLookup, path string) (util.ECALPluginManifest, error) {
+	sym, err := plug.Lookup(util.ECALPluginManifestSymbol)
+
+	if err != nil {
+		return nil, nil
+	}
+
+	manifest, ok := sym.(util.ECALPluginManifest)
+
+	if !ok {
+		return nil, fmt.Errorf("Symbol %v in plugin %v is not a plugin manifest",
+			util.ECALPluginManifestSymbol, path)
+	}
+
+	if v := manifest.APIVersion(); v != util.ECALPluginAPIVersion {
+		return nil, fmt.Errorf("Plugin %v %v (%v) requires plugin API version %v - supported version is %v",
+			manifest.Name(), manifest.Version(), path, v, util.ECALPluginAPIVersion)
+	}
+
+	return manifest, nil
+}
+
+/*
+ReloadStdlibPluginFunc loads a function which was loaded from a plugin again
+from the same plugin file and symbol.
+*/
+func ReloadStdlibPluginFunc(fullName string) error {
+	internalStdlibLock.RLock()
+	p, ok := internalStdlibPluginMap[fullName]
+	internalStdlibLock.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("Function %v was not loaded from a plugin", fullName)
+	}
+
+	return AddStdlibPluginFunc(p.Package, p.Name, p.Path, p.Symbol)
+}
+
+/*
+UnloadStdlibPluginFunc removes a function which was loaded from a plugin. A
+function cannot be unloaded while it is running. Already parsed code which
+still refers to the function gets an error when calling it.
+*/
+func UnloadStdlibPluginFunc(fullName string) error {
+	return unloadStdlibPluginFunc(fullName, true)
+}
+
+/*
+unloadStdlibPluginFunc removes a function which was loaded from a plugin. It
+is an error if the function was not loaded from a plugin and mustExist is set.
+*/
+func unloadStdlibPluginFunc(fullName string, mustExist bool) error {
+	internalStdlibLock.Lock()
+	defer internalStdlibLock.Unlock()
+
+	p, ok := internalStdlibPluginMap[fullName]
+
+	if !ok {
+		if mustExist {
+			return fmt.Errorf("Function %v was not loaded from a plugin", fullName)
+		}
+		return nil
+	}
+
+	// Mark the function as unloaded before checking for running calls so no
+	// new call can start unnoticed
+
+	atomic.StoreInt32(&p.unloaded, 1)
+
+	if calls := p.Calls(); calls > 0 {
+		atomic.StoreInt32(&p.unloaded, 0)
+		return fmt.Errorf("Function %v is still in use (%v running calls)", fullName, calls)
+	}
+
+	delete(internalStdlibPluginMap, fullName)
+	delete(internalStdlibFuncMap, fullName)
+
+	// Remove the package if it has no more functions
+
+	for k := range internalStdlibFuncMap {
+		if strings.HasPrefix(k, p.Package+".") {
+			return nil
+		}
+	}
+
+	delete(internalStdlibDocMap, p.Package)
+
+	return nil
+}
+
+/*
+GetStdlibPlugins returns all functions which were loaded from plugins ordered
+by their full name.
+*/
+func GetStdlibPlugins() []*StdlibPlugin {
+	var res []*StdlibPlugin
+
+	internalStdlibLock.RLock()
+	defer internalStdlibLock.RUnlock()
+
+	for _, p := range internalStdlibPluginMap {
+		res = append(res, p)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].FullName() < res[j].FullName()
+	})
+
+	return res
+}
+
 /*
 GetStdlibSymbols returns all available packages of stdlib and their constant
 and function symbols.
@@ -183,6 +382,9 @@ func GetStdlibSymbols() ([]string, []string, []string) {
 
 	// Add internal stuff
 
+	internalStdlibLock.RLock()
+	defer internalStdlibLock.RUnlock()
+
 	for k := range internalStdlibDocMap {
 		packageNames = append(packageNames, k)
 	}
@@ -226,7 +428,9 @@ func GetStdlibFunc(name string) (util.ECALFunction, bool) {
 	}
 
 	if !resok {
+		internalStdlibLock.RLock()
 		res, resok = internalStdlibFuncMap[name]
+		internalStdlibLock.RUnlock()
 	}
 
 	return res, resok
@@ -241,7 +445,9 @@ func GetPkgDocString(name string) (string, bool) {
 	if ok {
 		res = fmt.Sprint(s)
 	} else {
+		internalStdlibLock.RLock()
 		res, ok = internalStdlibDocMap[name]
+		internalStdlibLock.RUnlock()
 	}
 
 	return res, ok
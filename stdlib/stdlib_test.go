@@ -17,6 +17,10 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/krotik/common/errorutil"
+	"github.com/krotik/ecal/util"
 )
 
 func TestGetPkgDocString(t *testing.T) {
@@ -147,7 +151,7 @@ func TestAddPluginStdLibFunc(t *testing.T) {
 		}
 	*/
 
-	pluginTestLookup = &testLookup{&testECALPluginFunction{}, nil}
+	pluginTestLookup = &testLookup{&testECALPluginFunction{nil, nil}, nil, nil}
 
 	err = AddStdlibPluginFunc("foo", "bar", "", "ECALmyfunc")
 
@@ -158,7 +162,7 @@ func TestAddPluginStdLibFunc(t *testing.T) {
 		return
 	}
 
-	pluginTestLookup = &testLookup{&testECALPluginFunction{}, nil}
+	pluginTestLookup = &testLookup{&testECALPluginFunction{nil, nil}, nil, nil}
 
 	errs := LoadStdlibPlugins([]interface{}{
 		map[string]interface{}{
@@ -214,7 +218,7 @@ func TestAddPluginStdLibFunc(t *testing.T) {
 		}
 	*/
 
-	pluginTestLookup = &testLookup{"foo", nil}
+	pluginTestLookup = &testLookup{"foo", nil, nil}
 	err = AddStdlibPluginFunc("foo", "bar", "", "Greeting")
 
 	if err == nil || err.Error() != "Symbol Greeting is not a stdlib function" {
@@ -222,28 +226,165 @@ func TestAddPluginStdLibFunc(t *testing.T) {
 		return
 	}
 
-	pluginTestLookup = &testLookup{nil, fmt.Errorf("symbol foo not found")}
+	pluginTestLookup = &testLookup{nil, fmt.Errorf("symbol foo not found"), nil}
 	err = AddStdlibPluginFunc("foo", "bar", "", "foo")
 
 	if err == nil || !strings.Contains(err.Error(), "symbol foo not found") {
 		t.Error("Unexpected result:", err)
 		return
 	}
+
+	// Test plugin manifest
+
+	pluginTestLookup = &testLookup{&testECALPluginFunction{nil, nil}, nil,
+		&testECALPluginManifest{util.ECALPluginAPIVersion}}
+	err = AddStdlibPluginFunc("foo", "bar", "myplugin.so", "ECALmyfunc")
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	p := GetStdlibPlugins()[0]
+
+	if res := fmt.Sprint(p.FullName(), " ", p.PluginName, " ", p.PluginVersion); res != "foo.bar myplugin 1.2.3" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	pluginTestLookup = &testLookup{&testECALPluginFunction{nil, nil}, nil,
+		&testECALPluginManifest{util.ECALPluginAPIVersion + 1}}
+	err = AddStdlibPluginFunc("foo", "bar", "myplugin.so", "ECALmyfunc")
+
+	if err == nil || err.Error() != fmt.Sprintf("Plugin myplugin 1.2.3 (myplugin.so) requires plugin API version %v - supported version is %v",
+		util.ECALPluginAPIVersion+1, util.ECALPluginAPIVersion) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	pluginTestLookup = &testLookup{&testECALPluginFunction{nil, nil}, nil, "foo"}
+	err = AddStdlibPluginFunc("foo", "bar", "myplugin.so", "ECALmyfunc")
+
+	pluginTestLookup = nil
+
+	if err == nil || err.Error() != "Symbol ECALPluginManifest in plugin myplugin.so is not a plugin manifest" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// The previously loaded function is still available
+
+	if p := GetStdlibPlugins()[0]; p.PluginVersion != "1.2.3" {
+		t.Error("Unexpected result:", p)
+		return
+	}
+
+	errorutil.AssertOk(UnloadStdlibPluginFunc("foo.bar"))
+}
+
+func TestUnloadPluginStdLibFunc(t *testing.T) {
+	block := make(chan bool)
+	running := make(chan bool)
+
+	pluginTestLookup = &testLookup{&testECALPluginFunction{block, running}, nil, nil}
+	defer func() {
+		pluginTestLookup = nil
+	}()
+
+	errorutil.AssertOk(AddStdlibPluginFunc("plug", "greet", "myplugin.so", "ECALmyfunc"))
+
+	if res := fmt.Sprint(len(GetStdlibPlugins()), GetStdlibPlugins()[0].FullName(),
+		GetStdlibPlugins()[0].Path); res != "1plug.greetmyplugin.so" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	pfunc, _ := GetStdlibFunc("plug.greet")
+
+	// Functions cannot be unloaded or replaced while they are running
+
+	go pfunc.Run("", nil, nil, 0, []interface{}{"block"})
+	<-running
+
+	if err := UnloadStdlibPluginFunc("plug.greet"); err == nil ||
+		err.Error() != "Function plug.greet is still in use (1 running calls)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := ReloadStdlibPluginFunc("plug.greet"); err == nil ||
+		err.Error() != "Function plug.greet is still in use (1 running calls)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	block <- true
+
+	for GetStdlibPlugins()[0].Calls() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	errorutil.AssertOk(ReloadStdlibPluginFunc("plug.greet"))
+
+	if res, err := pfunc.Run("", nil, nil, 0, []interface{}{"John"}); err == nil ||
+		err.Error() != "Plugin function plug.greet was unloaded" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	pfunc, _ = GetStdlibFunc("plug.greet")
+
+	if res, err := pfunc.Run("", nil, nil, 0, []interface{}{"John"}); err != nil || res != "Hello World for John" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	errorutil.AssertOk(UnloadStdlibPluginFunc("plug.greet"))
+
+	if _, ok := GetStdlibFunc("plug.greet"); ok {
+		t.Error("Function should have been unloaded")
+		return
+	}
+
+	if _, ok := GetPkgDocString("plug"); ok {
+		t.Error("Package should have been removed")
+		return
+	}
+
+	if err := UnloadStdlibPluginFunc("plug.greet"); err == nil ||
+		err.Error() != "Function plug.greet was not loaded from a plugin" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if err := ReloadStdlibPluginFunc("plug.greet"); err == nil ||
+		err.Error() != "Function plug.greet was not loaded from a plugin" {
+		t.Error("Unexpected result:", err)
+		return
+	}
 }
 
 type testLookup struct {
-	ret interface{}
-	err error
+	ret      interface{}
+	err      error
+	manifest interface{}
 }
 
 func (tl *testLookup) Lookup(symName string) (plugin.Symbol, error) {
 	if symName == "showerror" {
 		return nil, fmt.Errorf("Test lookup error")
+	} else if symName == util.ECALPluginManifestSymbol {
+		if tl.manifest == nil {
+			return nil, fmt.Errorf("symbol %v not found", symName)
+		}
+		return tl.manifest, nil
 	}
 	return tl.ret, tl.err
 }
 
 type testECALPluginFunction struct {
+	block   chan bool
+	running chan bool
 }
 
 func (tf *testECALPluginFunction) Run(args []interface{}) (interface{}, error) {
@@ -251,9 +392,30 @@ func (tf *testECALPluginFunction) Run(args []interface{}) (interface{}, error) {
 		return "", fmt.Errorf("Need a name to greet as argument")
 	}
 
+	if args[0] == "block" {
+		tf.running <- true
+		<-tf.block
+	}
+
 	return fmt.Sprintf("Hello World for %v", args[0]), nil
 }
 
 func (tf *testECALPluginFunction) DocString() string {
 	return "Myfunc is an example function"
 }
+
+type testECALPluginManifest struct {
+	apiVersion int
+}
+
+func (tm *testECALPluginManifest) Name() string {
+	return "myplugin"
+}
+
+func (tm *testECALPluginManifest) Version() string {
+	return "1.2.3"
+}
+
+func (tm *testECALPluginManifest) APIVersion() int {
+	return tm.apiVersion
+}
@@ -0,0 +1,149 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+templateFuncMap contains all functions of the template package.
+*/
+var templateFuncMap = map[string]util.ECALFunction{
+	"render": &templateRenderFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("template", "Text and HTML templating functions.", templateFuncMap)
+}
+
+/*
+templateFunctions is the set of functions which can be used inside templates.
+The set only contains functions without side effects.
+*/
+var templateFunctions = map[string]interface{}{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+	"replace":  strings.ReplaceAll,
+	"contains": strings.Contains,
+	"join": func(list []interface{}, sep string) string {
+		strs := make([]string, 0, len(list))
+		for _, i := range list {
+			strs = append(strs, fmt.Sprint(i))
+		}
+		return strings.Join(strs, sep)
+	},
+	"json": func(val interface{}) (string, error) {
+		res, err := json.Marshal(val)
+		return string(res), err
+	},
+	"default": func(def interface{}, val interface{}) interface{} {
+		if val == nil || val == "" {
+			return def
+		}
+		return val
+	},
+}
+
+/*
+templateData converts ECAL values into values which can be accessed from
+templates. Maps get string keys so their values can be accessed by name.
+*/
+func templateData(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, mv := range v {
+			res[fmt.Sprint(k)] = templateData(mv)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, lv := range v {
+			res[i] = templateData(lv)
+		}
+		return res
+	}
+
+	return val
+}
+
+// render
+// ======
+
+/*
+templateRenderFunc renders a template with given data.
+*/
+type templateRenderFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *templateRenderFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var options map[interface{}]interface{}
+
+	err := f.AssertMinParams(args, 1, "a template string")
+
+	if err == nil && len(args) > 2 && args[2] != nil {
+		options, err = f.AssertMapParam(3, args[2])
+	}
+
+	if err == nil {
+		var data interface{}
+		var buf bytes.Buffer
+
+		if len(args) > 1 {
+			data = templateData(args[1])
+		}
+
+		if html, ok := options["html"]; ok && html == true {
+			var tmpl *htmltemplate.Template
+
+			if tmpl, err = htmltemplate.New("template").Funcs(templateFunctions).Parse(fmt.Sprint(args[0])); err == nil {
+				err = tmpl.Execute(&buf, data)
+			}
+
+		} else {
+			var tmpl *texttemplate.Template
+
+			if tmpl, err = texttemplate.New("template").Funcs(templateFunctions).Parse(fmt.Sprint(args[0])); err == nil {
+				err = tmpl.Execute(&buf, data)
+			}
+		}
+
+		if err == nil {
+			res = buf.String()
+		} else {
+			err = fmt.Errorf("Could not render template: %v", err)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *templateRenderFunc) DocString() (string, error) {
+	return "Renders a Go template with a data map and optional options (html).", nil
+}
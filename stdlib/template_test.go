@@ -0,0 +1,96 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplateRender(t *testing.T) {
+	render, _ := GetStdlibFunc("template.render")
+
+	data := map[interface{}]interface{}{
+		"name":  "foo",
+		"count": float64(3),
+		"items": []interface{}{"a", float64(1), map[interface{}]interface{}{"x": "y"}},
+		"tags":  []interface{}{"b", "c"},
+	}
+
+	res, err := render.Run("", nil, nil, 0, []interface{}{
+		`Hello {{upper .name}} ({{.count}}){{range .items}} [{{.}}]{{end}} {{join .tags ", "}} {{default "none" .missing}}`, data})
+
+	if err != nil || res != "Hello FOO (3) [a] [1] [map[x:y]] b, c none" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = render.Run("", nil, nil, 0, []interface{}{
+		`{{json .items}} {{index .items 2 "x"}} {{if contains .name "o"}}yes{{end}}`, data})
+
+	if err != nil || res != `["a",1,{"x":"y"}] y yes` {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	data["name"] = "<b>foo</b>"
+
+	res, err = render.Run("", nil, nil, 0, []interface{}{"<p>{{.name}}</p>", data,
+		map[interface{}]interface{}{"html": true}})
+
+	if err != nil || res != "<p>&lt;b&gt;foo&lt;/b&gt;</p>" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = render.Run("", nil, nil, 0, []interface{}{"<p>{{.name}}</p>", data})
+
+	if err != nil || res != "<p><b>foo</b></p>" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = render.Run("", nil, nil, 0, []interface{}{"no data"})
+
+	if err != nil || res != "no data" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = render.Run("", nil, nil, 0, []interface{}{}); err == nil ||
+		err.Error() != "Need a template string as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = render.Run("", nil, nil, 0, []interface{}{"{{.foo", data}); err == nil ||
+		!strings.HasPrefix(err.Error(), "Could not render template:") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = render.Run("", nil, nil, 0, []interface{}{"{{exec .foo}}", data}); err == nil ||
+		!strings.Contains(err.Error(), `function "exec" not defined`) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = render.Run("", nil, nil, 0, []interface{}{"", data, "foo"}); err == nil ||
+		err.Error() != "Parameter 3 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, _ := render.DocString(); res == "" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+}
@@ -0,0 +1,534 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+timeFuncMap contains all functions of the time package.
+*/
+var timeFuncMap = map[string]util.ECALFunction{
+	"now":     &timeNowFunc{&baseFunc{}},
+	"parse":   &timeParseFunc{&baseFunc{}},
+	"format":  &timeFormatFunc{&baseFunc{}},
+	"add":     &timeAddFunc{&baseFunc{}},
+	"diff":    &timeDiffFunc{&baseFunc{}},
+	"toMap":   &timeToMapFunc{&baseFunc{}},
+	"fromMap": &timeFromMapFunc{&baseFunc{}},
+	"convert": &timeConvertFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("time", "Date and time functions. Timestamps are seconds since epoch.", timeFuncMap)
+}
+
+/*
+timeLayoutAliases maps names of predefined layouts to their Go layout strings.
+*/
+var timeLayoutAliases = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Date":        "2006-01-02",
+	"DateTime":    "2006-01-02 15:04:05",
+	"Time":        "15:04:05",
+}
+
+/*
+timeUnits maps unit names to durations. Units which are not in this map
+are handled as calendar units.
+*/
+var timeUnits = map[string]time.Duration{
+	"millisecond": time.Millisecond,
+	"second":      time.Second,
+	"minute":      time.Minute,
+	"hour":        time.Hour,
+	"day":         24 * time.Hour,
+}
+
+/*
+timeLayout returns the Go layout string for a given layout parameter.
+*/
+func timeLayout(layout interface{}) string {
+	l := fmt.Sprint(layout)
+
+	if alias, ok := timeLayoutAliases[l]; ok {
+		return alias
+	}
+
+	return l
+}
+
+/*
+timeLocation returns a location from an optional parameter. The local
+timezone is returned if no parameter was given.
+*/
+func timeLocation(args []interface{}, index int) (*time.Location, error) {
+	if len(args) <= index {
+		return time.Local, nil
+	}
+
+	loc, err := time.LoadLocation(fmt.Sprint(args[index]))
+	if err != nil {
+		err = fmt.Errorf("Unknown timezone: %v", args[index])
+	}
+
+	return loc, err
+}
+
+/*
+timeToTimestamp converts a time object into seconds since epoch.
+*/
+func timeToTimestamp(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+/*
+timestampToTime converts seconds since epoch into a time object.
+*/
+func timestampToTime(ts float64) time.Time {
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(math.Round(frac*float64(time.Second))))
+}
+
+/*
+timeToMap converts a time object into a broken-down time map.
+*/
+func timeToMap(t time.Time) map[interface{}]interface{} {
+	zone, offset := t.Zone()
+
+	return map[interface{}]interface{}{
+		"year":       float64(t.Year()),
+		"month":      float64(t.Month()),
+		"day":        float64(t.Day()),
+		"hour":       float64(t.Hour()),
+		"minute":     float64(t.Minute()),
+		"second":     float64(t.Second()),
+		"nanosecond": float64(t.Nanosecond()),
+		"weekday":    float64(t.Weekday()),
+		"yearday":    float64(t.YearDay()),
+		"zone":       zone,
+		"offset":     float64(offset),
+		"timezone":   t.Location().String(),
+	}
+}
+
+/*
+AssertTimeParam converts a general interface{} parameter into a time object.
+A time parameter can be a timestamp, a broken-down time map or a Go time object.
+*/
+func (bf *baseFunc) AssertTimeParam(index int, val interface{}) (time.Time, error) {
+	if t, ok := val.(time.Time); ok {
+		return t, nil
+	}
+
+	if m, ok := val.(map[interface{}]interface{}); ok {
+		return bf.mapToTime(index, m)
+	}
+
+	ts, err := bf.AssertNumParam(index, val)
+	if err != nil {
+		err = fmt.Errorf("Parameter %v should be a timestamp or a time map", index)
+	}
+
+	return timestampToTime(ts), err
+}
+
+/*
+mapToTime converts a broken-down time map into a time object.
+*/
+func (bf *baseFunc) mapToTime(index int, m map[interface{}]interface{}) (time.Time, error) {
+	var err error
+
+	loc := time.Local
+	vals := make(map[string]int)
+
+	for _, k := range []string{"year", "month", "day", "hour", "minute", "second", "nanosecond"} {
+		var num float64
+
+		v, ok := m[k]
+		if !ok {
+			if k == "month" || k == "day" {
+				num = 1
+			}
+		} else if num, err = bf.AssertNumParam(index, v); err != nil {
+			return time.Time{}, fmt.Errorf("Parameter %v has an invalid %v value: %v", index, k, v)
+		}
+
+		vals[k] = int(num)
+	}
+
+	if tz, ok := m["timezone"]; ok {
+		if loc, err = time.LoadLocation(fmt.Sprint(tz)); err != nil {
+			return time.Time{}, fmt.Errorf("Unknown timezone: %v", tz)
+		}
+	}
+
+	return time.Date(vals["year"], time.Month(vals["month"]), vals["day"],
+		vals["hour"], vals["minute"], vals["second"], vals["nanosecond"], loc), nil
+}
+
+// now
+// ===
+
+/*
+timeNowFunc returns the current time.
+*/
+type timeNowFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *timeNowFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	return timeToTimestamp(time.Now()), nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *timeNowFunc) DocString() (string, error) {
+	return "Returns the current time as seconds since epoch.", nil
+}
+
+// parse
+// =====
+
+/*
+timeParseFunc parses a time string.
+*/
+type timeParseFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *timeParseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 2, "a layout and a time string")
+
+	if err == nil {
+		var loc *time.Location
+
+		if loc, err = timeLocation(args, 2); err == nil {
+			var t time.Time
+
+			if t, err = time.ParseInLocation(timeLayout(args[0]), fmt.Sprint(args[1]), loc); err == nil {
+				res = timeToTimestamp(t)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *timeParseFunc) DocString() (string, error) {
+	return "Parses a time string with a given layout and optional timezone into seconds since epoch.", nil
+}
+
+// format
+// ======
+
+/*
+timeFormatFunc formats a time.
+*/
+type timeFormatFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *timeFormatFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 2, "a time and a layout")
+
+	if err == nil {
+		var t time.Time
+
+		if t, err = f.AssertTimeParam(1, args[0]); err == nil {
+			var loc *time.Location
+
+			if loc, err = timeLocation(args, 2); err == nil {
+				res = t.In(loc).Format(timeLayout(args[1]))
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *timeFormatFunc) DocString() (string, error) {
+	return "Formats a time with a given layout and optional timezone.", nil
+}
+
+// add
+// ===
+
+/*
+timeAddFunc adds a value to a time.
+*/
+type timeAddFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *timeAddFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 2, "a time and a value")
+
+	if err == nil {
+		var t time.Time
+		var val float64
+
+		if t, err = f.AssertTimeParam(1, args[0]); err == nil {
+			if val, err = f.AssertNumParam(2, args[1]); err == nil {
+				var loc *time.Location
+
+				unit := "second"
+				if len(args) > 2 {
+					unit = strings.TrimSuffix(fmt.Sprint(args[2]), "s")
+				}
+
+				if loc, err = timeLocation(args, 3); err == nil {
+					t = t.In(loc)
+
+					// Calendar units respect daylight saving time changes
+
+					switch unit {
+					case "day":
+						t = t.AddDate(0, 0, int(val))
+					case "month":
+						t = t.AddDate(0, int(val), 0)
+					case "year":
+						t = t.AddDate(int(val), 0, 0)
+					default:
+						if d, ok := timeUnits[unit]; ok {
+							t = t.Add(time.Duration(val * float64(d)))
+						} else {
+							err = fmt.Errorf("Unknown time unit: %v", args[2])
+						}
+					}
+
+					if err == nil {
+						res = timeToTimestamp(t)
+					}
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *timeAddFunc) DocString() (string, error) {
+	return "Adds a value of a given unit (default is second) to a time.", nil
+}
+
+// diff
+// ====
+
+/*
+timeDiffFunc calculates the difference between two times.
+*/
+type timeDiffFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *timeDiffFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 2, "two times")
+
+	if err == nil {
+		var t1, t2 time.Time
+
+		if t1, err = f.AssertTimeParam(1, args[0]); err == nil {
+			if t2, err = f.AssertTimeParam(2, args[1]); err == nil {
+
+				unit := "second"
+				if len(args) > 2 {
+					unit = strings.TrimSuffix(fmt.Sprint(args[2]), "s")
+				}
+
+				if d, ok := timeUnits[unit]; ok {
+					res = float64(t2.Sub(t1)) / float64(d)
+				} else {
+					err = fmt.Errorf("Unknown time unit: %v", args[2])
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *timeDiffFunc) DocString() (string, error) {
+	return "Returns the difference between two times in a given unit (default is second).", nil
+}
+
+// toMap
+// =====
+
+/*
+timeToMapFunc converts a time into a broken-down time map.
+*/
+type timeToMapFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *timeToMapFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a time")
+
+	if err == nil {
+		var t time.Time
+
+		if t, err = f.AssertTimeParam(1, args[0]); err == nil {
+			var loc *time.Location
+
+			if loc, err = timeLocation(args, 1); err == nil {
+				res = timeToMap(t.In(loc))
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *timeToMapFunc) DocString() (string, error) {
+	return "Converts a time into a map with its components in an optional timezone.", nil
+}
+
+// fromMap
+// =======
+
+/*
+timeFromMapFunc converts a broken-down time map into a timestamp.
+*/
+type timeFromMapFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *timeFromMapFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a time map")
+
+	if err == nil {
+		var m map[interface{}]interface{}
+
+		if m, err = f.AssertMapParam(1, args[0]); err == nil {
+			var t time.Time
+
+			if t, err = f.mapToTime(1, m); err == nil {
+				res = timeToTimestamp(t)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *timeFromMapFunc) DocString() (string, error) {
+	return "Converts a map with time components into seconds since epoch.", nil
+}
+
+// convert
+// =======
+
+/*
+timeConvertFunc converts a time into a different timezone.
+*/
+type timeConvertFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *timeConvertFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 2, "a time and a timezone")
+
+	if err == nil {
+		var t time.Time
+
+		if t, err = f.AssertTimeParam(1, args[0]); err == nil {
+			var loc *time.Location
+
+			if loc, err = timeLocation(args, 1); err == nil {
+				res = timeToMap(t.In(loc))
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *timeConvertFunc) DocString() (string, error) {
+	return "Converts a time into a time map of a given timezone.", nil
+}
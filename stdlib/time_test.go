@@ -0,0 +1,218 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func runTimeFunc(name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("time." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, nil, 0, args)
+}
+
+func TestTimeParseFormat(t *testing.T) {
+
+	res, err := runTimeFunc("parse", "RFC3339", "2020-12-24T10:11:12Z")
+	if err != nil || res != float64(1608804672) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("parse", "DateTime", "2020-12-24 10:11:12", "Europe/Berlin")
+	if err != nil || res != float64(1608801072) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("format", 1608804672.5, "2006-01-02 15:04:05.000", "UTC")
+	if err != nil || res != "2020-12-24 10:11:12.500" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("format", time.Unix(1608804672, 0), "RFC1123", "Europe/Berlin")
+	if err != nil || res != "Thu, 24 Dec 2020 11:11:12 CET" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = runTimeFunc("parse", "Date", "foo"); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runTimeFunc("parse", "Date"); err == nil ||
+		err.Error() != "Need a layout and a time string as parameters" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runTimeFunc("format", 1, "Date", "foo/bar"); err == nil ||
+		err.Error() != "Unknown timezone: foo/bar" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runTimeFunc("format", "x", "Date"); err == nil ||
+		err.Error() != "Parameter 1 should be a timestamp or a time map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	now := float64(time.Now().Unix())
+	res, err = runTimeFunc("now")
+	if err != nil || res.(float64) < now {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+}
+
+func TestTimeArithmetic(t *testing.T) {
+
+	res, err := runTimeFunc("add", 1608804672, 90)
+	if err != nil || res != float64(1608804762) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("add", 1608804672, 1.5, "hours")
+	if err != nil || res != float64(1608810072) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("add", 1608804672, 2, "month", "UTC")
+	if err != nil || res != float64(1614161472) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("add", 1608804672, -1, "year", "UTC")
+	if err != nil || res != float64(1577182272) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// A day in Berlin across the daylight saving time change has 23 hours
+
+	res, err = runTimeFunc("add", 1616846400, 1, "day", "Europe/Berlin")
+	if err != nil || res != float64(1616846400+23*3600) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = runTimeFunc("add", 1, 1, "foo"); err == nil || err.Error() != "Unknown time unit: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runTimeFunc("add", 1, "x"); err == nil || err.Error() != "Parameter 2 should be a number" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	res, err = runTimeFunc("diff", 1608804672, 1608811872, "hour")
+	if err != nil || res != float64(2) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("diff", 1608804672, 1608804671.5)
+	if err != nil || res != float64(-0.5) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = runTimeFunc("diff", 1, 1, "month"); err == nil || err.Error() != "Unknown time unit: month" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestTimeMaps(t *testing.T) {
+
+	res, err := runTimeFunc("toMap", 1608804672, "UTC")
+	if err != nil || fmt.Sprint(res) != "map[day:24 hour:10 minute:11 month:12 nanosecond:0 "+
+		"offset:0 second:12 timezone:UTC weekday:4 year:2020 yearday:359 zone:UTC]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("convert", 1608804672, "America/New_York")
+	if err != nil || fmt.Sprint(res) != "map[day:24 hour:5 minute:11 month:12 nanosecond:0 "+
+		"offset:-18000 second:12 timezone:America/New_York weekday:4 year:2020 yearday:359 zone:EST]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("fromMap", res)
+	if err != nil || res != float64(1608804672) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("fromMap", map[interface{}]interface{}{
+		"year":     2020,
+		"timezone": "UTC",
+	})
+	if err != nil || res != float64(1577836800) {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	res, err = runTimeFunc("format", map[interface{}]interface{}{
+		"year":     2020,
+		"month":    2,
+		"day":      29,
+		"timezone": "UTC",
+	}, "Date")
+	if err != nil || res != "2020-02-29" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err = runTimeFunc("fromMap", map[interface{}]interface{}{
+		"year": "x",
+	}); err == nil || err.Error() != "Parameter 1 has an invalid year value: x" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runTimeFunc("fromMap", map[interface{}]interface{}{
+		"timezone": "foo",
+	}); err == nil || err.Error() != "Unknown timezone: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runTimeFunc("fromMap", 1); err == nil || err.Error() != "Parameter 1 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = runTimeFunc("convert", 1); err == nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for name, f := range timeFuncMap {
+		if doc, err := f.DocString(); doc == "" || err != nil {
+			t.Error("Missing docstring for:", name)
+			return
+		}
+	}
+}
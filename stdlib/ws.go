@@ -0,0 +1,348 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/krotik/ecal/engine"
+	"github.com/krotik/ecal/engine/source"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+wsFuncMap contains all functions of the ws package.
+*/
+var wsFuncMap = map[string]util.ECALFunction{
+	"connect": &wsConnectFunc{&baseFunc{}},
+	"send":    &wsSendFunc{&baseFunc{}},
+	"receive": &wsReceiveFunc{&baseFunc{}},
+	"close":   &wsCloseFunc{&baseFunc{}},
+	"listen":  &wsListenFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("ws", "WebSocket client connections and event sources.", wsFuncMap)
+}
+
+/*
+wsClient models an open WebSocket client connection.
+*/
+type wsClient struct {
+	conn      *websocket.Conn  // WebSocket connection
+	messages  chan interface{} // Received messages
+	err       error            // Error which ended the connection
+	writeLock *sync.Mutex      // Lock for writing to the connection
+	done      chan struct{}    // Closed once the connection was closed
+}
+
+/*
+wsAddress determines the network address (host:port) of a WebSocket URL.
+*/
+func wsAddress(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return rawurl
+	}
+
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	port := "80"
+	if u.Scheme == "wss" || u.Scheme == "https" {
+		port = "443"
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+/*
+AssertWSClientParam converts a general interface{} parameter into a WebSocket client.
+*/
+func (bf *baseFunc) AssertWSClientParam(index int, val interface{}) (*wsClient, error) {
+	if client, ok := getHandle(val).(*wsClient); ok {
+		return client, nil
+	}
+
+	return nil, fmt.Errorf("Parameter %v should be an open WebSocket connection", index)
+}
+
+// connect
+// =======
+
+/*
+wsConnectFunc opens a WebSocket connection.
+*/
+type wsConnectFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *wsConnectFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a URL")
+
+	if err == nil {
+		err = assertNetworkAllowed(is, wsAddress(fmt.Sprint(args[0])))
+	}
+
+	if err == nil {
+		header := http.Header{}
+
+		if len(args) > 1 {
+			var headerMap map[interface{}]interface{}
+
+			if headerMap, err = f.AssertMapParam(2, args[1]); err == nil {
+				for k, v := range headerMap {
+					header.Add(fmt.Sprint(k), fmt.Sprint(v))
+				}
+			}
+		}
+
+		if err == nil {
+			var conn *websocket.Conn
+
+			if conn, _, err = websocket.DefaultDialer.Dial(fmt.Sprint(args[0]), header); err == nil {
+				client := &wsClient{conn, make(chan interface{}, 1024), nil, &sync.Mutex{}, make(chan struct{})}
+
+				go func() {
+					for {
+						_, msg, err := conn.ReadMessage()
+						if err != nil {
+							client.err = err
+							close(client.messages)
+							return
+						}
+
+						// Stop reading if the connection was closed while nobody
+						// consumes the received messages
+
+						select {
+						case client.messages <- source.DecodeMessage(msg):
+						case <-client.done:
+							return
+						}
+					}
+				}()
+
+				res = addHandle("ws", client)
+
+			} else {
+
+				err = fmt.Errorf("Could not connect to %v: %v", args[0], err)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *wsConnectFunc) DocString() (string, error) {
+	return "Opens a WebSocket connection to a URL with an optional map of HTTP headers and returns a connection handle.", nil
+}
+
+// send
+// ====
+
+/*
+wsSendFunc sends a message over a WebSocket connection.
+*/
+type wsSendFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *wsSendFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 2, "a connection and a message")
+
+	if err == nil {
+		var client *wsClient
+
+		if client, err = f.AssertWSClientParam(1, args[0]); err == nil {
+			var msg []byte
+
+			if msg, err = source.EncodeMessage(args[1]); err == nil {
+				client.writeLock.Lock()
+				err = client.conn.WriteMessage(websocket.TextMessage, msg)
+				client.writeLock.Unlock()
+			}
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *wsSendFunc) DocString() (string, error) {
+	return "Sends a message over a WebSocket connection. Values which are not strings are sent as JSON.", nil
+}
+
+// receive
+// =======
+
+/*
+wsReceiveFunc receives a message from a WebSocket connection.
+*/
+type wsReceiveFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *wsReceiveFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a connection")
+
+	if err == nil {
+		var client *wsClient
+
+		if client, err = f.AssertWSClientParam(1, args[0]); err == nil {
+			var timeout <-chan time.Time
+
+			if len(args) > 1 {
+				var secs float64
+
+				if secs, err = f.AssertNumParam(2, args[1]); err == nil {
+					timeout = time.After(time.Duration(secs * float64(time.Second)))
+				}
+			}
+
+			if err == nil {
+				select {
+				case msg, ok := <-client.messages:
+					if ok {
+						res = msg
+					} else {
+						err = fmt.Errorf("Connection was closed: %v", client.err)
+					}
+				case <-timeout:
+				}
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *wsReceiveFunc) DocString() (string, error) {
+	return "Waits for a message from a WebSocket connection. Returns null if an optional timeout in seconds was reached.", nil
+}
+
+// close
+// =====
+
+/*
+wsCloseFunc closes a WebSocket connection or event source.
+*/
+type wsCloseFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *wsCloseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	err := f.AssertMinParams(args, 1, "a connection or an event source")
+
+	if err == nil {
+		switch handle := removeHandle(args[0]).(type) {
+		case *wsClient:
+			close(handle.done)
+			handle.writeLock.Lock()
+			handle.conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			handle.writeLock.Unlock()
+			err = handle.conn.Close()
+		case *source.WebSocketSource:
+			err = handle.Stop()
+		default:
+			err = fmt.Errorf("Parameter 1 should be an open WebSocket connection or event source")
+		}
+	}
+
+	return nil, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *wsCloseFunc) DocString() (string, error) {
+	return "Closes a WebSocket connection or event source.", nil
+}
+
+// listen
+// ======
+
+/*
+wsListenFunc starts a WebSocket event source.
+*/
+type wsListenFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *wsListenFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 4, "an address, a path, an event name and an event kind")
+
+	if err == nil {
+		var proc engine.Processor
+
+		if proc, err = runningProcessor(is); err == nil {
+			err = assertNetworkAllowed(is, fmt.Sprint(args[0]))
+		}
+
+		if err == nil {
+			src := source.NewWebSocketSource(proc, fmt.Sprint(args[0]), fmt.Sprint(args[1]),
+				fmt.Sprint(args[2]), strings.Split(fmt.Sprint(args[3]), "."))
+
+			if err = src.Start(); err == nil {
+				res = addHandle("wss", src)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *wsListenFunc) DocString() (string, error) {
+	return "Listens on an address and path for WebSocket connections and adds every received message as an event.", nil
+}
@@ -0,0 +1,235 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/krotik/ecal/engine"
+)
+
+type testEngineProvider struct {
+	proc engine.Processor
+}
+
+func (ep *testEngineProvider) GetProcessor() engine.Processor {
+	return ep.proc
+}
+
+type testSecureEngineProvider struct {
+	*testEngineProvider
+	*testSecurityPolicy
+}
+
+func runWSFunc(erp interface{}, name string, args ...interface{}) (interface{}, error) {
+	f, ok := GetStdlibFunc("ws." + name)
+	if !ok {
+		return nil, fmt.Errorf("Function %v not found", name)
+	}
+	return f.Run("", nil, map[string]interface{}{"erp": erp}, 0, args)
+}
+
+func TestWSClient(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte(r.Header.Get("X-Test")))
+
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(msg) == "bye" {
+				return
+			}
+			conn.WriteMessage(mt, msg)
+		}
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	policy := &testSecurityPolicy{allowed: []string{strings.TrimPrefix(server.URL, "http://"), "localhost:1"}}
+
+	if _, err := runWSFunc(nil, "connect", url); err == nil ||
+		err.Error() != fmt.Sprintf("Network access to %v is not allowed", strings.TrimPrefix(server.URL, "http://")) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runWSFunc(policy, "connect", "wss://example.com/foo"); err == nil ||
+		err.Error() != "Network access to example.com:443 is not allowed" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	conn, err := runWSFunc(policy, "connect", url, map[interface{}]interface{}{"X-Test": "welcome"})
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runWSFunc(policy, "receive", conn); err != nil || res != "welcome" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := runWSFunc(policy, "send", conn, map[interface{}]interface{}{"a": 1}); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if res, err := runWSFunc(policy, "receive", conn, 5); err != nil || fmt.Sprint(res) != "map[a:1]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := runWSFunc(policy, "receive", conn, 0.01); err != nil || res != nil {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	runWSFunc(policy, "send", conn, "bye")
+
+	if _, err := runWSFunc(policy, "receive", conn, 5); err == nil ||
+		!strings.HasPrefix(err.Error(), "Connection was closed") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runWSFunc(policy, "close", conn); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runWSFunc(policy, "send", conn, "foo"); err == nil ||
+		err.Error() != "Parameter 1 should be an open WebSocket connection" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runWSFunc(policy, "close", conn); err == nil ||
+		err.Error() != "Parameter 1 should be an open WebSocket connection or event source" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runWSFunc(policy, "connect", "ws://localhost:1/foo"); err == nil ||
+		!strings.HasPrefix(err.Error(), "Could not connect to ws://localhost:1/foo") {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runWSFunc(policy, "connect", url, 1); err == nil || err.Error() != "Parameter 2 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := runWSFunc(policy, "receive", "foo", "x"); err == nil ||
+		err.Error() != "Parameter 1 should be an open WebSocket connection" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	for name, f := range wsFuncMap {
+		if doc, err := f.DocString(); doc == "" || err != nil {
+			t.Error("Missing docstring for:", name)
+			return
+		}
+	}
+}
+
+func TestWSListen(t *testing.T) {
+	events := make(chan *engine.Event, 10)
+
+	proc := engine.NewProcessor(1)
+
+	proc.AddRule(&engine.Rule{
+		Name:       "TestRule",
+		KindMatch:  []string{"ws.message"},
+		ScopeMatch: []string{},
+		Action: func(p engine.Processor, m engine.Monitor, e *engine.Event, tid uint64) error {
+			events <- e
+			return nil
+		},
+	})
+	defer proc.Finish()
+
+	// Find a free port
+
+	l, _ := net.Listen("tcp", "localhost:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	ep := &testSecureEngineProvider{&testEngineProvider{proc}, &testSecurityPolicy{allowed: []string{addr}}}
+
+	if _, err := runWSFunc(&testEngineProvider{proc}, "listen", addr, "/events", "wsevent", "ws.message"); err == nil ||
+		err.Error() != fmt.Sprintf("Network access to %v is not allowed", addr) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	src, err := runWSFunc(ep, "listen", addr, "/events", "wsevent", "ws.message")
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	conn, err := runWSFunc(ep, "connect", fmt.Sprintf("ws://%v/events", addr))
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	runWSFunc(ep, "send", conn, []interface{}{1, 2})
+
+	select {
+	case e := <-events:
+		if e.Name() != "wsevent" || fmt.Sprint(e.State()["data"]) != "[1 2]" {
+			t.Error("Unexpected event:", e)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("No event received")
+		return
+	}
+
+	if _, err := runWSFunc(ep, "listen", addr, "/events", "wsevent", "ws.message"); err == nil {
+		t.Error("Address should be in use")
+		return
+	}
+
+	if _, err := runWSFunc(nil, "close", src); err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	runWSFunc(nil, "close", conn)
+
+	if _, err := runWSFunc(nil, "listen", addr, "/events", "wsevent", "ws.message"); err == nil ||
+		err.Error() != "No ECA engine available" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,306 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/krotik/common/sortutil"
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/util"
+)
+
+/*
+xmlFuncMap contains all functions of the xml package.
+*/
+var xmlFuncMap = map[string]util.ECALFunction{
+	"parse":     &xmlParseFunc{&baseFunc{}},
+	"stringify": &xmlStringifyFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("xml", "XML parsing and serialization functions.", xmlFuncMap)
+}
+
+/*
+Keys for attributes and text in element maps
+*/
+const (
+	xmlAttrPrefix = "@"
+	xmlTextKey    = "#text"
+)
+
+/*
+xmlElement is an element which is currently parsed.
+*/
+type xmlElement struct {
+	name     string
+	content  map[interface{}]interface{} // Attributes and child elements
+	text     strings.Builder             // Character data of the element
+	children bool                        // Flag if the element has child elements
+}
+
+/*
+add adds a value under a given key. Repeated keys are collected in a list.
+*/
+func (e *xmlElement) add(key string, val interface{}) {
+	if existing, ok := e.content[key]; ok {
+		if l, ok := existing.([]interface{}); ok {
+			e.content[key] = append(l, val)
+		} else {
+			e.content[key] = []interface{}{existing, val}
+		}
+	} else {
+		e.content[key] = val
+	}
+}
+
+/*
+value returns the ECAL value of a parsed element. Elements without attributes
+and child elements are represented by their text.
+*/
+func (e *xmlElement) value() interface{} {
+	text := strings.TrimSpace(e.text.String())
+
+	if len(e.content) == 0 {
+		return text
+	}
+
+	if text != "" {
+		e.content[xmlTextKey] = text
+	}
+
+	return e.content
+}
+
+// parse
+// =====
+
+/*
+xmlParseFunc parses an XML document into ECAL maps.
+*/
+type xmlParseFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *xmlParseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "an XML string")
+
+	if err == nil {
+		if res, err = f.parse(fmt.Sprint(args[0])); err != nil {
+			err = fmt.Errorf("Could not parse XML: %v", err)
+		}
+	}
+
+	return res, err
+}
+
+/*
+parse parses an XML string.
+*/
+func (f *xmlParseFunc) parse(str string) (interface{}, error) {
+	var stack []*xmlElement
+
+	root := &xmlElement{content: make(map[interface{}]interface{})}
+	stack = append(stack, root)
+
+	d := xml.NewDecoder(strings.NewReader(str))
+
+	for {
+		token, err := d.Token()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		current := stack[len(stack)-1]
+
+		switch t := token.(type) {
+
+		case xml.StartElement:
+			e := &xmlElement{name: t.Name.Local, content: make(map[interface{}]interface{})}
+
+			for _, a := range t.Attr {
+				if a.Name.Space != "xmlns" && a.Name.Local != "xmlns" {
+					e.content[xmlAttrPrefix+a.Name.Local] = a.Value
+				}
+			}
+
+			current.children = true
+			stack = append(stack, e)
+
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1].add(current.name, current.value())
+
+		case xml.CharData:
+			current.text.Write(t)
+		}
+	}
+
+	if !root.children {
+		return nil, fmt.Errorf("Document has no root element")
+	}
+
+	return root.content, nil
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *xmlParseFunc) DocString() (string, error) {
+	return "Parses an XML string into ECAL maps.", nil
+}
+
+// stringify
+// =========
+
+/*
+xmlStringifyFunc converts ECAL maps into an XML document.
+*/
+type xmlStringifyFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *xmlStringifyFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+	var doc map[interface{}]interface{}
+
+	err := f.AssertMinParams(args, 1, "a map")
+
+	if err == nil {
+		doc, err = f.AssertMapParam(1, args[0])
+	}
+
+	if err == nil && len(doc) != 1 {
+		err = fmt.Errorf("Document must have exactly one root element")
+	}
+
+	if err == nil {
+		var buf bytes.Buffer
+
+		e := xml.NewEncoder(&buf)
+
+		if len(args) > 1 && args[1] == true {
+			e.Indent("", "  ")
+		}
+
+		for k, v := range doc {
+			err = f.encode(e, fmt.Sprint(k), v)
+		}
+
+		if err == nil {
+			if err = e.Flush(); err == nil {
+				res = buf.String()
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+encode writes an ECAL value as one or more XML elements.
+*/
+func (f *xmlStringifyFunc) encode(e *xml.Encoder, name string, val interface{}) error {
+	var err error
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+
+	switch v := val.(type) {
+
+	case []interface{}:
+
+		// Lists are repeated elements
+
+		for _, lv := range v {
+			if err = f.encode(e, name, lv); err != nil {
+				break
+			}
+		}
+
+		return err
+
+	case map[interface{}]interface{}:
+		var keys []interface{}
+		var text interface{}
+
+		for k := range v {
+			keys = append(keys, k)
+		}
+
+		sortutil.InterfaceStrings(keys)
+
+		for _, k := range keys {
+			if ks := fmt.Sprint(k); strings.HasPrefix(ks, xmlAttrPrefix) {
+				start.Attr = append(start.Attr, xml.Attr{
+					Name:  xml.Name{Local: strings.TrimPrefix(ks, xmlAttrPrefix)},
+					Value: xmlText(v[k]),
+				})
+			}
+		}
+
+		if err = e.EncodeToken(start); err == nil {
+
+			if text = v[xmlTextKey]; text != nil {
+				err = e.EncodeToken(xml.CharData(xmlText(text)))
+			}
+
+			for _, k := range keys {
+				if ks := fmt.Sprint(k); err == nil && ks != xmlTextKey && !strings.HasPrefix(ks, xmlAttrPrefix) {
+					err = f.encode(e, ks, v[k])
+				}
+			}
+		}
+
+	default:
+		if err = e.EncodeToken(start); err == nil {
+			err = e.EncodeToken(xml.CharData(xmlText(v)))
+		}
+	}
+
+	if err == nil {
+		err = e.EncodeToken(start.End())
+	}
+
+	return err
+}
+
+/*
+xmlText converts an ECAL value into XML text.
+*/
+func xmlText(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *xmlStringifyFunc) DocString() (string, error) {
+	return "Converts ECAL maps into an XML string with an optional indentation flag.", nil
+}
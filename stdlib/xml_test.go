@@ -0,0 +1,98 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestXML(t *testing.T) {
+	parse, _ := GetStdlibFunc("xml.parse")
+	stringify, _ := GetStdlibFunc("xml.stringify")
+
+	res, err := parse.Run("", nil, nil, 0, []interface{}{`<?xml version="1.0" encoding="UTF-8"?>
+<!-- An order -->
+<order xmlns="urn:shop" id="123" status="new">
+  <customer>Foo &amp; Bar</customer>
+  <item sku="a1">Apple</item>
+  <item sku="b2"><amount>2</amount></item>
+  <note/>
+  Some text
+</order>`})
+
+	if err != nil || fmt.Sprint(res) != "map[order:map[#text:Some text @id:123 @status:new customer:Foo & Bar "+
+		"item:[map[#text:Apple @sku:a1] map[@sku:b2 amount:2]] note:]]" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	out, err := stringify.Run("", nil, nil, 0, []interface{}{res, true})
+
+	if err != nil || out != `<order id="123" status="new">Some text
+  <customer>Foo &amp; Bar</customer>
+  <item sku="a1">Apple</item>
+  <item sku="b2">
+    <amount>2</amount>
+  </item>
+  <note></note>
+</order>` {
+		t.Error("Unexpected result:", out, err)
+		return
+	}
+
+	out, err = stringify.Run("", nil, nil, 0, []interface{}{map[interface{}]interface{}{
+		"values": map[interface{}]interface{}{
+			"v":     []interface{}{1., true, nil},
+			"empty": []interface{}{},
+		},
+	}})
+
+	if err != nil || out != `<values><v>1</v><v>true</v><v></v></values>` {
+		t.Error("Unexpected result:", out, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := parse.Run("", nil, nil, 0, []interface{}{}); err == nil || err.Error() != "Need an XML string as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := parse.Run("", nil, nil, 0, []interface{}{"<a><b></a>"}); err == nil ||
+		err.Error() != "Could not parse XML: XML syntax error on line 1: element <b> closed by </a>" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := parse.Run("", nil, nil, 0, []interface{}{"foo"}); err == nil ||
+		err.Error() != "Could not parse XML: Document has no root element" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := stringify.Run("", nil, nil, 0, []interface{}{}); err == nil || err.Error() != "Need a map as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := stringify.Run("", nil, nil, 0, []interface{}{"a"}); err == nil || err.Error() != "Parameter 1 should be a map" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := stringify.Run("", nil, nil, 0, []interface{}{map[interface{}]interface{}{"a": 1., "b": 2.}}); err == nil ||
+		err.Error() != "Document must have exactly one root element" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/krotik/ecal/parser"
+	"github.com/krotik/ecal/scope"
+	"github.com/krotik/ecal/util"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+yamlFuncMap contains all functions of the yaml package.
+*/
+var yamlFuncMap = map[string]util.ECALFunction{
+	"parse":     &yamlParseFunc{&baseFunc{}},
+	"stringify": &yamlStringifyFunc{&baseFunc{}},
+}
+
+func init() {
+	addInternalStdlibPkg("yaml", "YAML parsing and serialization functions.", yamlFuncMap)
+}
+
+/*
+yamlValue converts an ECAL value into an object which can be marshalled into
+YAML. Only null, booleans, numbers, strings, lists and maps can be converted.
+*/
+func yamlValue(v interface{}) (interface{}, error) {
+	var err error
+
+	switch val := v.(type) {
+
+	case nil, bool, float64, string:
+		return val, nil
+
+	case []interface{}:
+		res := make([]interface{}, len(val))
+
+		for i, lv := range val {
+			if res[i], err = yamlValue(lv); err != nil {
+				return nil, err
+			}
+		}
+
+		return res, nil
+
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(val))
+
+		for mk, mv := range val {
+			if res[fmt.Sprint(mk)], err = yamlValue(mv); err != nil {
+				return nil, err
+			}
+		}
+
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("Cannot convert value to YAML: %v (type %T)", v, v)
+}
+
+/*
+yamlTimestamps replaces all timestamps in a parsed YAML document with strings
+(ECAL has no date type - the time package can parse them if required).
+*/
+func yamlTimestamps(v interface{}) interface{} {
+	switch val := v.(type) {
+
+	case time.Time:
+		if val.Equal(val.Truncate(24*time.Hour)) && val.Location() == time.UTC {
+			return val.Format("2006-01-02")
+		}
+		return val.Format(time.RFC3339Nano)
+
+	case []interface{}:
+		for i, lv := range val {
+			val[i] = yamlTimestamps(lv)
+		}
+
+	case map[string]interface{}:
+		for mk, mv := range val {
+			val[mk] = yamlTimestamps(mv)
+		}
+
+	case map[interface{}]interface{}:
+		for mk, mv := range val {
+			val[mk] = yamlTimestamps(mv)
+		}
+	}
+
+	return v
+}
+
+// parse
+// =====
+
+/*
+yamlParseFunc parses a YAML document into ECAL maps and lists.
+*/
+type yamlParseFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *yamlParseFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a YAML string")
+
+	if err == nil {
+		var doc interface{}
+
+		if err = yaml.Unmarshal([]byte(fmt.Sprint(args[0])), &doc); err == nil {
+			res = scope.ConvertGoToECALObject(yamlTimestamps(doc))
+		} else {
+			err = fmt.Errorf("Could not parse YAML: %v", err)
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *yamlParseFunc) DocString() (string, error) {
+	return "Parses a YAML string into ECAL maps and lists.", nil
+}
+
+// stringify
+// =========
+
+/*
+yamlStringifyFunc converts an ECAL value into a YAML document.
+*/
+type yamlStringifyFunc struct {
+	*baseFunc
+}
+
+/*
+Run executes this function.
+*/
+func (f *yamlStringifyFunc) Run(instanceID string, vs parser.Scope, is map[string]interface{}, tid uint64, args []interface{}) (interface{}, error) {
+	var res interface{}
+
+	err := f.AssertMinParams(args, 1, "a value")
+
+	if err == nil {
+		var val interface{}
+
+		if val, err = yamlValue(args[0]); err == nil {
+			var out []byte
+
+			if out, err = yaml.Marshal(val); err == nil {
+				res = string(out)
+			}
+		}
+	}
+
+	return res, err
+}
+
+/*
+DocString returns a descriptive string.
+*/
+func (f *yamlStringifyFunc) DocString() (string, error) {
+	return "Converts a value into a YAML string.", nil
+}
@@ -0,0 +1,112 @@
+/*
+ * ECAL
+ *
+ * Copyright 2020 Matthias Ladkau. All rights reserved.
+ *
+ * This Source Code Form is subject to the terms of the MIT
+ * License, If a copy of the MIT License was not distributed with this
+ * file, You can obtain one at https://opensource.org/licenses/MIT.
+ */
+
+package stdlib
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestYAML(t *testing.T) {
+	parse, _ := GetStdlibFunc("yaml.parse")
+	stringify, _ := GetStdlibFunc("yaml.stringify")
+
+	res, err := parse.Run("", nil, nil, 0, []interface{}{`
+name: myservice
+replicas: 3
+ratio: 0.5
+enabled: true
+created: 2020-01-01
+updated: 2020-01-01T10:11:12+01:00
+missing: ~
+ports:
+  - 80
+  - 443
+env:
+  DEBUG: "1"
+1: one
+`})
+
+	if err != nil {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	m := res.(map[interface{}]interface{})
+
+	if res := fmt.Sprint(m["name"], " ", m["replicas"], " ", m["ratio"], " ", m["enabled"], " ",
+		m["created"], " ", m["updated"], " ", m["missing"], " ", m["ports"], " ", m["env"], " ", m[1.]); res !=
+		"myservice 3 0.5 true 2020-01-01 2020-01-01T10:11:12+01:00 <nil> [80 443] map[DEBUG:1] one" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if _, ok := m["replicas"].(float64); !ok {
+		t.Error("Numbers should be float64:", m["replicas"])
+		return
+	}
+
+	res, err = stringify.Run("", nil, nil, 0, []interface{}{map[interface{}]interface{}{
+		"name":     "myservice",
+		"replicas": 3.,
+		"ratio":    0.5,
+		"ports":    []interface{}{80., 443.},
+		"env":      map[interface{}]interface{}{"DEBUG": "1"},
+		"missing":  nil,
+	}})
+
+	if err != nil || res != `env:
+    DEBUG: "1"
+missing: null
+name: myservice
+ports:
+    - 80
+    - 443
+ratio: 0.5
+replicas: 3
+` {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	// Round trip
+
+	res2, err := parse.Run("", nil, nil, 0, []interface{}{res})
+
+	if err != nil || fmt.Sprint(res2) != "map[env:map[DEBUG:1] missing:<nil> name:myservice ports:[80 443] ratio:0.5 replicas:3]" {
+		t.Error("Unexpected result:", res2, err)
+		return
+	}
+
+	// Test error cases
+
+	if _, err := parse.Run("", nil, nil, 0, []interface{}{}); err == nil || err.Error() != "Need a YAML string as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := parse.Run("", nil, nil, 0, []interface{}{"a: [1"}); err == nil ||
+		err.Error() != "Could not parse YAML: yaml: line 1: did not find expected ',' or ']'" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := stringify.Run("", nil, nil, 0, []interface{}{}); err == nil || err.Error() != "Need a value as parameter" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := stringify.Run("", nil, nil, 0, []interface{}{[]interface{}{stringify}}); err == nil ||
+		err.Error() != fmt.Sprintf("Cannot convert value to YAML: %v (type *stdlib.yamlStringifyFunc)", stringify) {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/krotik/ecal/config"
 	"github.com/krotik/ecal/parser"
 )
 
@@ -71,6 +72,12 @@ var (
 	ErrNotAMap          = errors.New("Operand is not a map")
 	ErrNotAListOrMap    = errors.New("Operand is not a list nor a map")
 	ErrSink             = errors.New("Error in sink")
+	ErrParallel         = errors.New("Error in parallel iteration")
+	ErrAssertionFailed  = errors.New("Assertion failed")
+	ErrTypeMismatch     = errors.New("Type mismatch")
+	ErrCancelled        = errors.New("Cancelled")
+	ErrMaxCallDepth     = errors.New("Maximum call depth exceeded")
+	ErrTimeout          = errors.New("Timeout")
 
 	// ErrReturn is not an error. It is used to return when executing a function
 	ErrReturn = errors.New("*** return ***")
@@ -79,6 +86,7 @@ var (
 	ErrIsIterator        = errors.New("Function is an iterator")
 	ErrEndOfIteration    = errors.New("End of iteration was reached")
 	ErrContinueIteration = errors.New("End of iteration step - Continue iteration")
+	ErrGeneratorStopped  = errors.New("Generator was stopped")
 )
 
 /*
@@ -107,6 +115,16 @@ func (re *RuntimeError) Error() string {
 	return ret
 }
 
+/*
+ErrorWithSource returns a human-readable string representation of this error
+followed by an excerpt of the given source code which shows the line of the
+error with a caret under the offending token. The output contains ANSI colors
+if the color flag is set.
+*/
+func (re *RuntimeError) ErrorWithSource(source string, color bool) string {
+	return parser.FormatErrorWithSource(re.Error(), source, re.Line, re.Pos, color)
+}
+
 /*
 AddTrace adds a trace step.
 */
@@ -125,11 +143,42 @@ func (re *RuntimeError) GetTrace() []*parser.ASTNode {
 GetTraceString returns the current stacktrace as a string.
 */
 func (re *RuntimeError) GetTraceString() []string {
+	return TraceString(re.GetTrace(), config.Int(config.TraceDepth))
+}
+
+/*
+TraceString returns a given stacktrace as a string. If the stacktrace has more
+than a given maximum number of frames (0 for no maximum) then only the first and
+the last frames are shown.
+*/
+func TraceString(trace []*parser.ASTNode, max int) []string {
 	res := []string{}
-	for _, t := range re.GetTrace() {
+
+	frame := func(t *parser.ASTNode) string {
 		pp, _ := parser.PrettyPrint(t)
-		res = append(res, fmt.Sprintf("%v (%v:%v)", pp, t.Token.Lsource, t.Token.Lline))
+		return fmt.Sprintf("%v (%v:%v)", pp, t.Token.Lsource, t.Token.Lline)
 	}
+
+	if max <= 0 || len(trace) <= max {
+		for _, t := range trace {
+			res = append(res, frame(t))
+		}
+		return res
+	}
+
+	head := (max + 1) / 2
+	tail := max - head
+
+	for _, t := range trace[:head] {
+		res = append(res, frame(t))
+	}
+
+	res = append(res, fmt.Sprintf("... %v frames omitted ...", len(trace)-max))
+
+	for _, t := range trace[len(trace)-tail:] {
+		res = append(res, frame(t))
+	}
+
 	return res
 }
 
@@ -32,6 +32,13 @@ func TestRuntimeError(t *testing.T) {
 		return
 	}
 
+	if res := err1.(*RuntimeError).ErrorWithSource("a", false); res != `ECAL error in foo: foo (bar) (Line:1 Pos:1)
+   1 | a
+     | ^` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
 	ast.Token = nil
 
 	err2 := NewRuntimeError("foo", fmt.Errorf("foo"), "bar", ast)
@@ -60,6 +67,22 @@ raise(c) (bar2:1)
 		return
 	}
 
+	// Long stacktraces show only the first and the last frames
+
+	trace = strings.Join(TraceString(err3.(TraceableRuntimeError).GetTrace(), 2), "\n")
+
+	if trace != `print(b) (bar1:1)
+... 1 frames omitted ...
+1 + d (bar3:1)` {
+		t.Error("Unexpected result:", trace)
+		return
+	}
+
+	if trace = strings.Join(TraceString(err3.(TraceableRuntimeError).GetTrace(), 0), "\n"); len(strings.Split(trace, "\n")) != 3 {
+		t.Error("Unexpected result:", trace)
+		return
+	}
+
 	err4 := &RuntimeErrorWithDetail{err3.(*RuntimeError), nil, nil}
 
 	res, _ := json.MarshalIndent(err4.RuntimeError, "", "  ")
@@ -68,7 +91,7 @@ raise(c) (bar2:1)
   "Node": {
     "Name": ":=",
     "Token": {
-      "ID": 39,
+      "ID": 45,
       "Pos": 1,
       "Val": ":=",
       "Identifier": false,
@@ -208,7 +231,7 @@ raise(c) (bar2:1)
     {
       "Name": "plus",
       "Token": {
-        "ID": 33,
+        "ID": 39,
         "Pos": 2,
         "Val": "+",
         "Identifier": false,
@@ -278,7 +301,7 @@ raise(c) (bar2:1)
   "Node": {
     "Name": ":=",
     "Token": {
-      "ID": 39,
+      "ID": 45,
       "Pos": 1,
       "Val": ":=",
       "Identifier": false,
@@ -418,7 +441,7 @@ raise(c) (bar2:1)
     {
       "Name": "plus",
       "Token": {
-        "ID": 33,
+        "ID": 39,
         "Pos": 2,
         "Val": "+",
         "Identifier": false,
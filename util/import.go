@@ -12,9 +12,12 @@ package util
 
 import (
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -57,7 +60,7 @@ func (il *FileImportLocator) Resolve(path string) (string, error) {
 
 	importPath := filepath.Clean(filepath.Join(il.Root, path))
 
-	ok, err := isSubpath(il.Root, importPath)
+	ok, err := IsSubpath(il.Root, importPath)
 
 	if err == nil && !ok {
 		err = fmt.Errorf("Import path is outside of code root: %v", path)
@@ -76,11 +79,186 @@ func (il *FileImportLocator) Resolve(path string) (string, error) {
 }
 
 /*
-isSubpath checks if the given sub path is a child path of root.
+ResolveImportPath resolves a relative slash separated import path (starting
+with ./ or ../) against the directory of the import path of the importing code.
+Other import paths are relative to the code root and are returned unchanged.
+Relative paths cannot point above the code root.
 */
-func isSubpath(root, sub string) (bool, error) {
+func ResolveImportPath(source string, importPath string) (string, error) {
+
+	if !strings.HasPrefix(importPath, "./") && !strings.HasPrefix(importPath, "../") {
+		return importPath, nil
+	}
+
+	res := path.Join(path.Dir(strings.TrimPrefix(source, "/")), importPath)
+
+	if res == ".." || strings.HasPrefix(res, "../") {
+		return "", fmt.Errorf("Import path is outside of code root: %v (imported from %v)",
+			importPath, source)
+	}
+
+	return res, nil
+}
+
+/*
+ResolveImportPath resolves a given import path of code with a given source
+name. The source name is either an import path or (for the entry file) a path
+on disk which is located in the root directory.
+*/
+func (il *FileImportLocator) ResolveImportPath(source string, importPath string) (string, error) {
+
+	if _, err := os.Stat(filepath.Join(il.Root, filepath.FromSlash(source))); err != nil {
+
+		// Source is not an import path - check if it is a file in the root directory
+
+		absRoot, err1 := filepath.Abs(il.Root)
+		absSource, err2 := filepath.Abs(source)
+
+		if err1 == nil && err2 == nil {
+			if ok, _ := IsSubpath(absRoot, absSource); ok {
+				rel, _ := filepath.Rel(absRoot, absSource)
+				source = filepath.ToSlash(rel)
+			}
+		}
+	}
+
+	return ResolveImportPath(source, importPath)
+}
+
+/*
+FSImportLocator provides files of a file system (e.g. an embed.FS) as imports.
+Import paths are slash separated paths relative to the root of the file system.
+*/
+type FSImportLocator struct {
+	FS fs.FS // File system which contains the code
+}
+
+/*
+Resolve a given import path and parse the imported file into an AST.
+*/
+func (il *FSImportLocator) Resolve(importPath string) (string, error) {
+	var res string
+	var err error
+
+	fsPath := path.Clean(strings.TrimPrefix(importPath, "/"))
+
+	if !fs.ValidPath(fsPath) {
+		err = fmt.Errorf("Import path is outside of code root: %v", importPath)
+	}
+
+	if err == nil {
+		var b []byte
+		if b, err = fs.ReadFile(il.FS, fsPath); err != nil {
+			err = fmt.Errorf("Could not import path %v: %v", importPath, err)
+		} else {
+			res = string(b)
+		}
+	}
+
+	return res, err
+}
+
+/*
+IsSubpath checks if the given sub path is a child path of root.
+*/
+func IsSubpath(root, sub string) (bool, error) {
 	rel, err := filepath.Rel(root, sub)
 	return err == nil &&
 		!strings.HasPrefix(rel, fmt.Sprintf("..%v", string(os.PathSeparator))) &&
 		rel != "..", err
 }
+
+// Bundles
+// =======
+
+/*
+bundleHeader is the first line of a bundle.
+*/
+const bundleHeader = "####ECALBUNDLE####\n"
+
+/*
+bundleFileMarker marks the beginning of a file in a bundle. The marker is
+followed by the import path of the file.
+*/
+const bundleFileMarker = "####ECALFILE#### "
+
+/*
+IsBundle checks if the given code is a bundle of several ECAL files.
+*/
+func IsBundle(code string) bool {
+	return strings.HasPrefix(code, bundleHeader)
+}
+
+/*
+CreateBundle bundles the given files (import path -> code) into a single
+string. The entry file is the first file in the bundle - all other files
+are ordered by their import path.
+*/
+func CreateBundle(entry string, files map[string]string) string {
+	var buf strings.Builder
+
+	writeFile := func(path string) {
+		buf.WriteString(fmt.Sprintf("%v%v\n", bundleFileMarker, path))
+		buf.WriteString(files[path])
+		if files[path] != "" && !strings.HasSuffix(files[path], "\n") {
+			buf.WriteString("\n")
+		}
+	}
+
+	buf.WriteString(bundleHeader)
+	writeFile(entry)
+
+	var paths []string
+	for path := range files {
+		if path != entry {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		writeFile(path)
+	}
+
+	return buf.String()
+}
+
+/*
+ParseBundle splits a bundle which was created by CreateBundle. Returns the
+import path of the entry file and an import locator for all bundled files.
+*/
+func ParseBundle(bundle string) (string, *MemoryImportLocator, error) {
+	var entry, path string
+	var code []string
+
+	if !IsBundle(bundle) {
+		return "", nil, fmt.Errorf("Not an ECAL bundle")
+	}
+
+	il := &MemoryImportLocator{Files: make(map[string]string)}
+
+	for _, line := range strings.SplitAfter(bundle[len(bundleHeader):], "\n") {
+		if strings.HasPrefix(line, bundleFileMarker) {
+			if path != "" {
+				il.Files[path] = strings.Join(code, "")
+			}
+
+			path, code = strings.TrimSpace(line[len(bundleFileMarker):]), nil
+
+			if entry == "" {
+				entry = path
+			}
+
+		} else if path != "" {
+			code = append(code, line)
+		}
+	}
+
+	if path == "" {
+		return "", nil, fmt.Errorf("ECAL bundle contains no files")
+	}
+
+	il.Files[path] = strings.Join(code, "")
+
+	return entry, il, nil
+}
@@ -17,6 +17,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/krotik/common/errorutil"
 	"github.com/krotik/common/fileutil"
@@ -118,3 +119,148 @@ func TestImportLocater(t *testing.T) {
 		return
 	}
 }
+
+func TestBundle(t *testing.T) {
+
+	bundle := CreateBundle("main.ecal", map[string]string{
+		"main.ecal":     "import \"lib/b.ecal\" as b\nimport \"a.ecal\" as a\n",
+		"lib/b.ecal":    "b := 1",
+		"a.ecal":        "a := 1\n\n",
+		"unused/c.ecal": "",
+	})
+
+	if bundle != `####ECALBUNDLE####
+####ECALFILE#### main.ecal
+import "lib/b.ecal" as b
+import "a.ecal" as a
+####ECALFILE#### a.ecal
+a := 1
+
+####ECALFILE#### lib/b.ecal
+b := 1
+####ECALFILE#### unused/c.ecal
+` {
+		t.Error("Unexpected result:", bundle)
+		return
+	}
+
+	if !IsBundle(bundle) || IsBundle("a := 1") {
+		t.Error("Unexpected result")
+		return
+	}
+
+	entry, il, err := ParseBundle(bundle)
+	errorutil.AssertOk(err)
+
+	if res := fmt.Sprintf("%v %q", entry, il.Files); res !=
+		`main.ecal map["a.ecal":"a := 1\n\n" "lib/b.ecal":"b := 1\n" "main.ecal":"import \"lib/b.ecal\" as b\nimport \"a.ecal\" as a\n" "unused/c.ecal":""]` {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if _, _, err := ParseBundle("a := 1"); err == nil || err.Error() != "Not an ECAL bundle" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, _, err := ParseBundle(bundleHeader); err == nil || err.Error() != "ECAL bundle contains no files" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestFSImportLocator(t *testing.T) {
+	fil := &FSImportLocator{fstest.MapFS{
+		"main.ecal":      &fstest.MapFile{Data: []byte("a := 1")},
+		"lib/utils.ecal": &fstest.MapFile{Data: []byte("b := 2")},
+	}}
+
+	res, err := fil.Resolve("main.ecal")
+	errorutil.AssertOk(err)
+
+	if res != "a := 1" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	res, err = fil.Resolve("/lib/../lib/utils.ecal")
+	errorutil.AssertOk(err)
+
+	if res != "b := 2" {
+		t.Error("Unexpected result:", res)
+		return
+	}
+
+	if _, err = fil.Resolve("../main.ecal"); err == nil ||
+		err.Error() != "Import path is outside of code root: ../main.ecal" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err = fil.Resolve("lib/foo.ecal"); err == nil ||
+		err.Error() != "Could not import path lib/foo.ecal: open lib/foo.ecal: file does not exist" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
+
+func TestResolveImportPath(t *testing.T) {
+
+	for _, tc := range [][]string{
+		{"main.ecal", "lib/a.ecal", "lib/a.ecal"},
+		{"lib/a.ecal", "lib/b.ecal", "lib/b.ecal"},
+		{"lib/a.ecal", "./b.ecal", "lib/b.ecal"},
+		{"lib/a.ecal", "./sub/../c.ecal", "lib/c.ecal"},
+		{"lib/sub/a.ecal", "../b.ecal", "lib/b.ecal"},
+		{"/lib/a.ecal", "../b.ecal", "b.ecal"},
+		{"main.ecal", "./b.ecal", "b.ecal"},
+		{"console input", "./b.ecal", "b.ecal"},
+	} {
+		if res, err := ResolveImportPath(tc[0], tc[1]); err != nil || res != tc[2] {
+			t.Error("Unexpected result:", tc, res, err)
+			return
+		}
+	}
+
+	if _, err := ResolveImportPath("lib/a.ecal", "../../b.ecal"); err == nil ||
+		err.Error() != "Import path is outside of code root: ../../b.ecal (imported from lib/a.ecal)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	if _, err := ResolveImportPath("main.ecal", "../b.ecal"); err == nil ||
+		err.Error() != "Import path is outside of code root: ../b.ecal (imported from main.ecal)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	// Entry files of a file import locator are paths on disk
+
+	if res, _ := fileutil.PathExists(importTestDir); res {
+		os.RemoveAll(importTestDir)
+	}
+
+	errorutil.AssertOk(os.MkdirAll(filepath.Join(importTestDir, "lib"), 0770))
+	defer os.RemoveAll(importTestDir)
+
+	entryFile := filepath.Join(importTestDir, "lib", "main.ecal")
+	errorutil.AssertOk(ioutil.WriteFile(entryFile, []byte("a := 1"), 0770))
+
+	fil := &FileImportLocator{importTestDir}
+
+	if res, err := fil.ResolveImportPath(entryFile, "./b.ecal"); err != nil || res != "lib/b.ecal" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if res, err := fil.ResolveImportPath("lib/main.ecal", "../b.ecal"); err != nil || res != "b.ecal" {
+		t.Error("Unexpected result:", res, err)
+		return
+	}
+
+	if _, err := fil.ResolveImportPath(entryFile, "../../b.ecal"); err == nil ||
+		err.Error() != "Import path is outside of code root: ../../b.ecal (imported from lib/main.ecal)" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"io"
 	"log"
 	"strings"
+	"sync"
 
 	"github.com/krotik/common/datautil"
 )
@@ -40,33 +41,56 @@ const (
 LogLevelLogger is a wrapper around loggers to add log level functionality.
 */
 type LogLevelLogger struct {
-	logger Logger
-	level  LogLevel
+	logger    Logger
+	level     LogLevel
+	levelLock *sync.RWMutex
 }
 
 /*
 NewLogLevelLogger wraps a given logger and adds level based filtering functionality.
 */
 func NewLogLevelLogger(logger Logger, level string) (*LogLevelLogger, error) {
-	llevel := LogLevel(strings.ToLower(level))
+	ll := &LogLevelLogger{
+		logger,
+		Info,
+		&sync.RWMutex{},
+	}
 
-	if llevel != Debug && llevel != Info && llevel != Error {
-		return nil, fmt.Errorf("Invalid log level: %v", llevel)
+	if err := ll.SetLevel(level); err != nil {
+		return nil, err
 	}
 
-	return &LogLevelLogger{
-		logger,
-		llevel,
-	}, nil
+	return ll, nil
 }
 
 /*
 Level returns the current log level.
 */
 func (ll *LogLevelLogger) Level() LogLevel {
+	ll.levelLock.RLock()
+	defer ll.levelLock.RUnlock()
+
 	return ll.level
 }
 
+/*
+SetLevel changes the log level. The level can be changed while the logger
+is in use.
+*/
+func (ll *LogLevelLogger) SetLevel(level string) error {
+	llevel := LogLevel(strings.ToLower(level))
+
+	if llevel != Debug && llevel != Info && llevel != Error {
+		return fmt.Errorf("Invalid log level: %v", llevel)
+	}
+
+	ll.levelLock.Lock()
+	ll.level = llevel
+	ll.levelLock.Unlock()
+
+	return nil
+}
+
 /*
 LogError adds a new error log message.
 */
@@ -78,7 +102,7 @@ func (ll *LogLevelLogger) LogError(m ...interface{}) {
 LogInfo adds a new info log message.
 */
 func (ll *LogLevelLogger) LogInfo(m ...interface{}) {
-	if ll.level == Info || ll.level == Debug {
+	if level := ll.Level(); level == Info || level == Debug {
 		ll.logger.LogInfo(m...)
 	}
 }
@@ -87,7 +111,7 @@ func (ll *LogLevelLogger) LogInfo(m ...interface{}) {
 LogDebug adds a new debug log message.
 */
 func (ll *LogLevelLogger) LogDebug(m ...interface{}) {
-	if ll.level == Debug {
+	if ll.Level() == Debug {
 		ll.logger.LogDebug(m...)
 	}
 }
@@ -110,6 +110,20 @@ error: ltest3` {
 		return
 	}
 
+	if err := ll.SetLevel("foo"); err == nil || err.Error() != "Invalid log level: foo" {
+		t.Error("Unexpected result:", err)
+		return
+	}
+
+	ml.Reset()
+	ll.SetLevel("Debug")
+	ll.LogDebug("l", "test1")
+
+	if ll.Level() != "debug" || ml.String() != `debug: ltest1` {
+		t.Error("Unexpected result:", ll.Level(), ml.String())
+		return
+	}
+
 	buf := bytes.NewBuffer(nil)
 	bl := NewBufferLogger(buf)
 	bl.LogDebug("l", "test1")
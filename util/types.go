@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/krotik/common/datautil"
+	"github.com/krotik/ecal/engine"
 	"github.com/krotik/ecal/engine/pool"
 	"github.com/krotik/ecal/parser"
 )
@@ -35,6 +36,146 @@ type ECALImportLocator interface {
 	Resolve(path string) (string, error)
 }
 
+/*
+ECALImportPathResolver can be implemented by import locators which need to
+control how relative import paths (starting with ./ or ../) are resolved. By
+default relative paths are resolved against the import path of the importing
+code (see ResolveImportPath).
+*/
+type ECALImportPathResolver interface {
+
+	/*
+		ResolveImportPath resolves a given import path of code with a given
+		source name to an import path which is relative to the code root.
+	*/
+	ResolveImportPath(source string, path string) (string, error)
+}
+
+/*
+ECALFileSandbox is implemented by runtime providers which allow stdlib functions
+to access the file system. All file operations are confined to the returned
+root directory. An empty root directory disables file operations.
+*/
+type ECALFileSandbox interface {
+
+	/*
+		GetFileRoot returns the root directory for file operations.
+	*/
+	GetFileRoot() string
+}
+
+/*
+ECALSecurityPolicy is implemented by runtime providers which allow stdlib functions
+to execute OS processes or to access the network.
+*/
+type ECALSecurityPolicy interface {
+
+	/*
+		IsExecAllowed checks if a given command may be executed.
+	*/
+	IsExecAllowed(cmd string) bool
+
+	/*
+		IsNetworkAllowed checks if a given network address (host:port) may be
+		connected to or listened on.
+	*/
+	IsNetworkAllowed(address string) bool
+}
+
+/*
+ECALDatabaseProvider is implemented by runtime providers which allow stdlib functions
+to connect to databases. Databases are configured by the embedder and are
+identified by a name.
+*/
+type ECALDatabaseProvider interface {
+
+	/*
+		GetDatabase returns the driver name and the data source name of a database.
+	*/
+	GetDatabase(name string) (string, string, bool)
+}
+
+/*
+ECALGraphStore is a graph database (e.g. EliasDB) which can be used by stdlib
+functions. Nodes and edges are maps which have at least a key and a kind.
+Edges additionally have the keys end1key, end1kind, end1role, end1cascading,
+end2key, end2kind, end2role and end2cascading.
+*/
+type ECALGraphStore interface {
+
+	/*
+		Query runs a query in a partition and returns its result.
+	*/
+	Query(partition string, query string) (interface{}, error)
+
+	/*
+		FetchNode fetches a node. Returns nil if the node does not exist.
+	*/
+	FetchNode(partition string, key string, kind string) (map[string]interface{}, error)
+
+	/*
+		StoreNode stores a node. An existing node is updated.
+	*/
+	StoreNode(partition string, node map[string]interface{}) error
+
+	/*
+		RemoveNode removes a node and all its edges.
+	*/
+	RemoveNode(partition string, key string, kind string) error
+
+	/*
+		StoreEdge stores an edge between two nodes. An existing edge is updated.
+	*/
+	StoreEdge(partition string, edge map[string]interface{}) error
+
+	/*
+		RemoveEdge removes an edge.
+	*/
+	RemoveEdge(partition string, key string, kind string) error
+
+	/*
+		Traverse follows all edges of a node which match a traversal spec
+		(e.g. :::) and returns the found nodes and traversed edges.
+	*/
+	Traverse(partition string, key string, kind string, spec string) ([]map[string]interface{}, []map[string]interface{}, error)
+}
+
+/*
+ECALGraphProvider is implemented by runtime providers which allow stdlib functions
+to access a graph database.
+*/
+type ECALGraphProvider interface {
+
+	/*
+		GetGraphStore returns the graph store or nil if no graph store is available.
+	*/
+	GetGraphStore() ECALGraphStore
+}
+
+/*
+ECALArgsProvider is implemented by runtime providers which give stdlib functions
+access to the arguments of the running program.
+*/
+type ECALArgsProvider interface {
+
+	/*
+		GetArgs returns the program arguments.
+	*/
+	GetArgs() []string
+}
+
+/*
+ECALEngineProvider is implemented by runtime providers which give stdlib functions
+access to the processor of the ECA engine.
+*/
+type ECALEngineProvider interface {
+
+	/*
+		GetProcessor returns the processor of the ECA engine.
+	*/
+	GetProcessor() engine.Processor
+}
+
 /*
 ECALFunction models a callable function in ECAL.
 */
@@ -55,6 +196,29 @@ type ECALFunction interface {
 	DocString() (string, error)
 }
 
+/*
+ECALObject models a map-like object whose fields can be read and written by
+ECAL code with the normal access operators (e.g. a Go value which is bridged
+into ECAL).
+*/
+type ECALObject interface {
+
+	/*
+		GetField returns the value of a field and if the field exists.
+	*/
+	GetField(name string) (interface{}, bool, error)
+
+	/*
+		SetField sets the value of a field.
+	*/
+	SetField(name string, value interface{}) error
+
+	/*
+		FieldNames returns the names of all fields of this object.
+	*/
+	FieldNames() []string
+}
+
 /*
 ECALPluginFunction models a callable function in ECAL which can be imported via a plugin.
 */
@@ -71,6 +235,40 @@ type ECALPluginFunction interface {
 	DocString() string
 }
 
+/*
+ECALPluginAPIVersion is the version of the plugin API which is supported by
+this interpreter. Plugins which declare a different API version in their
+manifest are rejected.
+*/
+const ECALPluginAPIVersion = 1
+
+/*
+ECALPluginManifestSymbol is the symbol of the optional manifest in a plugin.
+*/
+const ECALPluginManifestSymbol = "ECALPluginManifest"
+
+/*
+ECALPluginManifest describes a plugin which provides stdlib functions. A plugin
+can export a manifest as variable ECALPluginManifest.
+*/
+type ECALPluginManifest interface {
+
+	/*
+		Name returns the name of the plugin.
+	*/
+	Name() string
+
+	/*
+		Version returns the version of the plugin.
+	*/
+	Version() string
+
+	/*
+		APIVersion returns the plugin API version the plugin was written for.
+	*/
+	APIVersion() int
+}
+
 /*
 Logger is required external object to which the interpreter releases its log messages.
 */
@@ -107,6 +305,28 @@ const (
 	StepOut                  // Step out of the current function call
 )
 
+/*
+DebugSession contains the break points and settings of a debugger which can be
+stored between debugging sessions.
+*/
+type DebugSession struct {
+	BreakPoints     []*DebugBreakPoint `json:"breakpoints"`         // Break points
+	BreakOnStart    bool               `json:"breakonstart"`        // Flag to stop at the start of the next execution
+	BreakOnError    bool               `json:"breakonerror"`        // Flag to stop if an error occurs
+	VariableWatches []string           `json:"watchvars,omitempty"` // Watched variables (data break points)
+}
+
+/*
+DebugBreakPoint is a break point of a debug session.
+*/
+type DebugBreakPoint struct {
+	Source    string `json:"source"`              // Source of the break point
+	Line      int    `json:"line"`                // Line of the break point
+	Disabled  bool   `json:"disabled,omitempty"`  // Flag if the break point is disabled
+	Condition string `json:"condition,omitempty"` // Condition of the break point (ECAL expression)
+	HitCount  int    `json:"hitCount,omitempty"`  // Break only on every n-th hit
+}
+
 /*
 ECALDebugger is a debugging object which can be used to inspect and modify a running
 ECAL environment.
@@ -136,6 +356,23 @@ type ECALDebugger interface {
 	*/
 	BreakOnError(flag bool)
 
+	/*
+	   SetHistorySize sets the number of states which are recorded for each
+	   thread. A size of 0 disables the recording.
+	*/
+	SetHistorySize(size int)
+
+	/*
+	   Session returns the break points and settings of the debugger.
+	*/
+	Session() *DebugSession
+
+	/*
+	   LoadSession replaces the break points and settings of the debugger with
+	   the ones of a given session.
+	*/
+	LoadSession(session *DebugSession) error
+
 	/*
 	   SetLockingState sets locking status information.
 	*/
@@ -167,9 +404,38 @@ type ECALDebugger interface {
 	RecordThreadFinished(tid uint64)
 
 	/*
-	   SetBreakPoint sets a break point.
+	   SetBreakPoint sets a break point. The break point can have an optional
+	   condition (ECAL expression) and a hit count (break only on every n-th hit).
+	*/
+	SetBreakPoint(source string, line int, condition string, hitCount int) error
+
+	/*
+	   History returns the last recorded states of a thread.
 	*/
-	SetBreakPoint(source string, line int)
+	History(threadID uint64) interface{}
+
+	/*
+	   SetWatch adds a watch expression to a thread. The thread is suspended
+	   when the value of the expression changes.
+	*/
+	SetWatch(threadID uint64, expression string) error
+
+	/*
+	   RemoveWatch removes a watch expression from a thread. All watch
+	   expressions of the thread are removed if no expression is given.
+	*/
+	RemoveWatch(threadID uint64, expression string)
+
+	/*
+	   SetVariableWatch adds a data break point for a variable. Every thread
+	   which changes the value of the variable is suspended.
+	*/
+	SetVariableWatch(name string)
+
+	/*
+	   RemoveVariableWatch removes a data break point for a variable.
+	*/
+	RemoveVariableWatch(name string)
 
 	/*
 	   DisableBreakPoint disables a break point but keeps the code reference.
@@ -193,11 +459,23 @@ type ECALDebugger interface {
 	*/
 	InjectValue(threadID uint64, varName string, expression string) error
 
+	/*
+		EvaluateExpression evaluates an expression in the variable scope of a
+		suspended thread without changing the variables of the thread.
+	*/
+	EvaluateExpression(threadID uint64, expression string) (interface{}, error)
+
 	/*
 	   Continue will continue a suspended thread.
 	*/
 	Continue(threadID uint64, contType ContType)
 
+	/*
+	   KillThread raises a Cancelled error in a thread on its next state change.
+	   A suspended thread is resumed.
+	*/
+	KillThread(threadID uint64)
+
 	/*
 		Status returns the current status of the debugger.
 	*/